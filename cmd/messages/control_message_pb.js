@@ -0,0 +1,575 @@
+// source: cmd/messages/control_message.proto
+/**
+ * @fileoverview
+ * @enhanceable
+ * @suppress {missingRequire} reports error on implicit type usages.
+ * @suppress {messageConventions} JS Compiler reports an error if a variable or
+ *     field starts with 'MSG_' and isn't a translatable message.
+ * @public
+ */
+// GENERATED CODE -- DO NOT EDIT!
+/* eslint-disable */
+// @ts-nocheck
+
+
+goog.provide('proto.ControlCommand');
+goog.provide('proto.ControlMessage');
+goog.provide('proto.ParamValues');
+
+goog.require('jspb.BinaryReader');
+goog.require('jspb.BinaryWriter');
+goog.require('jspb.Message');
+goog.require('jspb.internal.public_for_gencode');
+
+/**
+ * Generated by JsPbCodeGenerator.
+ * @param {Array=} opt_data Optional initial data array, typically from a
+ * server response, or constructed directly in Javascript. The array is used
+ * in place and becomes part of the constructed object. It is not cloned.
+ * If no data is provided, the constructed object will be empty, but still
+ * valid.
+ * @extends {jspb.Message}
+ * @constructor
+ */
+proto.ParamValues = function(opt_data) {
+  jspb.Message.initialize(this, opt_data, 0, -1, proto.ParamValues.repeatedFields_, null);
+};
+goog.inherits(proto.ParamValues, jspb.Message);
+if (goog.DEBUG && !COMPILED) {
+  /**
+   * @public
+   * @override
+   */
+  proto.ParamValues.displayName = 'proto.ParamValues';
+}
+
+/**
+ * Generated by JsPbCodeGenerator.
+ * @param {Array=} opt_data Optional initial data array, typically from a
+ * server response, or constructed directly in Javascript. The array is used
+ * in place and becomes part of the constructed object. It is not cloned.
+ * If no data is provided, the constructed object will be empty, but still
+ * valid.
+ * @extends {jspb.Message}
+ * @constructor
+ */
+proto.ControlMessage = function(opt_data) {
+  jspb.Message.initialize(this, opt_data, 0, -1, proto.ControlMessage.repeatedFields_, null);
+};
+goog.inherits(proto.ControlMessage, jspb.Message);
+if (goog.DEBUG && !COMPILED) {
+  /**
+   * @public
+   * @override
+   */
+  proto.ControlMessage.displayName = 'proto.ControlMessage';
+}
+
+/**
+ * List of repeated fields within this message type.
+ * @private {!Array<number>}
+ * @const
+ */
+proto.ParamValues.repeatedFields_ = [2];
+
+
+
+if (jspb.Message.GENERATE_TO_OBJECT) {
+/**
+ * Creates an object representation of this proto.
+ * Field names that are reserved in JavaScript and will be renamed to pb_name.
+ * Optional fields that are not set will be set to undefined.
+ * To access a reserved field use, foo.pb_<name>, eg, foo.pb_default.
+ * For the list of reserved names please see:
+ *     net/proto2/compiler/js/internal/generator.cc#kKeyword.
+ * @param {boolean=} opt_includeInstance Deprecated. whether to include the
+ *     JSPB instance for transitional soy proto support:
+ *     http://goto/soy-param-migration
+ * @return {!Object}
+ */
+proto.ParamValues.prototype.toObject = function(opt_includeInstance) {
+  return proto.ParamValues.toObject(opt_includeInstance, this);
+};
+
+
+/**
+ * Static version of the {@see toObject} method.
+ * @param {boolean|undefined} includeInstance Deprecated. Whether to include
+ *     the JSPB instance for transitional soy proto support:
+ *     http://goto/soy-param-migration
+ * @param {!proto.ParamValues} msg The msg instance to transform.
+ * @return {!Object}
+ * @suppress {unusedLocalVariables} f is only used for nested messages
+ */
+proto.ParamValues.toObject = function(includeInstance, msg) {
+  var f, obj = {
+name: jspb.Message.getFieldWithDefault(msg, 1, ""),
+valuesList: (f = jspb.Message.getRepeatedFloatingPointField(msg, 2)) == null ? undefined : f
+  };
+
+  if (includeInstance) {
+    obj.$jspbMessageInstance = msg;
+  }
+  return obj;
+};
+}
+
+
+/**
+ * Deserializes binary data (in protobuf wire format).
+ * @param {jspb.ByteSource} bytes The bytes to deserialize.
+ * @return {!proto.ParamValues}
+ */
+proto.ParamValues.deserializeBinary = function(bytes) {
+  var reader = new jspb.BinaryReader(bytes);
+  var msg = new proto.ParamValues;
+  return proto.ParamValues.deserializeBinaryFromReader(msg, reader);
+};
+
+
+/**
+ * Deserializes binary data (in protobuf wire format) from the
+ * given reader into the given message object.
+ * @param {!proto.ParamValues} msg The message object to deserialize into.
+ * @param {!jspb.BinaryReader} reader The BinaryReader to use.
+ * @return {!proto.ParamValues}
+ */
+proto.ParamValues.deserializeBinaryFromReader = function(msg, reader) {
+  while (reader.nextField()) {
+    if (reader.isEndGroup()) {
+      break;
+    }
+    var field = reader.getFieldNumber();
+    switch (field) {
+    case 1:
+      var value = /** @type {string} */ (reader.readStringRequireUtf8());
+      msg.setName(value);
+      break;
+    case 2:
+      reader.readPackableDoubleInto(msg.getValuesList());
+      break;
+    default:
+      reader.skipField();
+      break;
+    }
+  }
+  return msg;
+};
+
+
+/**
+ * Serializes the message to binary data (in protobuf wire format).
+ * @return {!Uint8Array}
+ */
+proto.ParamValues.prototype.serializeBinary = function() {
+  var writer = new jspb.BinaryWriter();
+  proto.ParamValues.serializeBinaryToWriter(this, writer);
+  return writer.getResultBuffer();
+};
+
+
+/**
+ * Serializes the given message to binary data (in protobuf wire
+ * format), writing to the given BinaryWriter.
+ * @param {!proto.ParamValues} message
+ * @param {!jspb.BinaryWriter} writer
+ * @suppress {unusedLocalVariables} f is only used for nested messages
+ */
+proto.ParamValues.serializeBinaryToWriter = function(message, writer) {
+  var f = undefined;
+  f = message.getName();
+  if (f.length > 0) {
+    writer.writeString(
+      1,
+      f
+    );
+  }
+  f = message.getValuesList();
+  if (f.length > 0) {
+    writer.writePackedDouble(
+      2,
+      f
+    );
+  }
+};
+
+
+/**
+ * optional string name = 1;
+ * @return {string}
+ */
+proto.ParamValues.prototype.getName = function() {
+  return /** @type {string} */ (jspb.Message.getFieldWithDefault(this, 1, ""));
+};
+
+
+/**
+ * @param {string} value
+ * @return {!proto.ParamValues} returns this
+ */
+proto.ParamValues.prototype.setName = function(value) {
+  return jspb.Message.setProto3StringField(this, 1, value);
+};
+
+
+/**
+ * repeated double values = 2;
+ * @return {!Array<number>}
+ */
+proto.ParamValues.prototype.getValuesList = function() {
+  return /** @type {!Array<number>} */ (jspb.Message.getRepeatedFloatingPointField(this, 2));
+};
+
+
+/**
+ * @param {!Array<number>} value
+ * @return {!proto.ParamValues} returns this
+ */
+proto.ParamValues.prototype.setValuesList = function(value) {
+  return jspb.Message.setField(this, 2, value || []);
+};
+
+
+/**
+ * @param {number} value
+ * @param {number=} opt_index
+ * @return {!proto.ParamValues} returns this
+ */
+proto.ParamValues.prototype.addValues = function(value, opt_index) {
+  return jspb.Message.addToRepeatedField(this, 2, value, opt_index);
+};
+
+
+/**
+ * Clears the list making it empty but non-null.
+ * @return {!proto.ParamValues} returns this
+ */
+proto.ParamValues.prototype.clearValuesList = function() {
+  return this.setValuesList([]);
+};
+
+
+
+/**
+ * List of repeated fields within this message type.
+ * @private {!Array<number>}
+ * @const
+ */
+proto.ControlMessage.repeatedFields_ = [5];
+
+
+
+if (jspb.Message.GENERATE_TO_OBJECT) {
+/**
+ * Creates an object representation of this proto.
+ * Field names that are reserved in JavaScript and will be renamed to pb_name.
+ * Optional fields that are not set will be set to undefined.
+ * To access a reserved field use, foo.pb_<name>, eg, foo.pb_default.
+ * For the list of reserved names please see:
+ *     net/proto2/compiler/js/internal/generator.cc#kKeyword.
+ * @param {boolean=} opt_includeInstance Deprecated. whether to include the
+ *     JSPB instance for transitional soy proto support:
+ *     http://goto/soy-param-migration
+ * @return {!Object}
+ */
+proto.ControlMessage.prototype.toObject = function(opt_includeInstance) {
+  return proto.ControlMessage.toObject(opt_includeInstance, this);
+};
+
+
+/**
+ * Static version of the {@see toObject} method.
+ * @param {boolean|undefined} includeInstance Deprecated. Whether to include
+ *     the JSPB instance for transitional soy proto support:
+ *     http://goto/soy-param-migration
+ * @param {!proto.ControlMessage} msg The msg instance to transform.
+ * @return {!Object}
+ * @suppress {unusedLocalVariables} f is only used for nested messages
+ */
+proto.ControlMessage.toObject = function(includeInstance, msg) {
+  var f, obj = {
+command: jspb.Message.getFieldWithDefault(msg, 1, 0),
+steps: jspb.Message.getFieldWithDefault(msg, 2, 0),
+stepDelayMilliseconds: jspb.Message.getFloatingPointFieldWithDefault(msg, 3, 0.0),
+partitionName: jspb.Message.getFieldWithDefault(msg, 4, ""),
+paramsList: jspb.Message.toObjectList(msg.getParamsList(),
+    proto.ParamValues.toObject, includeInstance),
+requestId: jspb.Message.getFieldWithDefault(msg, 6, 0)
+  };
+
+  if (includeInstance) {
+    obj.$jspbMessageInstance = msg;
+  }
+  return obj;
+};
+}
+
+
+/**
+ * Deserializes binary data (in protobuf wire format).
+ * @param {jspb.ByteSource} bytes The bytes to deserialize.
+ * @return {!proto.ControlMessage}
+ */
+proto.ControlMessage.deserializeBinary = function(bytes) {
+  var reader = new jspb.BinaryReader(bytes);
+  var msg = new proto.ControlMessage;
+  return proto.ControlMessage.deserializeBinaryFromReader(msg, reader);
+};
+
+
+/**
+ * Deserializes binary data (in protobuf wire format) from the
+ * given reader into the given message object.
+ * @param {!proto.ControlMessage} msg The message object to deserialize into.
+ * @param {!jspb.BinaryReader} reader The BinaryReader to use.
+ * @return {!proto.ControlMessage}
+ */
+proto.ControlMessage.deserializeBinaryFromReader = function(msg, reader) {
+  while (reader.nextField()) {
+    if (reader.isEndGroup()) {
+      break;
+    }
+    var field = reader.getFieldNumber();
+    switch (field) {
+    case 1:
+      var value = /** @type {!proto.ControlCommand} */ (reader.readEnum());
+      msg.setCommand(value);
+      break;
+    case 2:
+      var value = /** @type {number} */ (reader.readUint32());
+      msg.setSteps(value);
+      break;
+    case 3:
+      var value = /** @type {number} */ (reader.readDouble());
+      msg.setStepDelayMilliseconds(value);
+      break;
+    case 4:
+      var value = /** @type {string} */ (reader.readStringRequireUtf8());
+      msg.setPartitionName(value);
+      break;
+    case 5:
+      var value = new proto.ParamValues;
+      reader.readMessage(value,proto.ParamValues.deserializeBinaryFromReader);
+      msg.addParams(value);
+      break;
+    case 6:
+      var value = /** @type {number} */ (reader.readUint64());
+      msg.setRequestId(value);
+      break;
+    default:
+      reader.skipField();
+      break;
+    }
+  }
+  return msg;
+};
+
+
+/**
+ * Serializes the message to binary data (in protobuf wire format).
+ * @return {!Uint8Array}
+ */
+proto.ControlMessage.prototype.serializeBinary = function() {
+  var writer = new jspb.BinaryWriter();
+  proto.ControlMessage.serializeBinaryToWriter(this, writer);
+  return writer.getResultBuffer();
+};
+
+
+/**
+ * Serializes the given message to binary data (in protobuf wire
+ * format), writing to the given BinaryWriter.
+ * @param {!proto.ControlMessage} message
+ * @param {!jspb.BinaryWriter} writer
+ * @suppress {unusedLocalVariables} f is only used for nested messages
+ */
+proto.ControlMessage.serializeBinaryToWriter = function(message, writer) {
+  var f = undefined;
+  f = message.getCommand();
+  if (f !== 0.0) {
+    writer.writeEnum(
+      1,
+      f
+    );
+  }
+  f = message.getSteps();
+  if (f !== 0) {
+    writer.writeUint32(
+      2,
+      f
+    );
+  }
+  f = message.getStepDelayMilliseconds();
+  if (f !== 0.0) {
+    writer.writeDouble(
+      3,
+      f
+    );
+  }
+  f = message.getPartitionName();
+  if (f.length > 0) {
+    writer.writeString(
+      4,
+      f
+    );
+  }
+  f = message.getParamsList();
+  if (f.length > 0) {
+    writer.writeRepeatedMessage(
+      5,
+      f,
+      proto.ParamValues.serializeBinaryToWriter
+    );
+  }
+  f = message.getRequestId();
+  if (f !== 0) {
+    writer.writeUint64(
+      6,
+      f
+    );
+  }
+};
+
+
+/**
+ * optional ControlCommand command = 1;
+ * @return {!proto.ControlCommand}
+ */
+proto.ControlMessage.prototype.getCommand = function() {
+  return /** @type {!proto.ControlCommand} */ (jspb.Message.getFieldWithDefault(this, 1, 0));
+};
+
+
+/**
+ * @param {!proto.ControlCommand} value
+ * @return {!proto.ControlMessage} returns this
+ */
+proto.ControlMessage.prototype.setCommand = function(value) {
+  return jspb.Message.setProto3EnumField(this, 1, value);
+};
+
+
+/**
+ * optional uint32 steps = 2;
+ * @return {number}
+ */
+proto.ControlMessage.prototype.getSteps = function() {
+  return /** @type {number} */ (jspb.Message.getFieldWithDefault(this, 2, 0));
+};
+
+
+/**
+ * @param {number} value
+ * @return {!proto.ControlMessage} returns this
+ */
+proto.ControlMessage.prototype.setSteps = function(value) {
+  return jspb.Message.setProto3IntField(this, 2, value);
+};
+
+
+/**
+ * optional double step_delay_milliseconds = 3;
+ * @return {number}
+ */
+proto.ControlMessage.prototype.getStepDelayMilliseconds = function() {
+  return /** @type {number} */ (jspb.Message.getFloatingPointFieldWithDefault(this, 3, 0.0));
+};
+
+
+/**
+ * @param {number} value
+ * @return {!proto.ControlMessage} returns this
+ */
+proto.ControlMessage.prototype.setStepDelayMilliseconds = function(value) {
+  return jspb.Message.setProto3FloatField(this, 3, value);
+};
+
+
+/**
+ * optional string partition_name = 4;
+ * @return {string}
+ */
+proto.ControlMessage.prototype.getPartitionName = function() {
+  return /** @type {string} */ (jspb.Message.getFieldWithDefault(this, 4, ""));
+};
+
+
+/**
+ * @param {string} value
+ * @return {!proto.ControlMessage} returns this
+ */
+proto.ControlMessage.prototype.setPartitionName = function(value) {
+  return jspb.Message.setProto3StringField(this, 4, value);
+};
+
+
+/**
+ * repeated ParamValues params = 5;
+ * @return {!Array<!proto.ParamValues>}
+ */
+proto.ControlMessage.prototype.getParamsList = function() {
+  return /** @type{!Array<!proto.ParamValues>} */ (
+    jspb.Message.getRepeatedWrapperField(this, proto.ParamValues, 5));
+};
+
+
+/**
+ * @param {!Array<!proto.ParamValues>} value
+ * @return {!proto.ControlMessage} returns this
+*/
+proto.ControlMessage.prototype.setParamsList = function(value) {
+  return jspb.Message.setRepeatedWrapperField(this, 5, value);
+};
+
+
+/**
+ * @param {!proto.ParamValues=} opt_value
+ * @param {number=} opt_index
+ * @return {!proto.ParamValues}
+ */
+proto.ControlMessage.prototype.addParams = function(opt_value, opt_index) {
+  return jspb.Message.addToRepeatedWrapperField(this, 5, opt_value, proto.ParamValues, opt_index);
+};
+
+
+/**
+ * Clears the list making it empty but non-null.
+ * @return {!proto.ControlMessage} returns this
+ */
+proto.ControlMessage.prototype.clearParamsList = function() {
+  return this.setParamsList([]);
+};
+
+
+/**
+ * optional uint64 request_id = 6;
+ * @return {number}
+ */
+proto.ControlMessage.prototype.getRequestId = function() {
+  return /** @type {number} */ (jspb.Message.getFieldWithDefault(this, 6, 0));
+};
+
+
+/**
+ * @param {number} value
+ * @return {!proto.ControlMessage} returns this
+ */
+proto.ControlMessage.prototype.setRequestId = function(value) {
+  return jspb.Message.setProto3IntField(this, 6, value);
+};
+
+
+
+/**
+ * @enum {number}
+ */
+proto.ControlCommand = {
+  CONTROL_COMMAND_UNSPECIFIED: 0,
+  CONTROL_COMMAND_PAUSE: 1,
+  CONTROL_COMMAND_RESUME: 2,
+  CONTROL_COMMAND_STEP: 3,
+  CONTROL_COMMAND_SET_STEP_DELAY: 4,
+  CONTROL_COMMAND_SET_PARAMS: 5,
+  CONTROL_COMMAND_SNAPSHOT: 6
+};
+
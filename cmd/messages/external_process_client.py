@@ -0,0 +1,130 @@
+"""Reference Python client for the external_process iteration.
+
+An external_process partition launches a subprocess and talks to it over the
+protocol in external_process.proto: length-prefixed ExternalProcessRequest
+messages on the subprocess's stdin, one ExternalProcessResponse per request on
+its stdout. This module implements that loop, so a Python component only has
+to supply the step function.
+
+A model script imports it and calls serve:
+
+    import sys
+    sys.path.insert(0, "path/to/stochadex/cmd/messages")
+    from external_process_client import history_rows, param, serve
+
+    def iterate(request):
+        state = history_rows(request.state_histories[0])[0]
+        rate = param(request, "rate")
+        return [x + r * request.timestep for x, r in zip(state, rate)]
+
+    serve(iterate)
+
+and the config points a partition at it:
+
+    iteration:
+      type: external_process
+      command: [python3, model.py]
+
+Requires the protobuf package (pip install protobuf). Nothing but protocol
+messages may be written to stdout, so serve redirects sys.stdout to stderr
+while it runs: print() output from the model ends up on the run's stderr.
+"""
+
+import os
+import struct
+import sys
+
+# the generated bindings sit next to this file
+sys.path.insert(0, os.path.dirname(os.path.abspath(__file__)))
+import external_process_pb2 as pb  # noqa: E402
+
+CONFIGURE = pb.EXTERNAL_PROCESS_REQUEST_TYPE_CONFIGURE
+ITERATE = pb.EXTERNAL_PROCESS_REQUEST_TYPE_ITERATE
+
+
+def read_message(stream, message):
+    """Reads one length-prefixed message from stream into message.
+
+    Returns False at a clean end of stream, before any byte of a message.
+    """
+    prefix = stream.read(4)
+    if not prefix:
+        return False
+    if len(prefix) < 4:
+        raise EOFError("stream ended inside a length prefix")
+    (length,) = struct.unpack(">I", prefix)
+    data = stream.read(length)
+    if len(data) < length:
+        raise EOFError("stream ended inside a message")
+    message.ParseFromString(data)
+    return True
+
+
+def write_message(stream, message):
+    """Writes message to stream with its 4-byte big-endian length prefix."""
+    data = message.SerializeToString()
+    stream.write(struct.pack(">I", len(data)) + data)
+    stream.flush()
+
+
+def param(request, name):
+    """Returns the values of the named params entry, or None if absent."""
+    for entry in request.params:
+        if entry.name == name:
+            return list(entry.values)
+    return None
+
+
+def history_rows(history):
+    """Returns an ExternalProcessHistory as a list of rows, most recent first."""
+    width = history.state_width
+    return [
+        list(history.values[row * width:(row + 1) * width])
+        for row in range(history.state_history_depth)
+    ]
+
+
+def serve(iterate, configure=None, stdin=None, stdout=None):
+    """Answers requests until stdin closes.
+
+    iterate(request) returns the partition's next state as a sequence of
+    state_width floats. configure(request), if given, is called on every
+    CONFIGURE request, which the run sends once at startup and again after each
+    restart. An exception raised by either is sent back as the response's
+    error, which stops the run.
+    """
+    stdin = stdin or sys.stdin.buffer
+    stdout = stdout or sys.stdout.buffer
+    redirected, sys.stdout = sys.stdout, sys.stderr
+    try:
+        while True:
+            request = pb.ExternalProcessRequest()
+            if not read_message(stdin, request):
+                return
+            response = pb.ExternalProcessResponse()
+            try:
+                if request.type == CONFIGURE:
+                    if configure is not None:
+                        configure(request)
+                elif request.type == ITERATE:
+                    response.state.extend(float(x) for x in iterate(request))
+                else:
+                    raise ValueError("unknown request type %d" % request.type)
+            except Exception as error:  # reported to the run, which stops
+                response = pb.ExternalProcessResponse(
+                    error="%s: %s" % (type(error).__name__, error)
+                )
+            write_message(stdout, response)
+    finally:
+        sys.stdout = redirected
+
+
+if __name__ == "__main__":
+    # A drift model: each step adds rate * timestep to the state, where rate
+    # is the partition's "rate" param.
+    def drift(request):
+        state = history_rows(request.state_histories[0])[0]
+        rate = param(request, "rate")
+        return [x + r * request.timestep for x, r in zip(state, rate)]
+
+    serve(drift)
@@ -0,0 +1,1208 @@
+// source: cmd/messages/external_process.proto
+/**
+ * @fileoverview
+ * @enhanceable
+ * @suppress {missingRequire} reports error on implicit type usages.
+ * @suppress {messageConventions} JS Compiler reports an error if a variable or
+ *     field starts with 'MSG_' and isn't a translatable message.
+ * @public
+ */
+// GENERATED CODE -- DO NOT EDIT!
+/* eslint-disable */
+// @ts-nocheck
+
+
+goog.provide('proto.ExternalProcessHistory');
+goog.provide('proto.ExternalProcessParam');
+goog.provide('proto.ExternalProcessRequest');
+goog.provide('proto.ExternalProcessRequestType');
+goog.provide('proto.ExternalProcessResponse');
+
+goog.require('jspb.BinaryReader');
+goog.require('jspb.BinaryWriter');
+goog.require('jspb.Message');
+goog.require('jspb.internal.public_for_gencode');
+
+/**
+ * Generated by JsPbCodeGenerator.
+ * @param {Array=} opt_data Optional initial data array, typically from a
+ * server response, or constructed directly in Javascript. The array is used
+ * in place and becomes part of the constructed object. It is not cloned.
+ * If no data is provided, the constructed object will be empty, but still
+ * valid.
+ * @extends {jspb.Message}
+ * @constructor
+ */
+proto.ExternalProcessParam = function(opt_data) {
+  jspb.Message.initialize(this, opt_data, 0, -1, proto.ExternalProcessParam.repeatedFields_, null);
+};
+goog.inherits(proto.ExternalProcessParam, jspb.Message);
+if (goog.DEBUG && !COMPILED) {
+  /**
+   * @public
+   * @override
+   */
+  proto.ExternalProcessParam.displayName = 'proto.ExternalProcessParam';
+}
+
+/**
+ * Generated by JsPbCodeGenerator.
+ * @param {Array=} opt_data Optional initial data array, typically from a
+ * server response, or constructed directly in Javascript. The array is used
+ * in place and becomes part of the constructed object. It is not cloned.
+ * If no data is provided, the constructed object will be empty, but still
+ * valid.
+ * @extends {jspb.Message}
+ * @constructor
+ */
+proto.ExternalProcessHistory = function(opt_data) {
+  jspb.Message.initialize(this, opt_data, 0, -1, proto.ExternalProcessHistory.repeatedFields_, null);
+};
+goog.inherits(proto.ExternalProcessHistory, jspb.Message);
+if (goog.DEBUG && !COMPILED) {
+  /**
+   * @public
+   * @override
+   */
+  proto.ExternalProcessHistory.displayName = 'proto.ExternalProcessHistory';
+}
+
+/**
+ * Generated by JsPbCodeGenerator.
+ * @param {Array=} opt_data Optional initial data array, typically from a
+ * server response, or constructed directly in Javascript. The array is used
+ * in place and becomes part of the constructed object. It is not cloned.
+ * If no data is provided, the constructed object will be empty, but still
+ * valid.
+ * @extends {jspb.Message}
+ * @constructor
+ */
+proto.ExternalProcessRequest = function(opt_data) {
+  jspb.Message.initialize(this, opt_data, 0, -1, proto.ExternalProcessRequest.repeatedFields_, null);
+};
+goog.inherits(proto.ExternalProcessRequest, jspb.Message);
+if (goog.DEBUG && !COMPILED) {
+  /**
+   * @public
+   * @override
+   */
+  proto.ExternalProcessRequest.displayName = 'proto.ExternalProcessRequest';
+}
+
+/**
+ * Generated by JsPbCodeGenerator.
+ * @param {Array=} opt_data Optional initial data array, typically from a
+ * server response, or constructed directly in Javascript. The array is used
+ * in place and becomes part of the constructed object. It is not cloned.
+ * If no data is provided, the constructed object will be empty, but still
+ * valid.
+ * @extends {jspb.Message}
+ * @constructor
+ */
+proto.ExternalProcessResponse = function(opt_data) {
+  jspb.Message.initialize(this, opt_data, 0, -1, proto.ExternalProcessResponse.repeatedFields_, null);
+};
+goog.inherits(proto.ExternalProcessResponse, jspb.Message);
+if (goog.DEBUG && !COMPILED) {
+  /**
+   * @public
+   * @override
+   */
+  proto.ExternalProcessResponse.displayName = 'proto.ExternalProcessResponse';
+}
+
+/**
+ * List of repeated fields within this message type.
+ * @private {!Array<number>}
+ * @const
+ */
+proto.ExternalProcessParam.repeatedFields_ = [2];
+
+
+
+if (jspb.Message.GENERATE_TO_OBJECT) {
+/**
+ * Creates an object representation of this proto.
+ * Field names that are reserved in JavaScript and will be renamed to pb_name.
+ * Optional fields that are not set will be set to undefined.
+ * To access a reserved field use, foo.pb_<name>, eg, foo.pb_default.
+ * For the list of reserved names please see:
+ *     net/proto2/compiler/js/internal/generator.cc#kKeyword.
+ * @param {boolean=} opt_includeInstance Deprecated. whether to include the
+ *     JSPB instance for transitional soy proto support:
+ *     http://goto/soy-param-migration
+ * @return {!Object}
+ */
+proto.ExternalProcessParam.prototype.toObject = function(opt_includeInstance) {
+  return proto.ExternalProcessParam.toObject(opt_includeInstance, this);
+};
+
+
+/**
+ * Static version of the {@see toObject} method.
+ * @param {boolean|undefined} includeInstance Deprecated. Whether to include
+ *     the JSPB instance for transitional soy proto support:
+ *     http://goto/soy-param-migration
+ * @param {!proto.ExternalProcessParam} msg The msg instance to transform.
+ * @return {!Object}
+ * @suppress {unusedLocalVariables} f is only used for nested messages
+ */
+proto.ExternalProcessParam.toObject = function(includeInstance, msg) {
+  var f, obj = {
+name: jspb.Message.getFieldWithDefault(msg, 1, ""),
+valuesList: (f = jspb.Message.getRepeatedFloatingPointField(msg, 2)) == null ? undefined : f
+  };
+
+  if (includeInstance) {
+    obj.$jspbMessageInstance = msg;
+  }
+  return obj;
+};
+}
+
+
+/**
+ * Deserializes binary data (in protobuf wire format).
+ * @param {jspb.ByteSource} bytes The bytes to deserialize.
+ * @return {!proto.ExternalProcessParam}
+ */
+proto.ExternalProcessParam.deserializeBinary = function(bytes) {
+  var reader = new jspb.BinaryReader(bytes);
+  var msg = new proto.ExternalProcessParam;
+  return proto.ExternalProcessParam.deserializeBinaryFromReader(msg, reader);
+};
+
+
+/**
+ * Deserializes binary data (in protobuf wire format) from the
+ * given reader into the given message object.
+ * @param {!proto.ExternalProcessParam} msg The message object to deserialize into.
+ * @param {!jspb.BinaryReader} reader The BinaryReader to use.
+ * @return {!proto.ExternalProcessParam}
+ */
+proto.ExternalProcessParam.deserializeBinaryFromReader = function(msg, reader) {
+  while (reader.nextField()) {
+    if (reader.isEndGroup()) {
+      break;
+    }
+    var field = reader.getFieldNumber();
+    switch (field) {
+    case 1:
+      var value = /** @type {string} */ (reader.readStringRequireUtf8());
+      msg.setName(value);
+      break;
+    case 2:
+      reader.readPackableDoubleInto(msg.getValuesList());
+      break;
+    default:
+      reader.skipField();
+      break;
+    }
+  }
+  return msg;
+};
+
+
+/**
+ * Serializes the message to binary data (in protobuf wire format).
+ * @return {!Uint8Array}
+ */
+proto.ExternalProcessParam.prototype.serializeBinary = function() {
+  var writer = new jspb.BinaryWriter();
+  proto.ExternalProcessParam.serializeBinaryToWriter(this, writer);
+  return writer.getResultBuffer();
+};
+
+
+/**
+ * Serializes the given message to binary data (in protobuf wire
+ * format), writing to the given BinaryWriter.
+ * @param {!proto.ExternalProcessParam} message
+ * @param {!jspb.BinaryWriter} writer
+ * @suppress {unusedLocalVariables} f is only used for nested messages
+ */
+proto.ExternalProcessParam.serializeBinaryToWriter = function(message, writer) {
+  var f = undefined;
+  f = message.getName();
+  if (f.length > 0) {
+    writer.writeString(
+      1,
+      f
+    );
+  }
+  f = message.getValuesList();
+  if (f.length > 0) {
+    writer.writePackedDouble(
+      2,
+      f
+    );
+  }
+};
+
+
+/**
+ * optional string name = 1;
+ * @return {string}
+ */
+proto.ExternalProcessParam.prototype.getName = function() {
+  return /** @type {string} */ (jspb.Message.getFieldWithDefault(this, 1, ""));
+};
+
+
+/**
+ * @param {string} value
+ * @return {!proto.ExternalProcessParam} returns this
+ */
+proto.ExternalProcessParam.prototype.setName = function(value) {
+  return jspb.Message.setProto3StringField(this, 1, value);
+};
+
+
+/**
+ * repeated double values = 2;
+ * @return {!Array<number>}
+ */
+proto.ExternalProcessParam.prototype.getValuesList = function() {
+  return /** @type {!Array<number>} */ (jspb.Message.getRepeatedFloatingPointField(this, 2));
+};
+
+
+/**
+ * @param {!Array<number>} value
+ * @return {!proto.ExternalProcessParam} returns this
+ */
+proto.ExternalProcessParam.prototype.setValuesList = function(value) {
+  return jspb.Message.setField(this, 2, value || []);
+};
+
+
+/**
+ * @param {number} value
+ * @param {number=} opt_index
+ * @return {!proto.ExternalProcessParam} returns this
+ */
+proto.ExternalProcessParam.prototype.addValues = function(value, opt_index) {
+  return jspb.Message.addToRepeatedField(this, 2, value, opt_index);
+};
+
+
+/**
+ * Clears the list making it empty but non-null.
+ * @return {!proto.ExternalProcessParam} returns this
+ */
+proto.ExternalProcessParam.prototype.clearValuesList = function() {
+  return this.setValuesList([]);
+};
+
+
+
+/**
+ * List of repeated fields within this message type.
+ * @private {!Array<number>}
+ * @const
+ */
+proto.ExternalProcessHistory.repeatedFields_ = [4];
+
+
+
+if (jspb.Message.GENERATE_TO_OBJECT) {
+/**
+ * Creates an object representation of this proto.
+ * Field names that are reserved in JavaScript and will be renamed to pb_name.
+ * Optional fields that are not set will be set to undefined.
+ * To access a reserved field use, foo.pb_<name>, eg, foo.pb_default.
+ * For the list of reserved names please see:
+ *     net/proto2/compiler/js/internal/generator.cc#kKeyword.
+ * @param {boolean=} opt_includeInstance Deprecated. whether to include the
+ *     JSPB instance for transitional soy proto support:
+ *     http://goto/soy-param-migration
+ * @return {!Object}
+ */
+proto.ExternalProcessHistory.prototype.toObject = function(opt_includeInstance) {
+  return proto.ExternalProcessHistory.toObject(opt_includeInstance, this);
+};
+
+
+/**
+ * Static version of the {@see toObject} method.
+ * @param {boolean|undefined} includeInstance Deprecated. Whether to include
+ *     the JSPB instance for transitional soy proto support:
+ *     http://goto/soy-param-migration
+ * @param {!proto.ExternalProcessHistory} msg The msg instance to transform.
+ * @return {!Object}
+ * @suppress {unusedLocalVariables} f is only used for nested messages
+ */
+proto.ExternalProcessHistory.toObject = function(includeInstance, msg) {
+  var f, obj = {
+partitionName: jspb.Message.getFieldWithDefault(msg, 1, ""),
+stateWidth: jspb.Message.getFieldWithDefault(msg, 2, 0),
+stateHistoryDepth: jspb.Message.getFieldWithDefault(msg, 3, 0),
+valuesList: (f = jspb.Message.getRepeatedFloatingPointField(msg, 4)) == null ? undefined : f
+  };
+
+  if (includeInstance) {
+    obj.$jspbMessageInstance = msg;
+  }
+  return obj;
+};
+}
+
+
+/**
+ * Deserializes binary data (in protobuf wire format).
+ * @param {jspb.ByteSource} bytes The bytes to deserialize.
+ * @return {!proto.ExternalProcessHistory}
+ */
+proto.ExternalProcessHistory.deserializeBinary = function(bytes) {
+  var reader = new jspb.BinaryReader(bytes);
+  var msg = new proto.ExternalProcessHistory;
+  return proto.ExternalProcessHistory.deserializeBinaryFromReader(msg, reader);
+};
+
+
+/**
+ * Deserializes binary data (in protobuf wire format) from the
+ * given reader into the given message object.
+ * @param {!proto.ExternalProcessHistory} msg The message object to deserialize into.
+ * @param {!jspb.BinaryReader} reader The BinaryReader to use.
+ * @return {!proto.ExternalProcessHistory}
+ */
+proto.ExternalProcessHistory.deserializeBinaryFromReader = function(msg, reader) {
+  while (reader.nextField()) {
+    if (reader.isEndGroup()) {
+      break;
+    }
+    var field = reader.getFieldNumber();
+    switch (field) {
+    case 1:
+      var value = /** @type {string} */ (reader.readStringRequireUtf8());
+      msg.setPartitionName(value);
+      break;
+    case 2:
+      var value = /** @type {number} */ (reader.readUint32());
+      msg.setStateWidth(value);
+      break;
+    case 3:
+      var value = /** @type {number} */ (reader.readUint32());
+      msg.setStateHistoryDepth(value);
+      break;
+    case 4:
+      reader.readPackableDoubleInto(msg.getValuesList());
+      break;
+    default:
+      reader.skipField();
+      break;
+    }
+  }
+  return msg;
+};
+
+
+/**
+ * Serializes the message to binary data (in protobuf wire format).
+ * @return {!Uint8Array}
+ */
+proto.ExternalProcessHistory.prototype.serializeBinary = function() {
+  var writer = new jspb.BinaryWriter();
+  proto.ExternalProcessHistory.serializeBinaryToWriter(this, writer);
+  return writer.getResultBuffer();
+};
+
+
+/**
+ * Serializes the given message to binary data (in protobuf wire
+ * format), writing to the given BinaryWriter.
+ * @param {!proto.ExternalProcessHistory} message
+ * @param {!jspb.BinaryWriter} writer
+ * @suppress {unusedLocalVariables} f is only used for nested messages
+ */
+proto.ExternalProcessHistory.serializeBinaryToWriter = function(message, writer) {
+  var f = undefined;
+  f = message.getPartitionName();
+  if (f.length > 0) {
+    writer.writeString(
+      1,
+      f
+    );
+  }
+  f = message.getStateWidth();
+  if (f !== 0) {
+    writer.writeUint32(
+      2,
+      f
+    );
+  }
+  f = message.getStateHistoryDepth();
+  if (f !== 0) {
+    writer.writeUint32(
+      3,
+      f
+    );
+  }
+  f = message.getValuesList();
+  if (f.length > 0) {
+    writer.writePackedDouble(
+      4,
+      f
+    );
+  }
+};
+
+
+/**
+ * optional string partition_name = 1;
+ * @return {string}
+ */
+proto.ExternalProcessHistory.prototype.getPartitionName = function() {
+  return /** @type {string} */ (jspb.Message.getFieldWithDefault(this, 1, ""));
+};
+
+
+/**
+ * @param {string} value
+ * @return {!proto.ExternalProcessHistory} returns this
+ */
+proto.ExternalProcessHistory.prototype.setPartitionName = function(value) {
+  return jspb.Message.setProto3StringField(this, 1, value);
+};
+
+
+/**
+ * optional uint32 state_width = 2;
+ * @return {number}
+ */
+proto.ExternalProcessHistory.prototype.getStateWidth = function() {
+  return /** @type {number} */ (jspb.Message.getFieldWithDefault(this, 2, 0));
+};
+
+
+/**
+ * @param {number} value
+ * @return {!proto.ExternalProcessHistory} returns this
+ */
+proto.ExternalProcessHistory.prototype.setStateWidth = function(value) {
+  return jspb.Message.setProto3IntField(this, 2, value);
+};
+
+
+/**
+ * optional uint32 state_history_depth = 3;
+ * @return {number}
+ */
+proto.ExternalProcessHistory.prototype.getStateHistoryDepth = function() {
+  return /** @type {number} */ (jspb.Message.getFieldWithDefault(this, 3, 0));
+};
+
+
+/**
+ * @param {number} value
+ * @return {!proto.ExternalProcessHistory} returns this
+ */
+proto.ExternalProcessHistory.prototype.setStateHistoryDepth = function(value) {
+  return jspb.Message.setProto3IntField(this, 3, value);
+};
+
+
+/**
+ * repeated double values = 4;
+ * @return {!Array<number>}
+ */
+proto.ExternalProcessHistory.prototype.getValuesList = function() {
+  return /** @type {!Array<number>} */ (jspb.Message.getRepeatedFloatingPointField(this, 4));
+};
+
+
+/**
+ * @param {!Array<number>} value
+ * @return {!proto.ExternalProcessHistory} returns this
+ */
+proto.ExternalProcessHistory.prototype.setValuesList = function(value) {
+  return jspb.Message.setField(this, 4, value || []);
+};
+
+
+/**
+ * @param {number} value
+ * @param {number=} opt_index
+ * @return {!proto.ExternalProcessHistory} returns this
+ */
+proto.ExternalProcessHistory.prototype.addValues = function(value, opt_index) {
+  return jspb.Message.addToRepeatedField(this, 4, value, opt_index);
+};
+
+
+/**
+ * Clears the list making it empty but non-null.
+ * @return {!proto.ExternalProcessHistory} returns this
+ */
+proto.ExternalProcessHistory.prototype.clearValuesList = function() {
+  return this.setValuesList([]);
+};
+
+
+
+/**
+ * List of repeated fields within this message type.
+ * @private {!Array<number>}
+ * @const
+ */
+proto.ExternalProcessRequest.repeatedFields_ = [8,9,10];
+
+
+
+if (jspb.Message.GENERATE_TO_OBJECT) {
+/**
+ * Creates an object representation of this proto.
+ * Field names that are reserved in JavaScript and will be renamed to pb_name.
+ * Optional fields that are not set will be set to undefined.
+ * To access a reserved field use, foo.pb_<name>, eg, foo.pb_default.
+ * For the list of reserved names please see:
+ *     net/proto2/compiler/js/internal/generator.cc#kKeyword.
+ * @param {boolean=} opt_includeInstance Deprecated. whether to include the
+ *     JSPB instance for transitional soy proto support:
+ *     http://goto/soy-param-migration
+ * @return {!Object}
+ */
+proto.ExternalProcessRequest.prototype.toObject = function(opt_includeInstance) {
+  return proto.ExternalProcessRequest.toObject(opt_includeInstance, this);
+};
+
+
+/**
+ * Static version of the {@see toObject} method.
+ * @param {boolean|undefined} includeInstance Deprecated. Whether to include
+ *     the JSPB instance for transitional soy proto support:
+ *     http://goto/soy-param-migration
+ * @param {!proto.ExternalProcessRequest} msg The msg instance to transform.
+ * @return {!Object}
+ * @suppress {unusedLocalVariables} f is only used for nested messages
+ */
+proto.ExternalProcessRequest.toObject = function(includeInstance, msg) {
+  var f, obj = {
+type: jspb.Message.getFieldWithDefault(msg, 1, 0),
+partitionName: jspb.Message.getFieldWithDefault(msg, 2, ""),
+stateWidth: jspb.Message.getFieldWithDefault(msg, 3, 0),
+seed: jspb.Message.getFieldWithDefault(msg, 4, 0),
+step: jspb.Message.getFieldWithDefault(msg, 5, 0),
+time: jspb.Message.getFloatingPointFieldWithDefault(msg, 6, 0.0),
+timestep: jspb.Message.getFloatingPointFieldWithDefault(msg, 7, 0.0),
+paramsList: jspb.Message.toObjectList(msg.getParamsList(),
+    proto.ExternalProcessParam.toObject, includeInstance),
+stateHistoriesList: jspb.Message.toObjectList(msg.getStateHistoriesList(),
+    proto.ExternalProcessHistory.toObject, includeInstance),
+initStateValuesList: (f = jspb.Message.getRepeatedFloatingPointField(msg, 10)) == null ? undefined : f
+  };
+
+  if (includeInstance) {
+    obj.$jspbMessageInstance = msg;
+  }
+  return obj;
+};
+}
+
+
+/**
+ * Deserializes binary data (in protobuf wire format).
+ * @param {jspb.ByteSource} bytes The bytes to deserialize.
+ * @return {!proto.ExternalProcessRequest}
+ */
+proto.ExternalProcessRequest.deserializeBinary = function(bytes) {
+  var reader = new jspb.BinaryReader(bytes);
+  var msg = new proto.ExternalProcessRequest;
+  return proto.ExternalProcessRequest.deserializeBinaryFromReader(msg, reader);
+};
+
+
+/**
+ * Deserializes binary data (in protobuf wire format) from the
+ * given reader into the given message object.
+ * @param {!proto.ExternalProcessRequest} msg The message object to deserialize into.
+ * @param {!jspb.BinaryReader} reader The BinaryReader to use.
+ * @return {!proto.ExternalProcessRequest}
+ */
+proto.ExternalProcessRequest.deserializeBinaryFromReader = function(msg, reader) {
+  while (reader.nextField()) {
+    if (reader.isEndGroup()) {
+      break;
+    }
+    var field = reader.getFieldNumber();
+    switch (field) {
+    case 1:
+      var value = /** @type {!proto.ExternalProcessRequestType} */ (reader.readEnum());
+      msg.setType(value);
+      break;
+    case 2:
+      var value = /** @type {string} */ (reader.readStringRequireUtf8());
+      msg.setPartitionName(value);
+      break;
+    case 3:
+      var value = /** @type {number} */ (reader.readUint32());
+      msg.setStateWidth(value);
+      break;
+    case 4:
+      var value = /** @type {number} */ (reader.readUint64());
+      msg.setSeed(value);
+      break;
+    case 5:
+      var value = /** @type {number} */ (reader.readUint64());
+      msg.setStep(value);
+      break;
+    case 6:
+      var value = /** @type {number} */ (reader.readDouble());
+      msg.setTime(value);
+      break;
+    case 7:
+      var value = /** @type {number} */ (reader.readDouble());
+      msg.setTimestep(value);
+      break;
+    case 8:
+      var value = new proto.ExternalProcessParam;
+      reader.readMessage(value,proto.ExternalProcessParam.deserializeBinaryFromReader);
+      msg.addParams(value);
+      break;
+    case 9:
+      var value = new proto.ExternalProcessHistory;
+      reader.readMessage(value,proto.ExternalProcessHistory.deserializeBinaryFromReader);
+      msg.addStateHistories(value);
+      break;
+    case 10:
+      reader.readPackableDoubleInto(msg.getInitStateValuesList());
+      break;
+    default:
+      reader.skipField();
+      break;
+    }
+  }
+  return msg;
+};
+
+
+/**
+ * Serializes the message to binary data (in protobuf wire format).
+ * @return {!Uint8Array}
+ */
+proto.ExternalProcessRequest.prototype.serializeBinary = function() {
+  var writer = new jspb.BinaryWriter();
+  proto.ExternalProcessRequest.serializeBinaryToWriter(this, writer);
+  return writer.getResultBuffer();
+};
+
+
+/**
+ * Serializes the given message to binary data (in protobuf wire
+ * format), writing to the given BinaryWriter.
+ * @param {!proto.ExternalProcessRequest} message
+ * @param {!jspb.BinaryWriter} writer
+ * @suppress {unusedLocalVariables} f is only used for nested messages
+ */
+proto.ExternalProcessRequest.serializeBinaryToWriter = function(message, writer) {
+  var f = undefined;
+  f = message.getType();
+  if (f !== 0.0) {
+    writer.writeEnum(
+      1,
+      f
+    );
+  }
+  f = message.getPartitionName();
+  if (f.length > 0) {
+    writer.writeString(
+      2,
+      f
+    );
+  }
+  f = message.getStateWidth();
+  if (f !== 0) {
+    writer.writeUint32(
+      3,
+      f
+    );
+  }
+  f = message.getSeed();
+  if (f !== 0) {
+    writer.writeUint64(
+      4,
+      f
+    );
+  }
+  f = message.getStep();
+  if (f !== 0) {
+    writer.writeUint64(
+      5,
+      f
+    );
+  }
+  f = message.getTime();
+  if (f !== 0.0) {
+    writer.writeDouble(
+      6,
+      f
+    );
+  }
+  f = message.getTimestep();
+  if (f !== 0.0) {
+    writer.writeDouble(
+      7,
+      f
+    );
+  }
+  f = message.getParamsList();
+  if (f.length > 0) {
+    writer.writeRepeatedMessage(
+      8,
+      f,
+      proto.ExternalProcessParam.serializeBinaryToWriter
+    );
+  }
+  f = message.getStateHistoriesList();
+  if (f.length > 0) {
+    writer.writeRepeatedMessage(
+      9,
+      f,
+      proto.ExternalProcessHistory.serializeBinaryToWriter
+    );
+  }
+  f = message.getInitStateValuesList();
+  if (f.length > 0) {
+    writer.writePackedDouble(
+      10,
+      f
+    );
+  }
+};
+
+
+/**
+ * optional ExternalProcessRequestType type = 1;
+ * @return {!proto.ExternalProcessRequestType}
+ */
+proto.ExternalProcessRequest.prototype.getType = function() {
+  return /** @type {!proto.ExternalProcessRequestType} */ (jspb.Message.getFieldWithDefault(this, 1, 0));
+};
+
+
+/**
+ * @param {!proto.ExternalProcessRequestType} value
+ * @return {!proto.ExternalProcessRequest} returns this
+ */
+proto.ExternalProcessRequest.prototype.setType = function(value) {
+  return jspb.Message.setProto3EnumField(this, 1, value);
+};
+
+
+/**
+ * optional string partition_name = 2;
+ * @return {string}
+ */
+proto.ExternalProcessRequest.prototype.getPartitionName = function() {
+  return /** @type {string} */ (jspb.Message.getFieldWithDefault(this, 2, ""));
+};
+
+
+/**
+ * @param {string} value
+ * @return {!proto.ExternalProcessRequest} returns this
+ */
+proto.ExternalProcessRequest.prototype.setPartitionName = function(value) {
+  return jspb.Message.setProto3StringField(this, 2, value);
+};
+
+
+/**
+ * optional uint32 state_width = 3;
+ * @return {number}
+ */
+proto.ExternalProcessRequest.prototype.getStateWidth = function() {
+  return /** @type {number} */ (jspb.Message.getFieldWithDefault(this, 3, 0));
+};
+
+
+/**
+ * @param {number} value
+ * @return {!proto.ExternalProcessRequest} returns this
+ */
+proto.ExternalProcessRequest.prototype.setStateWidth = function(value) {
+  return jspb.Message.setProto3IntField(this, 3, value);
+};
+
+
+/**
+ * optional uint64 seed = 4;
+ * @return {number}
+ */
+proto.ExternalProcessRequest.prototype.getSeed = function() {
+  return /** @type {number} */ (jspb.Message.getFieldWithDefault(this, 4, 0));
+};
+
+
+/**
+ * @param {number} value
+ * @return {!proto.ExternalProcessRequest} returns this
+ */
+proto.ExternalProcessRequest.prototype.setSeed = function(value) {
+  return jspb.Message.setProto3IntField(this, 4, value);
+};
+
+
+/**
+ * optional uint64 step = 5;
+ * @return {number}
+ */
+proto.ExternalProcessRequest.prototype.getStep = function() {
+  return /** @type {number} */ (jspb.Message.getFieldWithDefault(this, 5, 0));
+};
+
+
+/**
+ * @param {number} value
+ * @return {!proto.ExternalProcessRequest} returns this
+ */
+proto.ExternalProcessRequest.prototype.setStep = function(value) {
+  return jspb.Message.setProto3IntField(this, 5, value);
+};
+
+
+/**
+ * optional double time = 6;
+ * @return {number}
+ */
+proto.ExternalProcessRequest.prototype.getTime = function() {
+  return /** @type {number} */ (jspb.Message.getFloatingPointFieldWithDefault(this, 6, 0.0));
+};
+
+
+/**
+ * @param {number} value
+ * @return {!proto.ExternalProcessRequest} returns this
+ */
+proto.ExternalProcessRequest.prototype.setTime = function(value) {
+  return jspb.Message.setProto3FloatField(this, 6, value);
+};
+
+
+/**
+ * optional double timestep = 7;
+ * @return {number}
+ */
+proto.ExternalProcessRequest.prototype.getTimestep = function() {
+  return /** @type {number} */ (jspb.Message.getFloatingPointFieldWithDefault(this, 7, 0.0));
+};
+
+
+/**
+ * @param {number} value
+ * @return {!proto.ExternalProcessRequest} returns this
+ */
+proto.ExternalProcessRequest.prototype.setTimestep = function(value) {
+  return jspb.Message.setProto3FloatField(this, 7, value);
+};
+
+
+/**
+ * repeated ExternalProcessParam params = 8;
+ * @return {!Array<!proto.ExternalProcessParam>}
+ */
+proto.ExternalProcessRequest.prototype.getParamsList = function() {
+  return /** @type{!Array<!proto.ExternalProcessParam>} */ (
+    jspb.Message.getRepeatedWrapperField(this, proto.ExternalProcessParam, 8));
+};
+
+
+/**
+ * @param {!Array<!proto.ExternalProcessParam>} value
+ * @return {!proto.ExternalProcessRequest} returns this
+*/
+proto.ExternalProcessRequest.prototype.setParamsList = function(value) {
+  return jspb.Message.setRepeatedWrapperField(this, 8, value);
+};
+
+
+/**
+ * @param {!proto.ExternalProcessParam=} opt_value
+ * @param {number=} opt_index
+ * @return {!proto.ExternalProcessParam}
+ */
+proto.ExternalProcessRequest.prototype.addParams = function(opt_value, opt_index) {
+  return jspb.Message.addToRepeatedWrapperField(this, 8, opt_value, proto.ExternalProcessParam, opt_index);
+};
+
+
+/**
+ * Clears the list making it empty but non-null.
+ * @return {!proto.ExternalProcessRequest} returns this
+ */
+proto.ExternalProcessRequest.prototype.clearParamsList = function() {
+  return this.setParamsList([]);
+};
+
+
+/**
+ * repeated ExternalProcessHistory state_histories = 9;
+ * @return {!Array<!proto.ExternalProcessHistory>}
+ */
+proto.ExternalProcessRequest.prototype.getStateHistoriesList = function() {
+  return /** @type{!Array<!proto.ExternalProcessHistory>} */ (
+    jspb.Message.getRepeatedWrapperField(this, proto.ExternalProcessHistory, 9));
+};
+
+
+/**
+ * @param {!Array<!proto.ExternalProcessHistory>} value
+ * @return {!proto.ExternalProcessRequest} returns this
+*/
+proto.ExternalProcessRequest.prototype.setStateHistoriesList = function(value) {
+  return jspb.Message.setRepeatedWrapperField(this, 9, value);
+};
+
+
+/**
+ * @param {!proto.ExternalProcessHistory=} opt_value
+ * @param {number=} opt_index
+ * @return {!proto.ExternalProcessHistory}
+ */
+proto.ExternalProcessRequest.prototype.addStateHistories = function(opt_value, opt_index) {
+  return jspb.Message.addToRepeatedWrapperField(this, 9, opt_value, proto.ExternalProcessHistory, opt_index);
+};
+
+
+/**
+ * Clears the list making it empty but non-null.
+ * @return {!proto.ExternalProcessRequest} returns this
+ */
+proto.ExternalProcessRequest.prototype.clearStateHistoriesList = function() {
+  return this.setStateHistoriesList([]);
+};
+
+
+/**
+ * repeated double init_state_values = 10;
+ * @return {!Array<number>}
+ */
+proto.ExternalProcessRequest.prototype.getInitStateValuesList = function() {
+  return /** @type {!Array<number>} */ (jspb.Message.getRepeatedFloatingPointField(this, 10));
+};
+
+
+/**
+ * @param {!Array<number>} value
+ * @return {!proto.ExternalProcessRequest} returns this
+ */
+proto.ExternalProcessRequest.prototype.setInitStateValuesList = function(value) {
+  return jspb.Message.setField(this, 10, value || []);
+};
+
+
+/**
+ * @param {number} value
+ * @param {number=} opt_index
+ * @return {!proto.ExternalProcessRequest} returns this
+ */
+proto.ExternalProcessRequest.prototype.addInitStateValues = function(value, opt_index) {
+  return jspb.Message.addToRepeatedField(this, 10, value, opt_index);
+};
+
+
+/**
+ * Clears the list making it empty but non-null.
+ * @return {!proto.ExternalProcessRequest} returns this
+ */
+proto.ExternalProcessRequest.prototype.clearInitStateValuesList = function() {
+  return this.setInitStateValuesList([]);
+};
+
+
+
+/**
+ * List of repeated fields within this message type.
+ * @private {!Array<number>}
+ * @const
+ */
+proto.ExternalProcessResponse.repeatedFields_ = [1];
+
+
+
+if (jspb.Message.GENERATE_TO_OBJECT) {
+/**
+ * Creates an object representation of this proto.
+ * Field names that are reserved in JavaScript and will be renamed to pb_name.
+ * Optional fields that are not set will be set to undefined.
+ * To access a reserved field use, foo.pb_<name>, eg, foo.pb_default.
+ * For the list of reserved names please see:
+ *     net/proto2/compiler/js/internal/generator.cc#kKeyword.
+ * @param {boolean=} opt_includeInstance Deprecated. whether to include the
+ *     JSPB instance for transitional soy proto support:
+ *     http://goto/soy-param-migration
+ * @return {!Object}
+ */
+proto.ExternalProcessResponse.prototype.toObject = function(opt_includeInstance) {
+  return proto.ExternalProcessResponse.toObject(opt_includeInstance, this);
+};
+
+
+/**
+ * Static version of the {@see toObject} method.
+ * @param {boolean|undefined} includeInstance Deprecated. Whether to include
+ *     the JSPB instance for transitional soy proto support:
+ *     http://goto/soy-param-migration
+ * @param {!proto.ExternalProcessResponse} msg The msg instance to transform.
+ * @return {!Object}
+ * @suppress {unusedLocalVariables} f is only used for nested messages
+ */
+proto.ExternalProcessResponse.toObject = function(includeInstance, msg) {
+  var f, obj = {
+stateList: (f = jspb.Message.getRepeatedFloatingPointField(msg, 1)) == null ? undefined : f,
+error: jspb.Message.getFieldWithDefault(msg, 2, "")
+  };
+
+  if (includeInstance) {
+    obj.$jspbMessageInstance = msg;
+  }
+  return obj;
+};
+}
+
+
+/**
+ * Deserializes binary data (in protobuf wire format).
+ * @param {jspb.ByteSource} bytes The bytes to deserialize.
+ * @return {!proto.ExternalProcessResponse}
+ */
+proto.ExternalProcessResponse.deserializeBinary = function(bytes) {
+  var reader = new jspb.BinaryReader(bytes);
+  var msg = new proto.ExternalProcessResponse;
+  return proto.ExternalProcessResponse.deserializeBinaryFromReader(msg, reader);
+};
+
+
+/**
+ * Deserializes binary data (in protobuf wire format) from the
+ * given reader into the given message object.
+ * @param {!proto.ExternalProcessResponse} msg The message object to deserialize into.
+ * @param {!jspb.BinaryReader} reader The BinaryReader to use.
+ * @return {!proto.ExternalProcessResponse}
+ */
+proto.ExternalProcessResponse.deserializeBinaryFromReader = function(msg, reader) {
+  while (reader.nextField()) {
+    if (reader.isEndGroup()) {
+      break;
+    }
+    var field = reader.getFieldNumber();
+    switch (field) {
+    case 1:
+      reader.readPackableDoubleInto(msg.getStateList());
+      break;
+    case 2:
+      var value = /** @type {string} */ (reader.readStringRequireUtf8());
+      msg.setError(value);
+      break;
+    default:
+      reader.skipField();
+      break;
+    }
+  }
+  return msg;
+};
+
+
+/**
+ * Serializes the message to binary data (in protobuf wire format).
+ * @return {!Uint8Array}
+ */
+proto.ExternalProcessResponse.prototype.serializeBinary = function() {
+  var writer = new jspb.BinaryWriter();
+  proto.ExternalProcessResponse.serializeBinaryToWriter(this, writer);
+  return writer.getResultBuffer();
+};
+
+
+/**
+ * Serializes the given message to binary data (in protobuf wire
+ * format), writing to the given BinaryWriter.
+ * @param {!proto.ExternalProcessResponse} message
+ * @param {!jspb.BinaryWriter} writer
+ * @suppress {unusedLocalVariables} f is only used for nested messages
+ */
+proto.ExternalProcessResponse.serializeBinaryToWriter = function(message, writer) {
+  var f = undefined;
+  f = message.getStateList();
+  if (f.length > 0) {
+    writer.writePackedDouble(
+      1,
+      f
+    );
+  }
+  f = message.getError();
+  if (f.length > 0) {
+    writer.writeString(
+      2,
+      f
+    );
+  }
+};
+
+
+/**
+ * repeated double state = 1;
+ * @return {!Array<number>}
+ */
+proto.ExternalProcessResponse.prototype.getStateList = function() {
+  return /** @type {!Array<number>} */ (jspb.Message.getRepeatedFloatingPointField(this, 1));
+};
+
+
+/**
+ * @param {!Array<number>} value
+ * @return {!proto.ExternalProcessResponse} returns this
+ */
+proto.ExternalProcessResponse.prototype.setStateList = function(value) {
+  return jspb.Message.setField(this, 1, value || []);
+};
+
+
+/**
+ * @param {number} value
+ * @param {number=} opt_index
+ * @return {!proto.ExternalProcessResponse} returns this
+ */
+proto.ExternalProcessResponse.prototype.addState = function(value, opt_index) {
+  return jspb.Message.addToRepeatedField(this, 1, value, opt_index);
+};
+
+
+/**
+ * Clears the list making it empty but non-null.
+ * @return {!proto.ExternalProcessResponse} returns this
+ */
+proto.ExternalProcessResponse.prototype.clearStateList = function() {
+  return this.setStateList([]);
+};
+
+
+/**
+ * optional string error = 2;
+ * @return {string}
+ */
+proto.ExternalProcessResponse.prototype.getError = function() {
+  return /** @type {string} */ (jspb.Message.getFieldWithDefault(this, 2, ""));
+};
+
+
+/**
+ * @param {string} value
+ * @return {!proto.ExternalProcessResponse} returns this
+ */
+proto.ExternalProcessResponse.prototype.setError = function(value) {
+  return jspb.Message.setProto3StringField(this, 2, value);
+};
+
+
+
+/**
+ * @enum {number}
+ */
+proto.ExternalProcessRequestType = {
+  EXTERNAL_PROCESS_REQUEST_TYPE_UNSPECIFIED: 0,
+  EXTERNAL_PROCESS_REQUEST_TYPE_CONFIGURE: 1,
+  EXTERNAL_PROCESS_REQUEST_TYPE_ITERATE: 2
+};
+
@@ -1,23 +1,31 @@
 #!/usr/bin/env bash
 #
-# generate_proto.sh regenerates the PartitionState message bindings from
-# partition_state.proto, in every language the engine's streaming output targets:
+# generate_proto.sh regenerates the message bindings from
+# partition_state.proto (PartitionState, streamed to clients),
+# control_message.proto (ControlMessage, sent back by clients) and
+# external_process.proto (the external_process iteration's subprocess
+# protocol), in every language the engine's clients use:
 #
-#   - Go     -> pkg/simulator/partition_state.pb.go   (marshalled by the websocket
-#              output function in pkg/simulator/output.go)
-#   - JS     -> cmd/messages/partition_state_pb.js     (browser websocket clients)
-#   - Python -> cmd/messages/partition_state_pb2.py    (Python websocket clients)
+#   - Go     -> pkg/simulator/<name>.pb.go   (marshalled by the websocket output
+#              function in pkg/simulator/output.go and read by the live-run
+#              control loop in pkg/api/control.go), or pkg/general/ for
+#              external_process (spoken by pkg/general/external_process.go)
+#   - JS     -> cmd/messages/<name>_pb.js     (browser websocket clients)
+#   - Python -> cmd/messages/<name>_pb2.py    (Python websocket clients and
+#              external_process_client.py)
 #
 # Run from the repository root — the paths below are repo-root-relative:
 #
 #   bash cmd/messages/generate_proto.sh
 #
 # Requires `protoc` with the Go plugin (protoc-gen-go) on PATH, plus protoc's
-# built-in JS and Python generators. After editing partition_state.proto, re-run
+# built-in JS and Python generators. After editing either .proto file, re-run
 # this script and commit the regenerated files (never hand-edit them).
 
-protoc -I=. \
-    --go_out=$(pwd) \
-    --js_out=library=./cmd/messages/partition_state_pb,binary:. \
-    ./cmd/messages/partition_state.proto;
-protoc --python_out=. ./cmd/messages/partition_state.proto;
\ No newline at end of file
+for name in partition_state control_message external_process; do
+    protoc -I=. \
+        --go_out=$(pwd) \
+        --js_out=library=./cmd/messages/${name}_pb,binary:. \
+        ./cmd/messages/${name}.proto;
+    protoc --python_out=. ./cmd/messages/${name}.proto;
+done
\ No newline at end of file
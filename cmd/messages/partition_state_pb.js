@@ -81,7 +81,10 @@ proto.PartitionState.toObject = function(includeInstance, msg) {
   var f, obj = {
 cumulativeTimesteps: jspb.Message.getFloatingPointFieldWithDefault(msg, 1, 0.0),
 partitionName: jspb.Message.getFieldWithDefault(msg, 2, ""),
-stateList: (f = jspb.Message.getRepeatedFloatingPointField(msg, 3)) == null ? undefined : f
+stateList: (f = jspb.Message.getRepeatedFloatingPointField(msg, 3)) == null ? undefined : f,
+snapshotId: jspb.Message.getFieldWithDefault(msg, 4, 0),
+historyRow: jspb.Message.getFieldWithDefault(msg, 5, 0),
+snapshotSize: jspb.Message.getFieldWithDefault(msg, 6, 0)
   };
 
   if (includeInstance) {
@@ -129,6 +132,18 @@ proto.PartitionState.deserializeBinaryFromReader = function(msg, reader) {
     case 3:
       reader.readPackableDoubleInto(msg.getStateList());
       break;
+    case 4:
+      var value = /** @type {number} */ (reader.readUint64());
+      msg.setSnapshotId(value);
+      break;
+    case 5:
+      var value = /** @type {number} */ (reader.readUint32());
+      msg.setHistoryRow(value);
+      break;
+    case 6:
+      var value = /** @type {number} */ (reader.readUint32());
+      msg.setSnapshotSize(value);
+      break;
     default:
       reader.skipField();
       break;
@@ -179,6 +194,27 @@ proto.PartitionState.serializeBinaryToWriter = function(message, writer) {
       f
     );
   }
+  f = message.getSnapshotId();
+  if (f !== 0) {
+    writer.writeUint64(
+      4,
+      f
+    );
+  }
+  f = message.getHistoryRow();
+  if (f !== 0) {
+    writer.writeUint32(
+      5,
+      f
+    );
+  }
+  f = message.getSnapshotSize();
+  if (f !== 0) {
+    writer.writeUint32(
+      6,
+      f
+    );
+  }
 };
 
 
@@ -255,3 +291,57 @@ proto.PartitionState.prototype.clearStateList = function() {
 };
 
 
+/**
+ * optional uint64 snapshot_id = 4;
+ * @return {number}
+ */
+proto.PartitionState.prototype.getSnapshotId = function() {
+  return /** @type {number} */ (jspb.Message.getFieldWithDefault(this, 4, 0));
+};
+
+
+/**
+ * @param {number} value
+ * @return {!proto.PartitionState} returns this
+ */
+proto.PartitionState.prototype.setSnapshotId = function(value) {
+  return jspb.Message.setProto3IntField(this, 4, value);
+};
+
+
+/**
+ * optional uint32 history_row = 5;
+ * @return {number}
+ */
+proto.PartitionState.prototype.getHistoryRow = function() {
+  return /** @type {number} */ (jspb.Message.getFieldWithDefault(this, 5, 0));
+};
+
+
+/**
+ * @param {number} value
+ * @return {!proto.PartitionState} returns this
+ */
+proto.PartitionState.prototype.setHistoryRow = function(value) {
+  return jspb.Message.setProto3IntField(this, 5, value);
+};
+
+
+/**
+ * optional uint32 snapshot_size = 6;
+ * @return {number}
+ */
+proto.PartitionState.prototype.getSnapshotSize = function() {
+  return /** @type {number} */ (jspb.Message.getFieldWithDefault(this, 6, 0));
+};
+
+
+/**
+ * @param {number} value
+ * @return {!proto.PartitionState} returns this
+ */
+proto.PartitionState.prototype.setSnapshotSize = function(value) {
+  return jspb.Message.setProto3IntField(this, 6, value);
+};
+
+
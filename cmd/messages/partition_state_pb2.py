@@ -24,7 +24,7 @@ _sym_db = _symbol_database.Default()
 
 
 
-DESCRIPTOR = _descriptor_pool.Default().AddSerializedFile(b'\n\"cmd/messages/partition_state.proto\"U\n\x0ePartitionState\x12\x1c\n\x14\x63umulative_timesteps\x18\x01 \x01(\x01\x12\x16\n\x0epartition_name\x18\x02 \x01(\t\x12\r\n\x05state\x18\x03 \x03(\x01\x42\x11Z\x0f./pkg/simulatorb\x06proto3')
+DESCRIPTOR = _descriptor_pool.Default().AddSerializedFile(b'\n\"cmd/messages/partition_state.proto\"\x96\x01\n\x0ePartitionState\x12\x1c\n\x14\x63umulative_timesteps\x18\x01 \x01(\x01\x12\x16\n\x0epartition_name\x18\x02 \x01(\t\x12\r\n\x05state\x18\x03 \x03(\x01\x12\x13\n\x0bsnapshot_id\x18\x04 \x01(\x04\x12\x13\n\x0bhistory_row\x18\x05 \x01(\r\x12\x15\n\rsnapshot_size\x18\x06 \x01(\rB\x11Z\x0f./pkg/simulatorb\x06proto3')
 
 _globals = globals()
 _builder.BuildMessageAndEnumDescriptors(DESCRIPTOR, _globals)
@@ -32,6 +32,6 @@ _builder.BuildTopDescriptorsAndMessages(DESCRIPTOR, 'cmd.messages.partition_stat
 if not _descriptor._USE_C_DESCRIPTORS:
   _globals['DESCRIPTOR']._loaded_options = None
   _globals['DESCRIPTOR']._serialized_options = b'Z\017./pkg/simulator'
-  _globals['_PARTITIONSTATE']._serialized_start=38
-  _globals['_PARTITIONSTATE']._serialized_end=123
+  _globals['_PARTITIONSTATE']._serialized_start=39
+  _globals['_PARTITIONSTATE']._serialized_end=189
 # @@protoc_insertion_point(module_scope)
@@ -61,11 +61,14 @@ const note = "GENERATED by cmd/model-index — do not edit by hand. " +
 
 // inspectModel parses a model directory's non-test Go files and extracts its core
 // package imports, the iterations it defines, and whether it is behaviour-bound.
+// Files written by `stochadex codegen` are skipped: their iterations are the
+// declarative twin's, not bespoke Go.
 func inspectModel(dir string) (Model, error) {
 	m := Model{Dir: filepath.Base(dir)}
 	fset := token.NewFileSet()
 	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
-		return !strings.HasSuffix(fi.Name(), "_test.go")
+		return !strings.HasSuffix(fi.Name(), "_test.go") &&
+			!strings.HasSuffix(fi.Name(), "_generated.go")
 	}, 0)
 	if err != nil {
 		return m, err
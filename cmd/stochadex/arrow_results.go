@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/umbralcalc/stochadex/pkg/api"
+	"github.com/umbralcalc/stochadex/pkg/arrowstore"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// Registers `GET /jobs/{id}/results?format=arrow` on the `stochadex serve` job server,
+// which returns a finished job's output as an Arrow IPC file in the same layout the arrow
+// output function writes — so it reads straight into Polars, pandas or DuckDB, or back in
+// as an arrow data: source.
+func init() {
+	api.RegisterResultFormat(
+		"arrow",
+		"application/vnd.apache.arrow.file",
+		writeArrowResults,
+	)
+}
+
+// writeArrowResults copies storage into an Arrow storage and writes it as one record.
+func writeArrowResults(storage *simulator.StateTimeStorage, w io.Writer) error {
+	store := arrowstore.NewArrowStateTimeStorage()
+	defer store.Release()
+	names := storage.GetNames()
+	store.PreRegisterPartitions(names)
+	times := storage.GetTimes()
+	for index, name := range names {
+		for step, row := range storage.GetValues(name) {
+			store.AppendByIndex(index, times[step], row)
+		}
+	}
+	record := store.Record()
+	if record == nil {
+		return fmt.Errorf(
+			"arrow results: partitions produced differing row counts, so the run is " +
+				"not a single rectangular table; use format=json instead")
+	}
+	defer record.Release()
+	writer, err := ipc.NewFileWriter(w, ipc.WithSchema(record.Schema()))
+	if err != nil {
+		return fmt.Errorf("arrow results: opening writer: %w", err)
+	}
+	if err := writer.Write(record); err != nil {
+		return fmt.Errorf("arrow results: writing record: %w", err)
+	}
+	return writer.Close()
+}
@@ -1,12 +1,14 @@
 // The stochadex CLI. This is a SEPARATE module from the engine on purpose: it bundles the
-// opt-in egress modules (arrowstore, duckdbstore, s3store) and the onnx inference module
-// that the engine's own go.mod deliberately excludes, so the engine stays lean and
-// WASM-clean for everyone who imports it as a library while the shipped binary still
-// carries the integrations. The engine module is therefore library-only — this is the one
-// CLI, and it lives in its own module because imports drive go.mod.
+// opt-in egress modules (arrowstore, duckdbstore, s3store), the starlark and wasm modules
+// and the onnx inference module that the engine's own go.mod deliberately excludes, so the
+// engine stays lean and WASM-clean for everyone who imports it as a library while the
+// shipped binary still carries the integrations. The engine module is therefore
+// library-only — this is the one CLI, and it lives in its own module because imports
+// drive go.mod.
 //
 // One main package, several builds:
-//   - pure Go (no tags, CGO off) — engine + Postgres + Arrow + S3; cross-compiles everywhere.
+//   - pure Go (no tags, CGO off) — engine + Postgres + Arrow + S3 + Starlark +
+//     WASM; cross-compiles everywhere.
 //   - CGO with `-tags "cblas duckdb_arrow"` — adds an optimised system BLAS and DuckDB.
 //   - CGO with `-tags onnx` — adds the onnx_inference partition, running a frozen ONNX
 //     model behind an Iteration via a cgo ONNX Runtime. The ONNX Runtime shared library
@@ -27,9 +29,15 @@ require (
 	github.com/umbralcalc/stochadex/pkg/arrowstore v0.0.0
 	github.com/umbralcalc/stochadex/pkg/duckdbstore v0.0.0
 	github.com/umbralcalc/stochadex/pkg/s3store v0.0.0
+	github.com/umbralcalc/stochadex/pkg/starlark v0.0.0
+	github.com/umbralcalc/stochadex/pkg/wasm v0.0.0
 )
 
-require github.com/yalue/onnxruntime_go v1.31.0 // indirect
+require (
+	github.com/tetratelabs/wazero v1.9.0 // indirect
+	github.com/yalue/onnxruntime_go v1.31.0 // indirect
+	go.starlark.net v0.0.0-20260908191801-89a6a09411d5 // indirect
+)
 
 require (
 	github.com/akamensky/argparse v1.4.0 // indirect
@@ -95,3 +103,7 @@ replace github.com/umbralcalc/stochadex/pkg/duckdbstore => ../../pkg/duckdbstore
 replace github.com/umbralcalc/stochadex/pkg/s3store => ../../pkg/s3store
 
 replace github.com/umbralcalc/stochadex/pkg/onnx => ../../pkg/onnx
+
+replace github.com/umbralcalc/stochadex/pkg/starlark => ../../pkg/starlark
+
+replace github.com/umbralcalc/stochadex/pkg/wasm => ../../pkg/wasm
@@ -1,7 +1,7 @@
 // Command stochadex is the stochadex CLI: it reads a YAML run configuration — a single
 // data document naming the framework's own components by type — resolves it, and runs it
-// in-process, plus the egress integrations (Arrow, S3, Postgres, DuckDB) and the onnx
-// inference partition that live in opt-in modules.
+// in-process, plus the egress integrations (Arrow, S3, Postgres, DuckDB), the onnx
+// inference partition and the starlark and wasm partitions that live in opt-in modules.
 //
 // It is a SEPARATE module from the engine because imports drive go.mod. Adding Arrow or
 // DuckDB to the engine module would impose them on every downstream repo that imports the
@@ -21,6 +21,14 @@
 //	CGO_ENABLED=1 CGO_LDFLAGS="-lopenblas" \
 //	    go build -tags "cblas duckdb_arrow" -o stochadex-accel .   # Linux
 //
+// The same binary serves submitted configs over HTTP with `stochadex serve` (see
+// api.JobServer), returning results as JSON or, through the Arrow format registered here,
+// as an Arrow IPC file.
+//
+// `stochadex codegen -c model.yaml -p partition` writes an expression partition out as a
+// typed Go iteration beside the config, with a test that runs the two side by side (see
+// general.ExpressionIteration.GenerateGo), for promoting a model that has settled to Go.
+//
 // The `cblas` tag routes gonum's BLAS to the linked system library (see
 // pkg/simulator/blas_accelerated.go); `duckdb_arrow` compiles the DuckDB sink below.
 package main
@@ -60,6 +68,16 @@ func main() {
 	api.BuildVersion = version
 	api.BuildFeatures = features
 	api.BuildRevision = revision
+	// `stochadex serve` runs the HTTP job server instead of a single config.
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		api.ServeJobsWithParsedArgs(api.ServeArgParse())
+		return
+	}
+	// `stochadex codegen` writes an expression partition out as Go instead of running it.
+	if len(os.Args) > 1 && os.Args[1] == "codegen" {
+		api.CodegenWithParsedArgs(api.CodegenArgParse())
+		return
+	}
 	api.RunWithParsedArgs(api.ArgParse())
 }
 
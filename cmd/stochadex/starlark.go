@@ -0,0 +1,10 @@
+// Wires the opt-in Starlark scripting partition into the distributed CLI. The
+// blank import pulls in github.com/umbralcalc/stochadex/pkg/starlark, whose
+// init() self-registers the {type: starlark} spelling via
+// api.RegisterIteration. The interpreter is pure Go, so every build of the CLI
+// carries it.
+package main
+
+import (
+	_ "github.com/umbralcalc/stochadex/pkg/starlark"
+)
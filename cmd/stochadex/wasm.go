@@ -0,0 +1,10 @@
+// Wires the opt-in WebAssembly plugin partition into the distributed CLI. The
+// blank import pulls in github.com/umbralcalc/stochadex/pkg/wasm, whose init()
+// self-registers the {type: wasm} spelling via api.RegisterIteration. Its
+// runtime (wazero) is pure Go, so unlike onnx it needs no build tag: every
+// build of the CLI can load .wasm components.
+package main
+
+import (
+	_ "github.com/umbralcalc/stochadex/pkg/wasm"
+)
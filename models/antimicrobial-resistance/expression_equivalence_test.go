@@ -56,6 +56,7 @@ import (
 	"gonum.org/v1/gonum/mat"
 
 	"github.com/umbralcalc/stochadex/models/cardgen"
+	"github.com/umbralcalc/stochadex/models/twinbench"
 	"github.com/umbralcalc/stochadex/pkg/api"
 	"github.com/umbralcalc/stochadex/pkg/general"
 	"github.com/umbralcalc/stochadex/pkg/simulator"
@@ -496,3 +497,11 @@ func TestDeclarativeAMRAnswersTheSameClaims(t *testing.T) {
 		}
 	}
 }
+
+func BenchmarkDeclarativeTwin(b *testing.B) {
+	twinbench.Run(b, func() *simulator.ConfigGenerator {
+		return BuildStub(BaselinePrescribingRate, DefaultNumSteps)
+	}, func() *simulator.ConfigGenerator {
+		return declarativeBuildStub(BaselinePrescribingRate, DefaultNumSteps)
+	})
+}
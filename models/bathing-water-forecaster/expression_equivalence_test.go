@@ -28,6 +28,7 @@ import (
 	"gonum.org/v1/gonum/mat"
 
 	"github.com/umbralcalc/stochadex/models/cardgen"
+	"github.com/umbralcalc/stochadex/models/twinbench"
 	"github.com/umbralcalc/stochadex/pkg/api"
 	"github.com/umbralcalc/stochadex/pkg/continuous"
 	"github.com/umbralcalc/stochadex/pkg/general"
@@ -283,3 +284,11 @@ func TestDeclarativeBathingWaterAnswersTheSameClaims(t *testing.T) {
 	}
 	t.Logf("max deviation across every observation on every claim: %g", maxDev)
 }
+
+func BenchmarkDeclarativeTwin(b *testing.B) {
+	twinbench.Run(b, func() *simulator.ConfigGenerator {
+		return BuildStub(DefaultAnomalyVolatility, DefaultNumSteps, 0)
+	}, func() *simulator.ConfigGenerator {
+		return declarativeBuildStub(DefaultAnomalyVolatility, DefaultNumSteps, 0)
+	})
+}
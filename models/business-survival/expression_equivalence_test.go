@@ -62,6 +62,7 @@ import (
 	"gonum.org/v1/gonum/mat"
 
 	"github.com/umbralcalc/stochadex/models/cardgen"
+	"github.com/umbralcalc/stochadex/models/twinbench"
 	"github.com/umbralcalc/stochadex/pkg/api"
 	"github.com/umbralcalc/stochadex/pkg/general"
 	"github.com/umbralcalc/stochadex/pkg/simulator"
@@ -646,3 +647,11 @@ func TestDeclarativeBusinessSurvivalAnswersTheSameClaims(t *testing.T) {
 	}
 	t.Logf("max deviation across every observation on every claim: %g", maxDev)
 }
+
+func BenchmarkDeclarativeTwin(b *testing.B) {
+	twinbench.Run(b, func() *simulator.ConfigGenerator {
+		return BuildStub(DefaultPolicyHazardScale, DefaultNumSteps, 0)
+	}, func() *simulator.ConfigGenerator {
+		return declarativeBuildStub(DefaultPolicyHazardScale, DefaultNumSteps, 0)
+	})
+}
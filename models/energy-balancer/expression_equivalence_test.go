@@ -31,6 +31,7 @@ import (
 	"gonum.org/v1/gonum/mat"
 
 	"github.com/umbralcalc/stochadex/models/cardgen"
+	"github.com/umbralcalc/stochadex/models/twinbench"
 	"github.com/umbralcalc/stochadex/pkg/api"
 	"github.com/umbralcalc/stochadex/pkg/general"
 	"github.com/umbralcalc/stochadex/pkg/simulator"
@@ -622,3 +623,11 @@ func TestDeclarativeEnergyBalancerAnswersTheSameClaims(t *testing.T) {
 	}
 	t.Logf("max deviation across every observation on every claim: %g", maxDev)
 }
+
+func BenchmarkDeclarativeTwin(b *testing.B) {
+	twinbench.Run(b, func() *simulator.ConfigGenerator {
+		return BuildStub(0.5, DefaultNumSteps, 0)
+	}, func() *simulator.ConfigGenerator {
+		return declarativeBuildStub(0.5, DefaultNumSteps, 0)
+	})
+}
@@ -26,6 +26,7 @@ import (
 	"gonum.org/v1/gonum/mat"
 
 	"github.com/umbralcalc/stochadex/models/cardgen"
+	"github.com/umbralcalc/stochadex/models/twinbench"
 	"github.com/umbralcalc/stochadex/pkg/api"
 	"github.com/umbralcalc/stochadex/pkg/general"
 	"github.com/umbralcalc/stochadex/pkg/simulator"
@@ -324,3 +325,11 @@ func TestDeclarativeFloodRiskAnswersTheSameClaims(t *testing.T) {
 	}
 	t.Logf("max deviation across every observation on every claim: %g", maxDev)
 }
+
+func BenchmarkDeclarativeTwin(b *testing.B) {
+	twinbench.Run(b, func() *simulator.ConfigGenerator {
+		return BuildStub(1.0, DefaultNumSteps, 0)
+	}, func() *simulator.ConfigGenerator {
+		return declarativeBuildStub(1.0, DefaultNumSteps, 0)
+	})
+}
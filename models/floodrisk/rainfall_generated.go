@@ -0,0 +1,63 @@
+// Code generated by stochadex codegen from declarative.yaml, partition rainfall; DO NOT EDIT.
+
+package floodrisk
+
+import (
+	"math"
+
+	"github.com/umbralcalc/stochadex/pkg/general"
+	"github.com/umbralcalc/stochadex/pkg/rng"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// RainfallIteration is the rainfall partition of declarative.yaml with its expressions
+// generated as Go. It computes what the declarative iteration computes from the same spec, draw
+// for draw, for the widths that config gives its fields, params and upstreams, and must be
+// regenerated when they change.
+type RainfallIteration struct {
+	out     []float64
+	sampler *rng.Sampler
+}
+
+// Configure sizes the buffers and seeds the sampler from the partition's seed.
+func (r *RainfallIteration) Configure(
+	partitionIndex int,
+	settings *simulator.Settings,
+) {
+	r.out = make([]float64, 1)
+	r.sampler = rng.New(settings.Iterations[partitionIndex].Seed)
+}
+
+// Iterate computes the next state from this step's fields, params, upstreams and clock.
+func (r *RainfallIteration) Iterate(
+	params *simulator.Params,
+	partitionIndex int,
+	stateHistories []*simulator.StateHistory,
+	timestepsHistory *simulator.CumulativeTimestepsHistory,
+) []float64 {
+	state := stateHistories[partitionIndex].Values.RawRowView(0)
+	rainfallMm := state[0]
+	wetThreshold := params.Map["wet_threshold"][0]
+	pWetGivenWet := params.Map["p_wet_given_wet"][0]
+	pWetGivenDry := params.Map["p_wet_given_dry"][0]
+	wetDayShape := params.Map["wet_day_shape"][0]
+	wetDayScale := params.Map["wet_day_scale"][0]
+	rainfallMultiplier := params.Map["rainfall_multiplier"][0]
+	var pWet float64
+	if rainfallMm > wetThreshold {
+		pWet = pWetGivenWet
+	} else {
+		pWet = pWetGivenDry
+	}
+	draw := r.sampler.Uniform(0.0, 1.0)
+	todayWet := general.ExpressionBool(draw < pWet)
+	var chosen float64
+	if todayWet != 0.0 {
+		draw2 := r.sampler.Gamma(math.Max(wetDayShape, 0.01), 1.0/math.Max(wetDayScale, 0.01))
+		chosen = math.Max(draw2*rainfallMultiplier, wetThreshold)
+	} else {
+		chosen = 0.0
+	}
+	r.out[0] = chosen
+	return r.out
+}
@@ -0,0 +1,67 @@
+// Code generated by stochadex codegen from declarative.yaml, partition runoff; DO NOT EDIT.
+
+package floodrisk
+
+import (
+	"math"
+
+	"github.com/umbralcalc/stochadex/pkg/general"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// RunoffIteration is the runoff partition of declarative.yaml with its expressions generated as
+// Go. It computes what the declarative iteration computes from the same spec, draw for draw,
+// for the widths that config gives its fields, params and upstreams, and must be regenerated
+// when they change.
+type RunoffIteration struct {
+	out        []float64
+	rainfallMm int
+}
+
+// Configure sizes the buffers and resolves the upstream partitions by name.
+func (r *RunoffIteration) Configure(
+	partitionIndex int,
+	settings *simulator.Settings,
+) {
+	r.out = make([]float64, 4)
+	r.rainfallMm = general.ExpressionUpstream(settings, "rainfall", "rainfall_mm")
+}
+
+// Iterate computes the next state from this step's fields, params, upstreams and clock.
+func (r *RunoffIteration) Iterate(
+	params *simulator.Params,
+	partitionIndex int,
+	stateHistories []*simulator.StateHistory,
+	timestepsHistory *simulator.CumulativeTimestepsHistory,
+) []float64 {
+	rainfallMm := stateHistories[r.rainfallMm].Values.At(0, 0)
+	etRate := params.Map["et_rate"][0]
+	dt := timestepsHistory.NextIncrement
+	state := stateHistories[partitionIndex].Values.RawRowView(0)
+	soilMoisture := state[0]
+	fieldCapacity := params.Map["field_capacity"][0]
+	runoffShape := params.Map["runoff_shape"][0]
+	drainageRate := params.Map["drainage_rate"][0]
+	catchmentAreaKm2 := params.Map["catchment_area_km2"][0]
+	fastRecessionRate := params.Map["fast_recession_rate"][0]
+	fastFlow := state[2]
+	slowRecessionRate := params.Map["slow_recession_rate"][0]
+	slowFlow := state[3]
+	netRainfall := math.Max(rainfallMm-etRate, 0.0) * dt
+	saturation := math.Min(math.Max(soilMoisture/fieldCapacity, 0.0), 1.0)
+	runoffFraction := 1.0 - math.Pow(1.0-saturation, runoffShape)
+	directRunoff := netRainfall * runoffFraction
+	wettedSoil := soilMoisture + (netRainfall - directRunoff)
+	excess := math.Max(wettedSoil-fieldCapacity, 0.0)
+	cappedSoil := wettedSoil - excess
+	totalDirectRunoff := directRunoff + excess
+	drainage := drainageRate * cappedSoil * dt
+	mmToM3s := catchmentAreaKm2 * 1000.0 / (86400.0 * dt)
+	nextFastFlow := fastRecessionRate*(totalDirectRunoff*mmToM3s) + (1.0-fastRecessionRate)*fastFlow
+	nextSlowFlow := slowRecessionRate*(drainage*mmToM3s) + (1.0-slowRecessionRate)*slowFlow
+	r.out[0] = math.Max(cappedSoil-drainage, 0.0)
+	r.out[1] = nextFastFlow + nextSlowFlow
+	r.out[2] = nextFastFlow
+	r.out[3] = nextSlowFlow
+	return r.out
+}
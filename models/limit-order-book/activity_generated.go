@@ -0,0 +1,44 @@
+// Code generated by stochadex codegen from declarative.yaml, partition activity; DO NOT EDIT.
+
+package lob
+
+import (
+	"github.com/umbralcalc/stochadex/pkg/rng"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// GeneratedActivityIteration is the activity partition of declarative.yaml with its expressions
+// generated as Go. It computes what the declarative iteration computes from the same spec, draw
+// for draw, for the widths that config gives its fields, params and upstreams, and must be
+// regenerated when they change.
+type GeneratedActivityIteration struct {
+	out     []float64
+	sampler *rng.Sampler
+}
+
+// Configure sizes the buffers and seeds the sampler from the partition's seed.
+func (g *GeneratedActivityIteration) Configure(
+	partitionIndex int,
+	settings *simulator.Settings,
+) {
+	g.out = make([]float64, 1)
+	g.sampler = rng.New(settings.Iterations[partitionIndex].Seed)
+}
+
+// Iterate computes the next state from this step's fields, params, upstreams and clock.
+func (g *GeneratedActivityIteration) Iterate(
+	params *simulator.Params,
+	partitionIndex int,
+	stateHistories []*simulator.StateHistory,
+	timestepsHistory *simulator.CumulativeTimestepsHistory,
+) []float64 {
+	persistence := params.Map["persistence"][0]
+	state := stateHistories[partitionIndex].Values.RawRowView(0)
+	actPrev := state[0]
+	activityShape := params.Map["activity_shape"][0]
+	activityRate := params.Map["activity_rate"][0]
+	draw := g.sampler.Gamma(activityShape, activityRate)
+	act := persistence*actPrev + (1.0-persistence)*draw
+	g.out[0] = act
+	return g.out
+}
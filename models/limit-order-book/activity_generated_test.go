@@ -0,0 +1,117 @@
+// Code generated by stochadex codegen from declarative.yaml, partition activity; DO NOT EDIT.
+
+package lob
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/api"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// generatedActivityIterationLockstep runs the declarative iteration, which drives the run, and hands the
+// generated one the same inputs every step, recording the first step the two disagree on. They
+// draw from samplers seeded alike, in the same order, so they agree to rounding: compiled Go is
+// free to fuse a multiply and an add, so the tolerance is FMA-scale rather than zero.
+type generatedActivityIterationLockstep struct {
+	declarative simulator.Iteration
+	generated   *GeneratedActivityIteration
+	steps       int
+	mismatch    string
+}
+
+func (l *generatedActivityIterationLockstep) Configure(partitionIndex int, settings *simulator.Settings) {
+	l.declarative.Configure(partitionIndex, settings)
+	l.generated.Configure(partitionIndex, settings)
+}
+
+func (l *generatedActivityIterationLockstep) Iterate(
+	params *simulator.Params,
+	partitionIndex int,
+	stateHistories []*simulator.StateHistory,
+	timestepsHistory *simulator.CumulativeTimestepsHistory,
+) []float64 {
+	want := l.declarative.Iterate(params, partitionIndex, stateHistories, timestepsHistory)
+	got := l.generated.Iterate(params, partitionIndex, stateHistories, timestepsHistory)
+	l.steps++
+	for k := range want {
+		if l.mismatch != "" || got[k] == want[k] || math.IsNaN(got[k]) && math.IsNaN(want[k]) {
+			continue
+		}
+		d := math.Abs(got[k] - want[k])
+		if s := math.Abs(want[k]); s > 1 {
+			d /= s
+		}
+		if !(d <= 1e-12) {
+			l.mismatch = fmt.Sprintf("step %d, element %d: generated %v, declarative %v",
+				l.steps, k, got[k], want[k])
+		}
+	}
+	return want
+}
+
+// generatedActivityIterationRun builds declarative.yaml for a run of steps steps with nothing output, giving
+// the activity partition the iteration swap returns in place of its declarative one.
+func generatedActivityIterationRun(
+	steps int,
+	swap func(declarative simulator.Iteration) simulator.Iteration,
+) (*simulator.Settings, *simulator.Implementations) {
+	config := api.LoadApiRunConfigFromYaml("declarative.yaml")
+	config.Main.Simulation = simulator.SimulationConfig{
+		OutputCondition: &simulator.EveryStepOutputCondition{},
+		TerminationCondition: &simulator.NumberOfStepsTerminationCondition{
+			MaxNumberOfSteps: steps,
+		},
+		TimestepFunction: &simulator.ConstantTimestepFunction{Stepsize: 1.0},
+		InitTimeValue:    0.0,
+	}
+	gen := config.Main.GetConfigGenerator()
+	partition := gen.GetPartition("activity")
+	partition.Iteration = swap(partition.Iteration)
+	settings, implementations := gen.GenerateConfigs()
+	implementations.OutputFunction = &simulator.NilOutputFunction{}
+	implementations.ExecutionStrategy = &simulator.InlineExecution{}
+	return settings, implementations
+}
+
+func TestGeneratedActivityIterationMatchesDeclarative(t *testing.T) {
+	var lockstep *generatedActivityIterationLockstep
+	settings, implementations := generatedActivityIterationRun(1000,
+		func(declarative simulator.Iteration) simulator.Iteration {
+			lockstep = &generatedActivityIterationLockstep{declarative: declarative, generated: &GeneratedActivityIteration{}}
+			return lockstep
+		})
+	simulator.NewPartitionCoordinator(settings, implementations).Run()
+	if lockstep.steps == 0 {
+		t.Fatal("the partition never ran")
+	}
+	if lockstep.mismatch != "" {
+		t.Fatal(lockstep.mismatch)
+	}
+}
+
+// BenchmarkGeneratedActivityIteration runs the config with the partition declarative and then generated, so
+// what the generated Go saves is a measured number.
+func BenchmarkGeneratedActivityIteration(b *testing.B) {
+	for _, twin := range []struct {
+		name string
+		swap func(simulator.Iteration) simulator.Iteration
+	}{
+		{"declarative", func(declarative simulator.Iteration) simulator.Iteration {
+			return declarative
+		}},
+		{"generated", func(simulator.Iteration) simulator.Iteration { return &GeneratedActivityIteration{} }},
+	} {
+		b.Run(twin.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				settings, implementations := generatedActivityIterationRun(1000, twin.swap)
+				b.StartTimer()
+				simulator.NewPartitionCoordinator(settings, implementations).Run()
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+// Code generated by stochadex codegen from declarative.yaml, partition book; DO NOT EDIT.
+
+package lob
+
+import (
+	"math"
+
+	"github.com/umbralcalc/stochadex/pkg/general"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// GeneratedBookIteration is the book partition of declarative.yaml with its expressions
+// generated as Go. It computes what the declarative iteration computes from the same spec, draw
+// for draw, for the widths that config gives its fields, params and upstreams, and must be
+// regenerated when they change.
+type GeneratedBookIteration struct {
+	out     []float64
+	restBid []float64
+	restAsk []float64
+	cumBid  []float64
+	cumAsk  []float64
+	hitBid  []float64
+	hitAsk  []float64
+	nextBid []float64
+	nextAsk []float64
+}
+
+// Configure sizes the buffers.
+func (g *GeneratedBookIteration) Configure(
+	partitionIndex int,
+	settings *simulator.Settings,
+) {
+	g.out = make([]float64, 17)
+	g.restBid = make([]float64, 8)
+	g.restAsk = make([]float64, 8)
+	g.cumBid = make([]float64, 8)
+	g.cumAsk = make([]float64, 8)
+	g.hitBid = make([]float64, 8)
+	g.hitAsk = make([]float64, 8)
+	g.nextBid = make([]float64, 8)
+	g.nextAsk = make([]float64, 8)
+}
+
+// Iterate computes the next state from this step's fields, params, upstreams and clock.
+func (g *GeneratedBookIteration) Iterate(
+	params *simulator.Params,
+	partitionIndex int,
+	stateHistories []*simulator.StateHistory,
+	timestepsHistory *simulator.CumulativeTimestepsHistory,
+) []float64 {
+	flow := params.Map["flow"]
+	state := stateHistories[partitionIndex].Values.RawRowView(0)
+	bid := state[0:8]
+	ask := state[8:16]
+	arrBid := flow[0:8]
+	arrAsk := flow[8:16]
+	canBid := flow[16:24]
+	canAsk := flow[24:32]
+	buySize := flow[32]
+	sellSize := flow[33]
+	restBid := g.restBid
+	for i := range restBid {
+		restBid[i] = bid[i] - canBid[i] + arrBid[i]
+	}
+	restAsk := g.restAsk
+	for i := range restAsk {
+		restAsk[i] = ask[i] - canAsk[i] + arrAsk[i]
+	}
+	cumBid := g.cumBid
+	for lane := range cumBid {
+		i2 := float64(lane)
+		var chosen float64
+		if i2 == 0.0 {
+			chosen = 0.0
+		} else {
+			block := general.ExpressionSlice(restBid, 0.0, math.Max(i2, 1.0))
+			total := 0.0
+			for i := range block {
+				total += block[i]
+			}
+			chosen = total
+		}
+		cumBid[lane] = chosen
+	}
+	cumAsk := g.cumAsk
+	for lane2 := range cumAsk {
+		i3 := float64(lane2)
+		var chosen2 float64
+		if i3 == 0.0 {
+			chosen2 = 0.0
+		} else {
+			block2 := general.ExpressionSlice(restAsk, 0.0, math.Max(i3, 1.0))
+			total2 := 0.0
+			for i := range block2 {
+				total2 += block2[i]
+			}
+			chosen2 = total2
+		}
+		cumAsk[lane2] = chosen2
+	}
+	hitBid := g.hitBid
+	for i := range hitBid {
+		hitBid[i] = math.Min(math.Max(sellSize-cumBid[i], 0.0), restBid[i])
+	}
+	hitAsk := g.hitAsk
+	for i := range hitAsk {
+		hitAsk[i] = math.Min(math.Max(buySize-cumAsk[i], 0.0), restAsk[i])
+	}
+	nextBid := g.nextBid
+	for i := range nextBid {
+		nextBid[i] = restBid[i] - hitBid[i]
+	}
+	nextAsk := g.nextAsk
+	for i := range nextAsk {
+		nextAsk[i] = restAsk[i] - hitAsk[i]
+	}
+	copy(g.out[0:8], nextBid)
+	copy(g.out[8:16], nextAsk)
+	total3 := 0.0
+	for i := range hitBid {
+		total3 += hitBid[i]
+	}
+	total4 := 0.0
+	for i := range hitAsk {
+		total4 += hitAsk[i]
+	}
+	g.out[16] = total3 + total4
+	return g.out
+}
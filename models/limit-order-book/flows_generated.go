@@ -0,0 +1,163 @@
+// Code generated by stochadex codegen from declarative.yaml, partition flows; DO NOT EDIT.
+
+package lob
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/stat/distuv"
+
+	"github.com/umbralcalc/stochadex/pkg/general"
+	"github.com/umbralcalc/stochadex/pkg/rng"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// GeneratedFlowsIteration is the flows partition of declarative.yaml with its expressions
+// generated as Go. It computes what the declarative iteration computes from the same spec, draw
+// for draw, for the widths that config gives its fields, params and upstreams, and must be
+// regenerated when they change.
+type GeneratedFlowsIteration struct {
+	out      []float64
+	bookPrev int
+	arrBid   []float64
+	sampler  *rng.Sampler
+	arrAsk   []float64
+	churnBid []float64
+	churnAsk []float64
+	buffer   []float64
+	canBid   []float64
+	buffer2  []float64
+	canAsk   []float64
+	buffer3  []float64
+	buffer4  []float64
+}
+
+// Configure sizes the buffers, resolves the upstream partitions by name and seeds the sampler
+// from the partition's seed.
+func (g *GeneratedFlowsIteration) Configure(
+	partitionIndex int,
+	settings *simulator.Settings,
+) {
+	g.out = make([]float64, 35)
+	g.bookPrev = general.ExpressionUpstream(settings, "book", "book_prev")
+	g.arrBid = make([]float64, 8)
+	g.sampler = rng.New(settings.Iterations[partitionIndex].Seed)
+	g.arrAsk = make([]float64, 8)
+	g.churnBid = make([]float64, 8)
+	g.churnAsk = make([]float64, 8)
+	g.buffer = make([]float64, 8)
+	g.canBid = make([]float64, 8)
+	g.buffer2 = make([]float64, 8)
+	g.canAsk = make([]float64, 8)
+	g.buffer3 = make([]float64, 8)
+	g.buffer4 = make([]float64, 8)
+}
+
+// Iterate computes the next state from this step's fields, params, upstreams and clock.
+func (g *GeneratedFlowsIteration) Iterate(
+	params *simulator.Params,
+	partitionIndex int,
+	stateHistories []*simulator.StateHistory,
+	timestepsHistory *simulator.CumulativeTimestepsHistory,
+) []float64 {
+	bookPrev := stateHistories[g.bookPrev].Values.RawRowView(0)
+	limitRate := params.Map["limit_rate"][0]
+	arrivalDecay := params.Map["arrival_decay"][0]
+	activity := params.Map["activity"][0]
+	dt := timestepsHistory.NextIncrement
+	actRef := params.Map["act_ref"][0]
+	dampingGamma := params.Map["damping_gamma"][0]
+	arrivalScale := params.Map["arrival_scale"][0]
+	churnRate := params.Map["churn_rate"][0]
+	cancelRate := params.Map["cancel_rate"][0]
+	marketRate := params.Map["market_rate"][0]
+	half := params.Map["half"][0]
+	marketSize := params.Map["market_size"][0]
+	step := float64(timestepsHistory.CurrentStepNumber)
+	shockStep := params.Map["shock_step"][0]
+	shockSize := params.Map["shock_size"][0]
+	bid := bookPrev[0:8]
+	ask := bookPrev[8:16]
+	arrBid := g.arrBid
+	for lane := range arrBid {
+		i2 := float64(lane)
+		draw := g.sampler.Poisson(limitRate * math.Exp(-arrivalDecay*i2) * activity * dt / (1.0 + general.ExpressionSlice(bid, i2, 1.0)[0]*math.Pow(activity/actRef, dampingGamma)/arrivalScale))
+		arrBid[lane] = draw
+	}
+	arrAsk := g.arrAsk
+	for lane2 := range arrAsk {
+		i3 := float64(lane2)
+		draw2 := g.sampler.Poisson(limitRate * math.Exp(-arrivalDecay*i3) * activity * dt / (1.0 + general.ExpressionSlice(ask, i3, 1.0)[0]*math.Pow(activity/actRef, dampingGamma)/arrivalScale))
+		arrAsk[lane2] = draw2
+	}
+	churnBid := g.churnBid
+	for lane3 := range churnBid {
+		i4 := float64(lane3)
+		draw3 := g.sampler.Poisson(churnRate * math.Exp(-arrivalDecay*i4) * activity * dt)
+		churnBid[lane3] = draw3
+	}
+	churnAsk := g.churnAsk
+	for lane4 := range churnAsk {
+		i5 := float64(lane4)
+		draw4 := g.sampler.Poisson(churnRate * math.Exp(-arrivalDecay*i5) * activity * dt)
+		churnAsk[lane4] = draw4
+	}
+	v := g.buffer
+	for i := range v {
+		v[i] = g.sampler.Poisson(cancelRate * bid[i] * dt)
+	}
+	canBid := g.canBid
+	for i := range canBid {
+		canBid[i] = math.Min(bid[i], churnBid[i]+v[i])
+	}
+	v2 := g.buffer2
+	for i := range v2 {
+		v2[i] = g.sampler.Poisson(cancelRate * ask[i] * dt)
+	}
+	canAsk := g.canAsk
+	for i := range canAsk {
+		canAsk[i] = math.Min(ask[i], churnAsk[i]+v2[i])
+	}
+	mkt := g.sampler.Poisson(marketRate * dt)
+	mktBuy := distuv.Binomial{N: mkt, P: half, Src: g.sampler.Rand()}.Rand()
+	var chosen float64
+	if step == shockStep {
+		chosen = shockSize
+	} else {
+		chosen = 0.0
+	}
+	buySize := mktBuy*marketSize + chosen
+	sellSize := (mkt - mktBuy) * marketSize
+	copy(g.out[0:8], arrBid)
+	copy(g.out[8:16], arrAsk)
+	copy(g.out[16:24], canBid)
+	copy(g.out[24:32], canAsk)
+	g.out[32] = buySize
+	g.out[33] = sellSize
+	v3 := g.buffer3
+	for i := range v3 {
+		if churnBid[i] > bid[i] {
+			v3[i] = 1.0
+		} else {
+			v3[i] = 0.0
+		}
+	}
+	total := 0.0
+	for i := range v3 {
+		total += v3[i]
+	}
+	v4 := g.buffer4
+	for i := range v4 {
+		if churnAsk[i] > ask[i] {
+			v4[i] = 1.0
+		} else {
+			v4[i] = 0.0
+		}
+	}
+	total2 := 0.0
+	for i := range v4 {
+		total2 += v4[i]
+	}
+	g.out[34] = total + total2
+	return g.out
+}
@@ -0,0 +1,165 @@
+// Code generated by stochadex codegen from declarative.yaml, partition observables; DO NOT EDIT.
+
+package lob
+
+import (
+	"math"
+
+	"github.com/umbralcalc/stochadex/pkg/general"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// GeneratedObservablesIteration is the observables partition of declarative.yaml with its
+// expressions generated as Go. It computes what the declarative iteration computes from the
+// same spec, draw for draw, for the widths that config gives its fields, params and upstreams,
+// and must be regenerated when they change.
+type GeneratedObservablesIteration struct {
+	out      []float64
+	occBid   []float64
+	occAsk   []float64
+	frontBid []float64
+	frontAsk []float64
+	idx      []float64
+	bookPrev int
+}
+
+// Configure sizes the buffers and resolves the upstream partitions by name.
+func (g *GeneratedObservablesIteration) Configure(
+	partitionIndex int,
+	settings *simulator.Settings,
+) {
+	g.out = make([]float64, 6)
+	g.occBid = make([]float64, 8)
+	g.occAsk = make([]float64, 8)
+	g.frontBid = make([]float64, 8)
+	g.frontAsk = make([]float64, 8)
+	g.idx = make([]float64, 8)
+	g.bookPrev = general.ExpressionUpstream(settings, "book", "book_prev")
+}
+
+// Iterate computes the next state from this step's fields, params, upstreams and clock.
+func (g *GeneratedObservablesIteration) Iterate(
+	params *simulator.Params,
+	partitionIndex int,
+	stateHistories []*simulator.StateHistory,
+	timestepsHistory *simulator.CumulativeTimestepsHistory,
+) []float64 {
+	bookNow := params.Map["book_now"]
+	flow := params.Map["flow"]
+	bookPrev := stateHistories[g.bookPrev].Values.RawRowView(0)
+	emptySpread := params.Map["empty_spread"][0]
+	postBid := bookNow[0:8]
+	postAsk := bookNow[8:16]
+	occBid := g.occBid
+	for i := range occBid {
+		if postBid[i] > 0.0 {
+			occBid[i] = 1.0
+		} else {
+			occBid[i] = 0.0
+		}
+	}
+	occAsk := g.occAsk
+	for i := range occAsk {
+		if postAsk[i] > 0.0 {
+			occAsk[i] = 1.0
+		} else {
+			occAsk[i] = 0.0
+		}
+	}
+	frontBid := g.frontBid
+	for lane := range frontBid {
+		i2 := float64(lane)
+		var chosen2 float64
+		if i2 == 0.0 {
+			chosen2 = 1.0
+		} else {
+			block := general.ExpressionSlice(occBid, 0.0, math.Max(i2, 1.0))
+			total := 0.0
+			for i := range block {
+				total += block[i]
+			}
+			var chosen float64
+			if total == 0.0 {
+				chosen = 1.0
+			} else {
+				chosen = 0.0
+			}
+			chosen2 = chosen
+		}
+		frontBid[lane] = chosen2
+	}
+	frontAsk := g.frontAsk
+	for lane2 := range frontAsk {
+		i3 := float64(lane2)
+		var chosen4 float64
+		if i3 == 0.0 {
+			chosen4 = 1.0
+		} else {
+			block2 := general.ExpressionSlice(occAsk, 0.0, math.Max(i3, 1.0))
+			total2 := 0.0
+			for i := range block2 {
+				total2 += block2[i]
+			}
+			var chosen3 float64
+			if total2 == 0.0 {
+				chosen3 = 1.0
+			} else {
+				chosen3 = 0.0
+			}
+			chosen4 = chosen3
+		}
+		frontAsk[lane2] = chosen4
+	}
+	idx := g.idx
+	for lane3 := range idx {
+		i4 := float64(lane3)
+		idx[lane3] = i4
+	}
+	bestBid := 0.0
+	for i := 0; i < 8; i++ {
+		bestBid += idx[i] * (occBid[i] * frontBid[i])
+	}
+	bestAsk := 0.0
+	for i := 0; i < 8; i++ {
+		bestAsk += idx[i] * (occAsk[i] * frontAsk[i])
+	}
+	total3 := 0.0
+	for i := range occBid {
+		total3 += occBid[i]
+	}
+	total4 := 0.0
+	for i := range occAsk {
+		total4 += occAsk[i]
+	}
+	var twoSided float64
+	if total3*total4 > 0.0 {
+		twoSided = 1.0
+	} else {
+		twoSided = 0.0
+	}
+	total5 := 0.0
+	for i := range flow[0:16] {
+		total5 += flow[0:16][i]
+	}
+	g.out[0] = total5
+	total6 := 0.0
+	for i := range flow[16:32] {
+		total6 += flow[16:32][i]
+	}
+	g.out[1] = total6
+	g.out[2] = bookNow[16]
+	total7 := 0.0
+	for i := range bookPrev[0:16] {
+		total7 += bookPrev[0:16][i]
+	}
+	g.out[3] = total7
+	var chosen5 float64
+	if twoSided > 0.0 {
+		chosen5 = bestBid + bestAsk + 2.0
+	} else {
+		chosen5 = emptySpread
+	}
+	g.out[4] = chosen5
+	g.out[5] = flow[34]
+	return g.out
+}
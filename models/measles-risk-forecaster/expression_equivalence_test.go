@@ -42,6 +42,7 @@ import (
 	"gonum.org/v1/gonum/mat"
 
 	"github.com/umbralcalc/stochadex/models/cardgen"
+	"github.com/umbralcalc/stochadex/models/twinbench"
 	"github.com/umbralcalc/stochadex/pkg/api"
 	"github.com/umbralcalc/stochadex/pkg/general"
 	"github.com/umbralcalc/stochadex/pkg/simulator"
@@ -454,3 +455,11 @@ func TestDeclarativeMeaslesAnswersTheSameClaims(t *testing.T) {
 	}
 	t.Logf("max deviation across every claim observation: %g", maxDev)
 }
+
+func BenchmarkDeclarativeTwin(b *testing.B) {
+	twinbench.Run(b, func() *simulator.ConfigGenerator {
+		return BuildStub(DefaultMMR2Coverage, DefaultMaxGenerations, 0)
+	}, func() *simulator.ConfigGenerator {
+		return declarativeBuildStub(DefaultMMR2Coverage, DefaultMaxGenerations, 0)
+	})
+}
@@ -0,0 +1,35 @@
+// Package twinbench holds the benchmark behind every model's BenchmarkDeclarativeTwin: the
+// flagship horizon run from stub.go and from declarative.yaml, so what writing the model as
+// data costs over writing it in Go is a measured number.
+package twinbench
+
+import (
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// Run benchmarks the runs stub and declarative build as the sub-benchmarks "stub" and
+// "declarative". Builds are untimed, and both run inline with no output, so the timing is the
+// iterations' own.
+func Run(b *testing.B, stub, declarative func() *simulator.ConfigGenerator) {
+	for _, twin := range []struct {
+		name  string
+		build func() *simulator.ConfigGenerator
+	}{
+		{"stub", stub},
+		{"declarative", declarative},
+	} {
+		b.Run(twin.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				settings, implementations := twin.build().GenerateConfigs()
+				implementations.OutputFunction = &simulator.NilOutputFunction{}
+				implementations.ExecutionStrategy = &simulator.InlineExecution{}
+				b.StartTimer()
+				simulator.NewPartitionCoordinator(settings, implementations).Run()
+			}
+		})
+	}
+}
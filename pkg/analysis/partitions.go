@@ -1,6 +1,8 @@
 package analysis
 
 import (
+	"context"
+
 	"github.com/umbralcalc/stochadex/pkg/general"
 	"github.com/umbralcalc/stochadex/pkg/simulator"
 )
@@ -13,6 +15,22 @@ func NewStateTimeStorageFromPartitions(
 	timestep simulator.TimestepFunction,
 	initTime float64,
 ) *simulator.StateTimeStorage {
+	storage, _ := NewStateTimeStorageFromPartitionsContext(
+		context.Background(), partitions, termination, timestep, initTime,
+	)
+	return storage
+}
+
+// NewStateTimeStorageFromPartitionsContext is NewStateTimeStorageFromPartitions
+// stopping at a step boundary once ctx is done, in which case it returns
+// ctx.Err() and no storage.
+func NewStateTimeStorageFromPartitionsContext(
+	ctx context.Context,
+	partitions []*simulator.PartitionConfig,
+	termination simulator.TerminationCondition,
+	timestep simulator.TimestepFunction,
+	initTime float64,
+) (*simulator.StateTimeStorage, error) {
 	generator := simulator.NewConfigGenerator()
 	storage := simulator.NewStateTimeStorage()
 	generator.SetSimulation(&simulator.SimulationConfig{
@@ -28,8 +46,10 @@ func NewStateTimeStorageFromPartitions(
 		generator.SetPartition(partition)
 	}
 	coordinator := simulator.NewPartitionCoordinator(generator.GenerateConfigs())
-	coordinator.Run()
-	return storage
+	if err := coordinator.RunContext(ctx); err != nil {
+		return nil, err
+	}
+	return storage, nil
 }
 
 // AddPartitionsToStateTimeStorage extends the state time storage with newly
@@ -42,6 +62,22 @@ func AddPartitionsToStateTimeStorage(
 	partitions []*simulator.PartitionConfig,
 	windowSizeByPartition map[string]int,
 ) *simulator.StateTimeStorage {
+	storage, _ = AddPartitionsToStateTimeStorageContext(
+		context.Background(), storage, partitions, windowSizeByPartition,
+	)
+	return storage
+}
+
+// AddPartitionsToStateTimeStorageContext is AddPartitionsToStateTimeStorage
+// stopping at a step boundary once ctx is done, in which case it returns
+// ctx.Err() and no storage. The partial rows already appended to storage are
+// left in place.
+func AddPartitionsToStateTimeStorageContext(
+	ctx context.Context,
+	storage *simulator.StateTimeStorage,
+	partitions []*simulator.PartitionConfig,
+	windowSizeByPartition map[string]int,
+) (*simulator.StateTimeStorage, error) {
 	generator := simulator.NewConfigGenerator()
 	times := storage.GetTimes()
 	outputPartitions := make(map[string]bool)
@@ -83,6 +119,8 @@ func AddPartitionsToStateTimeStorage(
 		generator.SetPartition(partition)
 	}
 	coordinator := simulator.NewPartitionCoordinator(generator.GenerateConfigs())
-	coordinator.Run()
-	return storage
+	if err := coordinator.RunContext(ctx); err != nil {
+		return nil, err
+	}
+	return storage, nil
 }
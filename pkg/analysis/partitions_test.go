@@ -1,6 +1,8 @@
 package analysis
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/umbralcalc/stochadex/pkg/general"
@@ -82,4 +84,31 @@ func TestPartitions(t *testing.T) {
 			}
 		},
 	)
+	t.Run(
+		"test that a cancelled context stops the storage run",
+		func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			storage, err := NewStateTimeStorageFromPartitionsContext(
+				ctx,
+				[]*simulator.PartitionConfig{{
+					Name:              "test",
+					Iteration:         &general.ConstantValuesIteration{},
+					Params:            simulator.NewParams(make(map[string][]float64)),
+					InitStateValues:   []float64{1.0},
+					StateHistoryDepth: 1,
+				}},
+				&simulator.NumberOfStepsTerminationCondition{
+					MaxNumberOfSteps: 100,
+				},
+				&simulator.ConstantTimestepFunction{
+					Stepsize: 1.0,
+				},
+				0.0,
+			)
+			if !errors.Is(err, context.Canceled) || storage != nil {
+				t.Errorf("expected context.Canceled and no storage, got %v", err)
+			}
+		},
+	)
 }
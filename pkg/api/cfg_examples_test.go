@@ -43,6 +43,8 @@ func TestExampleConfigsRun(t *testing.T) {
 		"cfg/example_regression_config.yaml",
 		"cfg/example_data_source_config.yaml",
 		"cfg/example_from_storage_config.yaml",
+		"cfg/example_functions_config.yaml",
+		"cfg/example_matrix_config.yaml",
 	}
 	for _, path := range examples {
 		t.Run(path, func(t *testing.T) {
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/umbralcalc/stochadex/pkg/general"
+)
+
+// GenerateExpressionGo generates Go for the named expression partition of the config's main
+// run, with the widths the rest of that run gives it. spec's Shapes are filled in here; the
+// rest of it is as general.ExpressionIteration.GenerateGo takes it.
+func GenerateExpressionGo(
+	config *ApiRunConfig,
+	partition string,
+	spec general.ExpressionGoSpec,
+) (*general.ExpressionGo, error) {
+	byName, partitions := config.Main.partitionShapes()
+	p, ok := byName[partition]
+	if !ok {
+		return nil, fmt.Errorf("api: codegen: no partition %q in the main run", partition)
+	}
+	var e *general.ExpressionIteration
+	for i := range config.Main.Expressions {
+		if config.Main.Expressions[i].Partition == partition {
+			e = &config.Main.Expressions[i].ExpressionIteration
+		}
+	}
+	if e == nil {
+		if e, ok = p.Iteration.(*general.ExpressionIteration); !ok {
+			return nil, fmt.Errorf("api: codegen: partition %q is not an expression partition",
+				partition)
+		}
+	}
+	spec.Partition = partition
+	spec.Shapes = expressionShapes(p, byName, partitions)
+	generated, err := e.GenerateGo(spec)
+	if err != nil {
+		return nil, fmt.Errorf("api: codegen: partition %q: %w", partition, err)
+	}
+	return generated, nil
+}
+
+// CodegenWithParsedArgs generates Go for an expression partition as `stochadex codegen` is
+// asked to, writing <partition>_generated.go and <partition>_generated_test.go into the output
+// directory. The package defaults to the one the directory's Go files are already in, and the
+// type to the partition's name in camel case with Iteration after it; a type the package
+// already declares is refused rather than written over, so that a model whose hand-written Go
+// is being checked against can keep it.
+func CodegenWithParsedArgs(args CodegenArgs) {
+	if err := codegen(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func codegen(args CodegenArgs) error {
+	directory := args.OutputDirectory
+	if directory == "" {
+		directory = filepath.Dir(args.ConfigFile)
+	}
+	base := strings.ReplaceAll(args.Partition, "-", "_")
+	generated := map[string]bool{
+		base + "_generated.go":      true,
+		base + "_generated_test.go": true,
+	}
+	packageName, declared, err := goPackageDeclarations(directory, generated)
+	if err != nil {
+		return err
+	}
+	if args.Package != "" {
+		packageName = args.Package
+	}
+	if packageName == "" {
+		return fmt.Errorf("api: codegen: no Go package in %s to generate into; pass --package",
+			directory)
+	}
+	typeName := args.Type
+	if typeName == "" {
+		typeName = codegenTypeName(args.Partition)
+	}
+	if declared[typeName] {
+		return fmt.Errorf("api: codegen: package %s already declares %s; pass --type to name "+
+			"the generated iteration something else", packageName, typeName)
+	}
+	configPath, err := filepath.Rel(directory, args.ConfigFile)
+	if err != nil {
+		configPath = args.ConfigFile
+	}
+	out, err := GenerateExpressionGo(LoadApiRunConfigFromYaml(args.ConfigFile), args.Partition,
+		general.ExpressionGoSpec{
+			Package: packageName,
+			Type:    typeName,
+			Config:  filepath.ToSlash(configPath),
+			Steps:   args.Steps,
+		})
+	if err != nil {
+		return err
+	}
+	for _, file := range []struct {
+		name   string
+		source []byte
+	}{
+		{base + "_generated.go", out.Iteration},
+		{base + "_generated_test.go", out.Test},
+	} {
+		path := filepath.Join(directory, file.name)
+		if err := os.WriteFile(path, file.source, 0o644); err != nil {
+			return fmt.Errorf("api: codegen: %w", err)
+		}
+		fmt.Println("wrote", path)
+	}
+	return nil
+}
+
+// codegenTypeName is the default name of the iteration generated for partition.
+func codegenTypeName(partition string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range partition {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			upper = true
+		case upper:
+			b.WriteRune(unicode.ToUpper(r))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String() + "Iteration"
+}
+
+// goPackageDeclarations is the package the Go files in directory are in, other than the
+// skipped ones, and the names they declare at the top level. A directory with no Go files
+// gives an empty package name.
+func goPackageDeclarations(directory string, skip map[string]bool) (
+	string,
+	map[string]bool,
+	error,
+) {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return "", nil, fmt.Errorf("api: codegen: %w", err)
+	}
+	packageName := ""
+	declared := make(map[string]bool)
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || skip[name] {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(directory, name), nil,
+			parser.SkipObjectResolution)
+		if err != nil {
+			return "", nil, fmt.Errorf("api: codegen: %w", err)
+		}
+		test := strings.HasSuffix(name, "_test.go")
+		if !test || packageName == "" {
+			packageName = strings.TrimSuffix(file.Name.Name, "_test")
+		}
+		if test && strings.HasSuffix(file.Name.Name, "_test") {
+			continue
+		}
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Recv == nil {
+					declared[d.Name.Name] = true
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch s := spec.(type) {
+					case *ast.TypeSpec:
+						declared[s.Name.Name] = true
+					case *ast.ValueSpec:
+						for _, n := range s.Names {
+							declared[n.Name] = true
+						}
+					}
+				}
+			}
+		}
+	}
+	return packageName, declared, nil
+}
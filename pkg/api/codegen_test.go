@@ -0,0 +1,120 @@
+package api
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/general"
+)
+
+// generatedModels are the generated iterations committed beside the models they come from,
+// each of which runs its own test against the declarative partition it was generated from.
+var generatedModels = []struct {
+	model, partition, typeName string
+}{
+	{"floodrisk", "rainfall", "RainfallIteration"},
+	{"floodrisk", "runoff", "RunoffIteration"},
+	{"limit-order-book", "activity", "GeneratedActivityIteration"},
+	{"limit-order-book", "flows", "GeneratedFlowsIteration"},
+	{"limit-order-book", "book", "GeneratedBookIteration"},
+	{"limit-order-book", "observables", "GeneratedObservablesIteration"},
+}
+
+func TestGeneratedModelIterationsAreFresh(t *testing.T) {
+	for _, m := range generatedModels {
+		t.Run(m.model+"/"+m.partition, func(t *testing.T) {
+			directory := filepath.Join("..", "..", "models", m.model)
+			packageName, _, err := goPackageDeclarations(directory, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			generated, err := GenerateExpressionGo(
+				LoadApiRunConfigFromYaml(filepath.Join(directory, "declarative.yaml")),
+				m.partition,
+				general.ExpressionGoSpec{
+					Package: packageName,
+					Type:    m.typeName,
+					Config:  "declarative.yaml",
+					Steps:   1000,
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range map[string][]byte{
+				m.partition + "_generated.go":      generated.Iteration,
+				m.partition + "_generated_test.go": generated.Test,
+			} {
+				got, err := os.ReadFile(filepath.Join(directory, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("models/%s/%s is stale; regenerate it with stochadex codegen -c "+
+						"declarative.yaml -p %s -t %s", m.model, name, m.partition, m.typeName)
+				}
+			}
+		})
+	}
+}
+
+func TestCodegenWritesBesideTheConfig(t *testing.T) {
+	directory := t.TempDir()
+	config, err := os.ReadFile("test_program_expression_config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(directory, "walk.yaml")
+	if err := os.WriteFile(configFile, config, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	doc := []byte("// Package walk is a random walk.\npackage walk\n")
+	if err := os.WriteFile(filepath.Join(directory, "doc.go"), doc, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := codegen(CodegenArgs{ConfigFile: configFile, Partition: "walk", Steps: 10}); err != nil {
+		t.Fatal(err)
+	}
+	iteration, err := os.ReadFile(filepath.Join(directory, "walk_generated.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"package walk", "type WalkIteration struct", "x + drift*dt"} {
+		if !strings.Contains(string(iteration), want) {
+			t.Errorf("walk_generated.go lacks %q:\n%s", want, iteration)
+		}
+	}
+	test, err := os.ReadFile(filepath.Join(directory, "walk_generated_test.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(test), `api.LoadApiRunConfigFromYaml("walk.yaml")`) {
+		t.Errorf("walk_generated_test.go should load the config beside it:\n%s", test)
+	}
+
+	t.Run("regenerating replaces its own files", func(t *testing.T) {
+		if err := codegen(CodegenArgs{ConfigFile: configFile, Partition: "walk"}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("a type the package already declares is refused", func(t *testing.T) {
+		taken := []byte("package walk\n\ntype WalkIteration struct{}\n")
+		if err := os.WriteFile(filepath.Join(directory, "walk.go"), taken, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		err := codegen(CodegenArgs{ConfigFile: configFile, Partition: "walk"})
+		if err == nil || !strings.Contains(err.Error(), "already declares WalkIteration") {
+			t.Fatalf("got %v, want the clash reported", err)
+		}
+	})
+	t.Run("a partition that is not an expression is refused", func(t *testing.T) {
+		err := codegen(CodegenArgs{ConfigFile: configFile, Partition: "nowhere", Type: "Nowhere"})
+		if err == nil || !strings.Contains(err.Error(), `no partition "nowhere"`) {
+			t.Fatalf("got %v, want the missing partition reported", err)
+		}
+	})
+}
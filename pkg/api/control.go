@@ -0,0 +1,270 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+	"google.golang.org/protobuf/proto"
+)
+
+// NewLiveRunHandler returns an http.HandlerFunc that upgrades each request to a
+// websocket, runs a fresh simulation from generator on it and streams every
+// output as a PartitionState message — the live run behind
+// StepAndServeWebsocket.
+//
+// The connection is bidirectional: the client may send ControlMessage values
+// (cmd/messages/control_message.proto) back at any time to pause, resume or
+// single-step the run, change the delay between steps, overwrite a partition's
+// params, or request a snapshot of the current state histories. Controls are
+// applied between steps, in arrival order, so a step never observes a
+// half-applied change. The run stops when the termination condition is met or
+// the client disconnects, or when the request's context is done. A partition
+// that panics, or a non-finite value under NonFiniteHalt, ends it with a
+// websocket close frame whose reason is the error.
+//
+// Usage hints:
+//   - stepDelay is the initial delay between steps; SET_STEP_DELAY changes it.
+//   - startPaused holds the run before its first step until the client sends
+//     RESUME or STEP, so a client can connect, snapshot and tweak params first.
+//   - Malformed or inapplicable controls (an unknown partition, a negative
+//     delay, a zero snapshot id) are logged and ignored; the run continues.
+func NewLiveRunHandler(
+	generator *simulator.ConfigGenerator,
+	stepDelay time.Duration,
+	startPaused bool,
+) http.HandlerFunc {
+	var upgrader = websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		connection, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Println("Error upgrading to WebSocket:", err)
+			return
+		}
+		defer connection.Close()
+		// the server's owner may end the run through the request context; a
+		// closed connection stops it like a client disconnect
+		stop := context.AfterFunc(r.Context(), func() { connection.Close() })
+		defer stop()
+
+		var mutex sync.Mutex
+		simulationConfig := generator.GetSimulation()
+		simulationConfig.OutputFunction =
+			simulator.NewWebsocketOutputFunction(connection, &mutex)
+		generator.SetSimulation(simulationConfig)
+		run := &liveRun{
+			coordinator: simulator.NewPartitionCoordinator(
+				generator.GenerateConfigs(),
+			),
+			connection: connection,
+			mutex:      &mutex,
+			stepDelay:  stepDelay,
+			paused:     startPaused,
+		}
+		run.serve()
+	}
+}
+
+// liveRun is the per-connection state of a controllable websocket run. Every
+// field is owned by the goroutine running serve; the reader goroutine only
+// hands decoded messages over the controls channel.
+type liveRun struct {
+	coordinator  *simulator.PartitionCoordinator
+	connection   *websocket.Conn
+	mutex        *sync.Mutex
+	stepDelay    time.Duration
+	paused       bool
+	pendingSteps int
+}
+
+// serve steps the run to termination under the configured execution
+// strategy, applying controls between steps. A step that fails is logged and
+// ends the run with a close frame carrying the error.
+func (l *liveRun) serve() {
+	controls := make(chan *simulator.ControlMessage)
+	disconnected := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go l.readControls(controls, disconnected, done)
+
+	defer l.coordinator.Close()
+	stepper := l.coordinator.NewStepper()
+	defer stepper.Close()
+	for !l.coordinator.ReadyToTerminate() {
+		// apply every control that has already arrived
+		for pending := true; pending; {
+			select {
+			case message := <-controls:
+				l.apply(message)
+			case <-disconnected:
+				return
+			default:
+				pending = false
+			}
+		}
+		// a paused run with no single steps owed blocks until told otherwise
+		if l.paused && l.pendingSteps == 0 {
+			select {
+			case message := <-controls:
+				l.apply(message)
+			case <-disconnected:
+				return
+			}
+			continue
+		}
+		if err := simulator.StepRecovering(stepper); err != nil {
+			log.Println("Error stepping live run:", err)
+			l.closeWithError(err)
+			return
+		}
+		if l.paused {
+			l.pendingSteps--
+			continue
+		}
+		// sleep between steps so the websocket streams state at a watchable
+		// rate, staying responsive to controls while waiting
+		deadline := time.Now().Add(l.stepDelay)
+		for !l.paused && time.Now().Before(deadline) {
+			select {
+			case <-time.After(time.Until(deadline)):
+			case message := <-controls:
+				l.apply(message)
+			case <-disconnected:
+				return
+			}
+		}
+	}
+}
+
+// closeWithError sends the client a close frame carrying err's text, cut to
+// the length a close frame can hold, so a failed run ends with its reason.
+func (l *liveRun) closeWithError(err error) {
+	reason := err.Error()
+	if len(reason) > maxCloseReason {
+		reason = strings.ToValidUTF8(reason[:maxCloseReason], "")
+	}
+	message := websocket.FormatCloseMessage(websocket.CloseInternalServerErr, reason)
+	if err := l.connection.WriteControl(
+		websocket.CloseMessage, message, time.Now().Add(time.Second),
+	); err != nil {
+		log.Println("Error sending close message:", err)
+	}
+}
+
+// maxCloseReason is the longest reason a close frame carries: a control frame's
+// 125-byte payload less the two-byte close code.
+const maxCloseReason = 123
+
+// readControls decodes ControlMessages from the connection until it fails
+// (normally because the client disconnected) or serve returns.
+func (l *liveRun) readControls(
+	controls chan<- *simulator.ControlMessage,
+	disconnected chan<- struct{},
+	done <-chan struct{},
+) {
+	defer close(disconnected)
+	for {
+		_, data, err := l.connection.ReadMessage()
+		if err != nil {
+			return
+		}
+		message := &simulator.ControlMessage{}
+		if err := proto.Unmarshal(data, message); err != nil {
+			log.Println("Error unmarshaling control message:", err)
+			continue
+		}
+		select {
+		case controls <- message:
+		case <-done:
+			return
+		}
+	}
+}
+
+// apply carries out one control message between steps.
+func (l *liveRun) apply(message *simulator.ControlMessage) {
+	switch message.GetCommand() {
+	case simulator.ControlCommand_CONTROL_COMMAND_PAUSE:
+		l.paused = true
+		l.pendingSteps = 0
+	case simulator.ControlCommand_CONTROL_COMMAND_RESUME:
+		l.paused = false
+		l.pendingSteps = 0
+	case simulator.ControlCommand_CONTROL_COMMAND_STEP:
+		l.paused = true
+		l.pendingSteps += max(int(message.GetSteps()), 1)
+	case simulator.ControlCommand_CONTROL_COMMAND_SET_STEP_DELAY:
+		milliseconds := message.GetStepDelayMilliseconds()
+		if milliseconds < 0 {
+			log.Println("Ignoring negative step delay:", milliseconds)
+			return
+		}
+		l.stepDelay = time.Duration(milliseconds * float64(time.Millisecond))
+	case simulator.ControlCommand_CONTROL_COMMAND_SET_PARAMS:
+		l.setParams(message.GetPartitionName(), message.GetParams())
+	case simulator.ControlCommand_CONTROL_COMMAND_SNAPSHOT:
+		l.sendSnapshot(message.GetRequestId())
+	}
+}
+
+// setParams overwrites the named entries of a partition's params. Entries
+// wired from params_from_upstream are overwritten again by the next step's
+// injection, so setting them has no lasting effect.
+func (l *liveRun) setParams(partitionName string, params []*simulator.ParamValues) {
+	for _, iterator := range l.coordinator.Iterators {
+		if iterator.Partition.Name != partitionName {
+			continue
+		}
+		for _, param := range params {
+			iterator.Params.Set(
+				param.GetName(), append([]float64(nil), param.GetValues()...))
+		}
+		return
+	}
+	log.Println("Ignoring params for unknown partition:", partitionName)
+}
+
+// sendSnapshot writes every row of every partition's state history as
+// PartitionState frames tagged with requestId, in partition index order and
+// then row order (row 0 is the most recent committed state). The frames are
+// written under the output mutex, so no live output is interleaved with them.
+func (l *liveRun) sendSnapshot(requestId uint64) {
+	if requestId == 0 {
+		log.Println("Ignoring snapshot request without a nonzero request_id")
+		return
+	}
+	shared := l.coordinator.Shared
+	size := 0
+	for _, history := range shared.StateHistories {
+		size += history.StateHistoryDepth
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for index, history := range shared.StateHistories {
+		for row := 0; row < history.StateHistoryDepth; row++ {
+			data, err := proto.Marshal(&simulator.PartitionState{
+				CumulativeTimesteps: shared.TimestepsHistory.Values.AtVec(row),
+				PartitionName:       l.coordinator.Iterators[index].Partition.Name,
+				State:               history.Values.RawRowView(row),
+				SnapshotId:          requestId,
+				HistoryRow:          uint32(row),
+				SnapshotSize:        uint32(size),
+			})
+			if err != nil {
+				log.Println("Error marshaling snapshot frame:", err)
+				return
+			}
+			if err := l.connection.WriteMessage(websocket.BinaryMessage, data); err != nil {
+				log.Println("Error writing snapshot to WebSocket:", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/umbralcalc/stochadex/pkg/general"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+	"google.golang.org/protobuf/proto"
+)
+
+// liveRunGenerator builds a one-partition run whose state grows by its "rate"
+// param each step, so a SET_PARAMS control shows up directly in the output.
+func liveRunGenerator(maxSteps int) *simulator.ConfigGenerator {
+	generator := simulator.NewConfigGenerator()
+	generator.SetSimulation(&simulator.SimulationConfig{
+		OutputCondition: &simulator.EveryStepOutputCondition{},
+		OutputFunction:  &simulator.NilOutputFunction{},
+		TerminationCondition: &simulator.NumberOfStepsTerminationCondition{
+			MaxNumberOfSteps: maxSteps,
+		},
+		TimestepFunction: &simulator.ConstantTimestepFunction{Stepsize: 1.0},
+		InitTimeValue:    0.0,
+	})
+	generator.SetPartition(&simulator.PartitionConfig{
+		Name: "counter",
+		Iteration: &general.ExpressionIteration{
+			Fields:  []general.ExpressionField{{Name: "x"}},
+			Outputs: []string{"x + rate"},
+		},
+		Params: simulator.NewParams(map[string][]float64{
+			"rate": {1.0},
+		}),
+		InitStateValues:   []float64{0.0},
+		StateHistoryDepth: 3,
+	})
+	return generator
+}
+
+// liveRunClient is an in-process websocket client for a live run.
+type liveRunClient struct {
+	t          *testing.T
+	connection *websocket.Conn
+}
+
+func dialLiveRun(
+	t *testing.T,
+	generator *simulator.ConfigGenerator,
+	startPaused bool,
+) *liveRunClient {
+	t.Helper()
+	server := httptest.NewServer(NewLiveRunHandler(generator, 0, startPaused))
+	t.Cleanup(server.Close)
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	connection, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { connection.Close() })
+	client := &liveRunClient{t: t, connection: connection}
+	// the coordinator outputs every partition's initial state on creation
+	if initial := client.receive(); initial.CumulativeTimesteps != 0.0 ||
+		initial.SnapshotId != 0 {
+		t.Fatalf("expected the initial state frame first, got %+v", initial)
+	}
+	return client
+}
+
+func (c *liveRunClient) send(message *simulator.ControlMessage) {
+	c.t.Helper()
+	data, err := proto.Marshal(message)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := c.connection.WriteMessage(websocket.BinaryMessage, data); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// receive reads the next frame, failing the test if none arrives in time.
+func (c *liveRunClient) receive() *simulator.PartitionState {
+	c.t.Helper()
+	c.connection.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := c.connection.ReadMessage()
+	if err != nil {
+		c.t.Fatalf("no frame received: %v", err)
+	}
+	state := &simulator.PartitionState{}
+	if err := proto.Unmarshal(data, state); err != nil {
+		c.t.Fatal(err)
+	}
+	return state
+}
+
+// snapshot requests a snapshot and returns its frames. Because controls are
+// applied in order between steps, the first frame back must belong to it if
+// the run is paused.
+func (c *liveRunClient) snapshot(requestId uint64) []*simulator.PartitionState {
+	c.t.Helper()
+	c.send(&simulator.ControlMessage{
+		Command:   simulator.ControlCommand_CONTROL_COMMAND_SNAPSHOT,
+		RequestId: requestId,
+	})
+	first := c.receive()
+	if first.SnapshotId != requestId {
+		c.t.Fatalf("expected snapshot %d frame, got %+v", requestId, first)
+	}
+	frames := []*simulator.PartitionState{first}
+	for len(frames) < int(first.SnapshotSize) {
+		frames = append(frames, c.receive())
+	}
+	return frames
+}
+
+func TestLiveRunControl(t *testing.T) {
+	t.Run("a paused run only advances on STEP", func(t *testing.T) {
+		client := dialLiveRun(t, liveRunGenerator(10), true)
+
+		// nothing has run yet: the snapshot holds the initial state
+		frames := client.snapshot(1)
+		if len(frames) != 3 || frames[0].State[0] != 0.0 {
+			t.Fatalf("unexpected initial snapshot: %+v", frames)
+		}
+
+		client.send(&simulator.ControlMessage{
+			Command: simulator.ControlCommand_CONTROL_COMMAND_STEP,
+			Steps:   2,
+		})
+		for want := 1.0; want <= 2.0; want++ {
+			state := client.receive()
+			if state.SnapshotId != 0 || state.CumulativeTimesteps != want ||
+				state.State[0] != want {
+				t.Fatalf("step %v: unexpected frame %+v", want, state)
+			}
+		}
+
+		// still paused after the two steps: the next frame is the snapshot,
+		// with rows in most-recent-first order
+		frames = client.snapshot(2)
+		for row, want := range []float64{2.0, 1.0, 0.0} {
+			if frames[row].HistoryRow != uint32(row) ||
+				frames[row].PartitionName != "counter" ||
+				frames[row].State[0] != want ||
+				frames[row].CumulativeTimesteps != want {
+				t.Errorf("snapshot row %d = %+v, want state and time %v",
+					row, frames[row], want)
+			}
+		}
+	})
+
+	t.Run("SET_PARAMS applies from the next step", func(t *testing.T) {
+		client := dialLiveRun(t, liveRunGenerator(10), true)
+		client.send(&simulator.ControlMessage{
+			Command:       simulator.ControlCommand_CONTROL_COMMAND_SET_PARAMS,
+			PartitionName: "counter",
+			Params:        []*simulator.ParamValues{{Name: "rate", Values: []float64{10.0}}},
+		})
+		client.send(&simulator.ControlMessage{
+			Command: simulator.ControlCommand_CONTROL_COMMAND_STEP,
+		})
+		if state := client.receive(); state.State[0] != 10.0 {
+			t.Errorf("expected the new rate to apply, got %+v", state)
+		}
+
+		// an unknown partition is ignored and the run carries on
+		client.send(&simulator.ControlMessage{
+			Command:       simulator.ControlCommand_CONTROL_COMMAND_SET_PARAMS,
+			PartitionName: "missing",
+			Params:        []*simulator.ParamValues{{Name: "rate", Values: []float64{0.0}}},
+		})
+		client.send(&simulator.ControlMessage{
+			Command: simulator.ControlCommand_CONTROL_COMMAND_STEP,
+		})
+		if state := client.receive(); state.State[0] != 20.0 {
+			t.Errorf("expected the run to continue at rate 10, got %+v", state)
+		}
+	})
+
+	t.Run("a panicking partition closes the connection with its error", func(t *testing.T) {
+		generator := liveRunGenerator(10)
+		partition := generator.GetPartition("counter")
+		partition.Iteration = &general.ExpressionIteration{
+			Fields:  []general.ExpressionField{{Name: "x"}},
+			Outputs: []string{"x + rate[1]"},
+		}
+		generator.ResetPartition("counter", partition)
+		client := dialLiveRun(t, generator, false)
+		client.connection.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, _, err := client.connection.ReadMessage()
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) ||
+			closeErr.Code != websocket.CloseInternalServerErr ||
+			!strings.Contains(closeErr.Text, "counter") {
+			t.Errorf("expected a close frame naming the partition, got %v", err)
+		}
+	})
+
+	t.Run("cancelling the request context ends the run", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		server := httptest.NewUnstartedServer(
+			NewLiveRunHandler(liveRunGenerator(10), 0, true),
+		)
+		server.Config.BaseContext = func(net.Listener) context.Context { return ctx }
+		server.Start()
+		t.Cleanup(server.Close)
+		url := "ws" + strings.TrimPrefix(server.URL, "http")
+		connection, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer connection.Close()
+		client := &liveRunClient{t: t, connection: connection}
+		client.receive()
+
+		cancel()
+		connection.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, _, err = connection.ReadMessage()
+		var netErr net.Error
+		if err == nil || errors.As(err, &netErr) && netErr.Timeout() {
+			t.Errorf("expected the server to close the connection, got %v", err)
+		}
+	})
+
+	t.Run("PAUSE interrupts the step delay and RESUME runs to the end", func(t *testing.T) {
+		client := dialLiveRun(t, liveRunGenerator(6), true)
+		client.send(&simulator.ControlMessage{
+			Command:               simulator.ControlCommand_CONTROL_COMMAND_SET_STEP_DELAY,
+			StepDelayMilliseconds: 60_000,
+		})
+		client.send(&simulator.ControlMessage{
+			Command: simulator.ControlCommand_CONTROL_COMMAND_RESUME,
+		})
+		client.send(&simulator.ControlMessage{
+			Command: simulator.ControlCommand_CONTROL_COMMAND_PAUSE,
+		})
+		client.send(&simulator.ControlMessage{
+			Command:   simulator.ControlCommand_CONTROL_COMMAND_SNAPSHOT,
+			RequestId: 7,
+		})
+		// the pause lands either before the first step or during the long
+		// delay after it, so at most one live frame precedes the snapshot
+		live := 0
+		state := client.receive()
+		for state.SnapshotId == 0 {
+			live++
+			state = client.receive()
+		}
+		if live > 1 || state.CumulativeTimesteps != float64(live) {
+			t.Fatalf("%d live frames then snapshot %+v; the pause did not hold",
+				live, state)
+		}
+		for i := 1; i < int(state.SnapshotSize); i++ {
+			client.receive()
+		}
+
+		client.send(&simulator.ControlMessage{
+			Command:               simulator.ControlCommand_CONTROL_COMMAND_SET_STEP_DELAY,
+			StepDelayMilliseconds: 0,
+		})
+		client.send(&simulator.ControlMessage{
+			Command: simulator.ControlCommand_CONTROL_COMMAND_RESUME,
+		})
+		for want := float64(live + 1); want <= 6.0; want++ {
+			if state := client.receive(); state.CumulativeTimesteps != want {
+				t.Fatalf("expected time %v, got %+v", want, state)
+			}
+		}
+		// the handler closes the connection once the run terminates
+		client.connection.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, _, err := client.connection.ReadMessage(); err == nil {
+			t.Error("expected the connection to close after termination")
+		}
+	})
+}
@@ -78,6 +78,13 @@
 // runtime "all goroutines are asleep" with no indication of which partitions are at fault;
 // the check names them and says how to break the cycle. It runs no simulation. See pkg/graph.
 //
+// # Serving
+//
+// JobServer (`stochadex serve`) accepts configs over HTTP, loads each through the same
+// LoadApiRunConfigFromYaml path as the CLI, and queues it to run in-process. Jobs persist to
+// a directory so a restarted server keeps them. RegisterResultFormat lets a layer above add
+// a result encoding, as cmd/stochadex does for Arrow.
+//
 // # Scope
 //
 // Inference as forward simulation — a posterior stepped as a partition — is in scope, which
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -46,7 +47,7 @@ run:
 	config := LoadApiRunConfigFromYaml(path)
 	// Use the config's own resolved (data-spec) simulation, so members run the full
 	// horizon — not a stand-in with a different step count.
-	runs, err := ensembleRuns(config, &config.Main.Simulation)
+	runs, err := ensembleRuns(context.Background(), config, &config.Main.Simulation)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/umbralcalc/stochadex/pkg/general"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// checkExpressions statically checks every expression iteration in the run against the widths
+// its config fixes, and reports every problem in one error rather than the first one a run
+// would reach.
+//
+// Without it a width mismatch, a misspelt name or an un-annotated scalar draw is a panic on
+// the first step that evaluates it, which for a rarely taken branch, or a partition deep in an
+// embedded run, can be a long way into a simulation. The widths are all there at load time —
+// init_state_values, params, params_from_upstream and the upstream partitions — so the errors
+// can be too.
+func (r *RunConfig) checkExpressions() error {
+	byName, partitions := r.partitionShapes()
+	var problems []string
+	check := func(partition *simulator.PartitionConfig, e *general.ExpressionIteration) {
+		for _, issue := range e.Check(expressionShapes(partition, byName, partitions)) {
+			problems = append(problems,
+				fmt.Sprintf("partition %q, %s", partition.Name, issue.String()))
+		}
+	}
+	// An expressions entry replaces whatever iteration its partition names, so that partition's
+	// own iteration is never built and there is nothing of it to check.
+	replaced := make(map[string]bool, len(r.Expressions))
+	for i := range r.Expressions {
+		expression := &r.Expressions[i]
+		partition, ok := byName[expression.Partition]
+		if !ok {
+			// Building the generator reports this, with the run's other config errors.
+			continue
+		}
+		replaced[partition.Name] = true
+		check(partition, &expression.ExpressionIteration)
+	}
+	for i := range r.Partitions {
+		partition := &r.Partitions[i]
+		if replaced[partition.Name] {
+			continue
+		}
+		switch e := partition.Iteration.(type) {
+		case *general.ExpressionIteration:
+			check(partition, e)
+		case *general.ExpressionGradientIteration:
+			for _, issue := range e.Check(expressionShapes(partition, byName, partitions)) {
+				problems = append(problems,
+					fmt.Sprintf("partition %q, %s", partition.Name, issue.String()))
+			}
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("api: %d problems in expressions:\n%s",
+		len(problems), strings.Join(problems, "\n"))
+}
+
+// partitionShapes indexes the run's partitions by name, with the widths of their states.
+func (r *RunConfig) partitionShapes() (
+	map[string]*simulator.PartitionConfig,
+	map[string]general.ExpressionPartitionShape,
+) {
+	byName := make(map[string]*simulator.PartitionConfig, len(r.Partitions))
+	partitions := make(map[string]general.ExpressionPartitionShape, len(r.Partitions))
+	for i := range r.Partitions {
+		partition := &r.Partitions[i]
+		byName[partition.Name] = partition
+		partitions[partition.Name] = general.ExpressionPartitionShape{
+			StateWidth:        len(partition.InitStateValues),
+			StateHistoryDepth: partition.StateHistoryDepth,
+		}
+	}
+	return byName, partitions
+}
+
+// expressionShapes gives the widths an expression in partition will see.
+func expressionShapes(
+	partition *simulator.PartitionConfig,
+	byName map[string]*simulator.PartitionConfig,
+	partitions map[string]general.ExpressionPartitionShape,
+) general.ExpressionShapes {
+	params := make(map[string]int, len(partition.Params.Map))
+	for name, values := range partition.Params.Map {
+		params[name] = len(values)
+	}
+	for name, names := range partition.ParamsAsPartitions {
+		params[name] = len(names)
+	}
+	for name, upstream := range partition.ParamsFromUpstream {
+		switch source, ok := byName[upstream.Upstream]; {
+		case len(upstream.Indices) > 0:
+			params[name] = len(upstream.Indices)
+		case ok:
+			params[name] = len(source.InitStateValues)
+		default:
+			params[name] = -1
+		}
+	}
+	return general.ExpressionShapes{
+		StateWidth:        len(partition.InitStateValues),
+		StateHistoryDepth: partition.StateHistoryDepth,
+		Params:            params,
+		Partitions:        partitions,
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/general"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+func TestCheckExpressionsReportsEveryPartitionAtOnce(t *testing.T) {
+	newPartition := func(name string, width int) simulator.PartitionConfig {
+		p := simulator.PartitionConfig{
+			Name: name,
+			Params: simulator.NewParams(map[string][]float64{
+				"rates": {1, 2, 3, 4},
+			}),
+			ParamsFromUpstream: map[string]simulator.NamedUpstreamConfig{
+				"pair": {Upstream: "source", Indices: []int{0, 1}},
+			},
+			InitStateValues:   make([]float64, width),
+			StateHistoryDepth: 2,
+		}
+		p.Init()
+		return p
+	}
+	config := &RunConfig{
+		Partitions: []simulator.PartitionConfig{
+			newPartition("source", 3),
+			newPartition("first", 3),
+			newPartition("second", 1),
+		},
+		Expressions: []ExpressionConfig{
+			{Partition: "first", ExpressionIteration: general.ExpressionIteration{
+				Fields:  []general.ExpressionField{{Name: "x", Width: 3}},
+				Outputs: []string{"x + rates"},
+			}},
+			{Partition: "second", ExpressionIteration: general.ExpressionIteration{
+				Fields:    []general.ExpressionField{{Name: "y"}},
+				Upstreams: map[string]string{"s": "source"},
+				Outputs:   []string{"sum(s * pair) + lag(y, 2)"},
+			}},
+		},
+	}
+	err := config.checkExpressions()
+	if err == nil {
+		t.Fatal("expected the check to fail")
+	}
+	for _, want := range []string{
+		"api: 3 problems in expressions:",
+		`partition "first", output for field x: cannot combine widths 3 and 4 in +`,
+		// pair is params_from_upstream with two indices, so its width is 2.
+		`partition "second", output for field y: cannot combine widths 3 and 2 in *`,
+		`partition "second", output for field y: lag(y, 2) is outside the 2 rows y keeps`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error\n%v\ndoes not contain %q", err, want)
+		}
+	}
+}
+
+func TestLoadRejectsAnExpressionThatCannotRun(t *testing.T) {
+	defer func() {
+		message := stringify(recover())
+		if !strings.Contains(message, "cannot combine widths 2 and 3 in *") {
+			t.Errorf("got %q, want the load to report the width mismatch", message)
+		}
+	}()
+	writeConfig(t, `
+main:
+  partitions:
+  - name: walk
+    params:
+      scale: [1.0, 2.0]
+    init_state_values: [0.0, 0.0, 0.0]
+    state_history_depth: 1
+    seed: 1
+  expressions:
+  - partition: walk
+    fields:
+    - {name: x, width: 3}
+    outputs:
+    - x + scale * iid(3, normal(0, 1))
+`)
+}
+
+func TestLoadRejectsAGradientThatCannotRun(t *testing.T) {
+	for _, c := range []struct {
+		name, expr, wrt, want string
+	}{
+		{"an unknown function", "tanh(theta[0])", "theta", "unknown function tanh"},
+		{"an unknown name", "theta[0] + y", "theta", "unknown name y"},
+		{"an unknown input", "theta[0] * theta[0]", "phi", "with_respect_to: unknown name phi"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			defer func() {
+				if message := stringify(recover()); !strings.Contains(message, c.want) {
+					t.Errorf("got %q, want the load to report %q", message, c.want)
+				}
+			}()
+			writeConfig(t, `
+main:
+  partitions:
+  - name: gradient
+    iteration:
+      type: expression_gradient
+      expr: "`+c.expr+`"
+      with_respect_to: [`+c.wrt+`]
+    params:
+      theta: [1.0]
+    init_state_values: [0.0]
+    state_history_depth: 1
+    seed: 1
+`)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/umbralcalc/stochadex/pkg/general"
+)
+
+// FunctionLibrary is the contents of a file a run's function_imports names: expression
+// functions shared across configs, such as the link functions several models use.
+//
+//	functions:
+//	  - name: logistic
+//	    params: [z]
+//	    expr: "1 / (1 + exp(-z))"
+type FunctionLibrary struct {
+	Functions []general.ExpressionFunction `yaml:"functions"`
+}
+
+// LoadFunctionLibrary reads a FunctionLibrary from a YAML file, rejecting keys it does not
+// know so that a misspelt params or expr is not silently dropped.
+func LoadFunctionLibrary(path string) (*FunctionLibrary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var library FunctionLibrary
+	if err := yaml.UnmarshalStrict(data, &library); err != nil {
+		return nil, fmt.Errorf("function library %s: %w", path, err)
+	}
+	return &library, nil
+}
+
+// importFunctions loads the run's function_imports. A name two imports both define is an
+// error, because which one a call means would depend on the order the files are listed in;
+// the run's own functions block is what to use to choose between them.
+func (r *RunConfig) importFunctions() error {
+	r.imported = nil
+	from := make(map[string]string)
+	for _, path := range r.FunctionImports {
+		library, err := LoadFunctionLibrary(path)
+		if err != nil {
+			return err
+		}
+		for _, f := range library.Functions {
+			if other, ok := from[f.Name]; ok && other != path {
+				return fmt.Errorf("function %s is defined by both %s and %s", f.Name, other, path)
+			}
+			from[f.Name] = path
+		}
+		r.imported = append(r.imported, library.Functions...)
+	}
+	return nil
+}
+
+// useFunctions makes the run's functions, and those it imports, callable from every expression
+// iteration in the run. The run's own functions take precedence over imported ones of the same
+// name, and a partition's own over both.
+func (r *RunConfig) useFunctions() {
+	library := make([]general.ExpressionFunction, 0, len(r.imported)+len(r.Functions))
+	own := make(map[string]bool, len(r.Functions))
+	for _, f := range r.Functions {
+		own[f.Name] = true
+	}
+	for _, f := range r.imported {
+		if !own[f.Name] {
+			library = append(library, f)
+		}
+	}
+	library = append(library, r.Functions...)
+	for i := range r.Expressions {
+		r.Expressions[i].UseFunctions(library)
+	}
+	for i := range r.Partitions {
+		if e, ok := r.Partitions[i].Iteration.(*general.ExpressionIteration); ok {
+			e.UseFunctions(library)
+		}
+	}
+}
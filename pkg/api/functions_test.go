@@ -0,0 +1,151 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/general"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// writeLibrary writes a function library to a temp file and returns its path.
+func writeLibrary(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "functions.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("writing temp library: %v", err)
+	}
+	return path
+}
+
+// runSteps runs the loaded config's main run for steps steps and returns partition's states.
+func runSteps(config *ApiRunConfig, partition string, steps int) [][]float64 {
+	store := simulator.NewStateTimeStorage()
+	config.Main.Simulation = simulator.SimulationConfig{
+		OutputCondition: &simulator.EveryStepOutputCondition{},
+		OutputFunction:  &simulator.StateTimeStorageOutputFunction{Store: store},
+		TerminationCondition: &simulator.NumberOfStepsTerminationCondition{
+			MaxNumberOfSteps: steps,
+		},
+		TimestepFunction: &simulator.ConstantTimestepFunction{Stepsize: 1.0},
+	}
+	simulator.NewPartitionCoordinator(config.GetConfigGenerator().GenerateConfigs()).Run()
+	return store.GetValues(partition)
+}
+
+func TestRunLevelAndImportedFunctions(t *testing.T) {
+	library := writeLibrary(t, `
+functions:
+- name: half
+  params: [v]
+  expr: "v / 2"
+- name: step_up
+  params: [v]
+  expr: "v + 100"
+`)
+	config := writeConfig(t, `
+main:
+  function_imports: [`+library+`]
+  functions:
+  # Takes precedence over the import of the same name.
+  - name: step_up
+    params: [v]
+    expr: "v + 1"
+  partitions:
+  - name: walk
+    init_state_values: [8.0, 0.0]
+    state_history_depth: 1
+    seed: 1
+  expressions:
+  - partition: walk
+    functions:
+    - name: twice_up
+      params: [v]
+      expr: "step_up(step_up(v))"
+    fields:
+    - name: x
+    - name: y
+    outputs:
+    - "half(x)"
+    - "twice_up(y)"
+`)
+	got := runSteps(config, "walk", 2)
+	want := [][]float64{{8, 0}, {4, 2}, {2, 4}}
+	for i := range want {
+		if got[i][0] != want[i][0] || got[i][1] != want[i][1] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestFunctionImportsOfAGoBuiltConfig(t *testing.T) {
+	partition := simulator.PartitionConfig{
+		Name:              "walk",
+		InitStateValues:   []float64{8.0},
+		StateHistoryDepth: 1,
+		Seed:              1,
+	}
+	config := &ApiRunConfig{Main: RunConfig{
+		Partitions: []simulator.PartitionConfig{partition},
+		Expressions: []ExpressionConfig{{
+			Partition: "walk",
+			ExpressionIteration: general.ExpressionIteration{
+				Fields:  []general.ExpressionField{{Name: "x"}},
+				Outputs: []string{"half(x)"},
+			},
+		}},
+		FunctionImports: []string{writeLibrary(t,
+			"functions:\n- {name: half, params: [v], expr: v / 2}\n")},
+	}}
+	got := runSteps(config, "walk", 2)
+	if want := []float64{8, 4, 2}; got[0][0] != want[0] ||
+		got[1][0] != want[1] || got[2][0] != want[2] {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestFunctionImportErrors(t *testing.T) {
+	config := func(imports ...string) string {
+		return `
+main:
+  function_imports: [` + strings.Join(imports, ", ") + `]
+  partitions:
+  - name: walk
+    init_state_values: [0.0]
+    state_history_depth: 1
+    seed: 1
+  expressions:
+  - partition: walk
+    fields:
+    - name: x
+    outputs:
+    - "half(x)"
+`
+	}
+	half := "functions:\n- {name: half, params: [v], expr: v / 2}\n"
+	for _, c := range []struct {
+		name    string
+		imports []string
+		want    string
+	}{
+		{"a file that is missing", []string{"/nonexistent/functions.yaml"}, "no such file"},
+		{"a misspelt key", []string{writeLibrary(t,
+			"functions:\n- {name: half, parms: [v], expr: v / 2}\n")}, "field parms not found"},
+		{"a name two imports define", []string{writeLibrary(t, half), writeLibrary(t, half)},
+			"function half is defined by both"},
+		{"an import whose body cannot run", []string{writeLibrary(t,
+			"functions:\n- {name: half, params: [v], expr: v / two}\n")},
+			"function half: function half has no parameter two"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			defer func() {
+				if got := stringify(recover()); !strings.Contains(got, c.want) {
+					t.Errorf("got %q, want it to contain %q", got, c.want)
+				}
+			}()
+			writeConfig(t, config(c.imports...))
+		})
+	}
+}
@@ -0,0 +1,689 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/umbralcalc/stochadex/pkg/analysis"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+	"gopkg.in/yaml.v2"
+)
+
+// JobStatus is where a job submitted to a JobServer is in its lifecycle.
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+// finished reports whether the status is terminal.
+func (s JobStatus) finished() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCancelled
+}
+
+// Job is the persisted record of one submitted run, and the JSON body the job
+// server returns for it. Step and Time report progress: the number of steps
+// completed and the cumulative simulation time reached. A macros: config has
+// no step loop of its own to observe, so its progress stays at zero until it
+// finishes.
+type Job struct {
+	Id          string     `json:"id"`
+	Status      JobStatus  `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	Step        int        `json:"step"`
+	Time        float64    `json:"time"`
+	SubmittedAt time.Time  `json:"submitted_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// JobResults is the JSON form of a succeeded job's output: the time axis and
+// each partition's recorded rows, index-aligned to it.
+type JobResults struct {
+	Times      []float64              `json:"times"`
+	Partitions map[string][][]float64 `json:"partitions"`
+}
+
+// resultFormat encodes a finished job's storage for the results endpoint.
+type resultFormat struct {
+	contentType string
+	write       func(storage *simulator.StateTimeStorage, w io.Writer) error
+}
+
+// resultFormats holds the encodings the results endpoint can serve, keyed by
+// the name selecting them (?format=<name>). JSON is built in; the distributed
+// CLI registers Arrow.
+var resultFormats = map[string]resultFormat{
+	"json": {contentType: "application/json", write: writeJsonResults},
+}
+
+// RegisterResultFormat adds an encoding for job results that this package
+// cannot depend on directly. It mirrors RegisterDataSource: the distributed
+// CLI contributes the Arrow encoding, whose dependency it alone carries.
+func RegisterResultFormat(
+	name string,
+	contentType string,
+	write func(storage *simulator.StateTimeStorage, w io.Writer) error,
+) {
+	if _, exists := resultFormats[name]; exists {
+		panic("api: duplicate result format registration " + name)
+	}
+	resultFormats[name] = resultFormat{contentType: contentType, write: write}
+}
+
+// writeJsonResults encodes storage as a JobResults document.
+func writeJsonResults(storage *simulator.StateTimeStorage, w io.Writer) error {
+	results := JobResults{
+		Times:      storage.GetTimes(),
+		Partitions: make(map[string][][]float64),
+	}
+	for _, name := range storage.GetNames() {
+		results.Partitions[name] = storage.GetValues(name)
+	}
+	return json.NewEncoder(w).Encode(results)
+}
+
+// maxJobConfigBytes bounds the size of a submitted config.
+const maxJobConfigBytes = 16 << 20
+
+var (
+	errJobNotFound = errors.New("api: no job with that id")
+	errJobFinished = errors.New("api: job has already finished")
+)
+
+// JobServer queues and runs ApiRunConfig documents submitted over HTTP — the
+// server behind `stochadex serve`.
+//
+// Every job lives in its own subdirectory of the server's directory, holding
+// the submitted config (config.yaml), its status record (job.json) and, once
+// it succeeds, its output as a JSON log (results.jsonl). A new server opened
+// on the same directory therefore picks up where the last one stopped:
+// finished jobs keep their status and results, and jobs that were queued or
+// running are queued again and run from the start.
+//
+// Endpoints:
+//
+//	POST /jobs               submit a config (YAML or JSON body); 202 with the job
+//	GET  /jobs               list every job in submission order
+//	GET  /jobs/{id}          one job's status and progress
+//	POST /jobs/{id}/cancel   cancel a queued or running job
+//	GET  /jobs/{id}/results  a succeeded job's output; ?format=json (default) or
+//	                         any format added with RegisterResultFormat
+//
+// Usage hints:
+//   - A submission is loaded with LoadApiRunConfigFromYaml and pre-flighted with
+//     CheckForDeadlock before it is accepted, so a config that would fail to load
+//     is rejected with a 400 and never queued. JSON is accepted because it is
+//     also YAML.
+//   - Batch and macros: configs are supported; ensemble mode is rejected.
+//   - The config's output_function is replaced: a job's output is recorded by the
+//     server and returned from the results endpoint.
+//   - Relative paths in a config (a data: source file, say) resolve against the
+//     server's working directory.
+type JobServer struct {
+	directory   string
+	concurrency int
+	mutex       sync.Mutex
+	jobs        map[string]*Job
+	order       []string
+	queue       []string
+	running     int
+	cancels     map[string]context.CancelFunc
+	nextId      int
+	closed      bool
+	workers     sync.WaitGroup
+	// allowExternalProcess lets jobs run external_process iterations, which run
+	// any command as the server's user.
+	allowExternalProcess bool
+}
+
+// NewJobServer opens a job server on directory, creating it if needed and
+// reloading any jobs persisted there. At most concurrency jobs run at once;
+// <= 0 defaults to GOMAXPROCS. Unless allowExternalProcess is set, a config
+// using an external_process iteration is refused, since it would let anyone who
+// can reach the server run any command as its user.
+func NewJobServer(
+	directory string,
+	concurrency int,
+	allowExternalProcess bool,
+) (*JobServer, error) {
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return nil, fmt.Errorf("api: creating job directory: %w", err)
+	}
+	s := &JobServer{
+		directory:   directory,
+		concurrency: concurrency,
+		jobs:        make(map[string]*Job),
+		cancels:     make(map[string]context.CancelFunc),
+
+		allowExternalProcess: allowExternalProcess,
+	}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	s.dispatch()
+	s.mutex.Unlock()
+	return s, nil
+}
+
+// reload reads the jobs persisted in the server's directory, queueing again
+// any that had not finished.
+func (s *JobServer) reload() error {
+	entries, err := os.ReadDir(s.directory)
+	if err != nil {
+		return fmt.Errorf("api: reading job directory: %w", err)
+	}
+	for _, entry := range entries {
+		number, err := strconv.Atoi(entry.Name())
+		if !entry.IsDir() || err != nil {
+			continue
+		}
+		s.nextId = max(s.nextId, number+1)
+		data, err := os.ReadFile(s.jobPath(entry.Name(), "job.json"))
+		if errors.Is(err, os.ErrNotExist) {
+			// a submission interrupted before it was accepted
+			continue
+		} else if err != nil {
+			return fmt.Errorf("api: reading job %s: %w", entry.Name(), err)
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return fmt.Errorf("api: decoding job %s: %w", entry.Name(), err)
+		}
+		if !job.Status.finished() {
+			job.Status = JobQueued
+			job.Step, job.Time, job.StartedAt = 0, 0.0, nil
+			s.queue = append(s.queue, job.Id)
+			if err := s.persist(&job); err != nil {
+				return err
+			}
+		}
+		s.jobs[job.Id] = &job
+		s.order = append(s.order, job.Id)
+	}
+	// directory listings are name-sorted, which is submission order
+	return nil
+}
+
+// Close stops the server's running jobs and waits for them to return. They
+// are left recorded as running, so a server reopened on the same directory
+// runs them again.
+func (s *JobServer) Close() {
+	s.mutex.Lock()
+	s.closed = true
+	for _, cancel := range s.cancels {
+		cancel()
+	}
+	s.mutex.Unlock()
+	s.workers.Wait()
+}
+
+// Submit validates config and queues it as a new job.
+func (s *JobServer) Submit(config []byte) (*Job, error) {
+	s.mutex.Lock()
+	id := fmt.Sprintf("%06d", s.nextId)
+	s.nextId++
+	s.mutex.Unlock()
+
+	if err := os.MkdirAll(s.jobPath(id), 0o755); err != nil {
+		return nil, fmt.Errorf("api: creating job directory: %w", err)
+	}
+	configPath := s.jobPath(id, "config.yaml")
+	if err := os.WriteFile(configPath, config, 0o644); err != nil {
+		return nil, fmt.Errorf("api: writing job config: %w", err)
+	}
+	if _, err := s.loadJobConfig(configPath); err != nil {
+		os.RemoveAll(s.jobPath(id))
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	job := &Job{Id: id, Status: JobQueued, SubmittedAt: time.Now().UTC()}
+	if err := s.persist(job); err != nil {
+		os.RemoveAll(s.jobPath(id))
+		return nil, err
+	}
+	s.jobs[id] = job
+	s.order = append(s.order, id)
+	s.queue = append(s.queue, id)
+	s.dispatch()
+	copied := *job
+	return &copied, nil
+}
+
+// Get returns a snapshot of the job with the given id.
+func (s *JobServer) Get(id string) (*Job, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, errJobNotFound
+	}
+	copied := *job
+	return &copied, nil
+}
+
+// List returns snapshots of every job in submission order.
+func (s *JobServer) List() []*Job {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	jobs := make([]*Job, len(s.order))
+	for i, id := range s.order {
+		copied := *s.jobs[id]
+		jobs[i] = &copied
+	}
+	return jobs
+}
+
+// Cancel cancels a queued or running job. A queued job is cancelled at once;
+// a running one stops at its next step boundary.
+func (s *JobServer) Cancel(id string) (*Job, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, errJobNotFound
+	}
+	switch job.Status {
+	case JobQueued:
+		for i, queued := range s.queue {
+			if queued == id {
+				s.queue = append(s.queue[:i], s.queue[i+1:]...)
+				break
+			}
+		}
+		s.finish(job, JobCancelled, nil)
+	case JobRunning:
+		s.cancels[id]()
+	default:
+		return nil, errJobFinished
+	}
+	copied := *job
+	return &copied, nil
+}
+
+// Results loads a succeeded job's recorded output.
+func (s *JobServer) Results(id string) (*simulator.StateTimeStorage, error) {
+	job, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != JobSucceeded {
+		return nil, fmt.Errorf("api: job %s has no results: it is %s", id, job.Status)
+	}
+	return analysis.NewStateTimeStorageFromJsonLogEntries(
+		s.jobPath(id, "results.jsonl"),
+	)
+}
+
+// dispatch starts queued jobs while there is capacity. The caller holds the
+// mutex.
+func (s *JobServer) dispatch() {
+	for !s.closed && s.running < s.concurrency && len(s.queue) > 0 {
+		id := s.queue[0]
+		s.queue = s.queue[1:]
+		job := s.jobs[id]
+		started := time.Now().UTC()
+		job.Status, job.StartedAt = JobRunning, &started
+		if err := s.persist(job); err != nil {
+			log.Println("Error persisting job:", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		s.cancels[id] = cancel
+		s.running++
+		s.workers.Add(1)
+		go s.run(ctx, id)
+	}
+}
+
+// run executes one job and records how it ended.
+func (s *JobServer) run(ctx context.Context, id string) {
+	defer s.workers.Done()
+	storage, err := s.execute(ctx, id)
+	if err == nil && ctx.Err() == nil {
+		err = writeJobResults(s.jobPath(id, "results.jsonl"), storage)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	cancelled := ctx.Err() != nil
+	s.cancels[id]()
+	delete(s.cancels, id)
+	s.running--
+	if s.closed {
+		return
+	}
+	switch {
+	case cancelled:
+		s.finish(s.jobs[id], JobCancelled, nil)
+	case err != nil:
+		s.finish(s.jobs[id], JobFailed, err)
+	default:
+		s.finish(s.jobs[id], JobSucceeded, nil)
+	}
+	s.dispatch()
+}
+
+// execute loads a job's config and runs it to termination, recording its
+// output and reporting progress after every step. It stops at a step boundary
+// when ctx is cancelled. Config errors, which this package reports by
+// panicking, are returned as the job's error.
+func (s *JobServer) execute(
+	ctx context.Context,
+	id string,
+) (storage *simulator.StateTimeStorage, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			storage, err = nil, recoveredError("", r)
+		}
+	}()
+	config, err := s.loadJobConfig(s.jobPath(id, "config.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Macros) > 0 {
+		return RunMacrosContext(ctx, config)
+	}
+	generator := config.GetConfigGenerator()
+	storage = simulator.NewStateTimeStorage()
+	simulation := generator.GetSimulation()
+	simulation.OutputFunction = &simulator.StateTimeStorageOutputFunction{Store: storage}
+	generator.SetSimulation(simulation)
+	coordinator := simulator.NewPartitionCoordinator(generator.GenerateConfigs())
+	defer coordinator.Close()
+	stepper := coordinator.NewStepper()
+	defer stepper.Close()
+	for !coordinator.ReadyToTerminate() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		stepper.Step()
+		s.progress(id, coordinator.Shared.TimestepsHistory)
+	}
+	return storage, nil
+}
+
+// progress records the step and time a running job has reached. It is kept
+// in memory only: a job that is interrupted restarts from the beginning.
+func (s *JobServer) progress(id string, timesteps *simulator.CumulativeTimestepsHistory) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	job := s.jobs[id]
+	job.Step = timesteps.CurrentStepNumber
+	job.Time = timesteps.Values.AtVec(0)
+}
+
+// finish moves a job to a terminal status and persists it. The caller holds
+// the mutex.
+func (s *JobServer) finish(job *Job, status JobStatus, err error) {
+	finished := time.Now().UTC()
+	job.Status, job.FinishedAt = status, &finished
+	if err != nil {
+		job.Error = err.Error()
+	}
+	if persistErr := s.persist(job); persistErr != nil {
+		log.Println("Error persisting job:", persistErr)
+	}
+}
+
+// persist writes a job's status record, replacing the previous one
+// atomically so a crash never leaves a truncated record behind.
+func (s *JobServer) persist(job *Job) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return fmt.Errorf("api: encoding job %s: %w", job.Id, err)
+	}
+	path := s.jobPath(job.Id, "job.json")
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return fmt.Errorf("api: writing job %s: %w", job.Id, err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("api: writing job %s: %w", job.Id, err)
+	}
+	return nil
+}
+
+// jobPath joins elements onto a job's directory.
+func (s *JobServer) jobPath(id string, elements ...string) string {
+	return filepath.Join(append([]string{s.directory, id}, elements...)...)
+}
+
+// loadJobConfig loads a submitted config through the same path as the CLI and
+// checks the server can run it, returning the panics the load path raises on a
+// bad config as errors.
+func (s *JobServer) loadJobConfig(path string) (config *ApiRunConfig, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			config, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	if !s.allowExternalProcess {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("api: reading job config: %w", err)
+		}
+		var tree any
+		if err := yaml.Unmarshal(data, &tree); err != nil {
+			return nil, fmt.Errorf("api: parsing job config: %w", err)
+		}
+		if namesComponent(tree, "external_process") {
+			return nil, fmt.Errorf("api: this server does not run external_process " +
+				"iterations, which run any command as its user; start it with " +
+				"--allow-external-process to allow them")
+		}
+	}
+	config = LoadApiRunConfigFromYaml(path)
+	switch config.Run.Mode {
+	case "", "batch":
+	default:
+		return nil, fmt.Errorf(
+			"api: the job server runs batch and macros configs, not run mode %q",
+			config.Run.Mode,
+		)
+	}
+	if len(config.Macros) == 0 {
+		if err := CheckForDeadlock(config.GetConfigGenerator()); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// namesComponent reports whether a parsed YAML tree has a {type: name} mapping
+// anywhere in it, however deeply nested in embedded runs, macros or data blocks.
+func namesComponent(tree any, name string) bool {
+	switch node := tree.(type) {
+	case map[any]any:
+		if node["type"] == name {
+			return true
+		}
+		for _, value := range node {
+			if namesComponent(value, name) {
+				return true
+			}
+		}
+	case []any:
+		for _, value := range node {
+			if namesComponent(value, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeJobResults persists storage as a JSON log, one entry per partition per
+// recorded time, in time order — the format the json_log data source reads.
+func writeJobResults(path string, storage *simulator.StateTimeStorage) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("api: writing results: %w", err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	names := storage.GetNames()
+	values := make([][][]float64, len(names))
+	for i, name := range names {
+		values[i] = storage.GetValues(name)
+	}
+	for step, time := range storage.GetTimes() {
+		for i, name := range names {
+			if step >= len(values[i]) {
+				continue
+			}
+			if err := encoder.Encode(simulator.JsonLogEntry{
+				PartitionName:       name,
+				State:               values[i][step],
+				CumulativeTimesteps: time,
+			}); err != nil {
+				return fmt.Errorf("api: writing results: %w", err)
+			}
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("api: writing results: %w", err)
+	}
+	return file.Close()
+}
+
+// Handler returns the server's HTTP API.
+func (s *JobServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", s.handleSubmit)
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, http.StatusOK, s.List())
+	})
+	mux.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, err := s.Get(r.PathValue("id"))
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		writeJson(w, http.StatusOK, job)
+	})
+	mux.HandleFunc("POST /jobs/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		job, err := s.Cancel(r.PathValue("id"))
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		writeJson(w, http.StatusAccepted, job)
+	})
+	mux.HandleFunc("GET /jobs/{id}/results", s.handleResults)
+	return mux
+}
+
+func (s *JobServer) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	config, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxJobConfigBytes))
+	if err != nil {
+		writeJson(w, http.StatusRequestEntityTooLarge, jobError{err.Error()})
+		return
+	}
+	job, err := s.Submit(config)
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, jobError{err.Error()})
+		return
+	}
+	writeJson(w, http.StatusAccepted, job)
+}
+
+func (s *JobServer) handleResults(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("format")
+	if name == "" {
+		name = "json"
+	}
+	format, ok := resultFormats[name]
+	if !ok {
+		available := make([]string, 0, len(resultFormats))
+		for registered := range resultFormats {
+			available = append(available, registered)
+		}
+		sort.Strings(available)
+		writeJson(w, http.StatusBadRequest, jobError{fmt.Sprintf(
+			"api: unknown result format %q; this binary supports: %s",
+			name, strings.Join(available, ", "))})
+		return
+	}
+	id := r.PathValue("id")
+	job, err := s.Get(id)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	if job.Status != JobSucceeded {
+		writeJson(w, http.StatusConflict, jobError{fmt.Sprintf(
+			"api: job %s has no results: it is %s", id, job.Status)})
+		return
+	}
+	storage, err := s.Results(id)
+	if err != nil {
+		writeJson(w, http.StatusInternalServerError, jobError{err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", format.contentType)
+	if err := format.write(storage, w); err != nil {
+		log.Println("Error writing job results:", err)
+	}
+}
+
+// jobError is the JSON body of an error response.
+type jobError struct {
+	Error string `json:"error"`
+}
+
+// writeJobError maps a job lookup or cancellation error to its status code.
+func writeJobError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errJobNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errJobFinished):
+		status = http.StatusConflict
+	}
+	writeJson(w, status, jobError{err.Error()})
+}
+
+func writeJson(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Println("Error writing response:", err)
+	}
+}
+
+// ServeJobsWithParsedArgs runs a JobServer on the parsed address until the
+// process exits — `stochadex serve`.
+func ServeJobsWithParsedArgs(args ServeArgs) {
+	LogRunProvenance(os.Stderr)
+	server, err := NewJobServer(
+		args.JobsDirectory, args.Concurrency, args.AllowExternalProcess)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Serving jobs from %s on %s\n", args.JobsDirectory, args.Address)
+	log.Fatal(http.ListenAndServe(args.Address, server.Handler()))
+}
@@ -0,0 +1,323 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// jobConfigYAML is a deterministic one-partition run whose state after step k
+// is 2k at time k, so results can be checked exactly.
+func jobConfigYAML(maxSteps int) string {
+	return fmt.Sprintf(`main:
+  partitions:
+  - name: walk
+    params: {drift: [2.0]}
+    init_state_values: [0.0]
+    state_history_depth: 1
+  expressions:
+  - partition: walk
+    fields: [{name: x}]
+    outputs: ["x + drift * dt"]
+  simulation:
+    output_condition: {type: every_step}
+    output_function: {type: stdout}
+    termination_condition: {type: number_of_steps, max_steps: %d}
+    timestep_function: {type: constant, stepsize: 1.0}
+    init_time_value: 0.0
+`, maxSteps)
+}
+
+// longJobConfigYAML runs for far longer than any test waits, so it is still
+// running (or queued) whenever a test looks at it.
+var longJobConfigYAML = jobConfigYAML(1_000_000_000)
+
+// jobClient drives a JobServer over HTTP.
+type jobClient struct {
+	t      *testing.T
+	server *JobServer
+	url    string
+}
+
+func newJobClient(t *testing.T, directory string, concurrency int) *jobClient {
+	t.Helper()
+	server, err := NewJobServer(directory, concurrency, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server.Handler())
+	t.Cleanup(func() {
+		httpServer.Close()
+		server.Close()
+	})
+	return &jobClient{t: t, server: server, url: httpServer.URL}
+}
+
+// do sends a request and decodes a JSON response body into out, returning
+// the status code.
+func (c *jobClient) do(method, path, body string, out any) int {
+	c.t.Helper()
+	request, err := http.NewRequest(method, c.url+path, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	return response.StatusCode
+}
+
+func (c *jobClient) submit(config string) *Job {
+	c.t.Helper()
+	var job Job
+	if status := c.do("POST", "/jobs", config, &job); status != http.StatusAccepted {
+		c.t.Fatalf("submission returned %d", status)
+	}
+	return &job
+}
+
+// await polls a job until its status satisfies done.
+func (c *jobClient) await(id string, done func(JobStatus) bool) *Job {
+	c.t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		var job Job
+		c.do("GET", "/jobs/"+id, "", &job)
+		if done(job.Status) {
+			return &job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.t.Fatalf("job %s did not reach the expected status in time", id)
+	return nil
+}
+
+func isFinished(status JobStatus) bool { return status.finished() }
+
+func isRunning(status JobStatus) bool { return status == JobRunning }
+
+func TestJobServer(t *testing.T) {
+	t.Run("a submitted job runs and returns its results", func(t *testing.T) {
+		client := newJobClient(t, t.TempDir(), 2)
+		job := client.submit(jobConfigYAML(5))
+		if job.Status != JobQueued && job.Status != JobRunning {
+			t.Fatalf("unexpected status on submission: %+v", job)
+		}
+		job = client.await(job.Id, isFinished)
+		if job.Status != JobSucceeded || job.Step != 5 || job.Time != 5.0 ||
+			job.StartedAt == nil || job.FinishedAt == nil {
+			t.Fatalf("unexpected finished job: %+v", job)
+		}
+		var results JobResults
+		if status := client.do(
+			"GET", "/jobs/"+job.Id+"/results", "", &results,
+		); status != http.StatusOK {
+			t.Fatalf("results returned %d", status)
+		}
+		// the initial state is recorded at construction, then every step
+		walk := results.Partitions["walk"]
+		if len(results.Times) != 6 || len(walk) != 6 {
+			t.Fatalf("unexpected results: %+v", results)
+		}
+		for step, row := range walk {
+			if results.Times[step] != float64(step) || row[0] != 2.0*float64(step) {
+				t.Errorf("step %d: time %v state %v", step, results.Times[step], row)
+			}
+		}
+	})
+
+	t.Run("JSON configs are accepted", func(t *testing.T) {
+		client := newJobClient(t, t.TempDir(), 1)
+		job := client.submit(`{"main": {
+			"partitions": [{"name": "walk", "params": {"drift": [1.0]},
+				"init_state_values": [0.0], "state_history_depth": 1}],
+			"expressions": [{"partition": "walk", "fields": [{"name": "x"}],
+				"outputs": ["x + drift * dt"]}],
+			"simulation": {
+				"output_condition": {"type": "every_step"},
+				"output_function": {"type": "nil"},
+				"termination_condition": {"type": "number_of_steps", "max_steps": 3},
+				"timestep_function": {"type": "constant", "stepsize": 0.5},
+				"init_time_value": 0.0}}}`)
+		if job = client.await(job.Id, isFinished); job.Status != JobSucceeded ||
+			job.Time != 1.5 {
+			t.Fatalf("unexpected finished job: %+v", job)
+		}
+	})
+
+	t.Run("an invalid config is rejected and never queued", func(t *testing.T) {
+		client := newJobClient(t, t.TempDir(), 1)
+		var body jobError
+		status := client.do("POST", "/jobs",
+			strings.Replace(jobConfigYAML(5), "every_step", "no_such_condition", 1),
+			&body)
+		if status != http.StatusBadRequest ||
+			!strings.Contains(body.Error, "no_such_condition") {
+			t.Fatalf("expected a 400 naming the bad component, got %d %+v",
+				status, body)
+		}
+		status = client.do("POST", "/jobs",
+			strings.Replace(jobConfigYAML(5), "main:", "run: {mode: ensemble, seeds: [1]}\nmain:", 1),
+			&body)
+		if status != http.StatusBadRequest || !strings.Contains(body.Error, "ensemble") {
+			t.Fatalf("expected ensemble mode to be rejected, got %d %+v", status, body)
+		}
+		if jobs := client.server.List(); len(jobs) != 0 {
+			t.Errorf("rejected configs were recorded: %+v", jobs)
+		}
+	})
+
+	t.Run("the concurrency limit queues jobs and both can be cancelled", func(t *testing.T) {
+		client := newJobClient(t, t.TempDir(), 1)
+		first := client.submit(longJobConfigYAML)
+		second := client.submit(jobConfigYAML(5))
+		client.await(first.Id, isRunning)
+		if job, _ := client.server.Get(second.Id); job.Status != JobQueued {
+			t.Fatalf("expected the second job to wait, got %+v", job)
+		}
+
+		var cancelled Job
+		client.do("POST", "/jobs/"+second.Id+"/cancel", "", &cancelled)
+		if cancelled.Status != JobCancelled {
+			t.Fatalf("expected a queued job to cancel at once, got %+v", cancelled)
+		}
+		// progress is visible while the job runs
+		running := client.await(first.Id, func(JobStatus) bool {
+			job, _ := client.server.Get(first.Id)
+			return job.Step > 0
+		})
+		if running.Status != JobRunning || running.Time != float64(running.Step) {
+			t.Fatalf("unexpected progress: %+v", running)
+		}
+		client.do("POST", "/jobs/"+first.Id+"/cancel", "", nil)
+		if job := client.await(first.Id, isFinished); job.Status != JobCancelled {
+			t.Fatalf("expected the running job to cancel, got %+v", job)
+		}
+
+		var body jobError
+		if status := client.do(
+			"POST", "/jobs/"+first.Id+"/cancel", "", &body,
+		); status != http.StatusConflict {
+			t.Errorf("cancelling a finished job returned %d %+v", status, body)
+		}
+		if status := client.do(
+			"GET", "/jobs/"+first.Id+"/results", "", &body,
+		); status != http.StatusConflict {
+			t.Errorf("results of a cancelled job returned %d %+v", status, body)
+		}
+		if status := client.do("GET", "/jobs/999999", "", &body); status != http.StatusNotFound {
+			t.Errorf("an unknown job returned %d %+v", status, body)
+		}
+	})
+
+	t.Run("external_process is refused unless the server allows it", func(t *testing.T) {
+		config := strings.Replace(jobConfigYAML(3), "    state_history_depth: 1\n",
+			"    state_history_depth: 1\n  - name: outside\n"+
+				"    iteration: {type: external_process, command: [\"true\"]}\n"+
+				"    init_state_values: [0.0]\n    state_history_depth: 1\n", 1)
+		client := newJobClient(t, t.TempDir(), 1)
+		var body jobError
+		if status := client.do("POST", "/jobs", config, &body); status != http.StatusBadRequest ||
+			!strings.Contains(body.Error, "--allow-external-process") {
+			t.Fatalf("expected a 400 naming the flag, got %d %+v", status, body)
+		}
+		allowing, err := NewJobServer(t.TempDir(), 1, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer allowing.Close()
+		if _, err := allowing.Submit([]byte(config)); err != nil {
+			t.Errorf("a server allowing external_process refused it: %v", err)
+		}
+	})
+
+	t.Run("jobs survive a restart", func(t *testing.T) {
+		directory := t.TempDir()
+		before, err := NewJobServer(directory, 1, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		finished, _ := before.Submit([]byte(jobConfigYAML(3)))
+		for job, _ := before.Get(finished.Id); !job.Status.finished(); {
+			time.Sleep(5 * time.Millisecond)
+			job, _ = before.Get(finished.Id)
+		}
+		interrupted, _ := before.Submit([]byte(longJobConfigYAML))
+		queued, _ := before.Submit([]byte(jobConfigYAML(4)))
+		for job, _ := before.Get(interrupted.Id); job.Status != JobRunning; {
+			time.Sleep(5 * time.Millisecond)
+			job, _ = before.Get(interrupted.Id)
+		}
+		before.Close()
+
+		client := newJobClient(t, directory, 1)
+		jobs := client.server.List()
+		if len(jobs) != 3 || jobs[0].Status != JobSucceeded {
+			t.Fatalf("unexpected jobs after restart: %+v", jobs)
+		}
+		var results JobResults
+		client.do("GET", "/jobs/"+finished.Id+"/results", "", &results)
+		if walk := results.Partitions["walk"]; len(walk) != 4 || walk[3][0] != 6.0 {
+			t.Errorf("unexpected results after restart: %+v", results)
+		}
+		// the interrupted job runs again from the start, ahead of the queued one
+		client.await(interrupted.Id, isRunning)
+		if job, _ := client.server.Get(queued.Id); job.Status != JobQueued {
+			t.Fatalf("expected the queued job to still wait, got %+v", job)
+		}
+		client.do("POST", "/jobs/"+interrupted.Id+"/cancel", "", nil)
+		if job := client.await(queued.Id, isFinished); job.Status != JobSucceeded {
+			t.Fatalf("expected the queued job to run after restart, got %+v", job)
+		}
+
+		// new submissions do not reuse an id from before the restart
+		if job := client.submit(jobConfigYAML(1)); job.Id <= queued.Id {
+			t.Errorf("id %s was reused", job.Id)
+		}
+	})
+
+	t.Run("results formats", func(t *testing.T) {
+		client := newJobClient(t, t.TempDir(), 1)
+		job := client.await(client.submit(jobConfigYAML(2)).Id, isFinished)
+
+		var body jobError
+		if status := client.do(
+			"GET", "/jobs/"+job.Id+"/results?format=parquet", "", &body,
+		); status != http.StatusBadRequest || !strings.Contains(body.Error, "json") {
+			t.Errorf("expected an unknown format to list the available ones, got %d %+v",
+				status, body)
+		}
+
+		RegisterResultFormat("test_times", "text/plain",
+			func(storage *simulator.StateTimeStorage, w io.Writer) error {
+				_, err := fmt.Fprint(w, storage.GetTimes())
+				return err
+			})
+		defer delete(resultFormats, "test_times")
+		response, err := http.Get(client.url + "/jobs/" + job.Id + "/results?format=test_times")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		data, _ := io.ReadAll(response.Body)
+		if string(data) != "[0 1 2]" ||
+			response.Header.Get("Content-Type") != "text/plain" {
+			t.Errorf("registered format returned %q (%s)",
+				data, response.Header.Get("Content-Type"))
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/umbralcalc/stochadex/pkg/analysis"
@@ -112,7 +113,9 @@ func (m *MacroConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 
 // buildStorage produces the data: tier's storage: from a file source when one is
 // configured, otherwise by running the sub-simulation to completion.
-func (d *DataConfig) buildStorage() (*simulator.StateTimeStorage, error) {
+func (d *DataConfig) buildStorage(
+	ctx context.Context,
+) (*simulator.StateTimeStorage, error) {
 	if d.Source != nil {
 		return d.Source.load()
 	}
@@ -133,13 +136,13 @@ func (d *DataConfig) buildStorage() (*simulator.StateTimeStorage, error) {
 	if d.Timestep == 0 {
 		d.Timestep = 1.0
 	}
-	storage := analysis.NewStateTimeStorageFromPartitions(
+	return analysis.NewStateTimeStorageFromPartitionsContext(
+		ctx,
 		partitions,
 		&simulator.NumberOfStepsTerminationCondition{MaxNumberOfSteps: d.Steps},
 		&simulator.ConstantTimestepFunction{Stepsize: d.Timestep},
 		d.InitTime,
 	)
-	return storage, nil
 }
 
 // resolveIterations resolves any data-spec iterations on the given partitions in
@@ -163,7 +166,24 @@ func resolveIterations(partitions []simulator.PartitionConfig) error {
 // exits, which suits a CLI and makes it unusable from a caller that wants the
 // output or the error — a downstream driving a registered environment, say.
 func RunMacros(config *ApiRunConfig) (*simulator.StateTimeStorage, error) {
-	return runMacros(config)
+	return RunMacrosContext(context.Background(), config)
+}
+
+// RunMacrosContext is RunMacros with cancellation. Once ctx is done it stops at
+// the next step boundary of the simulation it is running — the data:
+// sub-simulation or a macro's partitions — or before the next macro, and
+// returns ctx.Err(). A macro whose resolution panics on a bad config is
+// reported as an error rather than a panic.
+func RunMacrosContext(
+	ctx context.Context,
+	config *ApiRunConfig,
+) (storage *simulator.StateTimeStorage, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			storage, err = nil, recoveredError("api: ", r)
+		}
+	}()
+	return runMacros(ctx, config)
 }
 
 // runMacros expands and runs each macro in turn, returning the resulting storage.
@@ -171,7 +191,10 @@ func RunMacros(config *ApiRunConfig) (*simulator.StateTimeStorage, error) {
 // simulation; an against-storage macro runs against the data: storage, which is
 // built lazily on first use — so a live-only config needs no data: block. Running
 // in turn lets a later against-storage macro reference an earlier one's output.
-func runMacros(config *ApiRunConfig) (*simulator.StateTimeStorage, error) {
+func runMacros(
+	ctx context.Context,
+	config *ApiRunConfig,
+) (*simulator.StateTimeStorage, error) {
 	if len(config.Main.Partitions) > 0 {
 		return nil, fmt.Errorf("api: a config sets both main.partitions and macros:; " +
 			"macros run in their own context and ignore main — put data-generating " +
@@ -185,11 +208,14 @@ func runMacros(config *ApiRunConfig) (*simulator.StateTimeStorage, error) {
 		if config.Data == nil {
 			return fmt.Errorf("api: against-storage macros require a data: block to analyse")
 		}
-		built, err := config.Data.buildStorage()
+		built, err := config.Data.buildStorage(ctx)
 		storage = built
 		return err
 	}
 	for i := range config.Macros {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		macro := &config.Macros[i]
 		if live, ok := macro.Spec.(liveMacroSpec); ok {
 			// A live macro may still need observed data (smc_inference): build the
@@ -204,12 +230,16 @@ func runMacros(config *ApiRunConfig) (*simulator.StateTimeStorage, error) {
 			if err != nil {
 				return nil, fmt.Errorf("macro %q: %w", macro.Type, err)
 			}
-			storage = analysis.NewStateTimeStorageFromPartitions(
+			storage, err = analysis.NewStateTimeStorageFromPartitionsContext(
+				ctx,
 				partitions,
 				&simulator.NumberOfStepsTerminationCondition{MaxNumberOfSteps: steps},
 				&simulator.ConstantTimestepFunction{Stepsize: timestep},
 				0.0,
 			)
+			if err != nil {
+				return nil, err
+			}
 			continue
 		}
 		if err := ensureStorage(); err != nil {
@@ -219,7 +249,12 @@ func runMacros(config *ApiRunConfig) (*simulator.StateTimeStorage, error) {
 		if err != nil {
 			return nil, fmt.Errorf("macro %q: %w", macro.Type, err)
 		}
-		storage = analysis.AddPartitionsToStateTimeStorage(storage, partitions, windows)
+		storage, err = analysis.AddPartitionsToStateTimeStorageContext(
+			ctx, storage, partitions, windows,
+		)
+		if err != nil {
+			return nil, err
+		}
 	}
 	if storage == nil {
 		return nil, fmt.Errorf("api: no macros produced any output")
@@ -117,7 +117,7 @@ func TestPosteriorEstimationMacroEquivalence(t *testing.T) {
 	if err := os.WriteFile(path, []byte(posteriorMacroYAML), 0o644); err != nil {
 		t.Fatal(err)
 	}
-	macroStorage, err := runMacros(LoadApiRunConfigFromYaml(path))
+	macroStorage, err := RunMacros(LoadApiRunConfigFromYaml(path))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -148,7 +148,7 @@ func TestPosteriorEstimationMacroEquivalence(t *testing.T) {
 // room for honest sampling residual on the high-variance (covariance 9) second
 // coordinate.
 func TestPosteriorEstimationMacroConverges(t *testing.T) {
-	storage, err := runMacros(LoadApiRunConfigFromYaml(
+	storage, err := RunMacros(LoadApiRunConfigFromYaml(
 		"../../cfg/example_posterior_macro_config.yaml"))
 	if err != nil {
 		t.Fatal(err)
@@ -204,7 +204,7 @@ macros:
 	if err := os.WriteFile(path, []byte(noParamsYAML), 0o644); err != nil {
 		t.Fatal(err)
 	}
-	storage, err := runMacros(LoadApiRunConfigFromYaml(path))
+	storage, err := RunMacros(LoadApiRunConfigFromYaml(path))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -245,7 +245,7 @@ macros:
 	if err := os.WriteFile(path, []byte(fitYAML), 0o644); err != nil {
 		t.Fatal(err)
 	}
-	macroStorage, err := runMacros(LoadApiRunConfigFromYaml(path))
+	macroStorage, err := RunMacros(LoadApiRunConfigFromYaml(path))
 	if err != nil {
 		t.Fatal(err)
 	}
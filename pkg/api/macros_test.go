@@ -52,7 +52,7 @@ func TestMacroTierRunsInProcess(t *testing.T) {
 	if len(config.Macros) != 2 || config.Data == nil {
 		t.Fatalf("data: and macros: not loaded (%d macros, data=%v)", len(config.Macros), config.Data != nil)
 	}
-	storage, err := runMacros(config)
+	storage, err := RunMacros(config)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -88,7 +88,7 @@ func TestMacroErrors(t *testing.T) {
 		); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := runMacros(&config); err == nil {
+		if _, err := RunMacros(&config); err == nil {
 			t.Error("expected an error when macros have no data: block")
 		}
 	})
@@ -102,7 +102,7 @@ func TestRunMacrosGuards(t *testing.T) {
 			Main:   RunConfig{Partitions: []simulator.PartitionConfig{{Name: "p"}}},
 			Macros: []MacroConfig{{Type: "vector_mean", Spec: &vectorMeanSpec{}}},
 		}
-		if _, err := runMacros(config); err == nil {
+		if _, err := RunMacros(config); err == nil {
 			t.Error("expected an error when both main.partitions and macros: are set")
 		}
 	})
@@ -130,7 +130,7 @@ func TestRunMacrosGuards(t *testing.T) {
 			},
 			Macros: []MacroConfig{{Type: "vector_mean", Spec: &vectorMeanSpec{}}},
 		}
-		_, err := runMacros(config)
+		_, err := RunMacros(config)
 		if err == nil || !strings.Contains(err.Error(), "deadlock") {
 			t.Errorf("expected a deadlock error from the cyclic data: block, got: %v", err)
 		}
@@ -8,10 +8,12 @@ import (
 )
 
 // ParsedArgs bundles CLI-derived inputs for running the API: the YAML config
-// path and an optional socket config path.
+// path, an optional socket config path and an optional profile output path,
+// which overrides the config's run.profile.
 type ParsedArgs struct {
-	ConfigFile string
-	SocketFile string
+	ConfigFile  string
+	SocketFile  string
+	ProfileFile string
 }
 
 // ArgParse parses CLI flags into a ParsedArgs.
@@ -37,12 +39,172 @@ func ArgParse() ParsedArgs {
 			Help:     "yaml config path for socket",
 		},
 	)
+	profileFile := parser.String(
+		"p",
+		"profile",
+		&argparse.Options{
+			Required: false,
+			Help:     "path to write a Chrome trace profile of the run to",
+		},
+	)
 	err := parser.Parse(os.Args)
 	if err != nil {
 		fmt.Print(parser.Usage(err))
 	}
 	return ParsedArgs{
-		ConfigFile: *configFile,
-		SocketFile: *socketFile,
+		ConfigFile:  *configFile,
+		SocketFile:  *socketFile,
+		ProfileFile: *profileFile,
+	}
+}
+
+// ServeArgs bundles the CLI-derived inputs for `stochadex serve`: the address
+// to listen on, the directory jobs are persisted in and the number of jobs
+// run at once.
+type ServeArgs struct {
+	Address              string
+	JobsDirectory        string
+	Concurrency          int
+	AllowExternalProcess bool
+}
+
+// ServeArgParse parses the flags following the serve subcommand into a
+// ServeArgs.
+func ServeArgParse() ServeArgs {
+	parser := argparse.NewParser(
+		"stochadex serve",
+		"Queue and run configs submitted over HTTP",
+	)
+	address := parser.String(
+		"a",
+		"address",
+		&argparse.Options{
+			Required: false,
+			Help:     "address to listen on",
+			Default:  "localhost:8080",
+		},
+	)
+	jobsDirectory := parser.String(
+		"d",
+		"jobs-dir",
+		&argparse.Options{
+			Required: false,
+			Help:     "directory jobs are persisted in",
+			Default:  "stochadex-jobs",
+		},
+	)
+	concurrency := parser.Int(
+		"n",
+		"concurrency",
+		&argparse.Options{
+			Required: false,
+			Help:     "maximum number of jobs run at once (0 for GOMAXPROCS)",
+			Default:  0,
+		},
+	)
+	allowExternalProcess := parser.Flag(
+		"",
+		"allow-external-process",
+		&argparse.Options{
+			Required: false,
+			Help: "run submitted configs that use external_process iterations, " +
+				"which can run any command as this server's user",
+		},
+	)
+	// os.Args[1] is the subcommand, which takes the program name's place
+	err := parser.Parse(os.Args[1:])
+	if err != nil {
+		fmt.Print(parser.Usage(err))
+		os.Exit(2)
+	}
+	return ServeArgs{
+		Address:              *address,
+		JobsDirectory:        *jobsDirectory,
+		Concurrency:          *concurrency,
+		AllowExternalProcess: *allowExternalProcess,
+	}
+}
+
+// CodegenArgs bundles the CLI-derived inputs for `stochadex codegen`: the
+// config and the expression partition in it to generate Go for, and where and
+// as what to write it.
+type CodegenArgs struct {
+	ConfigFile      string
+	Partition       string
+	Package         string
+	Type            string
+	OutputDirectory string
+	Steps           int
+}
+
+// CodegenArgParse parses the flags following the codegen subcommand into a
+// CodegenArgs.
+func CodegenArgParse() CodegenArgs {
+	parser := argparse.NewParser(
+		"stochadex codegen",
+		"Generate a Go iteration, and a test of it, from an expression partition",
+	)
+	configFile := parser.String(
+		"c",
+		"config",
+		&argparse.Options{
+			Required: true,
+			Help:     "yaml config path",
+		},
+	)
+	partition := parser.String(
+		"p",
+		"partition",
+		&argparse.Options{
+			Required: true,
+			Help:     "name of the expression partition to generate",
+		},
+	)
+	packageName := parser.String(
+		"",
+		"package",
+		&argparse.Options{
+			Required: false,
+			Help:     "Go package to generate into (default: the output directory's)",
+		},
+	)
+	typeName := parser.String(
+		"t",
+		"type",
+		&argparse.Options{
+			Required: false,
+			Help:     "name of the generated iteration (default: <Partition>Iteration)",
+		},
+	)
+	outputDirectory := parser.String(
+		"o",
+		"out",
+		&argparse.Options{
+			Required: false,
+			Help:     "directory to write the Go into (default: the config's)",
+		},
+	)
+	steps := parser.Int(
+		"n",
+		"steps",
+		&argparse.Options{
+			Required: false,
+			Help:     "steps the generated test runs the two iterations side by side",
+			Default:  1000,
+		},
+	)
+	// os.Args[1] is the subcommand, which takes the program name's place
+	err := parser.Parse(os.Args[1:])
+	if err != nil {
+		fmt.Print(parser.Usage(err))
+		os.Exit(2)
+	}
+	return CodegenArgs{
+		ConfigFile:      *configFile,
+		Partition:       *partition,
+		Package:         *packageName,
+		Type:            *typeName,
+		OutputDirectory: *outputDirectory,
+		Steps:           *steps,
 	}
 }
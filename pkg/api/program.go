@@ -43,6 +43,7 @@ type ExpressionConfig struct {
 // Fields:
 //   - Partitions: List of partition configurations defining the simulation state
 //   - Expressions: Declarative iterations bound to partitions by name
+//   - Functions, FunctionImports: Expression functions every expression partition can call
 //   - SimulationStrings: The simulation block as loaded (component data specs)
 //   - Simulation: The resolved simulation config (not loaded from YAML directly)
 //
@@ -69,15 +70,25 @@ type RunConfig struct {
 	Partitions []simulator.PartitionConfig `yaml:"partitions"`
 	// Expressions declaratively supply the iteration for the partitions they name.
 	Expressions []ExpressionConfig `yaml:"expressions,omitempty"`
+	// Functions are expression functions every expression partition in the run can call.
+	// See general.ExpressionFunction.
+	Functions []general.ExpressionFunction `yaml:"functions,omitempty"`
+	// FunctionImports are paths of FunctionLibrary files whose functions the run can call as
+	// if it had declared them, for functions shared across configs.
+	FunctionImports []string `yaml:"function_imports,omitempty"`
 	// SimulationStrings holds the simulation block as loaded (component fields are
 	// {type: ...} data specs). It is resolved into Simulation at load time.
 	SimulationStrings simulator.SimulationConfigStrings `yaml:"simulation"`
 	// Simulation is the resolved simulation config used to build the generator.
 	Simulation simulator.SimulationConfig `yaml:"-"`
+
+	imported []general.ExpressionFunction
 }
 
 // resolve fills the run's data-spec components at load time: the simulation
-// components and each partition whose iteration: was given as a data spec.
+// components and each partition whose iteration: was given as a data spec. It then
+// loads the run's function imports and checks every expression against the widths the
+// config fixes (see checkExpressions).
 func (r *RunConfig) resolve() error {
 	resolved, err := r.SimulationStrings.ResolveDataComponents()
 	if err != nil {
@@ -96,15 +107,23 @@ func (r *RunConfig) resolve() error {
 		}
 		r.Partitions[index].Iteration = iteration
 	}
-	return nil
+	if err := r.importFunctions(); err != nil {
+		return err
+	}
+	r.useFunctions()
+	return r.checkExpressions()
 }
 
 // GetConfigGenerator constructs a ConfigGenerator preloaded with the run's
 // SimulationConfig and Partitions, and gives any partition named by an Expressions entry a
-// declarative ExpressionIteration built from that entry.
+// declarative ExpressionIteration built from that entry. With a non_finite_check set, the
+// sentinel's report is traced downstream through the partition dependency graph.
 func (r *RunConfig) GetConfigGenerator() *simulator.ConfigGenerator {
 	generator := simulator.NewConfigGenerator()
-	generator.SetSimulation(&r.Simulation)
+	// The generator gets its own copy of the simulation block, so neither the trace
+	// set below nor a caller changing the generator's simulation writes into r.
+	simulation := r.Simulation
+	generator.SetSimulation(&simulation)
 	for _, partition := range r.Partitions {
 		generator.SetPartition(&partition)
 	}
@@ -120,6 +139,17 @@ func (r *RunConfig) GetConfigGenerator() *simulator.ConfigGenerator {
 		partition.Iteration = &expression.ExpressionIteration
 		generator.ResetPartition(expression.Partition, partition)
 	}
+	// Also done by resolve, but not every RunConfig is loaded: one built in Go gets its
+	// imports and functions here, before Configure compiles anything that calls them.
+	if r.imported == nil && len(r.FunctionImports) > 0 {
+		if err := r.importFunctions(); err != nil {
+			panic("api: " + err.Error())
+		}
+	}
+	r.useFunctions()
+	if r.Simulation.NonFiniteCheck != simulator.NonFiniteOff {
+		simulation.NonFiniteTrace = nonFiniteTrace(generator)
+	}
 	return generator
 }
 
@@ -138,7 +168,9 @@ type EmbeddedRunConfig struct {
 //     config is active). This is the default.
 //   - "ensemble": run one member per seed concurrently, varying the global seed,
 //     via simulator.RunSeededEnsemble. Each member is rebuilt by re-loading the
-//     source file to get fresh, non-shared iteration instances.
+//     source file to get fresh, non-shared iteration instances. With batched
+//     set, the members instead run in lock-step in one goroutine via
+//     simulator.RunBatchedEnsemble.
 type RunModeConfig struct {
 	Mode string `yaml:"mode,omitempty"`
 	// Seeds are the per-member global seeds for ensemble mode (one member each).
@@ -146,6 +178,14 @@ type RunModeConfig struct {
 	// Concurrency bounds how many ensemble members run at once; <= 0 defaults to
 	// GOMAXPROCS.
 	Concurrency int `yaml:"concurrency,omitempty"`
+	// Batched runs ensemble members in lock-step with simulator.RunBatchedEnsemble
+	// instead of concurrently, which is faster for many members of a small
+	// model. Concurrency is then ignored.
+	Batched bool `yaml:"batched,omitempty"`
+	// Profile, for an offline batch run, is a path to write a Chrome
+	// trace-event profile of the run to. The cost summary and a recommended
+	// execution strategy go to stderr (see simulator.Profiler).
+	Profile string `yaml:"profile,omitempty"`
 }
 
 // ApiRunConfig is the concrete, YAML-loadable configuration for an API run:
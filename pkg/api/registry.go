@@ -3,6 +3,7 @@ package api
 import (
 	"fmt"
 	"sort"
+	"time"
 
 	"github.com/umbralcalc/stochadex/pkg/continuous"
 	"github.com/umbralcalc/stochadex/pkg/discrete"
@@ -73,6 +74,10 @@ var iterationBuilders = map[string]iterationBuilder{
 	// via UpdateMemory (StateMemoryIteration), exactly as it does for the Go form
 	// &general.FromHistoryIteration{}. It is only meaningful inside an embedded run.
 	"from_history": buildFromHistory,
+
+	// external_process computes a partition in a subprocess (Python, R, ...)
+	// speaking cmd/messages/external_process.proto over stdin/stdout.
+	"external_process": buildExternalProcess,
 }
 
 // extraIterationBuilders holds iteration builders contributed by a package
@@ -210,6 +215,85 @@ func buildFromStorage(fields map[string]interface{}) (simulator.Iteration, error
 	return iteration, nil
 }
 
+// buildExternalProcess builds an ExternalProcessIteration from its command, the
+// optional histories to send, a timeout duration string (e.g. "5s") and a
+// restart policy with its max_restarts bound. The subprocess is launched when
+// the partition is configured, not here.
+func buildExternalProcess(fields map[string]interface{}) (simulator.Iteration, error) {
+	iteration := &general.ExternalProcessIteration{}
+	for key, value := range fields {
+		switch key {
+		case "command":
+			command, err := stringRow("external_process", key, value)
+			if err != nil {
+				return nil, err
+			}
+			iteration.Command = command
+		case "histories":
+			histories, err := stringRow("external_process", key, value)
+			if err != nil {
+				return nil, err
+			}
+			iteration.Histories = histories
+		case "timeout":
+			text, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf(
+					"external_process: timeout must be a duration such as \"5s\", got %T", value)
+			}
+			timeout, err := time.ParseDuration(text)
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf(
+					"external_process: timeout must be a positive duration such as \"5s\", got %q", text)
+			}
+			iteration.Timeout = timeout
+		case "restart":
+			policy, ok := value.(string)
+			if !ok || (policy != string(general.ExternalProcessRestartNever) &&
+				policy != string(general.ExternalProcessRestartOnFailure)) {
+				return nil, fmt.Errorf(
+					"external_process: restart must be %q or %q, got %v",
+					general.ExternalProcessRestartNever,
+					general.ExternalProcessRestartOnFailure, value)
+			}
+			iteration.Restart = general.ExternalProcessRestartPolicy(policy)
+		case "max_restarts":
+			restarts, ok := value.(int)
+			if !ok || restarts < 0 {
+				return nil, fmt.Errorf(
+					"external_process: max_restarts must be a non-negative integer, got %v", value)
+			}
+			iteration.MaxRestarts = restarts
+		default:
+			return nil, fmt.Errorf("external_process: unknown field %q", key)
+		}
+	}
+	if len(iteration.Command) == 0 {
+		return nil, fmt.Errorf(
+			"external_process: missing required field \"command\" (the program and its arguments)")
+	}
+	return iteration, nil
+}
+
+// stringRow converts a YAML list of strings into a []string, naming the
+// offending element on a type mismatch.
+func stringRow(specType, key string, value interface{}) ([]string, error) {
+	raw, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: %s must be a list, got %T", specType, key, value)
+	}
+	out := make([]string, len(raw))
+	for i, element := range raw {
+		text, ok := element.(string)
+		if !ok {
+			return nil, fmt.Errorf(
+				"%s: %s[%d] must be a string, got %T", specType, key, i, element)
+		}
+		out[i] = text
+	}
+	return out, nil
+}
+
 // floatRow converts a YAML list of numbers (int or float64 as decoded) into a
 // []float64, naming the offending element on a type mismatch.
 func floatRow(specType, key string, value interface{}) ([]float64, error) {
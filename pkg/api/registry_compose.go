@@ -8,7 +8,9 @@ import (
 	"github.com/umbralcalc/stochadex/pkg/general"
 	"github.com/umbralcalc/stochadex/pkg/inference"
 	"github.com/umbralcalc/stochadex/pkg/kernels"
+	"github.com/umbralcalc/stochadex/pkg/rng"
 	"github.com/umbralcalc/stochadex/pkg/simulator"
+	"github.com/umbralcalc/stochadex/pkg/spatial"
 	"gonum.org/v1/gonum/mat"
 	"gopkg.in/yaml.v2"
 )
@@ -139,6 +141,30 @@ func (r *specReader) iteration(key string) simulator.Iteration {
 	return resolved
 }
 
+// topology decodes a nested topology mapping strictly into a spatial.TopologySpec
+// and builds it.
+func (r *specReader) topology(key string) *spatial.Topology {
+	value, ok := r.value(key, true)
+	if !ok {
+		return nil
+	}
+	encoded, err := yaml.Marshal(value)
+	if err != nil {
+		r.fail("field %q: %v", key, err)
+		return nil
+	}
+	spec := &spatial.TopologySpec{}
+	if err := yaml.UnmarshalStrict(encoded, spec); err != nil {
+		r.fail("field %q: %v", key, err)
+		return nil
+	}
+	topology, err := spec.Build()
+	if err != nil {
+		r.fail("field %q: %v", key, err)
+	}
+	return topology
+}
+
 func (r *specReader) priorList(key string) []inference.Prior {
 	value, ok := r.value(key, true)
 	if !ok {
@@ -302,6 +328,13 @@ func resolveKernel(spec simulator.ComponentSpec) (kernels.IntegrationKernel, err
 			KernelA: reader.kernel("kernel_a"),
 			KernelB: reader.kernel("kernel_b"),
 		}
+	case "expression_kernel":
+		kernel := &general.ExpressionIntegrationKernel{
+			Bindings:  reader.expressionBindings(),
+			Functions: reader.expressionFunctions(),
+		}
+		kernel.Weight = reader.expression("weight", true, kernel.Bindings, kernel.Functions)
+		result = kernel
 	default:
 		return nil, fmt.Errorf("kernel: unknown type %q", spec.Type)
 	}
@@ -330,6 +363,16 @@ func resolveLikelihood(spec simulator.ComponentSpec) (inference.LikelihoodDistri
 		result = &inference.GammaLikelihoodDistribution{}
 	case "negative_binomial":
 		result = &inference.NegativeBinomialLikelihoodDistribution{}
+	case "expression_likelihood":
+		likelihood := &inference.ExpressionLikelihoodDistribution{
+			Bindings:  reader.expressionBindings(),
+			Functions: reader.expressionFunctions(),
+		}
+		likelihood.LogPDF = reader.expression(
+			"logpdf", true, likelihood.Bindings, likelihood.Functions)
+		likelihood.Sample = reader.expression(
+			"sample", false, likelihood.Bindings, likelihood.Functions)
+		result = likelihood
 	default:
 		return nil, fmt.Errorf("likelihood: unknown type %q", spec.Type)
 	}
@@ -365,12 +408,87 @@ func resolvePrior(spec simulator.ComponentSpec) (inference.Prior, error) {
 		result = &inference.HalfNormalPrior{Sigma: reader.floatField("sigma")}
 	case "log_normal":
 		result = &inference.LogNormalPrior{Mu: reader.floatField("mu"), Sigma: reader.floatField("sigma")}
+	case "expression_prior":
+		// A quantile makes it a QuantilePrior, and only then, so a design: that needs one
+		// is still refused up front when it is missing.
+		functions := reader.expressionFunctions()
+		logPDF := reader.stringField("logpdf", true)
+		sample := reader.stringField("sample", true)
+		var err error
+		if quantile := reader.stringField("quantile", false); quantile != "" {
+			result, err = inference.NewExpressionQuantilePrior(logPDF, sample, quantile, functions)
+		} else {
+			result, err = inference.NewExpressionPrior(logPDF, sample, functions)
+		}
+		if err != nil && reader.err == nil {
+			reader.fail("%v", err)
+		}
 	default:
 		return nil, fmt.Errorf("prior: unknown type %q", spec.Type)
 	}
 	return result, reader.done()
 }
 
+func (r *specReader) stringField(key string, required bool) string {
+	value, ok := r.value(key, required)
+	if !ok {
+		return ""
+	}
+	typed, ok := value.(string)
+	if !ok {
+		r.fail("field %q must be a string, got %T", key, value)
+	}
+	return typed
+}
+
+// expression reads an expression field and compiles it, with the component's bindings and
+// functions, so that one that cannot be parsed is reported when the config loads rather than
+// when the component is configured.
+func (r *specReader) expression(
+	key string,
+	required bool,
+	bindings []general.ExpressionBinding,
+	functions []general.ExpressionFunction,
+) string {
+	expr := r.stringField(key, required)
+	if expr == "" {
+		return ""
+	}
+	if _, err := general.NewExpressionEvaluator(expr, bindings, functions, false); err != nil {
+		r.fail("field %q: %v", key, err)
+	}
+	return expr
+}
+
+// expressionBindings and expressionFunctions read an expression component's optional bindings
+// and functions blocks, strictly decoded as an expressions entry's are.
+func (r *specReader) expressionBindings() []general.ExpressionBinding {
+	var bindings []general.ExpressionBinding
+	r.decode("bindings", &bindings)
+	return bindings
+}
+
+func (r *specReader) expressionFunctions() []general.ExpressionFunction {
+	var functions []general.ExpressionFunction
+	r.decode("functions", &functions)
+	return functions
+}
+
+// decode strictly decodes an optional field into out by re-encoding it.
+func (r *specReader) decode(key string, out interface{}) {
+	value, ok := r.value(key, false)
+	if !ok {
+		return
+	}
+	encoded, err := yaml.Marshal(value)
+	if err == nil {
+		err = yaml.UnmarshalStrict(encoded, out)
+	}
+	if err != nil {
+		r.fail("field %q: %v", key, err)
+	}
+}
+
 func (r *specReader) floatField(key string) float64 {
 	value, ok := r.value(key, true)
 	if !ok {
@@ -422,6 +540,19 @@ var aggregationFunctions = map[string]aggregationFunc{
 	"min":   general.MinAggregation,
 }
 
+var populationReductions = map[string]func(values []float64) float64{
+	"count": general.PopulationCountReduction,
+	"sum":   general.PopulationSumReduction,
+	"mean":  general.PopulationMeanReduction,
+	"max":   general.PopulationMaxReduction,
+	"min":   general.PopulationMinReduction,
+}
+
+// reactionFunctions are the local reaction terms of reaction_diffusion.
+var reactionFunctions = map[string]func(params *simulator.Params, values, out []float64){
+	"fisher_kpp": spatial.FisherKPPReaction,
+}
+
 // posteriorTransform is the Transform field type of PosteriorMeanIteration.
 type posteriorTransform = func(params *simulator.Params, values mat.Vector) mat.Vector
 
@@ -430,6 +561,14 @@ var posteriorTransforms = map[string]posteriorTransform{
 	"variance": inference.VarianceTransform,
 }
 
+// pointSamplerConstructors are the unit-cube designs an SMC proposal can draw its
+// first round from.
+var pointSamplerConstructors = map[string]rng.PointSamplerConstructor{
+	"sobol":           rng.SobolConstructor,
+	"halton":          rng.HaltonConstructor,
+	"latin_hypercube": rng.LatinHypercubeConstructor,
+}
+
 // ---- composable iteration builders --------------------------------------------
 
 func registerComposableIterations() {
@@ -477,6 +616,32 @@ func registerComposableIterations() {
 		it := &general.DiscountedCumulativeIteration{Iteration: r.iteration("iteration")}
 		return it, r.done()
 	}
+	iterationBuilders["population"] = func(f map[string]interface{}) (simulator.Iteration, error) {
+		r := newSpecReader("population", f)
+		it := &general.PopulationIteration{Entity: r.iteration("entity")}
+		return it, r.done()
+	}
+	iterationBuilders["population_aggregation"] = func(f map[string]interface{}) (simulator.Iteration, error) {
+		r := newSpecReader("population_aggregation", f)
+		it := &general.PopulationAggregationIteration{
+			Reduction: namedFunc(r, "reduction", populationReductions),
+		}
+		return it, r.done()
+	}
+	iterationBuilders["sir_network"] = func(f map[string]interface{}) (simulator.Iteration, error) {
+		r := newSpecReader("sir_network", f)
+		it := &spatial.SIRNetworkIteration{Topology: r.topology("topology")}
+		return it, r.done()
+	}
+	iterationBuilders["reaction_diffusion"] = func(f map[string]interface{}) (simulator.Iteration, error) {
+		r := newSpecReader("reaction_diffusion", f)
+		it := &spatial.ReactionDiffusionIteration{Topology: r.topology("topology")}
+		// reaction is optional: without it the field purely diffuses.
+		if _, ok := f["reaction"]; ok {
+			it.Reaction = namedFunc(r, "reaction", reactionFunctions)
+		}
+		return it, r.done()
+	}
 	iterationBuilders["data_generation"] = func(f map[string]interface{}) (simulator.Iteration, error) {
 		r := newSpecReader("data_generation", f)
 		it := &inference.DataGenerationIteration{Likelihood: r.likelihood("likelihood")}
@@ -495,6 +660,10 @@ func registerComposableIterations() {
 	iterationBuilders["smc_proposal"] = func(f map[string]interface{}) (simulator.Iteration, error) {
 		r := newSpecReader("smc_proposal", f)
 		it := &inference.SMCProposalIteration{Priors: r.priorList("priors")}
+		// design is optional: without it the first round draws pseudo-randomly.
+		if _, ok := f["design"]; ok {
+			it.Design = namedFunc(r, "design", pointSamplerConstructors)
+		}
 		return it, r.done()
 	}
 	// values_function takes either a whole named function ("function") or a
@@ -567,6 +736,32 @@ func registerComposableIterations() {
 		}
 		return iteration, nil
 	}
+	// expression_gradient is the derivative of an expression with respect to named
+	// params or upstreams, decoded the same way as expression. It is parsed here as
+	// well, so a malformed expression, function or shape fails at load rather than at
+	// Configure; unknown names and functions are caught with the run's other
+	// expressions by checkExpressions.
+	iterationBuilders["expression_gradient"] = func(f map[string]interface{}) (simulator.Iteration, error) {
+		encoded, err := yaml.Marshal(f)
+		if err != nil {
+			return nil, fmt.Errorf("expression_gradient: %w", err)
+		}
+		iteration := &general.ExpressionGradientIteration{}
+		if err := yaml.UnmarshalStrict(encoded, iteration); err != nil {
+			return nil, fmt.Errorf("expression_gradient: %w", err)
+		}
+		if len(iteration.WithRespectTo) == 0 {
+			return nil, fmt.Errorf("expression_gradient: with_respect_to must name at least one input")
+		}
+		if _, err := general.ParseExpressionDerivativeMode(iteration.Mode); err != nil {
+			return nil, fmt.Errorf("expression_gradient: %w", err)
+		}
+		if _, err := general.NewExpressionDerivative(iteration.Expr, iteration.Bindings,
+			iteration.Functions, iteration.Matrices, iteration.WithRespectTo); err != nil {
+			return nil, fmt.Errorf("expression_gradient: %w", err)
+		}
+		return iteration, nil
+	}
 }
 
 // Collection iteration func-field types and their framework-shipped values.
@@ -661,6 +856,37 @@ func registerDownstreamComponents() {
 			return &general.FromHistoryTimestepFunction{}, nil
 		},
 	)
+	// live_entities: outputs the named population partitions as their live
+	// entities only, passing everything else through to the nested output.
+	simulator.RegisterComponent(
+		"output_function", "live_entities",
+		func(spec simulator.ComponentSpec) (interface{}, error) {
+			r := newSpecReader("output_function live_entities", spec.Fields)
+			function := &general.LiveEntitiesOutputFunction{}
+			if value, ok := r.value("partitions", true); ok {
+				names, isList := value.([]interface{})
+				if !isList {
+					r.fail("field %q must be a list of partition names", "partitions")
+				}
+				for _, name := range names {
+					text, isString := name.(string)
+					if !isString {
+						r.fail("field %q must be a list of partition names", "partitions")
+						break
+					}
+					function.Partitions = append(function.Partitions, text)
+				}
+			}
+			if sink, ok := r.nestedSpec("output", true); ok {
+				resolved, err := simulator.ResolveOutputFunction(sink)
+				if err != nil {
+					r.fail("field %q: %v", "output", err)
+				}
+				function.Sink = resolved
+			}
+			return function, r.done()
+		},
+	)
 	// from_storage: replays an inline series of times by step number, the
 	// time-axis counterpart of the from_storage iteration. Its series is carried in
 	// the config as data (a list under "data"), with an optional "init_steps_taken"
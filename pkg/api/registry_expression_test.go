@@ -0,0 +1,329 @@
+package api
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/general"
+	"github.com/umbralcalc/stochadex/pkg/inference"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+func TestExpressionComponentResolution(t *testing.T) {
+	t.Run("expression_likelihood carries its expressions, bindings and functions", func(t *testing.T) {
+		it, err := ResolveIteration(simulator.ComponentSpec{
+			Type: "data_comparison",
+			Fields: map[string]interface{}{
+				"likelihood": map[string]interface{}{
+					"type":     "expression_likelihood",
+					"logpdf":   "logpdf_poisson(data, rates)",
+					"sample":   "poisson(rates)",
+					"bindings": []interface{}{map[string]interface{}{"name": "rates", "expr": "up(mean)"}},
+					"functions": []interface{}{
+						map[string]interface{}{"name": "up", "params": []interface{}{"m"}, "expr": "m + 1"},
+					},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		like := it.(*inference.DataComparisonIteration).Likelihood.(*inference.ExpressionLikelihoodDistribution)
+		if like.LogPDF != "logpdf_poisson(data, rates)" || like.Sample != "poisson(rates)" {
+			t.Errorf("expressions not applied: %+v", like)
+		}
+		if len(like.Bindings) != 1 || len(like.Functions) != 1 || like.Functions[0].Params[0] != "m" {
+			t.Errorf("bindings or functions not applied: %+v", like)
+		}
+	})
+
+	t.Run("expression_kernel carries its weight", func(t *testing.T) {
+		it, err := ResolveIteration(simulator.ComponentSpec{
+			Type: "values_function_vector_mean",
+			Fields: map[string]interface{}{
+				"function": "data_values",
+				"kernel": map[string]interface{}{
+					"type": "expression_kernel", "weight": "exp(past_time - current_time)",
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		kernel := it.(*general.ValuesFunctionVectorMeanIteration).Kernel
+		if kernel.(*general.ExpressionIntegrationKernel).Weight != "exp(past_time - current_time)" {
+			t.Error("weight not applied")
+		}
+	})
+
+	t.Run("expression_prior is a QuantilePrior only with a quantile", func(t *testing.T) {
+		resolve := func(fields map[string]interface{}) []inference.Prior {
+			t.Helper()
+			fields["type"] = "expression_prior"
+			it, err := ResolveIteration(simulator.ComponentSpec{
+				Type:   "smc_proposal",
+				Fields: map[string]interface{}{"priors": []interface{}{fields}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return it.(*inference.SMCProposalIteration).Priors
+		}
+		plain := resolve(map[string]interface{}{
+			"logpdf": "logpdf_exponential(x, 2)", "sample": "exponential(2)",
+		})
+		if _, ok := plain[0].(inference.QuantilePrior); ok {
+			t.Error("a prior without a quantile resolved as a QuantilePrior")
+		}
+		withQuantile := resolve(map[string]interface{}{
+			"logpdf": "logpdf_exponential(x, 2)", "sample": "exponential(2)",
+			"quantile": "-log(1 - u) / 2",
+		})
+		if _, ok := withQuantile[0].(inference.QuantilePrior); !ok {
+			t.Error("a prior with a quantile did not resolve as a QuantilePrior")
+		}
+	})
+
+	t.Run("malformed expression components are rejected at load", func(t *testing.T) {
+		for _, c := range []struct {
+			name   string
+			spec   simulator.ComponentSpec
+			wanted string
+		}{
+			{"an unparseable logpdf", simulator.ComponentSpec{
+				Type: "data_comparison",
+				Fields: map[string]interface{}{"likelihood": map[string]interface{}{
+					"type": "expression_likelihood", "logpdf": "logpdf_poisson(data,",
+				}},
+			}, "logpdf"},
+			{"a missing weight", simulator.ComponentSpec{
+				Type: "values_function_vector_mean",
+				Fields: map[string]interface{}{
+					"function": "data_values",
+					"kernel":   map[string]interface{}{"type": "expression_kernel"},
+				},
+			}, "weight"},
+			{"a binding with an unknown key", simulator.ComponentSpec{
+				Type: "values_function_vector_mean",
+				Fields: map[string]interface{}{
+					"function": "data_values",
+					"kernel": map[string]interface{}{
+						"type": "expression_kernel", "weight": "w",
+						"bindings": []interface{}{map[string]interface{}{"name": "w", "exp": "1"}},
+					},
+				},
+			}, "bindings"},
+			{"a non-string sample", simulator.ComponentSpec{
+				Type: "smc_proposal",
+				Fields: map[string]interface{}{"priors": []interface{}{map[string]interface{}{
+					"type": "expression_prior", "logpdf": "0", "sample": 1.0,
+				}}},
+			}, "sample"},
+			{"an unparseable quantile", simulator.ComponentSpec{
+				Type: "smc_proposal",
+				Fields: map[string]interface{}{"priors": []interface{}{map[string]interface{}{
+					"type": "expression_prior", "logpdf": "0", "sample": "uniform(0, 1)",
+					"quantile": "u *",
+				}}},
+			}, "quantile"},
+			{"a gradient with respect to nothing", simulator.ComponentSpec{
+				Type:   "expression_gradient",
+				Fields: map[string]interface{}{"expr": "x * x"},
+			}, "with_respect_to"},
+			{"a gradient in an unknown mode", simulator.ComponentSpec{
+				Type: "expression_gradient",
+				Fields: map[string]interface{}{
+					"expr": "x * x", "with_respect_to": []interface{}{"x"}, "mode": "sideways",
+				},
+			}, "mode"},
+			{"a gradient with respect to a binding", simulator.ComponentSpec{
+				Type: "expression_gradient",
+				Fields: map[string]interface{}{
+					"expr": "y * y", "with_respect_to": []interface{}{"y"},
+					"bindings": []interface{}{map[string]interface{}{"name": "y", "expr": "2 * x"}},
+				},
+			}, "binding"},
+		} {
+			_, err := ResolveIteration(c.spec)
+			if err == nil || !strings.Contains(err.Error(), c.wanted) {
+				t.Errorf("%s: got %v, want an error mentioning %q", c.name, err, c.wanted)
+			}
+		}
+	})
+}
+
+// TestExpressionComponentsRunInProcess runs a Poisson stream generated and smoothed entirely by
+// expression components.
+func TestExpressionComponentsRunInProcess(t *testing.T) {
+	const config = `main:
+  partitions:
+  - name: data_stream
+    iteration:
+      type: data_generation
+      likelihood: {type: expression_likelihood, logpdf: "logpdf_poisson(data, mean)", sample: "poisson(mean)"}
+    params:
+      mean: [1.8, 5.0]
+    init_state_values: [1.0, 5.0]
+    state_history_depth: 50
+    seed: 291
+  - name: rolling_mean
+    iteration:
+      type: values_function_vector_mean
+      function: data_values
+      kernel: {type: expression_kernel, weight: "exp((past_time - current_time) / timescale)"}
+    params:
+      timescale: [10.0]
+    params_as_partitions:
+      data_values_partition: [data_stream]
+    params_from_upstream:
+      latest_data_values: {upstream: data_stream}
+    init_state_values: [1.8, 5.0]
+    state_history_depth: 50
+    seed: 0
+  simulation:
+    output_condition: {type: every_step}
+    output_function: {type: nil}
+    termination_condition: {type: number_of_steps, max_steps: 100}
+    timestep_function: {type: constant, stepsize: 1.0}
+    init_time_value: 0.0
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	Run(LoadApiRunConfigFromYaml(path), &SocketConfig{})
+}
+
+// TestExpressionGradientFitsInProcess walks a partition down the gradient of an expression
+// objective, and fits a likelihood mean with an expression likelihood in place of the built-in
+// one it writes out, which must give the same fit.
+func TestExpressionGradientFitsInProcess(t *testing.T) {
+	const config = `data:
+  steps: 100
+  timestep: 1.0
+  partitions:
+  - name: test_data
+    iteration: {type: data_generation, likelihood: {type: normal}}
+    params: {mean: [2.0, 3.0], covariance_matrix: [1.0, 0.0, 0.0, 1.0]}
+    init_state_values: [2.0, 3.0]
+    state_history_depth: 100
+    seed: 5
+  - name: gradient
+    iteration:
+      type: expression_gradient
+      expr: "sum(logpdf_normal(target, theta, 1))"
+      with_respect_to: [theta]
+      upstreams: {theta: ascent}
+    params: {target: [1.5, -0.5]}
+    init_state_values: [0.0, 0.0]
+    state_history_depth: 1
+  - name: ascent
+    iteration: {type: gradient_descent}
+    params: {learning_rate: [0.5], ascent: [1]}
+    params_from_upstream:
+      gradient: {upstream: gradient}
+    init_state_values: [0.0, 0.0]
+    state_history_depth: 1
+macros:
+- type: likelihood_mean_function_fit
+  name: normal_fit
+  model:
+    likelihood: {type: normal}
+    params: {covariance_matrix: [1.0, 0.0, 0.0, 1.0]}
+  gradient: {function: mean_gradient, width: 2}
+  data: {partition_name: test_data}
+  window: {depth: 10}
+  learning_rate: 0.005
+  descent_iterations: 3
+  window_data_history_depth: {test_data: 10}
+- type: likelihood_mean_function_fit
+  name: expression_fit
+  model:
+    likelihood: {type: expression_likelihood, logpdf: "logpdf_normal(data, mean, 1)"}
+  gradient: {function: mean_gradient, width: 2}
+  data: {partition_name: test_data}
+  window: {depth: 10}
+  learning_rate: 0.005
+  descent_iterations: 3
+  window_data_history_depth: {test_data: 10}
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	storage, err := RunMacros(LoadApiRunConfigFromYaml(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ascent := storage.GetValues("ascent")
+	last := ascent[len(ascent)-1]
+	for i, want := range []float64{1.5, -0.5} {
+		if math.Abs(last[i]-want) > 1e-6 {
+			t.Errorf("ascent[%d]: got %v, want %v", i, last[i], want)
+		}
+	}
+	got, want := storage.GetValues("expression_fit"), storage.GetValues("normal_fit")
+	if len(got) == 0 || len(got) != len(want) {
+		t.Fatalf("got %d expression_fit rows for %d normal_fit rows", len(got), len(want))
+	}
+	for step := range want {
+		for i := range want[step] {
+			if math.Abs(got[step][i]-want[step][i]) > 1e-9 {
+				t.Errorf("step %d, element %d: expression %v, normal %v",
+					step, i, got[step][i], want[step][i])
+			}
+		}
+	}
+}
+
+// TestExpressionTablesRunInProcess reads a time-of-day tariff off a step table given inline in
+// an expression spec.
+func TestExpressionTablesRunInProcess(t *testing.T) {
+	const config = `main:
+  partitions:
+  - name: tariff
+    iteration:
+      type: expression
+      fields: [{name: price}]
+      tables:
+        hours: [0, 7, 16, 19, 24]
+        prices: [10, 20, 35, 20, 10]
+      outputs: ["interp(t + dt, hours, prices, step)"]
+    init_state_values: [10.0]
+    state_history_depth: 1
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	run := LoadApiRunConfigFromYaml(path)
+	store := simulator.NewStateTimeStorage()
+	run.Main.Simulation = simulator.SimulationConfig{
+		OutputCondition: &simulator.EveryStepOutputCondition{},
+		OutputFunction:  &simulator.StateTimeStorageOutputFunction{Store: store},
+		TerminationCondition: &simulator.NumberOfStepsTerminationCondition{
+			MaxNumberOfSteps: 26,
+		},
+		TimestepFunction: &simulator.ConstantTimestepFunction{Stepsize: 1.0},
+	}
+	simulator.NewPartitionCoordinator(run.Main.GetConfigGenerator().GenerateConfigs()).Run()
+	times, tariff := store.GetTimes(), store.GetValues("tariff")
+	for i, row := range tariff {
+		want := 10.0
+		switch {
+		case times[i] >= 24:
+		case times[i] >= 19:
+			want = 20
+		case times[i] >= 16:
+			want = 35
+		case times[i] >= 7:
+			want = 20
+		}
+		if row[0] != want {
+			t.Errorf("at t = %v: got %v, want %v", times[i], row[0], want)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/umbralcalc/stochadex/pkg/general"
 	"github.com/umbralcalc/stochadex/pkg/inference"
@@ -43,6 +44,7 @@ var wantIterationType = map[string]string{
 	"smc_posterior":                       "*inference.SMCPosteriorIteration",
 	"from_history":                        "*general.FromHistoryIteration",
 	"from_storage":                        "*general.FromStorageIteration",
+	"external_process":                    "*general.ExternalProcessIteration",
 
 	// composable (Phase B)
 	"compound_poisson_process":          "*continuous.CompoundPoissonProcessIteration",
@@ -59,8 +61,13 @@ var wantIterationType = map[string]string{
 	"data_generation":                   "*inference.DataGenerationIteration",
 	"data_comparison":                   "*inference.DataComparisonIteration",
 	"expression":                        "*general.ExpressionIteration",
+	"expression_gradient":               "*general.ExpressionGradientIteration",
 	"posterior_mean":                    "*inference.PosteriorMeanIteration",
 	"smc_proposal":                      "*inference.SMCProposalIteration",
+	"population":                        "*general.PopulationIteration",
+	"population_aggregation":            "*general.PopulationAggregationIteration",
+	"sir_network":                       "*spatial.SIRNetworkIteration",
+	"reaction_diffusion":                "*spatial.ReactionDiffusionIteration",
 }
 
 // iterationSpecFixtures gives a minimal valid Fields map for each composable
@@ -88,11 +95,17 @@ var iterationSpecFixtures = map[string]map[string]interface{}{
 	"values_collection":         {"pop_index": "next_non_empty", "push": "param_values"},
 	"values_sorting_collection": {"push_and_sort": "param_values"},
 	"expression":                {"fields": []interface{}{map[string]interface{}{"name": "x"}}, "outputs": []interface{}{"x"}},
+	"expression_gradient":       {"expr": "x * x", "with_respect_to": []interface{}{"x"}},
 	"from_storage":              {"data": []interface{}{[]interface{}{0.0}, []interface{}{1.0}}},
+	"external_process":          {"command": []interface{}{"python3", "model.py"}},
 	"data_generation":           {"likelihood": map[string]interface{}{"type": "normal"}},
 	"data_comparison":           {"likelihood": map[string]interface{}{"type": "normal"}},
 	"posterior_mean":            {"transform": "mean"},
 	"smc_proposal":              {"priors": []interface{}{map[string]interface{}{"type": "uniform", "lo": 0.0, "hi": 1.0}}},
+	"population":                {"entity": map[string]interface{}{"type": "constant_values"}},
+	"population_aggregation":    {"reduction": "count"},
+	"sir_network":               {"topology": map[string]interface{}{"edges": []interface{}{[]interface{}{0.0, 1.0}}}},
+	"reaction_diffusion":        {"topology": map[string]interface{}{"grid": map[string]interface{}{"rows": 2, "cols": 2}}},
 }
 
 // TestIterationRegistryConstructs is drift test 1: every registered name builds a
@@ -225,6 +238,65 @@ func TestResolveIterationErrors(t *testing.T) {
 		}
 	})
 
+	t.Run("external_process takes its command and subprocess policy", func(t *testing.T) {
+		it, err := ResolveIteration(simulator.ComponentSpec{
+			Type: "external_process",
+			Fields: map[string]interface{}{
+				"command":      []interface{}{"python3", "model.py"},
+				"histories":    []interface{}{"prices"},
+				"timeout":      "2s",
+				"restart":      "on_failure",
+				"max_restarts": 5,
+			},
+		})
+		if err != nil {
+			t.Fatalf("a valid external_process should be accepted: %v", err)
+		}
+		external := it.(*general.ExternalProcessIteration)
+		if !reflect.DeepEqual(external.Command, []string{"python3", "model.py"}) ||
+			!reflect.DeepEqual(external.Histories, []string{"prices"}) ||
+			external.Timeout != 2*time.Second || external.MaxRestarts != 5 ||
+			external.Restart != general.ExternalProcessRestartOnFailure {
+			t.Errorf("fields not applied: %+v", external)
+		}
+		for name, fields := range map[string]map[string]interface{}{
+			"missing command": {"timeout": "2s"},
+			"bad timeout":     {"command": []interface{}{"x"}, "timeout": "soon"},
+			"bad restart":     {"command": []interface{}{"x"}, "restart": "always"},
+			"unknown field":   {"command": []interface{}{"x"}, "nope": 1},
+		} {
+			if _, err := ResolveIteration(simulator.ComponentSpec{
+				Type: "external_process", Fields: fields,
+			}); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+	})
+
+	t.Run("live_entities output function wraps a nested output", func(t *testing.T) {
+		fn, err := simulator.ResolveOutputFunction(simulator.ComponentSpec{
+			Type: "live_entities",
+			Fields: map[string]interface{}{
+				"partitions": []interface{}{"herd"},
+				"output":     map[string]interface{}{"type": "stdout"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("a valid live_entities output function should be accepted: %v", err)
+		}
+		live := fn.(*general.LiveEntitiesOutputFunction)
+		if _, ok := live.Sink.(*simulator.StdoutOutputFunction); !ok ||
+			!reflect.DeepEqual(live.Partitions, []string{"herd"}) {
+			t.Errorf("fields not applied: %+v", live)
+		}
+		if _, err := simulator.ResolveOutputFunction(simulator.ComponentSpec{
+			Type:   "live_entities",
+			Fields: map[string]interface{}{"partitions": []interface{}{"herd"}},
+		}); err == nil {
+			t.Error("expected an error when the nested output is missing")
+		}
+	})
+
 	t.Run("values_function takes either a whole function or transform+reduce", func(t *testing.T) {
 		if _, err := ResolveIteration(simulator.ComponentSpec{
 			Type: "values_function", Fields: map[string]interface{}{"function": "params_event"},
@@ -509,6 +581,36 @@ func TestComposableResolution(t *testing.T) {
 		}
 	})
 
+	t.Run("smc_proposal resolves an optional named design", func(t *testing.T) {
+		it, err := ResolveIteration(simulator.ComponentSpec{
+			Type: "smc_proposal",
+			Fields: map[string]interface{}{
+				"priors": []interface{}{
+					map[string]interface{}{"type": "uniform", "lo": 0.0, "hi": 1.0},
+				},
+				"design": "sobol",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if it.(*inference.SMCProposalIteration).Design == nil {
+			t.Error("design not applied")
+		}
+		_, err = ResolveIteration(simulator.ComponentSpec{
+			Type: "smc_proposal",
+			Fields: map[string]interface{}{
+				"priors": []interface{}{
+					map[string]interface{}{"type": "uniform", "lo": 0.0, "hi": 1.0},
+				},
+				"design": "not_a_design",
+			},
+		})
+		if err == nil {
+			t.Error("expected an error for an unknown design")
+		}
+	})
+
 	t.Run("an unknown nested kernel type is rejected", func(t *testing.T) {
 		_, err := ResolveIteration(simulator.ComponentSpec{
 			Type: "values_function_vector_mean",
@@ -557,6 +659,63 @@ func TestComposableResolution(t *testing.T) {
 	})
 }
 
+// TestSpatialRunsFromYaml loads network and grid topologies through the YAML
+// loader, for the built-in spatial iterations and for an expression partition,
+// and steps them in-process.
+func TestSpatialRunsFromYaml(t *testing.T) {
+	const config = `main:
+  partitions:
+  - name: epidemic
+    iteration:
+      type: sir_network
+      topology: {edges: [[0, 1], [1, 2, 0.5]]}
+    params: {transmission_rate: [0.5], recovery_rate: [0.1], coupling: [0.2]}
+    init_state_values: [95.0, 100.0, 100.0, 5.0, 0.0, 0.0, 0.0, 0.0, 0.0]
+    state_history_depth: 1
+    seed: 11
+  - name: field
+    iteration:
+      type: reaction_diffusion
+      topology: {grid: {rows: 2, cols: 2, periodic: true}}
+      reaction: fisher_kpp
+    params: {diffusion_coefficient: [0.1], growth_rate: [0.5], carrying_capacity: [1.0]}
+    init_state_values: [0.5, 0.0, 0.0, 0.0]
+    state_history_depth: 1
+    seed: 0
+  - name: diffusing
+    iteration:
+      type: expression
+      topology: {grid: {rows: 2, cols: 2}}
+      fields: [{name: x, width: 4}]
+      outputs: ["x + dt * 0.1 * laplacian(x)"]
+    params: {}
+    init_state_values: [1.0, 0.0, 0.0, 0.0]
+    state_history_depth: 1
+    seed: 0
+  simulation:
+    output_condition: {type: every_step}
+    output_function: {type: nil}
+    termination_condition: {type: number_of_steps, max_steps: 20}
+    timestep_function: {type: constant, stepsize: 1.0}
+    init_time_value: 0.0
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded := LoadApiRunConfigFromYaml(path)
+	Run(loaded, &SocketConfig{})
+
+	if _, err := ResolveIteration(simulator.ComponentSpec{
+		Type: "sir_network",
+		Fields: map[string]interface{}{
+			"topology": map[string]interface{}{"grid": map[string]interface{}{"rows": 2}, "nodes": "x"},
+		},
+	}); err == nil {
+		t.Error("expected an error for a malformed topology")
+	}
+}
+
 // TestComposableRunsInProcess is the Phase B acceptance: a config whose iterations
 // are composable data specs (data_generation with a nested normal likelihood
 // feeding values_function_vector_mean with a named value function and an
@@ -1,21 +1,23 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/umbralcalc/stochadex/pkg/graph"
 	"github.com/umbralcalc/stochadex/pkg/simulator"
 )
 
 // StepAndServeWebsocket steps a simulation and streams state updates over a
-// websocket using simulator.WebsocketOutputFunction.
+// websocket using simulator.WebsocketOutputFunction. Clients can steer the run
+// over the same connection with ControlMessages; see NewLiveRunHandler.
 //
 // Usage hints:
 //   - The HTTP server mounts the websocket at handle and listens on address.
@@ -26,39 +28,9 @@ func StepAndServeWebsocket(
 	handle string,
 	address string,
 ) {
-	var upgrader = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool { return true },
-	}
-
 	http.HandleFunc(
 		handle,
-		func(w http.ResponseWriter, r *http.Request) {
-			connection, err := upgrader.Upgrade(w, r, nil)
-			if err != nil {
-				log.Println("Error upgrading to WebSocket:", err)
-				return
-			}
-			defer connection.Close()
-
-			var mutex sync.Mutex
-			simulationConfig := generator.GetSimulation()
-			simulationConfig.OutputFunction =
-				simulator.NewWebsocketOutputFunction(connection, &mutex)
-			generator.SetSimulation(simulationConfig)
-			coordinator := simulator.NewPartitionCoordinator(
-				generator.GenerateConfigs(),
-			)
-
-			// step under the configured execution strategy, sleeping between
-			// steps so the websocket streams state at a watchable rate
-			stepper := coordinator.NewStepper()
-			defer stepper.Close()
-			// terminate the for loop if the condition has been met
-			for !coordinator.ReadyToTerminate() {
-				stepper.Step()
-				time.Sleep(stepDelay * time.Millisecond)
-			}
-		},
+		NewLiveRunHandler(generator, stepDelay*time.Millisecond, false),
 	)
 	log.Fatal(http.ListenAndServe(address, nil))
 }
@@ -87,40 +59,93 @@ func CheckForDeadlock(generator *simulator.ConfigGenerator) error {
 	return fmt.Errorf(
 		"api: simulation wiring will deadlock — params_from_upstream forms a "+
 			"within-step dependency cycle among partitions %s. Break each cycle "+
-			"by making at least one direction a lag-1 read (a state-history read "+
-			"via params_as_partitions) instead of params_from_upstream",
+			"by making at least one direction a lag-1 read: give its "+
+			"params_from_upstream entry a lag: 1 (or read the state history via "+
+			"params_as_partitions instead)",
 		strings.Join(groups, ", "),
 	)
 }
 
+// nonFiniteTrace returns a simulator.SimulationConfig NonFiniteTrace that
+// describes every dependency edge downstream of a partition, as
+// "source -> target (param, kind)". The graph is built when a trace is first
+// asked for, from the generator as it then stands.
+func nonFiniteTrace(generator *simulator.ConfigGenerator) func(int) []string {
+	return func(partitionIndex int) []string {
+		edges := graph.Build(generator).Downstream(partitionIndex)
+		trace := make([]string, len(edges))
+		for i, e := range edges {
+			trace[i] = fmt.Sprintf(
+				"%s -> %s (%s, %s)", e.SourceName, e.TargetName, e.Param, e.Kind)
+		}
+		return trace
+	}
+}
+
 // Run executes the configured simulation under the mode named by the config's
 // run: block. The default (empty or "batch") preserves pre-run:-tier behaviour:
 // serve a websocket when a socket config is active, otherwise run once to
 // completion offline. "ensemble" runs one seeded member per seed concurrently.
+// Any error is fatal; RunContext is the form that returns it.
 func Run(config *ApiRunConfig, socket *SocketConfig) {
+	if err := RunContext(context.Background(), config, socket); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// recoveredError turns a recovered panic value into an error with the given
+// prefix. An error value — a *simulator.SimulationError naming the partition
+// that failed, say — is wrapped rather than flattened, so errors.As still finds
+// it.
+func recoveredError(prefix string, r any) error {
+	if err, ok := r.(error); ok {
+		return fmt.Errorf("%s%w", prefix, err)
+	}
+	return fmt.Errorf("%s%v", prefix, r)
+}
+
+// RunContext is Run for callers that embed the engine in a long-lived process.
+// Once ctx is cancelled or past its deadline the run stops at its next step
+// boundary, finalizes its output function and returns ctx.Err(); a served
+// websocket is shut down with its live runs. Configuration failures that the
+// load and generation paths raise as panics — an expressions: entry naming no
+// partition, say — are returned as errors instead, as are the deadlock
+// pre-flight and an unknown run mode. A partition that panics mid-run is
+// returned as a *simulator.SimulationError.
+func RunContext(
+	ctx context.Context,
+	config *ApiRunConfig,
+	socket *SocketConfig,
+) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recoveredError("api: ", r)
+		}
+	}()
 	// The macros: tier is its own run context — build storage, expand macros, run
 	// them against storage, emit the result — with no main partitions or coordinator.
 	if len(config.Macros) > 0 {
-		storage, err := runMacros(config)
+		storage, err := runMacros(ctx, config)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 		printStorage(storage)
-		return
+		return nil
 	}
 	generator := config.GetConfigGenerator()
 	if err := CheckForDeadlock(generator); err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if config.Run.Profile != "" && (config.Run.Mode == "ensemble" || socket.Active()) {
+		return fmt.Errorf("api: run.profile is only supported for offline batch runs")
 	}
 	switch config.Run.Mode {
 	case "", "batch":
-		runBatch(generator, socket)
+		return runBatch(ctx, generator, socket, config.Run.Profile)
 	case "ensemble":
-		if err := runEnsemble(config, generator.GetSimulation()); err != nil {
-			log.Fatal(err)
-		}
+		return runEnsemble(ctx, config, generator.GetSimulation())
 	default:
-		log.Fatalf(
+		return fmt.Errorf(
 			"api: unknown run mode %q — expected \"batch\" or \"ensemble\"",
 			config.Run.Mode,
 		)
@@ -128,21 +153,67 @@ func Run(config *ApiRunConfig, socket *SocketConfig) {
 }
 
 // runBatch serves a websocket when the socket is active, otherwise runs the
-// simulation once to completion.
-func runBatch(generator *simulator.ConfigGenerator, socket *SocketConfig) {
+// simulation once to completion, profiling it into the profile path if one is
+// given.
+func runBatch(
+	ctx context.Context,
+	generator *simulator.ConfigGenerator,
+	socket *SocketConfig,
+	profile string,
+) error {
 	if socket.Active() {
-		StepAndServeWebsocket(
-			generator,
-			time.Duration(socket.MillisecondDelay),
+		mux := http.NewServeMux()
+		mux.HandleFunc(
 			socket.Handle,
-			socket.Address,
+			NewLiveRunHandler(
+				generator,
+				time.Duration(socket.MillisecondDelay)*time.Millisecond,
+				socket.StartPaused,
+			),
 		)
-		return
+		// request contexts derive from ctx, so cancelling it ends live runs too
+		server := &http.Server{
+			Addr:        socket.Address,
+			Handler:     mux,
+			BaseContext: func(net.Listener) context.Context { return ctx },
+		}
+		stop := context.AfterFunc(ctx, func() { server.Close() })
+		defer stop()
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return ctx.Err()
 	}
 	coordinator := simulator.NewPartitionCoordinator(
 		generator.GenerateConfigs(),
 	)
-	coordinator.Run()
+	if profile == "" {
+		return coordinator.RunContext(ctx)
+	}
+	profiler := coordinator.Profile()
+	err := coordinator.RunContext(ctx)
+	if profileErr := writeProfile(profiler, profile); profileErr != nil {
+		return errors.Join(err, profileErr)
+	}
+	return err
+}
+
+// writeProfile writes the profiler's Chrome trace to path and its summary to
+// stderr. A failed or cancelled run is still worth profiling up to where it
+// stopped, so it is written either way.
+func writeProfile(profiler *simulator.Profiler, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("api: writing profile: %w", err)
+	}
+	if err := profiler.WriteChromeTrace(file); err != nil {
+		file.Close()
+		return fmt.Errorf("api: writing profile: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("api: writing profile: %w", err)
+	}
+	return profiler.WriteSummary(os.Stderr)
 }
 
 // RunEnsembleToStorage runs the config's ensemble (run: {mode: ensemble}) and returns
@@ -170,12 +241,12 @@ func RunEnsembleToStorage(
 	if err := CheckForDeadlock(generator); err != nil {
 		return nil, err
 	}
-	return ensembleRuns(config, generator.GetSimulation())
+	return ensembleRuns(context.Background(), config, generator.GetSimulation())
 }
 
 // runEnsemble runs one member per configured seed via simulator.RunSeededEnsemble
-// and writes each member's recorded trajectory to stdout, prefixed with its member
-// index and seed.
+// (or simulator.RunBatchedEnsemble when run.batched is set) and writes each
+// member's recorded trajectory to stdout, prefixed with its member index and seed.
 //
 // Members are rebuilt by re-loading the source file so each gets fresh, non-shared
 // iteration instances (required by RunSeededEnsemble). Re-loading resolves the whole
@@ -183,10 +254,11 @@ func RunEnsembleToStorage(
 // self-contained; the resolved sim is passed in only to share the (stateless)
 // components rather than re-resolve them per member.
 func runEnsemble(
+	ctx context.Context,
 	config *ApiRunConfig,
 	resolvedSim *simulator.SimulationConfig,
 ) error {
-	runs, err := ensembleRuns(config, resolvedSim)
+	runs, err := ensembleRuns(ctx, config, resolvedSim)
 	if err != nil {
 		return err
 	}
@@ -198,6 +270,7 @@ func runEnsemble(
 // configured seed, returning the recorded members. It performs no output, so it
 // is the testable core of runEnsemble.
 func ensembleRuns(
+	ctx context.Context,
 	config *ApiRunConfig,
 	resolvedSim *simulator.SimulationConfig,
 ) ([]simulator.EnsembleRun, error) {
@@ -225,9 +298,12 @@ func ensembleRuns(
 		generator.SetSimulation(&simCopy)
 		return generator
 	}
-	return simulator.RunSeededEnsemble(
-		build, config.Run.Seeds, config.Run.Concurrency,
-	), nil
+	if config.Run.Batched {
+		return simulator.RunBatchedEnsembleContext(ctx, build, config.Run.Seeds)
+	}
+	return simulator.RunSeededEnsembleContext(
+		ctx, build, config.Run.Seeds, config.Run.Concurrency,
+	)
 }
 
 // assertDataOnly reports an error unless every main partition has an iteration
@@ -285,8 +361,9 @@ func RunWithParsedArgs(args ParsedArgs) {
 	// when the orchestrator supplies it, the exact image) that produced it.
 	LogRunProvenance(os.Stderr)
 
-	Run(
-		LoadApiRunConfigFromYaml(args.ConfigFile),
-		LoadSocketConfigFromYaml(args.SocketFile),
-	)
+	config := LoadApiRunConfigFromYaml(args.ConfigFile)
+	if args.ProfileFile != "" {
+		config.Run.Profile = args.ProfileFile
+	}
+	Run(config, LoadSocketConfigFromYaml(args.SocketFile))
 }
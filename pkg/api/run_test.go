@@ -1,8 +1,13 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -104,6 +109,36 @@ func TestCheckForDeadlock(t *testing.T) {
 		}
 	})
 
+	t.Run("a mutual dependency broken by a lagged params_from_upstream passes", func(t *testing.T) {
+		gen := genFrom(
+			&simulator.PartitionConfig{
+				Name:              "prey",
+				InitStateValues:   []float64{0.0},
+				StateHistoryDepth: 1,
+				ParamsFromUpstream: map[string]simulator.NamedUpstreamConfig{
+					"pred_val": {Upstream: "predator", Lag: 1},
+				},
+			},
+			deadlockPartition("predator", map[string]simulator.NamedUpstreamConfig{
+				"prey_val": {Upstream: "prey"},
+			}),
+		)
+		if err := CheckForDeadlock(gen); err != nil {
+			t.Errorf("a cycle broken by a lagged inject should pass, got: %v", err)
+		}
+	})
+
+	t.Run("the deadlock error suggests a lag", func(t *testing.T) {
+		gen := genFrom(
+			deadlockPartition("a", map[string]simulator.NamedUpstreamConfig{"x": {Upstream: "b"}}),
+			deadlockPartition("b", map[string]simulator.NamedUpstreamConfig{"y": {Upstream: "a"}}),
+		)
+		err := CheckForDeadlock(gen)
+		if err == nil || !strings.Contains(err.Error(), "lag: 1") {
+			t.Errorf("expected the deadlock error to suggest lag: 1, got: %v", err)
+		}
+	})
+
 	t.Run("a mutual dependency broken by a lag-1 read passes", func(t *testing.T) {
 		// predator reads prey within-step; prey reads predator via a state-history
 		// read (params_as_partitions), which is lag-1 and so breaks the cycle.
@@ -180,7 +215,7 @@ func TestRunModeParsing(t *testing.T) {
 func TestEnsembleRuns(t *testing.T) {
 	t.Run("one member per seed, trajectories vary by seed", func(t *testing.T) {
 		config := writeConfig(t, dataOnlyEnsembleYAML)
-		runs, err := ensembleRuns(config, testSim())
+		runs, err := ensembleRuns(context.Background(), config, testSim())
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -205,11 +240,11 @@ func TestEnsembleRuns(t *testing.T) {
 
 	t.Run("deterministic across repeated runs", func(t *testing.T) {
 		config := writeConfig(t, dataOnlyEnsembleYAML)
-		first, err := ensembleRuns(config, testSim())
+		first, err := ensembleRuns(context.Background(), config, testSim())
 		if err != nil {
 			t.Fatal(err)
 		}
-		second, err := ensembleRuns(config, testSim())
+		second, err := ensembleRuns(context.Background(), config, testSim())
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -222,17 +257,36 @@ func TestEnsembleRuns(t *testing.T) {
 		}
 	})
 
+	t.Run("batched members match concurrent ones", func(t *testing.T) {
+		config := writeConfig(t, dataOnlyEnsembleYAML)
+		concurrent, err := ensembleRuns(context.Background(), config, testSim())
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.Run.Batched = true
+		batched, err := ensembleRuns(context.Background(), config, testSim())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range concurrent {
+			if !reflect.DeepEqual(concurrent[i].Storage.GetValues("growth"),
+				batched[i].Storage.GetValues("growth")) {
+				t.Errorf("member %d differs when batched", i)
+			}
+		}
+	})
+
 	t.Run("empty seeds is rejected", func(t *testing.T) {
 		config := writeConfig(t, dataOnlyEnsembleYAML)
 		config.Run.Seeds = nil
-		if _, err := ensembleRuns(config, testSim()); err == nil {
+		if _, err := ensembleRuns(context.Background(), config, testSim()); err == nil {
 			t.Error("expected an error for empty run.seeds")
 		}
 	})
 
 	t.Run("in-memory config (no source path) is rejected", func(t *testing.T) {
 		config := &ApiRunConfig{Run: RunModeConfig{Mode: "ensemble", Seeds: []uint64{1}}}
-		if _, err := ensembleRuns(config, testSim()); err == nil {
+		if _, err := ensembleRuns(context.Background(), config, testSim()); err == nil {
 			t.Error("expected an error when sourcePath is empty")
 		}
 	})
@@ -297,7 +351,7 @@ func TestRunEnsembleToStorage(t *testing.T) {
 		}
 		// Resolve the simulation the same way the exported path does, so the two
 		// share identical inputs — the wrapper must add nothing but the resolution.
-		internal, err := ensembleRuns(config, config.GetConfigGenerator().GetSimulation())
+		internal, err := ensembleRuns(context.Background(), config, config.GetConfigGenerator().GetSimulation())
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -391,3 +445,224 @@ func TestFullyDataResolution(t *testing.T) {
 		}
 	})
 }
+
+// TestLaggedUpstreamFromYaml runs a predator-prey pair coupled both ways through
+// params_from_upstream, with the prey's read of the predator lagged by one step,
+// and checks each step against the explicit recurrence.
+func TestLaggedUpstreamFromYaml(t *testing.T) {
+	const config = `main:
+  partitions:
+  - name: prey
+    iteration:
+      type: expression
+      fields: [{name: x, width: 1}]
+      outputs: ["x * (1.1 - 0.02 * pred)"]
+    params: {}
+    params_from_upstream:
+      pred: {upstream: predator, lag: 1}
+    init_state_values: [10.0]
+    state_history_depth: 1
+    seed: 0
+  - name: predator
+    iteration:
+      type: expression
+      fields: [{name: z, width: 1}]
+      outputs: ["z * (0.9 + 0.01 * prey)"]
+    params: {}
+    params_from_upstream:
+      prey: {upstream: prey}
+    init_state_values: [5.0]
+    state_history_depth: 1
+    seed: 0
+  simulation:
+    output_condition: {type: every_step}
+    output_function: {type: nil}
+    termination_condition: {type: number_of_steps, max_steps: 10}
+    timestep_function: {type: constant, stepsize: 1.0}
+    init_time_value: 0.0
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	generator := LoadApiRunConfigFromYaml(path).GetConfigGenerator()
+	if err := CheckForDeadlock(generator); err != nil {
+		t.Fatalf("a lagged cycle should pass the deadlock pre-flight: %v", err)
+	}
+	store := simulator.NewStateTimeStorage()
+	sim := generator.GetSimulation()
+	sim.OutputFunction = &simulator.StateTimeStorageOutputFunction{Store: store}
+	generator.SetSimulation(sim)
+	simulator.NewPartitionCoordinator(generator.GenerateConfigs()).Run()
+
+	x, y := 10.0, 5.0
+	prey := store.GetValues("prey")
+	predator := store.GetValues("predator")
+	for n := 1; n < len(prey); n++ {
+		x = x * (1.1 - 0.02*y)
+		y = y * (0.9 + 0.01*x)
+		if math.Abs(prey[n][0]-x) > 1e-9 || math.Abs(predator[n][0]-y) > 1e-9 {
+			t.Fatalf("step %d = (%v, %v), want (%v, %v)",
+				n, prey[n][0], predator[n][0], x, y)
+		}
+	}
+}
+
+// batchYAML is a small fully-data batch run; %s is spliced into its
+// expressions: list so a test can add a bad entry.
+const batchYAML = `main:
+  partitions:
+  - name: walk
+    params: {drift: [1.0]}
+    init_state_values: [0.0]
+    state_history_depth: 1
+  expressions:
+  - partition: walk
+    fields: [{name: x}]
+    outputs: ["x + drift * dt"]
+%s  simulation:
+    output_condition: {type: every_step}
+    output_function: {type: nil}
+    termination_condition: {type: number_of_steps, max_steps: 1000}
+    timestep_function: {type: constant, stepsize: 1.0}
+    init_time_value: 0.0
+`
+
+func TestRunContext(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	t.Run("a config error is returned, not panicked", func(t *testing.T) {
+		config := writeConfig(t, fmt.Sprintf(batchYAML, `  - partition: ghost
+    fields: [{name: x}]
+    outputs: ["x"]
+`))
+		err := RunContext(context.Background(), config, &SocketConfig{})
+		if err == nil || !strings.Contains(err.Error(), "ghost") {
+			t.Fatalf("expected an error naming the unknown partition, got %v", err)
+		}
+	})
+
+	t.Run("a partition panicking mid-run is returned as a SimulationError", func(t *testing.T) {
+		// drift has width 1, so indexing it by x fails once x reaches 1
+		config := writeConfig(t, strings.Replace(fmt.Sprintf(batchYAML, ""),
+			`"x + drift * dt"`, `"x + drift[x]"`, 1))
+		err := RunContext(context.Background(), config, &SocketConfig{})
+		var failure *simulator.SimulationError
+		if !errors.As(err, &failure) || failure.PartitionName != "walk" ||
+			failure.Step != 2 || !strings.Contains(err.Error(), "out of range") {
+			t.Fatalf("expected a SimulationError for walk at step 2, got %v", err)
+		}
+	})
+
+	t.Run("an unknown run mode is returned", func(t *testing.T) {
+		config := writeConfig(t, fmt.Sprintf(batchYAML, ""))
+		config.Run.Mode = "sweep"
+		err := RunContext(context.Background(), config, &SocketConfig{})
+		if err == nil || !strings.Contains(err.Error(), "unknown run mode") {
+			t.Fatalf("expected an unknown run mode error, got %v", err)
+		}
+	})
+
+	t.Run("batch runs to completion or stops on cancel", func(t *testing.T) {
+		config := writeConfig(t, fmt.Sprintf(batchYAML, ""))
+		if err := RunContext(context.Background(), config, &SocketConfig{}); err != nil {
+			t.Fatal(err)
+		}
+		config = writeConfig(t, fmt.Sprintf(batchYAML, ""))
+		if err := RunContext(cancelled, config, &SocketConfig{}); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	})
+
+	t.Run("ensemble stops on cancel", func(t *testing.T) {
+		config := writeConfig(t, fullyDataEnsembleYAML)
+		if err := RunContext(cancelled, config, &SocketConfig{}); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	})
+
+	t.Run("macros stop on cancel", func(t *testing.T) {
+		config := writeConfig(t, macroConfigYAML)
+		storage, err := RunMacrosContext(cancelled, config)
+		if !errors.Is(err, context.Canceled) || storage != nil {
+			t.Fatalf("expected context.Canceled and no storage, got %v", err)
+		}
+	})
+}
+
+func TestNonFiniteCheckTracesDownstream(t *testing.T) {
+	// walk goes NaN once t reaches 3; scaled consumes it within the step and
+	// tail reads scaled a step later
+	config := writeConfig(t, `main:
+  partitions:
+  - name: walk
+    init_state_values: [0.0]
+    state_history_depth: 1
+  - name: scaled
+    params_from_upstream: {in: {upstream: walk}}
+    init_state_values: [0.0]
+    state_history_depth: 1
+  - name: tail
+    params_from_upstream: {in: {upstream: scaled, lag: 1}}
+    init_state_values: [0.0]
+    state_history_depth: 1
+  expressions:
+  - partition: walk
+    fields: [{name: x}]
+    outputs: ["sqrt(2 - t)"]
+  - partition: scaled
+    fields: [{name: y}]
+    outputs: ["2 * in"]
+  - partition: tail
+    fields: [{name: z}]
+    outputs: ["in"]
+  simulation:
+    output_condition: {type: every_step}
+    output_function: {type: nil}
+    termination_condition: {type: number_of_steps, max_steps: 10}
+    timestep_function: {type: constant, stepsize: 1.0}
+    init_time_value: 0.0
+    non_finite_check: halt
+`)
+	err := RunContext(context.Background(), config, &SocketConfig{})
+	var nonFinite *simulator.NonFiniteError
+	if !errors.As(err, &nonFinite) {
+		t.Fatalf("expected a NonFiniteError, got %v", err)
+	}
+	want := []string{
+		"walk -> scaled (in, params_inject)",
+		"scaled -> tail (in, lagged_inject)",
+	}
+	if nonFinite.PartitionName != "walk" || nonFinite.Step != 4 ||
+		!reflect.DeepEqual(nonFinite.Downstream, want) {
+		t.Errorf("unexpected report: %v", err)
+	}
+	if config.Main.Simulation.NonFiniteTrace != nil {
+		t.Error("building the generator wrote the trace into the config")
+	}
+}
+
+func TestRunProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.json")
+	config := writeConfig(t, fmt.Sprintf(batchYAML, ""))
+	config.Run.Profile = path
+	if err := RunContext(context.Background(), config, &SocketConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"traceEvents"`) ||
+		!strings.Contains(string(data), `"walk"`) {
+		t.Errorf("unexpected trace: %.200s", data)
+	}
+
+	config = writeConfig(t, fullyDataEnsembleYAML)
+	config.Run.Profile = path
+	err = RunContext(context.Background(), config, &SocketConfig{})
+	if err == nil || !strings.Contains(err.Error(), "batch") {
+		t.Errorf("expected profiling an ensemble to be rejected, got %v", err)
+	}
+}
@@ -8,11 +8,13 @@ import (
 )
 
 // SocketConfig configures an optional real-time websocket used to stream
-// simulation updates.
+// simulation updates. StartPaused holds the run before its first step until a
+// client sends a RESUME or STEP control message.
 type SocketConfig struct {
 	Address          string `yaml:"address"`
 	Handle           string `yaml:"handle"`
 	MillisecondDelay uint64 `yaml:"millisecond_delay"`
+	StartPaused      bool   `yaml:"start_paused,omitempty"`
 }
 
 // Active reports whether the websocket server should be started.
@@ -50,6 +50,8 @@ import (
 //   - O(d) time complexity where d is the number of dimensions
 //   - Memory usage: O(1) per dimension
 //   - Efficient for high-dimensional simulations
+//   - Implements simulator.BatchIteration, so a batched ensemble advances
+//     every member in one call
 type WienerProcessIteration struct {
 	sampler *rng.Sampler
 }
@@ -77,3 +79,18 @@ func (w *WienerProcessIteration) Iterate(
 	}
 	return values
 }
+
+// IterateBatch advances every member of a batched ensemble, drawing from each
+// member's own sampler in the same order as Iterate.
+func (w *WienerProcessIteration) IterateBatch(batch *simulator.IterationBatch) {
+	for _, m := range batch.Members {
+		sampler := batch.Iterations[m].(*WienerProcessIteration).sampler
+		variances := batch.Params[m].Get("variances")
+		dt := batch.TimestepsHistories[m].NextIncrement
+		values := batch.NextState(m)
+		copy(values, batch.State(m))
+		for i := range values {
+			values[i] += math.Sqrt(variances[i]*dt) * sampler.NormFloat64()
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package continuous
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/umbralcalc/stochadex/pkg/simulator"
@@ -58,4 +59,39 @@ func TestWienerProcess(t *testing.T) {
 			}
 		},
 	)
+	t.Run(
+		"test that the batched Wiener process matches per-member runs",
+		func(t *testing.T) {
+			build := func() *simulator.ConfigGenerator {
+				generator := simulator.NewConfigGenerator()
+				generator.SetSimulation(&simulator.SimulationConfig{
+					OutputCondition: &simulator.EveryStepOutputCondition{},
+					OutputFunction:  &simulator.NilOutputFunction{},
+					TerminationCondition: &simulator.NumberOfStepsTerminationCondition{
+						MaxNumberOfSteps: 50,
+					},
+					TimestepFunction: &simulator.ConstantTimestepFunction{Stepsize: 0.5},
+				})
+				generator.SetPartition(&simulator.PartitionConfig{
+					Name:      "walk",
+					Iteration: &WienerProcessIteration{},
+					Params: simulator.NewParams(map[string][]float64{
+						"variances": {1.0, 2.0},
+					}),
+					InitStateValues:   []float64{0.45, -0.13},
+					StateHistoryDepth: 2,
+				})
+				return generator
+			}
+			seeds := []uint64{3, 5, 7, 11}
+			expected := simulator.RunSeededEnsemble(build, seeds, 2)
+			runs := simulator.RunBatchedEnsemble(build, seeds)
+			for i := range seeds {
+				if !reflect.DeepEqual(expected[i].Storage.GetValues("walk"),
+					runs[i].Storage.GetValues("walk")) {
+					t.Errorf("member %d differs when batched", i)
+				}
+			}
+		},
+	)
 }
@@ -10,6 +10,8 @@
 //   - Constant value generation and propagation
 //   - Cumulative computation utilities
 //   - Embedded simulation run support
+//   - Variable-population partitions whose entities spawn and retire at runtime
+//   - External-process partitions computed by a subprocess in another language
 //
 // Usage Patterns:
 //   - Create reusable iteration functions for common simulation patterns
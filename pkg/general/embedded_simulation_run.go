@@ -289,6 +289,12 @@ func (e *EmbeddedSimulationRunIteration) Iterate(
 	return e.concatBuffer
 }
 
+// Close closes the inner iterations that hold resources past a run, so the outer
+// run's end reaches them (see simulator.PartitionCoordinator.Close).
+func (e *EmbeddedSimulationRunIteration) Close() error {
+	return simulator.CloseIterations(e.implementations.Iterations)
+}
+
 // NewEmbeddedSimulationRunIteration constructs an embedded run iteration
 // from prepared settings and implementations.
 func NewEmbeddedSimulationRunIteration(
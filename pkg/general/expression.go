@@ -4,14 +4,12 @@ import (
 	"fmt"
 	"go/ast"
 	"go/parser"
-	"go/token"
 	"math"
 	"strconv"
 
-	"gonum.org/v1/gonum/stat/distuv"
-
 	"github.com/umbralcalc/stochadex/pkg/rng"
 	"github.com/umbralcalc/stochadex/pkg/simulator"
+	"github.com/umbralcalc/stochadex/pkg/spatial"
 )
 
 // ExpressionField names a contiguous block of a partition's state so that expressions can
@@ -21,8 +19,12 @@ import (
 type ExpressionField struct {
 	// Name is how expressions refer to this block.
 	Name string `yaml:"name"`
-	// Width is the number of state elements in the block, defaulting to 1.
+	// Width is the number of state elements in the block, defaulting to 1, or to rows * cols
+	// when Shape is given.
 	Width int `yaml:"width,omitempty"`
+	// Shape optionally makes the block a row-major [rows, cols] matrix, for the matrix
+	// functions.
+	Shape []int `yaml:"shape,omitempty"`
 }
 
 // ExpressionBinding is one named intermediate value in the evaluation DAG. Bindings are
@@ -45,17 +47,25 @@ type ExpressionBinding struct {
 //
 // Names available to expressions:
 //   - each of this partition's own fields, holding its current value;
-//   - each entry of the partition's params, by key;
+//   - each entry of the partition's params, by key, and then of its Tables;
 //   - each alias in Upstreams, holding that partition's current state (index it as alias[i]);
 //   - dt, the timestep increment; t, the current cumulative time; step, the step number;
 //   - pi;
 //   - any binding declared earlier.
 //
 // Functions: where, clamp, min, max, abs, floor, exp, log, sqrt, pow, sin, cos, erf, erfc,
-// fill, width, slice, concat, sum, dot, lag, each, scan, iid and shared, plus the draws normal,
-// uniform, exponential, poisson, gamma, beta and binomial. Draws take expressions as their
-// parameters, so compound sampling composes naturally: a negative-binomial branching step is
-// just poisson(gamma(shape, rate)).
+// fill, width, slice, concat, sum, dot, lag, each, scan, iid and shared, interp, bin_index and
+// interp2 (see below), sort, argsort, rank, argmax, argmin, topk, cumsum, quantile and gather
+// (see below), neighbours_sum and laplacian (given a Topology; see below), plus the
+// draws normal, uniform, exponential, poisson, gamma, beta and binomial. Draws take
+// expressions as their parameters, so compound sampling composes naturally: a
+// negative-binomial branching step is just poisson(gamma(shape, rate)).
+//
+// A wider catalogue adds negative_binomial, lognormal, student_t, weibull, truncated_normal,
+// categorical, multinomial, dirichlet and mvnormal, and every draw has a logpdf_ partner —
+// logpdf_poisson(counts, rates), say — so an expression can score data as well as simulate
+// it. The vector-valued draws give one sample of a distribution over vectors, and follow the
+// same width rule as the rest.
 //
 // sin and cos carry seasonality; erfc is the primitive a Gaussian CDF is built from, as
 // 0.5 * erfc(-x / sqrt(2)), which is what a probit link or a threshold-exceedance
@@ -143,9 +153,63 @@ type ExpressionBinding struct {
 // So x + normal(0, 1) over a 40-wide x is an error rather than quietly adding the same shock
 // to all forty elements. Draws with a vector parameter need no annotation.
 //
+// # Spatial coupling
+//
+// A partition whose state is one value per node of a network or grid can name a Topology
+// (see spatial.TopologySpec). neighbours_sum(x) is then Σ_j w_ij x_j and laplacian(x) is
+// Σ_j w_ij (x_j - x_i) at each node i, so a metapopulation's force of infection or a
+// diffusing field is one expression instead of hand-wired upstream indexing. x must have one
+// element per node, or be a scalar, which broadcasts to every node.
+//
+// # Functions
+//
+// A sub-expression used in several places can be named once in Functions and called like a
+// built-in: logistic(x) rather than 1 / (1 + exp(-x)) pasted into every binding that needs it.
+// Calls are inlined, and a function may not call itself, so functions add no recursion. See
+// ExpressionFunction.
+//
+// # Matrices
+//
+// A field with a Shape, or a param named in Matrices, is a row-major matrix to matmul,
+// transpose, outer, diag, solve, cholesky and inv, so a channels x covariates coefficient
+// block is multiplied into a design vector in one call rather than sliced row by row. It is
+// still an ordinary value to everything else.
+//
+// # Lookup tables
+//
+// interp(x, xs, ys) reads the piecewise curve through the knots (xs[i], ys[i]) at x — joined
+// by straight lines, or held flat between knots with interp(x, xs, ys, step), or joined by a
+// monotone cubic with interp(x, xs, ys, cubic) — so a tariff by hour or a rating curve is one
+// call rather than a chain of wheres. bin_index(x, edges) is the bin x falls in, and
+// interp2(x, y, xs, ys, zs) reads a grid bilinearly. The knots come from params, upstreams or
+// Tables, and outside them the end values hold.
+//
+// # Ordering
+//
+// sort, argsort, rank, argmax, argmin, topk(v, k), cumsum, quantile(v, q) and
+// gather(v, indices) reorder, rank or accumulate a whole value, for a prioritised allocation,
+// an order book's best levels or a quantile of the data. Ties always go to the earlier
+// element, so the order is deterministic, and quantile and gather are as wide as q and
+// indices.
+//
+// # Derivatives
+//
+// Everything but draws and a few functions is differentiable, so ExpressionGradientIteration
+// can output the gradient of an objective written here with respect to params or upstreams,
+// for gradient descent to follow. See ExpressionDerivative.
+//
 // This is deliberately not a general-purpose language: there is no assignment and no
 // recursion, and the only repetition is each's bounded comprehension, so an expression always
 // terminates.
+//
+// Expressions are parsed and compiled once, at Configure, into closures over buffers reused
+// from step to step, so a step neither walks a syntax tree nor allocates once its buffers are
+// sized. Compiling reports nothing early: an error still surfaces when its node runs, so a
+// malformed branch that is never taken is as harmless as it always was.
+//
+// Check is where errors are reported early. It infers widths from the partition's config
+// rather than running anything, so it sees every branch. A config loaded through pkg/api runs
+// it on every expression partition and refuses to load if it finds anything.
 type ExpressionIteration struct {
 	// Fields names the blocks of this partition's state, in layout order.
 	Fields []ExpressionField `yaml:"fields"`
@@ -156,14 +220,26 @@ type ExpressionIteration struct {
 	Bindings []ExpressionBinding `yaml:"bindings,omitempty"`
 	// Outputs holds one expression per entry of Fields, in the same order.
 	Outputs []string `yaml:"outputs"`
-
+	// Topology optionally gives the network or grid neighbours_sum and laplacian act over.
+	Topology *spatial.TopologySpec `yaml:"topology,omitempty"`
+	// Functions are user-defined functions the bindings and outputs can call. See
+	// ExpressionFunction.
+	Functions []ExpressionFunction `yaml:"functions,omitempty"`
+	// Matrices declares the params, tables and upstream aliases that are row-major matrices,
+	// with their [rows, cols], for the matrix functions.
+	Matrices map[string][]int `yaml:"matrices,omitempty"`
+	// Tables are named constant values, such as the knots of a lookup table, written inline
+	// rather than as params. A param of the same name takes precedence.
+	Tables map[string][]float64 `yaml:"tables,omitempty"`
+
+	library        []ExpressionFunction
 	offsets        []int
 	width          int
 	upstreamIndex  map[string]int
 	fieldIndex     map[string]int
-	parsedBindings []parsedExprBinding
-	parsedOutputs  []ast.Expr
-	sampler        *rng.Sampler
+	program        *exprProgram
+	partitionIndex int
+	stateHistories []*simulator.StateHistory
 	out            []float64
 }
 
@@ -176,13 +252,16 @@ func (e *ExpressionIteration) fieldWidth(i int) int {
 	if w := e.Fields[i].Width; w != 0 {
 		return w
 	}
+	if shape := e.Fields[i].Shape; len(shape) == 2 {
+		return shape[0] * shape[1]
+	}
 	return 1
 }
 
 // Configure resolves the state layout, resolves upstream partition names to indices, parses
-// every expression once, and seeds the draw sampler from the partition's seed. It panics on a
-// malformed specification: a partition that cannot be built is a configuration error, not
-// something to discover mid-run.
+// and compiles every expression once, and seeds the draw sampler from the partition's seed. It
+// panics on a malformed specification: a partition that cannot be built is a configuration
+// error, not something to discover mid-run.
 func (e *ExpressionIteration) Configure(
 	partitionIndex int,
 	settings *simulator.Settings,
@@ -223,80 +302,77 @@ func (e *ExpressionIteration) Configure(
 		e.upstreamIndex[alias] = found
 	}
 
-	e.parsedBindings = make([]parsedExprBinding, 0, len(e.Bindings))
+	parsedBindings := make([]parsedExprBinding, 0, len(e.Bindings))
 	for _, b := range e.Bindings {
 		parsed, err := parser.ParseExpr(b.Expr)
 		if err != nil {
 			panic("expression: parsing binding " + b.Name + ": " + err.Error())
 		}
-		e.parsedBindings = append(e.parsedBindings, parsedExprBinding{b.Name, parsed})
+		parsedBindings = append(parsedBindings, parsedExprBinding{b.Name, parsed})
 	}
-	e.parsedOutputs = make([]ast.Expr, len(e.Outputs))
+	parsedOutputs := make([]ast.Expr, len(e.Outputs))
 	for i, o := range e.Outputs {
 		parsed, err := parser.ParseExpr(o)
 		if err != nil {
 			panic("expression: parsing output for field " +
 				e.Fields[i].Name + ": " + err.Error())
 		}
-		e.parsedOutputs[i] = parsed
+		parsedOutputs[i] = parsed
 	}
 
-	e.sampler = rng.New(settings.Iterations[partitionIndex].Seed)
+	functions, issues := e.parseExprFunctions()
+	matrices, matrixIssues := e.matrixShapes()
+	if issues = append(issues, matrixIssues...); len(issues) > 0 {
+		panic("expression: " + issues[0].Where + ": " + issues[0].Message)
+	}
+	e.program = compileExprProgram(parsedBindings, parsedOutputs, functions, matrices)
+	for i := range e.program.globals {
+		g := &e.program.globals[i]
+		switch g.name {
+		case "dt", "t", "step":
+			g.fixed = exprValue{0}
+		case "pi":
+			g.fixed = exprValue{math.Pi}
+		}
+		if index, ok := e.upstreamIndex[g.name]; ok {
+			g.upstream = index
+		}
+		if index, ok := e.fieldIndex[g.name]; ok {
+			g.field = index
+		}
+	}
+	if e.Topology != nil {
+		topology, err := e.Topology.Build()
+		if err != nil {
+			panic("expression: topology: " + err.Error())
+		}
+		e.program.topology = topology
+	}
+	e.program.sampler = rng.New(settings.Iterations[partitionIndex].Seed)
+	e.program.lag = e.lag
 }
 
-// Iterate evaluates the bindings in order and then each field's output expression,
-// concatenating the results into the next state.
+// Iterate reads this step's fields, params, upstreams and clock into the compiled program,
+// runs the bindings in order and then each field's output, and concatenates the results into
+// the next state.
 func (e *ExpressionIteration) Iterate(
 	params *simulator.Params,
 	partitionIndex int,
 	stateHistories []*simulator.StateHistory,
 	timestepsHistory *simulator.CumulativeTimestepsHistory,
 ) []float64 {
-	env := make(exprEnv, len(e.Fields)+len(params.Map)+len(e.upstreamIndex)+3)
+	e.partitionIndex, e.stateHistories = partitionIndex, stateHistories
 	state := stateHistories[partitionIndex].Values.RawRowView(0)
-	for i, f := range e.Fields {
-		env[f.Name] = exprValue(state[e.offsets[i] : e.offsets[i]+e.fieldWidth(i)])
-	}
-	for name, values := range params.Map {
-		env[name] = exprValue(values)
-	}
-	for alias, index := range e.upstreamIndex {
-		env[alias] = exprValue(stateHistories[index].Values.RawRowView(0))
-	}
-	env["dt"] = exprValue{timestepsHistory.NextIncrement}
-	env["t"] = exprValue{timestepsHistory.Values.AtVec(0)}
-	env["step"] = exprValue{float64(timestepsHistory.CurrentStepNumber)}
-	env["pi"] = exprValue{math.Pi}
-
-	// Resolved lazily rather than copied into env like the current row: a partition may hold
-	// a deep history, and almost no expression reads past row 0.
-	lag := func(name string, row int) exprValue {
-		read := func(index int, from, width int) exprValue {
-			history := stateHistories[index]
-			if row < 0 || row >= history.StateHistoryDepth {
-				panic(fmt.Sprintf(
-					"expression: lag(%s, %d) is outside the %d rows %s keeps; raise its "+
-						"state_history_depth", name, row, history.StateHistoryDepth, name))
-			}
-			return exprValue(history.Values.RawRowView(row)[from : from+width])
-		}
-		if index, ok := e.upstreamIndex[name]; ok {
-			return read(index, 0, stateHistories[index].StateWidth)
-		}
-		if i, ok := e.fieldIndex[name]; ok {
-			return read(partitionIndex, e.offsets[i], e.fieldWidth(i))
-		}
-		panic("expression: lag needs an upstream alias or one of this partition's own " +
-			"fields, got " + name)
+	p := e.program
+	for _, g := range p.globals {
+		p.slots[g.slot] = e.global(g, params, state, timestepsHistory)
 	}
-
-	ctx := &exprCtx{env: env, sampler: e.sampler, lag: lag}
-	for _, b := range e.parsedBindings {
-		env[b.name] = ctx.eval(b.expr)
+	for _, b := range p.bindings {
+		p.slots[b.slot] = b.code()
 	}
-	for i, o := range e.parsedOutputs {
+	for i, o := range p.outputs {
 		w := e.fieldWidth(i)
-		v := ctx.eval(o)
+		v := o()
 		switch len(v) {
 		case w:
 			copy(e.out[e.offsets[i]:], v)
@@ -313,41 +389,76 @@ func (e *ExpressionIteration) Iterate(
 	return e.out
 }
 
-// exprValue is the single value type: a vector, where length 1 means a scalar and broadcasts
-// against any other length.
-type exprValue []float64
-
-type exprEnv map[string]exprValue
-
-// exprCtx carries the evaluation environment. drawsAreExplicit records whether evaluation is
-// inside an iid, shared or each call, which is where a scalar-parameter draw is unambiguous.
-type exprCtx struct {
-	env              exprEnv
-	sampler          *rng.Sampler
-	lag              func(name string, row int) exprValue
-	drawsAreExplicit bool
-}
-
-func (c *exprCtx) explicit() *exprCtx {
-	return &exprCtx{env: c.env, sampler: c.sampler, lag: c.lag, drawsAreExplicit: true}
+// global is what a name no binding declares means this step, or nil if it means nothing. The
+// clock shadows upstream aliases, which shadow params, which shadow tables, which shadow this
+// partition's fields.
+func (e *ExpressionIteration) global(
+	g exprGlobal,
+	params *simulator.Params,
+	state []float64,
+	timestepsHistory *simulator.CumulativeTimestepsHistory,
+) exprValue {
+	switch g.name {
+	case "dt":
+		g.fixed[0] = timestepsHistory.NextIncrement
+		return g.fixed
+	case "t":
+		g.fixed[0] = timestepsHistory.Values.AtVec(0)
+		return g.fixed
+	case "step":
+		g.fixed[0] = float64(timestepsHistory.CurrentStepNumber)
+		return g.fixed
+	case "pi":
+		return g.fixed
+	}
+	if g.upstream >= 0 {
+		return exprValue(e.stateHistories[g.upstream].Values.RawRowView(0))
+	}
+	if values, ok := params.Map[g.name]; ok {
+		if values == nil {
+			return exprValue{}
+		}
+		return exprValue(values)
+	}
+	if values, ok := e.Tables[g.name]; ok {
+		if values == nil {
+			return exprValue{}
+		}
+		return exprValue(values)
+	}
+	if g.field >= 0 {
+		return exprValue(state[e.offsets[g.field] : e.offsets[g.field]+e.fieldWidth(g.field)])
+	}
+	return nil
 }
 
-// bind reserves a name for a comprehension to write its lane index or accumulator into, and
-// returns the undo. The environment is shared with the enclosing scope rather than nested, so
-// a binding that outlived its loop would leak into the next expression — and, because the same
-// iteration is reused every step, into the next step. Call it before the loop and defer the
-// result, so the name is restored (or removed, if it was never there) on the panicking path too.
-func (c *exprCtx) bind(name string) func() {
-	shadowed, wasBound := c.env[name]
-	return func() {
-		if wasBound {
-			c.env[name] = shadowed
-		} else {
-			delete(c.env, name)
+// lag reads a partition's committed state row rows back. It is resolved on demand rather than
+// read in with the current row: a partition may hold a deep history, and almost no expression
+// reads past row 0.
+func (e *ExpressionIteration) lag(name string, row int) exprValue {
+	read := func(index int, from, width int) exprValue {
+		history := e.stateHistories[index]
+		if row < 0 || row >= history.StateHistoryDepth {
+			panic(fmt.Sprintf(
+				"expression: lag(%s, %d) is outside the %d rows %s keeps; raise its "+
+					"state_history_depth", name, row, history.StateHistoryDepth, name))
 		}
+		return exprValue(history.Values.RawRowView(row)[from : from+width])
+	}
+	if index, ok := e.upstreamIndex[name]; ok {
+		return read(index, 0, e.stateHistories[index].StateWidth)
+	}
+	if i, ok := e.fieldIndex[name]; ok {
+		return read(e.partitionIndex, e.offsets[i], e.fieldWidth(i))
 	}
+	panic("expression: lag needs an upstream alias or one of this partition's own " +
+		"fields, got " + name)
 }
 
+// exprValue is the single value type: a vector, where length 1 means a scalar and broadcasts
+// against any other length.
+type exprValue []float64
+
 func exprBool(b bool) float64 {
 	if b {
 		return 1
@@ -357,15 +468,19 @@ func exprBool(b bool) float64 {
 
 // broadcastLen returns the result length for combining a and b, or panics on a mismatch.
 func broadcastLen(a, b exprValue, what string) int {
+	return broadcastWidth(len(a), len(b), what)
+}
+
+func broadcastWidth(a, b int, what string) int {
 	switch {
-	case len(a) == len(b):
-		return len(a)
-	case len(a) == 1:
-		return len(b)
-	case len(b) == 1:
-		return len(a)
+	case a == b:
+		return a
+	case a == 1:
+		return b
+	case b == 1:
+		return a
 	}
-	panic(fmt.Sprintf("expression: cannot combine widths %d and %d in %s", len(a), len(b), what))
+	panic(fmt.Sprintf("expression: cannot combine widths %d and %d in %s", a, b, what))
 }
 
 // toIndex converts a computed index or count to an int, rejecting the values Go leaves
@@ -386,510 +501,3 @@ func at(v exprValue, i int) float64 {
 	}
 	return v[i]
 }
-
-func zipExpr(a, b exprValue, what string, f func(x, y float64) float64) exprValue {
-	n := broadcastLen(a, b, what)
-	out := make(exprValue, n)
-	for i := 0; i < n; i++ {
-		out[i] = f(at(a, i), at(b, i))
-	}
-	return out
-}
-
-func mapExpr(a exprValue, f func(x float64) float64) exprValue {
-	out := make(exprValue, len(a))
-	for i, x := range a {
-		out[i] = f(x)
-	}
-	return out
-}
-
-func (c *exprCtx) eval(node ast.Expr) exprValue {
-	switch n := node.(type) {
-	case *ast.BasicLit:
-		v, err := strconv.ParseFloat(n.Value, 64)
-		if err != nil {
-			panic("expression: bad numeric literal " + n.Value)
-		}
-		return exprValue{v}
-	case *ast.Ident:
-		v, ok := c.env[n.Name]
-		if !ok {
-			panic("expression: unknown name " + n.Name)
-		}
-		return v
-	case *ast.ParenExpr:
-		return c.eval(n.X)
-	case *ast.UnaryExpr:
-		v := c.eval(n.X)
-		switch n.Op {
-		case token.SUB:
-			return mapExpr(v, func(x float64) float64 { return -x })
-		case token.ADD:
-			return v
-		case token.NOT:
-			return mapExpr(v, func(x float64) float64 { return exprBool(x == 0) })
-		}
-	case *ast.IndexExpr:
-		v := c.eval(n.X)
-		idx := c.eval(n.Index)
-		if len(idx) != 1 {
-			panic("expression: index must be a scalar")
-		}
-		i := toIndex(idx[0], "an index")
-		if i < 0 || i >= len(v) {
-			panic(fmt.Sprintf("expression: index %d out of range for width %d", i, len(v)))
-		}
-		return exprValue{v[i]}
-	case *ast.BinaryExpr:
-		return c.evalBinary(n)
-	case *ast.CallExpr:
-		return c.evalCall(n)
-	}
-	panic("expression: unsupported syntax")
-}
-
-func (c *exprCtx) evalBinary(n *ast.BinaryExpr) exprValue {
-	// && and || short-circuit only when the left side is a scalar, matching where's rule.
-	if n.Op == token.LAND || n.Op == token.LOR {
-		l := c.eval(n.X)
-		if len(l) == 1 {
-			if n.Op == token.LAND && l[0] == 0 {
-				return exprValue{0}
-			}
-			if n.Op == token.LOR && l[0] != 0 {
-				return exprValue{1}
-			}
-			return mapExpr(c.eval(n.Y), func(y float64) float64 { return exprBool(y != 0) })
-		}
-		r := c.eval(n.Y)
-		if n.Op == token.LAND {
-			return zipExpr(l, r, "&&", func(x, y float64) float64 {
-				return exprBool(x != 0 && y != 0)
-			})
-		}
-		return zipExpr(l, r, "||", func(x, y float64) float64 {
-			return exprBool(x != 0 || y != 0)
-		})
-	}
-	l := c.eval(n.X)
-	r := c.eval(n.Y)
-	op := n.Op.String()
-	switch n.Op {
-	case token.ADD:
-		return zipExpr(l, r, op, func(x, y float64) float64 { return x + y })
-	case token.SUB:
-		return zipExpr(l, r, op, func(x, y float64) float64 { return x - y })
-	case token.MUL:
-		return zipExpr(l, r, op, func(x, y float64) float64 { return x * y })
-	case token.QUO:
-		return zipExpr(l, r, op, func(x, y float64) float64 { return x / y })
-	case token.REM:
-		return zipExpr(l, r, op, math.Mod)
-	case token.LSS:
-		return zipExpr(l, r, op, func(x, y float64) float64 { return exprBool(x < y) })
-	case token.GTR:
-		return zipExpr(l, r, op, func(x, y float64) float64 { return exprBool(x > y) })
-	case token.LEQ:
-		return zipExpr(l, r, op, func(x, y float64) float64 { return exprBool(x <= y) })
-	case token.GEQ:
-		return zipExpr(l, r, op, func(x, y float64) float64 { return exprBool(x >= y) })
-	case token.EQL:
-		return zipExpr(l, r, op, func(x, y float64) float64 { return exprBool(x == y) })
-	case token.NEQ:
-		return zipExpr(l, r, op, func(x, y float64) float64 { return exprBool(x != y) })
-	}
-	panic("expression: unsupported operator " + op)
-}
-
-func (c *exprCtx) evalCall(n *ast.CallExpr) exprValue {
-	ident, ok := n.Fun.(*ast.Ident)
-	if !ok {
-		panic("expression: unsupported call target")
-	}
-	name := ident.Name
-	need := func(k int) {
-		if len(n.Args) != k {
-			panic(fmt.Sprintf("expression: %s takes %d arguments, got %d", name, k, len(n.Args)))
-		}
-	}
-	arg := func(i int) exprValue { return c.eval(n.Args[i]) }
-
-	switch name {
-	case "where":
-		// Lazy on a scalar condition, so a guarded branch neither divides by zero nor
-		// consumes randomness.
-		need(3)
-		cond := arg(0)
-		if len(cond) == 1 {
-			if cond[0] != 0 {
-				return arg(1)
-			}
-			return arg(2)
-		}
-		// A vector condition selects elementwise, so each branch has to line up with it: the
-		// same width, or a scalar that broadcasts. where is the one place a mismatch was not
-		// caught, because it selects directly rather than going through broadcastLen, and it
-		// failed two ways depending on which side was short — a branch wider than the condition
-		// silently used its first len(cond) elements and dropped the rest, and a narrower one
-		// ran off the end as a bare Go index panic naming neither the function nor the widths.
-		// Both are answers to a question nobody asked; there is no reading of a width-5 branch
-		// under a width-3 condition that is what the author meant.
-		a, b := arg(1), arg(2)
-		for _, branch := range []struct {
-			which string
-			value exprValue
-		}{{"then", a}, {"else", b}} {
-			if len(branch.value) != len(cond) && len(branch.value) != 1 {
-				panic(fmt.Sprintf(
-					"expression: where's %s branch has width %d, which is neither the "+
-						"condition's %d nor 1", branch.which, len(branch.value), len(cond)))
-			}
-		}
-		out := make(exprValue, len(cond))
-		for i := range cond {
-			if cond[i] != 0 {
-				out[i] = at(a, i)
-			} else {
-				out[i] = at(b, i)
-			}
-		}
-		return out
-	case "iid":
-		// Evaluate the expression n times over, giving n independent samples.
-		need(2)
-		nv := arg(0)
-		if len(nv) != 1 {
-			panic("expression: iid's count must be a scalar")
-		}
-		count := toIndex(nv[0], "iid's count")
-		if count < 1 {
-			panic("expression: iid's count must be at least 1")
-		}
-		inner := c.explicit()
-		out := make(exprValue, count)
-		for i := 0; i < count; i++ {
-			v := inner.eval(n.Args[1])
-			if len(v) != 1 {
-				panic(fmt.Sprintf(
-					"expression: iid expects a scalar-valued expression, got width %d", len(v)))
-			}
-			out[i] = v[0]
-		}
-		return out
-	case "shared":
-		// One evaluation whose result may broadcast: the explicit way to say that a single
-		// sample is meant to apply across a whole field.
-		need(1)
-		return c.explicit().eval(n.Args[0])
-	case "each":
-		// iid with the lane index in scope: a vector of width count whose element i is the
-		// expression evaluated with that i bound.
-		//
-		// This is the one construct that is not elementwise, and it buys three things nothing
-		// else can. Element i may read element i-1 of something (a cohort ages), so an index
-		// shift becomes sayable. Everything inside a lane is a scalar, so where is lazy per
-		// lane and a skipped lane draws nothing. And lanes run in order, so a draw per lane
-		// interleaves the way a Go loop does rather than taking every gamma before any
-		// poisson. It is a bounded comprehension with no assignment and no recursion, so an
-		// expression still always terminates.
-		need(3)
-		countValue := arg(0)
-		if len(countValue) != 1 {
-			panic("expression: each's count must be a scalar")
-		}
-		count := toIndex(countValue[0], "each's count")
-		if count < 1 {
-			panic("expression: each's count must be at least 1")
-		}
-		index, ok := n.Args[1].(*ast.Ident)
-		if !ok {
-			panic("expression: each's second argument must be a name to bind the lane " +
-				"index to, as in each(40, i, ...)")
-		}
-		inner := c.explicit()
-		// The env is shared with the enclosing scope, so the binding must not outlive the loop.
-		defer inner.bind(index.Name)()
-		out := make(exprValue, count)
-		for i := 0; i < count; i++ {
-			inner.env[index.Name] = exprValue{float64(i)}
-			v := inner.eval(n.Args[2])
-			if len(v) != 1 {
-				panic(fmt.Sprintf(
-					"expression: each expects a scalar-valued expression per lane, got "+
-						"width %d", len(v)))
-			}
-			out[i] = v[0]
-		}
-		return out
-	case "scan":
-		// each with an accumulator threaded through the lanes: lane i evaluates the expression
-		// with the lane index bound and acc bound to the previous lane's value (init at lane 0),
-		// and the value of the call is the last lane's. So it is a fold, not a map.
-		//
-		// This is the one thing each cannot do. Its lanes are independent and each must produce
-		// a scalar, so nothing a lane computes reaches the next one. A scan lane may be any
-		// width, and that is what closes the case that asked for this: allocating k simultaneous
-		// arrivals to the first k free slots, where what has to be carried between lanes is
-		// which slots are now taken rather than a running total. Running maxima and true prefix
-		// operations are the same shape, and become O(n) rather than the O(n^2) of an each of
-		// sums over ever-longer slices.
-		//
-		// It stays as bounded as each: the count is fixed before the loop, acc is threaded
-		// rather than assigned to, and there is still no recursion, so an expression still
-		// always terminates.
-		need(5)
-		countValue := arg(0)
-		if len(countValue) != 1 {
-			panic("expression: scan's count must be a scalar")
-		}
-		count := toIndex(countValue[0], "scan's count")
-		if count < 0 {
-			// Zero is allowed, unlike each's: a fold over no lanes is init, which is the right
-			// answer rather than an edge case, and it lets the count come from data.
-			panic("expression: scan's count must not be negative")
-		}
-		index, ok := n.Args[1].(*ast.Ident)
-		if !ok {
-			panic("expression: scan's second argument must be a name to bind the lane index " +
-				"to, as in scan(40, i, acc, 0, ...)")
-		}
-		accumulator, ok := n.Args[2].(*ast.Ident)
-		if !ok {
-			panic("expression: scan's third argument must be a name to bind the accumulator " +
-				"to, as in scan(40, i, acc, 0, ...)")
-		}
-		if accumulator.Name == index.Name {
-			panic("expression: scan's lane index and accumulator cannot share the name " +
-				index.Name)
-		}
-		// The initial value is evaluated once, in the enclosing scope, before either name is
-		// bound — so an init that mentions them means the outer ones, as it reads.
-		value := arg(3)
-		inner := c.explicit()
-		defer inner.bind(index.Name)()
-		defer inner.bind(accumulator.Name)()
-		for i := 0; i < count; i++ {
-			inner.env[index.Name] = exprValue{float64(i)}
-			inner.env[accumulator.Name] = value
-			value = inner.eval(n.Args[4])
-		}
-		return value
-	case "lag":
-		// A read of a partition's committed state further back than the current row, which is
-		// all a bare name or an upstreams alias ever gives.
-		need(2)
-		name, ok := n.Args[0].(*ast.Ident)
-		if !ok {
-			panic("expression: lag's first argument must be an upstream alias or a field name")
-		}
-		rowValue := arg(1)
-		if len(rowValue) != 1 {
-			panic("expression: lag's row must be a scalar")
-		}
-		if c.lag == nil {
-			panic("expression: lag is unavailable here")
-		}
-		return c.lag(name.Name, toIndex(rowValue[0], "lag's row"))
-	}
-
-	switch name {
-	case "clamp":
-		need(3)
-		x, lo, hi := arg(0), arg(1), arg(2)
-		return zipExpr(zipExpr(x, lo, name, math.Max), hi, name, math.Min)
-	case "min":
-		need(2)
-		return zipExpr(arg(0), arg(1), name, math.Min)
-	case "max":
-		need(2)
-		return zipExpr(arg(0), arg(1), name, math.Max)
-	case "pow":
-		need(2)
-		return zipExpr(arg(0), arg(1), name, math.Pow)
-	case "abs":
-		need(1)
-		return mapExpr(arg(0), math.Abs)
-	case "floor":
-		need(1)
-		return mapExpr(arg(0), math.Floor)
-	case "exp":
-		need(1)
-		return mapExpr(arg(0), math.Exp)
-	case "log":
-		need(1)
-		return mapExpr(arg(0), math.Log)
-	case "sqrt":
-		need(1)
-		return mapExpr(arg(0), math.Sqrt)
-	case "sin":
-		need(1)
-		return mapExpr(arg(0), math.Sin)
-	case "cos":
-		need(1)
-		return mapExpr(arg(0), math.Cos)
-	case "tan":
-		need(1)
-		return mapExpr(arg(0), math.Tan)
-	case "asin":
-		need(1)
-		return mapExpr(arg(0), math.Asin)
-	case "acos":
-		need(1)
-		return mapExpr(arg(0), math.Acos)
-	case "atan":
-		need(1)
-		return mapExpr(arg(0), math.Atan)
-	case "atan2":
-		// Two-argument arctangent, atan2(y, x), for a full-circle angle from a pair of
-		// components — a solar azimuth from its projections, say. Kept as its own primitive
-		// rather than atan(y/x) so the quadrant is resolved and x == 0 is well defined,
-		// matching math.Atan2 exactly.
-		need(2)
-		return zipExpr(arg(0), arg(1), name, math.Atan2)
-	case "erf":
-		need(1)
-		return mapExpr(arg(0), math.Erf)
-	case "erfc":
-		// The primitive a Gaussian CDF is built from: 0.5 * erfc(-x / sqrt(2)). Kept as
-		// erfc rather than offering the CDF directly so it matches math.Erfc exactly, which
-		// is what lets a model expressed here agree with compiled Go to rounding.
-		need(1)
-		return mapExpr(arg(0), math.Erfc)
-	case "fill":
-		need(2)
-		nv, x := arg(0), arg(1)
-		if len(nv) != 1 {
-			panic("expression: fill's width must be a scalar")
-		}
-		w := toIndex(nv[0], "fill's width")
-		if w < 1 {
-			panic("expression: fill's width must be at least 1")
-		}
-		out := make(exprValue, w)
-		for i := 0; i < w; i++ {
-			out[i] = at(x, i)
-		}
-		return out
-	case "slice":
-		// A block of a vector, for state and params that pack several quantities end to end:
-		// the nine coefficients of a channel inside one flat thirty-six-wide param, say.
-		//
-		// A zero width gives an empty value rather than an error. That is not permissiveness:
-		// the natural prefix sum, each(n, i, sum(slice(q, 0, i))), asks for nothing at lane 0,
-		// and nothing is the correct block to ask for there. Rejecting it forced a guarded
-		// spelling that needed both a where and a max(i, 1) — the where for the answer, the max
-		// because the untaken branch is still bounds-checked — for the one case the construct
-		// exists to serve. sum of an empty value is 0, so the reduction lands where it should.
-		need(3)
-		v, fromValue, widthValue := arg(0), arg(1), arg(2)
-		if len(fromValue) != 1 || len(widthValue) != 1 {
-			panic("expression: slice's start and width must be scalars")
-		}
-		from := toIndex(fromValue[0], "slice's start")
-		width := toIndex(widthValue[0], "slice's width")
-		if width < 0 {
-			panic("expression: slice's width must not be negative")
-		}
-		if from < 0 || from+width > len(v) {
-			panic(fmt.Sprintf(
-				"expression: slice(%d, %d) is outside a width-%d value", from, width, len(v)))
-		}
-		return append(make(exprValue, 0, width), v[from:from+width]...)
-	case "concat":
-		// The other half of slice: assemble a field from pieces that are computed
-		// differently, such as a cohort's boundary buckets against its interior.
-		if len(n.Args) < 2 {
-			panic("expression: concat takes at least 2 arguments, got " +
-				strconv.Itoa(len(n.Args)))
-		}
-		out := make(exprValue, 0, len(n.Args))
-		for i := range n.Args {
-			out = append(out, arg(i)...)
-		}
-		return out
-	case "width":
-		// How many elements a value has, for a spec that must adapt to a param's length
-		// rather than hard-code it. Without it the only way to ask is a trick, and the
-		// obvious spelling of that trick, sum(0 * x + 1), is silently wrong: 0 * NaN is NaN.
-		need(1)
-		return exprValue{float64(len(arg(0)))}
-	case "sum":
-		need(1)
-		total := 0.0
-		for _, x := range arg(0) {
-			total += x
-		}
-		return exprValue{total}
-	case "dot":
-		need(2)
-		a, b := arg(0), arg(1)
-		nn := broadcastLen(a, b, name)
-		total := 0.0
-		for i := 0; i < nn; i++ {
-			total += at(a, i) * at(b, i)
-		}
-		return exprValue{total}
-	case "normal":
-		need(2)
-		return c.draw2(name, arg(0), arg(1), c.sampler.Normal)
-	case "uniform":
-		need(2)
-		return c.draw2(name, arg(0), arg(1), c.sampler.Uniform)
-	case "gamma":
-		need(2)
-		return c.draw2(name, arg(0), arg(1), c.sampler.Gamma)
-	case "beta":
-		need(2)
-		return c.draw2(name, arg(0), arg(1), c.sampler.Beta)
-	case "binomial":
-		need(2)
-		// pkg/rng leaves Binomial on distuv, whose three-branch algorithm was not worth
-		// reimplementing. Draw from the sampler's own generator so a partition still has
-		// exactly one stream and runs stay reproducible.
-		return c.draw2(name, arg(0), arg(1), func(nn, p float64) float64 {
-			return distuv.Binomial{N: nn, P: p, Src: c.sampler.Rand()}.Rand()
-		})
-	case "exponential":
-		need(1)
-		return c.draw1(name, arg(0), c.sampler.Exponential)
-	case "poisson":
-		need(1)
-		return c.draw1(name, arg(0), c.sampler.Poisson)
-	}
-	panic("expression: unknown function " + name)
-}
-
-// checkDrawWidth rejects a draw whose parameters are all scalars unless the caller has said
-// which reading is meant. See the type doc under "How wide a draw is".
-func (c *exprCtx) checkDrawWidth(name string, width int) {
-	if width == 1 && !c.drawsAreExplicit {
-		panic(fmt.Sprintf(
-			"expression: %s has only scalar parameters, so its width is ambiguous; "+
-				"write iid(n, %s(...)) for n independent samples, or shared(%s(...)) for "+
-				"one sample reused across the field",
-			name, name, name))
-	}
-}
-
-// draw1 applies a one-parameter draw elementwise; each element is an independent sample.
-func (c *exprCtx) draw1(name string, a exprValue, f func(x float64) float64) exprValue {
-	c.checkDrawWidth(name, len(a))
-	return mapExpr(a, f)
-}
-
-// draw2 applies a two-parameter draw elementwise, broadcasting the parameters; each element
-// is an independent sample.
-func (c *exprCtx) draw2(
-	name string,
-	a, b exprValue,
-	f func(x, y float64) float64,
-) exprValue {
-	n := broadcastLen(a, b, name)
-	c.checkDrawWidth(name, n)
-	out := make(exprValue, n)
-	for i := 0; i < n; i++ {
-		out[i] = f(at(a, i), at(b, i))
-	}
-	return out
-}
@@ -0,0 +1,733 @@
+package general
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/umbralcalc/stochadex/pkg/spatial"
+)
+
+// ExpressionShapes is what a static check of an ExpressionIteration knows about the partition
+// it runs in and the partitions around it, as they stand when the config is loaded.
+type ExpressionShapes struct {
+	// StateWidth is the partition's state width, or 0 if it is not known.
+	StateWidth int
+	// StateHistoryDepth is the partition's state_history_depth.
+	StateHistoryDepth int
+	// Params gives the width of every param the partition will be given, including those
+	// forwarded from upstream. A negative width means the param exists but its width is not
+	// known until the run.
+	Params map[string]int
+	// Partitions gives the shape of every partition in the run by name, which is what an
+	// upstream alias reads and what lag is bounded by.
+	Partitions map[string]ExpressionPartitionShape
+}
+
+// ExpressionPartitionShape is the state width and history depth of one partition.
+type ExpressionPartitionShape struct {
+	StateWidth        int
+	StateHistoryDepth int
+}
+
+// ExpressionIssue is one problem a static check found.
+type ExpressionIssue struct {
+	// Where names what the problem is in, such as "binding dispatch" or "output for field soc".
+	Where string
+	// Expr is the text of the expression the problem is in, or empty when it is in the
+	// partition's layout rather than in an expression.
+	Expr string
+	// Offset is the byte offset in Expr the problem is at.
+	Offset int
+	// Message says what is wrong.
+	Message string
+}
+
+// String gives the issue with the line of the expression it is in and a caret under the spot.
+func (i ExpressionIssue) String() string {
+	if i.Expr == "" {
+		return i.Where + ": " + i.Message
+	}
+	offset := min(max(i.Offset, 0), len(i.Expr))
+	start := strings.LastIndexByte(i.Expr[:offset], '\n') + 1
+	end := strings.IndexByte(i.Expr[offset:], '\n')
+	if end < 0 {
+		end = len(i.Expr)
+	} else {
+		end += offset
+	}
+	return fmt.Sprintf("%s: %s\n    %s\n    %s^", i.Where, i.Message, i.Expr[start:end],
+		strings.Repeat(" ", utf8.RuneCountInString(i.Expr[start:offset])))
+}
+
+// Check infers the width of every binding and output from the field widths, the params and
+// the upstream partitions, and reports every problem it can prove will stop the partition,
+// rather than the first one Iterate happens to reach mid-run: unknown names and functions,
+// wrong arities, widths that cannot broadcast, outputs that do not fit their fields, scalar
+// draws with no iid or shared, indices and slices out of range, and lag rows past a
+// partition's state_history_depth.
+//
+// It reports only what is certain. A width that depends on data — each's count when it is a
+// param, say — is left unknown, and nothing is reported against it. Where the runtime is lazy
+// the check is not: both branches of a where are checked, as a compiler checks both arms of an
+// if, because a branch that cannot run is a bug even on a step that does not take it.
+func (e *ExpressionIteration) Check(shapes ExpressionShapes) []ExpressionIssue {
+	c := &exprChecker{e: e, shapes: shapes}
+	if len(e.Outputs) != len(e.Fields) {
+		c.layout("%d outputs for %d fields; there must be exactly one per field",
+			len(e.Outputs), len(e.Fields))
+	}
+	width := 0
+	for i, f := range e.Fields {
+		switch {
+		case f.Name == "":
+			c.layout("field at index %d has no name", i)
+		case f.Width < 0:
+			c.layout("field %s has negative width", f.Name)
+		}
+		width += max(e.fieldWidth(i), 0)
+	}
+	if shapes.StateWidth > 0 && width != shapes.StateWidth {
+		c.layout("fields span %d elements, but the partition's state is %d wide",
+			width, shapes.StateWidth)
+	}
+	c.definitions()
+	for i, o := range e.Outputs {
+		if i >= len(e.Fields) {
+			break
+		}
+		where := "output for field " + e.Fields[i].Name
+		shape := c.expression(where, o)
+		if w := e.fieldWidth(i); shape.width >= 0 && shape.width != w && shape.width != 1 {
+			c.where, c.text = where, o
+			c.report(token.Pos(1), "produces width %d, want %d or 1", shape.width, w)
+		}
+	}
+	return c.issues
+}
+
+// Check reports what ExpressionIteration.Check would for Expr and the bindings, functions and
+// matrices it reads, with no fields, and any input in WithRespectTo that is not a param or an
+// upstream alias: the unknown names and functions that NewExpressionDerivative leaves for
+// Evaluate to reach. StateWidth is not checked, since the Jacobian's width depends on the
+// inputs' widths at run time.
+func (e *ExpressionGradientIteration) Check(shapes ExpressionShapes) []ExpressionIssue {
+	c := &exprChecker{e: &ExpressionIteration{
+		Upstreams: e.Upstreams,
+		Bindings:  e.Bindings,
+		Functions: e.Functions,
+		Matrices:  e.Matrices,
+	}, shapes: shapes}
+	c.definitions()
+	c.expression("expr", e.Expr)
+	c.scope = nil
+	for _, name := range e.WithRespectTo {
+		if _, ok := c.lookup(name); !ok {
+			c.issues = append(c.issues, ExpressionIssue{
+				Where:   "with_respect_to",
+				Message: "unknown name " + name + "; an input is a param or an upstream alias",
+			})
+		}
+	}
+	return c.issues
+}
+
+// definitions checks the upstream aliases and topology, then parses and checks the functions,
+// matrices and bindings every expression of e can read, leaving them in scope.
+func (c *exprChecker) definitions() {
+	e := c.e
+	for alias, name := range e.Upstreams {
+		if _, ok := c.shapes.Partitions[name]; !ok {
+			c.layout("upstream partition %s (alias %s) not found", name, alias)
+		}
+	}
+	if e.Topology != nil {
+		topology, err := e.Topology.Build()
+		if err != nil {
+			c.layout("topology: %v", err)
+		}
+		c.topology = topology
+	}
+
+	functions, issues := e.parseExprFunctions()
+	c.issues = append(c.issues, issues...)
+	c.functions = functions
+	matrices, issues := e.matrixShapes()
+	c.issues = append(c.issues, issues...)
+	c.matrices = matrices
+	// Each function is checked on its own first, with parameters of unknown width and as if
+	// called inside iid, so that one nothing calls yet is checked too. Its call sites then check
+	// it again with what they pass it.
+	for _, f := range e.Functions {
+		if parsed, ok := functions[f.Name]; ok && parsed.text == f.Expr {
+			names := make([]exprCheckName, len(parsed.params))
+			for i, param := range parsed.params {
+				names[i] = exprCheckName{param, unknownShape}
+			}
+			c.explicit = true
+			c.body(parsed, names)
+			c.explicit = false
+		}
+	}
+
+	for _, b := range e.Bindings {
+		shape := c.expression("binding "+b.Name, b.Expr)
+		c.scope = append(c.scope, exprCheckName{b.Name, shape})
+	}
+}
+
+// exprShape is what the check knows about a value: its width, or -1 if that depends on data,
+// and for a scalar built only from literals, its value. rows is 0 for a value that is not a
+// matrix, and otherwise its row count, or -1 if that depends on data.
+type exprShape struct {
+	width    int
+	constant bool
+	value    float64
+	rows     int
+}
+
+var unknownShape = exprShape{width: -1}
+
+func widthShape(width int) exprShape {
+	return exprShape{width: width}
+}
+
+func constantShape(value float64) exprShape {
+	return exprShape{width: 1, constant: true, value: value}
+}
+
+type exprCheckName struct {
+	name  string
+	shape exprShape
+}
+
+type exprChecker struct {
+	e         *ExpressionIteration
+	shapes    ExpressionShapes
+	topology  *spatial.Topology
+	scope     []exprCheckName
+	explicit  bool
+	functions map[string]*parsedExprFunction
+	inlining  []string
+	matrices  map[string][2]int
+	where     string
+	text      string
+	issues    []ExpressionIssue
+}
+
+func (c *exprChecker) layout(format string, args ...any) {
+	c.issues = append(c.issues, ExpressionIssue{
+		Where: "fields", Message: fmt.Sprintf(format, args...)})
+}
+
+// report records an issue at pos in the expression being checked. A function body is checked
+// once per call site, so the same issue is recorded only once.
+func (c *exprChecker) report(pos token.Pos, format string, args ...any) {
+	issue := ExpressionIssue{
+		Where:   c.where,
+		Expr:    c.text,
+		Offset:  int(pos) - 1,
+		Message: fmt.Sprintf(format, args...),
+	}
+	for _, reported := range c.issues {
+		if reported == issue {
+			return
+		}
+	}
+	c.issues = append(c.issues, issue)
+}
+
+// expression parses and checks one binding or output.
+func (c *exprChecker) expression(where, text string) exprShape {
+	c.where, c.text = where, text
+	node, err := parser.ParseExpr(text)
+	if err != nil {
+		issue := ExpressionIssue{Where: where, Expr: text, Message: err.Error()}
+		if list, ok := err.(scanner.ErrorList); ok && len(list) > 0 {
+			issue.Offset, issue.Message = list[0].Pos.Offset, list[0].Msg
+		}
+		c.issues = append(c.issues, issue)
+		return unknownShape
+	}
+	return c.check(node)
+}
+
+// lookup resolves a name the way Iterate does: lane variables and bindings innermost first,
+// then the clock, upstream aliases, params, tables and fields.
+func (c *exprChecker) lookup(name string) (exprShape, bool) {
+	for i := len(c.scope) - 1; i >= 0; i-- {
+		if c.scope[i].name == name {
+			return c.scope[i].shape, true
+		}
+	}
+	switch name {
+	case "dt", "t", "step":
+		return widthShape(1), true
+	case "pi":
+		return constantShape(math.Pi), true
+	}
+	if partition, ok := c.e.Upstreams[name]; ok {
+		if shape, ok := c.shapes.Partitions[partition]; ok {
+			return widthShape(shape.StateWidth), true
+		}
+		return unknownShape, true
+	}
+	if width, ok := c.shapes.Params[name]; ok {
+		return widthShape(max(width, -1)), true
+	}
+	if values, ok := c.e.Tables[name]; ok {
+		return widthShape(len(values)), true
+	}
+	for i, f := range c.e.Fields {
+		if f.Name == name {
+			return widthShape(c.e.fieldWidth(i)), true
+		}
+	}
+	return unknownShape, false
+}
+
+// declared reports whether name is in scope, rather than a global.
+func (c *exprChecker) declared(name string) bool {
+	for _, local := range c.scope {
+		if local.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// broadcast is the width of combining widths a and b, reporting a mismatch at pos. An unknown
+// width broadcasts to the other side unless that is a scalar, which could go either way.
+func (c *exprChecker) broadcast(pos token.Pos, what string, a, b int) int {
+	switch {
+	case a < 0 && b < 0:
+		return -1
+	case a < 0:
+		if b == 1 {
+			return -1
+		}
+		return b
+	case b < 0:
+		if a == 1 {
+			return -1
+		}
+		return a
+	case a == b, b == 1:
+		return a
+	case a == 1:
+		return b
+	}
+	c.report(pos, "cannot combine widths %d and %d in %s", a, b, what)
+	return -1
+}
+
+// scalar reports a value that is known not to be a scalar where one is needed.
+func (c *exprChecker) scalar(node ast.Expr, shape exprShape, message string) {
+	if shape.width >= 0 && shape.width != 1 {
+		c.report(node.Pos(), "%s, got width %d", message, shape.width)
+	}
+}
+
+// count returns a constant count or index as an int, reporting one that is not a whole number.
+func (c *exprChecker) count(node ast.Expr, shape exprShape, what string) (int, bool) {
+	if !shape.constant {
+		return 0, false
+	}
+	if math.IsNaN(shape.value) || math.IsInf(shape.value, 0) {
+		c.report(node.Pos(), "%s is %v, which is not a whole number", what, shape.value)
+		return 0, false
+	}
+	return int(shape.value), true
+}
+
+func (c *exprChecker) check(node ast.Expr) exprShape {
+	switch n := node.(type) {
+	case *ast.BasicLit:
+		v, err := strconv.ParseFloat(n.Value, 64)
+		if err != nil {
+			c.report(n.Pos(), "bad numeric literal %s", n.Value)
+			return unknownShape
+		}
+		return constantShape(v)
+	case *ast.Ident:
+		if len(c.inlining) > 0 && n.Name != "pi" && !c.declared(n.Name) {
+			c.report(n.Pos(), "function %s has no parameter %s; a function sees only its "+
+				"parameters and pi", c.inlining[len(c.inlining)-1], n.Name)
+			return unknownShape
+		}
+		local := c.declared(n.Name)
+		shape, ok := c.lookup(n.Name)
+		if !ok {
+			c.report(n.Pos(), "unknown name %s", n.Name)
+		}
+		if declared, ok := c.matrices[n.Name]; ok && !local {
+			if width := declared[0] * declared[1]; shape.width >= 0 && shape.width != width {
+				c.report(n.Pos(), "%s is declared %dx%d but has width %d",
+					n.Name, declared[0], declared[1], shape.width)
+			}
+			return exprShape{width: declared[0] * declared[1], rows: declared[0]}
+		}
+		return shape
+	case *ast.ParenExpr:
+		return c.check(n.X)
+	case *ast.UnaryExpr:
+		x := c.check(n.X)
+		switch n.Op {
+		case token.SUB:
+			x.value = -x.value
+			return x
+		case token.ADD:
+			return x
+		case token.NOT:
+			x.value = exprBool(x.value == 0)
+			return x
+		}
+		c.report(n.OpPos, "unsupported operator %s", n.Op)
+		return unknownShape
+	case *ast.IndexExpr:
+		x, index := c.check(n.X), c.check(n.Index)
+		c.scalar(n.Index, index, "an index must be a scalar")
+		if i, ok := c.count(n.Index, index, "an index"); ok && x.width >= 0 &&
+			(i < 0 || i >= x.width) {
+			c.report(n.Index.Pos(), "index %d out of range for width %d", i, x.width)
+		}
+		return widthShape(1)
+	case *ast.BinaryExpr:
+		return c.binary(n)
+	case *ast.CallExpr:
+		return c.call(n)
+	}
+	c.report(node.Pos(), "unsupported syntax")
+	return unknownShape
+}
+
+func (c *exprChecker) binary(n *ast.BinaryExpr) exprShape {
+	x, y := c.check(n.X), c.check(n.Y)
+	op := n.Op.String()
+	if n.Op == token.LAND || n.Op == token.LOR {
+		if x.width == 1 {
+			return widthShape(y.width)
+		}
+		return widthShape(c.broadcast(n.OpPos, op, x.width, y.width))
+	}
+	var fold func(a, b float64) float64
+	switch n.Op {
+	case token.ADD:
+		fold = func(a, b float64) float64 { return a + b }
+	case token.SUB:
+		fold = func(a, b float64) float64 { return a - b }
+	case token.MUL:
+		fold = func(a, b float64) float64 { return a * b }
+	case token.QUO:
+		fold = func(a, b float64) float64 { return a / b }
+	case token.REM:
+		fold = math.Mod
+	case token.LSS, token.GTR, token.LEQ, token.GEQ, token.EQL, token.NEQ:
+	default:
+		c.report(n.OpPos, "unsupported operator %s", op)
+		return unknownShape
+	}
+	shape := widthShape(c.broadcast(n.OpPos, op, x.width, y.width))
+	if fold != nil && x.constant && y.constant {
+		return constantShape(fold(x.value, y.value))
+	}
+	if fold != nil {
+		shape.rows = x.rows
+		if shape.rows == 0 {
+			shape.rows = y.rows
+		}
+	}
+	return shape
+}
+
+// within checks body with lane variables or an accumulator bound, and as explicit as a body
+// of iid or each is.
+func (c *exprChecker) within(body ast.Expr, names ...exprCheckName) exprShape {
+	outer := c.explicit
+	c.explicit = true
+	c.scope = append(c.scope, names...)
+	shape := c.check(body)
+	c.scope = c.scope[:len(c.scope)-len(names)]
+	c.explicit = outer
+	return shape
+}
+
+func (c *exprChecker) call(n *ast.CallExpr) exprShape {
+	ident, ok := n.Fun.(*ast.Ident)
+	if !ok {
+		c.report(n.Fun.Pos(), "unsupported call target")
+		return unknownShape
+	}
+	name := ident.Name
+	if f, ok := c.functions[name]; ok {
+		return c.inline(f, n)
+	}
+	if k, ok := exprArity[name]; ok && len(n.Args) != k {
+		c.report(n.Pos(), "%s takes %d arguments, got %d", name, k, len(n.Args))
+		return unknownShape
+	}
+	if _, ok := exprArity[name]; !ok && name != "concat" && name != "interp" {
+		c.report(n.Pos(), "unknown function %s", name)
+		return unknownShape
+	}
+	if exprTableFunctions[name] {
+		return c.table(name, n)
+	}
+	arg := func(i int) exprShape { return c.check(n.Args[i]) }
+
+	switch name {
+	case "where":
+		cond, a, b := arg(0), arg(1), arg(2)
+		if cond.width == 1 {
+			if cond.constant {
+				if cond.value != 0 {
+					return a
+				}
+				return b
+			}
+			if a.width == b.width {
+				return widthShape(a.width)
+			}
+			return unknownShape
+		}
+		if cond.width > 1 {
+			for i, branch := range []exprShape{a, b} {
+				if branch.width >= 0 && branch.width != cond.width && branch.width != 1 {
+					c.report(n.Args[i+1].Pos(), "where's %s branch has width %d, which is "+
+						"neither the condition's %d nor 1",
+						[]string{"then", "else"}[i], branch.width, cond.width)
+				}
+			}
+		}
+		return widthShape(cond.width)
+	case "iid":
+		count := arg(0)
+		c.scalar(n.Args[0], count, "iid's count must be a scalar")
+		body := c.within(n.Args[1])
+		if body.width >= 0 && body.width != 1 {
+			c.report(n.Args[1].Pos(), "iid expects a scalar-valued expression, got width %d",
+				body.width)
+		}
+		if k, ok := c.count(n.Args[0], count, "iid's count"); ok {
+			if k < 1 {
+				c.report(n.Args[0].Pos(), "iid's count must be at least 1")
+				return unknownShape
+			}
+			return widthShape(k)
+		}
+		return unknownShape
+	case "shared":
+		return c.within(n.Args[0])
+	case "each":
+		count := arg(0)
+		c.scalar(n.Args[0], count, "each's count must be a scalar")
+		index, named := n.Args[1].(*ast.Ident)
+		if !named {
+			c.report(n.Args[1].Pos(), "each's second argument must be a name to bind the lane "+
+				"index to, as in each(40, i, ...)")
+			return unknownShape
+		}
+		body := c.within(n.Args[2], exprCheckName{index.Name, widthShape(1)})
+		if body.width >= 0 && body.width != 1 {
+			c.report(n.Args[2].Pos(), "each expects a scalar-valued expression per lane, got "+
+				"width %d", body.width)
+		}
+		if k, ok := c.count(n.Args[0], count, "each's count"); ok {
+			if k < 1 {
+				c.report(n.Args[0].Pos(), "each's count must be at least 1")
+				return unknownShape
+			}
+			return widthShape(k)
+		}
+		return unknownShape
+	case "scan":
+		count := arg(0)
+		c.scalar(n.Args[0], count, "scan's count must be a scalar")
+		index, indexNamed := n.Args[1].(*ast.Ident)
+		accumulator, accumulatorNamed := n.Args[2].(*ast.Ident)
+		switch {
+		case !indexNamed:
+			c.report(n.Args[1].Pos(), "scan's second argument must be a name to bind the lane "+
+				"index to, as in scan(40, i, acc, 0, ...)")
+			return unknownShape
+		case !accumulatorNamed:
+			c.report(n.Args[2].Pos(), "scan's third argument must be a name to bind the "+
+				"accumulator to, as in scan(40, i, acc, 0, ...)")
+			return unknownShape
+		case index.Name == accumulator.Name:
+			c.report(n.Args[2].Pos(), "scan's lane index and accumulator cannot share the name "+
+				"%s", index.Name)
+			return unknownShape
+		}
+		init := arg(3)
+		// The body is checked as lane 0 runs it, with acc as wide as init. A body that keeps
+		// that width is a fixed point, so every lane is the same shape; one that grows acc is
+		// left unknown past lane 0.
+		body := c.within(n.Args[4],
+			exprCheckName{index.Name, widthShape(1)},
+			exprCheckName{accumulator.Name, widthShape(init.width)})
+		k, ok := c.count(n.Args[0], count, "scan's count")
+		switch {
+		case ok && k < 0:
+			c.report(n.Args[0].Pos(), "scan's count must not be negative")
+			return unknownShape
+		case ok && k == 0:
+			return init
+		case body.width == init.width, ok && k == 1:
+			return widthShape(body.width)
+		}
+		return unknownShape
+	case "lag":
+		target, ok := n.Args[0].(*ast.Ident)
+		if !ok {
+			c.report(n.Args[0].Pos(), "lag's first argument must be an upstream alias or a "+
+				"field name")
+			return unknownShape
+		}
+		row := arg(1)
+		c.scalar(n.Args[1], row, "lag's row must be a scalar")
+		shape, depth := unknownShape, 0
+		if partition, ok := c.e.Upstreams[target.Name]; ok {
+			if upstream, ok := c.shapes.Partitions[partition]; ok {
+				shape, depth = widthShape(upstream.StateWidth), upstream.StateHistoryDepth
+			}
+		} else if i := c.fieldIndex(target.Name); i >= 0 {
+			shape, depth = widthShape(c.e.fieldWidth(i)), c.shapes.StateHistoryDepth
+		} else {
+			c.report(target.Pos(), "lag needs an upstream alias or one of this partition's own "+
+				"fields, got %s", target.Name)
+			return unknownShape
+		}
+		if r, ok := c.count(n.Args[1], row, "lag's row"); ok && depth > 0 &&
+			(r < 0 || r >= depth) {
+			c.report(n.Args[1].Pos(), "lag(%s, %d) is outside the %d rows %s keeps; raise its "+
+				"state_history_depth", target.Name, r, depth, target.Name)
+		}
+		return shape
+	case "concat":
+		if len(n.Args) < 2 {
+			c.report(n.Pos(), "concat takes at least 2 arguments, got %d", len(n.Args))
+			return unknownShape
+		}
+		total := 0
+		for i := range n.Args {
+			if w := arg(i).width; w >= 0 && total >= 0 {
+				total += w
+			} else {
+				total = -1
+			}
+		}
+		return widthShape(total)
+	}
+
+	args := make([]exprShape, len(n.Args))
+	for i := range n.Args {
+		args[i] = arg(i)
+	}
+	if exprMatrixFunctions[name] {
+		return c.matrix(name, n, args)
+	}
+	if exprOrderFunctions[name] {
+		return c.order(name, n, args)
+	}
+	if exprDistributions[name] {
+		return c.distribution(name, n, args)
+	}
+	switch name {
+	case "clamp":
+		return widthShape(c.broadcast(n.Pos(), name,
+			c.broadcast(n.Pos(), name, args[0].width, args[1].width), args[2].width))
+	case "min", "max", "pow", "atan2":
+		return widthShape(c.broadcast(n.Pos(), name, args[0].width, args[1].width))
+	case "fill":
+		c.scalar(n.Args[0], args[0], "fill's width must be a scalar")
+		w, ok := c.count(n.Args[0], args[0], "fill's width")
+		if !ok {
+			return unknownShape
+		}
+		if w < 1 {
+			c.report(n.Args[0].Pos(), "fill's width must be at least 1")
+			return unknownShape
+		}
+		if x := args[1].width; x > 1 && x < w {
+			c.report(n.Args[1].Pos(), "fill(%d, ...) is given a width-%d value, which is too "+
+				"short to fill it; give it a scalar", w, x)
+		}
+		return widthShape(w)
+	case "slice":
+		c.scalar(n.Args[1], args[1], "slice's start must be a scalar")
+		c.scalar(n.Args[2], args[2], "slice's width must be a scalar")
+		from, fromKnown := c.count(n.Args[1], args[1], "slice's start")
+		w, ok := c.count(n.Args[2], args[2], "slice's width")
+		if !ok {
+			return unknownShape
+		}
+		if w < 0 {
+			c.report(n.Args[2].Pos(), "slice's width must not be negative")
+			return unknownShape
+		}
+		if v := args[0].width; fromKnown && v >= 0 && (from < 0 || from+w > v) {
+			c.report(n.Args[1].Pos(), "slice(%d, %d) is outside a width-%d value", from, w, v)
+		}
+		return widthShape(w)
+	case "width":
+		if args[0].width >= 0 {
+			return constantShape(float64(args[0].width))
+		}
+		return widthShape(1)
+	case "sum":
+		return widthShape(1)
+	case "dot":
+		c.broadcast(n.Pos(), name, args[0].width, args[1].width)
+		return widthShape(1)
+	case "neighbours_sum", "laplacian":
+		if c.e.Topology == nil {
+			c.report(n.Pos(), "%s needs a topology in the partition's spec", name)
+			return unknownShape
+		}
+		if c.topology == nil {
+			return unknownShape
+		}
+		nodes := c.topology.NumNodes()
+		if x := args[0].width; x >= 0 && x != 1 && x != nodes {
+			c.report(n.Args[0].Pos(), "%s takes one value per node, got width %d for %d nodes",
+				name, x, nodes)
+		}
+		return widthShape(nodes)
+	case "normal", "uniform", "gamma", "beta", "binomial":
+		return c.draw(n, c.broadcast(n.Pos(), name, args[0].width, args[1].width))
+	case "exponential", "poisson":
+		return c.draw(n, args[0].width)
+	}
+	shape := args[0]
+	if shape.constant {
+		shape.value = exprMath[name](shape.value)
+	}
+	return shape
+}
+
+// draw reports a scalar-parameter draw outside iid, shared, each and scan.
+func (c *exprChecker) draw(n *ast.CallExpr, width int) exprShape {
+	if width == 1 && !c.explicit {
+		name := n.Fun.(*ast.Ident).Name
+		c.report(n.Pos(), "%s has only scalar parameters, so its width is ambiguous; write "+
+			"iid(n, %s(...)) for n independent samples, or shared(%s(...)) for one sample "+
+			"reused across the field", name, name, name)
+	}
+	return widthShape(width)
+}
+
+func (c *exprChecker) fieldIndex(name string) int {
+	for i, f := range c.e.Fields {
+		if f.Name == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,169 @@
+package general
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/spatial"
+)
+
+// checkShapes is the surroundings most check tests run in: a width-3 field x, a scalar field
+// s, params of widths 1 and 4, and an upstream partition of width 2 keeping 3 rows.
+func checkShapes() ExpressionShapes {
+	return ExpressionShapes{
+		StateWidth:        4,
+		StateHistoryDepth: 2,
+		Params:            map[string]int{"rate": 1, "weights": 4, "later": -1},
+		Partitions: map[string]ExpressionPartitionShape{
+			"self":  {StateWidth: 4, StateHistoryDepth: 2},
+			"other": {StateWidth: 2, StateHistoryDepth: 3},
+		},
+	}
+}
+
+func checkIteration(bindings []ExpressionBinding, outputs ...string) *ExpressionIteration {
+	return &ExpressionIteration{
+		Fields:    []ExpressionField{{Name: "x", Width: 3}, {Name: "s"}},
+		Bindings:  bindings,
+		Outputs:   outputs,
+		Upstreams: map[string]string{"up": "other"},
+	}
+}
+
+func TestExpressionCheckAcceptsWellFormedExpressions(t *testing.T) {
+	for _, output := range []string{
+		"x + rate",
+		"x * slice(weights, 1, 3)",
+		"where(x > 0, x, 0)",
+		"where(s > 0, x, 1)",
+		"iid(3, normal(0, 1))",
+		"shared(normal(0, 1))",
+		"normal(x, 1)",
+		"each(3, i, x[i] * rate)",
+		"each(width(x), i, where(i > 0, x[i-1], 0))",
+		"scan(3, i, acc, fill(3, 0), acc + x)",
+		"lag(x, 1) + lag(up, 2)[0]",
+		"concat(slice(weights, 0, 2), s)",
+		"fill(3, later)",
+		// later's width is only known at run time, so nothing can be said about combining it.
+		"x + later",
+		"x[2] + weights[3]",
+		"fill(3 * width(up) - 3, rate)",
+	} {
+		e := checkIteration(nil, output, "s")
+		if issues := e.Check(checkShapes()); len(issues) != 0 {
+			t.Errorf("%s: unexpected issues %v", output, issues)
+		}
+	}
+}
+
+func TestExpressionCheckReportsWhatIterateWouldPanicOn(t *testing.T) {
+	for _, c := range []struct {
+		output string
+		want   string
+	}{
+		{"x + weights", "cannot combine widths 3 and 4 in +"},
+		{"x + nope", "unknown name nope"},
+		{"nope(x)", "unknown function nope"},
+		{"clamp(x, 0)", "clamp takes 3 arguments, got 2"},
+		{"normal(0, 1)", "normal has only scalar parameters"},
+		{"where(s > 0, shared(normal(0, 1)), poisson(rate))", "poisson has only scalar"},
+		{"where(x > 0, weights, 0)", "where's then branch has width 4"},
+		{"iid(3, x)", "iid expects a scalar-valued expression, got width 3"},
+		{"each(3, i, x)", "each expects a scalar-valued expression per lane, got width 3"},
+		{"each(x, i, 0)", "each's count must be a scalar, got width 3"},
+		{"each(0, i, 0)", "each's count must be at least 1"},
+		{"each(3, 2, 0)", "each's second argument must be a name"},
+		{"scan(3, i, i, 0, 0)", "cannot share the name i"},
+		{"fill(3, x[3])", "index 3 out of range for width 3"},
+		{"fill(3, weights[-1])", "index -1 out of range for width 4"},
+		{"slice(weights, 2, 3)", "slice(2, 3) is outside a width-4 value"},
+		{"fill(3, slice(weights, 0, 2))", "fill(3, ...) is given a width-2 value"},
+		{"lag(x, 2)", "lag(x, 2) is outside the 2 rows x keeps"},
+		{"fill(3, lag(up, 3)[0])", "lag(up, 3) is outside the 3 rows up keeps"},
+		{"lag(rate, 0)", "lag needs an upstream alias or one of this partition's own fields"},
+		{"neighbours_sum(x)", "neighbours_sum needs a topology"},
+		{"weights", "produces width 4, want 3 or 1"},
+		{"x +", "expected operand"},
+	} {
+		issues := checkIteration(nil, c.output, "s").Check(checkShapes())
+		if len(issues) != 1 || !strings.Contains(issues[0].Message, c.want) {
+			t.Errorf("%s: got %v, want one issue containing %q", c.output, issues, c.want)
+		}
+	}
+}
+
+func TestExpressionCheckReportsEveryIssueAtOnce(t *testing.T) {
+	e := checkIteration(
+		[]ExpressionBinding{{Name: "b", Expr: "x + weights"}, {Name: "c", Expr: "b * 2"}},
+		"c + missing", "normal(0, 1)")
+	issues := e.Check(checkShapes())
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.Where+": "+issue.Message)
+	}
+	want := []string{
+		"binding b: cannot combine widths 3 and 4 in +",
+		// b's width is unknown after its mismatch, so c says nothing further about it.
+		"output for field x: unknown name missing",
+		"output for field s: normal has only scalar parameters, so its width is ambiguous; " +
+			"write iid(n, normal(...)) for n independent samples, or shared(normal(...)) for " +
+			"one sample reused across the field",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestExpressionCheckPointsAtTheProblem(t *testing.T) {
+	issues := checkIteration(nil, "clamp(x, 0, 1) + weights", "s").Check(checkShapes())
+	if len(issues) != 1 {
+		t.Fatalf("got %v, want one issue", issues)
+	}
+	want := "output for field x: cannot combine widths 3 and 4 in +\n" +
+		"    clamp(x, 0, 1) + weights\n" +
+		"                   ^"
+	if got := issues[0].String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExpressionCheckReportsTheLayout(t *testing.T) {
+	e := &ExpressionIteration{
+		Fields:    []ExpressionField{{Name: "x", Width: 3}, {Name: ""}},
+		Outputs:   []string{"0"},
+		Upstreams: map[string]string{"up": "gone"},
+		Topology:  &spatial.TopologySpec{Grid: &spatial.GridSpec{Rows: 2, Cols: 2}},
+	}
+	var got []string
+	for _, issue := range e.Check(checkShapes()) {
+		got = append(got, issue.String())
+	}
+	want := []string{
+		"fields: 1 outputs for 2 fields; there must be exactly one per field",
+		"fields: field at index 1 has no name",
+		"upstream partition gone (alias up) not found",
+	}
+	for _, w := range want {
+		found := false
+		for _, g := range got {
+			found = found || strings.Contains(g, w)
+		}
+		if !found {
+			t.Errorf("got %v, want an issue containing %q", got, w)
+		}
+	}
+}
+
+func TestExpressionCheckKnowsTheTopology(t *testing.T) {
+	e := &ExpressionIteration{
+		Fields:   []ExpressionField{{Name: "u", Width: 4}},
+		Outputs:  []string{"u + laplacian(slice(u, 0, 3))"},
+		Topology: &spatial.TopologySpec{Grid: &spatial.GridSpec{Rows: 2, Cols: 2}},
+	}
+	issues := e.Check(ExpressionShapes{StateWidth: 4})
+	if len(issues) != 1 ||
+		!strings.Contains(issues[0].Message, "takes one value per node, got width 3 for 4 nodes") {
+		t.Errorf("got %v", issues)
+	}
+}
@@ -0,0 +1,1657 @@
+package general
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// An expression partition is interpreted: each step walks compiled closures over buffers,
+// broadcasting every value at run time. That is what lets a model be data, and it is cheap,
+// but a model that has settled can be worth promoting to Go, and writing that Go by hand is a
+// translation in which a draw taken out of order or a lazy where made eager is a different
+// model. GenerateGo does the translation instead.
+//
+// The Go it writes is typed by the config: a width-1 value is a float64, computed inline, and a
+// wider one is a []float64 in a buffer the iteration owns, so a step allocates nothing once the
+// buffers are sized. It takes the same draws from the same sampler in the same order as the
+// evaluator, keeps where lazy wherever the evaluator is lazy, and panics with the evaluator's
+// messages, so the two are the same model to rounding. It trusts the widths the config gives
+// fields, params and upstreams, and so must be regenerated when they change.
+//
+// It covers the elementwise core — operators, where, clamp, min, max, pow, atan2 and the
+// one-argument functions, fill, width, slice, concat, sum, dot, indexing, each, scan, iid,
+// shared and lag — with user functions inlined, and the draws normal, uniform, exponential,
+// poisson, gamma, beta and binomial. A partition using anything else (the matrix, table,
+// ordering and spatial functions, or the wider distribution catalogue) is reported as an error
+// and stays declarative.
+
+// ExpressionGoSpec says what GenerateGo should generate, and for which run.
+type ExpressionGoSpec struct {
+	// Package is the Go package the generated files belong to.
+	Package string
+	// Type names the generated Iteration.
+	Type string
+	// Config is the path of the config the partition is declared in, as the generated test
+	// should load it.
+	Config string
+	// Partition is the partition's name in that config.
+	Partition string
+	// Steps is how many steps the generated test runs the two side by side, defaulting to 1000.
+	Steps int
+	// Shapes are the widths the partition sees in that config, as Check takes them.
+	Shapes ExpressionShapes
+}
+
+// ExpressionGo is Go source generated from an ExpressionIteration, formatted.
+type ExpressionGo struct {
+	// Iteration is the generated simulator.Iteration.
+	Iteration []byte
+	// Test runs the config with the declarative iteration and the generated one side by side,
+	// failing on the first step they disagree, and benchmarks the two.
+	Test []byte
+}
+
+// GenerateGo writes this iteration out as a typed Go simulator.Iteration, with a test that it
+// is the same model. The iteration must pass Check against spec.Shapes, and use only what the
+// generator covers.
+func (e *ExpressionIteration) GenerateGo(spec ExpressionGoSpec) (generated *ExpressionGo, err error) {
+	if !token.IsIdentifier(spec.Type) || !token.IsExported(spec.Type) {
+		return nil, fmt.Errorf("expression: codegen type %q is not an exported Go name", spec.Type)
+	}
+	if !token.IsIdentifier(spec.Package) {
+		return nil, fmt.Errorf("expression: codegen package %q is not a Go name", spec.Package)
+	}
+	if issues := e.Check(spec.Shapes); len(issues) > 0 {
+		problems := make([]string, len(issues))
+		for i, issue := range issues {
+			problems[i] = issue.String()
+		}
+		return nil, errors.New("expression: " + strings.Join(problems, "\n"))
+	}
+	if e.Topology != nil {
+		return nil, errors.New("expression: codegen does not generate a topology yet; keep " +
+			"this partition declarative")
+	}
+	if spec.Steps == 0 {
+		spec.Steps = 1000
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			failure, ok := r.(exprCodegenError)
+			if !ok {
+				panic(r)
+			}
+			generated, err = nil, errors.New("expression: "+string(failure))
+		}
+	}()
+	g := newGoGen(e, spec)
+	iteration, err := format.Source(g.iteration())
+	if err != nil {
+		return nil, fmt.Errorf("expression: codegen wrote Go that does not parse: %w", err)
+	}
+	var test bytes.Buffer
+	if err := exprCodegenTest.Execute(&test, spec); err != nil {
+		return nil, err
+	}
+	formatted, err := format.Source(test.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("expression: codegen wrote a test that does not parse: %w", err)
+	}
+	return &ExpressionGo{Iteration: iteration, Test: formatted}, nil
+}
+
+// exprCodegenError is what the generator panics with on something it cannot generate, for
+// GenerateGo to return.
+type exprCodegenError string
+
+// goValue is one generated value. A width-1 value is a float64 Go expression, which is
+// composed into the expressions that use it; any other is a []float64 held in a variable.
+// width is -1 when it is only known at run time. prec is the precedence of code's outermost
+// operator, for parenthesising it when composed, and truth, when set, is a bool expression code
+// is the 0 or 1 of.
+//
+// A value with elements set is a vector not computed yet: code is its element i, for the loop
+// that uses it to compute in place. That is how a chain of elementwise operations becomes one
+// loop rather than a buffer per operation. Only a pure value of a known width over 1 is left
+// this way, and gen computes it into a buffer for any use but an elementwise one.
+type goValue struct {
+	code     string
+	width    int
+	prec     int
+	constant bool
+	value    float64
+	truth    string
+	elements bool
+}
+
+// Go's operator precedences, with goAtom for a name, a call or an index.
+const (
+	goCompare = 3
+	goAdd     = 4
+	goMul     = 5
+	goUnary   = 6
+	goAtom    = 7
+)
+
+func goScalar(code string) goValue {
+	return goValue{code: code, width: 1, prec: goAtom}
+}
+
+// goConstant is v as a float64 literal. Constants are folded here rather than left to Go, whose
+// constant arithmetic is exact where the evaluator rounds at every step.
+func goConstant(v float64) goValue {
+	value := goValue{width: 1, prec: goAtom, constant: true, value: v}
+	switch {
+	case math.IsNaN(v):
+		value.code = "math.NaN()"
+	case math.IsInf(v, 0):
+		value.code = fmt.Sprintf("math.Inf(%d)", int(math.Copysign(1, v)))
+	case v == 0 && math.Signbit(v):
+		value.code = "math.Copysign(0, -1)"
+	default:
+		value.code = strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(value.code, ".e") {
+			value.code += ".0"
+		}
+		if v < 0 {
+			value.prec = goUnary
+		}
+	}
+	return value
+}
+
+// goDecl is a variable the generated Iterate declares with text, which may turn out unused and
+// have to go. writes counts the lines that only assign to it, which Go does not count as uses,
+// and drop says its declaration is pure, so an unused one can simply be deleted.
+type goDecl struct {
+	name   string
+	text   string
+	writes int
+	drop   bool
+}
+
+type goLocal struct {
+	name  string
+	value goValue
+}
+
+// goGen generates one iteration. lines is Iterate's body as generated so far and preamble the
+// reads of the step's globals that go before it; fields, configure and locals are the
+// struct's fields, the lines of Configure and the names Iterate has taken.
+type goGen struct {
+	e         *ExpressionIteration
+	spec      ExpressionGoSpec
+	functions map[string]*parsedExprFunction
+	offsets   []int
+	recv      string
+	lines     []string
+	preamble  []string
+	fields    []string
+	configure []string
+	members   map[string]bool
+	locals    map[string]bool
+	decls     []goDecl
+	globals   map[string]goValue
+	scope     []goLocal
+	inlining  []string
+	upstreams map[string]string
+	sampler   bool
+}
+
+// goReserved are the names generated code uses for its own purposes.
+var goReserved = []string{
+	"append", "cap", "clear", "close", "complex", "copy", "delete", "imag", "len", "make", "max",
+	"min", "new", "panic", "print", "println", "real", "recover", "bool", "byte", "complex64",
+	"complex128", "error", "float32", "float64", "int", "int8", "int16", "int32", "int64",
+	"rune", "string", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "true", "false",
+	"iota", "nil", "any", "comparable", "math", "general", "simulator", "rng", "distuv",
+	"params", "partitionIndex", "stateHistories", "timestepsHistory", "settings", "state",
+	"i", "N", "P", "Src",
+}
+
+func newGoGen(e *ExpressionIteration, spec ExpressionGoSpec) *goGen {
+	g := &goGen{
+		e:         e,
+		spec:      spec,
+		members:   map[string]bool{"out": true, "sampler": true},
+		locals:    make(map[string]bool),
+		globals:   make(map[string]goValue),
+		upstreams: make(map[string]string),
+	}
+	for _, name := range goReserved {
+		g.locals[name] = true
+	}
+	g.recv = strings.ToLower(spec.Type[:1])
+	g.locals[g.recv] = true
+	g.offsets = make([]int, len(e.Fields))
+	for i := 1; i < len(e.Fields); i++ {
+		g.offsets[i] = g.offsets[i-1] + e.fieldWidth(i-1)
+	}
+	functions, _ := e.parseExprFunctions()
+	g.functions = functions
+	return g
+}
+
+func (g *goGen) fail(format string, args ...any) {
+	panic(exprCodegenError(fmt.Sprintf(format, args...)))
+}
+
+func (g *goGen) line(format string, args ...any) {
+	g.lines = append(g.lines, fmt.Sprintf(format, args...))
+}
+
+// capture runs f and takes back the lines it generated, for placing inside a block.
+func (g *goGen) capture(f func()) []string {
+	start := len(g.lines)
+	f()
+	captured := slices.Clone(g.lines[start:])
+	g.lines = g.lines[:start]
+	return captured
+}
+
+// goName is name in Go's camel case.
+func goName(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range name {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			upper = b.Len() > 0
+		case upper:
+			b.WriteRune(unicode.ToUpper(r))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	s := b.String()
+	if s == "" || !unicode.IsLetter([]rune(s)[0]) {
+		s = "v" + s
+	}
+	return s
+}
+
+// unique takes a name like base from taken, numbering it if base is taken already.
+func unique(taken map[string]bool, base string) string {
+	name := goName(base)
+	if token.Lookup(name).IsKeyword() || taken[name] {
+		for k := 2; ; k++ {
+			if candidate := name + strconv.Itoa(k); !taken[candidate] {
+				name = candidate
+				break
+			}
+		}
+	}
+	taken[name] = true
+	return name
+}
+
+// local takes a fresh variable name in Iterate.
+func (g *goGen) local(base string) string {
+	return unique(g.locals, base)
+}
+
+// result is the variable a construct stores its value in: hint, the name of the binding it is
+// the whole of, when there is one.
+func (g *goGen) result(hint, fallback string) string {
+	if hint != "" {
+		return hint
+	}
+	return g.local(fallback)
+}
+
+// declare generates name := code as a line of Iterate.
+func (g *goGen) declare(name, code string, writes int, drop bool) {
+	text := name + " := " + code
+	g.line("%s", text)
+	g.decls = append(g.decls, goDecl{name: name, text: text, writes: writes, drop: drop})
+}
+
+// member adds a field to the iteration's struct.
+func (g *goGen) member(base, typ string) string {
+	name := unique(g.members, base)
+	g.fields = append(g.fields, name+" "+typ)
+	return name
+}
+
+// buffer adds a []float64 field for a value of the given width, sized in Configure when the
+// width is known.
+func (g *goGen) buffer(base string, width int) string {
+	if base == "" {
+		base = "buffer"
+	}
+	name := g.member(base, "[]float64")
+	if width >= 0 {
+		g.configure = append(g.configure, fmt.Sprintf("%s.%s = make([]float64, %d)", g.recv, name, width))
+	}
+	return name
+}
+
+// vector declares a variable holding a fresh buffer of the given width, computed by
+// widthCode when it is not known, for a loop to fill.
+func (g *goGen) vector(hint string, width int, widthCode string) string {
+	name := g.result(hint, "v")
+	field := g.buffer(hint, width)
+	if width >= 0 {
+		g.declare(name, g.recv+"."+field, 0, false)
+	} else {
+		g.declare(name, fmt.Sprintf("general.ExpressionTake(&%s.%s, %s)", g.recv, field,
+			widthCode), 0, false)
+	}
+	return name
+}
+
+// paren is v's code, parenthesised if it binds looser than prec.
+func paren(v goValue, prec int) string {
+	if v.prec < prec {
+		return "(" + v.code + ")"
+	}
+	return v.code
+}
+
+// infix is a op b. The right operand is parenthesised at equal precedence too, since floating
+// point arithmetic does not reassociate.
+func infix(op string, prec int, a, b goValue) goValue {
+	return goValue{code: paren(a, prec) + " " + op + " " + paren(b, prec+1), width: 1, prec: prec}
+}
+
+// truth is v as a Go bool.
+func truth(v goValue) string {
+	if v.truth != "" {
+		return v.truth
+	}
+	return infix("!=", goCompare, v, goConstant(0)).code
+}
+
+// goBool is a 0 or 1 from the Go bool b.
+func goBool(b string) goValue {
+	v := goScalar("general.ExpressionBool(" + b + ")")
+	v.truth = b
+	return v
+}
+
+// call is fn applied to args, or, when they are all constants and fold is given, its value.
+func call(fn string, fold func(...float64) float64, args ...goValue) goValue {
+	codes := make([]string, len(args))
+	values := make([]float64, len(args))
+	constant := fold != nil
+	for i, a := range args {
+		codes[i], values[i] = a.code, a.value
+		constant = constant && a.constant
+	}
+	if constant {
+		return goConstant(fold(values...))
+	}
+	return goScalar(fn + "(" + strings.Join(codes, ", ") + ")")
+}
+
+// goSimple matches a scalar cheap enough to leave in a loop: a name, or one indexed by a number.
+var goSimple = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*(\[[0-9]+\])?$`)
+
+// hoist gives a computed scalar a variable, so a loop neither recomputes it per element nor,
+// by short-circuiting, skips a check the evaluator makes before it loops.
+func (g *goGen) hoist(v goValue) goValue {
+	if v.width != 1 || v.constant || goSimple.MatchString(v.code) {
+		return v
+	}
+	name := g.local("s")
+	g.declare(name, v.code, 0, true)
+	return goScalar(name)
+}
+
+// materialize computes a value left as its elements into a buffer.
+func (g *goGen) materialize(v goValue, hint string) goValue {
+	if !v.elements {
+		return v
+	}
+	out := g.vector(hint, v.width, "")
+	g.line("for i := range %s {", out)
+	g.line("%s[i] = %s", out, v.code)
+	g.line("}")
+	return goValue{code: out, width: v.width, prec: goAtom}
+}
+
+// settle is v ready for elem in a loop over a width-width value.
+func (g *goGen) settle(v goValue, width int) goValue {
+	if v.elements && v.width != width {
+		return g.materialize(v, "")
+	}
+	return g.hoist(v)
+}
+
+// asVector is v as a []float64, putting a scalar in a width-1 buffer.
+func (g *goGen) asVector(v goValue) string {
+	v = g.materialize(v, "")
+	if v.width != 1 {
+		return v.code
+	}
+	name := g.local("one")
+	g.declare(name, g.recv+"."+g.buffer("one", 1), 0, false)
+	g.line("%s[0] = %s", name, v.code)
+	return name
+}
+
+// widthCode is v's width as a Go int.
+func widthCode(v goValue) string {
+	if v.width >= 0 {
+		return strconv.Itoa(v.width)
+	}
+	return "len(" + v.code + ")"
+}
+
+// elem is element i of v in a loop over a width-width value.
+func elem(v goValue, width int) goValue {
+	switch {
+	case v.elements:
+		return goValue{code: v.code, width: 1, prec: v.prec, truth: v.truth}
+	case v.width == 1:
+		return v
+	case v.width >= 0 && v.width == width:
+		return goScalar(v.code + "[i]")
+	}
+	return goScalar("general.ExpressionAt(" + v.code + ", i)")
+}
+
+// broadcast is the width args combine to, and the Go computing it when it is not known.
+func (g *goGen) broadcast(what string, args []goValue) (int, string) {
+	width, code := 1, "1"
+	for _, a := range args {
+		switch {
+		case a.width == 1:
+		case width == 1 && a.width >= 0:
+			width, code = a.width, strconv.Itoa(a.width)
+		case width >= 0 && a.width >= 0:
+			if width != a.width {
+				g.fail("cannot combine widths %d and %d in %s", width, a.width, what)
+			}
+		case width == 1:
+			width, code = -1, widthCode(a)
+		default:
+			width, code = -1, fmt.Sprintf("general.ExpressionBroadcast(%s, %s, %q)", code,
+				widthCode(a), what)
+		}
+	}
+	return width, code
+}
+
+// elementwise is the pure f applied to the broadcast elements of args: f of args itself when
+// they are all scalars, f of their elements when the width is known, which the value's user
+// computes, and otherwise a loop filling a fresh vector.
+func (g *goGen) elementwise(
+	hint, what string,
+	f func(x []goValue) goValue,
+	args ...goValue,
+) goValue {
+	if !slices.ContainsFunc(args, func(a goValue) bool { return a.width != 1 }) {
+		return f(args)
+	}
+	if width, _ := g.broadcast(what, args); width > 1 && hint == "" {
+		elems := make([]goValue, len(args))
+		for k, a := range args {
+			elems[k] = elem(g.settle(a, width), width)
+		}
+		v := f(elems)
+		v.width, v.elements, v.constant = width, true, false
+		return v
+	}
+	return g.loop(hint, what, f, args...)
+}
+
+// loop is f applied to the broadcast elements of args, filling a fresh vector.
+func (g *goGen) loop(
+	hint, what string,
+	f func(x []goValue) goValue,
+	args ...goValue,
+) goValue {
+	width, code := g.broadcast(what, args)
+	elems := make([]goValue, len(args))
+	for k, a := range args {
+		elems[k] = elem(g.settle(a, width), width)
+	}
+	out := g.vector(hint, width, code)
+	g.line("for i := range %s {", out)
+	g.line("%s[i] = %s", out, f(elems).code)
+	g.line("}")
+	return goValue{code: out, width: width, prec: goAtom}
+}
+
+// scalar is v where a scalar is required, checked at run time when its width is not known.
+func (g *goGen) scalar(v goValue, message string) goValue {
+	switch {
+	case v.width == 1:
+		return v
+	case v.width < 0:
+		return goScalar(fmt.Sprintf("general.ExpressionScalar(%s, %q)", v.code, message))
+	}
+	g.fail("%s", message)
+	return v
+}
+
+// count is a lane count or a width, at least least: a number when it is a constant, and
+// otherwise a variable checked at run time.
+func (g *goGen) count(v goValue, what string, least int) (int, string) {
+	v = g.scalar(v, what+" must be a scalar")
+	if v.constant {
+		if math.IsNaN(v.value) || math.IsInf(v.value, 0) {
+			g.fail("%s is %v, which is not a whole number", what, v.value)
+		}
+		n := int(v.value)
+		if n < least {
+			g.fail("%s must be at least %d", what, least)
+		}
+		return n, strconv.Itoa(n)
+	}
+	name := g.local("n")
+	g.declare(name, fmt.Sprintf("general.ExpressionCount(%s, %q)", v.code, what), 0, false)
+	if least == 0 {
+		g.line("if %s < 0 { panic(%q) }", name, "expression: "+what+" must not be negative")
+	} else {
+		g.line("if %s < %d { panic(%q) }", name, least,
+			fmt.Sprintf("expression: %s must be at least %d", what, least))
+	}
+	return -1, name
+}
+
+// gen generates node, naming what it stores its value in hint when that is not empty.
+func (g *goGen) gen(node ast.Expr, hint string) goValue {
+	return g.materialize(g.genElements(node, hint), hint)
+}
+
+// genElements generates node for an elementwise use, which may leave it as its elements.
+func (g *goGen) genElements(node ast.Expr, hint string) goValue {
+	switch n := node.(type) {
+	case *ast.BasicLit:
+		v, err := strconv.ParseFloat(n.Value, 64)
+		if err != nil {
+			g.fail("bad numeric literal %s", n.Value)
+		}
+		return goConstant(v)
+	case *ast.Ident:
+		return g.ident(n.Name)
+	case *ast.ParenExpr:
+		return g.genElements(n.X, hint)
+	case *ast.UnaryExpr:
+		x := g.genElements(n.X, "")
+		switch n.Op {
+		case token.ADD:
+			return x
+		case token.SUB:
+			return g.elementwise(hint, "-", func(x []goValue) goValue {
+				if x[0].constant {
+					return goConstant(-x[0].value)
+				}
+				return goValue{code: "-" + paren(x[0], goUnary+1), width: 1, prec: goUnary}
+			}, x)
+		case token.NOT:
+			return g.elementwise(hint, "!", func(x []goValue) goValue {
+				return goBool(infix("==", goCompare, x[0], goConstant(0)).code)
+			}, x)
+		}
+	case *ast.IndexExpr:
+		return g.index(g.gen(n.X, ""), g.gen(n.Index, ""))
+	case *ast.BinaryExpr:
+		return g.binary(n, hint)
+	case *ast.CallExpr:
+		return g.call(n, hint)
+	}
+	g.fail("unsupported syntax")
+	return goValue{}
+}
+
+// ident resolves name as Iterate does: lane variables and bindings innermost first, then the
+// clock, upstream aliases, params, tables and fields, each read once per step.
+func (g *goGen) ident(name string) goValue {
+	for i := len(g.scope) - 1; i >= 0; i-- {
+		if g.scope[i].name == name {
+			return g.scope[i].value
+		}
+	}
+	if name == "pi" {
+		pi := goConstant(math.Pi)
+		pi.code = "math.Pi"
+		return pi
+	}
+	if len(g.inlining) > 0 {
+		g.fail("function %s has no parameter %s; a function sees only its parameters and pi",
+			g.inlining[len(g.inlining)-1], name)
+	}
+	if v, ok := g.globals[name]; ok {
+		return v
+	}
+	v := g.global(name)
+	g.globals[name] = v
+	return v
+}
+
+// read declares a global's variable at the top of Iterate.
+func (g *goGen) read(name, code string, width int) goValue {
+	local := g.local(name)
+	text := local + " := " + code
+	g.preamble = append(g.preamble, text)
+	g.decls = append(g.decls, goDecl{name: local, text: text, drop: true})
+	return goValue{code: local, width: width, prec: goAtom}
+}
+
+func (g *goGen) global(name string) goValue {
+	switch name {
+	case "dt":
+		return g.read(name, "timestepsHistory.NextIncrement", 1)
+	case "t":
+		return g.read(name, "timestepsHistory.Values.AtVec(0)", 1)
+	case "step":
+		return g.read(name, "float64(timestepsHistory.CurrentStepNumber)", 1)
+	}
+	if partition, ok := g.e.Upstreams[name]; ok {
+		history := "stateHistories[" + g.recv + "." + g.upstream(name) + "]"
+		width := -1
+		if shape, ok := g.spec.Shapes.Partitions[partition]; ok {
+			width = shape.StateWidth
+		}
+		if width == 1 {
+			return g.read(name, history+".Values.At(0, 0)", 1)
+		}
+		return g.read(name, history+".Values.RawRowView(0)", width)
+	}
+	if width, ok := g.spec.Shapes.Params[name]; ok {
+		if width == 1 {
+			return g.read(name, fmt.Sprintf("params.Map[%q][0]", name), 1)
+		}
+		return g.read(name, fmt.Sprintf("params.Map[%q]", name), max(width, -1))
+	}
+	if values, ok := g.e.Tables[name]; ok {
+		if len(values) == 1 {
+			return goConstant(values[0])
+		}
+		field := g.member(name, "[]float64")
+		codes := make([]string, len(values))
+		for i, v := range values {
+			codes[i] = goConstant(v).code
+		}
+		g.configure = append(g.configure, fmt.Sprintf("%s.%s = []float64{%s}", g.recv, field,
+			strings.Join(codes, ", ")))
+		return goValue{code: g.recv + "." + field, width: len(values), prec: goAtom}
+	}
+	for i, f := range g.e.Fields {
+		if f.Name != name {
+			continue
+		}
+		state := g.state()
+		offset, width := g.offsets[i], g.e.fieldWidth(i)
+		if width == 1 {
+			return g.read(name, fmt.Sprintf("%s[%d]", state, offset), 1)
+		}
+		return g.read(name, fmt.Sprintf("%s[%d:%d]", state, offset, offset+width), width)
+	}
+	g.fail("unknown name %s", name)
+	return goValue{}
+}
+
+// state declares this partition's current row, once.
+func (g *goGen) state() string {
+	if _, ok := g.globals["\x00state"]; !ok {
+		text := "state := stateHistories[partitionIndex].Values.RawRowView(0)"
+		g.preamble = append(g.preamble, text)
+		g.decls = append(g.decls, goDecl{name: "state", text: text, drop: true})
+		g.globals["\x00state"] = goScalar("state")
+	}
+	return "state"
+}
+
+// upstream is the field holding an upstream alias's partition index, which Configure
+// resolves by name.
+func (g *goGen) upstream(alias string) string {
+	if field, ok := g.upstreams[alias]; ok {
+		return field
+	}
+	field := g.member(alias, "int")
+	g.upstreams[alias] = field
+	g.configure = append(g.configure, fmt.Sprintf("%s.%s = general.ExpressionUpstream(settings, %q, %q)",
+		g.recv, field, g.e.Upstreams[alias], alias))
+	return field
+}
+
+// index is v[i], bounds-checked as the evaluator checks it unless it is known to be in range.
+func (g *goGen) index(v, i goValue) goValue {
+	i = g.scalar(i, "index must be a scalar")
+	if i.constant && !math.IsNaN(i.value) && !math.IsInf(i.value, 0) {
+		k := int(i.value)
+		if v.width >= 0 && (k < 0 || k >= v.width) {
+			g.fail("index %d out of range for width %d", k, v.width)
+		}
+		if v.width == 1 {
+			return v
+		}
+		if v.width >= 0 {
+			return goScalar(fmt.Sprintf("%s[%d]", v.code, k))
+		}
+	}
+	if v.width == 1 {
+		g.line("_ = general.ExpressionIndex(%s, 1)", i.code)
+		return v
+	}
+	return goScalar(fmt.Sprintf("%s[general.ExpressionIndex(%s, %s)]", v.code, i.code, widthCode(v)))
+}
+
+func (g *goGen) binary(n *ast.BinaryExpr, hint string) goValue {
+	if n.Op == token.LAND || n.Op == token.LOR {
+		return g.logical(n, hint)
+	}
+	op := n.Op.String()
+	l, r := g.genElements(n.X, ""), g.genElements(n.Y, "")
+	switch n.Op {
+	case token.ADD, token.SUB, token.MUL, token.QUO:
+		return g.elementwise(hint, op, func(x []goValue) goValue {
+			a, b := x[0], x[1]
+			if a.constant && b.constant {
+				switch n.Op {
+				case token.ADD:
+					return goConstant(a.value + b.value)
+				case token.SUB:
+					return goConstant(a.value - b.value)
+				case token.MUL:
+					return goConstant(a.value * b.value)
+				}
+				return goConstant(a.value / b.value)
+			}
+			if n.Op == token.QUO && b.constant && b.value == 0 {
+				// Go rejects a division by a constant zero, which to a float64 is a
+				// multiplication by the infinity of its sign.
+				return infix("*", goMul, a, goConstant(math.Copysign(math.Inf(1), b.value)))
+			}
+			prec := goAdd
+			if n.Op == token.MUL || n.Op == token.QUO {
+				prec = goMul
+			}
+			return infix(op, prec, a, b)
+		}, l, r)
+	case token.REM:
+		return g.elementwise(hint, op, func(x []goValue) goValue {
+			return call("math.Mod", func(v ...float64) float64 { return math.Mod(v[0], v[1]) }, x...)
+		}, l, r)
+	case token.LSS, token.GTR, token.LEQ, token.GEQ, token.EQL, token.NEQ:
+		return g.elementwise(hint, op, func(x []goValue) goValue {
+			return goBool(infix(op, goCompare, x[0], x[1]).code)
+		}, l, r)
+	}
+	g.fail("unsupported operator %s", op)
+	return goValue{}
+}
+
+// logical generates && and ||, which short-circuit on a scalar left side.
+func (g *goGen) logical(n *ast.BinaryExpr, hint string) goValue {
+	and := n.Op == token.LAND
+	op := n.Op.String()
+	l := g.genElements(n.X, "")
+	switch {
+	case l.width < 0:
+		g.fail("codegen needs to know whether the left side of %s is a scalar; give it a "+
+			"fixed width", op)
+	case l.width > 1:
+		r := g.genElements(n.Y, "")
+		return g.elementwise(hint, op, func(x []goValue) goValue {
+			return goBool(truth(x[0]) + " " + op + " " + truth(x[1]))
+		}, l, r)
+	}
+	var r goValue
+	lines := g.capture(func() { r = g.gen(n.Y, "") })
+	if r.width != 1 {
+		g.fail("codegen cannot generate %s of a scalar and a vector yet; keep this partition "+
+			"declarative", op)
+	}
+	if len(lines) == 0 {
+		return goBool(truth(l) + " " + op + " " + truth(r))
+	}
+	name := g.result(hint, "both")
+	if and {
+		g.line("var %s float64", name)
+		g.line("if %s {", truth(l))
+	} else {
+		g.line("%s := 1.0", name)
+		g.line("if !(%s) {", truth(l))
+	}
+	g.lines = append(g.lines, lines...)
+	g.line("%s = general.ExpressionBool(%s)", name, truth(r))
+	g.line("}")
+	g.decls = append(g.decls, goDecl{name: name, text: g.lines[len(g.lines)-len(lines)-3],
+		writes: 1})
+	if !and {
+		g.decls[len(g.decls)-1].text = g.lines[len(g.lines)-len(lines)-3]
+	}
+	return goScalar(name)
+}
+
+func (g *goGen) call(n *ast.CallExpr, hint string) goValue {
+	ident, ok := n.Fun.(*ast.Ident)
+	if !ok {
+		g.fail("unsupported call target")
+	}
+	name := ident.Name
+	if f, ok := g.functions[name]; ok {
+		return g.inline(f, n, hint)
+	}
+	switch name {
+	case "where":
+		return g.where(n, hint)
+	case "shared":
+		return g.genElements(n.Args[0], hint)
+	case "iid", "each":
+		return g.lanes(name, n, hint)
+	case "scan":
+		return g.scan(n, hint)
+	case "lag":
+		return g.lag(n)
+	case "concat":
+		return g.concat(n, hint)
+	}
+	if exprTableFunctions[name] || exprMatrixFunctions[name] || exprOrderFunctions[name] ||
+		exprDistributions[name] || name == "neighbours_sum" || name == "laplacian" {
+		g.fail("codegen does not generate %s yet; keep this partition declarative", name)
+	}
+	if _, ok := exprArity[name]; !ok {
+		g.fail("unknown function %s", name)
+	}
+	args := make([]goValue, len(n.Args))
+	for i, arg := range n.Args {
+		args[i] = g.genElements(arg, "")
+	}
+	switch name {
+	case "clamp":
+		return g.elementwise(hint, name, func(x []goValue) goValue {
+			lower := call("math.Max", func(v ...float64) float64 { return math.Max(v[0], v[1]) },
+				x[0], x[1])
+			return call("math.Min", func(v ...float64) float64 { return math.Min(v[0], v[1]) },
+				lower, x[2])
+		}, args...)
+	case "min", "max", "pow", "atan2":
+		fn := map[string]func(a, b float64) float64{
+			"min": math.Min, "max": math.Max, "pow": math.Pow, "atan2": math.Atan2}[name]
+		goFn := "math." + strings.ToUpper(name[:1]) + name[1:]
+		return g.elementwise(hint, name, func(x []goValue) goValue {
+			return call(goFn, func(v ...float64) float64 { return fn(v[0], v[1]) }, x...)
+		}, args...)
+	case "fill":
+		width, code := g.count(args[0], "fill's width", 1)
+		if width == 1 {
+			return g.index(g.materialize(args[1], ""), goConstant(0))
+		}
+		x := elem(g.settle(args[1], width), width)
+		out := g.vector(hint, width, code)
+		g.line("for i := range %s {", out)
+		g.line("%s[i] = %s", out, x.code)
+		g.line("}")
+		return goValue{code: out, width: width, prec: goAtom}
+	case "slice":
+		return g.slice(g.materialize(args[0], ""), args[1], args[2])
+	case "width":
+		if args[0].width >= 0 {
+			return goConstant(float64(args[0].width))
+		}
+		return goScalar("float64(len(" + args[0].code + "))")
+	case "sum":
+		if args[0].width == 1 {
+			return args[0]
+		}
+		total := g.result(hint, "total")
+		g.declare(total, "0.0", 1, false)
+		if args[0].elements {
+			g.line("for i := 0; i < %d; i++ { %s += %s }", args[0].width, total, args[0].code)
+		} else {
+			g.line("for i := range %s { %s += %s[i] }", args[0].code, total, args[0].code)
+		}
+		return goScalar(total)
+	case "dot":
+		if args[0].width == 1 && args[1].width == 1 {
+			return infix("*", goMul, args[0], args[1])
+		}
+		width, code := g.broadcast(name, args)
+		a, b := elem(g.settle(args[0], width), width), elem(g.settle(args[1], width), width)
+		total := g.result(hint, "total")
+		g.declare(total, "0.0", 1, false)
+		g.line("for i := 0; i < %s; i++ { %s += %s }", code, total,
+			infix("*", goMul, a, b).code)
+		return goScalar(total)
+	case "normal", "uniform", "gamma", "beta", "binomial", "exponential", "poisson":
+		return g.draw(name, hint, args)
+	}
+	fn := exprMath[name]
+	goFn := "math." + strings.ToUpper(name[:1]) + name[1:]
+	return g.elementwise(hint, name, func(x []goValue) goValue {
+		return call(goFn, func(v ...float64) float64 { return fn(v[0]) }, x...)
+	}, args...)
+}
+
+// draw generates a draw from the sampler: one statement for a scalar draw, which never moves
+// from where the evaluator takes it, or a loop of them.
+func (g *goGen) draw(name, hint string, args []goValue) goValue {
+	if !g.sampler {
+		g.sampler = true
+		g.fields = append(g.fields, "sampler *rng.Sampler")
+		g.configure = append(g.configure,
+			g.recv+".sampler = rng.New(settings.Iterations[partitionIndex].Seed)")
+	}
+	sample := func(x []goValue) string {
+		if name == "binomial" {
+			return fmt.Sprintf("distuv.Binomial{N: %s, P: %s, Src: %s.sampler.Rand()}.Rand()",
+				x[0].code, x[1].code, g.recv)
+		}
+		codes := make([]string, len(x))
+		for i, v := range x {
+			codes[i] = v.code
+		}
+		return fmt.Sprintf("%s.sampler.%s%s(%s)", g.recv, strings.ToUpper(name[:1]), name[1:],
+			strings.Join(codes, ", "))
+	}
+	if !slices.ContainsFunc(args, func(a goValue) bool { return a.width != 1 }) {
+		d := g.result(hint, "draw")
+		g.declare(d, sample(args), 0, false)
+		return goScalar(d)
+	}
+	return g.loop(hint, name, func(x []goValue) goValue {
+		return goScalar(sample(x))
+	}, args...)
+}
+
+// where is lazy on a scalar condition, generating each branch inside its arm of an if, and
+// selects elementwise, evaluating both, on a vector one.
+func (g *goGen) where(n *ast.CallExpr, hint string) goValue {
+	cond := g.genElements(n.Args[0], "")
+	switch {
+	case cond.width < 0:
+		g.fail("codegen needs to know whether where's condition is a scalar; give it a " +
+			"fixed width")
+	case cond.width != 1:
+		branches := []goValue{g.genElements(n.Args[1], ""), g.genElements(n.Args[2], "")}
+		for k, which := range []string{"then", "else"} {
+			branch := g.settle(branches[k], cond.width)
+			switch {
+			case branch.width < 0:
+				name := g.local(which)
+				g.declare(name, fmt.Sprintf("general.ExpressionBranch(%s, %q, %d)", branch.code,
+					which, cond.width), 0, false)
+				branch.code = name
+			case branch.width != 1 && branch.width != cond.width:
+				g.fail("where's %s branch has width %d, which is neither the condition's %d "+
+					"nor 1", which, branch.width, cond.width)
+			}
+			branches[k] = elem(branch, cond.width)
+		}
+		out := g.vector(hint, cond.width, "")
+		g.line("for i := range %s {", out)
+		g.line("if %s { %s[i] = %s } else { %s[i] = %s }", truth(elem(cond, cond.width)), out,
+			branches[0].code, out, branches[1].code)
+		g.line("}")
+		return goValue{code: out, width: cond.width, prec: goAtom}
+	}
+	var a, b goValue
+	thenLines := g.capture(func() { a = g.gen(n.Args[1], "") })
+	elseLines := g.capture(func() { b = g.gen(n.Args[2], "") })
+	if len(thenLines) == 0 && len(elseLines) == 0 && a.constant && b.constant &&
+		a.value == b.value {
+		return a
+	}
+	name := g.result(hint, "chosen")
+	result := goScalar(name)
+	typ := "float64"
+	if a.width != 1 || b.width != 1 {
+		typ = "[]float64"
+		result.width = -1
+		if a.width == b.width {
+			result.width = a.width
+		}
+		thenLines = append(thenLines, g.capture(func() { a = goScalar(g.asVector(a)) })...)
+		elseLines = append(elseLines, g.capture(func() { b = goScalar(g.asVector(b)) })...)
+	}
+	text := "var " + name + " " + typ
+	g.line("%s", text)
+	g.decls = append(g.decls, goDecl{name: name, text: text, writes: 2})
+	g.line("if %s {", truth(cond))
+	g.lines = append(g.lines, thenLines...)
+	g.line("%s = %s", name, a.code)
+	g.line("} else {")
+	g.lines = append(g.lines, elseLines...)
+	g.line("%s = %s", name, b.code)
+	g.line("}")
+	return result
+}
+
+// lanes generates iid and each, a loop filling one element per lane.
+func (g *goGen) lanes(name string, n *ast.CallExpr, hint string) goValue {
+	width, code := g.count(g.gen(n.Args[0], ""), name+"'s count", 1)
+	out := g.vector(hint, width, code)
+	lane := g.local("lane")
+	g.line("for %s := range %s {", lane, out)
+	var body goValue
+	if name == "each" {
+		index, ok := n.Args[1].(*ast.Ident)
+		if !ok {
+			g.fail("each's second argument must be a name to bind the lane index to")
+		}
+		variable := g.local(index.Name)
+		g.declare(variable, "float64("+lane+")", 0, true)
+		g.scope = append(g.scope, goLocal{index.Name, goScalar(variable)})
+		body = g.scalar(g.gen(n.Args[2], ""), "each expects a scalar-valued expression per lane")
+		g.scope = g.scope[:len(g.scope)-1]
+	} else {
+		body = g.scalar(g.gen(n.Args[1], ""), "iid expects a scalar-valued expression")
+	}
+	g.line("%s[%s] = %s", out, lane, body.code)
+	g.line("}")
+	if width == 1 {
+		return goScalar(out + "[0]")
+	}
+	return goValue{code: out, width: width, prec: goAtom}
+}
+
+// scan generates a fold: a loop threading an accumulator, which is a float64 when init and
+// every lane are scalars, and otherwise alternates between two buffers, since a lane reads the
+// accumulator while writing the next one.
+func (g *goGen) scan(n *ast.CallExpr, hint string) goValue {
+	_, count := g.count(g.gen(n.Args[0], ""), "scan's count", 0)
+	index, ok := n.Args[1].(*ast.Ident)
+	accumulator, ok2 := n.Args[2].(*ast.Ident)
+	if !ok || !ok2 || index.Name == accumulator.Name {
+		g.fail("scan's second and third arguments must be two names, as in scan(40, i, acc, 0, ...)")
+	}
+	init := g.gen(n.Args[3], "")
+	acc := g.result(hint, accumulator.Name)
+	lane := g.local("lane")
+	body := func(accWidth int) (goValue, []string) {
+		var v goValue
+		lines := g.capture(func() {
+			variable := g.local(index.Name)
+			g.declare(variable, "float64("+lane+")", 0, true)
+			g.scope = append(g.scope, goLocal{index.Name, goScalar(variable)},
+				goLocal{accumulator.Name, goValue{code: acc, width: accWidth, prec: goAtom}})
+			v = g.gen(n.Args[4], "")
+			g.scope = g.scope[:len(g.scope)-2]
+		})
+		return v, lines
+	}
+	v, lines := body(init.width)
+	if v.width == 1 && init.width == 1 {
+		g.declare(acc, init.code, 1, false)
+		g.line("for %s := 0; %s < %s; %s++ {", lane, lane, count, lane)
+		g.lines = append(g.lines, lines...)
+		g.line("%s = %s", acc, v.code)
+		g.line("}")
+		return goScalar(acc)
+	}
+	width := init.width
+	if v.width != init.width {
+		width = -1
+		v, lines = body(-1)
+	}
+	accumulated := g.member(acc+"Lanes", "[2][]float64")
+	g.declare(acc, g.asVector(init), 1, false)
+	g.line("for %s := 0; %s < %s; %s++ {", lane, lane, count, lane)
+	g.lines = append(g.lines, lines...)
+	next := fmt.Sprintf("%s.%s[%s%%2]", g.recv, accumulated, lane)
+	if v.width == 1 {
+		g.line("%s = append(%s[:0], %s)", next, next, v.code)
+	} else {
+		g.line("%s = append(%s[:0], %s...)", next, next, v.code)
+	}
+	g.line("%s = %s", acc, next)
+	g.line("}")
+	return goValue{code: acc, width: width, prec: goAtom}
+}
+
+// lag reads an upstream's or a field's committed state some rows back.
+func (g *goGen) lag(n *ast.CallExpr) goValue {
+	target, ok := n.Args[0].(*ast.Ident)
+	if !ok {
+		g.fail("lag's first argument must be an upstream alias or a field name")
+	}
+	row := g.scalar(g.gen(n.Args[1], ""), "lag's row must be a scalar")
+	var history, from, width string
+	w := -1
+	if partition, ok := g.e.Upstreams[target.Name]; ok {
+		history = "stateHistories[" + g.recv + "." + g.upstream(target.Name) + "]"
+		from, width = "0", history+".StateWidth"
+		if shape, ok := g.spec.Shapes.Partitions[partition]; ok {
+			w = shape.StateWidth
+			width = strconv.Itoa(w)
+		}
+	} else {
+		i := slices.IndexFunc(g.e.Fields, func(f ExpressionField) bool {
+			return f.Name == target.Name
+		})
+		if i < 0 {
+			g.fail("lag needs an upstream alias or one of this partition's own fields, got %s",
+				target.Name)
+		}
+		w = g.e.fieldWidth(i)
+		history = "stateHistories[partitionIndex]"
+		from, width = strconv.Itoa(g.offsets[i]), strconv.Itoa(w)
+	}
+	code := fmt.Sprintf("general.ExpressionLag(%s, %q, %s, %s, %s)", history, target.Name,
+		row.code, from, width)
+	if w == 1 {
+		return goScalar(code + "[0]")
+	}
+	lagged := g.local(target.Name + "_lagged")
+	g.declare(lagged, code, 0, false)
+	return goValue{code: lagged, width: w, prec: goAtom}
+}
+
+// concat appends its parts to a buffer, which Configure sizes when their widths are known.
+func (g *goGen) concat(n *ast.CallExpr, hint string) goValue {
+	if len(n.Args) < 2 {
+		g.fail("concat takes at least 2 arguments, got %d", len(n.Args))
+	}
+	parts := make([]goValue, len(n.Args))
+	total := 0
+	for i, arg := range n.Args {
+		parts[i] = g.gen(arg, "")
+		if total >= 0 && parts[i].width >= 0 {
+			total += parts[i].width
+		} else {
+			total = -1
+		}
+	}
+	out := g.result(hint, "joined")
+	field := g.member(out, "[]float64")
+	if total >= 0 {
+		g.configure = append(g.configure, fmt.Sprintf("%s.%s = make([]float64, 0, %d)", g.recv,
+			field, total))
+	}
+	g.declare(out, g.recv+"."+field+"[:0]", len(parts), false)
+	for _, part := range parts {
+		if part.width == 1 {
+			g.line("%s = append(%s, %s)", out, out, part.code)
+		} else {
+			g.line("%s = append(%s, %s...)", out, out, part.code)
+		}
+	}
+	g.line("%s.%s = %s", g.recv, field, out)
+	if total == 1 {
+		return goScalar(out + "[0]")
+	}
+	return goValue{code: out, width: total, prec: goAtom}
+}
+
+// slice is a block of v: a Go slice expression when the block is known to be in range, and
+// otherwise a call checking it as the evaluator does.
+func (g *goGen) slice(v, start, size goValue) goValue {
+	start = g.scalar(start, "slice's start and width must be scalars")
+	size = g.scalar(size, "slice's start and width must be scalars")
+	width := -1
+	if size.constant {
+		width = int(size.value)
+		if width < 0 {
+			g.fail("slice's width must not be negative")
+		}
+	}
+	if start.constant && v.width >= 0 && width >= 0 {
+		from := int(start.value)
+		if from < 0 || from+width > v.width {
+			g.fail("slice(%d, %d) is outside a width-%d value", from, width, v.width)
+		}
+		switch {
+		case width == 0:
+			return goValue{code: "[]float64{}", width: 0, prec: goAtom}
+		case v.width == 1:
+			return v
+		case width == 1:
+			return goScalar(fmt.Sprintf("%s[%d]", v.code, from))
+		}
+		return goValue{code: fmt.Sprintf("%s[%d:%d]", v.code, from, from+width), width: width,
+			prec: goAtom}
+	}
+	code := fmt.Sprintf("general.ExpressionSlice(%s, %s, %s)", g.asVector(v), start.code,
+		size.code)
+	if width == 1 {
+		return goScalar(code + "[0]")
+	}
+	block := g.local("block")
+	g.declare(block, code, 0, false)
+	return goValue{code: block, width: width, prec: goAtom}
+}
+
+// inline generates a call to a user-defined function: the arguments in the caller's scope,
+// then the body with only the parameters in scope.
+func (g *goGen) inline(f *parsedExprFunction, n *ast.CallExpr, hint string) goValue {
+	if len(n.Args) != len(f.params) {
+		g.fail("%s takes %d arguments, got %d", f.name, len(f.params), len(n.Args))
+	}
+	params := make([]goLocal, len(f.params))
+	for i, arg := range n.Args {
+		v := g.gen(arg, "")
+		if v.prec != goAtom && !v.constant {
+			name := g.local(f.params[i])
+			g.declare(name, v.code, 0, false)
+			v = goValue{code: name, width: v.width, prec: goAtom}
+		}
+		params[i] = goLocal{f.params[i], v}
+	}
+	scope := g.scope
+	g.scope = params
+	g.inlining = append(g.inlining, f.name)
+	v := g.gen(f.body, hint)
+	g.inlining = g.inlining[:len(g.inlining)-1]
+	g.scope = scope
+	return v
+}
+
+// iteration generates the whole file: the struct, Configure and Iterate.
+func (g *goGen) iteration() []byte {
+	for _, b := range g.e.Bindings {
+		parsed, err := parser.ParseExpr(b.Expr)
+		if err != nil {
+			g.fail("parsing binding %s: %v", b.Name, err)
+		}
+		name := g.local(b.Name)
+		v := g.gen(parsed, name)
+		switch {
+		case v.constant && v.prec != goAtom || v.constant && !strings.Contains(v.code, "("):
+			g.line("const %s = %s", name, v.code)
+			v = goValue{code: name, width: 1, prec: goAtom, constant: true, value: v.value}
+		case v.constant:
+		case v.code != name:
+			g.declare(name, v.code, 0, false)
+			v = goValue{code: name, width: v.width, prec: goAtom}
+		}
+		g.scope = append(g.scope, goLocal{b.Name, v})
+	}
+	width := 0
+	for i, o := range g.e.Outputs {
+		parsed, err := parser.ParseExpr(o)
+		if err != nil {
+			g.fail("parsing output for field %s: %v", g.e.Fields[i].Name, err)
+		}
+		v := g.genElements(parsed, "")
+		offset, w := g.offsets[i], g.e.fieldWidth(i)
+		width = offset + w
+		if v.elements && v.width != w {
+			v = g.materialize(v, "")
+		}
+		switch {
+		case v.elements:
+			g.line("for i := 0; i < %d; i++ { %s.out[%d+i] = %s }", w, g.recv, offset, v.code)
+		case v.width == 1 && w == 1:
+			g.line("%s.out[%d] = %s", g.recv, offset, v.code)
+		case v.width == 1:
+			v = g.hoist(v)
+			g.line("for i := %d; i < %d; i++ { %s.out[i] = %s }", offset, offset+w, g.recv, v.code)
+		case v.width == w:
+			g.line("copy(%s.out[%d:%d], %s)", g.recv, offset, offset+w, v.code)
+		case v.width < 0:
+			g.line("general.ExpressionOutput(%s.out[%d:%d], %s, %q)", g.recv, offset, offset+w,
+				v.code, g.e.Fields[i].Name)
+		default:
+			g.fail("output for field %s produces width %d, want %d or 1", g.e.Fields[i].Name,
+				v.width, w)
+		}
+	}
+	g.configure = append([]string{fmt.Sprintf("%s.out = make([]float64, %d)", g.recv, width)},
+		g.configure...)
+	body := g.prune(append(slices.Clone(g.preamble), g.lines...))
+
+	fields := append([]string{"out []float64"}, g.fields...)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by stochadex codegen from %s, partition %s; DO NOT EDIT.\n\n",
+		g.spec.Config, g.spec.Partition)
+	fmt.Fprintf(&b, "package %s\n\n", g.spec.Package)
+	text := strings.Join(fields, "\n") + strings.Join(g.configure, "\n") + strings.Join(body, "\n")
+	b.WriteString("import (\n")
+	for _, imp := range []struct{ name, path string }{
+		{"math", `"math"`},
+		{"", ""},
+		{"distuv", `"gonum.org/v1/gonum/stat/distuv"`},
+		{"", ""},
+		{"general", `"github.com/umbralcalc/stochadex/pkg/general"`},
+		{"rng", `"github.com/umbralcalc/stochadex/pkg/rng"`},
+		{"simulator", `"github.com/umbralcalc/stochadex/pkg/simulator"`},
+	} {
+		switch {
+		case imp.name == "":
+			b.WriteString("\n")
+		case imp.name == "simulator" || regexp.MustCompile(`\b`+imp.name+`\.`).MatchString(text):
+			fmt.Fprintf(&b, "%s\n", imp.path)
+		}
+	}
+	b.WriteString(")\n\n")
+	b.WriteString(goComment(fmt.Sprintf("%s is the %s partition of %s with its expressions "+
+		"generated as Go. It computes what the declarative iteration computes from the same "+
+		"spec, draw for draw, for the widths that config gives its fields, params and "+
+		"upstreams, and must be regenerated when they change.", g.spec.Type, g.spec.Partition,
+		g.spec.Config)))
+	fmt.Fprintf(&b, "type %s struct {\n%s\n}\n\n", g.spec.Type, strings.Join(fields, "\n"))
+	does := []string{"sizes the buffers"}
+	if len(g.upstreams) > 0 {
+		does = append(does, "resolves the upstream partitions by name")
+	}
+	if g.sampler {
+		does = append(does, "seeds the sampler from the partition's seed")
+	}
+	if len(does) > 1 {
+		does[len(does)-2] += " and " + does[len(does)-1]
+		does = does[:len(does)-1]
+	}
+	b.WriteString(goComment("Configure " + strings.Join(does, ", ") + "."))
+	fmt.Fprintf(&b, "func (%s *%s) Configure(\npartitionIndex int,\nsettings *simulator.Settings,\n) {\n%s\n}\n\n",
+		g.recv, g.spec.Type, strings.Join(g.configure, "\n"))
+	b.WriteString(goComment("Iterate computes the next state from this step's fields, params, " +
+		"upstreams and clock."))
+	fmt.Fprintf(&b, "func (%s *%s) Iterate(\nparams *simulator.Params,\npartitionIndex int,\n"+
+		"stateHistories []*simulator.StateHistory,\n"+
+		"timestepsHistory *simulator.CumulativeTimestepsHistory,\n) []float64 {\n%s\nreturn %s.out\n}\n",
+		g.recv, g.spec.Type, strings.Join(body, "\n"), g.recv)
+	return b.Bytes()
+}
+
+// goComment is text as a line comment, wrapped to the width the repository's comments keep to.
+func goComment(text string) string {
+	var b strings.Builder
+	line := "//"
+	for _, word := range strings.Fields(text) {
+		if len(line)+1+len(word) > 96 && line != "//" {
+			b.WriteString(line + "\n")
+			line = "//"
+		}
+		line += " " + word
+	}
+	b.WriteString(line + "\n")
+	return b.String()
+}
+
+// prune settles every declaration that ended up unused, which Go rejects: a pure one is
+// deleted, and may leave others unused in turn, and any other is kept for what it does and
+// assigned to the blank identifier.
+func (g *goGen) prune(body []string) []string {
+	settled := make([]bool, len(g.decls))
+	for changed := true; changed; {
+		changed = false
+		uses := goIdentCounts(body)
+		for k, d := range g.decls {
+			if settled[k] || uses[d.name] > 1+d.writes {
+				continue
+			}
+			i := slices.Index(body, d.text)
+			if i < 0 {
+				settled[k] = true
+				continue
+			}
+			settled[k] = true
+			switch {
+			case d.drop:
+				body = slices.Delete(body, i, i+1)
+				changed = true
+			case strings.HasPrefix(d.text, d.name+" := "):
+				body[i] = "_ = " + strings.TrimPrefix(d.text, d.name+" := ")
+			default:
+				body = slices.Insert(body, i+1, "_ = "+d.name)
+			}
+		}
+	}
+	return body
+}
+
+// goIdentCounts counts the uses of each name in lines, leaving out field selections.
+func goIdentCounts(lines []string) map[string]int {
+	src := []byte(strings.Join(lines, "\n"))
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", fset.Base(), len(src)), src, nil, 0)
+	counts := make(map[string]int)
+	previous := token.ILLEGAL
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return counts
+		}
+		if tok == token.IDENT && previous != token.PERIOD {
+			counts[lit]++
+		}
+		previous = tok
+	}
+}
+
+// exprCodegenTest is the test generated beside an iteration.
+var exprCodegenTest = template.Must(template.New("test").Funcs(template.FuncMap{
+	"lower": func(s string) string { return strings.ToLower(s[:1]) + s[1:] },
+}).Parse(`// Code generated by stochadex codegen from {{.Config}}, partition {{.Partition}}; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/api"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// {{lower .Type}}Lockstep runs the declarative iteration, which drives the run, and hands the
+// generated one the same inputs every step, recording the first step the two disagree on. They
+// draw from samplers seeded alike, in the same order, so they agree to rounding: compiled Go is
+// free to fuse a multiply and an add, so the tolerance is FMA-scale rather than zero.
+type {{lower .Type}}Lockstep struct {
+	declarative simulator.Iteration
+	generated   *{{.Type}}
+	steps       int
+	mismatch    string
+}
+
+func (l *{{lower .Type}}Lockstep) Configure(partitionIndex int, settings *simulator.Settings) {
+	l.declarative.Configure(partitionIndex, settings)
+	l.generated.Configure(partitionIndex, settings)
+}
+
+func (l *{{lower .Type}}Lockstep) Iterate(
+	params *simulator.Params,
+	partitionIndex int,
+	stateHistories []*simulator.StateHistory,
+	timestepsHistory *simulator.CumulativeTimestepsHistory,
+) []float64 {
+	want := l.declarative.Iterate(params, partitionIndex, stateHistories, timestepsHistory)
+	got := l.generated.Iterate(params, partitionIndex, stateHistories, timestepsHistory)
+	l.steps++
+	for k := range want {
+		if l.mismatch != "" || got[k] == want[k] || math.IsNaN(got[k]) && math.IsNaN(want[k]) {
+			continue
+		}
+		d := math.Abs(got[k] - want[k])
+		if s := math.Abs(want[k]); s > 1 {
+			d /= s
+		}
+		if !(d <= 1e-12) {
+			l.mismatch = fmt.Sprintf("step %d, element %d: generated %v, declarative %v",
+				l.steps, k, got[k], want[k])
+		}
+	}
+	return want
+}
+
+// {{lower .Type}}Run builds {{.Config}} for a run of steps steps with nothing output, giving
+// the {{.Partition}} partition the iteration swap returns in place of its declarative one.
+func {{lower .Type}}Run(
+	steps int,
+	swap func(declarative simulator.Iteration) simulator.Iteration,
+) (*simulator.Settings, *simulator.Implementations) {
+	config := api.LoadApiRunConfigFromYaml({{printf "%q" .Config}})
+	config.Main.Simulation = simulator.SimulationConfig{
+		OutputCondition: &simulator.EveryStepOutputCondition{},
+		TerminationCondition: &simulator.NumberOfStepsTerminationCondition{
+			MaxNumberOfSteps: steps,
+		},
+		TimestepFunction: &simulator.ConstantTimestepFunction{Stepsize: 1.0},
+		InitTimeValue:    0.0,
+	}
+	gen := config.Main.GetConfigGenerator()
+	partition := gen.GetPartition({{printf "%q" .Partition}})
+	partition.Iteration = swap(partition.Iteration)
+	settings, implementations := gen.GenerateConfigs()
+	implementations.OutputFunction = &simulator.NilOutputFunction{}
+	implementations.ExecutionStrategy = &simulator.InlineExecution{}
+	return settings, implementations
+}
+
+func Test{{.Type}}MatchesDeclarative(t *testing.T) {
+	var lockstep *{{lower .Type}}Lockstep
+	settings, implementations := {{lower .Type}}Run({{.Steps}},
+		func(declarative simulator.Iteration) simulator.Iteration {
+			lockstep = &{{lower .Type}}Lockstep{declarative: declarative, generated: &{{.Type}}{}}
+			return lockstep
+		})
+	simulator.NewPartitionCoordinator(settings, implementations).Run()
+	if lockstep.steps == 0 {
+		t.Fatal("the partition never ran")
+	}
+	if lockstep.mismatch != "" {
+		t.Fatal(lockstep.mismatch)
+	}
+}
+
+// Benchmark{{.Type}} runs the config with the partition declarative and then generated, so
+// what the generated Go saves is a measured number.
+func Benchmark{{.Type}}(b *testing.B) {
+	for _, twin := range []struct {
+		name string
+		swap func(simulator.Iteration) simulator.Iteration
+	}{
+		{"declarative", func(declarative simulator.Iteration) simulator.Iteration {
+			return declarative
+		}},
+		{"generated", func(simulator.Iteration) simulator.Iteration { return &{{.Type}}{} }},
+	} {
+		b.Run(twin.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				settings, implementations := {{lower .Type}}Run({{.Steps}}, twin.swap)
+				b.StartTimer()
+				simulator.NewPartitionCoordinator(settings, implementations).Run()
+			}
+		})
+	}
+}
+`))
+
+// The functions below are what generated Go calls for the evaluator's run-time rules, so that
+// it broadcasts, bounds-checks and fails exactly as an ExpressionIteration does.
+
+// ExpressionTake returns buffer resized to n, reallocating only when it is too small.
+func ExpressionTake(buffer *[]float64, n int) []float64 {
+	return take((*exprValue)(buffer), n)
+}
+
+// ExpressionAt is element i of v, or v's only element when it is a scalar, which broadcasts.
+func ExpressionAt(v []float64, i int) float64 {
+	return at(v, i)
+}
+
+// ExpressionBroadcast is the width values of widths a and b combine to, panicking when they
+// cannot.
+func ExpressionBroadcast(a, b int, what string) int {
+	return broadcastWidth(a, b, what)
+}
+
+// ExpressionBool is 1 for true and 0 for false.
+func ExpressionBool(b bool) float64 {
+	return exprBool(b)
+}
+
+// ExpressionBranch is v, a branch of a where over a width-width condition, panicking when it is
+// neither that width nor a scalar. which is "then" or "else".
+func ExpressionBranch(v []float64, which string, width int) []float64 {
+	if len(v) != width && len(v) != 1 {
+		panic(fmt.Sprintf("expression: where's %s branch has width %d, which is neither the "+
+			"condition's %d nor 1", which, len(v), width))
+	}
+	return v
+}
+
+// ExpressionScalar is v's only element, panicking with message when it has any other number.
+func ExpressionScalar(v []float64, message string) float64 {
+	if len(v) != 1 {
+		panic("expression: " + message)
+	}
+	return v[0]
+}
+
+// ExpressionCount is x as a count, panicking when it is not a number.
+func ExpressionCount(x float64, what string) int {
+	return toIndex(x, what)
+}
+
+// ExpressionIndex is x as an index into a width-width value, panicking when it is out of range.
+func ExpressionIndex(x float64, width int) int {
+	i := toIndex(x, "an index")
+	if i < 0 || i >= width {
+		panic(fmt.Sprintf("expression: index %d out of range for width %d", i, width))
+	}
+	return i
+}
+
+// ExpressionSlice is the width-wide block of v from start, panicking when it is outside v.
+func ExpressionSlice(v []float64, start, width float64) []float64 {
+	from, n := toIndex(start, "slice's start"), toIndex(width, "slice's width")
+	if n < 0 {
+		panic("expression: slice's width must not be negative")
+	}
+	if from < 0 || from+n > len(v) {
+		panic(fmt.Sprintf("expression: slice(%d, %d) is outside a width-%d value", from, n, len(v)))
+	}
+	return v[from : from+n]
+}
+
+// ExpressionLag is the width-wide block from from of history's state row rows back, panicking
+// when the history does not keep that many rows. name is what the expression called it.
+func ExpressionLag(
+	history *simulator.StateHistory,
+	name string,
+	row float64,
+	from, width int,
+) []float64 {
+	r := toIndex(row, "lag's row")
+	if r < 0 || r >= history.StateHistoryDepth {
+		panic(fmt.Sprintf(
+			"expression: lag(%s, %d) is outside the %d rows %s keeps; raise its "+
+				"state_history_depth", name, r, history.StateHistoryDepth, name))
+	}
+	return history.Values.RawRowView(r)[from : from+width]
+}
+
+// ExpressionOutput writes v into out, broadcasting a scalar, and panics when v is neither
+// out's width nor a scalar. field names the field out is.
+func ExpressionOutput(out, v []float64, field string) {
+	switch len(v) {
+	case len(out):
+		copy(out, v)
+	case 1:
+		for k := range out {
+			out[k] = v[0]
+		}
+	default:
+		panic(fmt.Sprintf("expression: output for field %s produced width %d, want %d or 1",
+			field, len(v), len(out)))
+	}
+}
+
+// ExpressionUpstream is the index of the partition named partition, which an expression calls
+// alias, panicking when there is none.
+func ExpressionUpstream(settings *simulator.Settings, partition, alias string) int {
+	for i, it := range settings.Iterations {
+		if it.Name == partition {
+			return i
+		}
+	}
+	panic("expression: upstream partition " + partition + " (alias " + alias + ") not found")
+}
@@ -0,0 +1,243 @@
+package general
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+	"github.com/umbralcalc/stochadex/pkg/spatial"
+)
+
+// queueIteration is a small partition using most of what the generator covers: a lazy where
+// guarding a draw, a vector binding, a reduction and an each.
+func queueIteration() *ExpressionIteration {
+	return &ExpressionIteration{
+		Fields: []ExpressionField{{Name: "level"}, {Name: "queue", Width: 4}},
+		Bindings: []ExpressionBinding{
+			{Name: "inflow", Expr: "where(level > cap, 0, shared(poisson(rate)))"},
+			{Name: "drained", Expr: "queue * (1 - drain)"},
+			{Name: "total", Expr: "sum(drained)"},
+		},
+		Outputs: []string{
+			"level + inflow - total * dt",
+			"each(4, i, drained[i] + where(i == 0, inflow, 0))",
+		},
+	}
+}
+
+func queueSpec() ExpressionGoSpec {
+	return ExpressionGoSpec{
+		Package:   "queue",
+		Type:      "QueueIteration",
+		Config:    "queue.yaml",
+		Partition: "queue",
+		Shapes: ExpressionShapes{
+			StateWidth:        5,
+			StateHistoryDepth: 1,
+			Params:            map[string]int{"cap": 1, "rate": 1, "drain": 1},
+		},
+	}
+}
+
+func TestExpressionGenerateGoWritesTypedGo(t *testing.T) {
+	generated, err := queueIteration().GenerateGo(queueSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, source := range map[string][]byte{
+		"queue_generated.go":      generated.Iteration,
+		"queue_generated_test.go": generated.Test,
+	} {
+		if _, err := parser.ParseFile(token.NewFileSet(), name, source, 0); err != nil {
+			t.Fatalf("%s does not parse: %v\n%s", name, err, source)
+		}
+	}
+	iteration := string(generated.Iteration)
+	for _, want := range []string{
+		"// Code generated by stochadex codegen from queue.yaml, partition queue; DO NOT EDIT.",
+		"package queue",
+		"type QueueIteration struct",
+		"q.sampler = rng.New(settings.Iterations[partitionIndex].Seed)",
+		"q.drained = make([]float64, 4)",
+		"level := state[0]",
+		"queue := state[1:5]",
+		"dt := timestepsHistory.NextIncrement",
+		"cap2 := params.Map[\"cap\"][0]",
+	} {
+		if !strings.Contains(iteration, want) {
+			t.Errorf("generated iteration lacks %q:\n%s", want, iteration)
+		}
+	}
+	// The draw stays inside the branch that takes it, as the evaluator's where is lazy.
+	if strings.Index(iteration, "q.sampler.Poisson(rate)") <
+		strings.Index(iteration, "if level > cap2 {") {
+		t.Errorf("the draw was hoisted out of its branch:\n%s", iteration)
+	}
+	test := string(generated.Test)
+	for _, want := range []string{
+		"func TestQueueIterationMatchesDeclarative(t *testing.T)",
+		"func BenchmarkQueueIteration(b *testing.B)",
+		`api.LoadApiRunConfigFromYaml("queue.yaml")`,
+		`gen.GetPartition("queue")`,
+		"MaxNumberOfSteps: steps",
+		"queueIterationRun(1000,",
+	} {
+		if !strings.Contains(test, want) {
+			t.Errorf("generated test lacks %q:\n%s", want, test)
+		}
+	}
+}
+
+func TestExpressionGenerateGoFusesElementwiseChains(t *testing.T) {
+	e := &ExpressionIteration{
+		Fields:  []ExpressionField{{Name: "v", Width: 3}},
+		Outputs: []string{"abs(v * k + 1) - v"},
+	}
+	spec := queueSpec()
+	spec.Shapes = ExpressionShapes{StateWidth: 3, Params: map[string]int{"k": 1}}
+	generated, err := e.GenerateGo(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "q.out[0+i] = math.Abs(v[i]*k+1.0) - v[i]"
+	if !strings.Contains(string(generated.Iteration), want) {
+		t.Fatalf("want the chain as one loop, %q:\n%s", want, generated.Iteration)
+	}
+	if strings.Count(string(generated.Iteration), "make(") != 1 {
+		t.Fatalf("a fused chain should need no buffer:\n%s", generated.Iteration)
+	}
+}
+
+func TestExpressionGenerateGoFoldsConstantsAsTheEvaluatorRounds(t *testing.T) {
+	e := &ExpressionIteration{
+		Fields:  []ExpressionField{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}},
+		Outputs: []string{"0.1 + 0.2", "a / 0", "-(0 * a)", "-0"},
+	}
+	spec := queueSpec()
+	spec.Shapes = ExpressionShapes{StateWidth: 4}
+	generated, err := e.GenerateGo(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		// Go's exact constant arithmetic would make this 0.3.
+		"q.out[0] = 0.30000000000000004",
+		// Go rejects a constant division by zero, which a float64 does not.
+		"q.out[1] = a * math.Inf(1)",
+		"q.out[2] = -(0.0 * a)",
+		"q.out[3] = math.Copysign(0, -1)",
+	} {
+		if !strings.Contains(string(generated.Iteration), want) {
+			t.Errorf("generated iteration lacks %q:\n%s", want, generated.Iteration)
+		}
+	}
+}
+
+func TestExpressionGenerateGoRefusesWhatItCannotGenerate(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		e    *ExpressionIteration
+		spec func(*ExpressionGoSpec)
+		want string
+	}{
+		{
+			name: "an uncovered function",
+			e: &ExpressionIteration{
+				Fields:  []ExpressionField{{Name: "v", Width: 2}},
+				Outputs: []string{"sort(v)"},
+			},
+			want: "codegen does not generate sort yet; keep this partition declarative",
+		},
+		{
+			name: "an uncovered distribution",
+			e: &ExpressionIteration{
+				Fields:  []ExpressionField{{Name: "v", Width: 2}},
+				Outputs: []string{"iid(2, lognormal(0, 1))"},
+			},
+			want: "codegen does not generate lognormal yet",
+		},
+		{
+			name: "a topology",
+			e: &ExpressionIteration{
+				Fields:   []ExpressionField{{Name: "v", Width: 2}},
+				Outputs:  []string{"v"},
+				Topology: &spatial.TopologySpec{Grid: &spatial.GridSpec{Rows: 1, Cols: 2}},
+			},
+			want: "codegen does not generate a topology yet",
+		},
+		{
+			name: "an expression Check rejects",
+			e: &ExpressionIteration{
+				Fields:  []ExpressionField{{Name: "v", Width: 2}},
+				Outputs: []string{"v + missing"},
+			},
+			want: "missing",
+		},
+		{
+			name: "a type that is not exported",
+			e: &ExpressionIteration{
+				Fields:  []ExpressionField{{Name: "v", Width: 2}},
+				Outputs: []string{"v"},
+			},
+			spec: func(spec *ExpressionGoSpec) { spec.Type = "queueIteration" },
+			want: `codegen type "queueIteration" is not an exported Go name`,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			spec := queueSpec()
+			spec.Shapes = ExpressionShapes{StateWidth: 2}
+			if c.spec != nil {
+				c.spec(&spec)
+			}
+			_, err := c.e.GenerateGo(spec)
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Fatalf("got %v, want an error containing %q", err, c.want)
+			}
+		})
+	}
+}
+
+func TestExpressionGoHelpersPanicAsTheEvaluatorDoes(t *testing.T) {
+	panicking := func(f func()) (message string) {
+		defer func() { message = stringifyPanic(recover()) }()
+		f()
+		return ""
+	}
+	v := []float64{1, 2, 3, 4, 5}
+	history := &simulator.StateHistory{
+		Values:            mat.NewDense(1, 5, v),
+		StateWidth:        5,
+		StateHistoryDepth: 1,
+	}
+	for _, c := range []struct {
+		output string
+		width  int
+		helper func()
+	}{
+		{"slice(v, 3 + 0 * v[0], 4)", 4, func() { ExpressionSlice(v, 3, 4) }},
+		{"v[5 + 0 * v[0]]", 1, func() { ExpressionIndex(5, 5) }},
+		{"where(v > 2, concat(1, 2), 0)", 5, func() { ExpressionBranch([]float64{1, 2}, "then", 5) }},
+		{"concat(1, 2)", 3, func() { ExpressionOutput(make([]float64, 3), []float64{1, 2}, "out") }},
+		{"lag(v, 3 + 0 * v[0])", 5, func() { ExpressionLag(history, "v", 3, 0, 5) }},
+	} {
+		t.Run(c.output, func(t *testing.T) {
+			e := &ExpressionIteration{
+				Fields:  []ExpressionField{{Name: "v", Width: 5}, {Name: "out", Width: c.width}},
+				Outputs: []string{"v", c.output},
+			}
+			want := panicking(func() {
+				evalOnce(t, e, append(append([]float64(nil), v...), make([]float64, c.width)...), nil)
+			})
+			if want == "" {
+				t.Fatal("the evaluator did not panic")
+			}
+			if got := panicking(c.helper); got != want {
+				t.Fatalf("helper panicked with %q, the evaluator with %q", got, want)
+			}
+		})
+	}
+}
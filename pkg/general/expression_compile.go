@@ -0,0 +1,925 @@
+package general
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"math"
+	"strconv"
+
+	"gonum.org/v1/gonum/stat/distuv"
+
+	"github.com/umbralcalc/stochadex/pkg/rng"
+	"github.com/umbralcalc/stochadex/pkg/spatial"
+)
+
+// exprCode is one compiled node of an expression: calling it evaluates the node. The value it
+// returns is either a buffer the node owns and overwrites the next time it runs, or a value it
+// was handed — a field, a param, a binding — so a caller may read it until the node runs again
+// and must never write through it.
+type exprCode func() exprValue
+
+// exprProgram is an ExpressionIteration's bindings and outputs, compiled once at Configure
+// into closures over preallocated buffers, so a step neither walks the syntax tree nor looks a
+// name up in a map nor allocates a value per node.
+//
+// Names are resolved when the program is compiled rather than when it runs. A binding or a lane
+// variable gets a local slot, and the scoping that the tree walker got by binding and restoring
+// names in a shared environment falls out of compiling each body with the names in scope. Every
+// other name is a global, read once per step from the partition's surroundings into its slot.
+type exprProgram struct {
+	slots    []exprValue
+	globals  []exprGlobal
+	bindings []exprBindingCode
+	outputs  []exprCode
+	sampler  *rng.Sampler
+	topology *spatial.Topology
+	lag      func(name string, row int) exprValue
+}
+
+// exprGlobal is a name that no binding or lane variable declares. upstream and field are the
+// partition and field it could mean, or -1, because which one it does mean is settled per step:
+// params are re-read every step and take precedence over fields.
+type exprGlobal struct {
+	name     string
+	slot     int
+	fixed    exprValue
+	upstream int
+	field    int
+}
+
+type exprBindingCode struct {
+	slot int
+	code exprCode
+}
+
+// compileExprProgram compiles bindings in order, each seeing those before it, then outputs,
+// which see them all. Nothing here panics: every error the tree walker reported when it reached
+// a node is compiled into a node that reports it when run, so an expression that never runs a
+// malformed branch still works, exactly as it did.
+func compileExprProgram(
+	bindings []parsedExprBinding,
+	outputs []ast.Expr,
+	functions map[string]*parsedExprFunction,
+	matrices map[string][2]int,
+) *exprProgram {
+	return newExprCompiler(functions, matrices).compileProgram(bindings, outputs)
+}
+
+func newExprCompiler(
+	functions map[string]*parsedExprFunction,
+	matrices map[string][2]int,
+) *exprCompiler {
+	return &exprCompiler{
+		program:   &exprProgram{},
+		globals:   make(map[string]int),
+		functions: functions,
+		matrices:  matrices,
+		rows:      make(map[ast.Expr]exprRows),
+		localRows: make(map[int]exprRows),
+	}
+}
+
+func (c *exprCompiler) compileProgram(
+	bindings []parsedExprBinding,
+	outputs []ast.Expr,
+) *exprProgram {
+	p := c.program
+	for _, b := range bindings {
+		// The expression is compiled before its name is declared, so a binding that mentions
+		// its own name means whatever the name meant before it.
+		code := c.compile(b.expr)
+		slot := c.declare(b.name)
+		if rows, ok := c.rows[b.expr]; ok {
+			c.localRows[slot] = rows
+		}
+		p.bindings = append(p.bindings, exprBindingCode{slot, code})
+	}
+	for _, o := range outputs {
+		p.outputs = append(p.outputs, c.compile(o))
+	}
+	p.slots = make([]exprValue, c.slots)
+	return p
+}
+
+// exprCompiler lowers a parsed expression to exprCode. scope holds the declared names, most
+// recent last, and explicit records whether the node being compiled sits inside an iid, shared,
+// each or scan, which is where a scalar-parameter draw is unambiguous. inlining is the user-defined
+// functions whose bodies are being compiled, outermost first. matrices is the declared shapes of
+// globals, rows the row count of every node compiled so far that is a matrix, and localRows
+// that of every binding that holds one.
+type exprCompiler struct {
+	program   *exprProgram
+	scope     []exprLocal
+	globals   map[string]int
+	slots     int
+	explicit  bool
+	functions map[string]*parsedExprFunction
+	inlining  []string
+	matrices  map[string][2]int
+	rows      map[ast.Expr]exprRows
+	localRows map[int]exprRows
+}
+
+type exprLocal struct {
+	name string
+	slot int
+}
+
+// declare gives name a fresh slot and brings it into scope, shadowing anything it names already.
+func (c *exprCompiler) declare(name string) int {
+	slot := c.slots
+	c.slots++
+	c.scope = append(c.scope, exprLocal{name, slot})
+	return slot
+}
+
+// declared reports whether name is in scope, rather than a global.
+func (c *exprCompiler) declared(name string) bool {
+	for _, local := range c.scope {
+		if local.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// undeclare takes the last n declared names out of scope again.
+func (c *exprCompiler) undeclare(n int) {
+	c.scope = c.scope[:len(c.scope)-n]
+}
+
+// lookup resolves name to the innermost declaration in scope, or else to its global slot.
+func (c *exprCompiler) lookup(name string) int {
+	for i := len(c.scope) - 1; i >= 0; i-- {
+		if c.scope[i].name == name {
+			return c.scope[i].slot
+		}
+	}
+	if slot, ok := c.globals[name]; ok {
+		return slot
+	}
+	slot := c.slots
+	c.slots++
+	c.globals[name] = slot
+	c.program.globals = append(c.program.globals, exprGlobal{
+		name: name, slot: slot, upstream: -1, field: -1})
+	return slot
+}
+
+// explicitly compiles node as the inside of an iid, shared, each or scan.
+func (c *exprCompiler) explicitly(node ast.Expr) exprCode {
+	outer := c.explicit
+	c.explicit = true
+	code := c.compile(node)
+	c.explicit = outer
+	return code
+}
+
+// take returns buffer resized to n, reallocating only when it is too small. It never returns
+// nil, which an empty value must not be: a nil slot is what an unknown name looks like.
+func take(buffer *exprValue, n int) exprValue {
+	if cap(*buffer) < n || *buffer == nil {
+		*buffer = make(exprValue, n)
+	}
+	return (*buffer)[:n]
+}
+
+func fail(message string) exprCode {
+	return func() exprValue { panic(message) }
+}
+
+func (c *exprCompiler) compile(node ast.Expr) exprCode {
+	p := c.program
+	switch n := node.(type) {
+	case *ast.BasicLit:
+		v, err := strconv.ParseFloat(n.Value, 64)
+		if err != nil {
+			return fail("expression: bad numeric literal " + n.Value)
+		}
+		value := exprValue{v}
+		return func() exprValue { return value }
+	case *ast.Ident:
+		if len(c.inlining) > 0 && n.Name != "pi" && !c.declared(n.Name) {
+			return fail("expression: function " + c.inlining[len(c.inlining)-1] +
+				" has no parameter " + n.Name + "; a function sees only its parameters and pi")
+		}
+		local := c.declared(n.Name)
+		slot, name := c.lookup(n.Name), n.Name
+		read := func() exprValue {
+			v := p.slots[slot]
+			if v == nil {
+				panic("expression: unknown name " + name)
+			}
+			return v
+		}
+		if rows, ok := c.localRows[slot]; ok && local {
+			c.rows[n] = rows
+		}
+		if shape, ok := c.matrices[name]; ok && !local {
+			return c.declaredMatrix(n, read, shape)
+		}
+		return read
+	case *ast.ParenExpr:
+		code := c.compile(n.X)
+		c.carryRows(n, n.X)
+		return code
+	case *ast.UnaryExpr:
+		x := c.compile(n.X)
+		c.carryRows(n, n.X)
+		switch n.Op {
+		case token.SUB:
+			return mapCode(x, func(x float64) float64 { return -x })
+		case token.ADD:
+			return x
+		case token.NOT:
+			return mapCode(x, func(x float64) float64 { return exprBool(x == 0) })
+		}
+		return func() exprValue {
+			x()
+			panic("expression: unsupported syntax")
+		}
+	case *ast.IndexExpr:
+		x, index := c.compile(n.X), c.compile(n.Index)
+		var buffer exprValue
+		return func() exprValue {
+			v, idx := x(), index()
+			if len(idx) != 1 {
+				panic("expression: index must be a scalar")
+			}
+			i := toIndex(idx[0], "an index")
+			if i < 0 || i >= len(v) {
+				panic(fmt.Sprintf("expression: index %d out of range for width %d", i, len(v)))
+			}
+			out := take(&buffer, 1)
+			out[0] = v[i]
+			return out
+		}
+	case *ast.BinaryExpr:
+		return c.binary(n)
+	case *ast.CallExpr:
+		return c.call(n)
+	}
+	return fail("expression: unsupported syntax")
+}
+
+func (c *exprCompiler) binary(n *ast.BinaryExpr) exprCode {
+	x, y := c.compile(n.X), c.compile(n.Y)
+	op := n.Op.String()
+	var buffer exprValue
+	// && and || short-circuit only when the left side is a scalar, matching where's rule.
+	if n.Op == token.LAND || n.Op == token.LOR {
+		and := n.Op == token.LAND
+		return func() exprValue {
+			l := x()
+			if len(l) == 1 {
+				if and == (l[0] == 0) {
+					out := take(&buffer, 1)
+					out[0] = exprBool(!and)
+					return out
+				}
+				r := y()
+				out := take(&buffer, len(r))
+				for i, v := range r {
+					out[i] = exprBool(v != 0)
+				}
+				return out
+			}
+			r := y()
+			out := take(&buffer, broadcastLen(l, r, op))
+			for i := range out {
+				if and {
+					out[i] = exprBool(at(l, i) != 0 && at(r, i) != 0)
+				} else {
+					out[i] = exprBool(at(l, i) != 0 || at(r, i) != 0)
+				}
+			}
+			return out
+		}
+	}
+	// The four arithmetic operators are written out rather than passed as funcs, because they
+	// are most of what a model does and a call per element is most of what they would cost.
+	switch n.Op {
+	case token.ADD, token.SUB, token.MUL, token.QUO, token.REM:
+		c.carryRows(n, n.X, n.Y)
+	}
+	switch n.Op {
+	case token.ADD:
+		return func() exprValue {
+			a, b := x(), y()
+			out := take(&buffer, broadcastLen(a, b, op))
+			switch {
+			case len(a) == len(b):
+				for i := range out {
+					out[i] = a[i] + b[i]
+				}
+			case len(a) == 1:
+				for i := range out {
+					out[i] = a[0] + b[i]
+				}
+			default:
+				for i := range out {
+					out[i] = a[i] + b[0]
+				}
+			}
+			return out
+		}
+	case token.SUB:
+		return func() exprValue {
+			a, b := x(), y()
+			out := take(&buffer, broadcastLen(a, b, op))
+			switch {
+			case len(a) == len(b):
+				for i := range out {
+					out[i] = a[i] - b[i]
+				}
+			case len(a) == 1:
+				for i := range out {
+					out[i] = a[0] - b[i]
+				}
+			default:
+				for i := range out {
+					out[i] = a[i] - b[0]
+				}
+			}
+			return out
+		}
+	case token.MUL:
+		return func() exprValue {
+			a, b := x(), y()
+			out := take(&buffer, broadcastLen(a, b, op))
+			switch {
+			case len(a) == len(b):
+				for i := range out {
+					out[i] = a[i] * b[i]
+				}
+			case len(a) == 1:
+				for i := range out {
+					out[i] = a[0] * b[i]
+				}
+			default:
+				for i := range out {
+					out[i] = a[i] * b[0]
+				}
+			}
+			return out
+		}
+	case token.QUO:
+		return func() exprValue {
+			a, b := x(), y()
+			out := take(&buffer, broadcastLen(a, b, op))
+			switch {
+			case len(a) == len(b):
+				for i := range out {
+					out[i] = a[i] / b[i]
+				}
+			case len(a) == 1:
+				for i := range out {
+					out[i] = a[0] / b[i]
+				}
+			default:
+				for i := range out {
+					out[i] = a[i] / b[0]
+				}
+			}
+			return out
+		}
+	case token.REM:
+		return zipCode(x, y, op, math.Mod)
+	case token.LSS:
+		return zipCode(x, y, op, func(a, b float64) float64 { return exprBool(a < b) })
+	case token.GTR:
+		return zipCode(x, y, op, func(a, b float64) float64 { return exprBool(a > b) })
+	case token.LEQ:
+		return zipCode(x, y, op, func(a, b float64) float64 { return exprBool(a <= b) })
+	case token.GEQ:
+		return zipCode(x, y, op, func(a, b float64) float64 { return exprBool(a >= b) })
+	case token.EQL:
+		return zipCode(x, y, op, func(a, b float64) float64 { return exprBool(a == b) })
+	case token.NEQ:
+		return zipCode(x, y, op, func(a, b float64) float64 { return exprBool(a != b) })
+	}
+	return func() exprValue {
+		x()
+		y()
+		panic("expression: unsupported operator " + op)
+	}
+}
+
+// zipCode applies f elementwise to the broadcast values of x and y.
+func zipCode(x, y exprCode, what string, f func(a, b float64) float64) exprCode {
+	var buffer exprValue
+	return func() exprValue {
+		a, b := x(), y()
+		out := take(&buffer, broadcastLen(a, b, what))
+		for i := range out {
+			out[i] = f(at(a, i), at(b, i))
+		}
+		return out
+	}
+}
+
+// mapCode applies f to each element of x.
+func mapCode(x exprCode, f func(a float64) float64) exprCode {
+	var buffer exprValue
+	return func() exprValue {
+		a := x()
+		out := take(&buffer, len(a))
+		for i, v := range a {
+			out[i] = f(v)
+		}
+		return out
+	}
+}
+
+// scalarArg evaluates an argument that must be a single number, such as a count or a width.
+func scalarArg(code exprCode, message string) float64 {
+	v := code()
+	if len(v) != 1 {
+		panic("expression: " + message)
+	}
+	return v[0]
+}
+
+func (c *exprCompiler) call(n *ast.CallExpr) exprCode {
+	p := c.program
+	ident, ok := n.Fun.(*ast.Ident)
+	if !ok {
+		return fail("expression: unsupported call target")
+	}
+	name := ident.Name
+	if f, ok := c.functions[name]; ok {
+		return c.inline(f, n)
+	}
+	// Arity is checked before any argument is evaluated, as it always was, so a call with the
+	// wrong number of arguments compiles to its error alone.
+	if k, ok := exprArity[name]; ok && len(n.Args) != k {
+		return fail(fmt.Sprintf("expression: %s takes %d arguments, got %d", name, k, len(n.Args)))
+	}
+	args := make([]exprCode, len(n.Args))
+	compileArgs := func() {
+		for i, arg := range n.Args {
+			args[i] = c.compile(arg)
+		}
+	}
+	var buffer exprValue
+
+	switch name {
+	case "where":
+		compileArgs()
+		cond, then, otherwise := args[0], args[1], args[2]
+		return func() exprValue {
+			// Lazy on a scalar condition, so a guarded branch neither divides by zero nor
+			// consumes randomness.
+			cv := cond()
+			if len(cv) == 1 {
+				if cv[0] != 0 {
+					return then()
+				}
+				return otherwise()
+			}
+			// A vector condition selects elementwise, so each branch has to line up with it: the
+			// same width, or a scalar that broadcasts. There is no reading of a width-5 branch
+			// under a width-3 condition that is what the author meant.
+			a, b := then(), otherwise()
+			for _, branch := range [2]struct {
+				which string
+				value exprValue
+			}{{"then", a}, {"else", b}} {
+				if len(branch.value) != len(cv) && len(branch.value) != 1 {
+					panic(fmt.Sprintf(
+						"expression: where's %s branch has width %d, which is neither the "+
+							"condition's %d nor 1", branch.which, len(branch.value), len(cv)))
+				}
+			}
+			out := take(&buffer, len(cv))
+			for i := range out {
+				if cv[i] != 0 {
+					out[i] = at(a, i)
+				} else {
+					out[i] = at(b, i)
+				}
+			}
+			return out
+		}
+	case "iid":
+		// Evaluate the expression n times over, giving n independent samples.
+		count, body := c.compile(n.Args[0]), c.explicitly(n.Args[1])
+		return func() exprValue {
+			k := toIndex(scalarArg(count, "iid's count must be a scalar"), "iid's count")
+			if k < 1 {
+				panic("expression: iid's count must be at least 1")
+			}
+			out := take(&buffer, k)
+			for i := range out {
+				v := body()
+				if len(v) != 1 {
+					panic(fmt.Sprintf(
+						"expression: iid expects a scalar-valued expression, got width %d", len(v)))
+				}
+				out[i] = v[0]
+			}
+			return out
+		}
+	case "shared":
+		// One evaluation whose result may broadcast: the explicit way to say that a single
+		// sample is meant to apply across a whole field.
+		return c.explicitly(n.Args[0])
+	case "each":
+		// iid with the lane index in scope: a vector of width count whose element i is the
+		// expression evaluated with that i bound.
+		//
+		// This is the one construct that is not elementwise, and it buys three things nothing
+		// else can. Element i may read element i-1 of something (a cohort ages), so an index
+		// shift becomes sayable. Everything inside a lane is a scalar, so where is lazy per
+		// lane and a skipped lane draws nothing. And lanes run in order, so a draw per lane
+		// interleaves the way a Go loop does rather than taking every gamma before any
+		// poisson. It is a bounded comprehension with no assignment and no recursion, so an
+		// expression still always terminates.
+		count := c.compile(n.Args[0])
+		index, named := n.Args[1].(*ast.Ident)
+		var lane int
+		var body exprCode
+		if named {
+			lane = c.declare(index.Name)
+			body = c.explicitly(n.Args[2])
+			c.undeclare(1)
+		}
+		laneValue := exprValue{0}
+		return func() exprValue {
+			k := toIndex(scalarArg(count, "each's count must be a scalar"), "each's count")
+			if k < 1 {
+				panic("expression: each's count must be at least 1")
+			}
+			if !named {
+				panic("expression: each's second argument must be a name to bind the lane " +
+					"index to, as in each(40, i, ...)")
+			}
+			out := take(&buffer, k)
+			for i := range out {
+				laneValue[0] = float64(i)
+				p.slots[lane] = laneValue
+				v := body()
+				if len(v) != 1 {
+					panic(fmt.Sprintf(
+						"expression: each expects a scalar-valued expression per lane, got "+
+							"width %d", len(v)))
+				}
+				out[i] = v[0]
+			}
+			return out
+		}
+	case "scan":
+		// each with an accumulator threaded through the lanes: lane i evaluates the expression
+		// with the lane index bound and acc bound to the previous lane's value (init at lane 0),
+		// and the value of the call is the last lane's. So it is a fold, not a map.
+		//
+		// This is the one thing each cannot do. Its lanes are independent and each must produce
+		// a scalar, so nothing a lane computes reaches the next one. A scan lane may be any
+		// width, and that is what closes the case that asked for this: allocating k simultaneous
+		// arrivals to the first k free slots, where what has to be carried between lanes is
+		// which slots are now taken rather than a running total. Running maxima and true prefix
+		// operations are the same shape, and become O(n) rather than the O(n^2) of an each of
+		// sums over ever-longer slices.
+		//
+		// It stays as bounded as each: the count is fixed before the loop, acc is threaded
+		// rather than assigned to, and there is still no recursion, so an expression still
+		// always terminates.
+		count := c.compile(n.Args[0])
+		index, indexNamed := n.Args[1].(*ast.Ident)
+		accumulator, accumulatorNamed := n.Args[2].(*ast.Ident)
+		// The initial value is evaluated once, in the enclosing scope, before either name is
+		// bound — so an init that mentions them means the outer ones, as it reads.
+		init := c.compile(n.Args[3])
+		distinct := indexNamed && accumulatorNamed && index.Name != accumulator.Name
+		var lane, acc int
+		var body exprCode
+		if distinct {
+			lane = c.declare(index.Name)
+			acc = c.declare(accumulator.Name)
+			body = c.explicitly(n.Args[4])
+			c.undeclare(2)
+		}
+		laneValue := exprValue{0}
+		// A lane's value is copied out of the body, whose buffers the next lane overwrites
+		// while still reading acc, and the two copies alternate so acc is never the one being
+		// written.
+		var accumulated [2]exprValue
+		return func() exprValue {
+			k := toIndex(scalarArg(count, "scan's count must be a scalar"), "scan's count")
+			if k < 0 {
+				// Zero is allowed, unlike each's: a fold over no lanes is init, which is the right
+				// answer rather than an edge case, and it lets the count come from data.
+				panic("expression: scan's count must not be negative")
+			}
+			if !indexNamed {
+				panic("expression: scan's second argument must be a name to bind the lane index " +
+					"to, as in scan(40, i, acc, 0, ...)")
+			}
+			if !accumulatorNamed {
+				panic("expression: scan's third argument must be a name to bind the accumulator " +
+					"to, as in scan(40, i, acc, 0, ...)")
+			}
+			if !distinct {
+				panic("expression: scan's lane index and accumulator cannot share the name " +
+					index.Name)
+			}
+			value := init()
+			for i := 0; i < k; i++ {
+				laneValue[0] = float64(i)
+				p.slots[lane] = laneValue
+				p.slots[acc] = value
+				v := body()
+				next := take(&accumulated[i%2], len(v))
+				copy(next, v)
+				value = next
+			}
+			return value
+		}
+	case "lag":
+		// A read of a partition's committed state further back than the current row, which is
+		// all a bare name or an upstreams alias ever gives.
+		target, ok := n.Args[0].(*ast.Ident)
+		if !ok {
+			return fail("expression: lag's first argument must be an upstream alias or a " +
+				"field name")
+		}
+		row := c.compile(n.Args[1])
+		return func() exprValue {
+			r := scalarArg(row, "lag's row must be a scalar")
+			if p.lag == nil {
+				panic("expression: lag is unavailable here")
+			}
+			return p.lag(target.Name, toIndex(r, "lag's row"))
+		}
+	case "concat":
+		// The other half of slice: assemble a field from pieces that are computed
+		// differently, such as a cohort's boundary buckets against its interior.
+		if len(n.Args) < 2 {
+			return fail("expression: concat takes at least 2 arguments, got " +
+				strconv.Itoa(len(n.Args)))
+		}
+		compileArgs()
+		parts := make([]exprValue, len(args))
+		return func() exprValue {
+			total := 0
+			for i, arg := range args {
+				parts[i] = arg()
+				total += len(parts[i])
+			}
+			out := take(&buffer, total)[:0]
+			for _, part := range parts {
+				out = append(out, part...)
+			}
+			return out
+		}
+	}
+
+	if exprTableFunctions[name] {
+		return c.table(name, n)
+	}
+	if _, ok := exprArity[name]; !ok {
+		return fail("expression: unknown function " + name)
+	}
+	compileArgs()
+	if exprMatrixFunctions[name] {
+		return c.matrix(name, n, args)
+	}
+	if exprOrderFunctions[name] {
+		return c.order(name, args)
+	}
+	if exprDistributions[name] {
+		return c.distribution(name, args)
+	}
+	switch name {
+	case "clamp":
+		x, lo, hi := args[0], args[1], args[2]
+		return func() exprValue {
+			xv, lov, hiv := x(), lo(), hi()
+			width := broadcastWidth(broadcastLen(xv, lov, name), len(hiv), name)
+			out := take(&buffer, width)
+			for i := range out {
+				out[i] = math.Min(math.Max(at(xv, i), at(lov, i)), at(hiv, i))
+			}
+			return out
+		}
+	case "min":
+		return zipCode(args[0], args[1], name, math.Min)
+	case "max":
+		return zipCode(args[0], args[1], name, math.Max)
+	case "pow":
+		return zipCode(args[0], args[1], name, math.Pow)
+	case "atan2":
+		// Two-argument arctangent, atan2(y, x), for a full-circle angle from a pair of
+		// components — a solar azimuth from its projections, say. Kept as its own primitive
+		// rather than atan(y/x) so the quadrant is resolved and x == 0 is well defined,
+		// matching math.Atan2 exactly.
+		return zipCode(args[0], args[1], name, math.Atan2)
+	case "fill":
+		x, w := args[1], args[0]
+		return func() exprValue {
+			wv, xv := w(), x()
+			if len(wv) != 1 {
+				panic("expression: fill's width must be a scalar")
+			}
+			width := toIndex(wv[0], "fill's width")
+			if width < 1 {
+				panic("expression: fill's width must be at least 1")
+			}
+			out := take(&buffer, width)
+			for i := range out {
+				out[i] = at(xv, i)
+			}
+			return out
+		}
+	case "slice":
+		// A block of a vector, for state and params that pack several quantities end to end:
+		// the nine coefficients of a channel inside one flat thirty-six-wide param, say.
+		//
+		// A zero width gives an empty value rather than an error. That is not permissiveness:
+		// the natural prefix sum, each(n, i, sum(slice(q, 0, i))), asks for nothing at lane 0,
+		// and nothing is the correct block to ask for there. sum of an empty value is 0, so the
+		// reduction lands where it should.
+		x, start, size := args[0], args[1], args[2]
+		return func() exprValue {
+			v, fromValue, widthValue := x(), start(), size()
+			if len(fromValue) != 1 || len(widthValue) != 1 {
+				panic("expression: slice's start and width must be scalars")
+			}
+			from := toIndex(fromValue[0], "slice's start")
+			width := toIndex(widthValue[0], "slice's width")
+			if width < 0 {
+				panic("expression: slice's width must not be negative")
+			}
+			if from < 0 || from+width > len(v) {
+				panic(fmt.Sprintf(
+					"expression: slice(%d, %d) is outside a width-%d value", from, width, len(v)))
+			}
+			out := take(&buffer, width)
+			copy(out, v[from:from+width])
+			return out
+		}
+	case "width":
+		// How many elements a value has, for a spec that must adapt to a param's length
+		// rather than hard-code it. Without it the only way to ask is a trick, and the
+		// obvious spelling of that trick, sum(0 * x + 1), is silently wrong: 0 * NaN is NaN.
+		x := args[0]
+		return func() exprValue {
+			out := take(&buffer, 1)
+			out[0] = float64(len(x()))
+			return out
+		}
+	case "sum":
+		x := args[0]
+		return func() exprValue {
+			total := 0.0
+			for _, v := range x() {
+				total += v
+			}
+			out := take(&buffer, 1)
+			out[0] = total
+			return out
+		}
+	case "dot":
+		x, y := args[0], args[1]
+		return func() exprValue {
+			a, b := x(), y()
+			total := 0.0
+			for i, width := 0, broadcastLen(a, b, name); i < width; i++ {
+				total += at(a, i) * at(b, i)
+			}
+			out := take(&buffer, 1)
+			out[0] = total
+			return out
+		}
+	case "neighbours_sum", "laplacian":
+		x := args[0]
+		var broadcast exprValue
+		return func() exprValue {
+			v := x()
+			if p.topology == nil {
+				panic("expression: " + name + " needs a topology in the partition's spec")
+			}
+			nodes := p.topology.NumNodes()
+			if len(v) == 1 {
+				scalar := v[0]
+				v = take(&broadcast, nodes)
+				for i := range v {
+					v[i] = scalar
+				}
+			}
+			if len(v) != nodes {
+				panic(fmt.Sprintf(
+					"expression: %s takes one value per node, got width %d for %d nodes",
+					name, len(v), nodes))
+			}
+			out := take(&buffer, nodes)
+			if name == "laplacian" {
+				p.topology.Laplacian(v, out)
+			} else {
+				p.topology.NeighboursSum(v, out)
+			}
+			return out
+		}
+	case "normal":
+		return c.draw2(name, args, func(a, b float64) float64 { return p.sampler.Normal(a, b) })
+	case "uniform":
+		return c.draw2(name, args, func(a, b float64) float64 { return p.sampler.Uniform(a, b) })
+	case "gamma":
+		return c.draw2(name, args, func(a, b float64) float64 { return p.sampler.Gamma(a, b) })
+	case "beta":
+		return c.draw2(name, args, func(a, b float64) float64 { return p.sampler.Beta(a, b) })
+	case "binomial":
+		// pkg/rng leaves Binomial on distuv, whose three-branch algorithm was not worth
+		// reimplementing. Draw from the sampler's own generator so a partition still has
+		// exactly one stream and runs stay reproducible.
+		return c.draw2(name, args, func(trials, q float64) float64 {
+			return distuv.Binomial{N: trials, P: q, Src: p.sampler.Rand()}.Rand()
+		})
+	case "exponential":
+		return c.draw1(name, args, func(a float64) float64 { return p.sampler.Exponential(a) })
+	case "poisson":
+		return c.draw1(name, args, func(a float64) float64 { return p.sampler.Poisson(a) })
+	}
+	return mapCode(args[0], exprMath[name])
+}
+
+// exprArity is how many arguments each fixed-arity function takes; a function is known if it
+// appears here or is concat.
+var exprArity = map[string]int{
+	"where": 3, "iid": 2, "shared": 1, "each": 3, "scan": 5, "lag": 2,
+	"clamp": 3, "min": 2, "max": 2, "pow": 2, "atan2": 2,
+	"abs": 1, "floor": 1, "exp": 1, "log": 1, "sqrt": 1, "sin": 1, "cos": 1, "tan": 1,
+	"asin": 1, "acos": 1, "atan": 1, "erf": 1,
+	// erfc is the primitive a Gaussian CDF is built from: 0.5 * erfc(-x / sqrt(2)). Kept as
+	// erfc rather than offering the CDF directly so it matches math.Erfc exactly, which is
+	// what lets a model expressed here agree with compiled Go to rounding.
+	"erfc": 1,
+	"fill": 2, "slice": 3, "width": 1, "sum": 1, "dot": 2,
+	"neighbours_sum": 1, "laplacian": 1,
+	"normal": 2, "uniform": 2, "gamma": 2, "beta": 2, "binomial": 2,
+	"exponential": 1, "poisson": 1,
+	"negative_binomial": 2, "lognormal": 2, "student_t": 3, "weibull": 2, "truncated_normal": 4,
+	"categorical": 1, "multinomial": 2, "dirichlet": 1, "mvnormal": 2,
+	"logpdf_normal": 3, "logpdf_uniform": 3, "logpdf_exponential": 2, "logpdf_poisson": 2,
+	"logpdf_gamma": 3, "logpdf_beta": 3, "logpdf_binomial": 3, "logpdf_negative_binomial": 3,
+	"logpdf_lognormal": 3, "logpdf_student_t": 4, "logpdf_weibull": 3,
+	"logpdf_truncated_normal": 5, "logpdf_categorical": 2, "logpdf_multinomial": 2,
+	"logpdf_dirichlet": 2, "logpdf_mvnormal": 3,
+	"matmul": 2, "transpose": 1, "outer": 2, "diag": 1, "solve": 2, "cholesky": 1, "inv": 1,
+	"bin_index": 2, "interp2": 5,
+	"sort": 1, "argsort": 1, "rank": 1, "argmax": 1, "argmin": 1, "topk": 2, "cumsum": 1,
+	"quantile": 2, "gather": 2,
+}
+
+// exprMath is the elementwise one-argument functions.
+var exprMath = map[string]func(float64) float64{
+	"abs": math.Abs, "floor": math.Floor, "exp": math.Exp, "log": math.Log,
+	"sqrt": math.Sqrt, "sin": math.Sin, "cos": math.Cos, "tan": math.Tan,
+	"asin": math.Asin, "acos": math.Acos, "atan": math.Atan, "erf": math.Erf,
+	"erfc": math.Erfc,
+}
+
+// checkDrawWidth rejects a draw whose parameters are all scalars unless the caller has said
+// which reading is meant. See the type doc under "How wide a draw is".
+func checkDrawWidth(name string, width int, explicit bool) {
+	if width == 1 && !explicit {
+		panic(fmt.Sprintf(
+			"expression: %s has only scalar parameters, so its width is ambiguous; "+
+				"write iid(n, %s(...)) for n independent samples, or shared(%s(...)) for "+
+				"one sample reused across the field",
+			name, name, name))
+	}
+}
+
+// draw1 applies a one-parameter draw elementwise; each element is an independent sample.
+func (c *exprCompiler) draw1(name string, args []exprCode, f func(a float64) float64) exprCode {
+	x, explicit := args[0], c.explicit
+	var buffer exprValue
+	return func() exprValue {
+		a := x()
+		checkDrawWidth(name, len(a), explicit)
+		out := take(&buffer, len(a))
+		for i, v := range a {
+			out[i] = f(v)
+		}
+		return out
+	}
+}
+
+// draw2 applies a two-parameter draw elementwise, broadcasting the parameters; each element
+// is an independent sample.
+func (c *exprCompiler) draw2(name string, args []exprCode, f func(a, b float64) float64) exprCode {
+	x, y, explicit := args[0], args[1], c.explicit
+	var buffer exprValue
+	return func() exprValue {
+		a, b := x(), y()
+		width := broadcastLen(a, b, name)
+		checkDrawWidth(name, width, explicit)
+		out := take(&buffer, width)
+		for i := range out {
+			out[i] = f(at(a, i), at(b, i))
+		}
+		return out
+	}
+}
@@ -0,0 +1,923 @@
+package general
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat/distuv"
+
+	"github.com/umbralcalc/stochadex/pkg/rng"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+	"github.com/umbralcalc/stochadex/pkg/spatial"
+)
+
+// The compiled program against the tree walker it replaced. The evaluator tests pin what each
+// construct means; this checks that compiling changed none of it, over expressions no one
+// would think to write by hand: the same value, the same error, and the same draws in the
+// same order, step after step.
+
+// exprGenerator writes random expressions over the names in differentialIteration, biased
+// towards the constructs whose compiled form is least like the tree walk: lazy where, short
+// circuits, lane scoping, the scan accumulator and draws. Now and then it writes something
+// wrong — a name out of scope, a bad count, a call that does not exist — because the errors
+// have to agree too.
+type exprGenerator struct {
+	rand *rand.Rand
+	// names are the globals an expression may read; outputs may read the binding b too.
+	names []string
+}
+
+func (g *exprGenerator) pick(options ...string) string {
+	return options[g.rand.IntN(len(options))]
+}
+
+func (g *exprGenerator) rarely() bool {
+	return g.rand.IntN(25) == 0
+}
+
+func (g *exprGenerator) count() string {
+	if g.rarely() {
+		return g.pick("0", "-1", "v", "empty")
+	}
+	return g.pick("1", "2", "3", "n")
+}
+
+func (g *exprGenerator) leaf(scope []string) string {
+	if g.rarely() {
+		return g.pick("nope", "i", "acc", "1e400")
+	}
+	if len(scope) > 0 && g.rand.IntN(2) == 0 {
+		return scope[g.rand.IntN(len(scope))]
+	}
+	if g.rand.IntN(3) == 0 {
+		return g.pick("0", "1", "2", "0.5", "3", "1e-3", "dt", "t", "step", "pi")
+	}
+	return g.names[g.rand.IntN(len(g.names))]
+}
+
+// parameter is a draw's parameter: a name or number folded into [0, 5], because a sampler
+// given NaN or an infinity may never return, and that is not what is under test here.
+func (g *exprGenerator) parameter(scope []string) string {
+	name := g.leaf(scope)
+	return "where(" + name + " < 5, abs(" + name + "), 5)"
+}
+
+func (g *exprGenerator) expr(depth int, scope []string) string {
+	if depth == 0 || g.rand.IntN(5) == 0 {
+		return g.leaf(scope)
+	}
+	sub := func() string { return g.expr(depth-1, scope) }
+	within := func(names ...string) []string {
+		return append(scope[:len(scope):len(scope)], names...)
+	}
+	if g.rarely() {
+		return g.pick("frobnicate(", "where(", "1(", "x.y + (") + sub() + ")"
+	}
+	switch g.rand.IntN(12) {
+	case 0, 1:
+		return "(" + sub() + " " + g.pick("+", "-", "*", "/", "%", "<", ">", "<=", ">=", "==",
+			"!=", "&&", "||") + " " + sub() + ")"
+	case 2:
+		return g.pick("-", "!", "+") + "(" + sub() + ")"
+	case 3:
+		index := g.pick("0", "0", "1", "2")
+		if g.rarely() {
+			index = sub()
+		}
+		return g.leaf(scope) + "[" + index + "]"
+	case 4:
+		return "where(" + sub() + ", " + sub() + ", " + sub() + ")"
+	case 5:
+		name := g.pick("i", "j")
+		return "each(" + g.count() + ", " + name + ", " + g.expr(depth-1, within(name)) + ")"
+	case 6:
+		index, accumulator := g.pick("i", "j"), g.pick("acc", "total")
+		if g.rarely() {
+			accumulator = index
+		}
+		return "scan(" + g.count() + ", " + index + ", " + accumulator + ", " + sub() + ", " +
+			g.expr(depth-1, within(index, accumulator)) + ")"
+	case 7:
+		return g.pick("iid("+g.count()+", ", "shared(") + sub() + ")"
+	case 8:
+		return g.pick("normal", "uniform", "gamma", "beta", "binomial") +
+			"(" + g.parameter(scope) + ", " + g.parameter(scope) + ")"
+	case 9:
+		if g.rand.IntN(3) == 0 {
+			return g.pick("exponential", "poisson") + "(" + g.parameter(scope) + ")"
+		}
+		return g.pick("abs", "floor", "exp", "log", "sqrt", "sin", "erfc", "width", "sum",
+			"neighbours_sum", "laplacian") + "(" + sub() + ")"
+	case 10:
+		switch g.rand.IntN(5) {
+		case 0:
+			return "slice(" + sub() + ", " + g.pick("0", "1") + ", " + g.count() + ")"
+		case 1:
+			return "concat(" + sub() + ", " + sub() + ")"
+		case 2:
+			return "fill(" + g.count() + ", " + sub() + ")"
+		case 3:
+			target := g.pick("x", "s", "up")
+			if g.rarely() {
+				target = g.pick("k", "2")
+			}
+			return "lag(" + target + ", " + g.pick("0", "1", "2", sub()) + ")"
+		}
+		return "clamp(" + sub() + ", " + sub() + ", " + sub() + ")"
+	}
+	return g.pick("min", "max", "pow", "atan2", "dot") + "(" + sub() + ", " + sub() + ")"
+}
+
+// differentialIteration has a vector and a scalar field, an upstream, a topology, params of
+// widths 0, 1 and 3, a three-row history for lag and one binding, so that every kind of name
+// resolution is exercised.
+func differentialIteration(binding string, outputs [2]string) *ExpressionIteration {
+	return &ExpressionIteration{
+		Fields:    []ExpressionField{{Name: "x", Width: 3}, {Name: "s"}},
+		Upstreams: map[string]string{"up": "other"},
+		Bindings:  []ExpressionBinding{{Name: "b", Expr: binding}},
+		Outputs:   outputs[:],
+		Topology:  &spatial.TopologySpec{Edges: [][]float64{{0, 1}, {1, 2, 0.5}}},
+	}
+}
+
+// outcome is what one step did: its next state, or the message it panicked with.
+type outcome struct {
+	state []float64
+	panic string
+}
+
+func (o outcome) equal(other outcome) bool {
+	if o.panic != other.panic || len(o.state) != len(other.state) {
+		return false
+	}
+	for i := range o.state {
+		a, b := o.state[i], other.state[i]
+		if a != b && !(math.IsNaN(a) && math.IsNaN(b)) {
+			return false
+		}
+	}
+	return true
+}
+
+func step(run func() []float64) (result outcome) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = outcome{panic: stringifyPanic(r)}
+			if result.panic == "" {
+				result.panic = fmt.Sprint(r)
+			}
+		}
+	}()
+	return outcome{state: append([]float64(nil), run()...)}
+}
+
+func TestExpressionCompiledMatchesTreeWalk(t *testing.T) {
+	settings := &simulator.Settings{
+		Iterations: []simulator.IterationSettings{{Name: "p", Seed: 11}, {Name: "other"}},
+	}
+	histories := []*simulator.StateHistory{
+		{
+			Values:            mat.NewDense(3, 4, []float64{1, 2, 3, 0.5, 4, 5, 6, 0.25, 7, 8, 9, 0}),
+			StateWidth:        4,
+			StateHistoryDepth: 3,
+		},
+		{
+			Values:            mat.NewDense(1, 2, []float64{2.5, -1}),
+			StateWidth:        2,
+			StateHistoryDepth: 1,
+		},
+	}
+	params := simulator.NewParams(map[string][]float64{
+		"k": {0.7}, "v": {1.5, -2, 3}, "n": {2}, "empty": {},
+	})
+	g := &exprGenerator{rand: rand.New(rand.NewPCG(1, 2))}
+	globals := []string{"x", "s", "k", "v", "n", "up", "empty"}
+	ran, agreed := 0, 0
+	for trial := 0; trial < 10000; trial++ {
+		g.names = globals
+		binding := g.expr(3, nil)
+		g.names = append(globals, "b")
+		outputs := [2]string{g.expr(4, nil), g.expr(4, nil)}
+		if g.rand.IntN(2) == 0 {
+			outputs[1] = "sum(" + outputs[1] + ")"
+		}
+		compiled := differentialIteration(binding, outputs)
+		compiled.Configure(0, settings)
+		reference := differentialIteration(binding, outputs)
+		reference.Configure(0, settings)
+		sampler := rng.New(settings.Iterations[0].Seed)
+		for n := 1; n <= 3; n++ {
+			timesteps := &simulator.CumulativeTimestepsHistory{
+				Values:            mat.NewVecDense(1, []float64{float64(n) * 0.5}),
+				NextIncrement:     0.5,
+				CurrentStepNumber: n,
+			}
+			want := step(func() []float64 {
+				return referenceIterate(reference, sampler, &params, 0, histories, timesteps)
+			})
+			got := step(func() []float64 {
+				return compiled.Iterate(&params, 0, histories, timesteps)
+			})
+			ran++
+			if !got.equal(want) {
+				t.Fatalf("step %d of\n  b = %s\n  x = %s\n  s = %s\ncompiled gave %+v, the tree "+
+					"walk %+v", n, binding, outputs[0], outputs[1], got, want)
+			}
+			if want.panic != "" {
+				break
+			}
+			agreed++
+		}
+		if a, b := compiled.program.sampler.Uniform(0, 1), sampler.Uniform(0, 1); a != b {
+			t.Fatalf("the draws of\n  b = %s\n  x = %s\n  s = %s\nleft the streams apart",
+				binding, outputs[0], outputs[1])
+		}
+	}
+	// Expressions this random mostly fail, which is worth checking too, but not only that.
+	if agreed < ran/10 {
+		t.Errorf("only %d of %d steps ran to a value; the generator needs rebalancing",
+			agreed, ran)
+	}
+}
+
+func TestExpressionCompiledReusesItsBuffers(t *testing.T) {
+	e := &ExpressionIteration{
+		Fields: []ExpressionField{{Name: "v", Width: 40}, {Name: "total"}},
+		Bindings: []ExpressionBinding{
+			{Name: "grown", Expr: "v * (1 + rate) + iid(40, normal(0, 1))"},
+		},
+		Outputs: []string{
+			"where(grown > 0, grown, 0)",
+			"scan(40, i, acc, 0, acc + each(1, j, grown[i])[0])",
+		},
+	}
+	settings := &simulator.Settings{
+		Iterations: []simulator.IterationSettings{{Name: "p", Seed: 1}},
+	}
+	e.Configure(0, settings)
+	params := simulator.NewParams(map[string][]float64{"rate": {0.01}})
+	histories := []*simulator.StateHistory{{
+		Values:            mat.NewDense(1, 41, make([]float64, 41)),
+		StateWidth:        41,
+		StateHistoryDepth: 1,
+	}}
+	timesteps := &simulator.CumulativeTimestepsHistory{
+		Values:        mat.NewVecDense(1, []float64{0}),
+		NextIncrement: 1,
+	}
+	e.Iterate(&params, 0, histories, timesteps)
+	allocs := testing.AllocsPerRun(100, func() {
+		e.Iterate(&params, 0, histories, timesteps)
+	})
+	if allocs != 0 {
+		t.Errorf("a step allocated %v times once its buffers were sized; want none", allocs)
+	}
+}
+
+func TestExpressionCompiledErrorsStayLazy(t *testing.T) {
+	// The walker found a bad call only when it reached it, so a spec could carry one on a
+	// branch that never runs. Compiling moves no error to Configure.
+	e := &ExpressionIteration{
+		Fields: []ExpressionField{{Name: "x"}},
+		Bindings: []ExpressionBinding{
+			{Name: "never", Expr: "0 && frobnicate(nope, 1, 2)"},
+		},
+		Outputs: []string{"where(x > 1, sqrt(1, 2)[nope], x + never)"},
+	}
+	if got := evalOnce(t, e, []float64{1}, nil); got[0] != 1 {
+		t.Fatalf("got %v, want 1", got[0])
+	}
+}
+
+// referenceIterate is ExpressionIteration.Iterate as it was before compiling: the environment
+// is rebuilt from scratch each step and the tree walked node by node. It reads only the layout
+// and topology Configure resolved, and draws from its own sampler.
+func referenceIterate(
+	e *ExpressionIteration,
+	sampler *rng.Sampler,
+	params *simulator.Params,
+	partitionIndex int,
+	stateHistories []*simulator.StateHistory,
+	timestepsHistory *simulator.CumulativeTimestepsHistory,
+) []float64 {
+	env := make(exprEnv, len(e.Fields)+len(params.Map)+len(e.upstreamIndex)+3)
+	state := stateHistories[partitionIndex].Values.RawRowView(0)
+	for i, f := range e.Fields {
+		env[f.Name] = exprValue(state[e.offsets[i] : e.offsets[i]+e.fieldWidth(i)])
+	}
+	for name, values := range params.Map {
+		env[name] = exprValue(values)
+	}
+	for alias, index := range e.upstreamIndex {
+		env[alias] = exprValue(stateHistories[index].Values.RawRowView(0))
+	}
+	env["dt"] = exprValue{timestepsHistory.NextIncrement}
+	env["t"] = exprValue{timestepsHistory.Values.AtVec(0)}
+	env["step"] = exprValue{float64(timestepsHistory.CurrentStepNumber)}
+	env["pi"] = exprValue{math.Pi}
+
+	e.partitionIndex, e.stateHistories = partitionIndex, stateHistories
+	ctx := &exprCtx{env: env, sampler: sampler, lag: e.lag, topology: e.program.topology}
+	for _, b := range e.Bindings {
+		parsed, err := parser.ParseExpr(b.Expr)
+		if err != nil {
+			panic(err)
+		}
+		env[b.Name] = ctx.eval(parsed)
+	}
+	out := make([]float64, e.width)
+	for i, o := range e.Outputs {
+		parsed, err := parser.ParseExpr(o)
+		if err != nil {
+			panic(err)
+		}
+		w := e.fieldWidth(i)
+		v := ctx.eval(parsed)
+		switch len(v) {
+		case w:
+			copy(out[e.offsets[i]:], v)
+		case 1:
+			for k := 0; k < w; k++ {
+				out[e.offsets[i]+k] = v[0]
+			}
+		default:
+			panic(fmt.Sprintf(
+				"expression: output for field %s produced width %d, want %d or 1",
+				e.Fields[i].Name, len(v), w))
+		}
+	}
+	return out
+}
+
+type exprEnv map[string]exprValue
+
+// exprCtx is the tree-walking evaluator the compiler replaced, kept as the reference the
+// compiled program is checked against: it re-walks the syntax tree at every node, allocating
+// a fresh value for each, which is slow but is the semantics. drawsAreExplicit records whether
+// evaluation is inside an iid, shared or each call, which is where a scalar-parameter draw is
+// unambiguous.
+type exprCtx struct {
+	env              exprEnv
+	sampler          *rng.Sampler
+	lag              func(name string, row int) exprValue
+	topology         *spatial.Topology
+	drawsAreExplicit bool
+}
+
+func (c *exprCtx) explicit() *exprCtx {
+	explicit := *c
+	explicit.drawsAreExplicit = true
+	return &explicit
+}
+
+// overTopology applies a spatial operator to x, broadcasting a scalar to every node.
+func (c *exprCtx) overTopology(name string, x exprValue, op func(x, out []float64)) exprValue {
+	if c.topology == nil {
+		panic("expression: " + name + " needs a topology in the partition's spec")
+	}
+	nodes := c.topology.NumNodes()
+	if len(x) == 1 {
+		x = broadcastScalar(x[0], nodes)
+	}
+	if len(x) != nodes {
+		panic(fmt.Sprintf(
+			"expression: %s takes one value per node, got width %d for %d nodes",
+			name, len(x), nodes))
+	}
+	out := make(exprValue, nodes)
+	op(x, out)
+	return out
+}
+
+func broadcastScalar(x float64, n int) exprValue {
+	out := make(exprValue, n)
+	for i := range out {
+		out[i] = x
+	}
+	return out
+}
+
+// bind reserves a name for a comprehension to write its lane index or accumulator into, and
+// returns the undo. The environment is shared with the enclosing scope rather than nested, so
+// a binding that outlived its loop would leak into the next expression — and, because the same
+// iteration is reused every step, into the next step. Call it before the loop and defer the
+// result, so the name is restored (or removed, if it was never there) on the panicking path too.
+func (c *exprCtx) bind(name string) func() {
+	shadowed, wasBound := c.env[name]
+	return func() {
+		if wasBound {
+			c.env[name] = shadowed
+		} else {
+			delete(c.env, name)
+		}
+	}
+}
+
+func zipExpr(a, b exprValue, what string, f func(x, y float64) float64) exprValue {
+	n := broadcastLen(a, b, what)
+	out := make(exprValue, n)
+	for i := 0; i < n; i++ {
+		out[i] = f(at(a, i), at(b, i))
+	}
+	return out
+}
+
+func mapExpr(a exprValue, f func(x float64) float64) exprValue {
+	out := make(exprValue, len(a))
+	for i, x := range a {
+		out[i] = f(x)
+	}
+	return out
+}
+
+func (c *exprCtx) eval(node ast.Expr) exprValue {
+	switch n := node.(type) {
+	case *ast.BasicLit:
+		v, err := strconv.ParseFloat(n.Value, 64)
+		if err != nil {
+			panic("expression: bad numeric literal " + n.Value)
+		}
+		return exprValue{v}
+	case *ast.Ident:
+		v, ok := c.env[n.Name]
+		if !ok {
+			panic("expression: unknown name " + n.Name)
+		}
+		return v
+	case *ast.ParenExpr:
+		return c.eval(n.X)
+	case *ast.UnaryExpr:
+		v := c.eval(n.X)
+		switch n.Op {
+		case token.SUB:
+			return mapExpr(v, func(x float64) float64 { return -x })
+		case token.ADD:
+			return v
+		case token.NOT:
+			return mapExpr(v, func(x float64) float64 { return exprBool(x == 0) })
+		}
+	case *ast.IndexExpr:
+		v := c.eval(n.X)
+		idx := c.eval(n.Index)
+		if len(idx) != 1 {
+			panic("expression: index must be a scalar")
+		}
+		i := toIndex(idx[0], "an index")
+		if i < 0 || i >= len(v) {
+			panic(fmt.Sprintf("expression: index %d out of range for width %d", i, len(v)))
+		}
+		return exprValue{v[i]}
+	case *ast.BinaryExpr:
+		return c.evalBinary(n)
+	case *ast.CallExpr:
+		return c.evalCall(n)
+	}
+	panic("expression: unsupported syntax")
+}
+
+func (c *exprCtx) evalBinary(n *ast.BinaryExpr) exprValue {
+	// && and || short-circuit only when the left side is a scalar, matching where's rule.
+	if n.Op == token.LAND || n.Op == token.LOR {
+		l := c.eval(n.X)
+		if len(l) == 1 {
+			if n.Op == token.LAND && l[0] == 0 {
+				return exprValue{0}
+			}
+			if n.Op == token.LOR && l[0] != 0 {
+				return exprValue{1}
+			}
+			return mapExpr(c.eval(n.Y), func(y float64) float64 { return exprBool(y != 0) })
+		}
+		r := c.eval(n.Y)
+		if n.Op == token.LAND {
+			return zipExpr(l, r, "&&", func(x, y float64) float64 {
+				return exprBool(x != 0 && y != 0)
+			})
+		}
+		return zipExpr(l, r, "||", func(x, y float64) float64 {
+			return exprBool(x != 0 || y != 0)
+		})
+	}
+	l := c.eval(n.X)
+	r := c.eval(n.Y)
+	op := n.Op.String()
+	switch n.Op {
+	case token.ADD:
+		return zipExpr(l, r, op, func(x, y float64) float64 { return x + y })
+	case token.SUB:
+		return zipExpr(l, r, op, func(x, y float64) float64 { return x - y })
+	case token.MUL:
+		return zipExpr(l, r, op, func(x, y float64) float64 { return x * y })
+	case token.QUO:
+		return zipExpr(l, r, op, func(x, y float64) float64 { return x / y })
+	case token.REM:
+		return zipExpr(l, r, op, math.Mod)
+	case token.LSS:
+		return zipExpr(l, r, op, func(x, y float64) float64 { return exprBool(x < y) })
+	case token.GTR:
+		return zipExpr(l, r, op, func(x, y float64) float64 { return exprBool(x > y) })
+	case token.LEQ:
+		return zipExpr(l, r, op, func(x, y float64) float64 { return exprBool(x <= y) })
+	case token.GEQ:
+		return zipExpr(l, r, op, func(x, y float64) float64 { return exprBool(x >= y) })
+	case token.EQL:
+		return zipExpr(l, r, op, func(x, y float64) float64 { return exprBool(x == y) })
+	case token.NEQ:
+		return zipExpr(l, r, op, func(x, y float64) float64 { return exprBool(x != y) })
+	}
+	panic("expression: unsupported operator " + op)
+}
+
+func (c *exprCtx) evalCall(n *ast.CallExpr) exprValue {
+	ident, ok := n.Fun.(*ast.Ident)
+	if !ok {
+		panic("expression: unsupported call target")
+	}
+	name := ident.Name
+	need := func(k int) {
+		if len(n.Args) != k {
+			panic(fmt.Sprintf("expression: %s takes %d arguments, got %d", name, k, len(n.Args)))
+		}
+	}
+	arg := func(i int) exprValue { return c.eval(n.Args[i]) }
+
+	switch name {
+	case "where":
+		// Lazy on a scalar condition, so a guarded branch neither divides by zero nor
+		// consumes randomness.
+		need(3)
+		cond := arg(0)
+		if len(cond) == 1 {
+			if cond[0] != 0 {
+				return arg(1)
+			}
+			return arg(2)
+		}
+		// A vector condition selects elementwise, so each branch has to line up with it: the
+		// same width, or a scalar that broadcasts. where is the one place a mismatch was not
+		// caught, because it selects directly rather than going through broadcastLen, and it
+		// failed two ways depending on which side was short — a branch wider than the condition
+		// silently used its first len(cond) elements and dropped the rest, and a narrower one
+		// ran off the end as a bare Go index panic naming neither the function nor the widths.
+		// Both are answers to a question nobody asked; there is no reading of a width-5 branch
+		// under a width-3 condition that is what the author meant.
+		a, b := arg(1), arg(2)
+		for _, branch := range []struct {
+			which string
+			value exprValue
+		}{{"then", a}, {"else", b}} {
+			if len(branch.value) != len(cond) && len(branch.value) != 1 {
+				panic(fmt.Sprintf(
+					"expression: where's %s branch has width %d, which is neither the "+
+						"condition's %d nor 1", branch.which, len(branch.value), len(cond)))
+			}
+		}
+		out := make(exprValue, len(cond))
+		for i := range cond {
+			if cond[i] != 0 {
+				out[i] = at(a, i)
+			} else {
+				out[i] = at(b, i)
+			}
+		}
+		return out
+	case "iid":
+		// Evaluate the expression n times over, giving n independent samples.
+		need(2)
+		nv := arg(0)
+		if len(nv) != 1 {
+			panic("expression: iid's count must be a scalar")
+		}
+		count := toIndex(nv[0], "iid's count")
+		if count < 1 {
+			panic("expression: iid's count must be at least 1")
+		}
+		inner := c.explicit()
+		out := make(exprValue, count)
+		for i := 0; i < count; i++ {
+			v := inner.eval(n.Args[1])
+			if len(v) != 1 {
+				panic(fmt.Sprintf(
+					"expression: iid expects a scalar-valued expression, got width %d", len(v)))
+			}
+			out[i] = v[0]
+		}
+		return out
+	case "shared":
+		// One evaluation whose result may broadcast: the explicit way to say that a single
+		// sample is meant to apply across a whole field.
+		need(1)
+		return c.explicit().eval(n.Args[0])
+	case "each":
+		// iid with the lane index in scope: a vector of width count whose element i is the
+		// expression evaluated with that i bound.
+		//
+		// This is the one construct that is not elementwise, and it buys three things nothing
+		// else can. Element i may read element i-1 of something (a cohort ages), so an index
+		// shift becomes sayable. Everything inside a lane is a scalar, so where is lazy per
+		// lane and a skipped lane draws nothing. And lanes run in order, so a draw per lane
+		// interleaves the way a Go loop does rather than taking every gamma before any
+		// poisson. It is a bounded comprehension with no assignment and no recursion, so an
+		// expression still always terminates.
+		need(3)
+		countValue := arg(0)
+		if len(countValue) != 1 {
+			panic("expression: each's count must be a scalar")
+		}
+		count := toIndex(countValue[0], "each's count")
+		if count < 1 {
+			panic("expression: each's count must be at least 1")
+		}
+		index, ok := n.Args[1].(*ast.Ident)
+		if !ok {
+			panic("expression: each's second argument must be a name to bind the lane " +
+				"index to, as in each(40, i, ...)")
+		}
+		inner := c.explicit()
+		// The env is shared with the enclosing scope, so the binding must not outlive the loop.
+		defer inner.bind(index.Name)()
+		out := make(exprValue, count)
+		for i := 0; i < count; i++ {
+			inner.env[index.Name] = exprValue{float64(i)}
+			v := inner.eval(n.Args[2])
+			if len(v) != 1 {
+				panic(fmt.Sprintf(
+					"expression: each expects a scalar-valued expression per lane, got "+
+						"width %d", len(v)))
+			}
+			out[i] = v[0]
+		}
+		return out
+	case "scan":
+		// each with an accumulator threaded through the lanes: lane i evaluates the expression
+		// with the lane index bound and acc bound to the previous lane's value (init at lane 0),
+		// and the value of the call is the last lane's. So it is a fold, not a map.
+		//
+		// This is the one thing each cannot do. Its lanes are independent and each must produce
+		// a scalar, so nothing a lane computes reaches the next one. A scan lane may be any
+		// width, and that is what closes the case that asked for this: allocating k simultaneous
+		// arrivals to the first k free slots, where what has to be carried between lanes is
+		// which slots are now taken rather than a running total. Running maxima and true prefix
+		// operations are the same shape, and become O(n) rather than the O(n^2) of an each of
+		// sums over ever-longer slices.
+		//
+		// It stays as bounded as each: the count is fixed before the loop, acc is threaded
+		// rather than assigned to, and there is still no recursion, so an expression still
+		// always terminates.
+		need(5)
+		countValue := arg(0)
+		if len(countValue) != 1 {
+			panic("expression: scan's count must be a scalar")
+		}
+		count := toIndex(countValue[0], "scan's count")
+		if count < 0 {
+			// Zero is allowed, unlike each's: a fold over no lanes is init, which is the right
+			// answer rather than an edge case, and it lets the count come from data.
+			panic("expression: scan's count must not be negative")
+		}
+		index, ok := n.Args[1].(*ast.Ident)
+		if !ok {
+			panic("expression: scan's second argument must be a name to bind the lane index " +
+				"to, as in scan(40, i, acc, 0, ...)")
+		}
+		accumulator, ok := n.Args[2].(*ast.Ident)
+		if !ok {
+			panic("expression: scan's third argument must be a name to bind the accumulator " +
+				"to, as in scan(40, i, acc, 0, ...)")
+		}
+		if accumulator.Name == index.Name {
+			panic("expression: scan's lane index and accumulator cannot share the name " +
+				index.Name)
+		}
+		// The initial value is evaluated once, in the enclosing scope, before either name is
+		// bound — so an init that mentions them means the outer ones, as it reads.
+		value := arg(3)
+		inner := c.explicit()
+		defer inner.bind(index.Name)()
+		defer inner.bind(accumulator.Name)()
+		for i := 0; i < count; i++ {
+			inner.env[index.Name] = exprValue{float64(i)}
+			inner.env[accumulator.Name] = value
+			value = inner.eval(n.Args[4])
+		}
+		return value
+	case "lag":
+		// A read of a partition's committed state further back than the current row, which is
+		// all a bare name or an upstreams alias ever gives.
+		need(2)
+		name, ok := n.Args[0].(*ast.Ident)
+		if !ok {
+			panic("expression: lag's first argument must be an upstream alias or a field name")
+		}
+		rowValue := arg(1)
+		if len(rowValue) != 1 {
+			panic("expression: lag's row must be a scalar")
+		}
+		if c.lag == nil {
+			panic("expression: lag is unavailable here")
+		}
+		return c.lag(name.Name, toIndex(rowValue[0], "lag's row"))
+	}
+
+	switch name {
+	case "clamp":
+		need(3)
+		x, lo, hi := arg(0), arg(1), arg(2)
+		return zipExpr(zipExpr(x, lo, name, math.Max), hi, name, math.Min)
+	case "min":
+		need(2)
+		return zipExpr(arg(0), arg(1), name, math.Min)
+	case "max":
+		need(2)
+		return zipExpr(arg(0), arg(1), name, math.Max)
+	case "pow":
+		need(2)
+		return zipExpr(arg(0), arg(1), name, math.Pow)
+	case "abs":
+		need(1)
+		return mapExpr(arg(0), math.Abs)
+	case "floor":
+		need(1)
+		return mapExpr(arg(0), math.Floor)
+	case "exp":
+		need(1)
+		return mapExpr(arg(0), math.Exp)
+	case "log":
+		need(1)
+		return mapExpr(arg(0), math.Log)
+	case "sqrt":
+		need(1)
+		return mapExpr(arg(0), math.Sqrt)
+	case "sin":
+		need(1)
+		return mapExpr(arg(0), math.Sin)
+	case "cos":
+		need(1)
+		return mapExpr(arg(0), math.Cos)
+	case "tan":
+		need(1)
+		return mapExpr(arg(0), math.Tan)
+	case "asin":
+		need(1)
+		return mapExpr(arg(0), math.Asin)
+	case "acos":
+		need(1)
+		return mapExpr(arg(0), math.Acos)
+	case "atan":
+		need(1)
+		return mapExpr(arg(0), math.Atan)
+	case "atan2":
+		// Two-argument arctangent, atan2(y, x), for a full-circle angle from a pair of
+		// components — a solar azimuth from its projections, say. Kept as its own primitive
+		// rather than atan(y/x) so the quadrant is resolved and x == 0 is well defined,
+		// matching math.Atan2 exactly.
+		need(2)
+		return zipExpr(arg(0), arg(1), name, math.Atan2)
+	case "erf":
+		need(1)
+		return mapExpr(arg(0), math.Erf)
+	case "erfc":
+		// The primitive a Gaussian CDF is built from: 0.5 * erfc(-x / sqrt(2)). Kept as
+		// erfc rather than offering the CDF directly so it matches math.Erfc exactly, which
+		// is what lets a model expressed here agree with compiled Go to rounding.
+		need(1)
+		return mapExpr(arg(0), math.Erfc)
+	case "fill":
+		need(2)
+		nv, x := arg(0), arg(1)
+		if len(nv) != 1 {
+			panic("expression: fill's width must be a scalar")
+		}
+		w := toIndex(nv[0], "fill's width")
+		if w < 1 {
+			panic("expression: fill's width must be at least 1")
+		}
+		out := make(exprValue, w)
+		for i := 0; i < w; i++ {
+			out[i] = at(x, i)
+		}
+		return out
+	case "slice":
+		// A block of a vector, for state and params that pack several quantities end to end:
+		// the nine coefficients of a channel inside one flat thirty-six-wide param, say.
+		//
+		// A zero width gives an empty value rather than an error. That is not permissiveness:
+		// the natural prefix sum, each(n, i, sum(slice(q, 0, i))), asks for nothing at lane 0,
+		// and nothing is the correct block to ask for there. Rejecting it forced a guarded
+		// spelling that needed both a where and a max(i, 1) — the where for the answer, the max
+		// because the untaken branch is still bounds-checked — for the one case the construct
+		// exists to serve. sum of an empty value is 0, so the reduction lands where it should.
+		need(3)
+		v, fromValue, widthValue := arg(0), arg(1), arg(2)
+		if len(fromValue) != 1 || len(widthValue) != 1 {
+			panic("expression: slice's start and width must be scalars")
+		}
+		from := toIndex(fromValue[0], "slice's start")
+		width := toIndex(widthValue[0], "slice's width")
+		if width < 0 {
+			panic("expression: slice's width must not be negative")
+		}
+		if from < 0 || from+width > len(v) {
+			panic(fmt.Sprintf(
+				"expression: slice(%d, %d) is outside a width-%d value", from, width, len(v)))
+		}
+		return append(make(exprValue, 0, width), v[from:from+width]...)
+	case "concat":
+		// The other half of slice: assemble a field from pieces that are computed
+		// differently, such as a cohort's boundary buckets against its interior.
+		if len(n.Args) < 2 {
+			panic("expression: concat takes at least 2 arguments, got " +
+				strconv.Itoa(len(n.Args)))
+		}
+		out := make(exprValue, 0, len(n.Args))
+		for i := range n.Args {
+			out = append(out, arg(i)...)
+		}
+		return out
+	case "width":
+		// How many elements a value has, for a spec that must adapt to a param's length
+		// rather than hard-code it. Without it the only way to ask is a trick, and the
+		// obvious spelling of that trick, sum(0 * x + 1), is silently wrong: 0 * NaN is NaN.
+		need(1)
+		return exprValue{float64(len(arg(0)))}
+	case "sum":
+		need(1)
+		total := 0.0
+		for _, x := range arg(0) {
+			total += x
+		}
+		return exprValue{total}
+	case "dot":
+		need(2)
+		a, b := arg(0), arg(1)
+		nn := broadcastLen(a, b, name)
+		total := 0.0
+		for i := 0; i < nn; i++ {
+			total += at(a, i) * at(b, i)
+		}
+		return exprValue{total}
+	case "neighbours_sum":
+		need(1)
+		return c.overTopology(name, arg(0), c.topology.NeighboursSum)
+	case "laplacian":
+		need(1)
+		return c.overTopology(name, arg(0), c.topology.Laplacian)
+	case "normal":
+		need(2)
+		return c.draw2(name, arg(0), arg(1), c.sampler.Normal)
+	case "uniform":
+		need(2)
+		return c.draw2(name, arg(0), arg(1), c.sampler.Uniform)
+	case "gamma":
+		need(2)
+		return c.draw2(name, arg(0), arg(1), c.sampler.Gamma)
+	case "beta":
+		need(2)
+		return c.draw2(name, arg(0), arg(1), c.sampler.Beta)
+	case "binomial":
+		need(2)
+		// pkg/rng leaves Binomial on distuv, whose three-branch algorithm was not worth
+		// reimplementing. Draw from the sampler's own generator so a partition still has
+		// exactly one stream and runs stay reproducible.
+		return c.draw2(name, arg(0), arg(1), func(nn, p float64) float64 {
+			return distuv.Binomial{N: nn, P: p, Src: c.sampler.Rand()}.Rand()
+		})
+	case "exponential":
+		need(1)
+		return c.draw1(name, arg(0), c.sampler.Exponential)
+	case "poisson":
+		need(1)
+		return c.draw1(name, arg(0), c.sampler.Poisson)
+	}
+	panic("expression: unknown function " + name)
+}
+
+// draw1 applies a one-parameter draw elementwise; each element is an independent sample.
+func (c *exprCtx) draw1(name string, a exprValue, f func(x float64) float64) exprValue {
+	checkDrawWidth(name, len(a), c.drawsAreExplicit)
+	return mapExpr(a, f)
+}
+
+// draw2 applies a two-parameter draw elementwise, broadcasting the parameters; each element
+// is an independent sample.
+func (c *exprCtx) draw2(
+	name string,
+	a, b exprValue,
+	f func(x, y float64) float64,
+) exprValue {
+	n := broadcastLen(a, b, name)
+	checkDrawWidth(name, n, c.drawsAreExplicit)
+	out := make(exprValue, n)
+	for i := 0; i < n; i++ {
+		out[i] = f(at(a, i), at(b, i))
+	}
+	return out
+}
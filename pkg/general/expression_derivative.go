@@ -0,0 +1,949 @@
+package general
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"strconv"
+
+	"gonum.org/v1/gonum/blas/blas64"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/mathext"
+
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// ExpressionDerivativeMode is which way ExpressionDerivative.Jacobian sweeps.
+type ExpressionDerivativeMode int
+
+const (
+	// ExpressionReverseMode sweeps once per element of the value, back to every input at
+	// once, so it is the cheap way to differentiate a scalar objective of many params.
+	ExpressionReverseMode ExpressionDerivativeMode = iota
+	// ExpressionForwardMode sweeps once per input element, out to every element of the value
+	// at once, so it is the cheap way to differentiate a wide value of a few params.
+	ExpressionForwardMode
+)
+
+// ParseExpressionDerivativeMode reads a mode as a spec spells it: reverse, the default when
+// it is empty, or forward.
+func ParseExpressionDerivativeMode(mode string) (ExpressionDerivativeMode, error) {
+	switch mode {
+	case "", "reverse":
+		return ExpressionReverseMode, nil
+	case "forward":
+		return ExpressionForwardMode, nil
+	}
+	return 0, fmt.Errorf("mode must be forward or reverse, got %q", mode)
+}
+
+// ExpressionDerivative differentiates an expression with respect to named inputs — the
+// params a model is fitted by, say — so that a model written as expressions can feed
+// gradient descent, a Laplace approximation or HMC with no derivative written by hand:
+//
+//	d, _ := NewExpressionDerivative("sum(logpdf_normal(data, mu, sigma))", nil, nil, nil,
+//		[]string{"mu", "sigma"})
+//	d.SetParams(params)
+//	d.Evaluate()
+//	gradient := d.Jacobian(ExpressionReverseMode)
+//
+// Names are resolved as an ExpressionEvaluator resolves them, and an input is one of them: a
+// param, or anything else its caller sets. Inputs are laid out end to end in the order given,
+// each as wide as its value, so the Jacobian of a width-m value has one row of that many
+// elements per element of the value. Everything else is a constant.
+//
+// Evaluate records the expression as it computes it, and the derivatives are then read off the
+// record in either mode, both giving the same numbers: Forward and Reverse are one sweep
+// each, a Jacobian-vector and a vector-Jacobian product, and Jacobian is as many sweeps as
+// the cheaper mode needs to build all of it.
+//
+// Everything in the language is differentiable except draws, whose value is not a function
+// of their parameters, and cholesky, neighbours_sum, laplacian, logpdf_categorical, which
+// report that when they are reached. A comparison, floor or width has derivative 0, min and
+// max take the derivative of the argument they chose, and where and each that of the branch
+// they took, so a derivative is the one-sided one at a kink. Where a log-density is -Inf its
+// derivatives are 0. lag reads history, which is data, and so it is a constant too.
+type ExpressionDerivative struct {
+	expr      ast.Expr
+	bindings  []parsedExprBinding
+	functions map[string]*parsedExprFunction
+	matrices  map[string][2]int
+	wrt       []string
+	set       map[string]exprValue
+	params    *simulator.Params
+	lag       func(name string, row int) exprValue
+	tape      exprTape
+	scope     []exprTapeLocal
+	base      int
+	inlining  []string
+	inputs    map[string]int
+	tables    map[*ast.CallExpr]*exprTable
+	order     []int
+	picks     []int
+	offsets   []int
+	out       int
+	result    []float64
+	seed      []float64
+	jacobian  []float64
+}
+
+// exprTapeLocal is a name a binding, a lane or a function's parameter declares, and the node
+// that holds its value.
+type exprTapeLocal struct {
+	name string
+	node int
+}
+
+// NewExpressionDerivative parses expr after bindings, with functions callable from both and
+// matrices declaring which names are row-major [rows, cols] matrices, to be differentiated
+// with respect to wrt. It returns an error for anything that cannot be parsed, a malformed
+// function or shape, and an input that is repeated or is a binding, which would hide it;
+// other errors surface when Evaluate reaches the node that has them.
+func NewExpressionDerivative(
+	expr string,
+	bindings []ExpressionBinding,
+	functions []ExpressionFunction,
+	matrices map[string][]int,
+	wrt []string,
+) (*ExpressionDerivative, error) {
+	d := &ExpressionDerivative{
+		matrices: make(map[string][2]int, len(matrices)),
+		wrt:      wrt,
+		set:      make(map[string]exprValue),
+		inputs:   make(map[string]int, len(wrt)),
+		tables:   make(map[*ast.CallExpr]*exprTable),
+		offsets:  make([]int, len(wrt)+1),
+		out:      -1,
+	}
+	var err error
+	if d.expr, err = parser.ParseExpr(expr); err != nil {
+		return nil, fmt.Errorf("parsing %q: %w", expr, err)
+	}
+	declared := make(map[string]bool, len(bindings))
+	for _, b := range bindings {
+		parsed, err := parser.ParseExpr(b.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing binding %s: %w", b.Name, err)
+		}
+		d.bindings = append(d.bindings, parsedExprBinding{b.Name, parsed})
+		declared[b.Name] = true
+	}
+	var issues []ExpressionIssue
+	if d.functions, issues = parseExprFunctions(functions); len(issues) > 0 {
+		return nil, fmt.Errorf("%s: %s", issues[0].Where, issues[0].Message)
+	}
+	for name, dims := range matrices {
+		if len(dims) != 2 || dims[0] < 1 || dims[1] < 1 {
+			return nil, fmt.Errorf("matrices entry %s: a shape is [rows, cols], both at "+
+				"least 1; got %v", name, dims)
+		}
+		d.matrices[name] = [2]int{dims[0], dims[1]}
+	}
+	seen := make(map[string]bool, len(wrt))
+	for _, name := range wrt {
+		switch {
+		case seen[name]:
+			return nil, fmt.Errorf("%s is named twice to differentiate with respect to", name)
+		case declared[name]:
+			return nil, fmt.Errorf("%s is a binding, so it cannot be differentiated with "+
+				"respect to; differentiate with respect to what it is computed from", name)
+		}
+		seen[name] = true
+	}
+	return d, nil
+}
+
+// Set gives name the value value until it is next set, as ExpressionEvaluator.Set does. A nil
+// value unsets it.
+func (d *ExpressionDerivative) Set(name string, value []float64) {
+	if value == nil {
+		delete(d.set, name)
+		return
+	}
+	d.set[name] = value
+}
+
+// SetParams makes params' entries readable by name, beneath anything Set has given a value.
+func (d *ExpressionDerivative) SetParams(params *simulator.Params) {
+	d.params = params
+}
+
+// global is what name means outside every binding, lane and function, or nil.
+func (d *ExpressionDerivative) global(name string) exprValue {
+	if v, ok := d.set[name]; ok {
+		return v
+	}
+	if d.params != nil {
+		if values, ok := d.params.Map[name]; ok {
+			if values == nil {
+				return exprValue{}
+			}
+			return values
+		}
+	}
+	if name == "pi" {
+		return exprValue{math.Pi}
+	}
+	return nil
+}
+
+// Evaluate computes the expression at the current values, recording it for Forward, Reverse
+// and Jacobian, and returns its value: a buffer valid until the next Evaluate.
+func (d *ExpressionDerivative) Evaluate() []float64 {
+	d.tape.n, d.scope, d.base, d.inlining = 0, d.scope[:0], 0, d.inlining[:0]
+	d.out = -1
+	for i, name := range d.wrt {
+		v := d.global(name)
+		if v == nil {
+			panic("expression: " + name + " has no value to differentiate with respect to")
+		}
+		input := d.tape.borrowed(exprInput, v)
+		d.matrix(name, input)
+		d.inputs[name] = input
+		d.offsets[i+1] = d.offsets[i] + len(v)
+	}
+	for _, b := range d.bindings {
+		node := d.record(b.expr)
+		d.scope = append(d.scope, exprTapeLocal{b.name, node})
+	}
+	d.out = d.record(d.expr)
+	return d.tape.value(d.out)
+}
+
+// InputWidth is how many elements the inputs have between them, as of the last Evaluate.
+func (d *ExpressionDerivative) InputWidth() int {
+	return d.offsets[len(d.wrt)]
+}
+
+func (d *ExpressionDerivative) recorded() {
+	if d.out < 0 {
+		panic("expression: a derivative needs Evaluate first")
+	}
+}
+
+// Forward is the derivative of the value in direction, a vector over the inputs: J·direction,
+// the Jacobian-vector product, in one forward sweep. It returns a buffer valid until the next
+// call.
+func (d *ExpressionDerivative) Forward(direction []float64) []float64 {
+	d.recorded()
+	checkWidth("the direction", len(direction), d.InputWidth())
+	t := &d.tape
+	for i, name := range d.wrt {
+		t.nodes[d.inputs[name]].dot = direction[d.offsets[i]:d.offsets[i+1]]
+	}
+	t.forward()
+	out := &t.nodes[d.out]
+	d.result = take((*exprValue)(&d.result), len(out.value))
+	if out.active {
+		copy(d.result, out.dot)
+	} else {
+		clear(d.result)
+	}
+	return d.result
+}
+
+// Reverse is cotangent, a vector over the value, times the Jacobian: the vector-Jacobian
+// product, in one reverse sweep, which for a cotangent of ones is the gradient of the value's
+// sum. It returns a buffer valid until the next call.
+func (d *ExpressionDerivative) Reverse(cotangent []float64) []float64 {
+	d.recorded()
+	t := &d.tape
+	out := &t.nodes[d.out]
+	checkWidth("the cotangent", len(cotangent), len(out.value))
+	d.result = take((*exprValue)(&d.result), d.InputWidth())
+	clear(d.result)
+	if !out.active {
+		return d.result
+	}
+	t.zero(true)
+	copy(out.bar, cotangent)
+	t.reverse(d.out)
+	for i, name := range d.wrt {
+		copy(d.result[d.offsets[i]:], t.nodes[d.inputs[name]].bar)
+	}
+	return d.result
+}
+
+// Jacobian is the derivative of every element of the value with respect to every input
+// element, row-major with one row per element of the value, built by mode's sweeps. It
+// returns a buffer valid until the next call.
+func (d *ExpressionDerivative) Jacobian(mode ExpressionDerivativeMode) []float64 {
+	d.recorded()
+	rows, cols := len(d.tape.value(d.out)), d.InputWidth()
+	d.jacobian = take((*exprValue)(&d.jacobian), rows*cols)
+	if mode == ExpressionForwardMode {
+		d.seed = take((*exprValue)(&d.seed), cols)
+		clear(d.seed)
+		for j := 0; j < cols; j++ {
+			d.seed[j] = 1
+			for i, v := range d.Forward(d.seed) {
+				d.jacobian[i*cols+j] = v
+			}
+			d.seed[j] = 0
+		}
+		return d.jacobian
+	}
+	d.seed = take((*exprValue)(&d.seed), rows)
+	clear(d.seed)
+	for i := 0; i < rows; i++ {
+		d.seed[i] = 1
+		copy(d.jacobian[i*cols:], d.Reverse(d.seed))
+		d.seed[i] = 0
+	}
+	return d.jacobian
+}
+
+// matrix gives node, the value of the global name, the rows its declared shape says it has,
+// checking that it is that wide.
+func (d *ExpressionDerivative) matrix(name string, node int) {
+	shape, ok := d.matrices[name]
+	if !ok {
+		return
+	}
+	if v := d.tape.value(node); len(v) != shape[0]*shape[1] {
+		panic(fmt.Sprintf("expression: %s is declared %dx%d but has width %d",
+			name, shape[0], shape[1], len(v)))
+	}
+	d.tape.nodes[node].rows = shape[0]
+}
+
+// local is the node the innermost declaration of name in scope holds, if there is one. Inside
+// a function only its parameters are in scope.
+func (d *ExpressionDerivative) local(name string) (int, bool) {
+	for i := len(d.scope) - 1; i >= d.base; i-- {
+		if d.scope[i].name == name {
+			return d.scope[i].node, true
+		}
+	}
+	return 0, false
+}
+
+// scalar is the single number node i holds, or a panic with message.
+func (d *ExpressionDerivative) scalar(i int, message string) float64 {
+	v := d.tape.value(i)
+	if len(v) != 1 {
+		panic("expression: " + message)
+	}
+	return v[0]
+}
+
+// carry makes node i a matrix with the rows of the first of from that is one.
+func (d *ExpressionDerivative) carry(i int, from ...int) int {
+	for _, f := range from {
+		if rows := d.tape.nodes[f].rows; rows > 0 {
+			d.tape.nodes[i].rows = rows
+			break
+		}
+	}
+	return i
+}
+
+// record evaluates node onto the tape, with the same values, and the same errors, as the
+// compiled expression, and returns the node holding its value.
+func (d *ExpressionDerivative) record(node ast.Expr) int {
+	t := &d.tape
+	switch n := node.(type) {
+	case *ast.BasicLit:
+		v, err := strconv.ParseFloat(n.Value, 64)
+		if err != nil {
+			panic("expression: bad numeric literal " + n.Value)
+		}
+		return t.constant(v)
+	case *ast.Ident:
+		if i, ok := d.local(n.Name); ok {
+			return i
+		}
+		if len(d.inlining) > 0 && n.Name != "pi" {
+			panic("expression: function " + d.inlining[len(d.inlining)-1] +
+				" has no parameter " + n.Name + "; a function sees only its parameters and pi")
+		}
+		if i, ok := d.inputs[n.Name]; ok {
+			return i
+		}
+		v := d.global(n.Name)
+		if v == nil {
+			panic("expression: unknown name " + n.Name)
+		}
+		i := t.borrowed(exprConstant, v)
+		d.matrix(n.Name, i)
+		return i
+	case *ast.ParenExpr:
+		return d.record(n.X)
+	case *ast.UnaryExpr:
+		x := d.record(n.X)
+		switch n.Op {
+		case token.SUB:
+			return d.carry(t.elementwise(len(t.value(x)),
+				func(x []float64) float64 { return -x[0] },
+				func(x []float64, y float64, d []float64) { d[0] = -1 }, x), x)
+		case token.ADD:
+			return x
+		case token.NOT:
+			return d.carry(d.constantMap(x, func(x float64) float64 {
+				return exprBool(x == 0)
+			}), x)
+		}
+		panic("expression: unsupported syntax")
+	case *ast.IndexExpr:
+		x, index := d.record(n.X), d.record(n.Index)
+		i := toIndex(d.scalar(index, "index must be a scalar"), "an index")
+		if v := t.value(x); i < 0 || i >= len(v) {
+			panic(fmt.Sprintf("expression: index %d out of range for width %d", i, len(v)))
+		}
+		return t.slice(x, i, 1)
+	case *ast.BinaryExpr:
+		return d.binary(n)
+	case *ast.CallExpr:
+		return d.call(n)
+	}
+	panic("expression: unsupported syntax")
+}
+
+// constantMap records f of each element of node x as a constant: the value of something whose
+// derivative is 0 wherever it has one.
+func (d *ExpressionDerivative) constantMap(x int, f func(float64) float64) int {
+	t := &d.tape
+	i := t.add(exprConstant)
+	v := t.value(x)
+	out := t.own(i, len(v))
+	for j, e := range v {
+		out[j] = f(e)
+	}
+	return i
+}
+
+// constantZip records f of the broadcast elements of nodes x and y as a constant.
+func (d *ExpressionDerivative) constantZip(x, y int, what string, f func(a, b float64) float64) int {
+	t := &d.tape
+	i := t.add(exprConstant)
+	a, b := t.value(x), t.value(y)
+	out := t.own(i, broadcastLen(a, b, what))
+	for j := range out {
+		out[j] = f(at(a, j), at(b, j))
+	}
+	return i
+}
+
+// exprPartials2 are the partial derivatives of the two-argument elementwise functions, given
+// their arguments and value. At a tie min and max follow their first argument.
+var exprPartials2 = map[string]func(a, b, y float64) (float64, float64){
+	"+": func(a, b, y float64) (float64, float64) { return 1, 1 },
+	"-": func(a, b, y float64) (float64, float64) { return 1, -1 },
+	"*": func(a, b, y float64) (float64, float64) { return b, a },
+	"/": func(a, b, y float64) (float64, float64) { return 1 / b, -a / (b * b) },
+	"%": func(a, b, y float64) (float64, float64) { return 1, -math.Trunc(a / b) },
+	"min": func(a, b, y float64) (float64, float64) {
+		if a <= b {
+			return 1, 0
+		}
+		return 0, 1
+	},
+	"max": func(a, b, y float64) (float64, float64) {
+		if a >= b {
+			return 1, 0
+		}
+		return 0, 1
+	},
+	"pow": func(a, b, y float64) (float64, float64) {
+		// y log a is 0 log 0 where y is 0, and that limit is 0.
+		if y == 0 {
+			return b * math.Pow(a, b-1), 0
+		}
+		return b * math.Pow(a, b-1), y * math.Log(a)
+	},
+	"atan2": func(a, b, y float64) (float64, float64) {
+		r := a*a + b*b
+		return b / r, -a / r
+	},
+}
+
+// exprValues2 are the two-argument elementwise functions, as the compiled expression computes
+// them.
+var exprValues2 = map[string]func(a, b float64) float64{
+	"+":     func(a, b float64) float64 { return a + b },
+	"-":     func(a, b float64) float64 { return a - b },
+	"*":     func(a, b float64) float64 { return a * b },
+	"/":     func(a, b float64) float64 { return a / b },
+	"%":     math.Mod,
+	"min":   math.Min,
+	"max":   math.Max,
+	"pow":   math.Pow,
+	"atan2": math.Atan2,
+}
+
+// exprPartials1 are the derivatives of the one-argument elementwise functions, given their
+// argument and value.
+var exprPartials1 = map[string]func(x, y float64) float64{
+	"abs": func(x, y float64) float64 {
+		switch {
+		case x > 0:
+			return 1
+		case x < 0:
+			return -1
+		}
+		return 0
+	},
+	"floor": func(x, y float64) float64 { return 0 },
+	"exp":   func(x, y float64) float64 { return y },
+	"log":   func(x, y float64) float64 { return 1 / x },
+	"sqrt":  func(x, y float64) float64 { return 0.5 / y },
+	"sin":   func(x, y float64) float64 { return math.Cos(x) },
+	"cos":   func(x, y float64) float64 { return -math.Sin(x) },
+	"tan":   func(x, y float64) float64 { return 1 + y*y },
+	"asin":  func(x, y float64) float64 { return 1 / math.Sqrt(1-x*x) },
+	"acos":  func(x, y float64) float64 { return -1 / math.Sqrt(1-x*x) },
+	"atan":  func(x, y float64) float64 { return 1 / (1 + x*x) },
+	"erf":   func(x, y float64) float64 { return 2 / math.Sqrt(math.Pi) * math.Exp(-x*x) },
+	"erfc":  func(x, y float64) float64 { return -2 / math.Sqrt(math.Pi) * math.Exp(-x*x) },
+}
+
+// zip records the two-argument elementwise function name of nodes x and y.
+func (d *ExpressionDerivative) zip(name, what string, x, y int) int {
+	t := &d.tape
+	f, partials := exprValues2[name], exprPartials2[name]
+	return t.elementwise(t.broadcast(what, x, y),
+		func(x []float64) float64 { return f(x[0], x[1]) },
+		func(x []float64, y float64, d []float64) { d[0], d[1] = partials(x[0], x[1], y) },
+		x, y)
+}
+
+func (d *ExpressionDerivative) binary(n *ast.BinaryExpr) int {
+	t := &d.tape
+	op := n.Op.String()
+	// && and || short-circuit only when the left side is a scalar, as compiled.
+	if n.Op == token.LAND || n.Op == token.LOR {
+		and := n.Op == token.LAND
+		x := d.record(n.X)
+		if l := t.value(x); len(l) == 1 {
+			if and == (l[0] == 0) {
+				return t.constant(exprBool(!and))
+			}
+			return d.constantMap(d.record(n.Y), func(v float64) float64 {
+				return exprBool(v != 0)
+			})
+		}
+		return d.constantZip(x, d.record(n.Y), op, func(a, b float64) float64 {
+			if and {
+				return exprBool(a != 0 && b != 0)
+			}
+			return exprBool(a != 0 || b != 0)
+		})
+	}
+	x, y := d.record(n.X), d.record(n.Y)
+	switch n.Op {
+	case token.ADD, token.SUB, token.MUL, token.QUO, token.REM:
+		return d.carry(d.zip(op, op, x, y), x, y)
+	case token.LSS:
+		return d.constantZip(x, y, op, func(a, b float64) float64 { return exprBool(a < b) })
+	case token.GTR:
+		return d.constantZip(x, y, op, func(a, b float64) float64 { return exprBool(a > b) })
+	case token.LEQ:
+		return d.constantZip(x, y, op, func(a, b float64) float64 { return exprBool(a <= b) })
+	case token.GEQ:
+		return d.constantZip(x, y, op, func(a, b float64) float64 { return exprBool(a >= b) })
+	case token.EQL:
+		return d.constantZip(x, y, op, func(a, b float64) float64 { return exprBool(a == b) })
+	case token.NEQ:
+		return d.constantZip(x, y, op, func(a, b float64) float64 { return exprBool(a != b) })
+	}
+	panic("expression: unsupported operator " + op)
+}
+
+// exprNotDifferentiable are the functions a derivative cannot be taken through, besides draws.
+var exprNotDifferentiable = map[string]bool{
+	"cholesky": true, "neighbours_sum": true, "laplacian": true, "logpdf_categorical": true,
+}
+
+// exprDraws are every draw, which a derivative cannot be taken through.
+var exprDraws = map[string]bool{
+	"normal": true, "uniform": true, "gamma": true, "beta": true, "binomial": true,
+	"exponential": true, "poisson": true, "negative_binomial": true, "lognormal": true,
+	"student_t": true, "weibull": true, "truncated_normal": true, "categorical": true,
+	"multinomial": true, "dirichlet": true, "mvnormal": true,
+}
+
+func (d *ExpressionDerivative) call(n *ast.CallExpr) int {
+	t := &d.tape
+	ident, ok := n.Fun.(*ast.Ident)
+	if !ok {
+		panic("expression: unsupported call target")
+	}
+	name := ident.Name
+	if f, ok := d.functions[name]; ok {
+		return d.inline(f, n)
+	}
+	if k, ok := exprArity[name]; ok && len(n.Args) != k {
+		panic(fmt.Sprintf("expression: %s takes %d arguments, got %d", name, k, len(n.Args)))
+	}
+	switch name {
+	case "where":
+		cond := d.record(n.Args[0])
+		cv := t.value(cond)
+		if len(cv) == 1 {
+			if cv[0] != 0 {
+				return d.record(n.Args[1])
+			}
+			return d.record(n.Args[2])
+		}
+		then, otherwise := d.record(n.Args[1]), d.record(n.Args[2])
+		for _, branch := range [2]struct {
+			which string
+			node  int
+		}{{"then", then}, {"else", otherwise}} {
+			if w := len(t.value(branch.node)); w != len(cv) && w != 1 {
+				panic(fmt.Sprintf(
+					"expression: where's %s branch has width %d, which is neither the "+
+						"condition's %d nor 1", branch.which, w, len(cv)))
+			}
+		}
+		return t.elementwise(len(cv),
+			func(x []float64) float64 {
+				if x[0] != 0 {
+					return x[1]
+				}
+				return x[2]
+			},
+			func(x []float64, y float64, d []float64) {
+				d[0], d[1], d[2] = 0, exprBool(x[0] != 0), exprBool(x[0] == 0)
+			},
+			cond, then, otherwise)
+	case "iid":
+		k := toIndex(d.scalar(d.record(n.Args[0]), "iid's count must be a scalar"), "iid's count")
+		if k < 1 {
+			panic("expression: iid's count must be at least 1")
+		}
+		lanes := make([]int, k)
+		for i := range lanes {
+			lanes[i] = d.record(n.Args[1])
+			if w := len(t.value(lanes[i])); w != 1 {
+				panic(fmt.Sprintf(
+					"expression: iid expects a scalar-valued expression, got width %d", w))
+			}
+		}
+		return d.concat(lanes)
+	case "shared":
+		return d.record(n.Args[0])
+	case "each":
+		k := toIndex(d.scalar(d.record(n.Args[0]), "each's count must be a scalar"),
+			"each's count")
+		if k < 1 {
+			panic("expression: each's count must be at least 1")
+		}
+		index, named := n.Args[1].(*ast.Ident)
+		if !named {
+			panic("expression: each's second argument must be a name to bind the lane " +
+				"index to, as in each(40, i, ...)")
+		}
+		lanes := make([]int, k)
+		for i := range lanes {
+			d.scope = append(d.scope, exprTapeLocal{index.Name, t.constant(float64(i))})
+			lanes[i] = d.record(n.Args[2])
+			d.scope = d.scope[:len(d.scope)-1]
+			if w := len(t.value(lanes[i])); w != 1 {
+				panic(fmt.Sprintf(
+					"expression: each expects a scalar-valued expression per lane, got "+
+						"width %d", w))
+			}
+		}
+		return d.concat(lanes)
+	case "scan":
+		k := toIndex(d.scalar(d.record(n.Args[0]), "scan's count must be a scalar"),
+			"scan's count")
+		if k < 0 {
+			panic("expression: scan's count must not be negative")
+		}
+		index, indexNamed := n.Args[1].(*ast.Ident)
+		accumulator, accumulatorNamed := n.Args[2].(*ast.Ident)
+		if !indexNamed {
+			panic("expression: scan's second argument must be a name to bind the lane index " +
+				"to, as in scan(40, i, acc, 0, ...)")
+		}
+		if !accumulatorNamed {
+			panic("expression: scan's third argument must be a name to bind the accumulator " +
+				"to, as in scan(40, i, acc, 0, ...)")
+		}
+		if index.Name == accumulator.Name {
+			panic("expression: scan's lane index and accumulator cannot share the name " +
+				index.Name)
+		}
+		value := d.record(n.Args[3])
+		for i := 0; i < k; i++ {
+			d.scope = append(d.scope,
+				exprTapeLocal{index.Name, t.constant(float64(i))},
+				exprTapeLocal{accumulator.Name, value})
+			value = d.record(n.Args[4])
+			d.scope = d.scope[:len(d.scope)-2]
+		}
+		return value
+	case "lag":
+		target, ok := n.Args[0].(*ast.Ident)
+		if !ok {
+			panic("expression: lag's first argument must be an upstream alias or a field name")
+		}
+		row := d.scalar(d.record(n.Args[1]), "lag's row must be a scalar")
+		if d.lag == nil {
+			panic("expression: lag is unavailable here")
+		}
+		return t.borrowed(exprConstant, d.lag(target.Name, toIndex(row, "lag's row")))
+	case "concat":
+		if len(n.Args) < 2 {
+			panic("expression: concat takes at least 2 arguments, got " +
+				strconv.Itoa(len(n.Args)))
+		}
+		parts := make([]int, len(n.Args))
+		for i, arg := range n.Args {
+			parts[i] = d.record(arg)
+		}
+		return d.concat(parts)
+	}
+
+	if exprTableFunctions[name] {
+		return d.tableCall(name, n)
+	}
+	if _, ok := exprArity[name]; !ok {
+		panic("expression: unknown function " + name)
+	}
+	args := make([]int, len(n.Args))
+	for i, arg := range n.Args {
+		args[i] = d.record(arg)
+	}
+	switch {
+	case exprDraws[name]:
+		panic("expression: " + name + " is a draw, and a draw cannot be differentiated")
+	case exprNotDifferentiable[name]:
+		panic("expression: " + name + " cannot be differentiated")
+	case exprMatrixFunctions[name]:
+		return d.matrixCall(name, args)
+	case exprOrderFunctions[name]:
+		return d.orderCall(name, args)
+	case exprDistributions[name]:
+		return d.density(name, args)
+	}
+	switch name {
+	case "clamp":
+		x, lo, hi := args[0], args[1], args[2]
+		width := broadcastWidth(broadcastLen(t.value(x), t.value(lo), name), len(t.value(hi)),
+			name)
+		return t.elementwise(width,
+			func(x []float64) float64 { return math.Min(math.Max(x[0], x[1]), x[2]) },
+			func(x []float64, y float64, d []float64) {
+				above := x[0] >= x[1]
+				below := math.Max(x[0], x[1]) <= x[2]
+				d[0] = exprBool(above && below)
+				d[1] = exprBool(!above && below)
+				d[2] = exprBool(!below)
+			},
+			x, lo, hi)
+	case "min", "max", "pow", "atan2":
+		return d.zip(name, name, args[0], args[1])
+	case "fill":
+		width := toIndex(d.scalar(args[0], "fill's width must be a scalar"), "fill's width")
+		if width < 1 {
+			panic("expression: fill's width must be at least 1")
+		}
+		return t.elementwise(width,
+			func(x []float64) float64 { return x[0] },
+			func(x []float64, y float64, d []float64) { d[0] = 1 },
+			args[1])
+	case "slice":
+		v := t.value(args[0])
+		from := toIndex(d.scalar(args[1], "slice's start and width must be scalars"),
+			"slice's start")
+		width := toIndex(d.scalar(args[2], "slice's start and width must be scalars"),
+			"slice's width")
+		if width < 0 {
+			panic("expression: slice's width must not be negative")
+		}
+		if from < 0 || from+width > len(v) {
+			panic(fmt.Sprintf(
+				"expression: slice(%d, %d) is outside a width-%d value", from, width, len(v)))
+		}
+		return t.slice(args[0], from, width)
+	case "width":
+		return t.constant(float64(len(t.value(args[0]))))
+	case "sum":
+		return d.sum(args[0])
+	case "dot":
+		return d.sum(d.zip("*", name, args[0], args[1]))
+	}
+	partial := exprPartials1[name]
+	f := exprMath[name]
+	return t.elementwise(len(t.value(args[0])),
+		func(x []float64) float64 { return f(x[0]) },
+		func(x []float64, y float64, d []float64) { d[0] = partial(x[0], y) },
+		args[0])
+}
+
+func (d *ExpressionDerivative) sum(x int) int {
+	t := &d.tape
+	i := t.add(exprSum, x)
+	total := 0.0
+	for _, v := range t.value(x) {
+		total += v
+	}
+	t.own(i, 1)[0] = total
+	return i
+}
+
+func (d *ExpressionDerivative) concat(parts []int) int {
+	t := &d.tape
+	i := t.add(exprConcat, parts...)
+	total := 0
+	for _, part := range parts {
+		total += len(t.value(part))
+	}
+	out := t.own(i, total)[:0]
+	for _, part := range parts {
+		out = append(out, t.value(part)...)
+	}
+	return i
+}
+
+// inline records a call to a user-defined function: the arguments in the caller's scope, then
+// the body with only the parameters in scope.
+func (d *ExpressionDerivative) inline(f *parsedExprFunction, n *ast.CallExpr) int {
+	if len(n.Args) != len(f.params) {
+		panic(fmt.Sprintf("expression: %s takes %d arguments, got %d",
+			f.name, len(f.params), len(n.Args)))
+	}
+	if cycle := recursion(d.inlining, f.name); cycle != "" {
+		panic("expression: function " + f.name + " calls itself (" + cycle +
+			"); functions may not recurse")
+	}
+	args := make([]int, len(n.Args))
+	for i, arg := range n.Args {
+		args[i] = d.record(arg)
+	}
+	base := d.base
+	d.base = len(d.scope)
+	for i, param := range f.params {
+		d.scope = append(d.scope, exprTapeLocal{param, args[i]})
+	}
+	d.inlining = append(d.inlining, f.name)
+	out := d.record(f.body)
+	d.inlining = d.inlining[:len(d.inlining)-1]
+	d.scope = d.scope[:d.base]
+	d.base = base
+	return out
+}
+
+// density records a log-density, elementwise or over whole vectors.
+func (d *ExpressionDerivative) density(name string, args []int) int {
+	t := &d.tape
+	if logProb, ok := exprLogDensities[name]; ok {
+		partials := exprLogDensityPartials[name]
+		return t.elementwise(t.broadcast(name, args...), logProb,
+			func(x []float64, y float64, d []float64) {
+				if math.IsInf(y, -1) {
+					clear(d)
+					return
+				}
+				partials(x, d)
+			},
+			args...)
+	}
+	i := t.add(exprScalar, args...)
+	node := &t.nodes[i]
+	out := t.own(i, 1)
+	width := 0
+	for _, a := range args {
+		width += len(t.value(a))
+	}
+	node.partials = take(&node.partials, width)
+	clear(node.partials)
+	switch name {
+	case "logpdf_multinomial":
+		counts, weight := t.value(args[0]), t.value(args[1])
+		sameWidth(name, "counts", "weights", len(counts), len(weight))
+		total := weights(name, weight)
+		logTotal := math.Log(total)
+		trials := 0.0
+		logProb := 0.0
+		for j, v := range counts {
+			if v < 0 || v != math.Floor(v) {
+				logProb = math.Inf(-1)
+				break
+			}
+			trials += v
+			lg, _ := math.Lgamma(v + 1)
+			logProb -= lg
+			if v > 0 {
+				logProb += v * (math.Log(weight[j]) - logTotal)
+			}
+		}
+		lg, _ := math.Lgamma(trials + 1)
+		out[0] = logProb + lg
+		if !math.IsInf(out[0], -1) {
+			for j, v := range counts {
+				// Only positive counts read their weight, but every weight is in the total.
+				if v > 0 {
+					node.partials[len(counts)+j] = v / weight[j]
+				}
+				node.partials[len(counts)+j] -= trials / total
+			}
+		}
+	case "logpdf_dirichlet":
+		v, alpha := t.value(args[0]), t.value(args[1])
+		sameWidth(name, "value", "concentrations", len(v), len(alpha))
+		total := 0.0
+		logProb := 0.0
+		for j, a := range alpha {
+			total += a
+			lg, _ := math.Lgamma(a)
+			logProb += (a-1)*math.Log(v[j]) - lg
+		}
+		lg, _ := math.Lgamma(total)
+		out[0] = logProb + lg
+		if !math.IsInf(out[0], -1) {
+			for j, a := range alpha {
+				node.partials[j] = (a - 1) / v[j]
+				node.partials[len(v)+j] = math.Log(v[j]) - mathext.Digamma(a) + mathext.Digamma(total)
+			}
+		}
+	case "logpdf_mvnormal":
+		d.mvnormal(i, args)
+	}
+	return i
+}
+
+// mvnormal records a multivariate normal log-density. With y = Σ⁻¹(x - μ), its gradient is -y
+// in x, y in μ and -(Σ⁻¹ - yyᵀ)/2 in Σ.
+func (d *ExpressionDerivative) mvnormal(i int, args []int) {
+	t := &d.tape
+	node := &t.nodes[i]
+	v, mu, cov := t.value(args[0]), t.value(args[1]), t.value(args[2])
+	size := broadcastLen(v, mu, "logpdf_mvnormal")
+	factor := &node.solver.covariance
+	factor.factorize("logpdf_mvnormal", cov, size)
+	work := take(&node.solver.work, 2*size)
+	diff, y := work[:size], work[size:]
+	for j := range diff {
+		diff[j] = at(v, j) - at(mu, j)
+	}
+	var dv, yv mat.VecDense
+	dv.SetRawVector(blas64.Vector{N: size, Inc: 1, Data: diff})
+	yv.SetRawVector(blas64.Vector{N: size, Inc: 1, Data: y})
+	singular("logpdf_mvnormal", factor.chol.SolveVecTo(&yv, &dv))
+	node.value[0] = -0.5 * (float64(size)*math.Log(2*math.Pi) + factor.chol.LogDet() +
+		mat.Dot(&dv, &yv))
+	if !node.active {
+		return
+	}
+	// A scalar x or μ broadcasts, and so collects every element's derivative.
+	for j := range y {
+		node.partials[j%len(v)] -= y[j]
+		node.partials[len(v)+j%len(mu)] += y[j]
+	}
+	if t.nodes[args[2]].active {
+		var inverse mat.SymDense
+		singular("logpdf_mvnormal", factor.chol.InverseTo(&inverse))
+		offset := len(v) + len(mu)
+		for r := 0; r < size; r++ {
+			for c := 0; c < size; c++ {
+				node.partials[offset+r*size+c] = -0.5 * (inverse.At(r, c) - y[r]*y[c])
+			}
+		}
+	}
+}
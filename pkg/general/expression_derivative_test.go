@@ -0,0 +1,285 @@
+package general
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// finiteDifferenceJacobian is the central-difference Jacobian of d's value with respect to its
+// inputs, taken by moving the params that hold them.
+func finiteDifferenceJacobian(
+	d *ExpressionDerivative,
+	params map[string][]float64,
+	wrt []string,
+) []float64 {
+	const h = 1e-6
+	evaluate := func() []float64 {
+		p := simulator.NewParams(params)
+		d.SetParams(&p)
+		return append([]float64(nil), d.Evaluate()...)
+	}
+	rows := len(evaluate())
+	var columns [][]float64
+	for _, name := range wrt {
+		for j := range params[name] {
+			x := params[name][j]
+			params[name][j] = x + h
+			up := evaluate()
+			params[name][j] = x - h
+			down := evaluate()
+			params[name][j] = x
+			column := make([]float64, rows)
+			for i := range column {
+				column[i] = (up[i] - down[i]) / (2 * h)
+			}
+			columns = append(columns, column)
+		}
+	}
+	evaluate()
+	jacobian := make([]float64, rows*len(columns))
+	for j, column := range columns {
+		for i, v := range column {
+			jacobian[i*len(columns)+j] = v
+		}
+	}
+	return jacobian
+}
+
+func TestExpressionDerivative(t *testing.T) {
+	functions := []ExpressionFunction{
+		{Name: "softplus", Params: []string{"x"}, Expr: "log(1 + exp(x))"},
+	}
+	matrices := map[string][]int{"a": {2, 2}, "b": {2, 2}}
+	cases := []struct {
+		name     string
+		expr     string
+		bindings []ExpressionBinding
+		params   map[string][]float64
+		wrt      []string
+	}{
+		{
+			name:   "arithmetic broadcasts a scalar over a vector",
+			expr:   "x * y + x / y - y % 1.5 + -x",
+			params: map[string][]float64{"x": {0.3, 1.7, -2.1}, "y": {1.3}},
+			wrt:    []string{"x", "y"},
+		},
+		{
+			name: "elementwise maths",
+			expr: "exp(x) + log(x) + sqrt(x) + sin(x) * cos(x) + tan(x) + erf(x) + erfc(x) + " +
+				"asin(x / 2) + acos(x / 2) + atan(x) + abs(-x) + pow(x, y) + atan2(x, y)",
+			params: map[string][]float64{"x": {0.4, 1.2}, "y": {2.5, 0.7}},
+			wrt:    []string{"x", "y"},
+		},
+		{
+			name: "bindings, functions, sums and indexing",
+			expr: "sum(z * z) + z[1] + dot(z, concat(x, x[0])) + softplus(x[0])",
+			bindings: []ExpressionBinding{
+				{Name: "z", Expr: "concat(x, 2 * y)"},
+			},
+			params: map[string][]float64{"x": {0.5, -1.5}, "y": {3}},
+			wrt:    []string{"x", "y"},
+		},
+		{
+			name:   "where, min, max and clamp take the branch they chose",
+			expr:   "where(x > 0, x * y, -x) + min(x, y) + max(x, 0.5) + clamp(x, -1, 1)",
+			params: map[string][]float64{"x": {0.3, -0.7, 2.2}, "y": {0.9}},
+			wrt:    []string{"x", "y"},
+		},
+		{
+			name:   "a scalar where records only its branch",
+			expr:   "where(y > 0, x * x, log(x))",
+			params: map[string][]float64{"x": {1.5, 2.5}, "y": {-1}},
+			wrt:    []string{"x"},
+		},
+		{
+			name:   "each and scan lanes",
+			expr:   "each(3, i, x[i] * x[2 - i]) + scan(3, i, acc, 0, acc * x[i] + x[i] * x[i])",
+			params: map[string][]float64{"x": {0.5, 1.5, 2.5}},
+			wrt:    []string{"x"},
+		},
+		{
+			name:   "slices and fills",
+			expr:   "slice(x, 1, 2) * fill(2, y)",
+			params: map[string][]float64{"x": {0.1, 0.2, 0.3}, "y": {4}},
+			wrt:    []string{"x", "y"},
+		},
+		{
+			name: "elementwise log-densities",
+			expr: "logpdf_normal(data, mu, sigma) + logpdf_gamma(data, sigma, mu) + " +
+				"logpdf_beta(p, mu, sigma) + logpdf_poisson(counts, mu) + " +
+				"logpdf_student_t(data, mu, sigma, 4) + logpdf_lognormal(data, mu, sigma) + " +
+				"logpdf_exponential(data, mu) + logpdf_weibull(data, mu, sigma) + " +
+				"logpdf_binomial(counts, 6, p) + logpdf_negative_binomial(counts, mu, p) + " +
+				"logpdf_uniform(p, -mu, sigma) + logpdf_truncated_normal(data, mu, sigma, 0, 3)",
+			params: map[string][]float64{
+				"data":   {0.7, 1.9},
+				"p":      {0.3, 0.6},
+				"counts": {2, 5},
+				"mu":     {1.1},
+				"sigma":  {0.8},
+			},
+			wrt: []string{"mu", "sigma"},
+		},
+		{
+			name: "multivariate log-densities",
+			expr: "logpdf_mvnormal(data, mu, concat(v[0], c, c, v[1])) + " +
+				"logpdf_dirichlet(p, alpha) + logpdf_multinomial(counts, p)",
+			params: map[string][]float64{
+				"data":   {0.2, -0.4},
+				"mu":     {0.1, 0.3},
+				"v":      {2, 1},
+				"c":      {0.3},
+				"p":      {0.2, 0.8},
+				"alpha":  {1.5, 3},
+				"counts": {3, 4},
+			},
+			wrt: []string{"data", "mu", "v", "c", "alpha", "p"},
+		},
+		{
+			name: "matrix functions",
+			expr: "sum(matmul(a, b)) + sum(inv(a)) + sum(solve(a, y)) + " +
+				"sum(transpose(b) * a) + sum(diag(a)) + sum(outer(y, y)) + sum(diag(y))",
+			params: map[string][]float64{
+				"a": {3, 1, 0.5, 2},
+				"b": {1, -1, 2, 0.5},
+				"y": {0.7, 1.1},
+			},
+			wrt: []string{"a", "b", "y"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d, err := NewExpressionDerivative(c.expr, c.bindings, functions, matrices, c.wrt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			params := simulator.NewParams(c.params)
+			d.SetParams(&params)
+			value := append([]float64(nil), d.Evaluate()...)
+			forward := append([]float64(nil), d.Jacobian(ExpressionForwardMode)...)
+			reverse := d.Jacobian(ExpressionReverseMode)
+			want := finiteDifferenceJacobian(d, c.params, c.wrt)
+			if len(forward) != len(want) || len(reverse) != len(want) {
+				t.Fatalf("got %d and %d elements, want %d", len(forward), len(reverse), len(want))
+			}
+			for i := range want {
+				if math.Abs(forward[i]-reverse[i]) > 1e-12*(1+math.Abs(reverse[i])) {
+					t.Errorf("element %d: forward %v, reverse %v", i, forward[i], reverse[i])
+				}
+				if math.Abs(reverse[i]-want[i]) > 1e-5*(1+math.Abs(want[i])) {
+					t.Errorf("element %d: got %v, finite differences give %v",
+						i, reverse[i], want[i])
+				}
+			}
+			if strings.Contains(c.expr, "matmul") {
+				return
+			}
+			v, err := NewExpressionEvaluator(c.expr, c.bindings, functions, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v.SetParams(&params)
+			got := v.Evaluate()
+			if len(got) != len(value) {
+				t.Fatalf("got width %d, the evaluator gives %d", len(value), len(got))
+			}
+			for i := range got {
+				if got[i] != value[i] {
+					t.Errorf("element %d: got %v, the evaluator gives %v", i, value[i], got[i])
+				}
+			}
+		})
+	}
+
+	t.Run("products match the Jacobian", func(t *testing.T) {
+		d, err := NewExpressionDerivative("x * x * y", nil, nil, nil, []string{"x", "y"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Set("x", []float64{2, 3})
+		d.Set("y", []float64{5})
+		d.Evaluate()
+		if got := d.Forward([]float64{1, 0, 1}); got[0] != 24 || got[1] != 9 {
+			t.Errorf("forward: got %v, want [24 9]", got)
+		}
+		if got := d.Reverse([]float64{1, 1}); got[0] != 20 || got[1] != 30 || got[2] != 13 {
+			t.Errorf("reverse: got %v, want [20 30 13]", got)
+		}
+	})
+
+	t.Run("constants have derivative 0", func(t *testing.T) {
+		d, err := NewExpressionDerivative("floor(x) + (x > 1) + width(x) + data",
+			nil, nil, nil, []string{"x"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Set("x", []float64{1.5})
+		d.Set("data", []float64{4})
+		d.Evaluate()
+		if got := d.Reverse([]float64{1}); got[0] != 0 {
+			t.Errorf("got %v, want [0]", got)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, c := range []struct {
+			expr     string
+			bindings []ExpressionBinding
+			matrices map[string][]int
+			wrt      []string
+			want     string
+		}{
+			{expr: "x +", wrt: []string{"x"}, want: "parsing"},
+			{expr: "x", wrt: []string{"x", "x"}, want: "named twice"},
+			{
+				expr:     "z",
+				bindings: []ExpressionBinding{{Name: "z", Expr: "2 * x"}},
+				wrt:      []string{"z"},
+				want:     "is a binding",
+			},
+			{expr: "x", matrices: map[string][]int{"x": {2}}, wrt: []string{"x"}, want: "shape"},
+		} {
+			_, err := NewExpressionDerivative(c.expr, c.bindings, nil, c.matrices, c.wrt)
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("%q: got %v, want an error containing %q", c.expr, err, c.want)
+			}
+		}
+		for _, c := range []struct{ expr, want string }{
+			{"normal(x, 1)", "cannot be differentiated"},
+			{"sum(cholesky(x))", "cannot be differentiated"},
+			{"y", "unknown name"},
+		} {
+			d, err := NewExpressionDerivative(c.expr, nil, nil, nil, []string{"x"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.Set("x", []float64{1})
+			func() {
+				defer func() {
+					r := recover()
+					if r == nil || !strings.Contains(r.(string), c.want) {
+						t.Errorf("%q: got panic %v, want one containing %q", c.expr, r, c.want)
+					}
+				}()
+				d.Evaluate()
+			}()
+		}
+	})
+
+	t.Run("modes parse", func(t *testing.T) {
+		for mode, want := range map[string]ExpressionDerivativeMode{
+			"": ExpressionReverseMode, "reverse": ExpressionReverseMode,
+			"forward": ExpressionForwardMode,
+		} {
+			if got, err := ParseExpressionDerivativeMode(mode); err != nil || got != want {
+				t.Errorf("%q: got %v, %v", mode, got, err)
+			}
+		}
+		if _, err := ParseExpressionDerivativeMode("sideways"); err == nil {
+			t.Error("sideways parsed")
+		}
+	})
+}
@@ -0,0 +1,575 @@
+package general
+
+import (
+	"fmt"
+	"go/ast"
+	"math"
+
+	"gonum.org/v1/gonum/blas/blas64"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/mathext"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// Beyond the draws every model needs, expressions have a wider catalogue, each with a
+// logpdf_ partner taking the value first and then the same parameters, so a partition can
+// score data as readily as it simulates it: sum(logpdf_poisson(counts, rates)) is a
+// log-likelihood contribution. Discrete logpdfs are log-masses.
+//
+// Elementwise, broadcasting their parameters exactly as normal does:
+//
+//   - negative_binomial(r, p) counts failures before the r-th success, with mean
+//     r(1 - p) / p. It is drawn as poisson(gamma(r, p / (1 - p))), as the inference
+//     package's negative binomial likelihood generates it.
+//   - lognormal(mu, sigma) is exp(normal(mu, sigma)).
+//   - student_t(nu, mu, sigma) has nu degrees of freedom, location mu and scale sigma.
+//   - weibull(k, lambda) has shape k and scale lambda.
+//   - truncated_normal(mu, sigma, lo, hi) is normal(mu, sigma) conditioned on [lo, hi],
+//     drawn by inversion from one uniform, so each sample costs exactly one.
+//
+// and logpdf_normal, logpdf_uniform, logpdf_exponential, logpdf_poisson, logpdf_gamma,
+// logpdf_beta and logpdf_binomial for the draws that were already there. These all give one
+// value per element, for sum to total.
+//
+// Vector-valued, each giving one sample of a distribution over vectors:
+//
+//   - categorical(weights) is an index drawn with probability proportional to its weight.
+//   - multinomial(n, weights) allocates n trials across the weights' categories.
+//   - dirichlet(alpha) is a point on the simplex, one element per concentration.
+//   - mvnormal(mu, cov) is a normal vector with mean mu and covariance cov, a width(mu)^2
+//     value read row-major; as the width says its shape, it need not be declared a matrix.
+//
+// Their logpdfs give one value for the whole vector, except logpdf_categorical, which scores
+// each element of its first argument as an index.
+//
+// The width rule is the one every draw follows: a draw whose result would be a single number
+// must say whether it is one sample or many, so categorical is written iid(n, categorical(w))
+// or shared(categorical(w)) like any scalar draw. A vector-valued draw consumes its stream
+// element by element, in order, and a categorical one uniform, so where in a sequence a draw
+// sits decides what it gets, just as for the others.
+
+// exprDistributions are the draws and log-densities compiled by distribution.
+var exprDistributions = map[string]bool{
+	"negative_binomial": true, "lognormal": true, "student_t": true, "weibull": true,
+	"truncated_normal": true, "categorical": true, "multinomial": true, "dirichlet": true,
+	"mvnormal": true, "logpdf_normal": true, "logpdf_uniform": true, "logpdf_exponential": true,
+	"logpdf_poisson": true, "logpdf_gamma": true, "logpdf_beta": true, "logpdf_binomial": true,
+	"logpdf_negative_binomial": true, "logpdf_lognormal": true, "logpdf_student_t": true,
+	"logpdf_weibull": true, "logpdf_truncated_normal": true, "logpdf_categorical": true,
+	"logpdf_multinomial": true, "logpdf_dirichlet": true, "logpdf_mvnormal": true,
+}
+
+// exprLogDensities are the elementwise log-densities, by name.
+var exprLogDensities = map[string]func(p []float64) float64{
+	"logpdf_normal": func(p []float64) float64 {
+		return distuv.Normal{Mu: p[1], Sigma: p[2]}.LogProb(p[0])
+	},
+	"logpdf_uniform": func(p []float64) float64 {
+		return distuv.Uniform{Min: p[1], Max: p[2]}.LogProb(p[0])
+	},
+	"logpdf_exponential": func(p []float64) float64 {
+		return distuv.Exponential{Rate: p[1]}.LogProb(p[0])
+	},
+	"logpdf_poisson": func(p []float64) float64 {
+		return distuv.Poisson{Lambda: p[1]}.LogProb(p[0])
+	},
+	"logpdf_gamma": func(p []float64) float64 {
+		return distuv.Gamma{Alpha: p[1], Beta: p[2]}.LogProb(p[0])
+	},
+	"logpdf_beta": func(p []float64) float64 {
+		return distuv.Beta{Alpha: p[1], Beta: p[2]}.LogProb(p[0])
+	},
+	"logpdf_binomial": func(p []float64) float64 {
+		return distuv.Binomial{N: p[1], P: p[2]}.LogProb(p[0])
+	},
+	"logpdf_negative_binomial": func(p []float64) float64 {
+		return negativeBinomialLogProb(p[0], p[1], p[2])
+	},
+	"logpdf_lognormal": func(p []float64) float64 {
+		return distuv.LogNormal{Mu: p[1], Sigma: p[2]}.LogProb(p[0])
+	},
+	"logpdf_student_t": func(p []float64) float64 {
+		return distuv.StudentsT{Nu: p[1], Mu: p[2], Sigma: p[3]}.LogProb(p[0])
+	},
+	"logpdf_weibull": func(p []float64) float64 {
+		return distuv.Weibull{K: p[1], Lambda: p[2]}.LogProb(p[0])
+	},
+	"logpdf_truncated_normal": func(p []float64) float64 {
+		return truncatedNormalLogProb(p[0], p[1], p[2], p[3], p[4])
+	},
+}
+
+// exprLogDensityPartials are the elementwise log-densities' derivatives with respect to the
+// value and then each parameter, written into d in argument order. A count has no derivative,
+// so a discrete log-mass's partial with respect to its value is 0.
+var exprLogDensityPartials = map[string]func(p []float64, d []float64){
+	"logpdf_normal": func(p []float64, d []float64) {
+		z := (p[0] - p[1]) / p[2]
+		d[0], d[1], d[2] = -z/p[2], z/p[2], (z*z-1)/p[2]
+	},
+	"logpdf_uniform": func(p []float64, d []float64) {
+		w := p[2] - p[1]
+		d[0], d[1], d[2] = 0, 1/w, -1/w
+	},
+	"logpdf_exponential": func(p []float64, d []float64) {
+		d[0], d[1] = -p[1], 1/p[1]-p[0]
+	},
+	"logpdf_poisson": func(p []float64, d []float64) {
+		d[0], d[1] = 0, p[0]/p[1]-1
+	},
+	"logpdf_gamma": func(p []float64, d []float64) {
+		x, alpha, beta := p[0], p[1], p[2]
+		d[0] = (alpha-1)/x - beta
+		d[1] = math.Log(beta) - mathext.Digamma(alpha) + math.Log(x)
+		d[2] = alpha/beta - x
+	},
+	"logpdf_beta": func(p []float64, d []float64) {
+		x, alpha, beta := p[0], p[1], p[2]
+		both := mathext.Digamma(alpha + beta)
+		d[0] = (alpha-1)/x - (beta-1)/(1-x)
+		d[1] = math.Log(x) - mathext.Digamma(alpha) + both
+		d[2] = math.Log1p(-x) - mathext.Digamma(beta) + both
+	},
+	"logpdf_binomial": func(p []float64, d []float64) {
+		x, n, q := p[0], p[1], p[2]
+		d[0] = 0
+		d[1] = mathext.Digamma(n+1) - mathext.Digamma(n-x+1) + math.Log1p(-q)
+		d[2] = x/q - (n-x)/(1-q)
+	},
+	"logpdf_negative_binomial": func(p []float64, d []float64) {
+		x, r, q := p[0], p[1], p[2]
+		d[0] = 0
+		d[1] = mathext.Digamma(r+x) - mathext.Digamma(r) + math.Log(q)
+		d[2] = r/q - x/(1-q)
+	},
+	"logpdf_lognormal": func(p []float64, d []float64) {
+		z := (math.Log(p[0]) - p[1]) / p[2]
+		d[0], d[1], d[2] = -(1+z/p[2])/p[0], z/p[2], (z*z-1)/p[2]
+	},
+	"logpdf_student_t": func(p []float64, d []float64) {
+		nu, sigma := p[1], p[3]
+		z := (p[0] - p[2]) / sigma
+		q := nu + z*z
+		d[0] = -(nu + 1) * z / (sigma * q)
+		d[1] = 0.5*(mathext.Digamma((nu+1)/2)-mathext.Digamma(nu/2)) - 0.5/nu -
+			0.5*math.Log1p(z*z/nu) + (nu+1)*z*z/(2*nu*q)
+		d[2] = -d[0]
+		d[3] = ((nu+1)*z*z/q - 1) / sigma
+	},
+	"logpdf_weibull": func(p []float64, d []float64) {
+		x, k, lambda := p[0], p[1], p[2]
+		u := x / lambda
+		uk := math.Pow(u, k)
+		d[0] = ((k - 1) - k*uk) / x
+		d[1] = 1/k + math.Log(u)*(1-uk)
+		d[2] = k * (uk - 1) / lambda
+	},
+	"logpdf_truncated_normal": func(p []float64, d []float64) {
+		mu, sigma := p[1], p[2]
+		z, a, b := (p[0]-mu)/sigma, (p[3]-mu)/sigma, (p[4]-mu)/sigma
+		scale := sigma * normalMass(a, b)
+		d[0], d[1], d[2] = -z/sigma, z/sigma, (z*z-1)/sigma
+		d[1] += (unitNormalDensity(b) - unitNormalDensity(a)) / scale
+		d[2] += (unitNormalMoment(b) - unitNormalMoment(a)) / scale
+		d[3] = unitNormalDensity(a) / scale
+		d[4] = -unitNormalDensity(b) / scale
+	},
+}
+
+// unitNormalDensity is the standard normal density, which is 0 at an infinite bound.
+func unitNormalDensity(z float64) float64 {
+	if math.IsInf(z, 0) {
+		return 0
+	}
+	return math.Exp(-0.5*z*z) / math.Sqrt(2*math.Pi)
+}
+
+// unitNormalMoment is z times the standard normal density, also 0 at an infinite bound.
+func unitNormalMoment(z float64) float64 {
+	if math.IsInf(z, 0) {
+		return 0
+	}
+	return z * unitNormalDensity(z)
+}
+
+// negativeBinomialLogProb is the log-mass of x failures before the r-th success, in the form
+// the inference package's negative binomial likelihood evaluates.
+func negativeBinomialLogProb(x, r, p float64) float64 {
+	if x < 0 || x != math.Floor(x) {
+		return math.Inf(-1)
+	}
+	a, _ := math.Lgamma(r + x)
+	b, _ := math.Lgamma(x + 1)
+	c, _ := math.Lgamma(r)
+	return a - b - c + r*math.Log(p) + x*math.Log1p(-p)
+}
+
+// normalMass is the probability a standard normal falls in [a, b], computed in whichever
+// tail keeps it accurate.
+func normalMass(a, b float64) float64 {
+	if a > 0 {
+		return distuv.UnitNormal.CDF(-a) - distuv.UnitNormal.CDF(-b)
+	}
+	return distuv.UnitNormal.CDF(b) - distuv.UnitNormal.CDF(a)
+}
+
+func truncatedNormalLogProb(x, mu, sigma, lo, hi float64) float64 {
+	if x < lo || x > hi {
+		return math.Inf(-1)
+	}
+	mass := normalMass((lo-mu)/sigma, (hi-mu)/sigma)
+	return distuv.Normal{Mu: mu, Sigma: sigma}.LogProb(x) - math.Log(mass)
+}
+
+// truncatedNormal draws by inverting the CDF at one uniform. An interval above the mean is
+// reflected below it first, where the CDF's small values are still precise.
+func truncatedNormal(u, mu, sigma, lo, hi float64) float64 {
+	if !(lo < hi) {
+		panic(fmt.Sprintf("expression: truncated_normal needs lo < hi, got [%v, %v]", lo, hi))
+	}
+	a, b, sign := (lo-mu)/sigma, (hi-mu)/sigma, 1.0
+	if a > 0 {
+		a, b, sign = -b, -a, -1
+	}
+	pa, pb := distuv.UnitNormal.CDF(a), distuv.UnitNormal.CDF(b)
+	if !(pb > pa) {
+		panic(fmt.Sprintf("expression: truncated_normal: [%v, %v] is too far into the tail of "+
+			"normal(%v, %v) to sample", lo, hi, mu, sigma))
+	}
+	z := math.Min(math.Max(distuv.UnitNormal.Quantile(pa+u*(pb-pa)), a), b)
+	return mu + sign*sigma*z
+}
+
+// weights checks a categorical or multinomial weight vector and returns its total.
+func weights(name string, w exprValue) float64 {
+	total := 0.0
+	for _, v := range w {
+		if !(v >= 0) {
+			panic(fmt.Sprintf("expression: %s needs non-negative weights, got %v", name, v))
+		}
+		total += v
+	}
+	if !(total > 0) || math.IsInf(total, 1) {
+		panic(fmt.Sprintf("expression: %s needs weights with a positive, finite total", name))
+	}
+	return total
+}
+
+// exprCovariance factorises a row-major covariance, reusing its storage from step to step.
+type exprCovariance struct {
+	chol mat.Cholesky
+	sym  mat.SymDense
+}
+
+func (f *exprCovariance) factorize(name string, cov exprValue, size int) {
+	if len(cov) != size*size {
+		panic(fmt.Sprintf("expression: %s: a width-%d mean needs a width-%d covariance, got "+
+			"width %d", name, size, size*size, len(cov)))
+	}
+	factorizeSymmetric(name, "covariance", &f.chol, &f.sym, cov, size)
+}
+
+// distribution compiles a call to one of exprDistributions, whose arguments are already
+// compiled.
+func (c *exprCompiler) distribution(name string, args []exprCode) exprCode {
+	p := c.program
+	if logProb, ok := exprLogDensities[name]; ok {
+		return c.elementwise(name, args, false, logProb)
+	}
+	explicit := c.explicit
+	var buffer exprValue
+	switch name {
+	case "negative_binomial":
+		return c.elementwise(name, args, true, func(q []float64) float64 {
+			if !(q[1] > 0 && q[1] <= 1) {
+				panic(fmt.Sprintf("expression: negative_binomial needs 0 < p <= 1, got %v", q[1]))
+			}
+			return p.sampler.Poisson(p.sampler.Gamma(q[0], q[1]/(1-q[1])))
+		})
+	case "lognormal":
+		return c.elementwise(name, args, true, func(q []float64) float64 {
+			return math.Exp(p.sampler.Normal(q[0], q[1]))
+		})
+	case "student_t":
+		return c.elementwise(name, args, true, func(q []float64) float64 {
+			return distuv.StudentsT{Nu: q[0], Mu: q[1], Sigma: q[2], Src: p.sampler.Rand()}.Rand()
+		})
+	case "weibull":
+		return c.elementwise(name, args, true, func(q []float64) float64 {
+			return distuv.Weibull{K: q[0], Lambda: q[1], Src: p.sampler.Rand()}.Rand()
+		})
+	case "truncated_normal":
+		return c.elementwise(name, args, true, func(q []float64) float64 {
+			return truncatedNormal(p.sampler.Float64(), q[0], q[1], q[2], q[3])
+		})
+	case "categorical":
+		w := args[0]
+		return func() exprValue {
+			if !explicit {
+				panic("expression: categorical gives one index, so its width is ambiguous; " +
+					"write iid(n, categorical(...)) for n independent indices, or " +
+					"shared(categorical(...)) for one index reused across the field")
+			}
+			weight := w()
+			u := p.sampler.Float64() * weights(name, weight)
+			out := take(&buffer, 1)
+			// The last positive weight catches a u that rounding leaves past the running total.
+			for i, v := range weight {
+				if v > 0 {
+					out[0] = float64(i)
+				}
+				if u < v {
+					break
+				}
+				u -= v
+			}
+			return out
+		}
+	case "multinomial":
+		count, w := args[0], args[1]
+		return func() exprValue {
+			trials := toIndex(scalarArg(count, "multinomial's count must be a scalar"),
+				"multinomial's count")
+			if trials < 0 {
+				panic("expression: multinomial's count must not be negative")
+			}
+			weight := w()
+			checkDrawWidth(name, len(weight), explicit)
+			rest := weights(name, weight)
+			out := take(&buffer, len(weight))
+			// Each category takes a binomial share of the trials left, given the weight left;
+			// once every trial is allocated the rest draw nothing.
+			remaining := float64(trials)
+			for i, v := range weight {
+				share := 0.0
+				switch {
+				case remaining == 0 || v == 0:
+				case i == len(weight)-1 || v >= rest:
+					share = remaining
+				default:
+					share = distuv.Binomial{N: remaining, P: v / rest, Src: p.sampler.Rand()}.Rand()
+				}
+				out[i] = share
+				remaining -= share
+				rest -= v
+			}
+			return out
+		}
+	case "dirichlet":
+		alpha := args[0]
+		return func() exprValue {
+			a := alpha()
+			checkDrawWidth(name, len(a), explicit)
+			out := take(&buffer, len(a))
+			total := 0.0
+			for i, v := range a {
+				if !(v > 0) {
+					panic(fmt.Sprintf("expression: dirichlet needs positive concentrations, got %v", v))
+				}
+				out[i] = p.sampler.Gamma(v, 1)
+				total += out[i]
+			}
+			for i := range out {
+				out[i] /= total
+			}
+			return out
+		}
+	case "mvnormal":
+		mean, covariance := args[0], args[1]
+		var factor exprCovariance
+		var z exprValue
+		return func() exprValue {
+			mu, cov := mean(), covariance()
+			size := len(mu)
+			checkDrawWidth(name, size, explicit)
+			factor.factorize(name, cov, size)
+			z = take(&z, size)
+			for i := range z {
+				z[i] = p.sampler.NormFloat64()
+			}
+			// x = mu + L z, with L the transpose of gonum's upper factor.
+			u := factor.chol.RawU()
+			out := take(&buffer, size)
+			for i := range out {
+				out[i] = mu[i]
+				for j := 0; j <= i; j++ {
+					out[i] += u.At(j, i) * z[j]
+				}
+			}
+			return out
+		}
+	case "logpdf_categorical":
+		x, w := args[0], args[1]
+		return func() exprValue {
+			index, weight := x(), w()
+			logTotal := math.Log(weights(name, weight))
+			out := take(&buffer, len(index))
+			for i, v := range index {
+				out[i] = math.Inf(-1)
+				if k := int(v); v >= 0 && v == math.Floor(v) && k < len(weight) {
+					out[i] = math.Log(weight[k]) - logTotal
+				}
+			}
+			return out
+		}
+	case "logpdf_multinomial":
+		x, w := args[0], args[1]
+		return func() exprValue {
+			counts, weight := x(), w()
+			sameWidth(name, "counts", "weights", len(counts), len(weight))
+			logTotal := math.Log(weights(name, weight))
+			trials := 0.0
+			logProb := 0.0
+			for i, v := range counts {
+				if v < 0 || v != math.Floor(v) {
+					logProb = math.Inf(-1)
+					break
+				}
+				trials += v
+				lg, _ := math.Lgamma(v + 1)
+				logProb -= lg
+				if v > 0 {
+					logProb += v * (math.Log(weight[i]) - logTotal)
+				}
+			}
+			lg, _ := math.Lgamma(trials + 1)
+			out := take(&buffer, 1)
+			out[0] = logProb + lg
+			return out
+		}
+	case "logpdf_dirichlet":
+		x, concentration := args[0], args[1]
+		return func() exprValue {
+			v, alpha := x(), concentration()
+			sameWidth(name, "value", "concentrations", len(v), len(alpha))
+			total := 0.0
+			logProb := 0.0
+			for i, a := range alpha {
+				total += a
+				lg, _ := math.Lgamma(a)
+				logProb += (a-1)*math.Log(v[i]) - lg
+			}
+			lg, _ := math.Lgamma(total)
+			out := take(&buffer, 1)
+			out[0] = logProb + lg
+			return out
+		}
+	case "logpdf_mvnormal":
+		x, mean, covariance := args[0], args[1], args[2]
+		var factor exprCovariance
+		var d, y exprValue
+		var dv, yv mat.VecDense
+		return func() exprValue {
+			v, mu, cov := x(), mean(), covariance()
+			size := broadcastLen(v, mu, name)
+			factor.factorize(name, cov, size)
+			d, y = take(&d, size), take(&y, size)
+			for i := range d {
+				d[i] = at(v, i) - at(mu, i)
+			}
+			dv.SetRawVector(blas64.Vector{N: size, Inc: 1, Data: d})
+			yv.SetRawVector(blas64.Vector{N: size, Inc: 1, Data: y})
+			singular(name, factor.chol.SolveVecTo(&yv, &dv))
+			out := take(&buffer, 1)
+			out[0] = -0.5 * (float64(size)*math.Log(2*math.Pi) + factor.chol.LogDet() +
+				mat.Dot(&dv, &yv))
+			return out
+		}
+	}
+	return fail("expression: unknown function " + name)
+}
+
+// sameWidth panics unless two values a function pairs element for element are equally wide.
+func sameWidth(name, a, b string, x, y int) {
+	if x != y {
+		panic(fmt.Sprintf("expression: %s: the %s have width %d but the %s width %d",
+			name, a, x, b, y))
+	}
+}
+
+// elementwise applies f to each element of the broadcast arguments, handing it one element
+// of each in argument order. A draw also follows the width rule.
+func (c *exprCompiler) elementwise(
+	name string,
+	args []exprCode,
+	draw bool,
+	f func(p []float64) float64,
+) exprCode {
+	explicit := c.explicit
+	values := make([]exprValue, len(args))
+	params := make([]float64, len(args))
+	var buffer exprValue
+	return func() exprValue {
+		width := 1
+		for i, arg := range args {
+			values[i] = arg()
+			width = broadcastWidth(width, len(values[i]), name)
+		}
+		if draw {
+			checkDrawWidth(name, width, explicit)
+		}
+		out := take(&buffer, width)
+		for j := range out {
+			for i, v := range values {
+				params[i] = at(v, j)
+			}
+			out[j] = f(params)
+		}
+		return out
+	}
+}
+
+// distribution checks a call to one of exprDistributions, given its arguments' shapes.
+func (c *exprChecker) distribution(name string, n *ast.CallExpr, args []exprShape) exprShape {
+	width := func() int {
+		w := 1
+		for _, a := range args {
+			w = c.broadcast(n.Pos(), name, w, a.width)
+		}
+		return w
+	}
+	// pair reports two arguments a function pairs element for element that differ in width.
+	pair := func(a, b string) {
+		if x, y := args[0].width, args[1].width; x >= 0 && y >= 0 && x != y {
+			c.report(n.Pos(), "%s: the %s have width %d but the %s width %d", name, a, x, b, y)
+		}
+	}
+	// covariance reports a covariance that is not size^2 wide.
+	covariance := func(size int) {
+		if cov := args[len(args)-1].width; size >= 0 && cov >= 0 && cov != size*size {
+			c.report(n.Args[len(args)-1].Pos(), "%s: a width-%d mean needs a width-%d "+
+				"covariance, got width %d", name, size, size*size, cov)
+		}
+	}
+	if _, ok := exprLogDensities[name]; ok {
+		return widthShape(width())
+	}
+	switch name {
+	case "negative_binomial", "lognormal", "student_t", "weibull", "truncated_normal":
+		return c.draw(n, width())
+	case "categorical":
+		if !c.explicit {
+			c.report(n.Pos(), "categorical gives one index, so its width is ambiguous; write "+
+				"iid(n, categorical(...)) for n independent indices, or "+
+				"shared(categorical(...)) for one index reused across the field")
+		}
+		return widthShape(1)
+	case "multinomial":
+		c.scalar(n.Args[0], args[0], "multinomial's count must be a scalar")
+		return c.draw(n, args[1].width)
+	case "dirichlet":
+		return c.draw(n, args[0].width)
+	case "mvnormal":
+		covariance(args[0].width)
+		return c.draw(n, args[0].width)
+	case "logpdf_categorical":
+		return widthShape(args[0].width)
+	case "logpdf_multinomial":
+		pair("counts", "weights")
+	case "logpdf_dirichlet":
+		pair("value", "concentrations")
+	case "logpdf_mvnormal":
+		covariance(c.broadcast(n.Pos(), name, args[0].width, args[1].width))
+	}
+	return widthShape(1)
+}
@@ -0,0 +1,311 @@
+package general
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/rng"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat/distmv"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// sampleMean draws n samples of a scalar draw through iid and returns their mean and them.
+func sampleMean(t *testing.T, draw string, n int) (float64, []float64) {
+	t.Helper()
+	e := &ExpressionIteration{
+		Fields:  []ExpressionField{{Name: "x", Width: n}},
+		Outputs: []string{"iid(" + strconv.Itoa(n) + ", " + draw + ")"},
+	}
+	values := evalOnce(t, e, make([]float64, n), nil)
+	mean := 0.0
+	for _, v := range values {
+		mean += v / float64(n)
+	}
+	return mean, values
+}
+
+func TestExpressionDrawCatalogueMoments(t *testing.T) {
+	const n = 40000
+	for _, c := range []struct {
+		draw       string
+		mean, sd   float64
+		lo, hi     float64
+		meanWithin float64
+	}{
+		{"negative_binomial(3, 0.4)", 4.5, math.Sqrt(3 * 0.6 / 0.16), 0, math.Inf(1), 0},
+		{"lognormal(0, 0.5)", math.Exp(0.125),
+			math.Sqrt((math.Exp(0.25) - 1) * math.Exp(0.25)), 0, math.Inf(1), 0},
+		{"student_t(5, 1, 2)", 1, 2 * math.Sqrt(5.0/3), math.Inf(-1), math.Inf(1), 0},
+		{"weibull(2, 3)", 3 * math.Gamma(1.5),
+			3 * math.Sqrt(math.Gamma(2)-math.Gamma(1.5)*math.Gamma(1.5)), 0, math.Inf(1), 0},
+		{"truncated_normal(0, 1, 1, 3)",
+			(distuv.UnitNormal.Prob(1) - distuv.UnitNormal.Prob(3)) /
+				(distuv.UnitNormal.CDF(3) - distuv.UnitNormal.CDF(1)), 0.5, 1, 3, 0},
+		{"truncated_normal(10, 2, -5, 4)", 0, 0, -5, 4, math.Inf(1)},
+	} {
+		t.Run(c.draw, func(t *testing.T) {
+			mean, values := sampleMean(t, c.draw, n)
+			for _, v := range values {
+				if v < c.lo || v > c.hi {
+					t.Fatalf("%v is outside [%v, %v]", v, c.lo, c.hi)
+				}
+			}
+			within := c.meanWithin
+			if within == 0 {
+				within = 5 * c.sd / math.Sqrt(n)
+			}
+			if math.Abs(mean-c.mean) > within {
+				t.Errorf("mean %v, want %v within %v", mean, c.mean, within)
+			}
+		})
+	}
+}
+
+func TestExpressionCategoricalDraw(t *testing.T) {
+	e := &ExpressionIteration{
+		Fields:  []ExpressionField{{Name: "x", Width: 20000}},
+		Outputs: []string{"iid(20000, categorical(weights))"},
+	}
+	values := evalOnce(t, e, make([]float64, 20000),
+		map[string][]float64{"weights": {1, 0, 3}})
+	counts := make([]float64, 3)
+	for _, v := range values {
+		counts[int(v)]++
+	}
+	if counts[1] != 0 || math.Abs(counts[2]/20000-0.75) > 0.02 {
+		t.Errorf("got counts %v for weights [1, 0, 3]", counts)
+	}
+}
+
+func TestExpressionTruncatedNormalTakesOneUniformEach(t *testing.T) {
+	e := &ExpressionIteration{
+		Fields:  []ExpressionField{{Name: "x", Width: 3}},
+		Outputs: []string{"iid(3, truncated_normal(0, 1, -1, 1))"},
+	}
+	got := evalOnce(t, e, make([]float64, 3), nil)
+	sampler := rng.New(1)
+	for i := range got {
+		if want := truncatedNormal(sampler.Float64(), 0, 1, -1, 1); got[i] != want {
+			t.Fatalf("got %v, want element %d to be %v", got, i, want)
+		}
+	}
+}
+
+// iterateMany configures e once and runs it steps times over state, returning every output.
+func iterateMany(
+	e *ExpressionIteration,
+	state []float64,
+	params map[string][]float64,
+	steps int,
+) [][]float64 {
+	settings := &simulator.Settings{
+		Iterations: []simulator.IterationSettings{{Name: "p", Seed: 1}},
+	}
+	e.Configure(0, settings)
+	p := simulator.NewParams(params)
+	histories := []*simulator.StateHistory{{
+		Values:            mat.NewDense(1, len(state), state),
+		StateWidth:        len(state),
+		StateHistoryDepth: 1,
+	}}
+	ts := &simulator.CumulativeTimestepsHistory{
+		Values:        mat.NewVecDense(1, []float64{0}),
+		NextIncrement: 1,
+	}
+	outputs := make([][]float64, steps)
+	for i := range outputs {
+		outputs[i] = append([]float64(nil), e.Iterate(&p, 0, histories, ts)...)
+	}
+	return outputs
+}
+
+func TestExpressionVectorDraws(t *testing.T) {
+	t.Run("multinomial allocates every trial", func(t *testing.T) {
+		e := &ExpressionIteration{
+			Fields:  []ExpressionField{{Name: "x", Width: 3}},
+			Outputs: []string{"multinomial(12, weights)"},
+		}
+		totals := make([]float64, 3)
+		for _, draw := range iterateMany(e, make([]float64, 3),
+			map[string][]float64{"weights": {2, 0, 6}}, 2000) {
+			if draw[0]+draw[1]+draw[2] != 12 || draw[1] != 0 {
+				t.Fatalf("got %v", draw)
+			}
+			for i, v := range draw {
+				totals[i] += v / 2000
+			}
+		}
+		if math.Abs(totals[0]-3) > 0.15 {
+			t.Errorf("mean allocation %v, want [3 0 9]", totals)
+		}
+	})
+	t.Run("dirichlet lands on the simplex", func(t *testing.T) {
+		e := &ExpressionIteration{
+			Fields:  []ExpressionField{{Name: "x", Width: 3}},
+			Outputs: []string{"dirichlet(alpha)"},
+		}
+		means := make([]float64, 3)
+		for _, draw := range iterateMany(e, make([]float64, 3),
+			map[string][]float64{"alpha": {1, 2, 5}}, 4000) {
+			if math.Abs(draw[0]+draw[1]+draw[2]-1) > 1e-12 {
+				t.Fatalf("got %v", draw)
+			}
+			for i, v := range draw {
+				means[i] += v / 4000
+			}
+		}
+		if math.Abs(means[2]-5.0/8) > 0.01 {
+			t.Errorf("mean %v, want [1/8 2/8 5/8]", means)
+		}
+	})
+	t.Run("mvnormal has the covariance it is given", func(t *testing.T) {
+		e := &ExpressionIteration{
+			Fields:  []ExpressionField{{Name: "x", Width: 2}},
+			Outputs: []string{"mvnormal(mu, cov)"},
+		}
+		const steps = 20000
+		var mean [2]float64
+		var cov [2][2]float64
+		draws := iterateMany(e, make([]float64, 2),
+			map[string][]float64{"mu": {1, -1}, "cov": {2, 0.8, 0.8, 1}}, steps)
+		for _, draw := range draws {
+			mean[0] += draw[0] / steps
+			mean[1] += draw[1] / steps
+		}
+		for _, draw := range draws {
+			for i := 0; i < 2; i++ {
+				for j := 0; j < 2; j++ {
+					cov[i][j] += (draw[i] - mean[i]) * (draw[j] - mean[j]) / steps
+				}
+			}
+		}
+		if math.Abs(mean[0]-1) > 0.05 || math.Abs(mean[1]+1) > 0.05 ||
+			math.Abs(cov[0][0]-2) > 0.1 || math.Abs(cov[0][1]-0.8) > 0.05 ||
+			math.Abs(cov[1][1]-1) > 0.05 {
+			t.Errorf("got mean %v and covariance %v", mean, cov)
+		}
+	})
+}
+
+func TestExpressionLogDensities(t *testing.T) {
+	params := map[string][]float64{
+		"x":      {0.3, 1.7},
+		"counts": {1, 2},
+		"mu":     {0.5, -0.5},
+		"cov":    {2, 0.3, 0.3, 1},
+		"w":      {1, 3},
+		"alpha":  {2, 5},
+		"simp":   {0.3, 0.7},
+	}
+	normal, _ := distmv.NewNormal(params["mu"], mat.NewSymDense(2, params["cov"]), nil)
+	dirichlet := distmv.NewDirichlet(params["alpha"], nil)
+	nb := func(x, r, p float64) float64 {
+		coefficient := math.Gamma(r+x) / (math.Gamma(x+1) * math.Gamma(r))
+		return math.Log(coefficient * math.Pow(p, r) * math.Pow(1-p, x))
+	}
+	for _, c := range []struct {
+		expr string
+		want []float64
+	}{
+		{"logpdf_normal(x, 1, 2)", []float64{
+			distuv.Normal{Mu: 1, Sigma: 2}.LogProb(0.3), distuv.Normal{Mu: 1, Sigma: 2}.LogProb(1.7)}},
+		{"logpdf_gamma(x, 2, 3)", []float64{
+			distuv.Gamma{Alpha: 2, Beta: 3}.LogProb(0.3), distuv.Gamma{Alpha: 2, Beta: 3}.LogProb(1.7)}},
+		{"logpdf_poisson(counts, 1.5)", []float64{
+			math.Log(1.5 * math.Exp(-1.5)), math.Log(1.5 * 1.5 / 2 * math.Exp(-1.5))}},
+		{"logpdf_negative_binomial(counts, 3, 0.4)", []float64{nb(1, 3, 0.4), nb(2, 3, 0.4)}},
+		{"logpdf_negative_binomial(0.5, 3, 0.4)", []float64{math.Inf(-1)}},
+		{"logpdf_lognormal(x, 0, 1)", []float64{
+			distuv.LogNormal{Mu: 0, Sigma: 1}.LogProb(0.3), distuv.LogNormal{Mu: 0, Sigma: 1}.LogProb(1.7)}},
+		{"logpdf_student_t(x, 4, 0, 1)", []float64{
+			distuv.StudentsT{Nu: 4, Mu: 0, Sigma: 1}.LogProb(0.3),
+			distuv.StudentsT{Nu: 4, Mu: 0, Sigma: 1}.LogProb(1.7)}},
+		{"logpdf_weibull(x, 2, 1)", []float64{
+			distuv.Weibull{K: 2, Lambda: 1}.LogProb(0.3), distuv.Weibull{K: 2, Lambda: 1}.LogProb(1.7)}},
+		{"logpdf_truncated_normal(x, 0, 1, 0, 1)", []float64{
+			distuv.UnitNormal.LogProb(0.3) - math.Log(distuv.UnitNormal.CDF(1)-0.5), math.Inf(-1)}},
+		{"logpdf_categorical(counts - 1, w)", []float64{math.Log(0.25), math.Log(0.75)}},
+		{"logpdf_multinomial(counts, w)", []float64{math.Log(3 * 0.25 * 0.75 * 0.75)}},
+		{"logpdf_dirichlet(simp, alpha)", []float64{dirichlet.LogProb(params["simp"])}},
+		{"logpdf_mvnormal(x, mu, cov)", []float64{normal.LogProb(params["x"])}},
+	} {
+		t.Run(c.expr, func(t *testing.T) {
+			e := &ExpressionIteration{
+				Fields:  []ExpressionField{{Name: "y", Width: len(c.want)}},
+				Outputs: []string{c.expr},
+			}
+			got := evalOnce(t, e, make([]float64, len(c.want)), params)
+			for i, want := range c.want {
+				if !(got[i] == want || math.Abs(got[i]-want) < 1e-12*math.Max(1, math.Abs(want))) {
+					t.Fatalf("got %v, want %v", got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestExpressionDistributionErrors(t *testing.T) {
+	params := map[string][]float64{"w": {1, 3}, "mu": {0, 0}, "cov": {1, 2, 3}}
+	for _, c := range []struct {
+		output string
+		want   string
+	}{
+		{"lognormal(0, 1)", "lognormal has only scalar parameters, so its width is ambiguous"},
+		{"categorical(w)", "categorical gives one index, so its width is ambiguous"},
+		{"dirichlet(1)", "dirichlet has only scalar parameters"},
+		{"slice(mvnormal(mu, cov), 0, 1)", "mvnormal: a width-2 mean needs a width-4 covariance"},
+		{"shared(categorical(w - 2))", "categorical needs non-negative weights, got -1"},
+		{"shared(truncated_normal(0, 1, 1, 1))", "truncated_normal needs lo < hi"},
+		{"shared(negative_binomial(2, 0))", "negative_binomial needs 0 < p <= 1"},
+	} {
+		t.Run(c.output, func(t *testing.T) {
+			defer func() {
+				if got := stringifyPanic(recover()); !strings.Contains(got, c.want) {
+					t.Errorf("got %q, want it to contain %q", got, c.want)
+				}
+			}()
+			e := &ExpressionIteration{Fields: []ExpressionField{{Name: "x"}}, Outputs: []string{c.output}}
+			evalOnce(t, e, []float64{0}, params)
+		})
+	}
+}
+
+func TestExpressionCheckKnowsDistributions(t *testing.T) {
+	shapes := ExpressionShapes{StateWidth: 2, Params: map[string]int{"w": 3, "mu": 2, "cov": 3}}
+	check := func(output string) []ExpressionIssue {
+		e := &ExpressionIteration{Fields: []ExpressionField{{Name: "x", Width: 2}},
+			Outputs: []string{output}}
+		return e.Check(shapes)
+	}
+	for _, c := range []struct {
+		output string
+		want   string
+	}{
+		{"fill(2, categorical(w))", "categorical gives one index"},
+		{"student_t(3, 0, 1) + x", "student_t has only scalar parameters"},
+		{"mvnormal(mu, cov)", "mvnormal: a width-2 mean needs a width-4 covariance, got width 3"},
+		{"fill(2, logpdf_multinomial(x, w))", "the counts have width 2 but the weights width 3"},
+		{"multinomial(12, w)", "produces width 3, want 2 or 1"},
+		{"logpdf_normal(w, 0, 1)", "produces width 3, want 2 or 1"},
+	} {
+		issues := check(c.output)
+		if len(issues) != 1 || !strings.Contains(issues[0].Message, c.want) {
+			t.Errorf("%s: got %v, want one issue containing %q", c.output, issues, c.want)
+		}
+	}
+	for _, output := range []string{
+		"iid(2, categorical(w))",
+		"fill(2, sum(logpdf_poisson(w, 2)))",
+		"lognormal(x, 1)",
+		"slice(multinomial(4, w), 0, 2)",
+		"fill(2, logpdf_mvnormal(x, mu, fill(4, 0) + concat(1, 0, 0, 1)))",
+	} {
+		if issues := check(output); len(issues) != 0 {
+			t.Errorf("%s: unexpected issues %v", output, issues)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package general
 
 import (
+	"go/ast"
 	"go/parser"
 	"strings"
 	"testing"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/umbralcalc/stochadex/pkg/rng"
 	"github.com/umbralcalc/stochadex/pkg/simulator"
+	"github.com/umbralcalc/stochadex/pkg/spatial"
 )
 
 // The evaluator's surface: every operator, every function, and every way of getting it wrong.
@@ -462,6 +464,62 @@ func TestExpressionOutputWidthMustFitItsField(t *testing.T) {
 	})
 }
 
+func TestExpressionSpatialOperators(t *testing.T) {
+	line := &spatial.TopologySpec{Edges: [][]float64{{0, 1}, {1, 2, 2}}}
+	t.Run("neighbours_sum and laplacian act over the topology", func(t *testing.T) {
+		got := evalOnce(t, &ExpressionIteration{
+			Fields:   []ExpressionField{{Name: "x", Width: 3}, {Name: "lx", Width: 3}},
+			Outputs:  []string{"neighbours_sum(x)", "laplacian(x)"},
+			Topology: line,
+		}, []float64{1, 10, 100, 0, 0, 0}, map[string][]float64{})
+		want := []float64{10, 201, 20, 9, 171, -180}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		}
+	})
+	t.Run("a scalar broadcasts to every node", func(t *testing.T) {
+		got := evalOnce(t, &ExpressionIteration{
+			Fields:   []ExpressionField{{Name: "degree", Width: 3}},
+			Outputs:  []string{"neighbours_sum(1)"},
+			Topology: line,
+		}, []float64{0, 0, 0}, map[string][]float64{})
+		if got[0] != 1 || got[1] != 3 || got[2] != 2 {
+			t.Errorf("got weighted degrees %v, want [1 3 2]", got)
+		}
+	})
+	for name, c := range map[string]struct {
+		e    *ExpressionIteration
+		want string
+	}{
+		"without a topology": {&ExpressionIteration{
+			Fields:  []ExpressionField{{Name: "x", Width: 3}},
+			Outputs: []string{"laplacian(x)"},
+		}, "needs a topology"},
+		"at the wrong width": {&ExpressionIteration{
+			Fields:   []ExpressionField{{Name: "x", Width: 3}},
+			Outputs:  []string{"neighbours_sum(slice(x, 0, 2))"},
+			Topology: line,
+		}, "one value per node"},
+		"with a malformed topology": {&ExpressionIteration{
+			Fields:   []ExpressionField{{Name: "x", Width: 3}},
+			Outputs:  []string{"x"},
+			Topology: &spatial.TopologySpec{},
+		}, "topology"},
+	} {
+		t.Run("is rejected "+name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r == nil || !strings.Contains(stringifyPanic(r), c.want) {
+					t.Errorf("want a panic mentioning %q, got %v", c.want, r)
+				}
+			}()
+			evalOnce(t, c.e, []float64{1, 2, 3}, map[string][]float64{})
+		})
+	}
+}
+
 func TestExpressionLagReadsAnUpstream(t *testing.T) {
 	// The own-field path is covered elsewhere; this is the alias path, which is what
 	// trywizard's match_state actually uses.
@@ -501,11 +559,11 @@ func TestExpressionLagReadsAnUpstream(t *testing.T) {
 }
 
 func TestExpressionLagWithoutHistoriesSaysSo(t *testing.T) {
-	// Iterate always supplies the resolver, so this guard is unreachable through the public
+	// Configure always supplies the resolver, so this guard is unreachable through the public
 	// surface and is tested directly rather than left as an untested assertion. It exists so
 	// that a future evaluation path which forgets to wire it fails by saying what is missing,
 	// instead of dereferencing a nil func.
-	t.Run("a context with no history resolver reports it", func(t *testing.T) {
+	t.Run("a program with no history resolver reports it", func(t *testing.T) {
 		defer func() {
 			r := recover()
 			if r == nil {
@@ -519,8 +577,9 @@ func TestExpressionLagWithoutHistoriesSaysSo(t *testing.T) {
 		if err != nil {
 			t.Fatalf("parsing: %v", err)
 		}
-		ctx := &exprCtx{env: exprEnv{"x": exprValue{1}}, sampler: rng.New(1)}
-		ctx.eval(parsed)
+		program := compileExprProgram(nil, []ast.Expr{parsed}, nil, nil)
+		program.sampler = rng.New(1)
+		program.outputs[0]()
 	})
 }
 
@@ -0,0 +1,128 @@
+package general
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"math"
+
+	"github.com/umbralcalc/stochadex/pkg/rng"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// ExpressionEvaluator is the expression language outside an ExpressionIteration: one
+// expression, after optional bindings and with optional functions, evaluated over names its
+// caller sets. It is what lets a component that is handed values rather than a partition's
+// state — a likelihood scoring data, a kernel weighting a past state, a prior — be written as
+// an expression rather than in Go.
+//
+// A name is whatever Set last gave it, else the param of that name from SetParams, else pi;
+// there are no fields, upstreams or clock unless the caller sets them. Like an iteration's
+// program it is compiled once and allocates nothing per evaluation once its buffers are sized.
+type ExpressionEvaluator struct {
+	program *exprProgram
+	globals map[string]int
+	set     []exprValue
+	params  []exprValue
+	scalar  bool
+}
+
+// NewExpressionEvaluator compiles expr after bindings, with functions callable from both. When
+// scalar is true the value must be a single number, such as a kernel's weight or a prior's
+// sample, and so a scalar-parameter draw is unambiguous and needs no iid or shared. It returns
+// an error for anything that cannot be parsed or a malformed function; other errors surface
+// when the node that has them runs, as in an iteration.
+func NewExpressionEvaluator(
+	expr string,
+	bindings []ExpressionBinding,
+	functions []ExpressionFunction,
+	scalar bool,
+) (*ExpressionEvaluator, error) {
+	parsedBindings := make([]parsedExprBinding, 0, len(bindings))
+	for _, b := range bindings {
+		parsed, err := parser.ParseExpr(b.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing binding %s: %w", b.Name, err)
+		}
+		parsedBindings = append(parsedBindings, parsedExprBinding{b.Name, parsed})
+	}
+	parsed, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %q: %w", expr, err)
+	}
+	parsedFunctions, issues := parseExprFunctions(functions)
+	if len(issues) > 0 {
+		return nil, fmt.Errorf("%s: %s", issues[0].Where, issues[0].Message)
+	}
+	c := newExprCompiler(parsedFunctions, nil)
+	c.explicit = scalar
+	v := &ExpressionEvaluator{
+		program: c.compileProgram(parsedBindings, []ast.Expr{parsed}),
+		globals: make(map[string]int),
+		scalar:  scalar,
+	}
+	for i := range v.program.globals {
+		g := &v.program.globals[i]
+		v.globals[g.name] = i
+		if g.name == "pi" {
+			g.fixed = exprValue{math.Pi}
+		}
+	}
+	v.set = make([]exprValue, len(v.program.globals))
+	v.params = make([]exprValue, len(v.program.globals))
+	v.program.sampler = rng.New(0)
+	return v, nil
+}
+
+// Set gives name the value value until it is next set. A nil value unsets it. The evaluator
+// reads value without copying it, so it must not change while an evaluation is running.
+func (v *ExpressionEvaluator) Set(name string, value []float64) {
+	if i, ok := v.globals[name]; ok {
+		v.set[i] = value
+	}
+}
+
+// SetParams makes params' entries readable by name, beneath anything Set has given a value.
+func (v *ExpressionEvaluator) SetParams(params *simulator.Params) {
+	for i, g := range v.program.globals {
+		values, ok := params.Map[g.name]
+		switch {
+		case !ok:
+			v.params[i] = nil
+		case values == nil:
+			v.params[i] = exprValue{}
+		default:
+			v.params[i] = values
+		}
+	}
+}
+
+// SetSampler makes the expression's draws come from sampler, which it otherwise seeds with 0.
+func (v *ExpressionEvaluator) SetSampler(sampler *rng.Sampler) {
+	v.program.sampler = sampler
+}
+
+// Evaluate runs the bindings and then the expression, returning its value. The value is a
+// buffer the evaluator reuses, valid until the next Evaluate.
+func (v *ExpressionEvaluator) Evaluate() []float64 {
+	p := v.program
+	for i, g := range p.globals {
+		value := v.set[i]
+		if value == nil {
+			value = v.params[i]
+		}
+		if value == nil {
+			value = g.fixed
+		}
+		p.slots[g.slot] = value
+	}
+	for _, b := range p.bindings {
+		p.slots[b.slot] = b.code()
+	}
+	out := p.outputs[0]()
+	if v.scalar && len(out) != 1 {
+		panic(fmt.Sprintf("expression: the value must be a single number, got width %d",
+			len(out)))
+	}
+	return out
+}
@@ -0,0 +1,101 @@
+package general
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/rng"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+func TestExpressionEvaluator(t *testing.T) {
+	t.Run("set names shadow params, which shadow pi", func(t *testing.T) {
+		v, err := NewExpressionEvaluator(
+			"scale * x + pi",
+			[]ExpressionBinding{{Name: "scale", Expr: "2 * k"}},
+			nil,
+			false,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params := simulator.NewParams(map[string][]float64{"k": {3}, "x": {10, 20}})
+		v.SetParams(&params)
+		got := v.Evaluate()
+		if len(got) != 2 || got[0] != 60+math.Pi || got[1] != 120+math.Pi {
+			t.Errorf("from params: got %v", got)
+		}
+		v.Set("x", []float64{1})
+		if got := v.Evaluate(); len(got) != 1 || got[0] != 6+math.Pi {
+			t.Errorf("set x: got %v", got)
+		}
+		v.Set("x", nil)
+		if got := v.Evaluate(); got[0] != 60+math.Pi {
+			t.Errorf("unset x: got %v", got)
+		}
+		v.Set("pi", []float64{0})
+		if got := v.Evaluate(); got[0] != 60 {
+			t.Errorf("set pi: got %v", got)
+		}
+	})
+
+	t.Run("functions can be called", func(t *testing.T) {
+		v, err := NewExpressionEvaluator("sq(y) + 1", nil,
+			[]ExpressionFunction{{Name: "sq", Params: []string{"a"}, Expr: "a * a"}}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.Set("y", []float64{3})
+		if got := v.Evaluate(); got[0] != 10 {
+			t.Errorf("got %v, want [10]", got)
+		}
+	})
+
+	t.Run("a scalar draw needs no iid and follows the sampler", func(t *testing.T) {
+		v, err := NewExpressionEvaluator("normal(0, 1)", nil, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.SetSampler(rng.New(7))
+		first := v.Evaluate()[0]
+		v.SetSampler(rng.New(7))
+		if again := v.Evaluate()[0]; again != first {
+			t.Errorf("the same seed gave %v then %v", first, again)
+		}
+	})
+
+	t.Run("a scalar evaluator refuses a vector value", func(t *testing.T) {
+		v, err := NewExpressionEvaluator("x", nil, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.Set("x", []float64{1, 2})
+		defer func() {
+			r := recover()
+			if r == nil || !strings.Contains(r.(string), "single number") {
+				t.Errorf("got panic %v, want one about a single number", r)
+			}
+		}()
+		v.Evaluate()
+	})
+
+	t.Run("compile errors are returned", func(t *testing.T) {
+		for _, c := range []struct {
+			expr      string
+			bindings  []ExpressionBinding
+			functions []ExpressionFunction
+			want      string
+		}{
+			{"x +", nil, nil, "parsing"},
+			{"x", []ExpressionBinding{{Name: "b", Expr: "(("}}, nil, "binding b"},
+			{"f(x)", nil, []ExpressionFunction{{Name: "f", Params: []string{"a"}, Expr: "a +"}},
+				"f"},
+		} {
+			_, err := NewExpressionEvaluator(c.expr, c.bindings, c.functions, false)
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("%q: got %v, want an error mentioning %q", c.expr, err, c.want)
+			}
+		}
+	})
+}
@@ -0,0 +1,193 @@
+package general
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"strings"
+)
+
+// ExpressionFunction is a named, parameterised expression that bindings and outputs can call
+// like a built-in: a logistic link, a Gaussian CDF built from erfc, a seasonal forcing. It is
+// written once in a functions block rather than pasted into every expression that uses it.
+//
+// A call is inlined: the body is compiled afresh at each call site with its parameters bound
+// to the arguments, so a function costs what writing its body out would. The arguments are
+// evaluated once each, before the body, as a Go call's are, so an argument that draws draws
+// once however often the body mentions it, and where's laziness applies inside the body
+// rather than to the arguments.
+//
+// A function sees only its parameters and pi — not the partition's fields, params or
+// bindings, nor the clock — so what it computes is all in its signature and the same function
+// means the same thing in every partition that calls it. It may call other functions, but not
+// itself, directly or through another, so inlining always finishes and an expression still
+// always terminates. Draws in a body are read as at the call site: inside iid or shared there,
+// a scalar draw is fine; outside, it is the same ambiguity it would be written out.
+type ExpressionFunction struct {
+	// Name is how expressions call the function. It may not be the name of a built-in.
+	Name string `yaml:"name"`
+	// Params names the arguments, in call order.
+	Params []string `yaml:"params,omitempty"`
+	// Expr is the body, in terms of Params.
+	Expr string `yaml:"expr"`
+}
+
+// UseFunctions makes library callable from this iteration's expressions as if it had declared
+// them itself, except that a function it does declare under the same name takes precedence.
+// It is how a run-level functions block, and the files that block imports, reach every
+// expression partition in the run. It must be called before Configure.
+func (e *ExpressionIteration) UseFunctions(library []ExpressionFunction) {
+	e.library = library
+}
+
+// parsedExprFunction is an ExpressionFunction ready to be inlined.
+type parsedExprFunction struct {
+	name   string
+	params []string
+	body   ast.Expr
+	text   string
+}
+
+// parseExprFunctions parses the iteration's own functions over the library's.
+func (e *ExpressionIteration) parseExprFunctions() (
+	map[string]*parsedExprFunction,
+	[]ExpressionIssue,
+) {
+	return parseExprFunctions(e.library, e.Functions)
+}
+
+// parseExprFunctions parses each level of functions over those before it, reporting every
+// malformed definition. A definition that cannot be parsed is left out, so that calling it
+// reports an unknown function rather than something more confusing.
+func parseExprFunctions(levels ...[]ExpressionFunction) (
+	map[string]*parsedExprFunction,
+	[]ExpressionIssue,
+) {
+	functions := make(map[string]*parsedExprFunction)
+	var issues []ExpressionIssue
+	for _, level := range levels {
+		declared := make(map[string]bool, len(level))
+		for i, f := range level {
+			where := "function " + f.Name
+			problem := ""
+			_, builtin := exprArity[f.Name]
+			switch {
+			case f.Name == "":
+				where, problem = fmt.Sprintf("function at index %d", i), "has no name"
+			case builtin || f.Name == "concat" || f.Name == "interp":
+				problem = "has the name of a built-in function"
+			case declared[f.Name]:
+				problem = "is declared twice"
+			}
+			params := make(map[string]bool, len(f.Params))
+			for _, param := range f.Params {
+				switch {
+				case problem != "":
+				case param == "":
+					problem = "has a parameter with no name"
+				case params[param]:
+					problem = "has two parameters named " + param
+				}
+				params[param] = true
+			}
+			if problem != "" {
+				issues = append(issues, ExpressionIssue{Where: where, Message: problem})
+				continue
+			}
+			declared[f.Name] = true
+			body, err := parser.ParseExpr(f.Expr)
+			if err != nil {
+				issue := ExpressionIssue{Where: where, Expr: f.Expr, Message: err.Error()}
+				if list, ok := err.(scanner.ErrorList); ok && len(list) > 0 {
+					issue.Offset, issue.Message = list[0].Pos.Offset, list[0].Msg
+				}
+				issues = append(issues, issue)
+				continue
+			}
+			functions[f.Name] = &parsedExprFunction{f.Name, f.Params, body, f.Expr}
+		}
+	}
+	return functions, issues
+}
+
+// recursion names the cycle a call to name would close, given the functions being inlined
+// around it, or is empty if there is none.
+func recursion(inlining []string, name string) string {
+	for i, caller := range inlining {
+		if caller == name {
+			return strings.Join(append(inlining[i:len(inlining):len(inlining)], name), " -> ")
+		}
+	}
+	return ""
+}
+
+// inline compiles a call to a user-defined function: the arguments in the caller's scope, then
+// the body in a scope holding only the parameters, each in a fresh slot the call fills in.
+func (c *exprCompiler) inline(f *parsedExprFunction, n *ast.CallExpr) exprCode {
+	p := c.program
+	if len(n.Args) != len(f.params) {
+		return fail(fmt.Sprintf("expression: %s takes %d arguments, got %d",
+			f.name, len(f.params), len(n.Args)))
+	}
+	if cycle := recursion(c.inlining, f.name); cycle != "" {
+		return fail("expression: function " + f.name + " calls itself (" + cycle +
+			"); functions may not recurse")
+	}
+	args := make([]exprCode, len(n.Args))
+	for i, arg := range n.Args {
+		args[i] = c.compile(arg)
+	}
+	scope := c.scope
+	c.scope = nil
+	slots := make([]int, len(f.params))
+	for i, param := range f.params {
+		slots[i] = c.declare(param)
+		// A parameter is a matrix when its argument is, so a function can take one.
+		if rows, ok := c.rows[n.Args[i]]; ok {
+			c.localRows[slots[i]] = rows
+		}
+	}
+	c.inlining = append(c.inlining, f.name)
+	body := c.compile(f.body)
+	c.carryRows(n, f.body)
+	c.inlining = c.inlining[:len(c.inlining)-1]
+	c.scope = scope
+	return func() exprValue {
+		for i, arg := range args {
+			p.slots[slots[i]] = arg()
+		}
+		return body()
+	}
+}
+
+// inline checks a call to a user-defined function by checking its body with the parameters
+// as wide as the arguments, so a body that is fine for scalars but not for the vector it is
+// handed is reported, at the spot in the body.
+func (c *exprChecker) inline(f *parsedExprFunction, n *ast.CallExpr) exprShape {
+	if len(n.Args) != len(f.params) {
+		c.report(n.Pos(), "%s takes %d arguments, got %d", f.name, len(f.params), len(n.Args))
+		return unknownShape
+	}
+	if cycle := recursion(c.inlining, f.name); cycle != "" {
+		c.report(n.Pos(), "function %s calls itself (%s); functions may not recurse",
+			f.name, cycle)
+		return unknownShape
+	}
+	names := make([]exprCheckName, len(f.params))
+	for i, arg := range n.Args {
+		names[i] = exprCheckName{f.params[i], c.check(arg)}
+	}
+	return c.body(f, names)
+}
+
+// body checks f's body with only names in scope, reporting against the body's own text.
+func (c *exprChecker) body(f *parsedExprFunction, names []exprCheckName) exprShape {
+	scope, where, text := c.scope, c.where, c.text
+	c.scope, c.where, c.text = names, "function "+f.name, f.text
+	c.inlining = append(c.inlining, f.name)
+	shape := c.check(f.body)
+	c.inlining = c.inlining[:len(c.inlining)-1]
+	c.scope, c.where, c.text = scope, where, text
+	return shape
+}
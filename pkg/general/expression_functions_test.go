@@ -0,0 +1,163 @@
+package general
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func functionsIteration(output string, functions ...ExpressionFunction) *ExpressionIteration {
+	return &ExpressionIteration{
+		Fields:    []ExpressionField{{Name: "x", Width: 3}},
+		Outputs:   []string{output},
+		Functions: functions,
+	}
+}
+
+var (
+	logistic  = ExpressionFunction{Name: "logistic", Params: []string{"z"}, Expr: "1 / (1 + exp(-z))"}
+	normalCdf = ExpressionFunction{Name: "normal_cdf", Params: []string{"z"},
+		Expr: "0.5 * erfc(-z / sqrt(2))"}
+)
+
+func TestExpressionFunctionsAreInlined(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		output string
+		want   []float64
+	}{
+		{"a call gives the body's value", "logistic(x)", []float64{
+			1 / (1 + math.Exp(1)), 0.5, 1 / (1 + math.Exp(-2))}},
+		{"arguments are any expression", "fill(3, logistic(sum(x)))", []float64{
+			1 / (1 + math.Exp(-1)), 1 / (1 + math.Exp(-1)), 1 / (1 + math.Exp(-1))}},
+		{"functions call functions", "scaled(x, 2)", []float64{-1, 1, 5}},
+		{"each call site is its own copy", "logistic(x) + logistic(-x)", []float64{1, 1, 1}},
+		{"a call inside a lane binds per lane", "each(3, i, logistic(x[i]) + logistic(-x[i]))",
+			[]float64{1, 1, 1}},
+		{"a body may use pi", "area(x)", []float64{math.Pi, 0, 4 * math.Pi}},
+		{"a parameter named like a field is the parameter", "shift(2 * x)", []float64{-2, 0, 5}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			e := functionsIteration(c.output, logistic,
+				ExpressionFunction{Name: "scaled", Params: []string{"v", "k"},
+					Expr: "double(v) + k - 1"},
+				ExpressionFunction{Name: "double", Params: []string{"v"}, Expr: "2 * v"},
+				ExpressionFunction{Name: "area", Params: []string{"r"}, Expr: "pi * r * r"},
+				// x here is the parameter, not the field of the same name.
+				ExpressionFunction{Name: "shift", Params: []string{"x"},
+					Expr: "where(x > 0, x + 1, x)"})
+			got := evalOnce(t, e, []float64{-1, 0, 2}, nil)
+			for i := range c.want {
+				if math.Abs(got[i]-c.want[i]) > 1e-12 {
+					t.Fatalf("got %v, want %v", got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestExpressionFunctionArgumentsAreEvaluatedOnce(t *testing.T) {
+	// A body that mentions its parameter twice must see the same draw both times.
+	e := functionsIteration("iid(3, twice(normal(0, 1)))",
+		ExpressionFunction{Name: "twice", Params: []string{"d"}, Expr: "d - d"})
+	for i, v := range evalOnce(t, e, []float64{0, 0, 0}, nil) {
+		if v != 0 {
+			t.Errorf("element %d: got %v, want 0", i, v)
+		}
+	}
+}
+
+func TestExpressionFunctionsFromALibrary(t *testing.T) {
+	e := functionsIteration("normal_cdf(x)",
+		ExpressionFunction{Name: "normal_cdf", Params: []string{"z"}, Expr: "z"})
+	e.UseFunctions([]ExpressionFunction{normalCdf, logistic})
+	// The iteration's own normal_cdf takes precedence over the library's.
+	if got := evalOnce(t, e, []float64{1, 2, 3}, nil); got[2] != 3 {
+		t.Errorf("got %v, want the iteration's own definition", got)
+	}
+	e = functionsIteration("normal_cdf(x)")
+	e.UseFunctions([]ExpressionFunction{normalCdf})
+	if got := evalOnce(t, e, []float64{0, 0, 0}, nil); got[0] != 0.5 {
+		t.Errorf("got %v, want the library's definition", got)
+	}
+}
+
+func TestExpressionFunctionErrors(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		output    string
+		functions []ExpressionFunction
+		want      string
+	}{
+		{"recursion", "f(x)",
+			[]ExpressionFunction{{Name: "f", Params: []string{"v"}, Expr: "f(v)"}},
+			"function f calls itself (f -> f)"},
+		{"mutual recursion", "f(x)", []ExpressionFunction{
+			{Name: "f", Params: []string{"v"}, Expr: "g(v) + 1"},
+			{Name: "g", Params: []string{"v"}, Expr: "f(v) * 2"},
+		}, "function f calls itself (f -> g -> f)"},
+		{"wrong arity", "logistic(x, x)", []ExpressionFunction{logistic},
+			"logistic takes 1 arguments, got 2"},
+		{"a body reading outside its parameters", "f(x)",
+			[]ExpressionFunction{{Name: "f", Params: []string{"v"}, Expr: "v + x"}},
+			"function f has no parameter x"},
+		{"a built-in's name", "x",
+			[]ExpressionFunction{{Name: "exp", Params: []string{"v"}, Expr: "v"}},
+			"function exp: has the name of a built-in function"},
+		{"a duplicate", "x", []ExpressionFunction{logistic, logistic},
+			"function logistic: is declared twice"},
+		{"a duplicate parameter", "x",
+			[]ExpressionFunction{{Name: "f", Params: []string{"v", "v"}, Expr: "v"}},
+			"function f: has two parameters named v"},
+		{"a malformed body", "x",
+			[]ExpressionFunction{{Name: "f", Params: []string{"v"}, Expr: "v +"}},
+			"function f: expected operand"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			defer func() {
+				if got := stringifyPanic(recover()); !strings.Contains(got, c.want) {
+					t.Errorf("got %q, want it to contain %q", got, c.want)
+				}
+			}()
+			evalOnce(t, functionsIteration(c.output, c.functions...), []float64{0, 0, 0}, nil)
+		})
+	}
+}
+
+func TestExpressionCheckSeesInsideFunctions(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		output    string
+		functions []ExpressionFunction
+		want      string
+	}{
+		{"a body that cannot take what it is passed", "f(x)",
+			[]ExpressionFunction{{Name: "f", Params: []string{"v"}, Expr: "v + fill(4, 0)"}},
+			"function f: cannot combine widths 3 and 4 in +\n    v + fill(4, 0)\n      ^"},
+		{"a scalar draw at a call site outside iid", "x + f()",
+			[]ExpressionFunction{{Name: "f", Expr: "normal(0, 1)"}},
+			"function f: normal has only scalar parameters"},
+		{"recursion", "f(x)",
+			[]ExpressionFunction{{Name: "f", Params: []string{"v"}, Expr: "f(v)"}},
+			"function f: function f calls itself (f -> f)"},
+		{"a function nothing calls yet", "x",
+			[]ExpressionFunction{{Name: "f", Params: []string{"v"}, Expr: "v * rate"}},
+			"function f: function f has no parameter rate"},
+		{"a width the call passes on", "f(x)",
+			[]ExpressionFunction{{Name: "f", Params: []string{"v"}, Expr: "concat(v, v)"}},
+			"output for field x: produces width 6, want 3 or 1"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			issues := functionsIteration(c.output, c.functions...).Check(ExpressionShapes{})
+			if len(issues) != 1 || !strings.HasPrefix(issues[0].String(), c.want) {
+				t.Errorf("got %v, want one issue starting %q", issues, c.want)
+			}
+		})
+	}
+	// Called inside iid, the same scalar draw is fine.
+	e := functionsIteration("x + iid(3, f())",
+		ExpressionFunction{Name: "f", Expr: "normal(0, 1)"})
+	if issues := e.Check(ExpressionShapes{}); len(issues) != 0 {
+		t.Errorf("unexpected issues %v", issues)
+	}
+}
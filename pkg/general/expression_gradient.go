@@ -0,0 +1,140 @@
+package general
+
+import (
+	"fmt"
+
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// ExpressionGradientIteration outputs the derivative of an expression with respect to named
+// inputs, so that a model written as expressions can drive gradient-based fitting with no
+// gradient written in Go. Its state is the row-major Jacobian of Expr's value with respect to
+// WithRespectTo, which for a scalar objective is its gradient, laid out input by input:
+//
+//	expr: "sum(logpdf_normal(data, theta[0], exp(theta[1])))"
+//	with_respect_to: [theta]
+//	upstreams: {theta: fit}
+//
+// feeds a gradient_descent partition named fit its gradient through params_from_upstream,
+// with fit's own state read back here as theta. Names are resolved as an ExpressionIteration
+// resolves them, less fields: the clock, then upstream aliases, then params, then pi. An
+// input is any of those but the clock. See ExpressionDerivative for what can be
+// differentiated.
+//
+// The state width must be the width of Expr's value times the width of the inputs between
+// them, which Iterate checks.
+type ExpressionGradientIteration struct {
+	// Expr is the expression to differentiate.
+	Expr string `yaml:"expr"`
+	// WithRespectTo names the inputs, in the order the Jacobian's columns take them.
+	WithRespectTo []string `yaml:"with_respect_to"`
+	// Mode is how the Jacobian is swept for: reverse, the default, or forward. Both give the
+	// same numbers; reverse is cheaper for a narrow value, forward for few input elements.
+	Mode string `yaml:"mode,omitempty"`
+	// Upstreams maps an alias used in expressions to another partition's name, making that
+	// partition's current state readable.
+	Upstreams map[string]string `yaml:"upstreams,omitempty"`
+	// Bindings are ordered named intermediates Expr can read.
+	Bindings []ExpressionBinding `yaml:"bindings,omitempty"`
+	// Functions are user-defined functions the bindings and Expr can call.
+	Functions []ExpressionFunction `yaml:"functions,omitempty"`
+	// Matrices declares the params and upstream aliases that are row-major matrices, with
+	// their [rows, cols], for the matrix functions.
+	Matrices map[string][]int `yaml:"matrices,omitempty"`
+
+	derivative     *ExpressionDerivative
+	mode           ExpressionDerivativeMode
+	upstreamIndex  map[string]int
+	stateHistories []*simulator.StateHistory
+	clock          [3][]float64
+}
+
+// Configure parses the expression and resolves upstream partition names to indices. It panics
+// on a malformed specification.
+func (e *ExpressionGradientIteration) Configure(
+	partitionIndex int,
+	settings *simulator.Settings,
+) {
+	if len(e.WithRespectTo) == 0 {
+		panic("expression_gradient: with_respect_to must name at least one input")
+	}
+	for _, name := range e.WithRespectTo {
+		switch name {
+		case "dt", "t", "step":
+			panic("expression_gradient: " + name + " is the clock, which cannot be " +
+				"differentiated with respect to")
+		}
+	}
+	mode, err := ParseExpressionDerivativeMode(e.Mode)
+	if err != nil {
+		panic("expression_gradient: " + err.Error())
+	}
+	e.mode = mode
+	e.derivative, err = NewExpressionDerivative(
+		e.Expr, e.Bindings, e.Functions, e.Matrices, e.WithRespectTo)
+	if err != nil {
+		panic("expression_gradient: " + err.Error())
+	}
+	e.upstreamIndex = make(map[string]int, len(e.Upstreams))
+	for alias, name := range e.Upstreams {
+		found := -1
+		for i, it := range settings.Iterations {
+			if it.Name == name {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			panic("expression_gradient: upstream partition " + name + " (alias " + alias +
+				") not found")
+		}
+		e.upstreamIndex[alias] = found
+	}
+	e.clock = [3][]float64{{0}, {0}, {0}}
+	for i, name := range []string{"t", "dt", "step"} {
+		e.derivative.Set(name, e.clock[i])
+	}
+	e.derivative.lag = e.lag
+}
+
+// Iterate evaluates the expression at this step's params, upstreams and clock and returns its
+// Jacobian.
+func (e *ExpressionGradientIteration) Iterate(
+	params *simulator.Params,
+	partitionIndex int,
+	stateHistories []*simulator.StateHistory,
+	timestepsHistory *simulator.CumulativeTimestepsHistory,
+) []float64 {
+	e.stateHistories = stateHistories
+	e.clock[0][0] = timestepsHistory.Values.AtVec(0)
+	e.clock[1][0] = timestepsHistory.NextIncrement
+	e.clock[2][0] = float64(timestepsHistory.CurrentStepNumber)
+	for alias, index := range e.upstreamIndex {
+		e.derivative.Set(alias, stateHistories[index].Values.RawRowView(0))
+	}
+	e.derivative.SetParams(params)
+	value := e.derivative.Evaluate()
+	jacobian := e.derivative.Jacobian(e.mode)
+	if want := stateHistories[partitionIndex].StateWidth; len(jacobian) != want {
+		panic(fmt.Sprintf(
+			"expression_gradient: the Jacobian of a width-%d value by %d input elements has "+
+				"%d elements, but the state has width %d", len(value),
+			e.derivative.InputWidth(), len(jacobian), want))
+	}
+	return jacobian
+}
+
+// lag reads an upstream partition's committed state row rows back.
+func (e *ExpressionGradientIteration) lag(name string, row int) exprValue {
+	index, ok := e.upstreamIndex[name]
+	if !ok {
+		panic("expression: lag needs an upstream alias; got " + name)
+	}
+	history := e.stateHistories[index]
+	if row < 0 || row >= history.StateHistoryDepth {
+		panic(fmt.Sprintf(
+			"expression: lag(%s, %d) is outside the %d rows %s keeps; raise its "+
+				"state_history_depth", name, row, history.StateHistoryDepth, name))
+	}
+	return exprValue(history.Values.RawRowView(row))
+}
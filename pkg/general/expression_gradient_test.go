@@ -0,0 +1,100 @@
+package general
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/continuous"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// gradientExpr differentiates a squared distance to target with respect to the fitted
+// partition's state, which gradient descent then walks down.
+func gradientExpr(mode string) *ExpressionGradientIteration {
+	return &ExpressionGradientIteration{
+		Expr:          "sum((theta - target) * (theta - target))",
+		WithRespectTo: []string{"theta"},
+		Mode:          mode,
+		Upstreams:     map[string]string{"theta": "fit"},
+	}
+}
+
+func TestExpressionGradient(t *testing.T) {
+	for _, mode := range []string{"", "forward"} {
+		t.Run("gradient descent finds the minimum in mode "+mode, func(t *testing.T) {
+			settings := simulator.LoadSettingsFromYaml("./expression_gradient_settings.yaml")
+			iterations := []simulator.Iteration{
+				gradientExpr(mode), &continuous.GradientDescentIteration{},
+			}
+			for i, iteration := range iterations {
+				iteration.Configure(i, settings)
+			}
+			store := simulator.NewStateTimeStorage()
+			implementations := &simulator.Implementations{
+				Iterations:      iterations,
+				OutputCondition: &simulator.EveryStepOutputCondition{},
+				OutputFunction:  &simulator.StateTimeStorageOutputFunction{Store: store},
+				TerminationCondition: &simulator.NumberOfStepsTerminationCondition{
+					MaxNumberOfSteps: 100,
+				},
+				TimestepFunction: &simulator.ConstantTimestepFunction{Stepsize: 1.0},
+			}
+			simulator.NewPartitionCoordinator(settings, implementations).Run()
+			fit := store.GetValues("fit")
+			last := fit[len(fit)-1]
+			for i, want := range []float64{1.5, -0.5} {
+				if math.Abs(last[i]-want) > 1e-6 {
+					t.Errorf("element %d: got %v, want %v", i, last[i], want)
+				}
+			}
+		})
+	}
+
+	t.Run("runs with harnesses", func(t *testing.T) {
+		settings := simulator.LoadSettingsFromYaml("./expression_gradient_settings.yaml")
+		iterations := []simulator.Iteration{
+			gradientExpr("reverse"), &continuous.GradientDescentIteration{},
+		}
+		for i, iteration := range iterations {
+			iteration.Configure(i, settings)
+		}
+		implementations := &simulator.Implementations{
+			Iterations:      iterations,
+			OutputCondition: &simulator.EveryStepOutputCondition{},
+			OutputFunction:  &simulator.NilOutputFunction{},
+			TerminationCondition: &simulator.NumberOfStepsTerminationCondition{
+				MaxNumberOfSteps: 100,
+			},
+			TimestepFunction: &simulator.ConstantTimestepFunction{Stepsize: 1.0},
+		}
+		if err := simulator.RunWithHarnesses(settings, implementations); err != nil {
+			t.Errorf("test harness failed: %v", err)
+		}
+	})
+
+	t.Run("panics on a malformed specification", func(t *testing.T) {
+		settings := simulator.LoadSettingsFromYaml("./expression_gradient_settings.yaml")
+		for _, c := range []struct {
+			iteration *ExpressionGradientIteration
+			want      string
+		}{
+			{&ExpressionGradientIteration{Expr: "x"}, "at least one input"},
+			{&ExpressionGradientIteration{Expr: "t", WithRespectTo: []string{"t"}}, "clock"},
+			{&ExpressionGradientIteration{Expr: "x", WithRespectTo: []string{"x"},
+				Mode: "sideways"}, "forward or reverse"},
+			{&ExpressionGradientIteration{Expr: "x", WithRespectTo: []string{"x"},
+				Upstreams: map[string]string{"y": "missing"}}, "not found"},
+		} {
+			func() {
+				defer func() {
+					r := recover()
+					if r == nil || !strings.Contains(r.(string), c.want) {
+						t.Errorf("got panic %v, want one containing %q", r, c.want)
+					}
+				}()
+				c.iteration.Configure(0, settings)
+			}()
+		}
+	})
+}
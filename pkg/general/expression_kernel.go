@@ -0,0 +1,60 @@
+package general
+
+import (
+	"github.com/umbralcalc/stochadex/pkg/rng"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// ExpressionIntegrationKernel weights a past state by an expression, for a kernel that none of
+// pkg/kernels' fixed shapes fits. Weight reads current_state, past_state, current_time and
+// past_time, and the params the kernel's iteration hands SetParams:
+//
+//	weight: "exp((past_time - current_time) / timescale) * where(past_state[0] > 0, 1, 0)"
+//
+// It must give a single number. It lives here rather than in pkg/kernels because it is built
+// on this package's expressions, which pkg/kernels cannot import.
+type ExpressionIntegrationKernel struct {
+	// Weight is the kernel's value for one past state.
+	Weight string
+	// Bindings are ordered named intermediates Weight can read.
+	Bindings []ExpressionBinding
+	// Functions are user-defined functions the bindings and Weight can call.
+	Functions []ExpressionFunction
+
+	evaluator   *ExpressionEvaluator
+	currentTime []float64
+	pastTime    []float64
+}
+
+// Configure compiles the weight and seeds its draws, if it has any, from the partition's seed.
+// It panics on an expression that cannot be compiled.
+func (k *ExpressionIntegrationKernel) Configure(
+	partitionIndex int,
+	settings *simulator.Settings,
+) {
+	evaluator, err := NewExpressionEvaluator(k.Weight, k.Bindings, k.Functions, true)
+	if err != nil {
+		panic("expression_kernel: " + err.Error())
+	}
+	evaluator.SetSampler(rng.New(settings.Iterations[partitionIndex].Seed))
+	k.evaluator = evaluator
+	k.currentTime, k.pastTime = []float64{0}, []float64{0}
+	k.evaluator.Set("current_time", k.currentTime)
+	k.evaluator.Set("past_time", k.pastTime)
+}
+
+func (k *ExpressionIntegrationKernel) SetParams(params *simulator.Params) {
+	k.evaluator.SetParams(params)
+}
+
+func (k *ExpressionIntegrationKernel) Evaluate(
+	currentState []float64,
+	pastState []float64,
+	currentTime float64,
+	pastTime float64,
+) float64 {
+	k.currentTime[0], k.pastTime[0] = currentTime, pastTime
+	k.evaluator.Set("current_state", currentState)
+	k.evaluator.Set("past_state", pastState)
+	return k.evaluator.Evaluate()[0]
+}
@@ -0,0 +1,67 @@
+package general
+
+import (
+	"math"
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/kernels"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+func TestExpressionIntegrationKernel(t *testing.T) {
+	t.Run("matches the exponential kernel it writes out", func(t *testing.T) {
+		params := simulator.NewParams(map[string][]float64{
+			"exponential_weighting_timescale": {2.0},
+		})
+		settings := &simulator.Settings{
+			Iterations: []simulator.IterationSettings{{Name: "test", Params: params}},
+		}
+		expression := &ExpressionIntegrationKernel{
+			Weight: "exp((past_time - current_time) / exponential_weighting_timescale)",
+		}
+		exponential := &kernels.ExponentialIntegrationKernel{}
+		expression.Configure(0, settings)
+		exponential.Configure(0, settings)
+		expression.SetParams(&params)
+		exponential.SetParams(&params)
+		for _, pastTime := range []float64{0, 0.5, 3} {
+			got := expression.Evaluate([]float64{1}, []float64{2}, 4, pastTime)
+			want := exponential.Evaluate([]float64{1}, []float64{2}, 4, pastTime)
+			if math.Abs(got-want) > 1e-12 {
+				t.Errorf("past time %v: got %v, want %v", pastTime, got, want)
+			}
+		}
+		params.SetIndex("exponential_weighting_timescale", 0, 1.0)
+		expression.SetParams(&params)
+		if got := expression.Evaluate(nil, nil, 1, 0); math.Abs(got-math.Exp(-1)) > 1e-12 {
+			t.Errorf("after SetParams: got %v, want %v", got, math.Exp(-1))
+		}
+	})
+
+	t.Run("reads the states", func(t *testing.T) {
+		kernel := &ExpressionIntegrationKernel{
+			Bindings: []ExpressionBinding{{Name: "gap", Expr: "current_state[0] - past_state[0]"}},
+			Weight:   "where(gap > 1, 0, 1)",
+		}
+		kernel.Configure(0, &simulator.Settings{
+			Iterations: []simulator.IterationSettings{{Name: "test"}},
+		})
+		if got := kernel.Evaluate([]float64{3}, []float64{2.5}, 0, 0); got != 1 {
+			t.Errorf("near state: got %v, want 1", got)
+		}
+		if got := kernel.Evaluate([]float64{3}, []float64{1}, 0, 0); got != 0 {
+			t.Errorf("far state: got %v, want 0", got)
+		}
+	})
+
+	t.Run("panics on a weight that cannot be compiled", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected a panic")
+			}
+		}()
+		(&ExpressionIntegrationKernel{Weight: "exp("}).Configure(0, &simulator.Settings{
+			Iterations: []simulator.IterationSettings{{Name: "test"}},
+		})
+	})
+}
@@ -0,0 +1,462 @@
+package general
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/blas"
+	"gonum.org/v1/gonum/blas/blas64"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Matrices in expressions are ordinary values laid out row-major, so a 3x3 matrix is a width-9
+// value and everything elementwise — arithmetic, where, slice, sum — works on it unchanged.
+// What a width does not say is how many rows it has, so a value is a matrix only where that is
+// declared: a field with a shape, a param or upstream alias named in Matrices, or the result of
+// a matrix function. Arithmetic between a matrix and anything else keeps the matrix's shape,
+// so A - 2 * B and 0.5 * (S + transpose(S)) are matrices too, as is a binding whose expression
+// is one.
+//
+//   - matmul(A, B) is the product AB. B may be a matrix or a plain value, which is read as a
+//     column of width(A) / rows(A) rows, so matmul(A, x) is the matrix-vector product.
+//   - transpose(A) is the transpose.
+//   - outer(a, b) is the width(a) x width(b) matrix of products a[i] * b[j].
+//   - diag(v) is the square matrix with v on its diagonal; diag(A) of a matrix is its diagonal.
+//   - solve(A, B) is X with AX = B, for a square A, without forming the inverse.
+//   - cholesky(A) is the lower-triangular L with LLᵀ = A, for a symmetric positive definite A.
+//   - inv(A) is the inverse, for when it is wanted itself; prefer solve to multiply by it.
+//
+// The products and factorisations are gonum's.
+
+// matrixShapes validates and collects the declared shapes of fields and of Matrices entries.
+func (e *ExpressionIteration) matrixShapes() (map[string][2]int, []ExpressionIssue) {
+	shapes := make(map[string][2]int)
+	var issues []ExpressionIssue
+	shape := func(where string, dims []int) ([2]int, bool) {
+		if len(dims) != 2 || dims[0] < 1 || dims[1] < 1 {
+			issues = append(issues, ExpressionIssue{Where: where,
+				Message: fmt.Sprintf("a shape is [rows, cols], both at least 1; got %v", dims)})
+			return [2]int{}, false
+		}
+		return [2]int{dims[0], dims[1]}, true
+	}
+	fields := make(map[string]bool, len(e.Fields))
+	for _, f := range e.Fields {
+		fields[f.Name] = true
+		if f.Shape == nil {
+			continue
+		}
+		s, ok := shape("field "+f.Name, f.Shape)
+		if !ok {
+			continue
+		}
+		if f.Width != 0 && f.Width != s[0]*s[1] {
+			issues = append(issues, ExpressionIssue{Where: "field " + f.Name,
+				Message: fmt.Sprintf("has width %d but shape %dx%d", f.Width, s[0], s[1])})
+			continue
+		}
+		shapes[f.Name] = s
+	}
+	names := make([]string, 0, len(e.Matrices))
+	for name := range e.Matrices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if fields[name] {
+			issues = append(issues, ExpressionIssue{Where: "matrices",
+				Message: name + " is a field; give a field's shape on the field"})
+			continue
+		}
+		if s, ok := shape("matrices entry "+name, e.Matrices[name]); ok {
+			shapes[name] = s
+		}
+	}
+	return shapes, issues
+}
+
+// exprRows gives the row count of a matrix-valued node, valid once the node has run.
+type exprRows func() int
+
+// carryRows records node as a matrix with the rows of the first of from that is one, which is
+// how a shape survives parentheses, negation and arithmetic.
+func (c *exprCompiler) carryRows(node ast.Expr, from ...ast.Expr) {
+	for _, f := range from {
+		if rows, ok := c.rows[f]; ok {
+			c.rows[node] = rows
+			return
+		}
+	}
+}
+
+// declaredMatrix compiles a read of a global declared to be a matrix, which also checks that
+// what is read this step has the declared width.
+func (c *exprCompiler) declaredMatrix(n *ast.Ident, read exprCode, shape [2]int) exprCode {
+	rows, width := shape[0], shape[0]*shape[1]
+	c.rows[n] = func() int { return rows }
+	return func() exprValue {
+		v := read()
+		if len(v) != width {
+			panic(fmt.Sprintf("expression: %s is declared %dx%d but has width %d",
+				n.Name, shape[0], shape[1], len(v)))
+		}
+		return v
+	}
+}
+
+// exprMatrixFunctions are the functions that take or give a matrix.
+var exprMatrixFunctions = map[string]bool{
+	"matmul": true, "transpose": true, "outer": true, "diag": true,
+	"solve": true, "cholesky": true, "inv": true,
+}
+
+// matrix compiles a call to one of exprMatrixFunctions, whose arguments are already compiled.
+func (c *exprCompiler) matrix(name string, n *ast.CallExpr, args []exprCode) exprCode {
+	shape := make([]exprRows, len(args))
+	for i, arg := range n.Args {
+		shape[i] = c.rows[arg]
+	}
+	operand := func(i int) bool {
+		return shape[i] != nil
+	}
+	needs := func(i int) exprCode {
+		return fail(fmt.Sprintf("expression: %s's %s argument must be a matrix: a field with a "+
+			"shape, a param declared in matrices, or the result of a matrix function",
+			name, []string{"first", "second"}[i]))
+	}
+	// dims is the rows and cols of a, the value argument i gave, and square additionally
+	// insists that they are equal.
+	dims := func(i int, a exprValue) (int, int) {
+		rows := shape[i]()
+		if rows < 1 || len(a) == 0 || len(a)%rows != 0 {
+			panic(fmt.Sprintf("expression: %s: a width-%d value cannot have %d rows",
+				name, len(a), rows))
+		}
+		return rows, len(a) / rows
+	}
+	square := func(i int, a exprValue) int {
+		rows, cols := dims(i, a)
+		if rows != cols {
+			panic(fmt.Sprintf("expression: %s needs a square matrix, got %dx%d", name, rows, cols))
+		}
+		return rows
+	}
+	var buffer exprValue
+	var rows int
+	result := func(code exprCode) exprCode {
+		c.rows[n] = func() int { return rows }
+		return code
+	}
+	var ad, bd, od mat.Dense
+	raw := func(m *mat.Dense, rows, cols int, data []float64) *mat.Dense {
+		m.SetRawMatrix(blas64.General{Rows: rows, Cols: cols, Stride: cols, Data: data})
+		return m
+	}
+
+	switch name {
+	case "matmul":
+		if !operand(0) {
+			return needs(0)
+		}
+		x, y := args[0], args[1]
+		return result(func() exprValue {
+			a, b := x(), y()
+			ar, ac := dims(0, a)
+			br, bc := ac, 0
+			if operand(1) {
+				br, bc = dims(1, b)
+			} else if len(b)%ac == 0 {
+				bc = len(b) / ac
+			}
+			if br != ac || bc == 0 {
+				panic(fmt.Sprintf("expression: matmul: a %dx%d matrix cannot multiply a "+
+					"width-%d value", ar, ac, len(b)))
+			}
+			out := take(&buffer, ar*bc)
+			raw(&od, ar, bc, out).Mul(raw(&ad, ar, ac, a), raw(&bd, br, bc, b))
+			rows = ar
+			return out
+		})
+	case "transpose":
+		if !operand(0) {
+			return needs(0)
+		}
+		x := args[0]
+		return result(func() exprValue {
+			a := x()
+			ar, ac := dims(0, a)
+			out := take(&buffer, len(a))
+			for i := 0; i < ar; i++ {
+				for j := 0; j < ac; j++ {
+					out[j*ar+i] = a[i*ac+j]
+				}
+			}
+			rows = ac
+			return out
+		})
+	case "outer":
+		x, y := args[0], args[1]
+		return result(func() exprValue {
+			a, b := x(), y()
+			if len(a) == 0 || len(b) == 0 {
+				panic("expression: outer needs two non-empty values")
+			}
+			out := take(&buffer, len(a)*len(b))
+			for i, u := range a {
+				for j, v := range b {
+					out[i*len(b)+j] = u * v
+				}
+			}
+			rows = len(a)
+			return out
+		})
+	case "diag":
+		x := args[0]
+		if operand(0) {
+			// The diagonal of a matrix is a plain value, so the result is not recorded as one.
+			return func() exprValue {
+				a := x()
+				ar, ac := dims(0, a)
+				out := take(&buffer, min(ar, ac))
+				for i := range out {
+					out[i] = a[i*ac+i]
+				}
+				return out
+			}
+		}
+		return result(func() exprValue {
+			v := x()
+			if len(v) == 0 {
+				panic("expression: diag needs a non-empty value")
+			}
+			out := take(&buffer, len(v)*len(v))
+			clear(out)
+			for i, d := range v {
+				out[i*len(v)+i] = d
+			}
+			rows = len(v)
+			return out
+		})
+	case "solve":
+		if !operand(0) {
+			return needs(0)
+		}
+		x, y := args[0], args[1]
+		var lu mat.LU
+		return result(func() exprValue {
+			a, b := x(), y()
+			size := square(0, a)
+			br, bc := size, 0
+			if operand(1) {
+				br, bc = dims(1, b)
+			} else if len(b)%size == 0 {
+				bc = len(b) / size
+			}
+			if br != size || bc == 0 {
+				panic(fmt.Sprintf("expression: solve: a %dx%d system cannot have a width-%d "+
+					"right-hand side", size, size, len(b)))
+			}
+			lu.Factorize(raw(&ad, size, size, a))
+			out := take(&buffer, len(b))
+			singular(name, lu.SolveTo(raw(&od, size, bc, out), false, raw(&bd, br, bc, b)))
+			rows = size
+			return out
+		})
+	case "cholesky":
+		if !operand(0) {
+			return needs(0)
+		}
+		x := args[0]
+		var chol mat.Cholesky
+		var sym mat.SymDense
+		var lower mat.TriDense
+		return result(func() exprValue {
+			a := x()
+			size := square(0, a)
+			factorizeSymmetric(name, "matrix", &chol, &sym, a, size)
+			lower.Reset()
+			chol.LTo(&lower)
+			out := take(&buffer, len(a))
+			for i := 0; i < size; i++ {
+				for j := 0; j < size; j++ {
+					out[i*size+j] = lower.At(i, j)
+				}
+			}
+			rows = size
+			return out
+		})
+	case "inv":
+		if !operand(0) {
+			return needs(0)
+		}
+		x := args[0]
+		return result(func() exprValue {
+			a := x()
+			size := square(0, a)
+			out := take(&buffer, len(a))
+			singular(name, raw(&od, size, size, out).Inverse(raw(&ad, size, size, a)))
+			rows = size
+			return out
+		})
+	}
+	return fail("expression: unknown function " + name)
+}
+
+// factorizeSymmetric Cholesky-factorises the row-major size x size a into chol, through sym,
+// panicking if it is not symmetric positive definite. what is what the caller calls a.
+func factorizeSymmetric(
+	name, what string,
+	chol *mat.Cholesky,
+	sym *mat.SymDense,
+	a []float64,
+	size int,
+) {
+	for i := 0; i < size; i++ {
+		for j := 0; j < i; j++ {
+			if a[i*size+j] != a[j*size+i] {
+				panic(fmt.Sprintf("expression: %s needs a symmetric %s", name, what))
+			}
+		}
+	}
+	sym.SetRawSymmetric(blas64.Symmetric{N: size, Stride: size, Data: a, Uplo: blas.Upper})
+	if !chol.Factorize(sym) {
+		panic(fmt.Sprintf("expression: %s needs a positive definite %s", name, what))
+	}
+}
+
+// singular panics on gonum's report that a matrix is exactly singular. A large but finite
+// condition number is only a warning that the answer may be inaccurate, as it is in gonum.
+func singular(name string, err error) {
+	var condition mat.Condition
+	if errors.As(err, &condition) && math.IsInf(float64(condition), 1) {
+		panic("expression: " + name + ": the matrix is singular")
+	}
+}
+
+// matrix checks a call to one of exprMatrixFunctions, given its arguments' shapes.
+func (c *exprChecker) matrix(name string, n *ast.CallExpr, args []exprShape) exprShape {
+	// dims is a matrix's rows and cols, each -1 if it depends on data.
+	dims := func(s exprShape) (int, int) {
+		if s.rows > 0 && s.width > 0 && s.width%s.rows == 0 {
+			return s.rows, s.width / s.rows
+		}
+		return s.rows, -1
+	}
+	matrix := func(width, rows int) exprShape {
+		if rows == 0 {
+			rows = -1
+		}
+		return exprShape{width: width, rows: rows}
+	}
+	needs := func(i int) bool {
+		if args[i].rows != 0 {
+			return false
+		}
+		c.report(n.Args[i].Pos(), "%s's %s argument must be a matrix: a field with a shape, "+
+			"a param declared in matrices, or the result of a matrix function",
+			name, []string{"first", "second"}[i])
+		return true
+	}
+	// square is the size of a square first argument, or 0 if it is not square, which has
+	// been reported.
+	square := func() int {
+		rows, cols := dims(args[0])
+		if rows > 0 && cols > 0 && rows != cols {
+			c.report(n.Args[0].Pos(), "%s needs a square matrix, got %dx%d", name, rows, cols)
+			return 0
+		}
+		return rows
+	}
+	// columns is how many columns the second argument has when it is multiplied into (or
+	// solved against) something with inner rows, or -1 if that depends on data. mismatch
+	// reports that it cannot be, in the words Iterate would use.
+	columns := func(inner int, mismatch func()) int {
+		b := args[1]
+		if b.rows != 0 {
+			rows, cols := dims(b)
+			if rows > 0 && inner > 0 && rows != inner && b.width >= 0 {
+				mismatch()
+				return -1
+			}
+			return cols
+		}
+		if inner > 0 && b.width >= 0 {
+			if b.width == 0 || b.width%inner != 0 {
+				mismatch()
+				return -1
+			}
+			return b.width / inner
+		}
+		return -1
+	}
+
+	switch name {
+	case "matmul":
+		if needs(0) {
+			return unknownShape
+		}
+		rows, cols := dims(args[0])
+		bc := columns(cols, func() {
+			c.report(n.Args[1].Pos(), "matmul: a %dx%d matrix cannot multiply a width-%d value",
+				rows, cols, args[1].width)
+		})
+		if rows > 0 && bc > 0 {
+			return matrix(rows*bc, rows)
+		}
+		return matrix(-1, rows)
+	case "transpose":
+		if needs(0) {
+			return unknownShape
+		}
+		_, cols := dims(args[0])
+		return matrix(args[0].width, cols)
+	case "outer":
+		a, b := args[0].width, args[1].width
+		if a >= 0 && b >= 0 {
+			return matrix(a*b, a)
+		}
+		return matrix(-1, a)
+	case "diag":
+		if args[0].rows != 0 {
+			rows, cols := dims(args[0])
+			if rows > 0 && cols > 0 {
+				return widthShape(min(rows, cols))
+			}
+			return unknownShape
+		}
+		if w := args[0].width; w >= 0 {
+			return matrix(w*w, w)
+		}
+		return matrix(-1, -1)
+	case "solve":
+		if needs(0) {
+			return unknownShape
+		}
+		size := square()
+		if size == 0 {
+			return unknownShape
+		}
+		fits := true
+		columns(size, func() {
+			c.report(n.Args[1].Pos(), "solve: a %dx%d system cannot have a width-%d "+
+				"right-hand side", size, size, args[1].width)
+			fits = false
+		})
+		if !fits {
+			return unknownShape
+		}
+		return matrix(args[1].width, size)
+	}
+	// cholesky and inv.
+	if needs(0) {
+		return unknownShape
+	}
+	size := square()
+	if size == 0 {
+		return unknownShape
+	}
+	return matrix(args[0].width, size)
+}
@@ -0,0 +1,208 @@
+package general
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// matrixIteration has a 2x2 field M and a plain 2-wide field v, and reads the 2x3 param B
+// and the 3x3 symmetric positive definite param S as matrices.
+func matrixIteration(output string, bindings ...ExpressionBinding) *ExpressionIteration {
+	return &ExpressionIteration{
+		Fields:   []ExpressionField{{Name: "M", Shape: []int{2, 2}}, {Name: "v", Width: 2}},
+		Matrices: map[string][]int{"B": {2, 3}, "S": {3, 3}},
+		Bindings: bindings,
+		Outputs:  []string{output, "v"},
+	}
+}
+
+var matrixParams = map[string][]float64{
+	"B": {1, 2, 3, 4, 5, 6},
+	"S": {4, 2, 0, 2, 5, 1, 0, 1, 3},
+	"w": {1, 1, 1},
+}
+
+func assertValues(t *testing.T, got, want []float64) {
+	t.Helper()
+	if len(got) < len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-12 {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestExpressionMatrixFunctions(t *testing.T) {
+	// M = [[2, 1], [1, 3]], v = [1, 2].
+	state := []float64{2, 1, 1, 3, 1, 2}
+	for _, c := range []struct {
+		name   string
+		output string
+		want   []float64
+	}{
+		{"a matrix-vector product", "fill(4, 0) + concat(matmul(M, v), 0, 0)", []float64{4, 7, 0, 0}},
+		{"a matrix-matrix product", "matmul(M, M)", []float64{5, 5, 5, 10}},
+		{"a product through a wider matrix", "concat(matmul(B, w), 0, 0)",
+			[]float64{6, 15, 0, 0}},
+		{"transpose", "slice(matmul(transpose(B), v), 0, 3)[0] + fill(4, 0)",
+			[]float64{9, 9, 9, 9}},
+		{"outer", "outer(v, v)", []float64{1, 2, 2, 4}},
+		{"diag of a vector", "diag(v)", []float64{1, 0, 0, 2}},
+		{"diag of a matrix", "concat(diag(M), diag(M))", []float64{2, 3, 2, 3}},
+		{"solve", "concat(solve(M, matmul(M, v)), 0, 0)", []float64{1, 2, 0, 0}},
+		{"inv", "matmul(inv(M), M)", []float64{1, 0, 0, 1}},
+		{"arithmetic keeps the shape", "matmul(2 * M - diag(fill(2, 1)), diag(fill(2, 1)))",
+			[]float64{3, 2, 2, 5}},
+		{"a binding keeps the shape", "concat(matmul(P, v), matmul(P, v))", []float64{4, 7, 4, 7}},
+		{"a shaped field is just its values elementwise", "M + 1", []float64{3, 2, 2, 4}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			e := matrixIteration(c.output, ExpressionBinding{Name: "P", Expr: "(M)"})
+			assertValues(t, evalOnce(t, e, state, matrixParams), c.want)
+		})
+	}
+}
+
+func TestExpressionCholeskyMatchesGonum(t *testing.T) {
+	e := &ExpressionIteration{
+		Fields:   []ExpressionField{{Name: "L", Shape: []int{3, 3}}},
+		Matrices: map[string][]int{"S": {3, 3}},
+		Outputs:  []string{"cholesky(S)"},
+	}
+	got := evalOnce(t, e, make([]float64, 9), matrixParams)
+	var chol mat.Cholesky
+	if !chol.Factorize(mat.NewSymDense(3, matrixParams["S"])) {
+		t.Fatal("S is not positive definite")
+	}
+	var lower mat.TriDense
+	chol.LTo(&lower)
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if got[i*3+j] != lower.At(i, j) {
+				t.Fatalf("got %v, want %v", got, mat.Formatted(&lower))
+			}
+		}
+	}
+}
+
+func TestExpressionMatrixFunctionsCompose(t *testing.T) {
+	// A user-defined function may take and return a matrix.
+	e := matrixIteration("sandwich(M, diag(v))", ExpressionBinding{Name: "unused", Expr: "0"})
+	e.Functions = []ExpressionFunction{{Name: "sandwich", Params: []string{"A", "D"},
+		Expr: "matmul(transpose(A), matmul(D, A))"}}
+	// Mᵀ diag(v) M with M = [[2, 1], [1, 3]], v = [1, 2].
+	assertValues(t, evalOnce(t, e, []float64{2, 1, 1, 3, 1, 2}, nil), []float64{6, 8, 8, 19})
+}
+
+func TestExpressionMatrixErrors(t *testing.T) {
+	state := []float64{2, 1, 1, 3, 1, 2}
+	for _, c := range []struct {
+		name   string
+		output string
+		params map[string][]float64
+		want   string
+	}{
+		{"an undeclared operand", "matmul(v, M)", matrixParams,
+			"matmul's first argument must be a matrix"},
+		{"a product that does not fit", "matmul(M, w)", matrixParams,
+			"matmul: a 2x2 matrix cannot multiply a width-3 value"},
+		{"a param of the wrong width", "fill(4, sum(B))",
+			map[string][]float64{"B": {1, 2}}, "B is declared 2x3 but has width 2"},
+		{"a non-square inverse", "fill(4, sum(inv(B)))", matrixParams,
+			"inv needs a square matrix, got 2x3"},
+		{"a singular system", "concat(solve(M * 0, v), 0, 0)", matrixParams,
+			"solve: the matrix is singular"},
+		{"a singular inverse", "inv(M * 0)", matrixParams, "inv: the matrix is singular"},
+		{"an asymmetric cholesky", "cholesky(matmul(M, diag(v)))", matrixParams,
+			"cholesky needs a symmetric matrix"},
+		{"an indefinite cholesky", "cholesky(-M)", matrixParams,
+			"cholesky needs a positive definite matrix"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			defer func() {
+				if got := stringifyPanic(recover()); !strings.Contains(got, c.want) {
+					t.Errorf("got %q, want it to contain %q", got, c.want)
+				}
+			}()
+			evalOnce(t, matrixIteration(c.output), state, c.params)
+		})
+	}
+}
+
+func TestExpressionMatrixDeclarationsAreChecked(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		e    *ExpressionIteration
+		want string
+	}{
+		{"a shape that is not two dimensions", &ExpressionIteration{
+			Fields:  []ExpressionField{{Name: "M", Shape: []int{4}}},
+			Outputs: []string{"M"},
+		}, "field M: a shape is [rows, cols], both at least 1; got [4]"},
+		{"a shape at odds with the width", &ExpressionIteration{
+			Fields:  []ExpressionField{{Name: "M", Width: 3, Shape: []int{2, 2}}},
+			Outputs: []string{"M"},
+		}, "field M: has width 3 but shape 2x2"},
+		{"a field in matrices", &ExpressionIteration{
+			Fields:   []ExpressionField{{Name: "M", Width: 4}},
+			Matrices: map[string][]int{"M": {2, 2}},
+			Outputs:  []string{"M"},
+		}, "matrices: M is a field; give a field's shape on the field"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			defer func() {
+				if got := stringifyPanic(recover()); !strings.Contains(got, c.want) {
+					t.Errorf("got %q, want it to contain %q", got, c.want)
+				}
+			}()
+			evalOnce(t, c.e, []float64{0, 0, 0, 0}, nil)
+		})
+	}
+}
+
+func TestExpressionCheckKnowsMatrixShapes(t *testing.T) {
+	shapes := ExpressionShapes{StateWidth: 6, Params: map[string]int{"B": 6, "S": 9, "w": 3}}
+	for _, c := range []struct {
+		output string
+		want   string
+	}{
+		{"matmul(v, M)", "matmul's first argument must be a matrix"},
+		{"concat(matmul(M, w), 0, 0)", "matmul: a 2x2 matrix cannot multiply a width-3 value"},
+		{"matmul(M, B) + 0", "produces width 6, want 4 or 1"},
+		{"fill(4, sum(solve(B, v)))", "solve needs a square matrix, got 2x3"},
+		{"inv(transpose(B))", "inv needs a square matrix, got 3x2"},
+		{"concat(solve(S, v), 0)", "solve: a 3x3 system cannot have a width-2 right-hand side"},
+		{"outer(v, w)", "produces width 6, want 4 or 1"},
+	} {
+		issues := matrixIteration(c.output).Check(shapes)
+		if len(issues) != 1 || !strings.Contains(issues[0].Message, c.want) {
+			t.Errorf("%s: got %v, want one issue containing %q", c.output, issues, c.want)
+		}
+	}
+	for _, output := range []string{
+		"matmul(M, M)",
+		"concat(matmul(B, w), 0, 0)",
+		"matmul(transpose(B), slice(B, 0, 2))[0] + fill(4, 0)",
+		"diag(v) + outer(v, v) + inv(M)",
+		"fill(4, sum(cholesky(S)))",
+		"concat(diag(M), solve(M, v))",
+	} {
+		if issues := matrixIteration(output).Check(shapes); len(issues) != 0 {
+			t.Errorf("%s: unexpected issues %v", output, issues)
+		}
+	}
+	shapes.Params["B"] = 5
+	issues := matrixIteration("M").Check(shapes)
+	if len(issues) != 0 {
+		t.Errorf("an unread param should not be checked: %v", issues)
+	}
+	issues = matrixIteration("fill(4, sum(B))").Check(shapes)
+	if len(issues) != 1 || !strings.Contains(issues[0].Message, "B is declared 2x3 but has width 5") {
+		t.Errorf("got %v", issues)
+	}
+}
@@ -0,0 +1,333 @@
+package general
+
+import (
+	"cmp"
+	"fmt"
+	"go/ast"
+	"math"
+	"slices"
+)
+
+// Ordering functions reorder or rank a whole value, which nothing elementwise can: a
+// prioritised allocation fills the most urgent demand first, an order book reads its best
+// price levels, and a quantile is read off the sorted data.
+//
+//   - sort(v) is v in ascending order, and argsort(v) the indices that put it there.
+//   - rank(v) is each element's position in that order, so rank(v)[i] == 0 for the smallest.
+//   - argmax(v) and argmin(v) are the index of the largest and of the smallest element.
+//   - topk(v, k) is the k largest elements, largest first.
+//   - cumsum(v) is the running total, cumsum(v)[i] == sum(slice(v, 0, i + 1)).
+//   - quantile(v, q) is the q-quantile of v's elements, interpolated linearly between the
+//     order statistics either side of it, for each element of q.
+//   - gather(v, indices) is v[indices[i]] for each element of indices, so
+//     gather(v, argsort(v)) is sort(v).
+//
+// Ties go to the earlier element, always: sort is stable, argmax and argmin give the first
+// index at the extreme, and topk keeps the earlier of equal values, so two runs over the same
+// data order it the same way. NaN orders before every number, as cmp.Compare has it, and a
+// quantile of data holding a NaN is NaN. The indices these give are ordinary numbers, usable
+// anywhere an index is, and a derivative of sort, topk, cumsum, quantile and gather is taken
+// through the elements they read; the index-valued functions are constants to it.
+
+// exprOrderFunctions are the functions that order a value.
+var exprOrderFunctions = map[string]bool{
+	"sort": true, "argsort": true, "rank": true, "argmax": true, "argmin": true,
+	"topk": true, "cumsum": true, "quantile": true, "gather": true,
+}
+
+// ascending fills perm with the indices of v in ascending order, ties by index.
+func ascending(perm []int, v exprValue) []int {
+	perm = perm[:0]
+	for i := range v {
+		perm = append(perm, i)
+	}
+	slices.SortFunc(perm, func(a, b int) int {
+		if c := cmp.Compare(v[a], v[b]); c != 0 {
+			return c
+		}
+		return a - b
+	})
+	return perm
+}
+
+// descending fills perm with the indices of v in descending order, ties by index.
+func descending(perm []int, v exprValue) []int {
+	perm = perm[:0]
+	for i := range v {
+		perm = append(perm, i)
+	}
+	slices.SortFunc(perm, func(a, b int) int {
+		if c := cmp.Compare(v[b], v[a]); c != 0 {
+			return c
+		}
+		return a - b
+	})
+	return perm
+}
+
+// extreme is the first index of v's largest element, or with sign -1 its smallest.
+func extreme(name string, v exprValue, sign int) int {
+	if len(v) == 0 {
+		panic("expression: " + name + " of an empty value")
+	}
+	best := 0
+	for i := 1; i < len(v); i++ {
+		if sign*cmp.Compare(v[i], v[best]) > 0 {
+			best = i
+		}
+	}
+	return best
+}
+
+// topkCount is topk's k, checked against the width of the value it reads.
+func topkCount(k exprValue, width int) int {
+	if len(k) != 1 {
+		panic("expression: topk's k must be a scalar")
+	}
+	n := toIndex(k[0], "topk's k")
+	if n < 0 {
+		panic("expression: topk's k must not be negative")
+	}
+	if n > width {
+		panic(fmt.Sprintf("expression: topk(%d) is more than a width-%d value has", n, width))
+	}
+	return n
+}
+
+// quantilePosition is where the q-quantile of n sorted values falls: between order statistics
+// lo and hi, a fraction w of the way from lo.
+func quantilePosition(n int, q float64) (int, int, float64) {
+	if n == 0 {
+		panic("expression: quantile of an empty value")
+	}
+	if !(q >= 0 && q <= 1) {
+		panic(fmt.Sprintf("expression: quantile's q must be between 0 and 1, got %v", q))
+	}
+	h := float64(n-1) * q
+	lo := int(h)
+	if lo == n-1 {
+		return lo, lo, 0
+	}
+	return lo, lo + 1, h - float64(lo)
+}
+
+// gatherIndex is element j of indices as an index into a width-n value.
+func gatherIndex(indices exprValue, j, n int) int {
+	i := toIndex(indices[j], "gather's index")
+	if i < 0 || i >= n {
+		panic(fmt.Sprintf("expression: gather's index %d out of range for width %d", i, n))
+	}
+	return i
+}
+
+// order compiles a call to one of exprOrderFunctions.
+func (c *exprCompiler) order(name string, args []exprCode) exprCode {
+	var buffer exprValue
+	var perm []int
+	x := args[0]
+	switch name {
+	case "sort", "argsort", "rank":
+		return func() exprValue {
+			v := x()
+			perm = ascending(perm, v)
+			out := take(&buffer, len(v))
+			for j, i := range perm {
+				switch name {
+				case "sort":
+					out[j] = v[i]
+				case "argsort":
+					out[j] = float64(i)
+				default:
+					out[i] = float64(j)
+				}
+			}
+			return out
+		}
+	case "argmax", "argmin":
+		sign := 1
+		if name == "argmin" {
+			sign = -1
+		}
+		return func() exprValue {
+			out := take(&buffer, 1)
+			out[0] = float64(extreme(name, x(), sign))
+			return out
+		}
+	case "topk":
+		k := args[1]
+		return func() exprValue {
+			v := x()
+			n := topkCount(k(), len(v))
+			perm = descending(perm, v)
+			out := take(&buffer, n)
+			for j := range out {
+				out[j] = v[perm[j]]
+			}
+			return out
+		}
+	case "cumsum":
+		return func() exprValue {
+			v := x()
+			out := take(&buffer, len(v))
+			total := 0.0
+			for i, e := range v {
+				total += e
+				out[i] = total
+			}
+			return out
+		}
+	case "quantile":
+		q := args[1]
+		return func() exprValue {
+			v, qs := x(), q()
+			perm = ascending(perm, v)
+			out := take(&buffer, len(qs))
+			for j, p := range qs {
+				lo, hi, w := quantilePosition(len(v), p)
+				if math.IsNaN(v[perm[0]]) {
+					out[j] = math.NaN()
+					continue
+				}
+				a, b := v[perm[lo]], v[perm[hi]]
+				out[j] = a + w*(b-a)
+			}
+			return out
+		}
+	}
+	indices := args[1]
+	return func() exprValue {
+		v, idx := x(), indices()
+		out := take(&buffer, len(idx))
+		for j := range out {
+			out[j] = v[gatherIndex(idx, j, len(v))]
+		}
+		return out
+	}
+}
+
+// order checks a call to one of exprOrderFunctions.
+func (c *exprChecker) order(name string, n *ast.CallExpr, args []exprShape) exprShape {
+	x := args[0]
+	switch name {
+	case "sort", "cumsum":
+		if x.constant {
+			return x
+		}
+		return widthShape(x.width)
+	case "argsort", "rank":
+		if x.width == 1 {
+			return constantShape(0)
+		}
+		return widthShape(x.width)
+	case "argmax", "argmin":
+		switch x.width {
+		case 0:
+			c.report(n.Args[0].Pos(), "%s of an empty value", name)
+		case 1:
+			return constantShape(0)
+		}
+		return widthShape(1)
+	case "topk":
+		c.scalar(n.Args[1], args[1], "topk's k must be a scalar")
+		k, ok := c.count(n.Args[1], args[1], "topk's k")
+		if !ok {
+			return unknownShape
+		}
+		if k < 0 {
+			c.report(n.Args[1].Pos(), "topk's k must not be negative")
+			return unknownShape
+		}
+		if x.width >= 0 && k > x.width {
+			c.report(n.Args[1].Pos(), "topk(%d) is more than a width-%d value has", k, x.width)
+		}
+		return widthShape(k)
+	case "quantile":
+		if x.width == 0 {
+			c.report(n.Args[0].Pos(), "quantile of an empty value")
+		}
+		if q := args[1]; q.constant && !(q.value >= 0 && q.value <= 1) {
+			c.report(n.Args[1].Pos(), "quantile's q must be between 0 and 1, got %v", q.value)
+		}
+		return widthShape(args[1].width)
+	}
+	if i, ok := c.count(n.Args[1], args[1], "gather's index"); ok && x.width >= 0 &&
+		(i < 0 || i >= x.width) {
+		c.report(n.Args[1].Pos(), "gather's index %d out of range for width %d", i, x.width)
+	}
+	return widthShape(args[1].width)
+}
+
+// orderCall records a call to one of exprOrderFunctions. Which elements they select is fixed
+// by the values, so a derivative flows through the elements selected, and an index is a
+// constant.
+func (d *ExpressionDerivative) orderCall(name string, args []int) int {
+	t := &d.tape
+	v := t.value(args[0])
+	switch name {
+	case "sort":
+		d.order = ascending(d.order, v)
+		return t.gather(args[0], d.order)
+	case "argsort", "rank":
+		d.order = ascending(d.order, v)
+		i := t.add(exprConstant)
+		out := t.own(i, len(v))
+		for j, m := range d.order {
+			if name == "argsort" {
+				out[j] = float64(m)
+			} else {
+				out[m] = float64(j)
+			}
+		}
+		return i
+	case "argmax":
+		return t.constant(float64(extreme(name, v, 1)))
+	case "argmin":
+		return t.constant(float64(extreme(name, v, -1)))
+	case "topk":
+		n := topkCount(t.value(args[1]), len(v))
+		d.order = descending(d.order, v)
+		return t.gather(args[0], d.order[:n])
+	case "cumsum":
+		return t.cumsum(args[0])
+	case "quantile":
+		// The quantile is lo + w * (hi - lo) for the order statistics either side of it, with
+		// w = (n - 1) * q - (lo's rank), which is linear in q between them.
+		qs := t.value(args[1])
+		d.order = ascending(d.order, v)
+		nan := len(v) > 0 && math.IsNaN(v[d.order[0]])
+		start := t.add(exprConstant)
+		ranks := t.own(start, len(qs))
+		picks := func(high bool) int {
+			d.picks = d.picks[:0]
+			for j, q := range qs {
+				lo, hi, _ := quantilePosition(len(v), q)
+				if nan {
+					lo, hi = 0, 0
+				}
+				ranks[j] = float64(lo)
+				if high {
+					lo = hi
+				}
+				d.picks = append(d.picks, d.order[lo])
+			}
+			return t.gather(args[0], d.picks)
+		}
+		los, his := picks(false), picks(true)
+		scale := float64(len(v) - 1)
+		return t.elementwise(len(qs),
+			func(x []float64) float64 {
+				return x[0] + (scale*x[2]-x[3])*(x[1]-x[0])
+			},
+			func(x []float64, _ float64, d []float64) {
+				w := scale*x[2] - x[3]
+				d[0], d[1], d[2], d[3] = 1-w, w, scale*(x[1]-x[0]), 0
+			},
+			los, his, args[1], start)
+	}
+	idx := t.value(args[1])
+	d.picks = d.picks[:0]
+	for j := range idx {
+		d.picks = append(d.picks, gatherIndex(idx, j, len(v)))
+	}
+	return t.gather(args[0], d.picks)
+}
@@ -0,0 +1,184 @@
+package general
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// orderIteration reads v, a 5-wide field, with one output as wide as output gives.
+func orderIteration(output string, width int) *ExpressionIteration {
+	return &ExpressionIteration{
+		Fields:  []ExpressionField{{Name: "v", Width: 5}, {Name: "out", Width: width}},
+		Outputs: []string{"v", output},
+	}
+}
+
+func TestExpressionOrderFunctions(t *testing.T) {
+	state := []float64{3, 1, 4, 1, 5}
+	nan := math.NaN()
+	for _, c := range []struct {
+		output string
+		want   []float64
+	}{
+		{"sort(v)", []float64{1, 1, 3, 4, 5}},
+		{"argsort(v)", []float64{1, 3, 0, 2, 4}},
+		{"rank(v)", []float64{2, 0, 3, 1, 4}},
+		{"argmax(v)", []float64{4}},
+		{"argmin(v)", []float64{1}},
+		{"argmax(concat(2, 7, 7))", []float64{1}},
+		{"topk(v, 3)", []float64{5, 4, 3}},
+		{"concat(topk(v, 0 * v[0]), 8)", []float64{8}},
+		{"cumsum(v)", []float64{3, 4, 8, 9, 14}},
+		{"quantile(v, 0.5)", []float64{3}},
+		{"quantile(v, concat(0, 0.25, 0.6, 1))", []float64{1, 1, 3.4, 5}},
+		{"quantile(7, 0.3)", []float64{7}},
+		{"gather(v, concat(4, 0, 0))", []float64{5, 3, 3}},
+		{"gather(v, argsort(v))", []float64{1, 1, 3, 4, 5}},
+		{"gather(v, argmax(v))", []float64{5}},
+		{"sort(concat(2, nan, 1))", []float64{nan, 1, 2}},
+		{"argmax(concat(nan, 1))", []float64{1}},
+		{"quantile(concat(2, nan, 1), 1)", []float64{nan}},
+	} {
+		t.Run(c.output, func(t *testing.T) {
+			e := orderIteration(c.output, len(c.want))
+			got := evalOnce(t, e, append(append([]float64(nil), state...),
+				make([]float64, len(c.want))...), map[string][]float64{"nan": {nan}})
+			assertValues(t, got[len(state):], c.want)
+		})
+	}
+}
+
+func TestExpressionOrderTiesAreStable(t *testing.T) {
+	// Equal values keep their order, so the indices of equal keys come out in index order
+	// however the sort partitions them.
+	v := make([]float64, 64)
+	for i := range v {
+		v[i] = float64(i % 3)
+	}
+	e := &ExpressionIteration{
+		Fields:  []ExpressionField{{Name: "v", Width: 64}, {Name: "order", Width: 64}},
+		Outputs: []string{"v", "argsort(v)"},
+	}
+	got := evalOnce(t, e, append(append([]float64(nil), v...), make([]float64, 64)...), nil)
+	order := got[64:]
+	for j := 1; j < len(order); j++ {
+		a, b := int(order[j-1]), int(order[j])
+		if v[a] > v[b] || (v[a] == v[b] && a > b) {
+			t.Fatalf("argsort is not stable at %d: %v", j, order)
+		}
+	}
+}
+
+func TestExpressionOrderAllocatesByPriority(t *testing.T) {
+	// supply goes to the most urgent demand first, then the next, until it runs out.
+	e := &ExpressionIteration{
+		Fields: []ExpressionField{{Name: "served", Width: 4}},
+		Bindings: []ExpressionBinding{
+			{Name: "order", Expr: "argsort(-urgency)"},
+			{Name: "filled", Expr: "clamp(supply - (cumsum(gather(demand, order)) - " +
+				"gather(demand, order)), 0, gather(demand, order))"},
+		},
+		Outputs: []string{"gather(filled, rank(-urgency))"},
+	}
+	got := evalOnce(t, e, make([]float64, 4), map[string][]float64{
+		"supply":  {10},
+		"demand":  {4, 5, 3, 6},
+		"urgency": {1, 3, 2, 3},
+	})
+	assertValues(t, got, []float64{0, 5, 0, 5})
+}
+
+func TestExpressionOrderErrors(t *testing.T) {
+	for _, c := range []struct {
+		output string
+		want   string
+	}{
+		{"topk(v, 6)", "topk(6) is more than a width-5 value has"},
+		{"topk(v, concat(1, 2))", "topk's k must be a scalar"},
+		{"gather(v, concat(0, 5))", "gather's index 5 out of range for width 5"},
+		{"quantile(v, 1.5)", "quantile's q must be between 0 and 1, got 1.5"},
+		{"argmax(slice(v, 0, 0))", "argmax of an empty value"},
+		{"quantile(slice(v, 0, 0), 0.5)", "quantile of an empty value"},
+	} {
+		t.Run(c.output, func(t *testing.T) {
+			defer func() {
+				if got := stringifyPanic(recover()); !strings.Contains(got, c.want) {
+					t.Errorf("got %q, want it to contain %q", got, c.want)
+				}
+			}()
+			evalOnce(t, orderIteration(c.output, 1), make([]float64, 6), nil)
+		})
+	}
+}
+
+func TestExpressionCheckKnowsOrderShapes(t *testing.T) {
+	for _, c := range []struct {
+		output string
+		width  int
+		want   string
+	}{
+		{"topk(v, 2)", 3, "produces width 2, want 3 or 1"},
+		{"topk(v, 6)", 6, "topk(6) is more than a width-5 value has"},
+		{"topk(v, v)", 3, "topk's k must be a scalar, got width 5"},
+		{"gather(v, 5)", 3, "gather's index 5 out of range for width 5"},
+		{"quantile(v, concat(0.1, 0.9))", 3, "produces width 2, want 3 or 1"},
+		{"quantile(v, -1)", 3, "quantile's q must be between 0 and 1, got -1"},
+		{"argmin(slice(v, 0, 0))", 3, "argmin of an empty value"},
+	} {
+		shapes := ExpressionShapes{StateWidth: 5 + c.width}
+		issues := orderIteration(c.output, c.width).Check(shapes)
+		if len(issues) != 1 || !strings.Contains(issues[0].Message, c.want) {
+			t.Errorf("%s: got %v, want one issue containing %q", c.output, issues, c.want)
+		}
+	}
+	for _, output := range []string{
+		"concat(topk(v, 2), argmax(v))",
+		"quantile(v, concat(0.1, 0.5, 0.9))",
+		"gather(sort(v), concat(0, 2, 4))",
+		"slice(cumsum(rank(v)), 0, 3)",
+	} {
+		shapes := ExpressionShapes{StateWidth: 8}
+		if issues := orderIteration(output, 3).Check(shapes); len(issues) != 0 {
+			t.Errorf("%s: unexpected issues %v", output, issues)
+		}
+	}
+}
+
+func TestExpressionOrderIsDifferentiable(t *testing.T) {
+	params := map[string][]float64{
+		"v": {0.3, -1.2, 2.5, 0.9, -0.4},
+		"q": {0.1, 0.55, 0.95},
+		"w": {1, 2, 3, 4, 5},
+	}
+	for _, expr := range []string{
+		"sort(v) * w",
+		"topk(v, 3)",
+		"cumsum(v * v)",
+		"quantile(v, q)",
+		"quantile(exp(v), q) * q",
+		"gather(v, concat(4, 0, 4))",
+		"sum(gather(v, argsort(v)) * w) + argmax(v)",
+		"v[argmin(v)] + sum(rank(v) * v)",
+	} {
+		d, err := NewExpressionDerivative(expr, nil, nil, nil, []string{"v", "q"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := simulator.NewParams(params)
+		d.SetParams(&p)
+		d.Evaluate()
+		reverse := append([]float64(nil), d.Jacobian(ExpressionReverseMode)...)
+		forward := append([]float64(nil), d.Jacobian(ExpressionForwardMode)...)
+		want := finiteDifferenceJacobian(d, params, []string{"v", "q"})
+		for i := range want {
+			if math.Abs(reverse[i]-want[i]) > 1e-5*(1+math.Abs(want[i])) ||
+				math.Abs(forward[i]-want[i]) > 1e-5*(1+math.Abs(want[i])) {
+				t.Errorf("%s, element %d: reverse %v, forward %v, finite differences give %v",
+					expr, i, reverse[i], forward[i], want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package general
+
+import (
+	"fmt"
+	"go/ast"
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/interp"
+)
+
+// Lookup tables are piecewise curves given by their knots — a tariff by hour, a rating curve,
+// a stage-discharge table — read off at a value rather than rewritten as a chain of wheres.
+// The knots are ordinary values, so they come from params, from upstreams, or from a
+// partition's Tables.
+//
+//   - interp(x, xs, ys) reads the curve through (xs[i], ys[i]) at each element of x, joining
+//     the knots with straight lines. interp(x, xs, ys, step) instead holds ys[i] from xs[i]
+//     up to the next knot, as a tariff does, and interp(x, xs, ys, cubic) joins them with a
+//     monotone cubic (Fritsch-Butland, as gonum fits it), which is smooth and, unlike a
+//     natural spline, never overshoots the knots, so a rising rating curve stays rising.
+//   - bin_index(x, edges) is the index i of the bin [edges[i], edges[i+1]) each element of x
+//     falls in, with the last bin closed, for indexing a per-bin param.
+//   - interp2(x, y, xs, ys, zs) reads a surface off a grid bilinearly, with zs holding
+//     z(xs[i], ys[j]) row-major at zs[i*width(ys)+j].
+//
+// Knots must be strictly increasing, and there must be at least 2 of them. Outside the table
+// its end values hold, so interp gives ys[0] below xs[0] and bin_index gives the first or last
+// bin: a curve measured over a range says nothing past it, and holding is the reading that
+// cannot run away. A derivative is taken with respect to x and y only, since a table is data.
+
+// exprInterpMode is how interp joins its knots.
+type exprInterpMode int
+
+const (
+	exprInterpLinear exprInterpMode = iota
+	exprInterpStep
+	exprInterpCubic
+)
+
+// exprTableFunctions are the functions that read lookup tables. interp is not in exprArity,
+// because its mode is optional.
+var exprTableFunctions = map[string]bool{"interp": true, "bin_index": true, "interp2": true}
+
+// interpMode reads interp's optional fourth argument, a bare linear, step or cubic.
+func interpMode(n *ast.CallExpr) (exprInterpMode, error) {
+	if len(n.Args) != 3 && len(n.Args) != 4 {
+		return 0, fmt.Errorf("interp takes 3 arguments, or 4 with a mode, got %d", len(n.Args))
+	}
+	if len(n.Args) == 3 {
+		return exprInterpLinear, nil
+	}
+	if mode, ok := n.Args[3].(*ast.Ident); ok {
+		switch mode.Name {
+		case "linear":
+			return exprInterpLinear, nil
+		case "step":
+			return exprInterpStep, nil
+		case "cubic":
+			return exprInterpCubic, nil
+		}
+	}
+	return 0, fmt.Errorf("interp's mode must be linear, step or cubic")
+}
+
+// checkKnots panics unless knots, what of name, are at least 2 and strictly increasing.
+func checkKnots(name, what string, knots exprValue) {
+	if len(knots) < 2 {
+		panic(fmt.Sprintf("expression: %s's %s needs at least 2 knots, got %d",
+			name, what, len(knots)))
+	}
+	for i := 1; i < len(knots); i++ {
+		if !(knots[i] > knots[i-1]) {
+			panic(fmt.Sprintf("expression: %s's %s must be strictly increasing, but element "+
+				"%d is %v after %v", name, what, i, knots[i], knots[i-1]))
+		}
+	}
+}
+
+// knotSegment is where x falls among knots: the index i of the segment [knots[i],
+// knots[i+1]) holding it, the fraction u of the way along it, and du/dx. Outside the knots it
+// is the end segment, with u held at 0 or 1 and du/dx 0.
+func knotSegment(knots exprValue, x float64) (int, float64, float64) {
+	n := len(knots)
+	switch {
+	case x <= knots[0]:
+		return 0, 0, 0
+	case x >= knots[n-1]:
+		return n - 2, 1, 0
+	}
+	i := sort.SearchFloat64s(knots, x)
+	if knots[i] != x {
+		i--
+	}
+	h := knots[i+1] - knots[i]
+	return i, (x - knots[i]) / h, 1 / h
+}
+
+// exprTable is one interp call site's curve, kept so that a cubic is fitted again only when
+// its knots change.
+type exprTable struct {
+	mode   exprInterpMode
+	xs, ys exprValue
+	cubic  interp.FritschButland
+	fitted bool
+}
+
+// set makes the curve through xs and ys current.
+func (t *exprTable) set(xs, ys exprValue) {
+	checkKnots("interp", "xs", xs)
+	if len(ys) != len(xs) {
+		panic(fmt.Sprintf("expression: interp's xs has width %d but its ys has width %d",
+			len(xs), len(ys)))
+	}
+	if t.mode != exprInterpCubic {
+		t.xs, t.ys = xs, ys
+		return
+	}
+	if t.fitted && equalValues(t.xs, xs) && equalValues(t.ys, ys) {
+		return
+	}
+	t.xs = append(t.xs[:0], xs...)
+	t.ys = append(t.ys[:0], ys...)
+	t.cubic.Fit(t.xs, t.ys)
+	t.fitted = true
+}
+
+// at is the curve's value at x, and its derivative there.
+func (t *exprTable) at(x float64) (float64, float64) {
+	if math.IsNaN(x) {
+		return x, x
+	}
+	i, u, du := knotSegment(t.xs, x)
+	switch {
+	case du == 0:
+		return t.ys[i+int(u)], 0
+	case t.mode == exprInterpStep:
+		return t.ys[i], 0
+	case t.mode == exprInterpCubic:
+		return t.cubic.Predict(x), t.cubic.PredictDerivative(x)
+	}
+	slope := t.ys[i+1] - t.ys[i]
+	return t.ys[i] + u*slope, slope * du
+}
+
+func equalValues(a, b exprValue) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// binIndex is the bin of edges x falls in.
+func binIndex(edges exprValue, x float64) float64 {
+	if math.IsNaN(x) {
+		return x
+	}
+	i, _, _ := knotSegment(edges, x)
+	return float64(i)
+}
+
+// checkGrid panics unless xs and ys are knots and zs has a value at each pair of them.
+func checkGrid(xs, ys, zs exprValue) {
+	checkKnots("interp2", "xs", xs)
+	checkKnots("interp2", "ys", ys)
+	if len(zs) != len(xs)*len(ys) {
+		panic(fmt.Sprintf("expression: interp2's zs has width %d, want %d x %d", len(zs),
+			len(xs), len(ys)))
+	}
+}
+
+// bilinear is the surface zs over xs and ys at (x, y), and its derivatives there.
+func bilinear(xs, ys, zs exprValue, x, y float64) (float64, float64, float64) {
+	if math.IsNaN(x) || math.IsNaN(y) {
+		return math.NaN(), math.NaN(), math.NaN()
+	}
+	i, u, du := knotSegment(xs, x)
+	j, v, dv := knotSegment(ys, y)
+	m := len(ys)
+	z00, z01 := zs[i*m+j], zs[i*m+j+1]
+	z10, z11 := zs[(i+1)*m+j], zs[(i+1)*m+j+1]
+	z := (1-u)*(1-v)*z00 + (1-u)*v*z01 + u*(1-v)*z10 + u*v*z11
+	dzdu := (1-v)*(z10-z00) + v*(z11-z01)
+	dzdv := (1-u)*(z01-z00) + u*(z11-z10)
+	return z, dzdu * du, dzdv * dv
+}
+
+// table compiles a call to one of exprTableFunctions.
+func (c *exprCompiler) table(name string, n *ast.CallExpr) exprCode {
+	var buffer exprValue
+	switch name {
+	case "interp":
+		mode, err := interpMode(n)
+		if err != nil {
+			return fail("expression: " + err.Error())
+		}
+		x, xs, ys := c.compile(n.Args[0]), c.compile(n.Args[1]), c.compile(n.Args[2])
+		curve := &exprTable{mode: mode}
+		return func() exprValue {
+			v := x()
+			curve.set(xs(), ys())
+			out := take(&buffer, len(v))
+			for i, e := range v {
+				out[i], _ = curve.at(e)
+			}
+			return out
+		}
+	case "bin_index":
+		x, edges := c.compile(n.Args[0]), c.compile(n.Args[1])
+		return func() exprValue {
+			v, e := x(), edges()
+			checkKnots(name, "edges", e)
+			out := take(&buffer, len(v))
+			for i, value := range v {
+				out[i] = binIndex(e, value)
+			}
+			return out
+		}
+	}
+	x, y := c.compile(n.Args[0]), c.compile(n.Args[1])
+	xs, ys, zs := c.compile(n.Args[2]), c.compile(n.Args[3]), c.compile(n.Args[4])
+	return func() exprValue {
+		a, b := x(), y()
+		gx, gy, gz := xs(), ys(), zs()
+		checkGrid(gx, gy, gz)
+		out := take(&buffer, broadcastLen(a, b, name))
+		for i := range out {
+			out[i], _, _ = bilinear(gx, gy, gz, at(a, i), at(b, i))
+		}
+		return out
+	}
+}
+
+// table checks a call to one of exprTableFunctions.
+func (c *exprChecker) table(name string, n *ast.CallExpr) exprShape {
+	knots := func(i int, what string) exprShape {
+		shape := c.check(n.Args[i])
+		if shape.width >= 0 && shape.width < 2 {
+			c.report(n.Args[i].Pos(), "%s's %s needs at least 2 knots, got %d",
+				name, what, shape.width)
+		}
+		return shape
+	}
+	switch name {
+	case "interp":
+		if _, err := interpMode(n); err != nil {
+			pos := n.Pos()
+			if len(n.Args) == 4 {
+				pos = n.Args[3].Pos()
+			}
+			c.report(pos, "%s", err.Error())
+			return unknownShape
+		}
+		x := c.check(n.Args[0])
+		xs, ys := knots(1, "xs"), c.check(n.Args[2])
+		if xs.width >= 0 && ys.width >= 0 && xs.width != ys.width {
+			c.report(n.Args[2].Pos(), "interp's xs has width %d but its ys has width %d",
+				xs.width, ys.width)
+		}
+		return widthShape(x.width)
+	case "bin_index":
+		x := c.check(n.Args[0])
+		knots(1, "edges")
+		return widthShape(x.width)
+	}
+	x, y := c.check(n.Args[0]), c.check(n.Args[1])
+	xs, ys, zs := knots(2, "xs"), knots(3, "ys"), c.check(n.Args[4])
+	if xs.width >= 0 && ys.width >= 0 && zs.width >= 0 && zs.width != xs.width*ys.width {
+		c.report(n.Args[4].Pos(), "interp2's zs has width %d, want %d x %d",
+			zs.width, xs.width, ys.width)
+	}
+	return widthShape(c.broadcast(n.Pos(), name, x.width, y.width))
+}
+
+// tableCall records a call to one of exprTableFunctions, whose tables must be constants.
+func (d *ExpressionDerivative) tableCall(name string, n *ast.CallExpr) int {
+	t := &d.tape
+	constant := func(i int) exprValue {
+		node := d.record(n.Args[i])
+		if t.nodes[node].active {
+			panic("expression: " + name + " can be differentiated with respect to where it " +
+				"is read, but not its table")
+		}
+		return t.value(node)
+	}
+	switch name {
+	case "interp":
+		mode, err := interpMode(n)
+		if err != nil {
+			panic("expression: " + err.Error())
+		}
+		x := d.record(n.Args[0])
+		curve, ok := d.tables[n]
+		if !ok {
+			curve = &exprTable{mode: mode}
+			d.tables[n] = curve
+		}
+		curve.set(constant(1), constant(2))
+		return t.elementwise(len(t.value(x)),
+			func(x []float64) float64 {
+				y, _ := curve.at(x[0])
+				return y
+			},
+			func(x []float64, _ float64, d []float64) { _, d[0] = curve.at(x[0]) },
+			x)
+	case "bin_index":
+		x := d.record(n.Args[0])
+		edges := constant(1)
+		checkKnots(name, "edges", edges)
+		return d.constantMap(x, func(v float64) float64 { return binIndex(edges, v) })
+	}
+	x, y := d.record(n.Args[0]), d.record(n.Args[1])
+	xs, ys, zs := constant(2), constant(3), constant(4)
+	checkGrid(xs, ys, zs)
+	return t.elementwise(t.broadcast(name, x, y),
+		func(x []float64) float64 {
+			z, _, _ := bilinear(xs, ys, zs, x[0], x[1])
+			return z
+		},
+		func(x []float64, _ float64, d []float64) {
+			_, d[0], d[1] = bilinear(xs, ys, zs, x[0], x[1])
+		},
+		x, y)
+}
@@ -0,0 +1,185 @@
+package general
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+	"gonum.org/v1/gonum/interp"
+)
+
+// tableIteration reads x, a 5-wide field, off the curve through hours and prices, which are
+// given inline as tables.
+func tableIteration(output string) *ExpressionIteration {
+	return &ExpressionIteration{
+		Fields: []ExpressionField{{Name: "x", Width: 5}},
+		Tables: map[string][]float64{
+			"hours":  {0, 7, 16, 19, 24},
+			"prices": {10, 20, 35, 20, 10},
+		},
+		Outputs: []string{output},
+	}
+}
+
+func TestExpressionTableFunctions(t *testing.T) {
+	state := []float64{-1, 3.5, 16, 17.5, 30}
+	for _, c := range []struct {
+		name   string
+		output string
+		params map[string][]float64
+		want   []float64
+	}{
+		{"linear, holding the ends", "interp(x, hours, prices)", nil,
+			[]float64{10, 15, 35, 27.5, 10}},
+		{"linear by name", "interp(x, hours, prices, linear)", nil,
+			[]float64{10, 15, 35, 27.5, 10}},
+		{"step", "interp(x, hours, prices, step)", nil, []float64{10, 10, 35, 35, 10}},
+		{"a param overrides a table", "interp(x, hours, prices, step)",
+			map[string][]float64{"prices": {1, 2, 3, 4, 5}}, []float64{1, 1, 3, 3, 5}},
+		{"bin_index", "bin_index(x, hours)", nil, []float64{0, 0, 2, 2, 3}},
+		{"bin_index indexes a per-bin param",
+			"each(5, i, rates[bin_index(x[i], hours)])",
+			map[string][]float64{"rates": {1, 2, 3, 4}}, []float64{1, 1, 3, 3, 4}},
+		{"interp2 on the grid's corners and between them",
+			"interp2(x, 0.5, concat(-1, 30), concat(0, 1), concat(0, 10, 310, 320))", nil,
+			[]float64{5, 50, 175, 190, 315}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			assertValues(t, evalOnce(t, tableIteration(c.output), state, c.params), c.want)
+		})
+	}
+}
+
+func TestExpressionInterpCubicMatchesGonum(t *testing.T) {
+	xs, ys := []float64{0, 1, 2.5, 4, 6}, []float64{0, 0.5, 3, 3.2, 7}
+	e := &ExpressionIteration{
+		Fields:  []ExpressionField{{Name: "x", Width: 6}},
+		Outputs: []string{"interp(x, xs, ys, cubic)"},
+	}
+	state := []float64{-2, 0.3, 1, 2.9, 5.5, 9}
+	got := evalOnce(t, e, state, map[string][]float64{"xs": xs, "ys": ys})
+	var fb interp.FritschButland
+	if err := fb.Fit(xs, ys); err != nil {
+		t.Fatal(err)
+	}
+	for i, x := range state {
+		want := fb.Predict(min(max(x, xs[0]), xs[len(xs)-1]))
+		if math.Abs(got[i]-want) > 1e-12 {
+			t.Errorf("x = %v: got %v, want %v", x, got[i], want)
+		}
+	}
+	// Monotone knots give a monotone curve.
+	for i := 1; i < len(got); i++ {
+		if got[i] < got[i-1] {
+			t.Errorf("the curve falls from %v to %v", got[i-1], got[i])
+		}
+	}
+}
+
+func TestExpressionTableErrors(t *testing.T) {
+	state := []float64{0, 0, 0, 0, 0}
+	for _, c := range []struct {
+		name   string
+		output string
+		params map[string][]float64
+		want   string
+	}{
+		{"knots out of order", "interp(x, xs, prices)",
+			map[string][]float64{"xs": {0, 7, 7, 19, 24}},
+			"interp's xs must be strictly increasing, but element 2 is 7 after 7"},
+		{"too few knots", "interp(x, 1, 2)", nil, "interp's xs needs at least 2 knots, got 1"},
+		{"mismatched knots", "interp(x, hours, slice(prices, 0, 4))", nil,
+			"interp's xs has width 5 but its ys has width 4"},
+		{"an unknown mode", "interp(x, hours, prices, quadratic)", nil,
+			"interp's mode must be linear, step or cubic"},
+		{"a missing argument", "interp(x, hours)", nil,
+			"interp takes 3 arguments, or 4 with a mode, got 2"},
+		{"unordered edges", "bin_index(x, concat(1, 0))", nil,
+			"bin_index's edges must be strictly increasing"},
+		{"a grid of the wrong width", "interp2(x, x, hours, hours, prices)", nil,
+			"interp2's zs has width 5, want 5 x 5"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			defer func() {
+				if got := stringifyPanic(recover()); !strings.Contains(got, c.want) {
+					t.Errorf("got %q, want it to contain %q", got, c.want)
+				}
+			}()
+			evalOnce(t, tableIteration(c.output), state, c.params)
+		})
+	}
+}
+
+func TestExpressionCheckKnowsTables(t *testing.T) {
+	shapes := ExpressionShapes{StateWidth: 5, Params: map[string]int{"short": 1}}
+	for _, c := range []struct {
+		output string
+		want   string
+	}{
+		{"interp(x, short, short)", "interp's xs needs at least 2 knots, got 1"},
+		{"interp(x, hours, slice(prices, 0, 4))",
+			"interp's xs has width 5 but its ys has width 4"},
+		{"interp(x, hours, prices, quadratic)", "interp's mode must be linear, step or cubic"},
+		{"bin_index(x, short)", "bin_index's edges needs at least 2 knots, got 1"},
+		{"interp2(x, x, hours, hours, prices)", "interp2's zs has width 5, want 5 x 5"},
+		{"concat(interp(x, hours, prices), 0)", "produces width 6, want 5 or 1"},
+	} {
+		issues := tableIteration(c.output).Check(shapes)
+		if len(issues) != 1 || !strings.Contains(issues[0].Message, c.want) {
+			t.Errorf("%s: got %v, want one issue containing %q", c.output, issues, c.want)
+		}
+	}
+	for _, output := range []string{
+		"interp(x, hours, prices, cubic)",
+		"bin_index(x, hours)",
+		"interp2(x, 1, hours, concat(0, 1), fill(10, 1))",
+	} {
+		if issues := tableIteration(output).Check(shapes); len(issues) != 0 {
+			t.Errorf("%s: unexpected issues %v", output, issues)
+		}
+	}
+}
+
+func TestExpressionTablesAreDifferentiable(t *testing.T) {
+	params := map[string][]float64{
+		"x":      {-1, 3.5, 17.5, 30},
+		"y":      {0.25},
+		"hours":  {0, 7, 16, 19, 24},
+		"prices": {10, 20, 35, 20, 10},
+	}
+	for _, expr := range []string{
+		"interp(x, hours, prices)",
+		"interp(x, hours, prices, cubic)",
+		"interp(x, hours, prices, step) + bin_index(x, hours)",
+		"interp2(x, y, hours, concat(0, 1), concat(prices, 2 * prices))",
+	} {
+		d, err := NewExpressionDerivative(expr, nil, nil, nil, []string{"x", "y"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := simulator.NewParams(params)
+		d.SetParams(&p)
+		d.Evaluate()
+		got := append([]float64(nil), d.Jacobian(ExpressionReverseMode)...)
+		want := finiteDifferenceJacobian(d, params, []string{"x", "y"})
+		for i := range want {
+			if math.Abs(got[i]-want[i]) > 1e-5*(1+math.Abs(want[i])) {
+				t.Errorf("%s, element %d: got %v, finite differences give %v",
+					expr, i, got[i], want[i])
+			}
+		}
+	}
+	d, err := NewExpressionDerivative("interp(1, xs, ys)", nil, nil, nil, []string{"ys"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Set("xs", []float64{0, 2})
+	d.Set("ys", []float64{0, 2})
+	defer func() {
+		if got := stringifyPanic(recover()); !strings.Contains(got, "not its table") {
+			t.Errorf("got %q, want a panic about the table", got)
+		}
+	}()
+	d.Evaluate()
+}
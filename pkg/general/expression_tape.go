@@ -0,0 +1,368 @@
+package general
+
+import (
+	"fmt"
+)
+
+// exprTape is a record of one evaluation of an expression, kept so that it can be swept for
+// derivatives: forwards from the inputs, carrying tangents, or backwards from the value,
+// carrying adjoints. A node is active if it depends on an input at all, and an inactive node is
+// a constant to both sweeps, so the parts of an expression that read only data cost nothing
+// to differentiate.
+//
+// The tape is recorded afresh each evaluation rather than compiled once, because which way a
+// scalar where goes, or how many lanes an each runs, can change from one evaluation to the
+// next. It is recorded into the nodes the previous evaluation left, so an evaluation that
+// takes the same path as the last reuses their buffers.
+type exprTape struct {
+	nodes []exprNode
+	n     int
+}
+
+type exprNodeOp int
+
+const (
+	exprConstant exprNodeOp = iota
+	exprInput
+	exprElementwise
+	exprScalar
+	exprSlice
+	exprConcat
+	exprSum
+	exprGather
+	exprCumsum
+	exprMatmul
+	exprTranspose
+	exprOuter
+	exprDiagonal
+	exprDiagonalOf
+	exprInverse
+	exprSolve
+)
+
+// exprNode is one recorded operation. value is what it gave: buffer, or a value it was handed,
+// which it never writes through. rows is its row count when it is a matrix, and 0 otherwise.
+//
+// An elementwise node keeps the partial derivative of element j with respect to args[i] at
+// partials[j*len(args)+i]. A scalar node keeps its gradient with respect to each argument in
+// turn, each as wide as the argument. Both are taken when the node is recorded, and only if it
+// is active. offset is where a slice starts, indices which elements a gather reads, and dims a
+// matrix operation's rows and columns of its first argument and columns of its second.
+type exprNode struct {
+	op       exprNodeOp
+	args     []int
+	active   bool
+	value    exprValue
+	buffer   exprValue
+	rows     int
+	offset   int
+	indices  []int
+	dims     [3]int
+	partials exprValue
+	dot      exprValue
+	bar      exprValue
+	solver   exprSolver
+}
+
+// add records a node of op reading args, reusing the node the last recording left in its
+// place, and returns its index.
+func (t *exprTape) add(op exprNodeOp, args ...int) int {
+	if t.n == len(t.nodes) {
+		t.nodes = append(t.nodes, exprNode{})
+	}
+	i := t.n
+	t.n++
+	node := &t.nodes[i]
+	node.op, node.rows, node.offset = op, 0, 0
+	node.args = append(node.args[:0], args...)
+	node.active = op == exprInput
+	for _, a := range args {
+		node.active = node.active || t.nodes[a].active
+	}
+	return i
+}
+
+// own gives node i a value of width n in its own buffer.
+func (t *exprTape) own(i, n int) exprValue {
+	node := &t.nodes[i]
+	node.value = take(&node.buffer, n)
+	return node.value
+}
+
+// constant records a value that no input reaches.
+func (t *exprTape) constant(v float64) int {
+	i := t.add(exprConstant)
+	t.own(i, 1)[0] = v
+	return i
+}
+
+// borrowed records a value the tape is handed, such as a param, without copying it.
+func (t *exprTape) borrowed(op exprNodeOp, v exprValue) int {
+	i := t.add(op)
+	t.nodes[i].value = v
+	return i
+}
+
+func (t *exprTape) value(i int) exprValue {
+	return t.nodes[i].value
+}
+
+// elementwise records f of each element of args, broadcast to width, with partials giving f's
+// derivatives with respect to its arguments at that element, given f's value there.
+func (t *exprTape) elementwise(
+	width int,
+	f func(x []float64) float64,
+	partials func(x []float64, y float64, d []float64),
+	args ...int,
+) int {
+	var x [5]float64
+	i := t.add(exprElementwise, args...)
+	k := len(args)
+	out := t.own(i, width)
+	node := &t.nodes[i]
+	if node.active {
+		node.partials = take(&node.partials, width*k)
+	}
+	for j := range out {
+		for a, arg := range args {
+			x[a] = at(t.nodes[arg].value, j)
+		}
+		out[j] = f(x[:k])
+		if node.active {
+			partials(x[:k], out[j], node.partials[j*k:(j+1)*k])
+		}
+	}
+	return i
+}
+
+// broadcast is the width args combine to elementwise.
+func (t *exprTape) broadcast(what string, args ...int) int {
+	width := 1
+	for _, a := range args {
+		width = broadcastWidth(width, len(t.nodes[a].value), what)
+	}
+	return width
+}
+
+// slice records elements [from, from+width) of x.
+func (t *exprTape) slice(x, from, width int) int {
+	i := t.add(exprSlice, x)
+	copy(t.own(i, width), t.nodes[x].value[from:from+width])
+	t.nodes[i].offset = from
+	return i
+}
+
+// gather records the elements of x at indices, in that order.
+func (t *exprTape) gather(x int, indices []int) int {
+	i := t.add(exprGather, x)
+	node := &t.nodes[i]
+	node.indices = append(node.indices[:0], indices...)
+	out, v := t.own(i, len(indices)), t.value(x)
+	for j, m := range indices {
+		out[j] = v[m]
+	}
+	return i
+}
+
+// cumsum records the running total of x.
+func (t *exprTape) cumsum(x int) int {
+	i := t.add(exprCumsum, x)
+	out, total := t.own(i, len(t.value(x))), 0.0
+	for j, v := range t.value(x) {
+		total += v
+		out[j] = total
+	}
+	return i
+}
+
+// zero clears the tangents or adjoints of every active node.
+func (t *exprTape) zero(adjoint bool) {
+	for i := 0; i < t.n; i++ {
+		node := &t.nodes[i]
+		if !node.active {
+			continue
+		}
+		if adjoint {
+			node.bar = take(&node.bar, len(node.value))
+			clear(node.bar)
+		} else if node.op != exprInput {
+			node.dot = take(&node.dot, len(node.value))
+			clear(node.dot)
+		}
+	}
+}
+
+// forward sweeps tangents from the inputs, whose dot the caller has set, to every active node.
+func (t *exprTape) forward() {
+	t.zero(false)
+	for i := 0; i < t.n; i++ {
+		node := &t.nodes[i]
+		if !node.active || node.op == exprInput {
+			continue
+		}
+		t.forwardNode(node)
+	}
+}
+
+// reverse sweeps adjoints back from node out, whose bar the caller has set after zero, to
+// every active node it depends on.
+func (t *exprTape) reverse(out int) {
+	for i := out; i >= 0; i-- {
+		node := &t.nodes[i]
+		if node.active && node.op != exprInput {
+			t.reverseNode(node)
+		}
+	}
+}
+
+// arg is argument a of node, and whether it carries a derivative.
+func (t *exprTape) arg(node *exprNode, a int) (*exprNode, bool) {
+	arg := &t.nodes[node.args[a]]
+	return arg, arg.active
+}
+
+func (t *exprTape) forwardNode(node *exprNode) {
+	dot := node.dot
+	switch node.op {
+	case exprElementwise:
+		k := len(node.args)
+		for a := range node.args {
+			arg, ok := t.arg(node, a)
+			if !ok {
+				continue
+			}
+			for j := range dot {
+				// A zero tangent contributes nothing, even through an infinite partial.
+				if d := at(arg.dot, j); d != 0 {
+					dot[j] += node.partials[j*k+a] * d
+				}
+			}
+		}
+	case exprScalar:
+		offset := 0
+		for a := range node.args {
+			arg, ok := t.arg(node, a)
+			if ok {
+				for m, d := range arg.dot {
+					if d != 0 {
+						dot[0] += node.partials[offset+m] * d
+					}
+				}
+			}
+			offset += len(arg.value)
+		}
+	case exprSlice:
+		arg, _ := t.arg(node, 0)
+		copy(dot, arg.dot[node.offset:node.offset+len(dot)])
+	case exprConcat:
+		offset := 0
+		for a := range node.args {
+			arg, ok := t.arg(node, a)
+			if ok {
+				copy(dot[offset:], arg.dot)
+			}
+			offset += len(arg.value)
+		}
+	case exprSum:
+		arg, _ := t.arg(node, 0)
+		for _, d := range arg.dot {
+			dot[0] += d
+		}
+	case exprGather:
+		arg, _ := t.arg(node, 0)
+		for j, m := range node.indices {
+			dot[j] = arg.dot[m]
+		}
+	case exprCumsum:
+		arg, _ := t.arg(node, 0)
+		total := 0.0
+		for j, d := range arg.dot {
+			total += d
+			dot[j] = total
+		}
+	default:
+		t.forwardMatrix(node)
+	}
+}
+
+func (t *exprTape) reverseNode(node *exprNode) {
+	bar := node.bar
+	switch node.op {
+	case exprElementwise:
+		k := len(node.args)
+		for a := range node.args {
+			arg, ok := t.arg(node, a)
+			if !ok {
+				continue
+			}
+			broadcast := len(arg.bar) == 1
+			for j, b := range bar {
+				// As forwards: a zero adjoint contributes nothing.
+				if b == 0 {
+					continue
+				}
+				if broadcast {
+					arg.bar[0] += node.partials[j*k+a] * b
+				} else {
+					arg.bar[j] += node.partials[j*k+a] * b
+				}
+			}
+		}
+	case exprScalar:
+		if bar[0] == 0 {
+			return
+		}
+		offset := 0
+		for a := range node.args {
+			arg, ok := t.arg(node, a)
+			if ok {
+				for m := range arg.bar {
+					arg.bar[m] += node.partials[offset+m] * bar[0]
+				}
+			}
+			offset += len(arg.value)
+		}
+	case exprSlice:
+		arg, _ := t.arg(node, 0)
+		for m, b := range bar {
+			arg.bar[node.offset+m] += b
+		}
+	case exprConcat:
+		offset := 0
+		for a := range node.args {
+			arg, ok := t.arg(node, a)
+			if ok {
+				for m := range arg.bar {
+					arg.bar[m] += bar[offset+m]
+				}
+			}
+			offset += len(arg.value)
+		}
+	case exprSum:
+		arg, _ := t.arg(node, 0)
+		for m := range arg.bar {
+			arg.bar[m] += bar[0]
+		}
+	case exprGather:
+		arg, _ := t.arg(node, 0)
+		for j, m := range node.indices {
+			arg.bar[m] += bar[j]
+		}
+	case exprCumsum:
+		arg, _ := t.arg(node, 0)
+		total := 0.0
+		for m := len(bar) - 1; m >= 0; m-- {
+			total += bar[m]
+			arg.bar[m] += total
+		}
+	default:
+		t.reverseMatrix(node)
+	}
+}
+
+// checkWidth panics unless what, a direction or a cotangent, has the width it must.
+func checkWidth(what string, got, want int) {
+	if got != want {
+		panic(fmt.Sprintf("expression: %s has width %d, want %d", what, got, want))
+	}
+}
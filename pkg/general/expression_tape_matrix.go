@@ -0,0 +1,335 @@
+package general
+
+import (
+	"fmt"
+
+	"gonum.org/v1/gonum/blas/blas64"
+	"gonum.org/v1/gonum/mat"
+)
+
+// exprSolver is what a solve, an inverse or a multivariate normal's log-density keeps from
+// being recorded to being swept: its factorisation, and room to work in.
+type exprSolver struct {
+	lu         mat.LU
+	covariance exprCovariance
+	work       exprValue
+	dst, src   mat.Dense
+}
+
+// dense points m at data as a row-major rows x cols matrix, without copying it.
+func dense(m *mat.Dense, rows, cols int, data []float64) *mat.Dense {
+	m.SetRawMatrix(blas64.General{Rows: rows, Cols: cols, Stride: cols, Data: data})
+	return m
+}
+
+// The matrix functions' derivatives, written out as loops: the matrices an expression holds
+// are small, and the loops say which products are meant more plainly than the calls would.
+//
+//   - matmul: d(AB) = dA B + A dB, and backwards Ā += C̄ Bᵀ, B̄ += Aᵀ C̄.
+//   - inv: d(A⁻¹) = -A⁻¹ dA A⁻¹, and backwards Ā -= A⁻ᵀ Ȳ A⁻ᵀ.
+//   - solve: with X = A⁻¹B, dX = A⁻¹(dB - dA X), and backwards B̄ += A⁻ᵀ X̄, Ā -= B̄ Xᵀ.
+//
+// transpose, outer and both diags only move or multiply elements, and their derivatives do
+// the same.
+
+func (t *exprTape) forwardMatrix(node *exprNode) {
+	dot := node.dot
+	a, aActive := t.arg(node, 0)
+	switch node.op {
+	case exprMatmul:
+		b, bActive := t.arg(node, 1)
+		ar, ac, bc := node.dims[0], node.dims[1], node.dims[2]
+		for i := 0; i < ar; i++ {
+			for j := 0; j < ac; j++ {
+				for k := 0; k < bc; k++ {
+					if aActive {
+						dot[i*bc+k] += a.dot[i*ac+j] * b.value[j*bc+k]
+					}
+					if bActive {
+						dot[i*bc+k] += a.value[i*ac+j] * b.dot[j*bc+k]
+					}
+				}
+			}
+		}
+	case exprTranspose:
+		ar, ac := node.dims[0], node.dims[1]
+		for i := 0; i < ar; i++ {
+			for j := 0; j < ac; j++ {
+				dot[j*ar+i] = a.dot[i*ac+j]
+			}
+		}
+	case exprOuter:
+		b, bActive := t.arg(node, 1)
+		nb := len(b.value)
+		for i := range a.value {
+			for j := 0; j < nb; j++ {
+				if aActive {
+					dot[i*nb+j] += a.dot[i] * b.value[j]
+				}
+				if bActive {
+					dot[i*nb+j] += a.value[i] * b.dot[j]
+				}
+			}
+		}
+	case exprDiagonal:
+		n := len(a.value)
+		for i := 0; i < n; i++ {
+			dot[i*n+i] = a.dot[i]
+		}
+	case exprDiagonalOf:
+		ac := node.dims[1]
+		for i := range dot {
+			dot[i] = a.dot[i*ac+i]
+		}
+	case exprInverse:
+		n, y := node.dims[0], node.value
+		work := take(&node.solver.work, n*n)
+		clear(work)
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				for k := 0; k < n; k++ {
+					work[i*n+k] += a.dot[i*n+j] * y[j*n+k]
+				}
+			}
+		}
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				for k := 0; k < n; k++ {
+					dot[i*n+k] -= y[i*n+j] * work[j*n+k]
+				}
+			}
+		}
+	case exprSolve:
+		b, bActive := t.arg(node, 1)
+		n, m, x := node.dims[0], node.dims[2], node.value
+		work := take(&node.solver.work, n*m)
+		clear(work)
+		if bActive {
+			copy(work, b.dot)
+		}
+		if aActive {
+			for i := 0; i < n; i++ {
+				for j := 0; j < n; j++ {
+					for k := 0; k < m; k++ {
+						work[i*m+k] -= a.dot[i*n+j] * x[j*m+k]
+					}
+				}
+			}
+		}
+		s := &node.solver
+		singular("solve", s.lu.SolveTo(dense(&s.dst, n, m, dot), false, dense(&s.src, n, m, work)))
+	}
+}
+
+func (t *exprTape) reverseMatrix(node *exprNode) {
+	bar := node.bar
+	a, aActive := t.arg(node, 0)
+	switch node.op {
+	case exprMatmul:
+		b, bActive := t.arg(node, 1)
+		ar, ac, bc := node.dims[0], node.dims[1], node.dims[2]
+		for i := 0; i < ar; i++ {
+			for j := 0; j < ac; j++ {
+				for k := 0; k < bc; k++ {
+					if aActive {
+						a.bar[i*ac+j] += bar[i*bc+k] * b.value[j*bc+k]
+					}
+					if bActive {
+						b.bar[j*bc+k] += a.value[i*ac+j] * bar[i*bc+k]
+					}
+				}
+			}
+		}
+	case exprTranspose:
+		ar, ac := node.dims[0], node.dims[1]
+		for i := 0; i < ar; i++ {
+			for j := 0; j < ac; j++ {
+				a.bar[i*ac+j] += bar[j*ar+i]
+			}
+		}
+	case exprOuter:
+		b, bActive := t.arg(node, 1)
+		nb := len(b.value)
+		for i := range a.value {
+			for j := 0; j < nb; j++ {
+				if aActive {
+					a.bar[i] += bar[i*nb+j] * b.value[j]
+				}
+				if bActive {
+					b.bar[j] += bar[i*nb+j] * a.value[i]
+				}
+			}
+		}
+	case exprDiagonal:
+		n := len(a.value)
+		for i := 0; i < n; i++ {
+			a.bar[i] += bar[i*n+i]
+		}
+	case exprDiagonalOf:
+		ac := node.dims[1]
+		for i, b := range bar {
+			a.bar[i*ac+i] += b
+		}
+	case exprInverse:
+		n, y := node.dims[0], node.value
+		work := take(&node.solver.work, n*n)
+		clear(work)
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				for k := 0; k < n; k++ {
+					work[i*n+k] += bar[i*n+j] * y[k*n+j]
+				}
+			}
+		}
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				for k := 0; k < n; k++ {
+					a.bar[i*n+k] -= y[j*n+i] * work[j*n+k]
+				}
+			}
+		}
+	case exprSolve:
+		b, bActive := t.arg(node, 1)
+		n, m, x := node.dims[0], node.dims[2], node.value
+		s := &node.solver
+		work := take(&s.work, n*m)
+		singular("solve", s.lu.SolveTo(dense(&s.dst, n, m, work), true, dense(&s.src, n, m, bar)))
+		if bActive {
+			for i, g := range work {
+				b.bar[i] += g
+			}
+		}
+		if aActive {
+			for i := 0; i < n; i++ {
+				for j := 0; j < n; j++ {
+					for k := 0; k < m; k++ {
+						a.bar[i*n+j] -= work[i*m+k] * x[j*m+k]
+					}
+				}
+			}
+		}
+	}
+}
+
+// matrixCall records a call to one of exprMatrixFunctions but cholesky, with the values and
+// errors the compiled call gives.
+func (d *ExpressionDerivative) matrixCall(name string, args []int) int {
+	t := &d.tape
+	needs := func(i int) {
+		if t.nodes[args[i]].rows == 0 {
+			panic(fmt.Sprintf("expression: %s's %s argument must be a matrix: a field with a "+
+				"shape, a param declared in matrices, or the result of a matrix function",
+				name, []string{"first", "second"}[i]))
+		}
+	}
+	dims := func(i int) (int, int) {
+		rows, a := t.nodes[args[i]].rows, t.value(args[i])
+		if rows < 1 || len(a) == 0 || len(a)%rows != 0 {
+			panic(fmt.Sprintf("expression: %s: a width-%d value cannot have %d rows",
+				name, len(a), rows))
+		}
+		return rows, len(a) / rows
+	}
+	square := func(i int) int {
+		rows, cols := dims(i)
+		if rows != cols {
+			panic(fmt.Sprintf("expression: %s needs a square matrix, got %dx%d", name, rows, cols))
+		}
+		return rows
+	}
+	// columns is how many columns the second argument has as the right-hand side of a first
+	// with rows rows, reading a plain value as columns of that many rows.
+	columns := func(rows int, what string) int {
+		b := t.value(args[1])
+		br, bc := rows, 0
+		if t.nodes[args[1]].rows > 0 {
+			br, bc = dims(1)
+		} else if len(b)%rows == 0 {
+			bc = len(b) / rows
+		}
+		if br != rows || bc == 0 {
+			panic(fmt.Sprintf(what, len(b)))
+		}
+		return bc
+	}
+	result := func(op exprNodeOp, rows int, width int, dims [3]int) (int, exprValue) {
+		i := t.add(op, args...)
+		t.nodes[i].rows, t.nodes[i].dims = rows, dims
+		return i, t.own(i, width)
+	}
+	var ad, bd, od mat.Dense
+
+	switch name {
+	case "matmul":
+		needs(0)
+		ar, ac := dims(0)
+		bc := columns(ac, fmt.Sprintf("expression: matmul: a %dx%d matrix cannot multiply a "+
+			"width-%%d value", ar, ac))
+		i, out := result(exprMatmul, ar, ar*bc, [3]int{ar, ac, bc})
+		a, b := t.value(args[0]), t.value(args[1])
+		dense(&od, ar, bc, out).Mul(dense(&ad, ar, ac, a), dense(&bd, ac, bc, b))
+		return i
+	case "transpose":
+		needs(0)
+		ar, ac := dims(0)
+		i, out := result(exprTranspose, ac, ar*ac, [3]int{ar, ac, 0})
+		a := t.value(args[0])
+		for r := 0; r < ar; r++ {
+			for c := 0; c < ac; c++ {
+				out[c*ar+r] = a[r*ac+c]
+			}
+		}
+		return i
+	case "outer":
+		a, b := t.value(args[0]), t.value(args[1])
+		if len(a) == 0 || len(b) == 0 {
+			panic("expression: outer needs two non-empty values")
+		}
+		i, out := result(exprOuter, len(a), len(a)*len(b), [3]int{})
+		for r, u := range a {
+			for c, v := range b {
+				out[r*len(b)+c] = u * v
+			}
+		}
+		return i
+	case "diag":
+		if t.nodes[args[0]].rows > 0 {
+			ar, ac := dims(0)
+			i, out := result(exprDiagonalOf, 0, min(ar, ac), [3]int{ar, ac, 0})
+			a := t.value(args[0])
+			for r := range out {
+				out[r] = a[r*ac+r]
+			}
+			return i
+		}
+		v := t.value(args[0])
+		if len(v) == 0 {
+			panic("expression: diag needs a non-empty value")
+		}
+		i, out := result(exprDiagonal, len(v), len(v)*len(v), [3]int{})
+		clear(out)
+		for r, e := range v {
+			out[r*len(v)+r] = e
+		}
+		return i
+	case "solve":
+		needs(0)
+		size := square(0)
+		bc := columns(size, fmt.Sprintf("expression: solve: a %dx%d system cannot have a "+
+			"width-%%d right-hand side", size, size))
+		i, out := result(exprSolve, size, size*bc, [3]int{size, size, bc})
+		s := &t.nodes[i].solver
+		s.lu.Factorize(dense(&ad, size, size, t.value(args[0])))
+		singular(name, s.lu.SolveTo(dense(&od, size, bc, out), false,
+			dense(&bd, size, bc, t.value(args[1]))))
+		return i
+	case "inv":
+		needs(0)
+		size := square(0)
+		i, out := result(exprInverse, size, size*size, [3]int{size, size, 0})
+		singular(name, dense(&od, size, size, out).Inverse(dense(&ad, size, size,
+			t.value(args[0]))))
+		return i
+	}
+	panic("expression: unknown function " + name)
+}
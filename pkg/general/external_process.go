@@ -0,0 +1,458 @@
+package general
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultExternalProcessTimeout bounds how long an ExternalProcessIteration
+// waits for each response when its Timeout is zero.
+const DefaultExternalProcessTimeout = 10 * time.Second
+
+// DefaultExternalProcessMaxRestarts is the number of restarts allowed under
+// ExternalProcessRestartOnFailure when MaxRestarts is zero.
+const DefaultExternalProcessMaxRestarts = 3
+
+// maxExternalProcessMessage bounds the length prefix the iteration accepts, so
+// a subprocess that writes stray text to stdout fails fast instead of asking
+// for gigabytes.
+const maxExternalProcessMessage = 64 << 20
+
+// ExternalProcessRestartPolicy decides what an ExternalProcessIteration does
+// when its subprocess exits, times out or breaks the protocol.
+type ExternalProcessRestartPolicy string
+
+const (
+	// ExternalProcessRestartNever stops the run on the first failure. It is
+	// the default.
+	ExternalProcessRestartNever ExternalProcessRestartPolicy = "never"
+	// ExternalProcessRestartOnFailure kills the subprocess, starts a new one,
+	// configures it and retries the request, up to MaxRestarts times per run.
+	ExternalProcessRestartOnFailure ExternalProcessRestartPolicy = "on_failure"
+)
+
+// ExternalProcessIteration computes a partition's next state in a subprocess,
+// so components written in Python, R or any other language can take part in a
+// simulation. Configure launches Command once; each step the iteration sends it
+// the params, the state histories and the timestep as an ExternalProcessRequest
+// and reads back the next state. Messages are length-prefixed protobuf over the
+// subprocess's stdin and stdout (see cmd/messages/external_process.proto and
+// the Python reference client cmd/messages/external_process_client.py).
+//
+// Usage hints:
+//   - Command is the program and its arguments, e.g. ["python3", "model.py"].
+//   - Histories names other partitions whose state histories are sent after
+//     the partition's own.
+//   - Timeout bounds each response (DefaultExternalProcessTimeout if zero); a
+//     subprocess that misses it is killed.
+//   - Restart selects what a crash, timeout or malformed reply does. A restarted
+//     subprocess is configured again but loses any state it held.
+//   - An error reported by the subprocess itself always stops the run.
+//   - The subprocess's stderr passes through to the run's stderr.
+//   - Close stops the subprocess. A run closes it when it ends, however it
+//     ends (see simulator.PartitionCoordinator.Close); failing that it is
+//     stopped when the iteration is garbage collected.
+type ExternalProcessIteration struct {
+	Command     []string
+	Histories   []string
+	Timeout     time.Duration
+	Restart     ExternalProcessRestartPolicy
+	MaxRestarts int
+
+	partitionName   string
+	stateWidth      int
+	seed            uint64
+	initStateValues []float64
+	initParams      simulator.Params
+	historyIndices  []int
+	historyNames    []string
+	process         *externalProcess
+	restarts        int
+}
+
+func (e *ExternalProcessIteration) Configure(
+	partitionIndex int,
+	settings *simulator.Settings,
+) {
+	iteration := settings.Iterations[partitionIndex]
+	e.partitionName = iteration.Name
+	e.stateWidth = iteration.StateWidth
+	e.seed = iteration.Seed
+	e.initStateValues = iteration.InitStateValues
+	e.initParams = iteration.Params
+	e.historyIndices = []int{partitionIndex}
+	e.historyNames = []string{iteration.Name}
+	for _, name := range e.Histories {
+		index := -1
+		for i, other := range settings.Iterations {
+			if other.Name == name {
+				index = i
+			}
+		}
+		if index < 0 {
+			panic(fmt.Sprintf(
+				"external_process %q: histories names unknown partition %q",
+				e.partitionName, name))
+		}
+		e.historyIndices = append(e.historyIndices, index)
+		e.historyNames = append(e.historyNames, name)
+	}
+	switch e.Restart {
+	case "", ExternalProcessRestartNever, ExternalProcessRestartOnFailure:
+	default:
+		panic(fmt.Sprintf(
+			"external_process %q: unknown restart policy %q — expected %q or %q",
+			e.partitionName, e.Restart,
+			ExternalProcessRestartNever, ExternalProcessRestartOnFailure))
+	}
+	e.restarts = 0
+	if err := e.start(); err != nil {
+		panic(err)
+	}
+}
+
+func (e *ExternalProcessIteration) Iterate(
+	params *simulator.Params,
+	partitionIndex int,
+	stateHistories []*simulator.StateHistory,
+	timestepsHistory *simulator.CumulativeTimestepsHistory,
+) []float64 {
+	request := &ExternalProcessRequest{
+		Type:          ExternalProcessRequestType_EXTERNAL_PROCESS_REQUEST_TYPE_ITERATE,
+		PartitionName: e.partitionName,
+		StateWidth:    uint32(e.stateWidth),
+		Step:          uint64(timestepsHistory.CurrentStepNumber),
+		Time:          timestepsHistory.Values.AtVec(0),
+		Timestep:      timestepsHistory.NextIncrement,
+		Params:        externalProcessParams(params),
+	}
+	for i, index := range e.historyIndices {
+		history := stateHistories[index]
+		values := make([]float64, 0, history.StateHistoryDepth*history.StateWidth)
+		for row := 0; row < history.StateHistoryDepth; row++ {
+			values = append(values, history.Values.RawRowView(row)...)
+		}
+		request.StateHistories = append(request.StateHistories, &ExternalProcessHistory{
+			PartitionName:     e.historyNames[i],
+			StateWidth:        uint32(history.StateWidth),
+			StateHistoryDepth: uint32(history.StateHistoryDepth),
+			Values:            values,
+		})
+	}
+	response, err := e.exchange(request)
+	if err != nil {
+		panic(err)
+	}
+	if len(response.State) != e.stateWidth {
+		panic(fmt.Sprintf(
+			"external_process %q: subprocess returned %d values, want state width %d",
+			e.partitionName, len(response.State), e.stateWidth))
+	}
+	return response.State
+}
+
+// Close stops the subprocess. The iteration must be configured again before it
+// can iterate.
+func (e *ExternalProcessIteration) Close() error {
+	if e.process == nil {
+		return nil
+	}
+	e.process.stop()
+	e.process = nil
+	return nil
+}
+
+// start stops any running subprocess, launches a new one and configures it.
+func (e *ExternalProcessIteration) start() error {
+	if e.process != nil {
+		e.process.stop()
+		e.process = nil
+	}
+	if len(e.Command) == 0 {
+		return fmt.Errorf("external_process %q: no command to run", e.partitionName)
+	}
+	process, err := startExternalProcess(e.Command)
+	if err != nil {
+		return fmt.Errorf("external_process %q: %w", e.partitionName, err)
+	}
+	e.process = process
+	runtime.AddCleanup(e, func(process *externalProcess) { process.stop() }, process)
+	response, err := e.process.exchange(&ExternalProcessRequest{
+		Type:            ExternalProcessRequestType_EXTERNAL_PROCESS_REQUEST_TYPE_CONFIGURE,
+		PartitionName:   e.partitionName,
+		StateWidth:      uint32(e.stateWidth),
+		Seed:            e.seed,
+		Params:          externalProcessParams(&e.initParams),
+		InitStateValues: e.initStateValues,
+	}, e.timeout())
+	if err == nil && response.Error != "" {
+		err = fmt.Errorf("subprocess failed to configure: %s", response.Error)
+	}
+	if err != nil {
+		e.process.stop()
+		e.process = nil
+		return fmt.Errorf("external_process %q: %w", e.partitionName, err)
+	}
+	return nil
+}
+
+// exchange sends request and returns the response, restarting the subprocess
+// and retrying as the restart policy allows. An error response is returned as
+// an error without a restart.
+func (e *ExternalProcessIteration) exchange(
+	request *ExternalProcessRequest,
+) (*ExternalProcessResponse, error) {
+	maxRestarts := 0
+	if e.Restart == ExternalProcessRestartOnFailure {
+		maxRestarts = e.MaxRestarts
+		if maxRestarts == 0 {
+			maxRestarts = DefaultExternalProcessMaxRestarts
+		}
+	}
+	for {
+		if e.process == nil {
+			return nil, fmt.Errorf(
+				"external_process %q: iterated after Close", e.partitionName)
+		}
+		response, err := e.process.exchange(request, e.timeout())
+		if err == nil {
+			if response.Error != "" {
+				return nil, fmt.Errorf("external_process %q: subprocess failed at step %d: %s",
+					e.partitionName, request.Step, response.Error)
+			}
+			return response, nil
+		}
+		err = fmt.Errorf("external_process %q: step %d: %w", e.partitionName, request.Step, err)
+		if e.restarts >= maxRestarts {
+			if maxRestarts > 0 {
+				err = fmt.Errorf("%w (after %d restarts)", err, e.restarts)
+			}
+			return nil, err
+		}
+		e.restarts++
+		if restartErr := e.start(); restartErr != nil {
+			return nil, fmt.Errorf("%w; restart failed: %w", err, restartErr)
+		}
+	}
+}
+
+func (e *ExternalProcessIteration) timeout() time.Duration {
+	if e.Timeout > 0 {
+		return e.Timeout
+	}
+	return DefaultExternalProcessTimeout
+}
+
+// externalProcessParams converts params to their wire form, sorted by name.
+func externalProcessParams(params *simulator.Params) []*ExternalProcessParam {
+	names := make([]string, 0, len(params.Map))
+	for name := range params.Map {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	wire := make([]*ExternalProcessParam, len(names))
+	for i, name := range names {
+		wire[i] = &ExternalProcessParam{Name: name, Values: params.Map[name]}
+	}
+	return wire
+}
+
+// externalProcess is one running subprocess. A goroutine reads its responses
+// off stdout into replies, so a read can be abandoned when it times out.
+type externalProcess struct {
+	command  *exec.Cmd
+	stdin    io.WriteCloser
+	replies  chan externalProcessReply
+	stderr   *tailBuffer
+	exited   chan struct{}
+	stopped  chan struct{}
+	waitErr  error
+	stopOnce sync.Once
+}
+
+type externalProcessReply struct {
+	response *ExternalProcessResponse
+	err      error
+}
+
+func startExternalProcess(command []string) (*externalProcess, error) {
+	p := &externalProcess{
+		command: exec.Command(command[0], command[1:]...),
+		// one reply to an abandoned request plus the final read error
+		replies: make(chan externalProcessReply, 2),
+		stderr:  &tailBuffer{limit: 2048},
+		exited:  make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	p.command.Stderr = io.MultiWriter(os.Stderr, p.stderr)
+	p.command.WaitDelay = time.Second
+	stdin, err := p.command.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	// a plain pipe rather than StdoutPipe, which Wait would close under the
+	// reader as soon as the subprocess exits
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	p.command.Stdout = stdoutWriter
+	err = p.command.Start()
+	stdoutWriter.Close()
+	if err != nil {
+		stdout.Close()
+		return nil, err
+	}
+	p.stdin = stdin
+	go func() {
+		defer stdout.Close()
+		for {
+			response := &ExternalProcessResponse{}
+			err := ReadExternalProcessMessage(stdout, response)
+			select {
+			case p.replies <- externalProcessReply{response: response, err: err}:
+			case <-p.stopped:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		p.waitErr = p.command.Wait()
+		close(p.exited)
+	}()
+	return p, nil
+}
+
+// exchange writes request and waits up to timeout for the response, killing
+// the subprocess if none arrives.
+func (p *externalProcess) exchange(
+	request *ExternalProcessRequest,
+	timeout time.Duration,
+) (*ExternalProcessResponse, error) {
+	if err := WriteExternalProcessMessage(p.stdin, request); err != nil {
+		return nil, p.failure(fmt.Errorf("writing request: %w", err))
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case reply := <-p.replies:
+		if reply.err != nil {
+			return nil, p.failure(fmt.Errorf("reading response: %w", reply.err))
+		}
+		return reply.response, nil
+	case <-timer.C:
+		p.kill()
+		return nil, fmt.Errorf("no response within %v; subprocess killed", timeout)
+	}
+}
+
+// failure annotates err with the subprocess's exit status and the tail of its
+// stderr once it has exited, waiting briefly for it to do so.
+func (p *externalProcess) failure(err error) error {
+	select {
+	case <-p.exited:
+	case <-time.After(time.Second):
+		p.kill()
+		return err
+	}
+	if p.waitErr != nil {
+		err = fmt.Errorf("%w (subprocess %v)", err, p.waitErr)
+	} else {
+		err = fmt.Errorf("%w (subprocess exited)", err)
+	}
+	if tail := strings.TrimSpace(p.stderr.String()); tail != "" {
+		err = fmt.Errorf("%w; stderr: %s", err, tail)
+	}
+	return err
+}
+
+func (p *externalProcess) kill() {
+	p.command.Process.Kill()
+	<-p.exited
+}
+
+// stop closes stdin, which asks the subprocess to exit, and kills it if it has
+// not within a second.
+func (p *externalProcess) stop() {
+	p.stopOnce.Do(func() {
+		close(p.stopped)
+		p.stdin.Close()
+		select {
+		case <-p.exited:
+		case <-time.After(time.Second):
+			p.kill()
+		}
+	})
+}
+
+// tailBuffer keeps the last limit bytes written to it.
+type tailBuffer struct {
+	mu    sync.Mutex
+	limit int
+	data  []byte
+}
+
+func (t *tailBuffer) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.data = append(t.data, b...)
+	if excess := len(t.data) - t.limit; excess > 0 {
+		t.data = append(t.data[:0], t.data[excess:]...)
+	}
+	return len(b), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(bytes.ToValidUTF8(t.data, nil))
+}
+
+// WriteExternalProcessMessage writes message to w framed by its length as a
+// 4-byte big-endian unsigned integer, the framing of the external_process
+// protocol.
+func WriteExternalProcessMessage(w io.Writer, message proto.Message) error {
+	data, err := proto.Marshal(message)
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	_, err = w.Write(frame)
+	return err
+}
+
+// ReadExternalProcessMessage reads one length-prefixed message written by
+// WriteExternalProcessMessage from r into message.
+func ReadExternalProcessMessage(r io.Reader, message proto.Message) error {
+	var prefix [4]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return err
+	}
+	length := binary.BigEndian.Uint32(prefix[:])
+	if length > maxExternalProcessMessage {
+		return fmt.Errorf("message length %d exceeds the %d byte limit",
+			length, maxExternalProcessMessage)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	return proto.Unmarshal(data, message)
+}
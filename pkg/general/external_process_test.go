@@ -0,0 +1,249 @@
+package general
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// buildExternalProcessHelper builds testdata/external_process_helper into a
+// temporary directory and returns its path.
+func buildExternalProcessHelper(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "helper")
+	output, err := exec.Command("go", "build", "-o", path,
+		"./testdata/external_process_helper").CombinedOutput()
+	if err != nil {
+		t.Skipf("cannot build the external process helper: %v\n%s", err, output)
+	}
+	return path
+}
+
+// externalProcessRun builds a coordinator over external_process_settings.yaml
+// from walk and a summary partition that runs helper.
+func externalProcessRun(
+	t *testing.T,
+	helper string,
+	walk *ExternalProcessIteration,
+	steps int,
+) (*simulator.PartitionCoordinator, *simulator.StateTimeStorage) {
+	t.Helper()
+	settings := simulator.LoadSettingsFromYaml("./external_process_settings.yaml")
+	summary := &ExternalProcessIteration{
+		Command:   []string{helper},
+		Histories: []string{"walk"},
+	}
+	iterations := []simulator.Iteration{walk, summary}
+	for index, iteration := range iterations {
+		iteration.Configure(index, settings)
+	}
+	t.Cleanup(func() {
+		walk.Close()
+		summary.Close()
+	})
+	store := simulator.NewStateTimeStorage()
+	implementations := &simulator.Implementations{
+		Iterations:      iterations,
+		OutputCondition: &simulator.EveryStepOutputCondition{},
+		OutputFunction:  &simulator.StateTimeStorageOutputFunction{Store: store},
+		TerminationCondition: &simulator.NumberOfStepsTerminationCondition{
+			MaxNumberOfSteps: steps,
+		},
+		TimestepFunction: &simulator.ConstantTimestepFunction{Stepsize: 0.5},
+	}
+	return simulator.NewPartitionCoordinator(settings, implementations), store
+}
+
+func TestExternalProcess(t *testing.T) {
+	helper := buildExternalProcessHelper(t)
+	t.Run(
+		"test that the external process iteration runs",
+		func(t *testing.T) {
+			walk := &ExternalProcessIteration{Command: []string{helper}}
+			coordinator, store := externalProcessRun(t, helper, walk, 10)
+			coordinator.Run()
+			walkValues := store.GetValues("walk")
+			if final := walkValues[len(walkValues)-1]; final[0] != 5.0 || final[1] != 7.5 {
+				t.Errorf("unexpected final walk state: %v", final)
+			}
+			// step, time, timestep, seed, the walk's latest value and its depth
+			summary := store.GetValues("summary")
+			want := []float64{3, 1.0, 0.5, 42, 1.0, 2}
+			for i, value := range summary[3] {
+				if value != want[i] {
+					t.Errorf("unexpected request summary at step 3: %v, want %v",
+						summary[3], want)
+					break
+				}
+			}
+		},
+	)
+	t.Run(
+		"test that the subprocesses have exited when the run returns",
+		func(t *testing.T) {
+			cancelled, cancel := context.WithCancel(t.Context())
+			cancel()
+			for name, run := range map[string]struct {
+				ctx     context.Context
+				command []string
+			}{
+				"finished":  {t.Context(), []string{helper}},
+				"failed":    {t.Context(), []string{helper, "-mode=crash", "-at=2"}},
+				"cancelled": {cancelled, []string{helper}},
+			} {
+				walk := &ExternalProcessIteration{Command: run.command}
+				coordinator, _ := externalProcessRun(t, helper, walk, 5)
+				processes := []*externalProcess{
+					walk.process,
+					coordinator.Iterators[1].Iteration.(*ExternalProcessIteration).process,
+				}
+				coordinator.RunContext(run.ctx)
+				for _, process := range processes {
+					select {
+					case <-process.exited:
+					case <-time.After(5 * time.Second):
+						t.Errorf("%s: a subprocess is still running after the run returned", name)
+					}
+				}
+				if walk.process != nil {
+					t.Errorf("%s: the iteration was not closed", name)
+				}
+			}
+		},
+	)
+	t.Run(
+		"test that the external process iteration runs with harnesses",
+		func(t *testing.T) {
+			settings := simulator.LoadSettingsFromYaml("./external_process_settings.yaml")
+			walk := &ExternalProcessIteration{Command: []string{helper}}
+			summary := &ExternalProcessIteration{
+				Command:   []string{helper},
+				Histories: []string{"walk"},
+			}
+			defer walk.Close()
+			defer summary.Close()
+			implementations := &simulator.Implementations{
+				Iterations:      []simulator.Iteration{walk, summary},
+				OutputCondition: &simulator.EveryStepOutputCondition{},
+				OutputFunction:  &simulator.NilOutputFunction{},
+				TerminationCondition: &simulator.NumberOfStepsTerminationCondition{
+					MaxNumberOfSteps: 20,
+				},
+				TimestepFunction: &simulator.ConstantTimestepFunction{Stepsize: 1.0},
+			}
+			if err := simulator.RunWithHarnesses(settings, implementations); err != nil {
+				t.Errorf("test harness failed: %v", err)
+			}
+		},
+	)
+	t.Run(
+		"test that a slow subprocess is killed at the timeout",
+		func(t *testing.T) {
+			walk := &ExternalProcessIteration{
+				Command: []string{helper, "-mode=sleep", "-at=2"},
+				Timeout: 200 * time.Millisecond,
+			}
+			coordinator, _ := externalProcessRun(t, helper, walk, 5)
+			start := time.Now()
+			err := coordinator.RunContext(t.Context())
+			if err == nil || !strings.Contains(err.Error(), "no response within 200ms") {
+				t.Errorf("expected a timeout, got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("the timeout took %v", elapsed)
+			}
+		},
+	)
+	t.Run(
+		"test that a crash stops the run by default",
+		func(t *testing.T) {
+			walk := &ExternalProcessIteration{
+				Command: []string{helper, "-mode=crash", "-at=3"},
+			}
+			coordinator, _ := externalProcessRun(t, helper, walk, 5)
+			err := coordinator.RunContext(t.Context())
+			if err == nil || !strings.Contains(err.Error(), "exit status 3") ||
+				!strings.Contains(err.Error(), "crashing as asked") {
+				t.Errorf("expected the crash with its stderr, got %v", err)
+			}
+		},
+	)
+	t.Run(
+		"test that a crashed subprocess is restarted on failure",
+		func(t *testing.T) {
+			marker := filepath.Join(t.TempDir(), "crashed")
+			walk := &ExternalProcessIteration{
+				Command: []string{
+					helper, "-mode=crash", "-at=3", "-once=" + marker,
+				},
+				Restart: ExternalProcessRestartOnFailure,
+			}
+			coordinator, store := externalProcessRun(t, helper, walk, 10)
+			if err := coordinator.RunContext(t.Context()); err != nil {
+				t.Fatal(err)
+			}
+			walkValues := store.GetValues("walk")
+			if final := walkValues[len(walkValues)-1]; final[0] != 5.0 || walk.restarts != 1 {
+				t.Errorf("unexpected final walk state %v after %d restarts",
+					final, walk.restarts)
+			}
+		},
+	)
+	t.Run(
+		"test that restarts are bounded",
+		func(t *testing.T) {
+			walk := &ExternalProcessIteration{
+				Command:     []string{helper, "-mode=crash", "-at=2"},
+				Restart:     ExternalProcessRestartOnFailure,
+				MaxRestarts: 2,
+			}
+			coordinator, _ := externalProcessRun(t, helper, walk, 5)
+			err := coordinator.RunContext(t.Context())
+			if err == nil || !strings.Contains(err.Error(), "after 2 restarts") {
+				t.Errorf("expected the run to stop after 2 restarts, got %v", err)
+			}
+		},
+	)
+	t.Run(
+		"test that an error response stops the run without a restart",
+		func(t *testing.T) {
+			walk := &ExternalProcessIteration{
+				Command: []string{helper, "-mode=error", "-at=2"},
+				Restart: ExternalProcessRestartOnFailure,
+			}
+			coordinator, _ := externalProcessRun(t, helper, walk, 5)
+			err := coordinator.RunContext(t.Context())
+			if err == nil || !strings.Contains(err.Error(), "failed at step 2: bad input") ||
+				walk.restarts != 0 {
+				t.Errorf("expected the error response, got %v", err)
+			}
+		},
+	)
+	t.Run(
+		"test that configuration errors panic",
+		func(t *testing.T) {
+			settings := simulator.LoadSettingsFromYaml("./external_process_settings.yaml")
+			for name, iteration := range map[string]*ExternalProcessIteration{
+				"refused":          {Command: []string{helper, "-mode=configure_error"}},
+				"missing program":  {Command: []string{filepath.Join(t.TempDir(), "missing")}},
+				"unknown history":  {Command: []string{helper}, Histories: []string{"nope"}},
+				"unknown restart":  {Command: []string{helper}, Restart: "always"},
+				"no command given": {},
+			} {
+				func() {
+					defer func() {
+						if recover() == nil {
+							t.Errorf("%s: expected Configure to panic", name)
+						}
+					}()
+					iteration.Configure(0, settings)
+				}()
+			}
+		},
+	)
+}
@@ -0,0 +1,425 @@
+package general
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+	"gonum.org/v1/gonum/mat"
+)
+
+// PopulationStateWidth returns the state width of a population partition holding
+// up to capacity entities of entityWidth values each.
+//
+// The state is laid out as [live mask (capacity) | ids (capacity) | records
+// (capacity * entityWidth)]: slot k is live when its mask value is 1, in which case
+// ids[k] is the entity's stable ID and its record occupies
+// records[k*entityWidth : (k+1)*entityWidth]. Dead slots hold zeros throughout.
+func PopulationStateWidth(capacity, entityWidth int) int {
+	return capacity * (2 + entityWidth)
+}
+
+// NewPopulationInitState builds the initial state of a population partition with
+// the given entities live in the lowest slots and IDs 1, 2, ... assigned in order.
+// It panics if there are more entities than capacity or a record is the wrong width.
+func NewPopulationInitState(capacity, entityWidth int, entities [][]float64) []float64 {
+	if len(entities) > capacity {
+		panic(fmt.Sprintf(
+			"population: %d initial entities exceed capacity %d", len(entities), capacity))
+	}
+	state := make([]float64, PopulationStateWidth(capacity, entityWidth))
+	for slot, record := range entities {
+		if len(record) != entityWidth {
+			panic(fmt.Sprintf("population: initial entity %d has width %d, want %d",
+				slot, len(record), entityWidth))
+		}
+		state[slot] = 1
+		state[capacity+slot] = float64(slot + 1)
+		copy(state[2*capacity+slot*entityWidth:], record)
+	}
+	return state
+}
+
+// populationLayout reads the capacity param of a population partition and derives
+// its entity width from the state width, panicking if the two are inconsistent.
+func populationLayout(iteration simulator.IterationSettings) (capacity, entityWidth int) {
+	capacity = int(iteration.Params.GetIndex("capacity", 0))
+	if capacity <= 0 || iteration.StateWidth%capacity != 0 ||
+		iteration.StateWidth/capacity < 2 {
+		panic(fmt.Sprintf(
+			"population: partition %s has state width %d, which is not a "+
+				"[live mask | ids | records] layout for capacity %d",
+			iteration.Name, iteration.StateWidth, capacity))
+	}
+	return capacity, iteration.StateWidth/capacity - 2
+}
+
+// populationHasParam reports whether a population partition is given the named
+// param, either directly or from upstream.
+func populationHasParam(iteration simulator.IterationSettings, name string) bool {
+	if _, ok := iteration.Params.GetOk(name); ok {
+		return true
+	}
+	_, ok := iteration.ParamsFromUpstream[name]
+	return ok
+}
+
+// PopulationIteration is a container partition for a variable number of entities
+// which are spawned and retired at runtime. The number of live entities may change
+// every step while the partition's state width stays fixed at its capacity (see
+// PopulationStateWidth for the layout).
+//
+// Each step the Entity iteration runs once for every live slot, in slot order. It
+// sees this partition's state as a single entity: a width entity_width+2 history
+// holding the entity's record followed by two zeros. It must return entity_width+2
+// values: the entity's next record, then a retire flag (non-zero retires the entity)
+// and a spawn count (the number of offspring to create). The entity's stable ID and
+// its current slot are passed to it as the "entity_id" and "entity_slot" params.
+// Because entity Iterate calls share one Configure, any per-entity state the Entity
+// needs must live in its record.
+//
+// Newborns take the lowest free slots after every entity has stepped (so a slot
+// freed by a retirement is reusable within the same step) and receive strictly
+// increasing IDs which are never reused. A newborn's record is the "newborn_state"
+// param if set, or otherwise its parent's next record.
+//
+// Usage hints:
+//   - Provide params: "capacity" and init_state_values built by NewPopulationInitState
+//     (or laid out by hand, with distinct positive IDs in live slots).
+//   - Optionally provide "spawn_count" (e.g. from upstream) to spawn that many
+//     entities each step from "newborn_state", independently of the Entity; a
+//     spawn_count without a newborn_state panics at Configure.
+//   - Exceeding capacity panics; raise "capacity" to fit the largest population.
+//   - Use LiveEntitiesOutputFunction to output only live entities and
+//     PopulationAggregationIteration to reduce over them.
+type PopulationIteration struct {
+	Entity simulator.Iteration
+
+	capacity    int
+	entityWidth int
+	nextID      float64
+	scratch     *simulator.StateHistory
+	histories   []*simulator.StateHistory
+	entityID    []float64
+	entitySlot  []float64
+	newborns    []float64
+}
+
+func (p *PopulationIteration) Configure(
+	partitionIndex int,
+	settings *simulator.Settings,
+) {
+	iteration := settings.Iterations[partitionIndex]
+	p.capacity, p.entityWidth = populationLayout(iteration)
+	if populationHasParam(iteration, "spawn_count") &&
+		!populationHasParam(iteration, "newborn_state") {
+		panic(fmt.Sprintf(
+			"population: partition %s has a spawn_count param but no newborn_state "+
+				"param to spawn from", iteration.Name))
+	}
+	p.nextID = 1
+	for _, id := range iteration.InitStateValues[p.capacity : 2*p.capacity] {
+		if id >= p.nextID {
+			p.nextID = id + 1
+		}
+	}
+	width := p.entityWidth + 2
+	p.scratch = &simulator.StateHistory{
+		Values:            mat.NewDense(1, width, nil),
+		NextValues:        make([]float64, width),
+		StateWidth:        width,
+		StateHistoryDepth: 1,
+	}
+	p.entityID = make([]float64, 1)
+	p.entitySlot = make([]float64, 1)
+
+	// The Entity is configured as if it were the partition, but one entity wide.
+	entitySettings := *settings
+	entitySettings.Iterations = append(
+		[]simulator.IterationSettings(nil), settings.Iterations...)
+	entitySettings.Iterations[partitionIndex].StateWidth = width
+	entitySettings.Iterations[partitionIndex].StateHistoryDepth = 1
+	entitySettings.Iterations[partitionIndex].InitStateValues = make([]float64, width)
+	p.Entity.Configure(partitionIndex, &entitySettings)
+}
+
+func (p *PopulationIteration) Iterate(
+	params *simulator.Params,
+	partitionIndex int,
+	stateHistories []*simulator.StateHistory,
+	timestepsHistory *simulator.CumulativeTimestepsHistory,
+) []float64 {
+	state := stateHistories[partitionIndex].Values.RawRowView(0)
+	next := stateHistories[partitionIndex].GetNextStateRowToUpdate()
+	if len(p.histories) != len(stateHistories) {
+		p.histories = make([]*simulator.StateHistory, len(stateHistories))
+	}
+	copy(p.histories, stateHistories)
+	p.histories[partitionIndex] = p.scratch
+
+	// The entity params extend, rather than mutate, the partition's own params.
+	entityParams := *params
+	entityParams.Map = make(map[string][]float64, len(params.Map)+2)
+	for name, values := range params.Map {
+		entityParams.Map[name] = values
+	}
+	entityParams.Map["entity_id"] = p.entityID
+	entityParams.Map["entity_slot"] = p.entitySlot
+
+	newbornState, hasNewbornState := params.GetOk("newborn_state")
+	if hasNewbornState && len(newbornState) != p.entityWidth {
+		panic(fmt.Sprintf("population: newborn_state has width %d, want %d",
+			len(newbornState), p.entityWidth))
+	}
+	row := p.scratch.Values.RawRowView(0)
+	p.newborns = p.newborns[:0]
+	for slot := 0; slot < p.capacity; slot++ {
+		if state[slot] == 0 {
+			continue
+		}
+		record := p.record(next, slot)
+		copy(row, p.record(state, slot))
+		row[p.entityWidth], row[p.entityWidth+1] = 0, 0
+		p.entityID[0] = state[p.capacity+slot]
+		p.entitySlot[0] = float64(slot)
+		out := p.Entity.Iterate(&entityParams, partitionIndex, p.histories, timestepsHistory)
+		if len(out) != p.entityWidth+2 {
+			panic(fmt.Sprintf(
+				"population: entity iteration returned %d values, want %d "+
+					"(the record, then retire and spawn)", len(out), p.entityWidth+2))
+		}
+		for k := 0; k < int(out[p.entityWidth+1]); k++ {
+			if hasNewbornState {
+				p.newborns = append(p.newborns, newbornState...)
+			} else {
+				p.newborns = append(p.newborns, out[:p.entityWidth]...)
+			}
+		}
+		if out[p.entityWidth] != 0 {
+			next[slot], next[p.capacity+slot] = 0, 0
+			clear(record)
+		} else {
+			copy(record, out[:p.entityWidth])
+		}
+	}
+	if spawnCount, ok := params.GetOk("spawn_count"); ok {
+		for k := 0; k < int(spawnCount[0]); k++ {
+			p.newborns = append(p.newborns, newbornState...)
+		}
+	}
+
+	slot := 0
+	for start := 0; start < len(p.newborns); start += p.entityWidth {
+		for slot < p.capacity && next[slot] != 0 {
+			slot++
+		}
+		if slot == p.capacity {
+			panic(fmt.Sprintf(
+				"population: spawning would exceed capacity %d at step %d; "+
+					"raise the capacity param", p.capacity, timestepsHistory.CurrentStepNumber+1))
+		}
+		next[slot] = 1
+		next[p.capacity+slot] = p.nextID
+		p.nextID++
+		copy(p.record(next, slot), p.newborns[start:start+p.entityWidth])
+	}
+	return next
+}
+
+func (p *PopulationIteration) record(state []float64, slot int) []float64 {
+	start := 2*p.capacity + slot*p.entityWidth
+	return state[start : start+p.entityWidth]
+}
+
+// LiveEntities returns the IDs and records of the live entities in a population
+// partition's state, in ascending ID order.
+func LiveEntities(state []float64, capacity int) (ids []float64, records [][]float64) {
+	entityWidth := len(state)/capacity - 2
+	slots := make([]int, 0, capacity)
+	for slot := 0; slot < capacity; slot++ {
+		if state[slot] != 0 {
+			slots = append(slots, slot)
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool {
+		return state[capacity+slots[i]] < state[capacity+slots[j]]
+	})
+	for _, slot := range slots {
+		start := 2*capacity + slot*entityWidth
+		ids = append(ids, state[capacity+slot])
+		records = append(records, state[start:start+entityWidth])
+	}
+	return ids, records
+}
+
+// ParseLiveEntitiesRow splits a row written by LiveEntitiesOutputFunction back into
+// entity IDs and records.
+func ParseLiveEntitiesRow(row []float64, entityWidth int) (ids []float64, records [][]float64) {
+	for start := 0; start+entityWidth < len(row); start += entityWidth + 1 {
+		ids = append(ids, row[start])
+		records = append(records, row[start+1:start+1+entityWidth])
+	}
+	return ids, records
+}
+
+// LiveEntitiesOutputFunction wraps another output function so that the named
+// population partitions are output as their live entities only, each as its ID
+// followed by its record, in ascending ID order. The rows written for these
+// partitions therefore vary in width with the population size; read them back with
+// ParseLiveEntitiesRow. Every other partition passes through unchanged.
+//
+// Usage hints:
+//   - Wrap a StateTimeStorageOutputFunction to store entity trajectories keyed by
+//     their stable IDs rather than by the slots they happen to occupy.
+type LiveEntitiesOutputFunction struct {
+	Sink       simulator.OutputFunction
+	Partitions []string
+	capacities map[string]int
+	row        []float64
+}
+
+func (l *LiveEntitiesOutputFunction) Configure(settings *simulator.Settings) {
+	l.capacities = make(map[string]int, len(l.Partitions))
+	for _, name := range l.Partitions {
+		found := false
+		for _, iteration := range settings.Iterations {
+			if iteration.Name == name {
+				l.capacities[name], _ = populationLayout(iteration)
+				found = true
+				break
+			}
+		}
+		if !found {
+			panic("population: live entities output partition " + name + " not found")
+		}
+	}
+	l.Sink.Configure(settings)
+}
+
+func (l *LiveEntitiesOutputFunction) Output(
+	partitionName string,
+	state []float64,
+	cumulativeTimesteps float64,
+) {
+	capacity, ok := l.capacities[partitionName]
+	if !ok {
+		l.Sink.Output(partitionName, state, cumulativeTimesteps)
+		return
+	}
+	ids, records := LiveEntities(state, capacity)
+	l.row = l.row[:0]
+	for i, id := range ids {
+		l.row = append(l.row, id)
+		l.row = append(l.row, records[i]...)
+	}
+	l.Sink.Output(partitionName, l.row, cumulativeTimesteps)
+}
+
+// Finalize finalizes the wrapped output function if it needs finalizing.
+func (l *LiveEntitiesOutputFunction) Finalize() {
+	if finalizing, ok := l.Sink.(simulator.FinalizingOutputFunction); ok {
+		finalizing.Finalize()
+	}
+}
+
+// PopulationCountReduction counts the live entities.
+func PopulationCountReduction(values []float64) float64 {
+	return float64(len(values))
+}
+
+// PopulationSumReduction sums a value over the live entities.
+func PopulationSumReduction(values []float64) float64 {
+	total := 0.0
+	for _, value := range values {
+		total += value
+	}
+	return total
+}
+
+// PopulationMeanReduction averages a value over the live entities, or returns 0
+// when there are none.
+func PopulationMeanReduction(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	return PopulationSumReduction(values) / float64(len(values))
+}
+
+// PopulationMaxReduction is the maximum of a value over the live entities, or 0
+// when there are none.
+func PopulationMaxReduction(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	max := values[0]
+	for _, value := range values[1:] {
+		if value > max {
+			max = value
+		}
+	}
+	return max
+}
+
+// PopulationMinReduction is the minimum of a value over the live entities, or 0
+// when there are none.
+func PopulationMinReduction(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	min := values[0]
+	for _, value := range values[1:] {
+		if value < min {
+			min = value
+		}
+	}
+	return min
+}
+
+// PopulationAggregationIteration reduces values over the live entities of a
+// population partition only, ignoring empty slots. It outputs one reduced value
+// per requested entity record index.
+//
+// Usage hints:
+//   - Provide params: "population_partition" (index) and "entity_value_indices"
+//     (indices into each entity's record).
+//   - Set Reduction, e.g. PopulationMeanReduction; PopulationCountReduction gives
+//     the population size whichever index it is applied to.
+type PopulationAggregationIteration struct {
+	Reduction   func(values []float64) float64
+	capacity    int
+	entityWidth int
+	values      []float64
+}
+
+func (p *PopulationAggregationIteration) Configure(
+	partitionIndex int,
+	settings *simulator.Settings,
+) {
+	population := int(settings.Iterations[partitionIndex].Params.GetIndex(
+		"population_partition", 0))
+	p.capacity, p.entityWidth = populationLayout(settings.Iterations[population])
+	p.values = make([]float64, 0, p.capacity)
+}
+
+func (p *PopulationAggregationIteration) Iterate(
+	params *simulator.Params,
+	partitionIndex int,
+	stateHistories []*simulator.StateHistory,
+	timestepsHistory *simulator.CumulativeTimestepsHistory,
+) []float64 {
+	state := stateHistories[int(params.GetIndex("population_partition", 0))].
+		Values.RawRowView(0)
+	indices := params.Get("entity_value_indices")
+	out := make([]float64, len(indices))
+	for i, index := range indices {
+		p.values = p.values[:0]
+		for slot := 0; slot < p.capacity; slot++ {
+			if state[slot] != 0 {
+				p.values = append(p.values,
+					state[2*p.capacity+slot*p.entityWidth+int(index)])
+			}
+		}
+		out[i] = p.Reduction(p.values)
+	}
+	return out
+}
@@ -0,0 +1,208 @@
+package general
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+	"gonum.org/v1/gonum/mat"
+)
+
+// ageingEntity ages each entity by one per step, has one offspring at age 2
+// and retires at age 4.
+type ageingEntity struct{}
+
+func (a *ageingEntity) Configure(partitionIndex int, settings *simulator.Settings) {}
+
+func (a *ageingEntity) Iterate(
+	params *simulator.Params,
+	partitionIndex int,
+	stateHistories []*simulator.StateHistory,
+	timestepsHistory *simulator.CumulativeTimestepsHistory,
+) []float64 {
+	age := stateHistories[partitionIndex].Values.At(0, 0) + 1
+	out := []float64{age, 0, 0}
+	if age >= 4 {
+		out[1] = 1
+	}
+	if age == 2 {
+		out[2] = 1
+	}
+	return out
+}
+
+func newPopulationImplementations(
+	entity simulator.Iteration,
+	output simulator.OutputFunction,
+	steps int,
+) *simulator.Implementations {
+	return &simulator.Implementations{
+		Iterations: []simulator.Iteration{
+			&PopulationIteration{Entity: entity},
+			&PopulationAggregationIteration{Reduction: PopulationMeanReduction},
+		},
+		OutputCondition: &simulator.EveryStepOutputCondition{},
+		OutputFunction:  output,
+		TerminationCondition: &simulator.NumberOfStepsTerminationCondition{
+			MaxNumberOfSteps: steps,
+		},
+		TimestepFunction: &simulator.ConstantTimestepFunction{Stepsize: 1.0},
+	}
+}
+
+func TestPopulation(t *testing.T) {
+	t.Run(
+		"test that entities are spawned and retired with stable ids",
+		func(t *testing.T) {
+			settings := simulator.LoadSettingsFromYaml("./population_settings.yaml")
+			store := simulator.NewStateTimeStorage()
+			output := &LiveEntitiesOutputFunction{
+				Sink:       &simulator.StateTimeStorageOutputFunction{Store: store},
+				Partitions: []string{"population"},
+			}
+			implementations := newPopulationImplementations(&ageingEntity{}, output, 3)
+			for index, iteration := range implementations.Iterations {
+				iteration.Configure(index, settings)
+			}
+			simulator.NewPartitionCoordinator(settings, implementations).Run()
+
+			// The first row is the initial [0, 1] of ids 1 and 2. Step 1 ages ids 1 and 2 to [1, 2] and id 2 has id 3; step 2 gives
+			// [2, 3, 1] and id 1 has id 4; step 3 retires id 2 and id 3 has id 5,
+			// which reuses the freed slot.
+			wantIDs := [][]float64{{1, 2}, {1, 2, 3}, {1, 2, 3, 4}, {1, 3, 4, 5}}
+			wantAges := [][]float64{{0, 1}, {1, 2, 0}, {2, 3, 1, 0}, {3, 2, 1, 0}}
+			rows := store.GetValues("population")
+			if len(rows) != len(wantIDs) {
+				t.Fatalf("got %d rows, want %d", len(rows), len(wantIDs))
+			}
+			for step, row := range rows {
+				ids, records := ParseLiveEntitiesRow(row, 1)
+				if len(ids) != len(wantIDs[step]) {
+					t.Fatalf("row %d: got ids %v, want %v", step, ids, wantIDs[step])
+				}
+				for i := range ids {
+					if ids[i] != wantIDs[step][i] || records[i][0] != wantAges[step][i] {
+						t.Errorf("row %d: got ids %v and records %v, want %v and %v",
+							step, ids, records, wantIDs[step], wantAges[step])
+						break
+					}
+				}
+			}
+
+			// The aggregation sees the population one step behind, over live slots only.
+			means := store.GetValues("population_aggregation")
+			for step, want := range []float64{0, 0.5, 1, 1.5} {
+				if means[step][0] != want {
+					t.Errorf("row %d: mean age %v, want %v", step, means[step][0], want)
+				}
+			}
+		},
+	)
+	t.Run(
+		"test that an expression iteration can be the entity",
+		func(t *testing.T) {
+			entity := &ExpressionIteration{
+				Fields: []ExpressionField{{Name: "age"}, {Name: "retire"}, {Name: "spawn"}},
+				Outputs: []string{
+					"age + 1",
+					"where(age + 1 >= 4, 1, 0)",
+					"where(age + 1 == 2, 1, 0)",
+				},
+			}
+			reference := simulator.NewStateTimeStorage()
+			store := simulator.NewStateTimeStorage()
+			for _, run := range []struct {
+				entity simulator.Iteration
+				store  *simulator.StateTimeStorage
+			}{{&ageingEntity{}, reference}, {entity, store}} {
+				settings := simulator.LoadSettingsFromYaml("./population_settings.yaml")
+				implementations := newPopulationImplementations(
+					run.entity,
+					&simulator.StateTimeStorageOutputFunction{Store: run.store},
+					6,
+				)
+				for index, iteration := range implementations.Iterations {
+					iteration.Configure(index, settings)
+				}
+				simulator.NewPartitionCoordinator(settings, implementations).Run()
+			}
+			want := reference.GetValues("population")
+			got := store.GetValues("population")
+			for step := range want {
+				for i := range want[step] {
+					if got[step][i] != want[step][i] {
+						t.Fatalf("row %d: got %v, want %v", step, got[step], want[step])
+					}
+				}
+			}
+		},
+	)
+	t.Run(
+		"test that exceeding capacity panics",
+		func(t *testing.T) {
+			settings := simulator.LoadSettingsFromYaml("./population_settings.yaml")
+			settings.Iterations[0].Params.Set("spawn_count", []float64{4})
+			population := &PopulationIteration{Entity: &ageingEntity{}}
+			population.Configure(0, settings)
+			history := &simulator.StateHistory{
+				Values:            mat.NewDense(1, 15, settings.Iterations[0].InitStateValues),
+				StateWidth:        15,
+				StateHistoryDepth: 1,
+			}
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic when spawning past capacity")
+				}
+			}()
+			population.Iterate(
+				&settings.Iterations[0].Params,
+				0,
+				[]*simulator.StateHistory{history},
+				&simulator.CumulativeTimestepsHistory{
+					Values:            mat.NewVecDense(1, nil),
+					StateHistoryDepth: 1,
+				},
+			)
+		},
+	)
+	t.Run(
+		"test that a spawn count without a newborn state is refused at configure",
+		func(t *testing.T) {
+			settings := simulator.LoadSettingsFromYaml("./population_settings.yaml")
+			settings.Iterations[0].Params.Set("spawn_count", []float64{1})
+			delete(settings.Iterations[0].Params.Map, "newborn_state")
+			defer func() {
+				message, _ := recover().(string)
+				if !strings.Contains(message, "no newborn_state") {
+					t.Errorf("got panic %q, want the missing newborn_state named", message)
+				}
+			}()
+			(&PopulationIteration{Entity: &ageingEntity{}}).Configure(0, settings)
+		},
+	)
+	t.Run(
+		"test that the population iteration runs with harnesses",
+		func(t *testing.T) {
+			settings := simulator.LoadSettingsFromYaml("./population_settings.yaml")
+			implementations := newPopulationImplementations(
+				&ageingEntity{}, &simulator.NilOutputFunction{}, 20)
+			if err := simulator.RunWithHarnesses(settings, implementations); err != nil {
+				t.Errorf("test harness failed: %v", err)
+			}
+		},
+	)
+	t.Run(
+		"test that the init state helper matches the layout",
+		func(t *testing.T) {
+			state := NewPopulationInitState(3, 2, [][]float64{{5, 6}, {7, 8}})
+			if len(state) != PopulationStateWidth(3, 2) {
+				t.Fatalf("width %d, want %d", len(state), PopulationStateWidth(3, 2))
+			}
+			ids, records := LiveEntities(state, 3)
+			if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 ||
+				records[0][1] != 6 || records[1][0] != 7 {
+				t.Errorf("got ids %v and records %v", ids, records)
+			}
+		},
+	)
+}
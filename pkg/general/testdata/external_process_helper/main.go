@@ -0,0 +1,85 @@
+// Command external_process_helper is the subprocess the external_process
+// iteration tests run. It speaks the protocol in
+// cmd/messages/external_process.proto and misbehaves on request, so the tests
+// can cover timeouts, crashes and restarts.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/umbralcalc/stochadex/pkg/general"
+)
+
+func main() {
+	mode := flag.String("mode", "drift", "drift (the default), sleep, crash, error or configure_error")
+	at := flag.Uint64("at", 0, "the step at which sleep, crash and error misbehave")
+	once := flag.String("once", "", "crash only if this marker file does not exist, then create it")
+	flag.Parse()
+
+	var seed uint64
+	for {
+		request := &general.ExternalProcessRequest{}
+		if err := general.ReadExternalProcessMessage(os.Stdin, request); err == io.EOF {
+			return
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, "helper:", err)
+			os.Exit(1)
+		}
+		response := &general.ExternalProcessResponse{}
+		if request.Type == general.ExternalProcessRequestType_EXTERNAL_PROCESS_REQUEST_TYPE_CONFIGURE {
+			seed = request.Seed
+			if *mode == "configure_error" {
+				response.Error = "cannot configure"
+			}
+		} else {
+			response.State = iterate(request, seed)
+			if request.Step == *at {
+				switch *mode {
+				case "sleep":
+					time.Sleep(time.Hour)
+				case "crash":
+					if _, err := os.Stat(*once); *once == "" || os.IsNotExist(err) {
+						if *once != "" {
+							os.WriteFile(*once, nil, 0o644)
+						}
+						fmt.Fprintln(os.Stderr, "helper: crashing as asked")
+						os.Exit(3)
+					}
+				case "error":
+					response = &general.ExternalProcessResponse{Error: "bad input"}
+				}
+			}
+		}
+		if err := general.WriteExternalProcessMessage(os.Stdout, response); err != nil {
+			os.Exit(1)
+		}
+	}
+}
+
+// iterate computes the next state: in echo mode a summary of the request, and
+// otherwise the partition's state plus drift times the timestep.
+func iterate(request *general.ExternalProcessRequest, seed uint64) []float64 {
+	histories := request.StateHistories
+	if len(histories) > 1 && histories[1].StateWidth > 0 {
+		other := histories[1]
+		return []float64{
+			float64(request.Step), request.Time, request.Timestep, float64(seed),
+			other.Values[0], float64(other.StateHistoryDepth),
+		}
+	}
+	var drift []float64
+	for _, param := range request.Params {
+		if param.Name == "drift" {
+			drift = param.Values
+		}
+	}
+	state := make([]float64, request.StateWidth)
+	for i := range state {
+		state[i] = histories[0].Values[i] + drift[i]*request.Timestep
+	}
+	return state
+}
@@ -10,8 +10,8 @@ import "sort"
 // blocked waiting for.
 //
 // Only ParamsInject edges are considered. A dependency cycle that routes
-// through a lag edge (a CrossHistory read, or a partition's assumed read of its
-// own history) is safe — the lag consumer reads the previous step's committed
+// through a lag edge (a CrossHistory read, a LaggedInject param, or a
+// partition's assumed read of its own history) is safe — the lag consumer reads the previous step's committed
 // value — and is the documented cycle-breaking pattern, so it is intentionally
 // excluded.
 func (g *Graph) InjectCycles() [][]int {
@@ -10,7 +10,7 @@
 //   - What depends on what? Build produces the full dependency graph for
 //     documentation and visualisation (see Mermaid / DOT).
 //
-// # Reliability: one edge class is exact, two are hints
+// # Reliability: two edge classes are exact, one is a hint
 //
 // The three edge kinds do not have the same relationship to config, and the
 // difference is load-bearing:
@@ -19,7 +19,12 @@
 //     coordinator builds a channel the consumer blocks on receiving before its
 //     Iterate even runs, so the dependency exists whether or not the iteration
 //     reads the injected param. These edges are exact — sound and complete —
-//     and are the only ones safe to assert on.
+//     and safe to assert on.
+//   - LaggedInject (from params_from_upstream with a lag: k) is equally
+//     engine-enforced, but the engine injects the source's committed state
+//     from k steps ago rather than its live output. It is exact, like
+//     ParamsInject, and lag-based, like CrossHistory, so it never takes part in
+//     a deadlock.
 //   - CrossHistory (from params_as_partitions) is declared capacity, not
 //     wiring. The actual read lives in iteration code, which config cannot see.
 //     It over-reports (a configured partition ref the iteration ignores) and
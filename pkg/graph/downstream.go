@@ -0,0 +1,33 @@
+package graph
+
+// Downstream returns the edges along which a value produced by the source
+// partition can spread: every edge whose source is reachable from it, in
+// breadth-first order from the source (and in Build's edge order within each
+// partition). It follows every edge kind, so CrossHistory edges contribute
+// partitions that may read the value rather than ones known to; a cycle
+// through a lag edge is followed once.
+//
+// It answers "what else did this value reach?" — the non-finite value
+// sentinel uses it to trace a NaN from the partition that produced it.
+func (g *Graph) Downstream(source int) []Edge {
+	outgoing := make([][]Edge, len(g.Names))
+	for _, e := range g.Edges {
+		outgoing[e.Source] = append(outgoing[e.Source], e)
+	}
+	visited := make([]bool, len(g.Names))
+	visited[source] = true
+	queue := []int{source}
+	var edges []Edge
+	for len(queue) > 0 {
+		partition := queue[0]
+		queue = queue[1:]
+		for _, e := range outgoing[partition] {
+			edges = append(edges, e)
+			if !visited[e.Target] {
+				visited[e.Target] = true
+				queue = append(queue, e.Target)
+			}
+		}
+	}
+	return edges
+}
@@ -17,6 +17,10 @@ const (
 	// CrossHistory is a lag>=1 dependency declared by params_as_partitions: the
 	// target may read the source partition's previous-step state history.
 	CrossHistory
+	// LaggedInject is a lag>=1 dependency declared by params_from_upstream with a
+	// lag: the source's committed state from that many steps ago is piped into
+	// the target's params. It imposes no computation order and cannot deadlock.
+	LaggedInject
 )
 
 // String returns a stable snake_case label for the edge kind.
@@ -26,6 +30,8 @@ func (k EdgeKind) String() string {
 		return "params_inject"
 	case CrossHistory:
 		return "cross_history"
+	case LaggedInject:
+		return "lagged_inject"
 	default:
 		return "unknown"
 	}
@@ -33,8 +39,9 @@ func (k EdgeKind) String() string {
 
 // Reliable reports whether this edge kind is derived from engine-enforced
 // wiring (exact) rather than declared capacity (a may-read hint). Only
-// ParamsInject edges are reliable, and only they should be asserted on.
-func (k EdgeKind) Reliable() bool { return k == ParamsInject }
+// ParamsInject and LaggedInject edges are reliable, and only they should be
+// asserted on.
+func (k EdgeKind) Reliable() bool { return k == ParamsInject || k == LaggedInject }
 
 // Edge is a directed dependency: the Target partition depends on the Source.
 type Edge struct {
@@ -46,7 +53,8 @@ type Edge struct {
 	// or params_as_partitions key).
 	Param string
 	// Window is the maximum readable lag: the source partition's state history
-	// depth for a CrossHistory edge, 0 for a within-step ParamsInject edge.
+	// depth for a CrossHistory edge, the exact lag for a LaggedInject edge and 0
+	// for a within-step ParamsInject edge.
 	Window int
 }
 
@@ -70,21 +78,26 @@ func Build(gen *simulator.ConfigGenerator) *Graph {
 	for target, name := range names {
 		cfg := gen.GetPartition(name)
 
-		// ParamsInject: exact within-step wiring from params_from_upstream.
+		// ParamsInject and LaggedInject: exact wiring from params_from_upstream,
+		// within-step unless the entry has a lag.
 		for _, param := range sortedKeys(cfg.ParamsFromUpstream) {
 			up := cfg.ParamsFromUpstream[param]
 			src, ok := index[up.Upstream]
 			if !ok {
 				continue
 			}
+			kind := ParamsInject
+			if up.Lag > 0 {
+				kind = LaggedInject
+			}
 			g.Edges = append(g.Edges, Edge{
 				Source:     src,
 				Target:     target,
 				SourceName: up.Upstream,
 				TargetName: name,
-				Kind:       ParamsInject,
+				Kind:       kind,
 				Param:      param,
-				Window:     0,
+				Window:     up.Lag,
 			})
 		}
 
@@ -203,3 +203,70 @@ func TestPastCopyMakesMutualLagAcyclic(t *testing.T) {
 		t.Errorf("live producer node must not carry the lag edge:\n%s", mermaid)
 	}
 }
+
+func TestLaggedInjectBreaksCycle(t *testing.T) {
+	// a and b inject into each other, but a's entry carries lag: 1, so it is a
+	// reliable LaggedInject edge rather than a within-step ParamsInject one and
+	// the mutual dependency is not a deadlock.
+	gen := newGen(
+		partition("a", 1,
+			map[string]simulator.NamedUpstreamConfig{"x": {Upstream: "b", Lag: 1}}, nil),
+		partition("b", 2,
+			map[string]simulator.NamedUpstreamConfig{"y": {Upstream: "a"}}, nil),
+	)
+	g := Build(gen)
+
+	lagged := Edge{Source: 1, Target: 0, SourceName: "b", TargetName: "a",
+		Kind: LaggedInject, Param: "x", Window: 1}
+	if !hasEdge(g, lagged) {
+		t.Errorf("missing lagged inject edge (window should be the lag); got %+v", g.Edges)
+	}
+	if !LaggedInject.Reliable() || LaggedInject.String() != "lagged_inject" {
+		t.Errorf("LaggedInject should be reliable and named lagged_inject, got %q",
+			LaggedInject.String())
+	}
+	if g.HasDeadlock() {
+		t.Errorf("cycle routed through a lagged inject must not be a deadlock; cycles=%v",
+			g.InjectCycles())
+	}
+
+	mermaid := g.Mermaid()
+	if !strings.Contains(mermaid, "n1past -->|x (lag 1)| n0") {
+		t.Errorf("expected solid lagged edge from past-copy node; got:\n%s", mermaid)
+	}
+	dot := g.DOT()
+	if !strings.Contains(dot, `n1past -> n0 [label="x (lag 1)"];`) {
+		t.Errorf("expected lagged edge from past-copy node in dot; got:\n%s", dot)
+	}
+}
+
+func TestDownstream(t *testing.T) {
+	// source -> middle (within-step) -> sink (lagged) -> middle (history read),
+	// plus an unrelated bystander
+	gen := newGen(
+		partition("bystander", 1, nil, nil),
+		partition("source", 1, nil, nil),
+		partition("middle", 1,
+			map[string]simulator.NamedUpstreamConfig{"driver": {Upstream: "source"}},
+			map[string][]string{"feedback": {"sink"}}),
+		partition("sink", 1,
+			map[string]simulator.NamedUpstreamConfig{"in": {Upstream: "middle", Lag: 1}},
+			nil),
+	)
+	g := Build(gen)
+	var got []string
+	for _, e := range g.Downstream(1) {
+		got = append(got, e.SourceName+"->"+e.TargetName+":"+e.Kind.String())
+	}
+	want := []string{
+		"source->middle:params_inject",
+		"middle->sink:lagged_inject",
+		"sink->middle:cross_history",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Downstream(source) = %v, want %v", got, want)
+	}
+	if edges := g.Downstream(0); len(edges) != 0 {
+		t.Errorf("expected nothing downstream of the bystander, got %v", edges)
+	}
+}
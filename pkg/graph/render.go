@@ -11,10 +11,11 @@ import (
 // card) with no external tooling.
 //
 // Edge styling encodes the reliability distinction from the package doc:
-//   - solid arrow  (-->)  : ParamsInject, the exact within-step wiring.
+//   - solid arrow  (-->)  : ParamsInject, the exact within-step wiring, and
+//     LaggedInject, the exact lagged wiring (labelled with its lag).
 //   - dashed arrow (-.->) : CrossHistory, the may-read hint.
 //
-// CrossHistory dependencies are reads of a partition's *past* committed state,
+// CrossHistory and LaggedInject dependencies are reads of a partition's *past* committed state,
 // not of its live within-step output. So that the rendered graph stays a DAG,
 // such an edge does not point back at the live producer node; instead each
 // producer read this way gets a distinct, differently coloured past-copy node
@@ -43,6 +44,8 @@ func (g *Graph) Mermaid() string {
 			fmt.Fprintf(&b, "  n%d -->|%s| n%d\n", e.Source, mermaidLabel(e.Param), e.Target)
 		case CrossHistory:
 			fmt.Fprintf(&b, "  n%dpast -.->|%s| n%d\n", e.Source, mermaidLabel(e.Param), e.Target)
+		case LaggedInject:
+			fmt.Fprintf(&b, "  n%dpast -->|%s| n%d\n", e.Source, mermaidLabel(lagLabel(e)), e.Target)
 		}
 	}
 	if len(pastSources) > 0 {
@@ -68,8 +71,8 @@ func (g *Graph) Mermaid() string {
 }
 
 // DOT renders the graph in Graphviz DOT for users who want a rendered image
-// (stochadex-graph --format dot ... | dot -Tsvg). CrossHistory reads of past
-// state render as differently coloured past-copy nodes, exactly as in Mermaid,
+// (stochadex-graph --format dot ... | dot -Tsvg). CrossHistory and LaggedInject
+// reads of past state render as differently coloured past-copy nodes, exactly as in Mermaid,
 // so the drawn graph is a DAG (see the Mermaid doc for the rationale).
 func (g *Graph) DOT() string {
 	var b strings.Builder
@@ -91,6 +94,8 @@ func (g *Graph) DOT() string {
 			fmt.Fprintf(&b, "  n%d -> n%d [label=%q];\n", e.Source, e.Target, e.Param)
 		case CrossHistory:
 			fmt.Fprintf(&b, "  n%dpast -> n%d [label=%q, style=dashed];\n", e.Source, e.Target, e.Param)
+		case LaggedInject:
+			fmt.Fprintf(&b, "  n%dpast -> n%d [label=%q];\n", e.Source, e.Target, lagLabel(e))
 		}
 	}
 	seen := make(map[int]bool)
@@ -107,13 +112,14 @@ func (g *Graph) DOT() string {
 }
 
 // crossHistorySources returns, in ascending index order, the distinct partition
-// indices that are read as past state via a CrossHistory edge. Each gets one
-// past-copy node in the rendered graph, shared by all its lag consumers.
+// indices that are read as past state via a CrossHistory or LaggedInject edge.
+// Each gets one past-copy node in the rendered graph, shared by all its lag
+// consumers.
 func (g *Graph) crossHistorySources() []int {
 	seen := make(map[int]bool)
 	srcs := make([]int, 0)
 	for _, e := range g.Edges {
-		if e.Kind == CrossHistory && !seen[e.Source] {
+		if (e.Kind == CrossHistory || e.Kind == LaggedInject) && !seen[e.Source] {
 			seen[e.Source] = true
 			srcs = append(srcs, e.Source)
 		}
@@ -122,6 +128,11 @@ func (g *Graph) crossHistorySources() []int {
 	return srcs
 }
 
+// lagLabel labels a LaggedInject edge with its param and lag.
+func lagLabel(e Edge) string {
+	return fmt.Sprintf("%s (lag %d)", e.Param, e.Window)
+}
+
 // mermaidLabel escapes a Mermaid edge label. Partition and param names in
 // stochadex are simple identifiers, but quotes and pipes would break the
 // flowchart syntax, so they are neutralised defensively.
@@ -0,0 +1,125 @@
+package inference
+
+import (
+	"github.com/umbralcalc/stochadex/pkg/general"
+	"github.com/umbralcalc/stochadex/pkg/rng"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// ExpressionLikelihoodDistribution is an observation model written as expressions rather than
+// Go. LogPDF scores the data against the params the comparing partition is handed — its own,
+// and whatever params_from_upstream brings in — and Sample generates data from them:
+//
+//	logpdf: "logpdf_negative_binomial(data, dispersion, dispersion / (dispersion + mean))"
+//	sample: "negative_binomial(dispersion, dispersion / (dispersion + mean))"
+//
+// Both also read t, dt and step. LogPDF reads the data as data, and a vector it gives is
+// summed, so the elementwise logpdf_ functions can be used as they are. Sample is optional
+// for a likelihood that only scores, and follows the usual width rule for its draws.
+//
+// Like the built-in likelihoods, it reads mean from the partition a mean_partition param
+// indexes when there is no mean param, and EvaluateLogLikeMeanGrad differentiates LogPDF
+// with respect to mean, so it can be fitted by gradient descent with no gradient written in
+// Go. That needs LogPDF to be differentiable; see general.ExpressionDerivative.
+type ExpressionLikelihoodDistribution struct {
+	// LogPDF is the log-likelihood of data.
+	LogPDF string
+	// Sample draws new data.
+	Sample string
+	// Bindings are ordered named intermediates both expressions can read.
+	Bindings []general.ExpressionBinding
+	// Functions are user-defined functions both expressions can call.
+	Functions []general.ExpressionFunction
+
+	logPDF   *general.ExpressionEvaluator
+	sample   *general.ExpressionEvaluator
+	gradient *general.ExpressionDerivative
+	clock    [3][]float64
+	ones     []float64
+}
+
+// SetSeed compiles the expressions and seeds their draws from the partition's seed. It panics
+// on an expression that cannot be compiled.
+func (e *ExpressionLikelihoodDistribution) SetSeed(
+	partitionIndex int,
+	settings *simulator.Settings,
+) {
+	sampler := rng.New(settings.Iterations[partitionIndex].Seed)
+	compile := func(expr string) *general.ExpressionEvaluator {
+		evaluator, err := general.NewExpressionEvaluator(expr, e.Bindings, e.Functions, false)
+		if err != nil {
+			panic("expression_likelihood: " + err.Error())
+		}
+		evaluator.SetSampler(sampler)
+		return evaluator
+	}
+	e.logPDF = compile(e.LogPDF)
+	gradient, err := general.NewExpressionDerivative(
+		e.LogPDF, e.Bindings, e.Functions, nil, []string{"mean"})
+	if err != nil {
+		panic("expression_likelihood: " + err.Error())
+	}
+	e.gradient = gradient
+	e.sample = nil
+	if e.Sample != "" {
+		e.sample = compile(e.Sample)
+	}
+	e.clock = [3][]float64{{0}, {0}, {0}}
+}
+
+func (e *ExpressionLikelihoodDistribution) SetParams(
+	params *simulator.Params,
+	partitionIndex int,
+	stateHistories []*simulator.StateHistory,
+	timestepsHistory *simulator.CumulativeTimestepsHistory,
+) {
+	e.clock[0][0] = timestepsHistory.Values.AtVec(0)
+	e.clock[1][0] = timestepsHistory.NextIncrement
+	e.clock[2][0] = float64(timestepsHistory.CurrentStepNumber)
+	var mean []float64
+	if _, ok := params.GetOk("mean"); !ok {
+		if index, ok := params.GetOk("mean_partition"); ok {
+			mean = stateHistories[int(index[0])].Values.RawRowView(0)
+		}
+	}
+	set := func(evaluator interface {
+		SetParams(*simulator.Params)
+		Set(string, []float64)
+	}) {
+		evaluator.SetParams(params)
+		for i, name := range []string{"t", "dt", "step"} {
+			evaluator.Set(name, e.clock[i])
+		}
+		evaluator.Set("mean", mean)
+	}
+	set(e.logPDF)
+	set(e.gradient)
+	if e.sample != nil {
+		set(e.sample)
+	}
+}
+
+func (e *ExpressionLikelihoodDistribution) EvaluateLogLike(data []float64) float64 {
+	e.logPDF.Set("data", data)
+	logLike := 0.0
+	for _, v := range e.logPDF.Evaluate() {
+		logLike += v
+	}
+	return logLike
+}
+
+func (e *ExpressionLikelihoodDistribution) EvaluateLogLikeMeanGrad(data []float64) []float64 {
+	e.gradient.Set("data", data)
+	value := e.gradient.Evaluate()
+	for len(e.ones) < len(value) {
+		e.ones = append(e.ones, 1)
+	}
+	return append([]float64(nil), e.gradient.Reverse(e.ones[:len(value)])...)
+}
+
+func (e *ExpressionLikelihoodDistribution) GenerateNewSamples() []float64 {
+	if e.sample == nil {
+		panic("expression_likelihood: there is no sample expression to generate data with")
+	}
+	return append([]float64(nil), e.sample.Evaluate()...)
+}
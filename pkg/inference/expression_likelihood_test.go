@@ -0,0 +1,145 @@
+package inference
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/general"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+	"gonum.org/v1/gonum/mat"
+)
+
+func expressionLikelihoodSettings(params simulator.Params) *simulator.Settings {
+	return &simulator.Settings{
+		Iterations: []simulator.IterationSettings{{Name: "test", Params: params, Seed: 3}},
+	}
+}
+
+func TestExpressionLikelihoodDistribution(t *testing.T) {
+	timesteps := &simulator.CumulativeTimestepsHistory{
+		NextIncrement:     0.5,
+		Values:            mat.NewVecDense(1, []float64{2.0}),
+		CurrentStepNumber: 4,
+	}
+
+	t.Run("matches the Poisson likelihood it writes out", func(t *testing.T) {
+		params := simulator.NewParams(map[string][]float64{"mean": {1.5, 4.0, 0.3}})
+		settings := expressionLikelihoodSettings(params)
+		expression := &ExpressionLikelihoodDistribution{
+			LogPDF: "logpdf_poisson(data, mean)",
+			Sample: "poisson(mean)",
+		}
+		poisson := &PoissonLikelihoodDistribution{}
+		expression.SetSeed(0, settings)
+		poisson.SetSeed(0, settings)
+		expression.SetParams(&params, 0, nil, timesteps)
+		poisson.SetParams(&params, 0, nil, timesteps)
+		for _, data := range [][]float64{{0, 4, 1}, {3, 2, 0}} {
+			got, want := expression.EvaluateLogLike(data), poisson.EvaluateLogLike(data)
+			if math.Abs(got-want) > 1e-10 {
+				t.Errorf("data %v: got %v, want %v", data, got, want)
+			}
+		}
+		samples := expression.GenerateNewSamples()
+		if len(samples) != 3 {
+			t.Fatalf("got %d samples, want 3", len(samples))
+		}
+		for _, s := range samples {
+			if s < 0 || s != math.Floor(s) {
+				t.Errorf("sample %v is not a count", s)
+			}
+		}
+	})
+
+	t.Run("differentiates with respect to a mean from a partition", func(t *testing.T) {
+		params := simulator.NewParams(map[string][]float64{"mean_partition": {1}})
+		settings := expressionLikelihoodSettings(params)
+		stateHistories := []*simulator.StateHistory{nil, {
+			Values:            mat.NewDense(1, 3, []float64{1.5, 4.0, 0.3}),
+			StateWidth:        3,
+			StateHistoryDepth: 1,
+		}}
+		expression := &ExpressionLikelihoodDistribution{LogPDF: "logpdf_poisson(data, mean)"}
+		poisson := &PoissonLikelihoodDistribution{}
+		expression.SetSeed(0, settings)
+		poisson.SetSeed(0, settings)
+		expression.SetParams(&params, 0, stateHistories, timesteps)
+		poisson.SetParams(&params, 0, stateHistories, timesteps)
+		data := []float64{0, 4, 1}
+		if got, want := expression.EvaluateLogLike(data), poisson.EvaluateLogLike(data); math.Abs(
+			got-want) > 1e-10 {
+			t.Errorf("log-likelihood: got %v, want %v", got, want)
+		}
+		got, want := expression.EvaluateLogLikeMeanGrad(data), poisson.EvaluateLogLikeMeanGrad(data)
+		if len(got) != len(want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		for i := range want {
+			if math.Abs(got[i]-want[i]) > 1e-12 {
+				t.Errorf("element %d: got %v, want %v", i, got[i], want[i])
+			}
+		}
+	})
+
+	t.Run("reads the clock, bindings and functions", func(t *testing.T) {
+		params := simulator.NewParams(map[string][]float64{"rate": {2}})
+		likelihood := &ExpressionLikelihoodDistribution{
+			LogPDF:   "logpdf_normal(data, centre, 1)",
+			Bindings: []general.ExpressionBinding{{Name: "centre", Expr: "drift(rate, t, dt, step)"}},
+			Functions: []general.ExpressionFunction{{
+				Name: "drift", Params: []string{"r", "a", "b", "c"}, Expr: "r * a + b + c",
+			}},
+		}
+		likelihood.SetSeed(0, expressionLikelihoodSettings(params))
+		likelihood.SetParams(&params, 0, nil, timesteps)
+		// centre = 2 * 2.0 + 0.5 + 4 = 8.5
+		if got := likelihood.EvaluateLogLike([]float64{8.5}); math.Abs(
+			got+0.5*math.Log(2*math.Pi)) > 1e-12 {
+			t.Errorf("got %v, want the standard normal's peak", got)
+		}
+	})
+
+	t.Run("the same seed gives the same samples", func(t *testing.T) {
+		params := simulator.NewParams(map[string][]float64{"mean": {10, 20}})
+		draw := func() []float64 {
+			likelihood := &ExpressionLikelihoodDistribution{
+				LogPDF: "logpdf_poisson(data, mean)",
+				Sample: "poisson(mean)",
+			}
+			likelihood.SetSeed(0, expressionLikelihoodSettings(params))
+			likelihood.SetParams(&params, 0, nil, timesteps)
+			return likelihood.GenerateNewSamples()
+		}
+		first, second := draw(), draw()
+		for i := range first {
+			if first[i] != second[i] {
+				t.Errorf("got %v then %v", first, second)
+				break
+			}
+		}
+	})
+
+	t.Run("panics without a sample expression or on a bad one", func(t *testing.T) {
+		params := simulator.NewParams(map[string][]float64{"mean": {1}})
+		for _, c := range []struct {
+			likelihood *ExpressionLikelihoodDistribution
+			want       string
+		}{
+			{&ExpressionLikelihoodDistribution{LogPDF: "logpdf_poisson(data, mean)"}, "sample"},
+			{&ExpressionLikelihoodDistribution{LogPDF: "logpdf_poisson(data,"}, "parsing"},
+		} {
+			func() {
+				defer func() {
+					r := recover()
+					if r == nil || !strings.Contains(r.(string), c.want) {
+						t.Errorf("got panic %v, want one mentioning %q", r, c.want)
+					}
+				}()
+				c.likelihood.SetSeed(0, expressionLikelihoodSettings(params))
+				c.likelihood.SetParams(&params, 0, nil, timesteps)
+				c.likelihood.GenerateNewSamples()
+			}()
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package inference
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+
+	"github.com/umbralcalc/stochadex/pkg/general"
+	"github.com/umbralcalc/stochadex/pkg/rng"
+)
+
+// ExpressionPrior is a prior written as expressions: LogPDF of the value x, and Sample, one
+// draw from it. A prior has no params, so both see only x, pi and the functions they are given.
+// Its support is wherever LogPDF is finite. It is not safe for concurrent use.
+type ExpressionPrior struct {
+	logPDF *general.ExpressionEvaluator
+	sample *general.ExpressionEvaluator
+	x      []float64
+	rng    *rand.Rand
+}
+
+// NewExpressionPrior compiles a prior's log-density and sampler. Sample is one value by
+// construction, so a draw in it needs no iid or shared.
+func NewExpressionPrior(
+	logPDF, sample string,
+	functions []general.ExpressionFunction,
+) (*ExpressionPrior, error) {
+	p := &ExpressionPrior{x: []float64{0}}
+	var err error
+	if p.logPDF, err = general.NewExpressionEvaluator(logPDF, nil, functions, true); err != nil {
+		return nil, fmt.Errorf("logpdf: %w", err)
+	}
+	if p.sample, err = general.NewExpressionEvaluator(sample, nil, functions, true); err != nil {
+		return nil, fmt.Errorf("sample: %w", err)
+	}
+	p.logPDF.Set("x", p.x)
+	return p, nil
+}
+
+// Sample draws from r's stream, as the built-in priors do, rather than from a fresh one. r is
+// wrapped once for as long as the same generator is passed.
+func (p *ExpressionPrior) Sample(r *rand.Rand) float64 {
+	if r != p.rng {
+		p.rng = r
+		p.sample.SetSampler(rng.NewFromSource(r))
+	}
+	return p.sample.Evaluate()[0]
+}
+
+func (p *ExpressionPrior) LogPDF(x float64) float64 {
+	p.x[0] = x
+	return p.logPDF.Evaluate()[0]
+}
+
+func (p *ExpressionPrior) InSupport(x float64) bool {
+	logPDF := p.LogPDF(x)
+	return !math.IsInf(logPDF, -1) && !math.IsNaN(logPDF)
+}
+
+// ExpressionQuantilePrior is an ExpressionPrior with an inverse CDF, an expression of u, which
+// is what a design-driven SMC proposal needs.
+type ExpressionQuantilePrior struct {
+	*ExpressionPrior
+	inverseCDF *general.ExpressionEvaluator
+	u          []float64
+}
+
+// NewExpressionQuantilePrior compiles a prior with an inverse CDF as well.
+func NewExpressionQuantilePrior(
+	logPDF, sample, inverseCDF string,
+	functions []general.ExpressionFunction,
+) (*ExpressionQuantilePrior, error) {
+	prior, err := NewExpressionPrior(logPDF, sample, functions)
+	if err != nil {
+		return nil, err
+	}
+	p := &ExpressionQuantilePrior{ExpressionPrior: prior, u: []float64{0}}
+	if p.inverseCDF, err = general.NewExpressionEvaluator(
+		inverseCDF, nil, functions, true); err != nil {
+		return nil, fmt.Errorf("quantile: %w", err)
+	}
+	p.inverseCDF.Set("u", p.u)
+	return p, nil
+}
+
+func (p *ExpressionQuantilePrior) Quantile(u float64) float64 {
+	p.u[0] = u
+	return p.inverseCDF.Evaluate()[0]
+}
@@ -0,0 +1,80 @@
+package inference
+
+import (
+	"math"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/general"
+	"gonum.org/v1/gonum/floats"
+)
+
+func TestExpressionPrior(t *testing.T) {
+	t.Run("matches the uniform prior it writes out", func(t *testing.T) {
+		p, err := NewExpressionQuantilePrior(
+			"where(x >= -1 && x <= 2, -log(3), log(0))",
+			"uniform(-1, 2)",
+			"-1 + 3 * u",
+			nil,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uniform := &UniformPrior{Lo: -1.0, Hi: 2.0}
+		for _, x := range []float64{-2, -1, 0.5, 2, 3} {
+			if got, want := p.LogPDF(x), uniform.LogPDF(x); got != want {
+				t.Errorf("LogPDF(%v): got %v, want %v", x, got, want)
+			}
+			if got, want := p.InSupport(x), uniform.InSupport(x); got != want {
+				t.Errorf("InSupport(%v): got %v, want %v", x, got, want)
+			}
+		}
+		for _, u := range []float64{0, 0.25, 1} {
+			if got, want := p.Quantile(u), uniform.Quantile(u); math.Abs(got-want) > 1e-12 {
+				t.Errorf("Quantile(%v): got %v, want %v", u, got, want)
+			}
+		}
+		r := rand.New(rand.NewPCG(42, 43))
+		samples := make([]float64, 10000)
+		for i := range samples {
+			samples[i] = p.Sample(r)
+			if !p.InSupport(samples[i]) {
+				t.Fatalf("sample %v out of support", samples[i])
+			}
+		}
+		if mean := floats.Sum(samples) / float64(len(samples)); math.Abs(mean-0.5) > 0.1 {
+			t.Errorf("mean %.4f, expected ~0.5", mean)
+		}
+	})
+
+	t.Run("draws from the generator it is given", func(t *testing.T) {
+		p, err := NewExpressionPrior("logpdf_normal(x, 0, s(1))", "normal(0, s(1))",
+			[]general.ExpressionFunction{{Name: "s", Params: []string{"v"}, Expr: "2 * v"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := p.Sample(rand.New(rand.NewPCG(1, 2)))
+		if again := p.Sample(rand.New(rand.NewPCG(1, 2))); again != first {
+			t.Errorf("the same generator state gave %v then %v", first, again)
+		}
+		if _, ok := interface{}(p).(QuantilePrior); ok {
+			t.Error("a prior without a quantile should not be a QuantilePrior")
+		}
+	})
+
+	t.Run("reports which expression failed", func(t *testing.T) {
+		if _, err := NewExpressionPrior("x +", "normal(0, 1)", nil); err == nil ||
+			!strings.HasPrefix(err.Error(), "logpdf") {
+			t.Errorf("got %v, want a logpdf error", err)
+		}
+		if _, err := NewExpressionPrior("x", "normal(0,", nil); err == nil ||
+			!strings.HasPrefix(err.Error(), "sample") {
+			t.Errorf("got %v, want a sample error", err)
+		}
+		if _, err := NewExpressionQuantilePrior("x", "x", "u *", nil); err == nil ||
+			!strings.HasPrefix(err.Error(), "quantile") {
+			t.Errorf("got %v, want a quantile error", err)
+		}
+	})
+}
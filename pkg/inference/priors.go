@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"math"
 	"math/rand/v2"
+
+	"gonum.org/v1/gonum/stat/distuv"
 )
 
 // Prior defines a 1D prior distribution for a model parameter.
@@ -13,6 +15,28 @@ type Prior interface {
 	InSupport(x float64) bool
 }
 
+// QuantilePrior is a Prior with an inverse CDF. It is what lets a prior consume a
+// quasi-random or Latin hypercube design from pkg/rng: a point u in (0,1) maps to the
+// prior value below which a fraction u of its mass lies, so a stratified design over the
+// unit cube becomes a stratified design over the prior. All of the built-in priors
+// implement it.
+type QuantilePrior interface {
+	Prior
+	Quantile(u float64) float64
+}
+
+// PriorQuantiles maps one unit-cube point through the inverse CDF of each prior, writing
+// the parameter values into out. It panics if a prior has no Quantile.
+func PriorQuantiles(priors []Prior, u []float64, out []float64) {
+	for j, prior := range priors {
+		quantilePrior, ok := prior.(QuantilePrior)
+		if !ok {
+			panic(fmt.Sprintf("prior %d (%T) has no inverse CDF", j, prior))
+		}
+		out[j] = quantilePrior.Quantile(u[j])
+	}
+}
+
 // UniformPrior is a uniform distribution on [Lo, Hi].
 type UniformPrior struct {
 	Lo, Hi float64
@@ -33,6 +57,10 @@ func (p *UniformPrior) InSupport(x float64) bool {
 	return x >= p.Lo && x <= p.Hi
 }
 
+func (p *UniformPrior) Quantile(u float64) float64 {
+	return p.Lo + u*(p.Hi-p.Lo)
+}
+
 // TruncatedNormalPrior is a normal distribution truncated to [Lo, Hi].
 type TruncatedNormalPrior struct {
 	Mu, Sigma float64
@@ -61,6 +89,16 @@ func (p *TruncatedNormalPrior) InSupport(x float64) bool {
 	return x >= p.Lo && x <= p.Hi
 }
 
+// Quantile inverts the CDF of the truncated normal by rescaling u onto the untruncated
+// normal's CDF between the two bounds.
+func (p *TruncatedNormalPrior) Quantile(u float64) float64 {
+	lo := distuv.UnitNormal.CDF((p.Lo - p.Mu) / p.Sigma)
+	hi := distuv.UnitNormal.CDF((p.Hi - p.Mu) / p.Sigma)
+	x := p.Mu + p.Sigma*distuv.UnitNormal.Quantile(lo+u*(hi-lo))
+	// guard the rounding at a far-tail bound
+	return math.Min(math.Max(x, p.Lo), p.Hi)
+}
+
 // HalfNormalPrior is a half-normal distribution (x >= 0) with scale sigma.
 type HalfNormalPrior struct {
 	Sigma float64
@@ -82,6 +120,10 @@ func (p *HalfNormalPrior) InSupport(x float64) bool {
 	return x >= 0
 }
 
+func (p *HalfNormalPrior) Quantile(u float64) float64 {
+	return p.Sigma * distuv.UnitNormal.Quantile(0.5+0.5*u)
+}
+
 // LogNormalPrior is a log-normal distribution: log(x) ~ N(mu, sigma^2).
 type LogNormalPrior struct {
 	Mu, Sigma float64
@@ -104,6 +146,10 @@ func (p *LogNormalPrior) InSupport(x float64) bool {
 	return x > 0
 }
 
+func (p *LogNormalPrior) Quantile(u float64) float64 {
+	return math.Exp(p.Mu + p.Sigma*distuv.UnitNormal.Quantile(u))
+}
+
 // Prior type codes for params-based configuration.
 const (
 	PriorTypeUniform         = 0
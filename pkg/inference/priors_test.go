@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/stat/distuv"
 )
 
 func TestUniformPrior(t *testing.T) {
@@ -120,3 +121,35 @@ func TestEncodeDecodePriors(t *testing.T) {
 		}
 	}
 }
+
+func TestPriorQuantiles(t *testing.T) {
+	priors := []Prior{
+		&UniformPrior{Lo: -1.0, Hi: 2.0},
+		&TruncatedNormalPrior{Mu: 0.5, Sigma: 2.0, Lo: 0.0, Hi: 1.0},
+		&HalfNormalPrior{Sigma: 1.5},
+		&LogNormalPrior{Mu: 0.2, Sigma: 0.7},
+	}
+	cdfs := []func(x float64) float64{
+		func(x float64) float64 { return (x + 1.0) / 3.0 },
+		func(x float64) float64 {
+			lo := distuv.UnitNormal.CDF(-0.25)
+			hi := distuv.UnitNormal.CDF(0.25)
+			return (distuv.UnitNormal.CDF((x-0.5)/2.0) - lo) / (hi - lo)
+		},
+		func(x float64) float64 { return 2*distuv.UnitNormal.CDF(x/1.5) - 1 },
+		func(x float64) float64 { return distuv.UnitNormal.CDF((math.Log(x) - 0.2) / 0.7) },
+	}
+	for _, u := range []float64{1e-6, 0.1, 0.5, 0.9, 1 - 1e-6} {
+		point := []float64{u, u, u, u}
+		values := make([]float64, len(priors))
+		PriorQuantiles(priors, point, values)
+		for j, x := range values {
+			if !priors[j].InSupport(x) {
+				t.Errorf("prior %d: quantile(%v)=%v is outside the support", j, u, x)
+			}
+			if got := cdfs[j](x); math.Abs(got-u) > 1e-8 {
+				t.Errorf("prior %d: cdf(quantile(%v)) = %v", j, u, got)
+			}
+		}
+	}
+}
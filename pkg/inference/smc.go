@@ -6,6 +6,7 @@ import (
 	"math/rand/v2"
 	"sort"
 
+	"github.com/umbralcalc/stochadex/pkg/rng"
 	"github.com/umbralcalc/stochadex/pkg/simulator"
 )
 
@@ -27,6 +28,12 @@ type SMCResult struct {
 // from a multivariate normal centred on the previous posterior,
 // read from the posterior partition's state history.
 //
+// When Design is set, the step-1 prior draws are taken from a
+// quasi-random or Latin hypercube design (see pkg/rng) mapped through
+// each prior's inverse CDF rather than pseudo-randomly, which covers
+// the prior far more evenly for the same particle count. Every prior
+// must then implement QuantilePrior.
+//
 // State layout: [particle_params(N*d)] flattened row-major.
 // State width: N*d.
 //
@@ -39,8 +46,12 @@ type SMCResult struct {
 //	verbose:            [0 or 1]
 type SMCProposalIteration struct {
 	Priors []Prior
+	// Design optionally builds the unit-cube design the step-1 prior
+	// draws come from; nil draws pseudo-randomly from each prior.
+	Design rng.PointSamplerConstructor
 
 	rng                   *rand.Rand
+	design                rng.PointSampler
 	numParticles          int
 	nParams               int
 	posteriorPartitionIdx int
@@ -70,6 +81,16 @@ func (s *SMCProposalIteration) Configure(
 	}
 	s.nParams = len(s.Priors)
 	s.posteriorPartitionIdx = int(iterParams.GetIndex("posterior_partition", 0))
+	if s.Design != nil {
+		for j, prior := range s.Priors {
+			if _, ok := prior.(QuantilePrior); !ok {
+				panic(fmt.Sprintf(
+					"SMCProposalIteration: a design needs every prior to have "+
+						"an inverse CDF, but prior %d (%T) does not", j, prior))
+			}
+		}
+		s.design = s.Design(s.nParams, s.numParticles, seed)
+	}
 }
 
 func (s *SMCProposalIteration) Iterate(
@@ -83,7 +104,15 @@ func (s *SMCProposalIteration) Iterate(
 	d := s.nParams
 
 	particleParams := make([][]float64, N)
-	if round == 1 {
+	if round == 1 && s.design != nil {
+		u := make([]float64, d)
+		for p := range N {
+			pp := make([]float64, d)
+			s.design.Next(u)
+			PriorQuantiles(s.Priors, u, pp)
+			particleParams[p] = pp
+		}
+	} else if round == 1 {
 		for p := range N {
 			pp := make([]float64, d)
 			for j, prior := range s.Priors {
@@ -6,8 +6,10 @@ import (
 	"testing"
 
 	"github.com/umbralcalc/stochadex/pkg/general"
+	"github.com/umbralcalc/stochadex/pkg/rng"
 	"github.com/umbralcalc/stochadex/pkg/simulator"
 	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/stat/distuv"
 )
 
 func TestSMCHarness(t *testing.T) {
@@ -243,3 +245,52 @@ func TestSampleMultivariateNormal(t *testing.T) {
 		t.Errorf("sample mean[1]=%f, expected ~2.0", sMean[1])
 	}
 }
+
+func TestSMCProposalDesign(t *testing.T) {
+	t.Run(
+		"test that a design stratifies the first round over each prior",
+		func(t *testing.T) {
+			const n = 64
+			settings := &simulator.Settings{
+				Iterations: []simulator.IterationSettings{{
+					Name: "proposal",
+					Params: simulator.NewParams(map[string][]float64{
+						"num_particles":       {n},
+						"posterior_partition": {1},
+						"verbose":             {0},
+					}),
+					Seed: 3,
+				}},
+			}
+			priors := []Prior{
+				&UniformPrior{Lo: 0.0, Hi: 4.0},
+				&LogNormalPrior{Mu: 0.0, Sigma: 1.0},
+			}
+			proposal := &SMCProposalIteration{
+				Priors: priors,
+				Design: rng.LatinHypercubeConstructor,
+			}
+			proposal.Configure(0, settings)
+			timesteps := &simulator.CumulativeTimestepsHistory{CurrentStepNumber: 1}
+			state := proposal.Iterate(&settings.Iterations[0].Params, 0, nil, timesteps)
+			if len(state) != n*len(priors) {
+				t.Fatalf("state width %d, want %d", len(state), n*len(priors))
+			}
+			// Mapping each draw back through its prior's CDF must land one per stratum.
+			cdfs := []func(x float64) float64{
+				func(x float64) float64 { return x / 4.0 },
+				func(x float64) float64 { return distuv.UnitNormal.CDF(math.Log(x)) },
+			}
+			for j := range priors {
+				seen := make([]bool, n)
+				for p := range n {
+					k := int(cdfs[j](state[p*len(priors)+j]) * n)
+					if seen[k] {
+						t.Fatalf("prior %d: two particles share stratum %d", j, k)
+					}
+					seen[k] = true
+				}
+			}
+		},
+	)
+}
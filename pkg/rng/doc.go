@@ -38,6 +38,13 @@
 // (a stateful precomputed sampling heap) stay on distuv: the copied-algorithm maintenance
 // cost outweighs the small per-draw saving, and neither sits in a tight per-element loop.
 //
+// Quasi-random designs:
+// Alongside the pseudo-random Sampler, PointSampler yields points in the unit hypercube
+// from a scrambled Sobol sequence, a scrambled Halton sequence, or successive Latin
+// hypercube designs. These are for sweeps, sensitivity designs and low-variance integrals
+// over priors, where an even cover of the parameter space matters more than independence;
+// map a point through inverse CDFs (inference.QuantilePrior) to land it on a prior.
+//
 // Usage Patterns:
 //   - Create a Sampler in an iteration's Configure, seeded from the partition Seed, and
 //     keep it on the iteration struct; call its methods in Iterate
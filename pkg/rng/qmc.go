@@ -0,0 +1,318 @@
+package rng
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// PointSampler yields a sequence of points in the open unit hypercube (0,1)^d. It is the
+// interface the quasi-Monte Carlo sequences and Latin hypercube designs share, so a caller
+// that maps unit points through inverse CDFs (a prior sweep, a sensitivity design, a
+// low-variance integral over a prior) does not care which one it was handed.
+//
+// Points are strictly inside the cube, never on a face, so an inverse CDF with an infinite
+// tail (a normal quantile at 0 or 1) is always finite.
+type PointSampler interface {
+	// Dimension is the number of coordinates in each point.
+	Dimension() int
+	// Next writes the next point into point, which must have length Dimension.
+	Next(point []float64)
+}
+
+// PointSamplerConstructor builds a PointSampler of the given dimension that is expected to
+// be asked for size points, seeded from seed. size only matters to designs with a fixed
+// number of points (a Latin hypercube); the sequences ignore it. It is the func-typed form
+// iterations hold so that the dimension and size can be fixed in Configure, once the
+// partition's params are known.
+type PointSamplerConstructor func(dimension, size int, seed uint64) PointSampler
+
+// sobolMaxDimension is the number of dimensions sobolDirections can generate: the first,
+// which is the van der Corput sequence in base 2, plus one per primitive polynomial below.
+const sobolMaxDimension = 21
+
+// sobolPolynomials are the primitive polynomials and initial direction numbers for Sobol
+// dimensions 2 onwards, from Joe and Kuo's new-joe-kuo-6.21201 table. Degree is s, Coeffs
+// is a (the interior coefficients packed as bits), and M are the initial odd integers
+// m_1..m_s with m_k < 2^k.
+//
+// S. Joe and F. Y. Kuo, "Constructing Sobol sequences with better two-dimensional
+// projections", SIAM J. Sci. Comput. 30, 2635-2654 (2008).
+var sobolPolynomials = []struct {
+	Degree int
+	Coeffs uint32
+	M      []uint32
+}{
+	{1, 0, []uint32{1}},
+	{2, 1, []uint32{1, 3}},
+	{3, 1, []uint32{1, 3, 1}},
+	{3, 2, []uint32{1, 1, 1}},
+	{4, 1, []uint32{1, 1, 3, 3}},
+	{4, 4, []uint32{1, 3, 5, 13}},
+	{5, 2, []uint32{1, 1, 5, 5, 17}},
+	{5, 4, []uint32{1, 1, 5, 5, 5}},
+	{5, 7, []uint32{1, 1, 7, 11, 19}},
+	{5, 11, []uint32{1, 1, 5, 1, 1}},
+	{5, 13, []uint32{1, 1, 1, 3, 11}},
+	{5, 14, []uint32{1, 3, 5, 5, 31}},
+	{6, 1, []uint32{1, 3, 3, 9, 7, 49}},
+	{6, 13, []uint32{1, 1, 1, 15, 21, 21}},
+	{6, 16, []uint32{1, 3, 1, 13, 27, 49}},
+	{6, 19, []uint32{1, 1, 1, 15, 7, 5}},
+	{6, 22, []uint32{1, 3, 1, 15, 13, 25}},
+	{6, 25, []uint32{1, 1, 5, 5, 19, 61}},
+	{7, 1, []uint32{1, 3, 7, 11, 23, 15, 103}},
+	{7, 4, []uint32{1, 3, 7, 13, 13, 15, 69}},
+}
+
+// sobolDirections returns the 32 direction numbers of one Sobol dimension (0-indexed),
+// each left-aligned in a uint32 so that bit 31 is the first binary digit.
+func sobolDirections(dimension int) [32]uint32 {
+	var v [32]uint32
+	if dimension == 0 {
+		for k := range v {
+			v[k] = 1 << (31 - k)
+		}
+		return v
+	}
+	poly := sobolPolynomials[dimension-1]
+	s := poly.Degree
+	for k := 0; k < s; k++ {
+		v[k] = poly.M[k] << (31 - k)
+	}
+	for k := s; k < 32; k++ {
+		v[k] = v[k-s] ^ (v[k-s] >> s)
+		for j := 1; j < s; j++ {
+			if (poly.Coeffs>>(s-1-j))&1 == 1 {
+				v[k] ^= v[k-j]
+			}
+		}
+	}
+	return v
+}
+
+// SobolSequence is a scrambled Sobol low-discrepancy sequence in up to 21 dimensions.
+//
+// Each coordinate is Owen-scrambled with the hash-based nested uniform scramble of Burley
+// (2020), seeded per dimension from the sequence seed. Scrambling keeps the digital net
+// structure — every power-of-two prefix of the sequence is still exactly stratified in each
+// coordinate — while removing the unscrambled sequence's point at the origin and its
+// correlated low-dimensional projections, and it makes the sequence a randomised QMC rule:
+// independent seeds give independent, unbiased replicate estimates, which is how the error
+// of a QMC integral is estimated.
+//
+// Use power-of-two point counts. A Sobol prefix of any other length is still a good design,
+// but only the power-of-two prefixes carry the equidistribution guarantee.
+//
+// B. Burley, "Practical Hash-based Owen Scrambling", JCGT 9(4), 2020.
+type SobolSequence struct {
+	directions [][32]uint32
+	scramble   []uint32
+	index      uint32
+	state      []uint32
+}
+
+// NewSobolSequence returns a scrambled Sobol sequence of the given dimension. It panics if
+// dimension is outside 1..21.
+func NewSobolSequence(dimension int, seed uint64) *SobolSequence {
+	if dimension < 1 || dimension > sobolMaxDimension {
+		panic(fmt.Sprintf(
+			"rng: sobol dimension %d is outside the supported 1..%d",
+			dimension, sobolMaxDimension))
+	}
+	seeds := New(seed)
+	s := &SobolSequence{
+		directions: make([][32]uint32, dimension),
+		scramble:   make([]uint32, dimension),
+		state:      make([]uint32, dimension),
+	}
+	for d := range dimension {
+		s.directions[d] = sobolDirections(d)
+		s.scramble[d] = seeds.Rand().Uint32()
+	}
+	return s
+}
+
+// Dimension returns the number of coordinates in each point.
+func (s *SobolSequence) Dimension() int { return len(s.directions) }
+
+// Next writes the next point of the sequence into point. Points are generated in Gray-code
+// order, which visits the same set of points in each power-of-two prefix as natural order.
+func (s *SobolSequence) Next(point []float64) {
+	for d := range s.state {
+		point[d] = unitFromUint32(owenScramble(s.state[d], s.scramble[d]))
+	}
+	// advance the Gray-code state: flip the direction number of the lowest zero bit of index
+	c := bits.TrailingZeros32(^s.index)
+	for d := range s.state {
+		s.state[d] ^= s.directions[d][c]
+	}
+	s.index++
+}
+
+// owenScramble applies Burley's hash-based nested uniform scramble to a left-aligned 32-bit
+// fixed-point coordinate. Reversing the bits turns the Laine-Karras hash, whose output bit k
+// depends only on input bits 0..k, into a scramble where each digit is permuted depending
+// only on the digits before it — which is Owen's nested scramble.
+func owenScramble(x, seed uint32) uint32 {
+	x = bits.Reverse32(x)
+	x += seed
+	x ^= x * 0x6c50b47c
+	x ^= x * 0xb82f1e52
+	x ^= x * 0xc7afe638
+	x ^= x * 0x8d22f6e6
+	return bits.Reverse32(x)
+}
+
+// unitFromUint32 maps a 32-bit fixed-point coordinate to the centre of its cell, so the
+// result lies in the open interval (0,1).
+func unitFromUint32(x uint32) float64 {
+	return (float64(x) + 0.5) / (1 << 32)
+}
+
+// haltonPrimes are the bases of the first Halton dimensions.
+var haltonPrimes = []int{
+	2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47, 53, 59, 61, 67, 71,
+	73, 79, 83, 89, 97, 101, 103, 107, 109, 113, 127, 131, 137, 139, 149, 151,
+}
+
+// HaltonSequence is a scrambled Halton low-discrepancy sequence: coordinate d is the
+// radical inverse of the point index in the d-th prime base, with every digit position
+// passed through its own random permutation of the base's digits (Matoušek's random digit
+// scramble). Unscrambled Halton coordinates in neighbouring large bases are strongly
+// correlated for the first few hundred points; the scramble removes that while keeping the
+// one-dimensional stratification of each coordinate.
+//
+// Unlike Sobol, Halton has no preferred point counts, so it suits designs whose size is not
+// a power of two. It supports up to 36 dimensions.
+type HaltonSequence struct {
+	bases        []int
+	digits       []int
+	permutations [][][]int
+	index        uint64
+}
+
+// NewHaltonSequence returns a scrambled Halton sequence of the given dimension. It panics if
+// dimension is outside 1..36.
+func NewHaltonSequence(dimension int, seed uint64) *HaltonSequence {
+	if dimension < 1 || dimension > len(haltonPrimes) {
+		panic(fmt.Sprintf(
+			"rng: halton dimension %d is outside the supported 1..%d",
+			dimension, len(haltonPrimes)))
+	}
+	sampler := New(seed)
+	h := &HaltonSequence{
+		bases:        haltonPrimes[:dimension],
+		digits:       make([]int, dimension),
+		permutations: make([][][]int, dimension),
+	}
+	for d, base := range h.bases {
+		// enough digits that the last one resolves finer than a float64 can represent
+		h.digits[d] = int(math.Ceil(53 / math.Log2(float64(base))))
+		h.permutations[d] = make([][]int, h.digits[d])
+		for k := range h.permutations[d] {
+			h.permutations[d][k] = sampler.Rand().Perm(base)
+		}
+	}
+	return h
+}
+
+// Dimension returns the number of coordinates in each point.
+func (h *HaltonSequence) Dimension() int { return len(h.bases) }
+
+// Next writes the next point of the sequence into point.
+func (h *HaltonSequence) Next(point []float64) {
+	for d, base := range h.bases {
+		b := uint64(base)
+		n := h.index
+		value := 0.0
+		scale := 1.0 / float64(base)
+		for k := 0; k < h.digits[d]; k++ {
+			value += float64(h.permutations[d][k][n%b]) * scale
+			n /= b
+			scale /= float64(base)
+		}
+		// A permutation may send every digit to zero; nudge by half the finest cell so the
+		// point stays off the face of the cube.
+		point[d] = math.Min(value+0.5*scale*float64(base), math.Nextafter(1, 0))
+	}
+	h.index++
+}
+
+// LatinHypercubeDesign returns an n-point Latin hypercube design in dim dimensions: each
+// coordinate's n values fall one in each of the n equal-width strata of (0,1), in an
+// independent random order per coordinate, and uniformly within their stratum. Draws are
+// taken from sampler, so a design is reproducible from the sampler's seed.
+//
+// The result is row-major: design[i] is the i-th point.
+func LatinHypercubeDesign(n, dim int, sampler *Sampler) [][]float64 {
+	if n < 1 || dim < 1 {
+		panic(fmt.Sprintf("rng: latin hypercube needs n >= 1 and dim >= 1, got %d and %d", n, dim))
+	}
+	design := make([][]float64, n)
+	for i := range design {
+		design[i] = make([]float64, dim)
+	}
+	for d := 0; d < dim; d++ {
+		strata := sampler.Rand().Perm(n)
+		for i, stratum := range strata {
+			u := sampler.Float64()
+			// Float64 is in [0,1), so only the lower face needs guarding
+			if u == 0 {
+				u = 0.5
+			}
+			design[i][d] = (float64(stratum) + u) / float64(n)
+		}
+	}
+	return design
+}
+
+// LatinHypercube is a PointSampler over successive Latin hypercube designs of a fixed size:
+// the first size points form one design, the next size points a fresh independent design,
+// and so on. A caller that asks for exactly size points gets one stratified design.
+type LatinHypercube struct {
+	size    int
+	dim     int
+	sampler *Sampler
+	design  [][]float64
+	next    int
+}
+
+// NewLatinHypercube returns a Latin hypercube sampler producing designs of size points in
+// the given dimension.
+func NewLatinHypercube(dimension, size int, seed uint64) *LatinHypercube {
+	if size < 1 || dimension < 1 {
+		panic(fmt.Sprintf(
+			"rng: latin hypercube needs size >= 1 and dimension >= 1, got %d and %d",
+			size, dimension))
+	}
+	return &LatinHypercube{size: size, dim: dimension, sampler: New(seed)}
+}
+
+// Dimension returns the number of coordinates in each point.
+func (l *LatinHypercube) Dimension() int { return l.dim }
+
+// Next writes the next design point into point, generating a new design every size points.
+func (l *LatinHypercube) Next(point []float64) {
+	if l.design == nil || l.next == l.size {
+		l.design = LatinHypercubeDesign(l.size, l.dim, l.sampler)
+		l.next = 0
+	}
+	copy(point, l.design[l.next])
+	l.next++
+}
+
+// SobolConstructor is the PointSamplerConstructor for NewSobolSequence.
+func SobolConstructor(dimension, size int, seed uint64) PointSampler {
+	return NewSobolSequence(dimension, seed)
+}
+
+// HaltonConstructor is the PointSamplerConstructor for NewHaltonSequence.
+func HaltonConstructor(dimension, size int, seed uint64) PointSampler {
+	return NewHaltonSequence(dimension, seed)
+}
+
+// LatinHypercubeConstructor is the PointSamplerConstructor for NewLatinHypercube.
+func LatinHypercubeConstructor(dimension, size int, seed uint64) PointSampler {
+	return NewLatinHypercube(dimension, size, seed)
+}
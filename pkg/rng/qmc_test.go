@@ -0,0 +1,179 @@
+package rng
+
+import (
+	"math"
+	"testing"
+)
+
+// stratified reports whether the n values fall one in each of the n equal-width strata of
+// (0,1), the one-dimensional equidistribution every design here must have.
+func stratified(values []float64) bool {
+	n := len(values)
+	seen := make([]bool, n)
+	for _, v := range values {
+		if v <= 0 || v >= 1 {
+			return false
+		}
+		k := int(v * float64(n))
+		if seen[k] {
+			return false
+		}
+		seen[k] = true
+	}
+	return true
+}
+
+func column(points [][]float64, d int) []float64 {
+	out := make([]float64, len(points))
+	for i, p := range points {
+		out[i] = p[d]
+	}
+	return out
+}
+
+func take(s PointSampler, n int) [][]float64 {
+	points := make([][]float64, n)
+	for i := range points {
+		points[i] = make([]float64, s.Dimension())
+		s.Next(points[i])
+	}
+	return points
+}
+
+func TestSobolDirectionNumbersAreValid(t *testing.T) {
+	if len(sobolPolynomials)+1 != sobolMaxDimension {
+		t.Fatalf("%d polynomials for %d dimensions", len(sobolPolynomials), sobolMaxDimension)
+	}
+	for i, poly := range sobolPolynomials {
+		if len(poly.M) != poly.Degree {
+			t.Fatalf("dimension %d: %d initial direction numbers for degree %d",
+				i+2, len(poly.M), poly.Degree)
+		}
+		if poly.Coeffs >= 1<<(poly.Degree-1) && poly.Degree > 1 {
+			t.Errorf("dimension %d: coefficients %b do not fit degree %d", i+2, poly.Coeffs, poly.Degree)
+		}
+		for k, m := range poly.M {
+			if m%2 != 1 || m >= 1<<(k+1) {
+				t.Errorf("dimension %d: m_%d = %d must be odd and below 2^%d", i+2, k+1, m, k+1)
+			}
+		}
+	}
+}
+
+func TestSobolPowerOfTwoPrefixesAreStratified(t *testing.T) {
+	s := NewSobolSequence(sobolMaxDimension, 7)
+	points := take(s, 1024)
+	for _, n := range []int{2, 16, 256, 1024} {
+		for d := 0; d < s.Dimension(); d++ {
+			if !stratified(column(points[:n], d)) {
+				t.Fatalf("dimension %d: first %d points are not stratified", d, n)
+			}
+		}
+	}
+}
+
+func TestSobolFirstTwoDimensionsFormANet(t *testing.T) {
+	// The first two Sobol coordinates form a (0,m,2)-net: every 2^a by 2^b box with a+b=m
+	// holds exactly one of the first 2^m points, and scrambling preserves it.
+	const m = 8
+	points := take(NewSobolSequence(2, 99), 1<<m)
+	for a := 0; a <= m; a++ {
+		counts := make(map[[2]int]int)
+		for _, p := range points {
+			counts[[2]int{int(p[0] * float64(int(1)<<a)), int(p[1] * float64(int(1)<<(m-a)))}]++
+		}
+		if len(counts) != 1<<m {
+			t.Fatalf("boxes 2^-%d x 2^-%d: %d distinct occupied, want %d", a, m-a, len(counts), 1<<m)
+		}
+	}
+}
+
+func TestSobolSeedsGiveDifferentScrambles(t *testing.T) {
+	a := take(NewSobolSequence(3, 1), 4)
+	b := take(NewSobolSequence(3, 2), 4)
+	again := take(NewSobolSequence(3, 1), 4)
+	if a[0][0] == b[0][0] {
+		t.Error("different seeds gave the same first point")
+	}
+	for i := range a {
+		for d := range a[i] {
+			if a[i][d] != again[i][d] {
+				t.Fatalf("seed 1 is not reproducible at point %d, dimension %d", i, d)
+			}
+		}
+	}
+}
+
+func TestSobolIntegratesSmoothFunctionWell(t *testing.T) {
+	// The integral of prod_d 2*x_d over the unit cube is 1. A 4096-point scrambled Sobol rule
+	// should land far closer than the ~1/sqrt(n) a pseudo-random rule manages.
+	const n, dim = 4096, 5
+	s := NewSobolSequence(dim, 3)
+	point := make([]float64, dim)
+	total := 0.0
+	for i := 0; i < n; i++ {
+		s.Next(point)
+		f := 1.0
+		for _, x := range point {
+			f *= 2 * x
+		}
+		total += f
+	}
+	if err := math.Abs(total/n - 1); err > 1e-3 {
+		t.Errorf("integral estimate off by %v", err)
+	}
+}
+
+func TestHaltonPrefixesAreStratifiedInEachBase(t *testing.T) {
+	h := NewHaltonSequence(4, 11)
+	points := take(h, 625)
+	for d, base := range h.bases {
+		n := base
+		for n*base <= len(points) {
+			n *= base
+		}
+		if !stratified(column(points[:n], d)) {
+			t.Errorf("dimension %d (base %d): first %d points are not stratified", d, base, n)
+		}
+	}
+}
+
+func TestLatinHypercubeDesignIsStratified(t *testing.T) {
+	design := LatinHypercubeDesign(50, 6, New(5))
+	for d := 0; d < 6; d++ {
+		if !stratified(column(design, d)) {
+			t.Errorf("dimension %d is not one point per stratum", d)
+		}
+	}
+}
+
+func TestLatinHypercubeSamplerRestartsEachDesign(t *testing.T) {
+	l := NewLatinHypercube(3, 20, 8)
+	points := take(l, 40)
+	for _, block := range [][][]float64{points[:20], points[20:]} {
+		for d := 0; d < 3; d++ {
+			if !stratified(column(block, d)) {
+				t.Fatalf("dimension %d of a 20-point block is not stratified", d)
+			}
+		}
+	}
+	if points[0][0] == points[20][0] {
+		t.Error("the second design repeated the first")
+	}
+}
+
+func TestConstructorsSatisfyPointSampler(t *testing.T) {
+	for name, construct := range map[string]PointSamplerConstructor{
+		"sobol":           SobolConstructor,
+		"halton":          HaltonConstructor,
+		"latin_hypercube": LatinHypercubeConstructor,
+	} {
+		s := construct(4, 8, 1)
+		if s.Dimension() != 4 {
+			t.Errorf("%s: dimension %d, want 4", name, s.Dimension())
+		}
+		if !stratified(column(take(s, 8), 0)) {
+			t.Errorf("%s: first 8 points are not stratified", name)
+		}
+	}
+}
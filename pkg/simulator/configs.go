@@ -9,9 +9,15 @@ import (
 
 // UpstreamConfig is the YAML-loadable representation of a slice of data
 // from the output of a partition which is computationally upstream.
+//
+// Lag 0 (the default) injects the upstream's output from this step. Lag k >= 1
+// injects its committed state from k steps ago instead, read from its state
+// history, so the upstream must keep at least k rows and there is no
+// within-step dependency on it.
 type UpstreamConfig struct {
 	Upstream int   `yaml:"upstream"`
 	Indices  []int `yaml:"indices,omitempty"`
+	Lag      int   `yaml:"lag,omitempty"`
 }
 
 // IterationSettings is the YAML-loadable per-partition configuration.
@@ -65,12 +71,15 @@ type Implementations struct {
 	TerminationCondition TerminationCondition
 	TimestepFunction     TimestepFunction
 	ExecutionStrategy    ExecutionStrategy
+	NonFiniteCheck       NonFiniteCheck
+	NonFiniteTrace       func(partitionIndex int) []string
 }
 
 // NamedUpstreamConfig is like UpstreamConfig but refers to upstream by name.
 type NamedUpstreamConfig struct {
 	Upstream string `yaml:"upstream"`
 	Indices  []int  `yaml:"indices,omitempty"`
+	Lag      int    `yaml:"lag,omitempty"`
 }
 
 // PartitionConfig defines a partition to add to a simulation.
@@ -118,12 +127,20 @@ type SimulationConfig struct {
 	TimestepFunction     TimestepFunction
 	InitTimeValue        float64
 	ExecutionStrategy    ExecutionStrategy
+	// NonFiniteCheck opts into the non-finite value sentinel (see
+	// NonFiniteCheck). NonFiniteTrace, when set, is called with the index of
+	// the partition that produced the first non-finite value and returns the
+	// downstream dependency edges to report with it; the api sets it from the
+	// partition dependency graph.
+	NonFiniteCheck NonFiniteCheck
+	NonFiniteTrace func(partitionIndex int) []string
 }
 
 // SimulationConfigStrings is the YAML-loadable version of SimulationConfig. Each
 // component field is a ComponentSpec data spec ({type: ...}) resolved at load time
 // by the registry, needing no Go toolchain. ExecutionStrategy is optional and
-// resolves to nil (the default spawn-per-step policy) when omitted.
+// resolves to nil (the default spawn-per-step policy) when omitted, as is
+// NonFiniteCheck ("warn" or "halt"), which is off when omitted.
 type SimulationConfigStrings struct {
 	OutputCondition      ComponentSpec `yaml:"output_condition"`
 	OutputFunction       ComponentSpec `yaml:"output_function"`
@@ -131,6 +148,7 @@ type SimulationConfigStrings struct {
 	TimestepFunction     ComponentSpec `yaml:"timestep_function"`
 	InitTimeValue        float64       `yaml:"init_time_value"`
 	ExecutionStrategy    ComponentSpec `yaml:"execution_strategy,omitempty"`
+	NonFiniteCheck       string        `yaml:"non_finite_check,omitempty"`
 }
 
 // ResolveDataComponents returns a SimulationConfig with every component data spec
@@ -172,6 +190,10 @@ func (s *SimulationConfigStrings) ResolveDataComponents() (*SimulationConfig, er
 		return nil, err
 	}
 	config.ExecutionStrategy = resolvedStrategy
+	config.NonFiniteCheck, err = ParseNonFiniteCheck(s.NonFiniteCheck)
+	if err != nil {
+		return nil, err
+	}
 	return config, nil
 }
 
@@ -270,6 +292,8 @@ func (c *ConfigGenerator) GenerateConfigs() (*Settings, *Implementations) {
 		TerminationCondition: c.simulationConfig.TerminationCondition,
 		TimestepFunction:     c.simulationConfig.TimestepFunction,
 		ExecutionStrategy:    c.simulationConfig.ExecutionStrategy,
+		NonFiniteCheck:       c.simulationConfig.NonFiniteCheck,
+		NonFiniteTrace:       c.simulationConfig.NonFiniteTrace,
 	}
 	settings := Settings{
 		Iterations:    make([]IterationSettings, 0),
@@ -309,9 +333,24 @@ func (c *ConfigGenerator) GenerateConfigs() (*Settings, *Implementations) {
 						))
 					}
 				}
+				if partitionValues.Lag < 0 {
+					panic(fmt.Sprintf(
+						"params_from_upstream %q -> upstream %q: lag %d must not be negative",
+						paramsName, partitionValues.Upstream, partitionValues.Lag,
+					))
+				}
+				if partitionValues.Lag > upstreamCfg.StateHistoryDepth {
+					panic(fmt.Sprintf(
+						"params_from_upstream %q -> upstream %q: lag %d needs %q to keep "+
+							"at least %d rows of state history, but its state_history_depth is %d",
+						paramsName, partitionValues.Upstream, partitionValues.Lag,
+						partitionValues.Upstream, partitionValues.Lag, upstreamCfg.StateHistoryDepth,
+					))
+				}
 				paramsFromUpstream[paramsName] = UpstreamConfig{
 					Upstream: index,
 					Indices:  partitionValues.Indices,
+					Lag:      partitionValues.Lag,
 				}
 			} else {
 				panic("error converting upstream name: " + partitionValues.Upstream +
@@ -106,6 +106,54 @@ func TestConfigGenerator(t *testing.T) {
 			generator.GenerateConfigs()
 		},
 	)
+	t.Run(
+		"params_from_upstream rejects a lag deeper than the upstream history",
+		func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatal("expected panic for a lag beyond the upstream history depth")
+				}
+				if !strings.Contains(fmt.Sprint(r), "at least 3 rows") {
+					t.Fatalf("unexpected panic: %v", r)
+				}
+			}()
+			generator := NewConfigGenerator()
+			generator.SetSimulation(
+				&SimulationConfig{
+					OutputCondition: &NilOutputCondition{},
+					OutputFunction:  &NilOutputFunction{},
+					TerminationCondition: &NumberOfStepsTerminationCondition{
+						MaxNumberOfSteps: 2,
+					},
+					TimestepFunction: &ConstantTimestepFunction{Stepsize: 1.0},
+					InitTimeValue:    0.0,
+				},
+			)
+			generator.SetPartition(
+				&PartitionConfig{
+					Name:              "upstream",
+					Iteration:         &doublingProcessIteration{},
+					Params:            NewParams(make(map[string][]float64)),
+					InitStateValues:   []float64{0.0},
+					StateHistoryDepth: 2,
+				},
+			)
+			generator.SetPartition(
+				&PartitionConfig{
+					Name:      "downstream",
+					Iteration: &doublingProcessIteration{},
+					Params:    NewParams(make(map[string][]float64)),
+					ParamsFromUpstream: map[string]NamedUpstreamConfig{
+						"p": {Upstream: "upstream", Lag: 3},
+					},
+					InitStateValues:   []float64{0.0},
+					StateHistoryDepth: 1,
+				},
+			)
+			generator.GenerateConfigs()
+		},
+	)
 	t.Run(
 		"SetGlobalSeed assigns deterministic per-partition seeds",
 		func(t *testing.T) {
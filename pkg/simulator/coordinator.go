@@ -1,6 +1,8 @@
 package simulator
 
 import (
+	"context"
+	"io"
 	"sync"
 
 	"gonum.org/v1/gonum/mat"
@@ -76,7 +78,15 @@ type PartitionCoordinator struct {
 	RunStrategy          ExecutionStrategy
 	// OutputFunction is retained solely so Run can Finalize a sink that implements
 	// FinalizingOutputFunction; per-step output goes through the iterators.
-	OutputFunction  OutputFunction
+	OutputFunction OutputFunction
+	// NonFiniteCheck opts into the non-finite value sentinel, and
+	// NonFiniteTrace, if set, names what lies downstream of the partition it
+	// reports (see NonFiniteCheck).
+	NonFiniteCheck  NonFiniteCheck
+	NonFiniteTrace  func(partitionIndex int) []string
+	nonFinite       *NonFiniteError
+	nonFiniteHalt   *NonFiniteError
+	profiler        *Profiler
 	newWorkChannels [](chan *IteratorInputMessage)
 }
 
@@ -146,21 +156,33 @@ func (c *PartitionCoordinator) advanceTimestepsHistory() {
 }
 
 // Step performs one simulation tick under the default spawn-per-step execution:
-// compute dt, request iterations, then apply state/time updates. It is the
+// compute dt, request iterations, then apply state/time updates. If a partition
+// panicked, Step panics with its *SimulationError once both phases are done. It
+// is the
 // single-step primitive the SpawnPerStepExecution stepper delegates to; other
 // strategies advance a step through their own Stepper. Callers that want to
 // drive a step under the coordinator's configured strategy should use
 // NewStepper instead.
 func (c *PartitionCoordinator) Step(wg *sync.WaitGroup) {
+	stepStart := c.profiler.clock()
 	c.beginStep()
+	step := c.Shared.TimestepsHistory.CurrentStepNumber
 
 	// begin by requesting iterations for the next step and waiting
+	phaseStart := c.profiler.clock()
 	c.RequestMoreIterations(wg)
 	wg.Wait()
+	c.profiler.phase("iterate phase", step, phaseStart)
+	c.checkNonFinite()
 
 	// then implement the pending state and time updates to the histories
+	phaseStart = c.profiler.clock()
 	c.UpdateHistory(wg)
 	wg.Wait()
+	c.profiler.phase("update phase", step, phaseStart)
+	c.profiler.phase("step", step, stepStart)
+
+	c.raiseStepFailure()
 }
 
 // ReadyToTerminate returns whether the TerminationCondition is met.
@@ -197,14 +219,53 @@ func (c *PartitionCoordinator) NewStepper() Stepper {
 // Run advances the coordinator to termination under its configured RunStrategy
 // (a nil RunStrategy selects the default spawn-per-step two-phase execution).
 // It is the canonical run loop shared by every strategy: build a Stepper, step
-// until termination, then release the stepper.
+// until termination, then release the stepper and close the iterations (see
+// Close). A partition that panics makes Run panic with its *SimulationError
+// once the sink has been finalized.
 func (c *PartitionCoordinator) Run() {
-	stepper := c.NewStepper()
+	if err := c.RunContext(context.Background()); err != nil {
+		panic(err)
+	}
+}
+
+// RunContext is Run with cancellation: before each step it checks ctx, and
+// once ctx is cancelled or past its deadline it stops at that step boundary
+// and returns ctx.Err(). A partition that panics stops the run at the end of
+// the failed step with its *SimulationError, and so does a non-finite value
+// under NonFiniteHalt with its *NonFiniteError. Either way the output function is
+// finalized, so a cancelled or failed run still leaves a flushed, readable sink
+// holding every step that completed, and the iterations are closed. It returns
+// nil when the run reaches termination, or else the first error from Close.
+// Wiring the execution strategy cannot order returns its *ExecutionOrderError
+// before any step is taken.
+func (c *PartitionCoordinator) RunContext(ctx context.Context) error {
+	return c.run(ctx, true)
+}
+
+// run is RunContext, leaving the iterations open unless closeIterations is set,
+// for a caller that runs the same configured iterations again.
+func (c *PartitionCoordinator) run(ctx context.Context, closeIterations bool) (err error) {
+	if closeIterations {
+		defer func() {
+			if closeErr := c.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+	}
+	stepper, err := newStepperRecovering(c)
+	if err != nil {
+		return err
+	}
 	defer stepper.Close()
 
 	// terminate the for loop if the condition has been met
 	for !c.ReadyToTerminate() {
-		stepper.Step()
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		if err = StepRecovering(stepper); err != nil {
+			break
+		}
 	}
 
 	// Give a resource-holding sink its one chance to flush/seal once no further
@@ -213,6 +274,35 @@ func (c *PartitionCoordinator) Run() {
 	if f, ok := c.OutputFunction.(FinalizingOutputFunction); ok {
 		f.Finalize()
 	}
+	return err
+}
+
+// Close closes every iteration that implements io.Closer — one holding a
+// subprocess, a runtime or a file beyond the run — and returns the first error.
+// RunContext and Run call it when the run ends, however it ends; a caller that
+// drives a Stepper itself calls it once done. A closed iteration must be
+// configured again before it can iterate.
+func (c *PartitionCoordinator) Close() error {
+	iterations := make([]Iteration, len(c.Iterators))
+	for index, iterator := range c.Iterators {
+		iterations[index] = iterator.Iteration
+	}
+	return CloseIterations(iterations)
+}
+
+// CloseIterations closes each iteration that implements io.Closer, in order,
+// and returns the first error. An iteration that runs simulations of its own
+// calls it from its Close so the outer run's end reaches the inner iterations.
+func CloseIterations(iterations []Iteration) error {
+	var first error
+	for _, iteration := range iterations {
+		if closer, ok := iteration.(io.Closer); ok {
+			if err := closer.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
 }
 
 // NewPartitionCoordinator wires Settings and Implementations into a runnable
@@ -236,6 +326,10 @@ func NewPartitionCoordinator(
 	for _, iteration := range settings.Iterations {
 		valueChannels = append(valueChannels, make(chan []float64))
 		for _, values := range iteration.ParamsFromUpstream {
+			// lagged upstreams read committed history and listen on no channel
+			if values.Lag > 0 {
+				continue
+			}
 			_, ok := listenersByPartition[values.Upstream]
 			if !ok {
 				listenersByPartition[values.Upstream] = 0
@@ -262,11 +356,15 @@ func NewPartitionCoordinator(
 		)
 		upstreamByParams := make(map[string]*UpstreamStateValues)
 		for params, values := range iteration.ParamsFromUpstream {
-			upstreamByParams[params] = &UpstreamStateValues{
-				Channel:  valueChannels[values.Upstream],
+			upstream := &UpstreamStateValues{
 				Indices:  values.Indices,
 				Upstream: values.Upstream,
+				Lag:      values.Lag,
+			}
+			if values.Lag == 0 {
+				upstream.Channel = valueChannels[values.Upstream]
 			}
+			upstreamByParams[params] = upstream
 		}
 		iterators = append(
 			iterators,
@@ -304,6 +402,8 @@ func NewPartitionCoordinator(
 		TerminationCondition: implementations.TerminationCondition,
 		RunStrategy:          implementations.ExecutionStrategy,
 		OutputFunction:       implementations.OutputFunction,
+		NonFiniteCheck:       implementations.NonFiniteCheck,
+		NonFiniteTrace:       implementations.NonFiniteTrace,
 		newWorkChannels:      newWorkChannels,
 	}
 }
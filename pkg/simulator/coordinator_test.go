@@ -1,7 +1,10 @@
 package simulator
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 )
 
 // doublingProcessIteration defines an iteration which is only for
@@ -184,3 +187,106 @@ func TestPartitionCoordinator(t *testing.T) {
 		},
 	)
 }
+
+// cancellingIteration counts up by one each step and cancels a context from
+// inside the step numbered at, so a test knows exactly which step boundary a
+// run should stop at.
+type cancellingIteration struct {
+	cancel context.CancelFunc
+	at     int
+}
+
+func (c *cancellingIteration) Configure(partitionIndex int, settings *Settings) {}
+
+func (c *cancellingIteration) Iterate(
+	params *Params,
+	partitionIndex int,
+	stateHistories []*StateHistory,
+	timestepsHistory *CumulativeTimestepsHistory,
+) []float64 {
+	if timestepsHistory.CurrentStepNumber == c.at {
+		c.cancel()
+	}
+	return []float64{stateHistories[partitionIndex].Values.At(0, 0) + 1.0}
+}
+
+func TestRunContext(t *testing.T) {
+	newRun := func(
+		iteration Iteration,
+		strategy ExecutionStrategy,
+		sink OutputFunction,
+	) *PartitionCoordinator {
+		generator := NewConfigGenerator()
+		generator.SetPartition(&PartitionConfig{
+			Name:              "p",
+			Iteration:         iteration,
+			Params:            NewParams(make(map[string][]float64)),
+			InitStateValues:   []float64{0.0},
+			StateHistoryDepth: 1,
+		})
+		generator.SetSimulation(&SimulationConfig{
+			OutputCondition:      &EveryStepOutputCondition{},
+			OutputFunction:       sink,
+			TerminationCondition: &NumberOfStepsTerminationCondition{MaxNumberOfSteps: 100},
+			TimestepFunction:     &ConstantTimestepFunction{Stepsize: 1.0},
+			ExecutionStrategy:    strategy,
+		})
+		return NewPartitionCoordinator(generator.GenerateConfigs())
+	}
+
+	strategies := map[string]ExecutionStrategy{
+		"default":           nil,
+		"persistent worker": &PersistentWorkerExecution{},
+		"inline":            &InlineExecution{},
+	}
+	for name, strategy := range strategies {
+		t.Run(name+": stops at the step boundary after cancel", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			sink := &finalizeCountingOutput{}
+			coordinator := newRun(&cancellingIteration{cancel: cancel, at: 3}, strategy, sink)
+			err := coordinator.RunContext(ctx)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected context.Canceled, got %v", err)
+			}
+			// the cancelling step completes; no further step starts
+			if step := coordinator.Shared.TimestepsHistory.CurrentStepNumber; step != 3 {
+				t.Errorf("stopped after step %d, want 3", step)
+			}
+			if state := coordinator.Shared.StateHistories[0].Values.At(0, 0); state != 3.0 {
+				t.Errorf("state %v, want 3", state)
+			}
+			// the initial row plus one per completed step, then one Finalize
+			if sink.finalizeCalls != 1 || sink.rowsAtFinal != 4 {
+				t.Errorf("finalized %d times after %d rows, want once after 4",
+					sink.finalizeCalls, sink.rowsAtFinal)
+			}
+		})
+	}
+
+	t.Run("an expired deadline runs no steps", func(t *testing.T) {
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+		defer cancel()
+		sink := &finalizeCountingOutput{}
+		coordinator := newRun(&doublingProcessIteration{}, nil, sink)
+		if err := coordinator.RunContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+		}
+		if step := coordinator.Shared.TimestepsHistory.CurrentStepNumber; step != 0 {
+			t.Errorf("ran %d steps past the deadline", step)
+		}
+		if sink.finalizeCalls != 1 {
+			t.Errorf("Finalize called %d times, want 1", sink.finalizeCalls)
+		}
+	})
+
+	t.Run("a run to termination returns nil", func(t *testing.T) {
+		coordinator := newRun(&doublingProcessIteration{}, nil, &NilOutputFunction{})
+		if err := coordinator.RunContext(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if step := coordinator.Shared.TimestepsHistory.CurrentStepNumber; step != 100 {
+			t.Errorf("ran %d steps, want 100", step)
+		}
+	})
+}
@@ -1,6 +1,8 @@
 package simulator
 
 import (
+	"context"
+	"fmt"
 	"runtime"
 	"sync"
 )
@@ -37,45 +39,97 @@ func RunSeededEnsemble(
 	seeds []uint64,
 	maxConcurrency int,
 ) []EnsembleRun {
+	runs, err := RunSeededEnsembleContext(
+		context.Background(), build, seeds, maxConcurrency,
+	)
+	if err != nil {
+		panic(err)
+	}
+	return runs
+}
+
+// RunSeededEnsembleContext is RunSeededEnsemble with cancellation and error
+// returns. Each running member stops at its next step boundary once ctx is
+// done, and no further members start. A member whose build or configuration
+// panics is reported as an error naming its index and seed instead, and
+// cancels the members still running. Any error means no runs are returned:
+// the first member error, or ctx.Err() when the ensemble was cancelled.
+func RunSeededEnsembleContext(
+	ctx context.Context,
+	build func() *ConfigGenerator,
+	seeds []uint64,
+	maxConcurrency int,
+) ([]EnsembleRun, error) {
 	if maxConcurrency <= 0 {
 		maxConcurrency = runtime.GOMAXPROCS(0)
 	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	results := make([]EnsembleRun, len(seeds))
 	semaphore := make(chan struct{}, maxConcurrency)
 	var waitGroup sync.WaitGroup
+	var errOnce sync.Once
+	var memberErr error
 
+launch:
 	for runIndex, seed := range seeds {
+		select {
+		case <-ctx.Done():
+			break launch
+		case semaphore <- struct{}{}:
+		}
 		waitGroup.Add(1)
-		semaphore <- struct{}{}
 		go func(runIndex int, seed uint64) {
 			defer waitGroup.Done()
 			defer func() { <-semaphore }()
-			results[runIndex] = EnsembleRun{
-				Seed:    seed,
-				Storage: runSeededMember(build, seed),
+			storage, err := runSeededMember(ctx, build, seed)
+			if err != nil && ctx.Err() == nil {
+				errOnce.Do(func() {
+					memberErr = fmt.Errorf(
+						"ensemble member %d (seed %d): %w", runIndex, seed, err,
+					)
+					cancel()
+				})
+				return
 			}
+			results[runIndex] = EnsembleRun{Seed: seed, Storage: storage}
 		}(runIndex, seed)
 	}
 
 	waitGroup.Wait()
-	return results
+	if memberErr != nil {
+		return nil, memberErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
 }
 
 // runSeededMember builds one ensemble member, applies the seed, runs it to
-// termination and returns its recorded output.
+// termination (or until ctx is done) and returns its recorded output. A panic
+// while building or running the member is returned as its error.
 func runSeededMember(
+	ctx context.Context,
 	build func() *ConfigGenerator,
 	seed uint64,
-) *StateTimeStorage {
+) (storage *StateTimeStorage, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			storage, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
 	generator := build()
 	generator.SetGlobalSeed(seed)
 	settings, implementations := generator.GenerateConfigs()
-	storage := NewStateTimeStorage()
+	storage = NewStateTimeStorage()
 	implementations.OutputFunction = &StateTimeStorageOutputFunction{
 		Store: storage,
 	}
 	coordinator := NewPartitionCoordinator(settings, implementations)
-	coordinator.Run()
-	return storage
+	if err := coordinator.RunContext(ctx); err != nil {
+		return nil, err
+	}
+	return storage, nil
 }
@@ -0,0 +1,389 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// BatchIteration is an Iteration that can also advance one partition of every
+// member of a batched ensemble in a single call (see RunBatchedEnsemble).
+// Iterations that do not implement it are run member by member instead, so
+// implementing it is purely an optimisation: IterateBatch must leave every
+// member exactly where Iterate would have.
+type BatchIteration interface {
+	Iteration
+	IterateBatch(batch *IterationBatch)
+}
+
+// IterationBatch hands one partition of every active ensemble member to
+// IterateBatch. The partition's state histories of all members live in one
+// member-major block, History, and their next states in another, Next:
+// member m's history is the StateHistoryDepth x StateWidth row-major matrix
+// starting at m*StateHistoryDepth*StateWidth in History, and its next state
+// is the StateWidth values starting at m*StateWidth in Next.
+//
+// Every per-member slice is indexed by member, not by position in Members.
+// Iterations holds each member's own configured instance of the partition's
+// Iteration, so per-member state such as an RNG seeded from the member's seed
+// stays with its member; IterateBatch is called on the instance of the first
+// active member.
+type IterationBatch struct {
+	PartitionIndex    int
+	StateWidth        int
+	StateHistoryDepth int
+	// Members lists the members to advance this step in ascending order. A
+	// member drops out once its termination condition is met.
+	Members            []int
+	Iterations         []Iteration
+	Params             []*Params
+	StateHistories     [][]*StateHistory
+	TimestepsHistories []*CumulativeTimestepsHistory
+	History            []float64
+	// Next must be filled with each active member's next state. It is also
+	// every member's NextValues buffer for the partition, so an Iterate that
+	// uses GetNextStateRowToUpdate writes straight into it.
+	Next []float64
+}
+
+// State returns the latest state of member m (row 0 of its history).
+func (b *IterationBatch) State(m int) []float64 {
+	offset := m * b.StateHistoryDepth * b.StateWidth
+	return b.History[offset : offset+b.StateWidth]
+}
+
+// NextState returns the slice of Next that receives member m's next state.
+func (b *IterationBatch) NextState(m int) []float64 {
+	return b.Next[m*b.StateWidth : (m+1)*b.StateWidth]
+}
+
+// RunBatchedEnsemble runs the same ensemble as RunSeededEnsemble — one member
+// per seed, built and seeded identically and returned in the same shape — but
+// in lock-step inside a single goroutine rather than as one coordinator per
+// member. Every member takes step n before any takes step n+1, and each
+// partition's state histories for all members are held in one member-major
+// block, so a partition whose Iteration implements BatchIteration advances the
+// whole ensemble in a single IterateBatch call. Other partitions fall back to
+// a loop over members. Either way each member's output is identical to
+// RunSeededEnsemble's for the same seed.
+//
+// This removes the per-member goroutines and channels, which dominate the cost
+// of large ensembles of small models; for a few members with costly partitions,
+// RunSeededEnsemble's concurrency is the better choice. Partitions run in
+// within-step dependency order as under InlineExecution, and each member's
+// ExecutionStrategy is ignored. A member's termination condition drops it from
+// later steps without stopping the others.
+//
+// The build closure carries the same contract as for RunSeededEnsemble: it
+// must construct a fresh ConfigGenerator on every call, and every member must
+// have the same partitions with the same state widths and history depths.
+func RunBatchedEnsemble(
+	build func() *ConfigGenerator,
+	seeds []uint64,
+) []EnsembleRun {
+	runs, err := RunBatchedEnsembleContext(context.Background(), build, seeds)
+	if err != nil {
+		panic(err)
+	}
+	return runs
+}
+
+// RunBatchedEnsembleContext is RunBatchedEnsemble with cancellation and error
+// returns. The ensemble stops at the next step boundary once ctx is done. A
+// member whose build or configuration panics, or whose step fails, is reported
+// as an error naming its index and seed; a panicking IterateBatch is reported
+// as an error naming the partition. Any error means no runs are returned.
+func RunBatchedEnsembleContext(
+	ctx context.Context,
+	build func() *ConfigGenerator,
+	seeds []uint64,
+) ([]EnsembleRun, error) {
+	ensemble, err := newBatchedEnsemble(build, seeds)
+	if err != nil {
+		return nil, err
+	}
+	err = ensemble.run(ctx)
+	if closeErr := ensemble.close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]EnsembleRun, len(seeds))
+	for m, seed := range seeds {
+		runs[m] = EnsembleRun{Seed: seed, Storage: ensemble.storages[m]}
+	}
+	return runs, nil
+}
+
+// batchedEnsemble is the lock-step state of RunBatchedEnsemble: one
+// coordinator per member, used for its histories, params and output wiring
+// but never for its steppers.
+type batchedEnsemble struct {
+	seeds        []uint64
+	coordinators []*PartitionCoordinator
+	storages     []*StateTimeStorage
+	// order is the within-step dependency order of the partitions and
+	// batches holds, per partition, its batch or nil to loop over members.
+	order   []int
+	batches []*IterationBatch
+}
+
+// newBatchedEnsemble builds and seeds every member, then moves each
+// partition's histories into member-major blocks.
+func newBatchedEnsemble(
+	build func() *ConfigGenerator,
+	seeds []uint64,
+) (*batchedEnsemble, error) {
+	e := &batchedEnsemble{
+		seeds:        seeds,
+		coordinators: make([]*PartitionCoordinator, len(seeds)),
+		storages:     make([]*StateTimeStorage, len(seeds)),
+	}
+	for m, seed := range seeds {
+		coordinator, storage, err := newBatchedMember(build, seed)
+		if err != nil {
+			e.close()
+			return nil, fmt.Errorf("ensemble member %d (seed %d): %w", m, seed, err)
+		}
+		if m > 0 {
+			if err := sameEnsembleShape(e.coordinators[0], coordinator); err != nil {
+				coordinator.Close()
+				e.close()
+				return nil, fmt.Errorf("ensemble member %d (seed %d): %w", m, seed, err)
+			}
+		}
+		e.coordinators[m], e.storages[m] = coordinator, storage
+	}
+	if len(seeds) == 0 {
+		return e, nil
+	}
+
+	first := e.coordinators[0]
+	order, err := coordinatorWithinStepOrder(first)
+	if err != nil {
+		e.close()
+		return nil, fmt.Errorf("batched ensemble: %w", err)
+	}
+	e.order = order
+	e.batches = make([]*IterationBatch, len(first.Iterators))
+	for index := range first.Iterators {
+		e.batches[index] = e.newBlocks(index)
+	}
+	return e, nil
+}
+
+// newBatchedMember builds one seeded member as runSeededMember does, without
+// running it. A panic while building the member is returned as its error.
+func newBatchedMember(
+	build func() *ConfigGenerator,
+	seed uint64,
+) (coordinator *PartitionCoordinator, storage *StateTimeStorage, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			coordinator, storage, err = nil, nil, fmt.Errorf("%v", r)
+		}
+	}()
+	generator := build()
+	generator.SetGlobalSeed(seed)
+	settings, implementations := generator.GenerateConfigs()
+	storage = NewStateTimeStorage()
+	implementations.OutputFunction = &StateTimeStorageOutputFunction{
+		Store: storage,
+	}
+	return NewPartitionCoordinator(settings, implementations), storage, nil
+}
+
+// sameEnsembleShape checks that member has the partitions of first, in the
+// same order and with the same state widths and history depths.
+func sameEnsembleShape(first, member *PartitionCoordinator) error {
+	if len(member.Iterators) != len(first.Iterators) {
+		return fmt.Errorf("has %d partitions, member 0 has %d",
+			len(member.Iterators), len(first.Iterators))
+	}
+	for index, iterator := range member.Iterators {
+		want, got := first.Shared.StateHistories[index], member.Shared.StateHistories[index]
+		if iterator.Partition.Name != first.Iterators[index].Partition.Name ||
+			got.StateWidth != want.StateWidth ||
+			got.StateHistoryDepth != want.StateHistoryDepth {
+			return fmt.Errorf(
+				"partition %d is %q (width %d, depth %d), member 0 has %q (width %d, depth %d)",
+				index, iterator.Partition.Name, got.StateWidth, got.StateHistoryDepth,
+				first.Iterators[index].Partition.Name, want.StateWidth, want.StateHistoryDepth,
+			)
+		}
+	}
+	return nil
+}
+
+// newBlocks moves partition index of every member into member-major history
+// and next-state blocks, repointing each member's StateHistory at its slice of
+// them. It returns the partition's batch, or nil when its Iteration does not
+// implement BatchIteration.
+func (e *batchedEnsemble) newBlocks(index int) *IterationBatch {
+	first := e.coordinators[0].Shared.StateHistories[index]
+	width, depth := first.StateWidth, first.StateHistoryDepth
+	batch := &IterationBatch{
+		PartitionIndex:     index,
+		StateWidth:         width,
+		StateHistoryDepth:  depth,
+		Iterations:         make([]Iteration, len(e.coordinators)),
+		Params:             make([]*Params, len(e.coordinators)),
+		StateHistories:     make([][]*StateHistory, len(e.coordinators)),
+		TimestepsHistories: make([]*CumulativeTimestepsHistory, len(e.coordinators)),
+		History:            make([]float64, len(e.coordinators)*depth*width),
+		Next:               make([]float64, len(e.coordinators)*width),
+	}
+	batchable := width > 0
+	for m, coordinator := range e.coordinators {
+		iterator := coordinator.Iterators[index]
+		if _, ok := iterator.Iteration.(BatchIteration); !ok {
+			batchable = false
+		}
+		history := coordinator.Shared.StateHistories[index]
+		if width > 0 {
+			block := batch.History[m*depth*width : (m+1)*depth*width]
+			for row := 0; row < depth; row++ {
+				copy(block[row*width:(row+1)*width], history.Values.RawRowView(row))
+			}
+			history.Values = mat.NewDense(depth, width, block)
+			history.NextValues = batch.NextState(m)
+		}
+		batch.Iterations[m] = iterator.Iteration
+		batch.Params[m] = &iterator.Params
+		batch.StateHistories[m] = coordinator.Shared.StateHistories
+		batch.TimestepsHistories[m] = coordinator.Shared.TimestepsHistory
+	}
+	if !batchable {
+		return nil
+	}
+	return batch
+}
+
+// close closes every member built so far (see PartitionCoordinator.Close) and
+// returns the first error.
+func (e *batchedEnsemble) close() error {
+	var first error
+	for _, coordinator := range e.coordinators {
+		if coordinator == nil {
+			continue
+		}
+		if err := coordinator.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// run steps the active members in lock-step until every one has terminated.
+func (e *batchedEnsemble) run(ctx context.Context) error {
+	active := make([]int, 0, len(e.coordinators))
+	for {
+		active = active[:0]
+		for m, coordinator := range e.coordinators {
+			if !coordinator.ReadyToTerminate() {
+				active = append(active, m)
+			}
+		}
+		if len(active) == 0 {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := e.step(active); err != nil {
+			return err
+		}
+	}
+	for _, coordinator := range e.coordinators {
+		if f, ok := coordinator.OutputFunction.(FinalizingOutputFunction); ok {
+			f.Finalize()
+		}
+	}
+	return nil
+}
+
+// step advances the active members by one step: the same two phases as
+// InlineExecution, with each phase run across all members before the next.
+func (e *batchedEnsemble) step(active []int) error {
+	for _, m := range active {
+		e.coordinators[m].beginStep()
+	}
+	for _, index := range e.order {
+		if batch := e.batches[index]; batch != nil {
+			if err := e.iterateBatch(batch, active); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, m := range active {
+			coordinator := e.coordinators[m]
+			coordinator.Iterators[index].IteratePendingInline(coordinator.Shared)
+		}
+	}
+	for _, m := range active {
+		coordinator := e.coordinators[m]
+		coordinator.checkNonFinite()
+		for _, iterator := range coordinator.Iterators {
+			iterator.ApplyHistoryUpdate(coordinator.Shared)
+		}
+		coordinator.advanceTimestepsHistory()
+		if err := coordinator.takeStepFailure(); err != nil {
+			return fmt.Errorf("ensemble member %d (seed %d): %w", m, e.seeds[m], err)
+		}
+	}
+	return nil
+}
+
+// iterateBatch runs the iteration phase of one batched partition for the
+// active members: upstream params first, then IterateBatch, then each member's
+// output exactly as StateIterator.Iterate would emit it.
+func (e *batchedEnsemble) iterateBatch(batch *IterationBatch, active []int) error {
+	for _, m := range active {
+		coordinator := e.coordinators[m]
+		iterator := coordinator.Iterators[batch.PartitionIndex]
+		iterator.ValueChannels.UpdateUpstreamParamsInline(
+			&iterator.Params,
+			coordinator.Shared.StateHistories,
+		)
+		iterator.ValueChannels.UpdateLaggedUpstreamParams(
+			&iterator.Params,
+			coordinator.Shared.StateHistories,
+		)
+	}
+	batch.Members = active
+	if err := e.callIterateBatch(batch); err != nil {
+		return err
+	}
+	for _, m := range active {
+		iterator := e.coordinators[m].Iterators[batch.PartitionIndex]
+		timesteps := batch.TimestepsHistories[m]
+		values := batch.NextState(m)
+		if iterator.OutputCondition.IsOutputStep(iterator.Partition.Name, values, timesteps) {
+			iterator.OutputFunction.Output(iterator.Partition.Name, values,
+				timesteps.Values.AtVec(0)+timesteps.NextIncrement)
+		}
+	}
+	return nil
+}
+
+// callIterateBatch calls IterateBatch, recovering a panic into an error that
+// names the partition.
+func (e *batchedEnsemble) callIterateBatch(batch *IterationBatch) (err error) {
+	first := batch.Members[0]
+	defer func() {
+		if r := recover(); r != nil {
+			name := e.coordinators[first].Iterators[batch.PartitionIndex].Partition.Name
+			message := fmt.Sprintf("batched ensemble: partition %q (index %d) failed at step %d",
+				name, batch.PartitionIndex, batch.TimestepsHistories[first].CurrentStepNumber)
+			if cause, ok := r.(error); ok {
+				err = fmt.Errorf("%s: %w", message, cause)
+			} else {
+				err = fmt.Errorf("%s: %v", message, r)
+			}
+		}
+	}()
+	batch.Iterations[first].(BatchIteration).IterateBatch(batch)
+	return nil
+}
@@ -0,0 +1,289 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// batchedRandomWalkIteration is seededRandomWalkIteration with an IterateBatch
+// that advances every member from its own RNG, in the same draw order.
+type batchedRandomWalkIteration struct {
+	seededRandomWalkIteration
+	panicAt int
+}
+
+func (b *batchedRandomWalkIteration) IterateBatch(batch *IterationBatch) {
+	for _, m := range batch.Members {
+		if batch.TimestepsHistories[m].CurrentStepNumber == b.panicAt {
+			panic("walk exploded")
+		}
+		rng := batch.Iterations[m].(*batchedRandomWalkIteration).rng
+		state, next := batch.State(m), batch.NextState(m)
+		for i := range next {
+			next[i] = state[i] + rng.NormFloat64()
+		}
+	}
+}
+
+// escapeTermination stops a member once its first partition leaves [-2, 2] or
+// after maxSteps, so members of one ensemble terminate at different steps.
+type escapeTermination struct {
+	maxSteps int
+}
+
+func (e *escapeTermination) Terminate(
+	stateHistories []*StateHistory,
+	timestepsHistory *CumulativeTimestepsHistory,
+) bool {
+	return math.Abs(stateHistories[0].Values.At(0, 0)) > 2.0 ||
+		timestepsHistory.CurrentStepNumber >= e.maxSteps
+}
+
+// batchedEnsembleBuilder returns a member of two random walks ("walk" batched
+// when batched is set) feeding a consumer through a within-step edge and
+// another at lag 1, listed before them so the run must reorder partitions.
+func batchedEnsembleBuilder(batched bool, steps int) func() *ConfigGenerator {
+	return func() *ConfigGenerator {
+		var walk Iteration = &seededRandomWalkIteration{}
+		if batched {
+			walk = &batchedRandomWalkIteration{}
+		}
+		generator := NewConfigGenerator()
+		generator.SetSimulation(&SimulationConfig{
+			OutputCondition:      &EveryStepOutputCondition{},
+			OutputFunction:       &NilOutputFunction{},
+			TerminationCondition: &escapeTermination{maxSteps: steps},
+			TimestepFunction:     &ConstantTimestepFunction{Stepsize: 0.1},
+		})
+		generator.SetPartition(&PartitionConfig{
+			Name:      "echo",
+			Iteration: &paramEchoIteration{},
+			Params:    NewParams(make(map[string][]float64)),
+			ParamsFromUpstream: map[string]NamedUpstreamConfig{
+				"in": {Upstream: "walk"},
+			},
+			InitStateValues:   []float64{0.0, 0.0},
+			StateHistoryDepth: 1,
+		})
+		generator.SetPartition(&PartitionConfig{
+			Name:      "lagged",
+			Iteration: &paramEchoIteration{},
+			Params:    NewParams(make(map[string][]float64)),
+			ParamsFromUpstream: map[string]NamedUpstreamConfig{
+				"in": {Upstream: "walk", Lag: 1},
+			},
+			InitStateValues:   []float64{0.0, 0.0},
+			StateHistoryDepth: 1,
+		})
+		generator.SetPartition(&PartitionConfig{
+			Name:              "walk",
+			Iteration:         walk,
+			Params:            NewParams(make(map[string][]float64)),
+			InitStateValues:   []float64{0.0, 0.0},
+			StateHistoryDepth: 3,
+		})
+		return generator
+	}
+}
+
+// closingEchoIteration is paramEchoIteration counting the times it is closed.
+type closingEchoIteration struct {
+	paramEchoIteration
+	closed *int
+}
+
+func (c *closingEchoIteration) Close() error {
+	*c.closed++
+	return nil
+}
+
+func TestRunBatchedEnsemble(t *testing.T) {
+	seeds := []uint64{11, 22, 33, 44, 55, 66}
+	for name, build := range map[string]func() *ConfigGenerator{
+		"fallback loop":     ensembleBuilder(3, 25),
+		"fallback wiring":   batchedEnsembleBuilder(false, 40),
+		"batched iteration": batchedEnsembleBuilder(true, 40),
+	} {
+		t.Run(name+": each member matches RunSeededEnsemble", func(t *testing.T) {
+			expected := RunSeededEnsemble(build, seeds, 2)
+			runs := RunBatchedEnsemble(build, seeds)
+			if len(runs) != len(seeds) {
+				t.Fatalf("got %d runs, want %d", len(runs), len(seeds))
+			}
+			for i, run := range runs {
+				if run.Seed != seeds[i] {
+					t.Errorf("run %d seed = %d, want %d", i, run.Seed, seeds[i])
+				}
+				assertStoresEqual(t, expected[i].Storage, run.Storage,
+					name+"-"+strconv.Itoa(i))
+			}
+		})
+	}
+
+	t.Run("members terminate independently", func(t *testing.T) {
+		runs := RunBatchedEnsemble(batchedEnsembleBuilder(true, 40), seeds)
+		lengths := make(map[int]bool)
+		for _, run := range runs {
+			lengths[len(run.Storage.GetTimes())] = true
+		}
+		if len(lengths) < 2 {
+			t.Errorf("expected members to stop at different steps, got lengths %v", lengths)
+		}
+	})
+
+	t.Run("the histories are member-major blocks", func(t *testing.T) {
+		ensemble, err := newBatchedEnsemble(batchedEnsembleBuilder(true, 4), seeds[:3])
+		if err != nil {
+			t.Fatal(err)
+		}
+		batch := ensemble.batches[2]
+		if batch == nil || ensemble.batches[0] != nil {
+			t.Fatalf("expected only the walk to be batched, got %v", ensemble.batches)
+		}
+		if err := ensemble.run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		for m, coordinator := range ensemble.coordinators {
+			history := coordinator.Shared.StateHistories[2]
+			data := history.Values.RawMatrix().Data
+			if &data[0] != &batch.History[m*3*2] ||
+				history.Values.At(1, 1) != batch.History[m*3*2+3] ||
+				&history.NextValues[0] != &batch.Next[m*2] {
+				t.Errorf("member %d's history is not its slice of the block", m)
+			}
+		}
+	})
+
+	t.Run("a panicking IterateBatch names the partition", func(t *testing.T) {
+		build := func() *ConfigGenerator {
+			generator := batchedEnsembleBuilder(true, 40)()
+			generator.GetPartition("walk").Iteration =
+				&batchedRandomWalkIteration{panicAt: 2}
+			return generator
+		}
+		runs, err := RunBatchedEnsembleContext(context.Background(), build, seeds)
+		if runs != nil || err == nil ||
+			!strings.Contains(err.Error(), `partition "walk" (index 2) failed at step 2`) ||
+			!strings.Contains(err.Error(), "walk exploded") {
+			t.Errorf("unexpected result %v, %v", runs, err)
+		}
+	})
+
+	t.Run("a failing member is named with its seed", func(t *testing.T) {
+		calls := 0
+		build := func() *ConfigGenerator {
+			generator := ensembleBuilder(1, 5)()
+			// only the third member's counter reaches a step that panics
+			iteration := &panickingIteration{value: "boom"}
+			if calls++; calls == 3 {
+				iteration.at = 2
+			}
+			partition := generator.GetPartition("walk_0")
+			partition.Iteration = iteration
+			partition.InitStateValues = []float64{0.0}
+			return generator
+		}
+		_, err := RunBatchedEnsembleContext(context.Background(), build, seeds)
+		var simErr *SimulationError
+		if !errors.As(err, &simErr) || simErr.Step != 2 || simErr.Value != "boom" ||
+			!strings.HasPrefix(err.Error(), "ensemble member 2 (seed 33): ") {
+			t.Errorf("expected member 2's *SimulationError, got %v", err)
+		}
+	})
+
+	t.Run("members must share one shape", func(t *testing.T) {
+		calls := 0
+		build := func() *ConfigGenerator {
+			calls++
+			return ensembleBuilder(calls, 5)()
+		}
+		_, err := RunBatchedEnsembleContext(context.Background(), build, seeds)
+		if err == nil || !strings.Contains(err.Error(), "ensemble member 1 (seed 22)") {
+			t.Errorf("expected a shape error for member 1, got %v", err)
+		}
+	})
+
+	t.Run("a within-step cycle closes every member", func(t *testing.T) {
+		closed := 0
+		build := func() *ConfigGenerator {
+			generator := NewConfigGenerator()
+			generator.SetSimulation(&SimulationConfig{
+				OutputCondition:      &EveryStepOutputCondition{},
+				OutputFunction:       &NilOutputFunction{},
+				TerminationCondition: &NumberOfStepsTerminationCondition{MaxNumberOfSteps: 5},
+				TimestepFunction:     &ConstantTimestepFunction{Stepsize: 1.0},
+			})
+			for _, pair := range [][2]string{{"a", "b"}, {"b", "a"}} {
+				name, upstream := pair[0], pair[1]
+				generator.SetPartition(&PartitionConfig{
+					Name:      name,
+					Iteration: &closingEchoIteration{closed: &closed},
+					Params:    NewParams(make(map[string][]float64)),
+					ParamsFromUpstream: map[string]NamedUpstreamConfig{
+						"in": {Upstream: upstream},
+					},
+					InitStateValues:   []float64{0.0},
+					StateHistoryDepth: 1,
+				})
+			}
+			return generator
+		}
+		_, err := RunBatchedEnsembleContext(context.Background(), build, seeds)
+		var orderErr *ExecutionOrderError
+		if !errors.As(err, &orderErr) {
+			t.Fatalf("expected an *ExecutionOrderError, got %v", err)
+		}
+		if want := 2 * len(seeds); closed != want {
+			t.Errorf("closed %d iterations, want %d", closed, want)
+		}
+	})
+
+	t.Run("a cancelled context returns its error and no runs", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		runs, err := RunBatchedEnsembleContext(ctx, ensembleBuilder(2, 10), seeds)
+		if runs != nil || !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled and no runs, got %v, %v", runs, err)
+		}
+	})
+}
+
+func BenchmarkEnsemble(b *testing.B) {
+	seeds := make([]uint64, 2000)
+	for i := range seeds {
+		seeds[i] = uint64(i + 1)
+	}
+	builders := map[string]func() *ConfigGenerator{
+		"fallback": ensembleBuilder(2, 50),
+		"batched":  batchedBenchmarkBuilder(2, 50),
+	}
+	for _, name := range []string{"fallback", "batched"} {
+		build := builders[name]
+		b.Run("seeded/"+name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				RunSeededEnsemble(build, seeds, 0)
+			}
+		})
+		b.Run("batched/"+name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				RunBatchedEnsemble(build, seeds)
+			}
+		})
+	}
+}
+
+// batchedBenchmarkBuilder is ensembleBuilder with batched random walks.
+func batchedBenchmarkBuilder(numPartitions, steps int) func() *ConfigGenerator {
+	return func() *ConfigGenerator {
+		generator := ensembleBuilder(numPartitions, steps)()
+		for i := 0; i < numPartitions; i++ {
+			generator.GetPartition("walk_" + strconv.Itoa(i)).Iteration =
+				&batchedRandomWalkIteration{}
+		}
+		return generator
+	}
+}
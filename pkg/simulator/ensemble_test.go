@@ -1,8 +1,12 @@
 package simulator
 
 import (
+	"context"
+	"errors"
 	"math/rand/v2"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"gonum.org/v1/gonum/floats"
@@ -176,3 +180,47 @@ func TestRunSeededEnsembleMemberHarness(t *testing.T) {
 		t.Fatalf("RunWithHarnesses: %v", err)
 	}
 }
+
+func TestRunSeededEnsembleContext(t *testing.T) {
+	seeds := []uint64{11, 22, 33, 44}
+
+	t.Run("matches RunSeededEnsemble when not cancelled", func(t *testing.T) {
+		build := ensembleBuilder(2, 10)
+		runs, err := RunSeededEnsembleContext(context.Background(), build, seeds, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := RunSeededEnsemble(build, seeds, 2)
+		for i := range seeds {
+			assertStoresEqual(t, expected[i].Storage, runs[i].Storage,
+				"context-"+strconv.Itoa(i))
+		}
+	})
+
+	t.Run("a cancelled context returns its error and no runs", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		runs, err := RunSeededEnsembleContext(ctx, ensembleBuilder(2, 1_000_000), seeds, 2)
+		if !errors.Is(err, context.Canceled) || runs != nil {
+			t.Fatalf("expected context.Canceled and no runs, got %v, %v", err, runs)
+		}
+	})
+
+	t.Run("a member that panics is reported as an error", func(t *testing.T) {
+		inner := ensembleBuilder(2, 10)
+		var calls atomic.Int32
+		build := func() *ConfigGenerator {
+			// the third build panics, as a member with a bad config would
+			if calls.Add(1) == 3 {
+				panic("bad member config")
+			}
+			return inner()
+		}
+		_, err := RunSeededEnsembleContext(context.Background(), build, seeds, 1)
+		if err == nil ||
+			!strings.Contains(err.Error(), "ensemble member 2 (seed 33)") ||
+			!strings.Contains(err.Error(), "bad member config") {
+			t.Fatalf("expected an error naming member 2, got %v", err)
+		}
+	})
+}
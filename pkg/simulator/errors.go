@@ -0,0 +1,166 @@
+package simulator
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// SimulationError reports a panic raised while a partition was being stepped —
+// typically by its Iteration — with the context needed to find the cause: which
+// partition, at which step and time, with which params and from which state.
+//
+// Every execution strategy recovers such a panic on the goroutine that raised
+// it, lets the rest of the step complete (the failed partition's new state is
+// filled with NaN and still broadcast to its params_from_upstream consumers, so
+// no other worker is left blocked), and then raises the *SimulationError from
+// the Stepper's Step on the caller's goroutine. RunContext returns it as an
+// error; Run panics with it.
+//
+// A partition whose iteration runs an embedded simulation that fails reports
+// the inner *SimulationError as its Value, so errors.As finds either level.
+type SimulationError struct {
+	PartitionName  string
+	PartitionIndex int
+	// Step is the number of the step that failed (the first step is 1).
+	Step int
+	// Time is the cumulative time the failed step was advancing to.
+	Time float64
+	// Phase is "iterate" for a panic in the iteration phase (the Iteration or
+	// the output it triggers) or "update" for one applying the new state to the
+	// history, such as a state of the wrong width.
+	Phase string
+	// Params is a copy of the partition's params when the step failed.
+	Params map[string][]float64
+	// LastState is a copy of the partition's last committed state row.
+	LastState []float64
+	// Value is the value the partition panicked with.
+	Value any
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+// Error describes the failure on one line. The stack trace is kept in Stack
+// rather than the message.
+func (e *SimulationError) Error() string {
+	names := make([]string, 0, len(e.Params))
+	for name := range e.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	params := make([]string, len(names))
+	for i, name := range names {
+		params[i] = fmt.Sprintf("%s: %v", name, e.Params[name])
+	}
+	return fmt.Sprintf(
+		"simulator: partition %q (index %d) panicked in the %s phase of step %d "+
+			"(time %v): %v; params {%s}; last state %v",
+		e.PartitionName, e.PartitionIndex, e.Phase, e.Step, e.Time, e.Value,
+		strings.Join(params, ", "), e.LastState,
+	)
+}
+
+// Unwrap returns the panic value when it is an error, so errors.Is and
+// errors.As see through to it.
+func (e *SimulationError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// newSimulationError captures a recovered panic with the partition's context.
+// It must be called from the deferred recover on the panicking goroutine, so
+// that Stack is that goroutine's trace.
+func newSimulationError(
+	iterator *StateIterator,
+	inputMessage *IteratorInputMessage,
+	phase string,
+	value any,
+) *SimulationError {
+	params := make(map[string][]float64, len(iterator.Params.Map))
+	for name, values := range iterator.Params.Map {
+		params[name] = append([]float64(nil), values...)
+	}
+	timesteps := inputMessage.TimestepsHistory
+	return &SimulationError{
+		PartitionName:  iterator.Partition.Name,
+		PartitionIndex: iterator.Partition.Index,
+		Step:           timesteps.CurrentStepNumber,
+		Time:           timesteps.Values.AtVec(0) + timesteps.NextIncrement,
+		Phase:          phase,
+		Params:         params,
+		LastState: append([]float64(nil),
+			inputMessage.StateHistories[iterator.Partition.Index].Values.RawRowView(0)...),
+		Value: value,
+		Stack: debug.Stack(),
+	}
+}
+
+// raiseStepFailure panics on the caller's goroutine with the failure of the
+// lowest-indexed partition that failed during the step just completed, if any,
+// or else with the NonFiniteError that halts the run under NonFiniteHalt. Every
+// Stepper calls it at the end of Step, once no work is in flight. All recorded
+// failures are cleared first, so a caller that recovers and steps on is not
+// handed the same failure twice.
+func (c *PartitionCoordinator) raiseStepFailure() {
+	if err := c.takeStepFailure(); err != nil {
+		panic(err)
+	}
+}
+
+// takeStepFailure returns and clears the failure raiseStepFailure would raise.
+func (c *PartitionCoordinator) takeStepFailure() error {
+	var failure *SimulationError
+	for _, iterator := range c.Iterators {
+		if failure == nil {
+			failure = iterator.failure
+		}
+		iterator.failure = nil
+	}
+	if failure != nil {
+		return failure
+	}
+	if halt := c.nonFiniteHalt; halt != nil {
+		c.nonFiniteHalt = nil
+		return halt
+	}
+	return nil
+}
+
+// newStepperRecovering builds the coordinator's Stepper and returns the
+// *ExecutionOrderError a strategy raises when the within-step wiring admits no
+// order. Other panics propagate unchanged.
+func newStepperRecovering(c *PartitionCoordinator) (stepper Stepper, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			failure, ok := r.(*ExecutionOrderError)
+			if !ok {
+				panic(r)
+			}
+			err = failure
+		}
+	}()
+	return c.NewStepper(), nil
+}
+
+// StepRecovering runs one Step and returns the *SimulationError or
+// *NonFiniteError it raises, if any. Other panics propagate unchanged. It is
+// how RunContext steps, for a caller that drives a Stepper itself.
+func StepRecovering(stepper Stepper) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch failure := r.(type) {
+			case *SimulationError:
+				err = failure
+			case *NonFiniteError:
+				err = failure
+			default:
+				panic(r)
+			}
+		}
+	}()
+	stepper.Step()
+	return nil
+}
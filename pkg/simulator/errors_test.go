@@ -0,0 +1,175 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+// panickingIteration counts up by one each step and panics with value in the
+// step numbered at.
+type panickingIteration struct {
+	at    int
+	value any
+}
+
+func (p *panickingIteration) Configure(partitionIndex int, settings *Settings) {}
+
+func (p *panickingIteration) Iterate(
+	params *Params,
+	partitionIndex int,
+	stateHistories []*StateHistory,
+	timestepsHistory *CumulativeTimestepsHistory,
+) []float64 {
+	if timestepsHistory.CurrentStepNumber == p.at {
+		panic(p.value)
+	}
+	return []float64{stateHistories[partitionIndex].Values.At(0, 0) + 1.0}
+}
+
+// tooWideIteration returns a state one value wider than its partition's.
+type tooWideIteration struct{}
+
+func (w *tooWideIteration) Configure(partitionIndex int, settings *Settings) {}
+
+func (w *tooWideIteration) Iterate(
+	params *Params,
+	partitionIndex int,
+	stateHistories []*StateHistory,
+	timestepsHistory *CumulativeTimestepsHistory,
+) []float64 {
+	return make([]float64, stateHistories[partitionIndex].StateWidth+1)
+}
+
+// newFailingRun builds a run whose "failing" partition panics with value in
+// step 3, feeding a "consumer" partition through a within-step
+// params_from_upstream edge, alongside a healthy "bystander".
+func newFailingRun(value any, strategy ExecutionStrategy) *PartitionCoordinator {
+	generator := NewConfigGenerator()
+	generator.SetPartition(&PartitionConfig{
+		Name:              "bystander",
+		Iteration:         &doublingProcessIteration{},
+		Params:            NewParams(make(map[string][]float64)),
+		InitStateValues:   []float64{1.0},
+		StateHistoryDepth: 2,
+	})
+	generator.SetPartition(&PartitionConfig{
+		Name:              "failing",
+		Iteration:         &panickingIteration{at: 3, value: value},
+		Params:            NewParams(map[string][]float64{"rate": {0.5, 2.0}}),
+		InitStateValues:   []float64{0.0},
+		StateHistoryDepth: 2,
+	})
+	generator.SetPartition(&PartitionConfig{
+		Name:      "consumer",
+		Iteration: &paramEchoIteration{},
+		Params:    NewParams(make(map[string][]float64)),
+		ParamsFromUpstream: map[string]NamedUpstreamConfig{
+			"in": {Upstream: "failing"},
+		},
+		InitStateValues:   []float64{0.0},
+		StateHistoryDepth: 2,
+	})
+	generator.SetSimulation(&SimulationConfig{
+		OutputCondition:      &EveryStepOutputCondition{},
+		OutputFunction:       &NilOutputFunction{},
+		TerminationCondition: &NumberOfStepsTerminationCondition{MaxNumberOfSteps: 10},
+		TimestepFunction:     &ConstantTimestepFunction{Stepsize: 0.5},
+		ExecutionStrategy:    strategy,
+	})
+	return NewPartitionCoordinator(generator.GenerateConfigs())
+}
+
+func TestSimulationError(t *testing.T) {
+	strategies := map[string]ExecutionStrategy{
+		"default":           nil,
+		"persistent worker": &PersistentWorkerExecution{},
+		"inline":            &InlineExecution{},
+	}
+	for name, strategy := range strategies {
+		t.Run(name+": a panicking partition is reported with its context", func(t *testing.T) {
+			coordinator := newFailingRun("bad state", strategy)
+			err := coordinator.RunContext(context.Background())
+			var failure *SimulationError
+			if !errors.As(err, &failure) {
+				t.Fatalf("expected a *SimulationError, got %v", err)
+			}
+			if failure.PartitionName != "failing" || failure.PartitionIndex != 1 ||
+				failure.Step != 3 || failure.Time != 1.5 || failure.Phase != "iterate" ||
+				failure.Value != "bad state" || len(failure.Stack) == 0 {
+				t.Errorf("unexpected failure: %+v", failure)
+			}
+			if rate := failure.Params["rate"]; len(rate) != 2 || rate[1] != 2.0 {
+				t.Errorf("unexpected params snapshot: %v", failure.Params)
+			}
+			if len(failure.LastState) != 1 || failure.LastState[0] != 2.0 {
+				t.Errorf("last state %v, want [2]", failure.LastState)
+			}
+			for _, want := range []string{`"failing"`, "step 3", "bad state", "rate: [0.5 2]"} {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("%q does not mention %s", err.Error(), want)
+				}
+			}
+			// the failed step still completes for every partition, with the
+			// failed partition's new state and all it feeds marked NaN, and
+			// the run stops
+			if step := coordinator.Shared.TimestepsHistory.CurrentStepNumber; step != 3 {
+				t.Errorf("stopped after step %d, want 3", step)
+			}
+			for index, want := range []float64{8.0, math.NaN(), math.NaN()} {
+				state := coordinator.Shared.StateHistories[index].Values.At(0, 0)
+				if state != want && !(math.IsNaN(state) && math.IsNaN(want)) {
+					t.Errorf("partition %d state %v, want %v", index, state, want)
+				}
+			}
+			if state := coordinator.Shared.StateHistories[1].Values.At(1, 0); state != 2.0 {
+				t.Errorf("failing partition's last real state %v, want 2", state)
+			}
+		})
+	}
+
+	t.Run("an error panic value is unwrapped", func(t *testing.T) {
+		cause := errors.New("cause")
+		err := newFailingRun(cause, nil).RunContext(context.Background())
+		if !errors.Is(err, cause) {
+			t.Errorf("expected the panic value to be unwrapped, got %v", err)
+		}
+	})
+
+	t.Run("a state of the wrong width fails the update phase", func(t *testing.T) {
+		coordinator := newFailingRun(nil, &InlineExecution{})
+		coordinator.Iterators[0].Iteration = &tooWideIteration{}
+		var failure *SimulationError
+		if err := coordinator.RunContext(context.Background()); !errors.As(err, &failure) ||
+			failure.PartitionName != "bystander" || failure.Phase != "update" ||
+			failure.Step != 1 {
+			t.Errorf("unexpected failure: %v", err)
+		}
+	})
+
+	t.Run("Run panics with the *SimulationError", func(t *testing.T) {
+		defer func() {
+			if _, ok := recover().(*SimulationError); !ok {
+				t.Error("expected Run to panic with a *SimulationError")
+			}
+		}()
+		newFailingRun("bad state", &PersistentWorkerExecution{}).Run()
+	})
+
+	t.Run("a stepper raises the failure once", func(t *testing.T) {
+		coordinator := newFailingRun("bad state", nil)
+		stepper := coordinator.NewStepper()
+		defer stepper.Close()
+		failures := 0
+		for !coordinator.ReadyToTerminate() {
+			if StepRecovering(stepper) != nil {
+				failures++
+			}
+		}
+		if failures != 1 {
+			t.Errorf("raised %d failures, want 1", failures)
+		}
+	})
+}
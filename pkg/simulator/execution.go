@@ -47,8 +47,11 @@ type ExecutionStrategy interface {
 // Step advances by exactly one simulation tick — compute the next timestep
 // increment, run the iteration phase for every partition, then the update
 // phase — leaving the coordinator in the same committed state the default
-// algorithm reaches after one Step. Close releases resources and must be
-// called exactly once; Step must not be called after Close.
+// algorithm reaches after one Step. If a partition panicked during the step,
+// Step completes the step with that partition's new state filled with NaN and
+// then panics with its *SimulationError on the calling goroutine. Close
+// releases resources and must be called exactly once; Step must not be called
+// after Close.
 type Stepper interface {
 	Step()
 	Close()
@@ -158,23 +161,32 @@ func (s *persistentWorkerStepper) Step() {
 	c := s.coordinator
 	numPartitions := len(c.Iterators)
 
+	stepStart := c.profiler.clock()
 	c.beginStep()
+	step := c.Shared.TimestepsHistory.CurrentStepNumber
 
 	// iteration phase: wake every worker, then wait for all to finish
+	phaseStart := c.profiler.clock()
 	s.iterateWaitGroup.Add(numPartitions)
 	for _, channel := range c.newWorkChannels {
 		channel <- c.Shared
 	}
 	s.iterateWaitGroup.Wait()
+	c.profiler.phase("iterate phase", step, phaseStart)
+	c.checkNonFinite()
 
 	// update phase: wake every worker, then wait for all to finish
+	phaseStart = c.profiler.clock()
 	s.updateWaitGroup.Add(numPartitions)
 	for _, channel := range c.newWorkChannels {
 		channel <- c.Shared
 	}
 	s.updateWaitGroup.Wait()
+	c.profiler.phase("update phase", step, phaseStart)
 
 	c.advanceTimestepsHistory()
+	c.profiler.phase("step", step, stepStart)
+	c.raiseStepFailure()
 }
 
 // Close releases the persistent workers. Every worker is parked on an
@@ -184,7 +196,7 @@ func (s *persistentWorkerStepper) Close() { close(s.quit) }
 // InlineExecution runs the simulation entirely on the calling goroutine: no
 // worker goroutines, no channel handshakes and no WaitGroup barrier. Each step
 // runs the iteration phase for every partition and then the update phase for
-// every partition, in index order, by calling the iterators directly.
+// every partition by calling the iterators directly.
 //
 // This is the only strategy that synchronises nothing per step, so it is the
 // one that reaches serial speed when concurrency buys nothing — most obviously
@@ -193,15 +205,19 @@ func (s *persistentWorkerStepper) Close() { close(s.quit) }
 //
 // Within-step params_from_upstream edges are supported, but because inline
 // execution has no blocking channel handshake to wait on, every upstream
-// producer must be ordered before its downstream consumers: the producer's
-// staged output is read directly, so it must already have run this step.
-// NewStepper validates this up front and panics with a clear message if any
-// consumer is ordered before (or at the same index as) one of its upstreams —
-// which also catches cycles — rather than silently reading stale values.
-// Reorder the partitions so upstreams precede consumers, or use a concurrent
-// strategy. Partitions coupled only through state-history reads (which are
-// lag-based and need no within-step handshake) are unaffected by the ordering
-// rule.
+// producer must run its iteration phase before its downstream consumers: the
+// producer's staged output is read directly, so it must already have run this
+// step. NewStepper therefore topologically sorts the partitions by their
+// within-step edges and runs the iteration phase in that order, whatever order
+// the config lists them in. The sort is an execution order only: partition
+// indices, state histories and output are unaffected, and a config whose
+// upstreams already precede their consumers runs in plain index order. If the
+// within-step wiring is cyclic no such order exists, and NewStepper panics with
+// an *ExecutionOrderError naming the partitions involved rather than silently
+// reading stale values; RunContext returns it as the run's error.
+// Partitions coupled only through state-history reads (which are lag-based and
+// need no within-step handshake), including params_from_upstream entries with a
+// lag, impose no ordering.
 //
 // Output is byte-identical to the default strategy: the two phases are still
 // applied in order, so the iteration phase observes the previous step's
@@ -211,54 +227,58 @@ func (s *persistentWorkerStepper) Close() { close(s.quit) }
 // This strategy is stateless and safe to share across coordinators.
 type InlineExecution struct{}
 
-// NewStepper validates the partition ordering and returns a Stepper that
-// advances the coordinator inline on the calling goroutine. It panics if any
-// consumer is not ordered strictly after all of its upstreams (which also
-// rejects cycles and self-edges).
+// NewStepper sorts the partitions so every within-step upstream runs before its
+// consumers and returns a Stepper that advances the coordinator inline on the
+// calling goroutine in that order. It panics with an *ExecutionOrderError if the
+// within-step wiring is cyclic (including self-edges), since no order can then
+// be valid.
 func (e *InlineExecution) NewStepper(c *PartitionCoordinator) Stepper {
-	// Fail loudly instead of reading stale producer output if any consumer is
-	// not ordered strictly after all of its upstreams.
-	for consumerIndex, iterator := range c.Iterators {
-		for _, upstream := range iterator.ValueChannels.Upstreams {
-			if upstream.Upstream >= consumerIndex {
-				panic("InlineExecution requires upstreams to be ordered before " +
-					"their consumers: partition " + iterator.Partition.Name +
-					" reads an upstream that is not earlier in partition order; " +
-					"reorder the partitions or use a concurrent execution strategy")
-			}
-		}
+	order, err := coordinatorWithinStepOrder(c)
+	if err != nil {
+		panic(err)
 	}
-	return &inlineStepper{coordinator: c}
+	return &inlineStepper{coordinator: c, order: order}
 }
 
 // inlineStepper advances the coordinator on the calling goroutine with no
-// concurrency, so it holds no resources and Close is a no-op.
+// concurrency, so it holds no resources and Close is a no-op. order is the
+// within-step execution order of the iteration phase.
 type inlineStepper struct {
 	coordinator *PartitionCoordinator
+	order       []int
 }
 
 // Step advances the coordinator by one tick, running the iteration phase for
-// every partition and then the update phase for every partition, in index
-// order, on the calling goroutine.
+// every partition in dependency order and then the update phase for every
+// partition in index order, on the calling goroutine.
 func (s *inlineStepper) Step() {
 	c := s.coordinator
 
+	stepStart := c.profiler.clock()
 	c.beginStep()
+	step := c.Shared.TimestepsHistory.CurrentStepNumber
 
 	// iteration phase for every partition, then update phase for every
 	// partition: the same two-phase ordering as the default strategy, so a
 	// partition that reads another's history still sees the previous step's
 	// committed values. Upstream params are read directly from producers'
-	// staged output, which the ordering check guarantees is already set this
+	// staged output, which the dependency order guarantees is already set this
 	// step.
-	for _, iterator := range c.Iterators {
-		iterator.IteratePendingInline(c.Shared)
+	phaseStart := c.profiler.clock()
+	for _, index := range s.order {
+		c.Iterators[index].IteratePendingInline(c.Shared)
 	}
+	c.profiler.phase("iterate phase", step, phaseStart)
+	c.checkNonFinite()
+	phaseStart = c.profiler.clock()
 	for _, iterator := range c.Iterators {
 		iterator.ApplyHistoryUpdate(c.Shared)
 	}
+	c.profiler.phase("update phase", step, phaseStart)
 
 	c.advanceTimestepsHistory()
+	c.profiler.phase("step", step, stepStart)
+	c.raiseStepFailure()
 }
 
 // Close releases the stepper. Inline execution holds no long-lived resources,
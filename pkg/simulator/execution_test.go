@@ -1,6 +1,9 @@
 package simulator
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
 
 	"gonum.org/v1/gonum/floats"
@@ -148,9 +151,8 @@ func independentSettings(numPartitions int) (*Settings, func() []Iteration) {
 
 // misorderedSettings builds a topology whose within-step edge runs "backwards"
 // in partition order: partition_0 reads upstream partition_1. The channel
-// strategies handle this (the consumer blocks until the producer broadcasts),
-// but inline execution cannot, since it would read the producer's output
-// before the producer has run this step.
+// strategies handle this because the consumer blocks until the producer
+// broadcasts; inline execution handles it by running partition_1 first.
 func misorderedSettings() (*Settings, func() []Iteration) {
 	settings := &Settings{
 		Iterations: []IterationSettings{
@@ -299,21 +301,211 @@ func TestExecutionStrategies(t *testing.T) {
 			}
 		})
 
-	t.Run("InlineExecution panics on mis-ordered edges", func(t *testing.T) {
-		// A consumer ordered before its upstream is fine for the channel
-		// strategies (which block) but cannot be serviced inline; it must
-		// panic rather than read stale values.
+	t.Run("InlineExecution sorts mis-ordered edges", func(t *testing.T) {
+		// A consumer listed before its upstream is run after it inline, so the
+		// output matches the default strategy without reordering the config.
 		settings, makeIterations := misorderedSettings()
+		reference := runStrategyConfig(settings, makeIterations, maxSteps, nil)
+		got := runStrategyConfig(settings, makeIterations, maxSteps, &InlineExecution{})
+		assertStoresEqual(t, reference, got, "inline/misordered")
+		stepped := stepStrategyConfig(settings, makeIterations, maxSteps, &InlineExecution{})
+		assertStoresEqual(t, reference, stepped, "stepwise/inline/misordered")
+	})
+
+	t.Run("InlineExecution returns an error on a within-step cycle", func(t *testing.T) {
+		// With partition_1 also reading partition_0 within-step, no order can
+		// run both producers first; the run must fail rather than read stale
+		// values.
+		settings, makeIterations := misorderedSettings()
+		settings.Iterations[1].ParamsFromUpstream = map[string]UpstreamConfig{
+			"multipliers": {Upstream: 0},
+		}
+		iterations := makeIterations()
+		for index, iteration := range iterations {
+			iteration.Configure(index, settings)
+		}
+		coordinator := NewPartitionCoordinator(settings, &Implementations{
+			Iterations:      iterations,
+			OutputCondition: &EveryStepOutputCondition{},
+			OutputFunction:  &NilOutputFunction{},
+			TerminationCondition: &NumberOfStepsTerminationCondition{
+				MaxNumberOfSteps: maxSteps,
+			},
+			TimestepFunction:  &ConstantTimestepFunction{Stepsize: 1.0},
+			ExecutionStrategy: &InlineExecution{},
+		})
+		err := coordinator.RunContext(context.Background())
+		var orderErr *ExecutionOrderError
+		if !errors.As(err, &orderErr) {
+			t.Fatalf("expected an *ExecutionOrderError, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "partition_0, partition_1") {
+			t.Errorf("error should name the cyclic partitions, got: %v", err)
+		}
+	})
+}
+
+// laggedCycleSettings builds a two-partition cycle: partition_1 reads
+// partition_0 within-step, while partition_0 reads partition_1 through a lag-1
+// params_from_upstream entry. The lag breaks the cycle, so every strategy —
+// including inline, since the only within-step edge runs forwards — can run it.
+func laggedCycleSettings() (*Settings, func() []Iteration) {
+	settings := &Settings{
+		Iterations: []IterationSettings{
+			{
+				Name:   "partition_0",
+				Params: NewParams(make(map[string][]float64)),
+				ParamsFromUpstream: map[string]UpstreamConfig{
+					"multipliers": {Upstream: 1, Lag: 1},
+				},
+				InitStateValues:   []float64{1.1, 0.9},
+				StateWidth:        2,
+				StateHistoryDepth: 2,
+			},
+			{
+				Name:   "partition_1",
+				Params: NewParams(make(map[string][]float64)),
+				ParamsFromUpstream: map[string]UpstreamConfig{
+					"multipliers": {Upstream: 0},
+				},
+				InitStateValues:   []float64{0.95, 1.05},
+				StateWidth:        2,
+				StateHistoryDepth: 2,
+			},
+		},
+		InitTimeValue:         0.0,
+		TimestepsHistoryDepth: 2,
+	}
+	settings.Init()
+	makeIterations := func() []Iteration {
+		return []Iteration{
+			&paramMultProcessIteration{},
+			&paramMultProcessIteration{},
+		}
+	}
+	return settings, makeIterations
+}
+
+// paramEchoIteration outputs params["in"] unchanged, so a test can observe
+// exactly which values were injected into a partition on each step.
+type paramEchoIteration struct{}
+
+func (p *paramEchoIteration) Configure(partitionIndex int, settings *Settings) {}
+
+func (p *paramEchoIteration) Iterate(
+	params *Params,
+	partitionIndex int,
+	stateHistories []*StateHistory,
+	timestepsHistory *CumulativeTimestepsHistory,
+) []float64 {
+	values := make([]float64, stateHistories[partitionIndex].StateWidth)
+	copy(values, params.Get("in"))
+	return values
+}
+
+func TestLaggedUpstreamParams(t *testing.T) {
+	const maxSteps = 8
+
+	t.Run("a lag of k injects the upstream state from k steps ago",
+		func(t *testing.T) {
+			// partition_1 echoes partition_0 at lag 2, so on step n it must
+			// output partition_0's state from step n-2. Before two steps have
+			// been committed the lagged row is still the zero-filled history.
+			settings := &Settings{
+				Iterations: []IterationSettings{
+					{
+						Name:              "partition_0",
+						Params:            NewParams(make(map[string][]float64)),
+						InitStateValues:   []float64{1.0},
+						StateWidth:        1,
+						StateHistoryDepth: 2,
+					},
+					{
+						Name:   "partition_1",
+						Params: NewParams(make(map[string][]float64)),
+						ParamsFromUpstream: map[string]UpstreamConfig{
+							"in": {Upstream: 0, Lag: 2},
+						},
+						InitStateValues:   []float64{0.0},
+						StateWidth:        1,
+						StateHistoryDepth: 1,
+					},
+				},
+				InitTimeValue:         0.0,
+				TimestepsHistoryDepth: 2,
+			}
+			settings.Init()
+			makeIterations := func() []Iteration {
+				return []Iteration{&doublingProcessIteration{}, &paramEchoIteration{}}
+			}
+			for label, strategy := range map[string]ExecutionStrategy{
+				"default": nil,
+				"inline":  &InlineExecution{},
+			} {
+				store := runStrategyConfig(settings, makeIterations, maxSteps, strategy)
+				producer := store.GetValues("partition_0")
+				consumer := store.GetValues("partition_1")
+				if consumer[1][0] != 0.0 {
+					t.Errorf("%s: step 1 = %v, want the zero-filled history row",
+						label, consumer[1][0])
+				}
+				for n := 2; n < len(consumer); n++ {
+					if consumer[n][0] != producer[n-2][0] {
+						t.Errorf("%s: step %d = %v, want upstream step %d value %v",
+							label, n, consumer[n][0], n-2, producer[n-2][0])
+					}
+				}
+			}
+		})
 
-		// The default strategy handles the reverse-ordered edge fine.
-		runStrategyConfig(settings, makeIterations, maxSteps, nil)
+	t.Run("a cycle broken by a lag runs under every strategy",
+		func(t *testing.T) {
+			settings, makeIterations := laggedCycleSettings()
+			reference := runStrategyConfig(settings, makeIterations, maxSteps, nil)
 
-		defer func() {
-			if r := recover(); r == nil {
-				t.Error("expected panic for mis-ordered upstream under inline")
+			// Recompute the recurrence by hand: partition_0 multiplies by
+			// partition_1's previous state, then partition_1 multiplies by
+			// partition_0's new state.
+			a := []float64{1.1, 0.9}
+			b := []float64{0.95, 1.05}
+			gotA := reference.GetValues("partition_0")
+			gotB := reference.GetValues("partition_1")
+			for n := 1; n < len(gotA); n++ {
+				for i := range a {
+					a[i] *= b[i]
+					b[i] *= a[i]
+				}
+				if !floats.EqualApprox(gotA[n], a, 1e-12) ||
+					!floats.EqualApprox(gotB[n], b, 1e-12) {
+					t.Fatalf("step %d = (%v, %v), want (%v, %v)",
+						n, gotA[n], gotB[n], a, b)
+				}
 			}
-		}()
-		runStrategyConfig(settings, makeIterations, maxSteps, &InlineExecution{})
+
+			strategies := namedStrategies()
+			strategies["inline"] = &InlineExecution{}
+			for label, strategy := range strategies {
+				got := runStrategyConfig(settings, makeIterations, maxSteps, strategy)
+				assertStoresEqual(t, reference, got, label)
+				stepped := stepStrategyConfig(settings, makeIterations, maxSteps, strategy)
+				assertStoresEqual(t, reference, stepped, "stepwise/"+label)
+			}
+		})
+
+	t.Run("a lagged cycle passes RunWithHarnesses", func(t *testing.T) {
+		settings, makeIterations := laggedCycleSettings()
+		implementations := &Implementations{
+			Iterations:      makeIterations(),
+			OutputCondition: &EveryStepOutputCondition{},
+			OutputFunction:  &NilOutputFunction{},
+			TerminationCondition: &NumberOfStepsTerminationCondition{
+				MaxNumberOfSteps: maxSteps,
+			},
+			TimestepFunction: &ConstantTimestepFunction{Stepsize: 1.0},
+		}
+		if err := RunWithHarnesses(settings, implementations); err != nil {
+			t.Errorf("lagged cycle harness: %v", err)
+		}
 	})
 }
 
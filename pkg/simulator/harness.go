@@ -43,6 +43,11 @@ type IterationTestHarness struct {
 	history   *mat.Dense
 }
 
+// Close closes the wrapped iteration if it implements io.Closer.
+func (h *IterationTestHarness) Close() error {
+	return CloseIterations([]Iteration{h.Iteration})
+}
+
 func (h *IterationTestHarness) Configure(
 	partitionIndex int,
 	settings *Settings,
@@ -261,6 +266,7 @@ func runHarnessedToTermination(
 	coordinator *PartitionCoordinator,
 	harnesses []*IterationTestHarness,
 ) error {
+	defer coordinator.Close()
 	stepper := coordinator.NewStepper()
 	defer stepper.Close()
 	for !coordinator.ReadyToTerminate() {
@@ -1,5 +1,7 @@
 package simulator
 
+import "math"
+
 // Iteration defines the interface for per-partition state update functions
 // in stochadex simulations.
 //
@@ -95,10 +97,30 @@ type Iteration interface {
 // Upstream is the partition index of the producer. It is unused by the
 // channel-based strategies (which receive blockingly on Channel) but lets
 // inline execution read the producer's staged NextValues directly.
+//
+// A Lag of k >= 1 reads the producer's committed state from k steps ago out of
+// its state history instead; such an upstream has no Channel and is applied by
+// UpdateLaggedUpstreamParams under every strategy.
 type UpstreamStateValues struct {
 	Channel  chan []float64
 	Indices  []int
 	Upstream int
+	Lag      int
+}
+
+// setUpstreamParam sets params[name] from an upstream's values, copying them (or
+// just the selected indices) so the params cannot alias the producer's buffers.
+func setUpstreamParam(params *Params, name string, values []float64, indices []int) {
+	switch indices {
+	case nil:
+		params.Set(name, append([]float64(nil), values...))
+	default:
+		indexedValues := make([]float64, len(indices))
+		for i, index := range indices {
+			indexedValues[i] = values[index]
+		}
+		params.Set(name, indexedValues)
+	}
 }
 
 // DownstreamStateValues contains information to broadcast state values to
@@ -119,6 +141,9 @@ type StateValueChannels struct {
 // channels.
 func (s *StateValueChannels) UpdateUpstreamParams(params *Params) {
 	for name, upstream := range s.Upstreams {
+		if upstream.Lag > 0 {
+			continue
+		}
 		switch indices := upstream.Indices; indices {
 		case nil:
 			params.Set(name, <-upstream.Channel)
@@ -143,19 +168,35 @@ func (s *StateValueChannels) UpdateUpstreamParamsInline(
 	stateHistories []*StateHistory,
 ) {
 	for name, upstream := range s.Upstreams {
-		values := stateHistories[upstream.Upstream].NextValues
-		switch indices := upstream.Indices; indices {
-		case nil:
-			// Copy so downstream params wiring cannot mutate the producer's
-			// staged state buffer (matching BroadcastDownstream's guarantee).
-			params.Set(name, append([]float64(nil), values...))
-		default:
-			indexedValues := make([]float64, len(indices))
-			for i, index := range indices {
-				indexedValues[i] = values[index]
-			}
-			params.Set(name, indexedValues)
+		if upstream.Lag > 0 {
+			continue
 		}
+		// Copy so downstream params wiring cannot mutate the producer's staged
+		// state buffer (matching BroadcastDownstream's guarantee).
+		setUpstreamParam(
+			params, name, stateHistories[upstream.Upstream].NextValues, upstream.Indices)
+	}
+}
+
+// UpdateLaggedUpstreamParams updates Params from the lagged upstreams, reading
+// each producer's committed state from Lag steps ago. Row 0 of a history is the
+// state committed at the end of the previous step, so lag k reads row k-1. It
+// runs in the iteration phase, before any history is shifted, and so needs no
+// synchronisation with the producer.
+func (s *StateValueChannels) UpdateLaggedUpstreamParams(
+	params *Params,
+	stateHistories []*StateHistory,
+) {
+	for name, upstream := range s.Upstreams {
+		if upstream.Lag == 0 {
+			continue
+		}
+		setUpstreamParam(
+			params,
+			name,
+			stateHistories[upstream.Upstream].Values.RawRowView(upstream.Lag-1),
+			upstream.Indices,
+		)
 	}
 }
 
@@ -177,6 +218,10 @@ type NamedPartitionIndex struct {
 
 // StateIterator runs an Iteration for a partition on a goroutine and
 // manages reads/writes to history and output.
+//
+// A panic in either phase is recovered into failure rather than unwinding the
+// goroutine, and the coordinator's Stepper raises it once the step completes
+// (see SimulationError).
 type StateIterator struct {
 	Iteration       Iteration
 	Params          Params
@@ -184,6 +229,8 @@ type StateIterator struct {
 	ValueChannels   StateValueChannels
 	OutputCondition OutputCondition
 	OutputFunction  OutputFunction
+	failure         *SimulationError
+	profile         *partitionRecorder
 }
 
 // Iterate runs the Iteration and optionally triggers output if the condition
@@ -220,32 +267,58 @@ func (s *StateIterator) ReceiveAndIteratePending(
 // by the iteration phase, factored out from the channel receive so that
 // long-lived workers can own the receive themselves.
 func (s *StateIterator) IteratePending(inputMessage *IteratorInputMessage) {
+	step := inputMessage.TimestepsHistory.CurrentStepNumber
 	// listen to the upstream channels which may set new params
+	wait := s.profile.begin(profileWait)
 	s.ValueChannels.UpdateUpstreamParams(&s.Params)
-	inputMessage.StateHistories[s.Partition.Index].NextValues = s.Iterate(
-		inputMessage.StateHistories,
-		inputMessage.TimestepsHistory,
-	)
+	wait.end(step)
+	s.ValueChannels.UpdateLaggedUpstreamParams(&s.Params, inputMessage.StateHistories)
+	iterate := s.profile.begin(profileIterate)
+	inputMessage.StateHistories[s.Partition.Index].NextValues =
+		s.iterateRecovering(inputMessage)
+	iterate.end(step)
 	// broadcast a reference to the new state values for all downstream listeners
+	wait = s.profile.begin(profileWait)
 	s.ValueChannels.BroadcastDownstream(
 		inputMessage.StateHistories[s.Partition.Index].NextValues,
 	)
+	wait.end(step)
 }
 
 // IteratePendingInline runs the iteration phase for inline execution: it reads
 // upstream-driven params directly from producers' staged NextValues (no
 // channels) and does not broadcast downstream. Callers must process partitions
 // in an order where every upstream precedes its downstream consumers, which
-// InlineExecution validates before running.
+// InlineExecution computes before running.
 func (s *StateIterator) IteratePendingInline(inputMessage *IteratorInputMessage) {
 	s.ValueChannels.UpdateUpstreamParamsInline(
 		&s.Params,
 		inputMessage.StateHistories,
 	)
-	inputMessage.StateHistories[s.Partition.Index].NextValues = s.Iterate(
-		inputMessage.StateHistories,
-		inputMessage.TimestepsHistory,
-	)
+	s.ValueChannels.UpdateLaggedUpstreamParams(&s.Params, inputMessage.StateHistories)
+	iterate := s.profile.begin(profileIterate)
+	inputMessage.StateHistories[s.Partition.Index].NextValues =
+		s.iterateRecovering(inputMessage)
+	iterate.end(inputMessage.TimestepsHistory.CurrentStepNumber)
+}
+
+// iterateRecovering runs Iterate, recovering a panic into s.failure. A failed
+// partition's next values are all NaN, so the rest of the step — downstream
+// broadcasts included — completes before the failure is raised, and nothing
+// reading the failed step can mistake it for a real state.
+func (s *StateIterator) iterateRecovering(
+	inputMessage *IteratorInputMessage,
+) (newState []float64) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.failure = newSimulationError(s, inputMessage, "iterate", r)
+			newState = make([]float64, inputMessage.StateHistories[s.Partition.Index].StateWidth)
+			for i := range newState {
+				newState[i] = math.NaN()
+			}
+		}
+	}()
+	return s.Iterate(inputMessage.StateHistories, inputMessage.TimestepsHistory)
 }
 
 // UpdateHistory applies the pending state update to the partition history.
@@ -258,6 +331,13 @@ func (s *StateIterator) UpdateHistory(inputChannel <-chan *IteratorInputMessage)
 // factored out from the channel receive so that long-lived workers can own the
 // receive themselves.
 func (s *StateIterator) ApplyHistoryUpdate(inputMessage *IteratorInputMessage) {
+	update := s.profile.begin(profileUpdate)
+	defer update.end(inputMessage.TimestepsHistory.CurrentStepNumber)
+	defer func() {
+		if r := recover(); r != nil && s.failure == nil {
+			s.failure = newSimulationError(s, inputMessage, "update", r)
+		}
+	}()
 	// reference this partition
 	partition := inputMessage.StateHistories[s.Partition.Index]
 	// iterate over the history (matrix columns) and shift them
@@ -0,0 +1,198 @@
+package simulator
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+)
+
+// NonFiniteCheck selects the non-finite value sentinel: an opt-in check, run
+// once per step, that every partition's new state row is free of NaN and ±Inf.
+// It is far cheaper than the IterationTestHarness — one pass over the staged
+// rows between the iteration and update phases, and none at all once a
+// non-finite value has been found — so it can stay on in production runs.
+//
+// On the first occurrence the coordinator records a NonFiniteError naming the
+// partition that produced the value, and:
+//   - NonFiniteWarn logs it and lets the run continue;
+//   - NonFiniteHalt completes the step and then raises it from the Stepper's
+//     Step, exactly as a *SimulationError is raised, so RunContext returns it
+//     and Run panics with it.
+//
+// Either way FirstNonFinite returns it afterwards.
+type NonFiniteCheck string
+
+const (
+	// NonFiniteOff disables the sentinel. It is the default.
+	NonFiniteOff NonFiniteCheck = ""
+	// NonFiniteWarn logs the first non-finite value and carries on.
+	NonFiniteWarn NonFiniteCheck = "warn"
+	// NonFiniteHalt stops the run at the end of the step that produced the
+	// first non-finite value.
+	NonFiniteHalt NonFiniteCheck = "halt"
+)
+
+// ParseNonFiniteCheck validates the non_finite_check setting of a simulation
+// config.
+func ParseNonFiniteCheck(value string) (NonFiniteCheck, error) {
+	switch check := NonFiniteCheck(value); check {
+	case NonFiniteOff, NonFiniteWarn, NonFiniteHalt:
+		return check, nil
+	default:
+		return NonFiniteOff, fmt.Errorf(
+			"unknown non_finite_check %q — expected \"warn\" or \"halt\"", value)
+	}
+}
+
+// NonFiniteError records the first non-finite value a run produced: which
+// partition produced it, at which step and time, and from which params.
+//
+// When several partitions go non-finite in the same step, the one reported is
+// the lowest-indexed whose within-step upstreams all stayed finite — the
+// source, rather than a consumer that merely received its value.
+type NonFiniteError struct {
+	PartitionName  string
+	PartitionIndex int
+	Step           int
+	// Time is the cumulative time of the new state.
+	Time float64
+	// State is a copy of the new state row that holds the non-finite values.
+	State []float64
+	// Params is a copy of the params the partition iterated with, including
+	// any set from upstream partitions this step.
+	Params map[string][]float64
+	// Upstreams maps each param set by params_from_upstream to the partition
+	// it came from, with its lag if it has one.
+	Upstreams map[string]string
+	// Downstream traces the dependency edges along which the value can spread
+	// from the partition, as "source -> target (param)". It is only filled in
+	// when the simulation config has a NonFiniteTrace, because the full wiring
+	// (params_as_partitions included) is only known to the config.
+	Downstream []string
+}
+
+// Error describes the first non-finite value on one line.
+func (e *NonFiniteError) Error() string {
+	names := make([]string, 0, len(e.Params))
+	for name := range e.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	params := make([]string, len(names))
+	for i, name := range names {
+		if upstream, ok := e.Upstreams[name]; ok {
+			params[i] = fmt.Sprintf("%s (from %s): %v", name, upstream, e.Params[name])
+		} else {
+			params[i] = fmt.Sprintf("%s: %v", name, e.Params[name])
+		}
+	}
+	message := fmt.Sprintf(
+		"simulator: partition %q (index %d) produced the non-finite state %v at "+
+			"step %d (time %v); params {%s}",
+		e.PartitionName, e.PartitionIndex, e.State, e.Step, e.Time,
+		strings.Join(params, ", "),
+	)
+	if len(e.Downstream) > 0 {
+		message += "; downstream: " + strings.Join(e.Downstream, ", ")
+	}
+	return message
+}
+
+// hasNonFinite reports whether any value is NaN or ±Inf.
+func hasNonFinite(values []float64) bool {
+	for _, value := range values {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNonFinite runs the sentinel over the rows staged by the iteration phase.
+// Every Stepper calls it between the two phases, when no worker is running, so
+// it can read every iterator's params and staged row safely. A step in which a
+// partition panicked is skipped: its NaN row marks the failure, which the step
+// raises as a *SimulationError instead.
+func (c *PartitionCoordinator) checkNonFinite() {
+	if c.NonFiniteCheck == NonFiniteOff || c.nonFinite != nil {
+		return
+	}
+	for _, iterator := range c.Iterators {
+		if iterator.failure != nil {
+			return
+		}
+	}
+	nonFinite := make(map[int]bool)
+	for index := range c.Iterators {
+		if hasNonFinite(c.Shared.StateHistories[index].NextValues) {
+			nonFinite[index] = true
+		}
+	}
+	if len(nonFinite) == 0 {
+		return
+	}
+	source := -1
+	for index, iterator := range c.Iterators {
+		if !nonFinite[index] {
+			continue
+		}
+		if source < 0 {
+			source = index
+		}
+		fromSource := false
+		for _, upstream := range iterator.ValueChannels.Upstreams {
+			if upstream.Lag == 0 && nonFinite[upstream.Upstream] {
+				fromSource = true
+			}
+		}
+		if !fromSource {
+			source = index
+			break
+		}
+	}
+	c.nonFinite = c.newNonFiniteError(source)
+	switch c.NonFiniteCheck {
+	case NonFiniteHalt:
+		c.nonFiniteHalt = c.nonFinite
+	default:
+		log.Print("warning: " + c.nonFinite.Error())
+	}
+}
+
+// newNonFiniteError snapshots the partition at index for a NonFiniteError.
+func (c *PartitionCoordinator) newNonFiniteError(index int) *NonFiniteError {
+	iterator := c.Iterators[index]
+	params := make(map[string][]float64, len(iterator.Params.Map))
+	for name, values := range iterator.Params.Map {
+		params[name] = append([]float64(nil), values...)
+	}
+	upstreams := make(map[string]string, len(iterator.ValueChannels.Upstreams))
+	for name, upstream := range iterator.ValueChannels.Upstreams {
+		upstreams[name] = c.Iterators[upstream.Upstream].Partition.Name
+		if upstream.Lag > 0 {
+			upstreams[name] += fmt.Sprintf(" at lag %d", upstream.Lag)
+		}
+	}
+	timesteps := c.Shared.TimestepsHistory
+	err := &NonFiniteError{
+		PartitionName:  iterator.Partition.Name,
+		PartitionIndex: index,
+		Step:           timesteps.CurrentStepNumber,
+		Time:           timesteps.Values.AtVec(0) + timesteps.NextIncrement,
+		State:          append([]float64(nil), c.Shared.StateHistories[index].NextValues...),
+		Params:         params,
+		Upstreams:      upstreams,
+	}
+	if c.NonFiniteTrace != nil {
+		err.Downstream = c.NonFiniteTrace(index)
+	}
+	return err
+}
+
+// FirstNonFinite returns the first non-finite value the sentinel found, or nil
+// if it has found none (or is off).
+func (c *PartitionCoordinator) FirstNonFinite() *NonFiniteError {
+	return c.nonFinite
+}
@@ -0,0 +1,152 @@
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"math"
+	"strings"
+	"testing"
+)
+
+// nanAfterIteration counts up by one each step and returns NaN from the step
+// numbered at onwards.
+type nanAfterIteration struct {
+	at int
+}
+
+func (n *nanAfterIteration) Configure(partitionIndex int, settings *Settings) {}
+
+func (n *nanAfterIteration) Iterate(
+	params *Params,
+	partitionIndex int,
+	stateHistories []*StateHistory,
+	timestepsHistory *CumulativeTimestepsHistory,
+) []float64 {
+	if timestepsHistory.CurrentStepNumber >= n.at {
+		return []float64{math.NaN()}
+	}
+	return []float64{stateHistories[partitionIndex].Values.At(0, 0) + 1.0}
+}
+
+// newNonFiniteRun builds a run whose "source" partition goes NaN in step 3. The
+// "consumer" it feeds through a within-step params_from_upstream edge is
+// listed first, so it has the lower index but must not be reported.
+func newNonFiniteRun(check NonFiniteCheck, strategy ExecutionStrategy) *PartitionCoordinator {
+	generator := NewConfigGenerator()
+	generator.SetPartition(&PartitionConfig{
+		Name:      "consumer",
+		Iteration: &paramEchoIteration{},
+		Params:    NewParams(make(map[string][]float64)),
+		ParamsFromUpstream: map[string]NamedUpstreamConfig{
+			"in": {Upstream: "source"},
+		},
+		InitStateValues:   []float64{0.0},
+		StateHistoryDepth: 1,
+	})
+	generator.SetPartition(&PartitionConfig{
+		Name:              "source",
+		Iteration:         &nanAfterIteration{at: 3},
+		Params:            NewParams(map[string][]float64{"rate": {0.5}}),
+		InitStateValues:   []float64{0.0},
+		StateHistoryDepth: 1,
+	})
+	generator.SetSimulation(&SimulationConfig{
+		OutputCondition:      &EveryStepOutputCondition{},
+		OutputFunction:       &NilOutputFunction{},
+		TerminationCondition: &NumberOfStepsTerminationCondition{MaxNumberOfSteps: 6},
+		TimestepFunction:     &ConstantTimestepFunction{Stepsize: 1.0},
+		ExecutionStrategy:    strategy,
+		NonFiniteCheck:       check,
+		NonFiniteTrace: func(partitionIndex int) []string {
+			return []string{"traced from " + generator.PartitionNames()[partitionIndex]}
+		},
+	})
+	return NewPartitionCoordinator(generator.GenerateConfigs())
+}
+
+func TestNonFiniteCheck(t *testing.T) {
+	strategies := map[string]ExecutionStrategy{
+		"default":           nil,
+		"persistent worker": &PersistentWorkerExecution{},
+		"inline":            &InlineExecution{},
+	}
+	for name, strategy := range strategies {
+		t.Run(name+": halt stops at the first non-finite value", func(t *testing.T) {
+			coordinator := newNonFiniteRun(NonFiniteHalt, strategy)
+			err := coordinator.RunContext(context.Background())
+			var nonFinite *NonFiniteError
+			if !errors.As(err, &nonFinite) {
+				t.Fatalf("expected a *NonFiniteError, got %v", err)
+			}
+			if nonFinite.PartitionName != "source" || nonFinite.PartitionIndex != 1 ||
+				nonFinite.Step != 3 || nonFinite.Time != 3.0 ||
+				len(nonFinite.State) != 1 || !math.IsNaN(nonFinite.State[0]) ||
+				nonFinite.Params["rate"][0] != 0.5 {
+				t.Errorf("unexpected report: %+v", nonFinite)
+			}
+			if len(nonFinite.Downstream) != 1 || nonFinite.Downstream[0] != "traced from source" {
+				t.Errorf("unexpected downstream trace: %v", nonFinite.Downstream)
+			}
+			if step := coordinator.Shared.TimestepsHistory.CurrentStepNumber; step != 3 {
+				t.Errorf("stopped after step %d, want 3", step)
+			}
+			if coordinator.FirstNonFinite() != nonFinite {
+				t.Error("FirstNonFinite does not return the reported error")
+			}
+		})
+
+		t.Run(name+": warn logs once and carries on", func(t *testing.T) {
+			var logged bytes.Buffer
+			defer log.SetOutput(log.Writer())
+			log.SetOutput(&logged)
+			coordinator := newNonFiniteRun(NonFiniteWarn, strategy)
+			if err := coordinator.RunContext(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if step := coordinator.Shared.TimestepsHistory.CurrentStepNumber; step != 6 {
+				t.Errorf("stopped after step %d, want 6", step)
+			}
+			if count := strings.Count(logged.String(), "warning:"); count != 1 ||
+				!strings.Contains(logged.String(), `"source"`) {
+				t.Errorf("expected one warning naming the source, got %q", logged.String())
+			}
+			if first := coordinator.FirstNonFinite(); first == nil || first.Step != 3 {
+				t.Errorf("unexpected first non-finite value: %v", first)
+			}
+		})
+	}
+
+	t.Run("the consumer's upstream is recorded", func(t *testing.T) {
+		coordinator := newNonFiniteRun(NonFiniteHalt, nil)
+		stepper := coordinator.NewStepper()
+		defer stepper.Close()
+		stepper.Step()
+		// report the consumer directly to check its upstream attribution
+		coordinator.Shared.StateHistories[0].NextValues = []float64{math.Inf(1)}
+		err := coordinator.newNonFiniteError(0)
+		if err.Upstreams["in"] != "source" ||
+			!strings.Contains(err.Error(), "in (from source)") {
+			t.Errorf("unexpected upstreams: %v", err)
+		}
+	})
+
+	t.Run("off by default", func(t *testing.T) {
+		coordinator := newNonFiniteRun(NonFiniteOff, nil)
+		if err := coordinator.RunContext(context.Background()); err != nil ||
+			coordinator.FirstNonFinite() != nil {
+			t.Errorf("expected no sentinel, got %v %v", err, coordinator.FirstNonFinite())
+		}
+	})
+
+	t.Run("an unknown setting is rejected", func(t *testing.T) {
+		if _, err := ParseNonFiniteCheck("panic"); err == nil {
+			t.Error("expected an unknown non_finite_check to be rejected")
+		}
+		config, err := (&SimulationConfigStrings{NonFiniteCheck: "halt"}).ResolveDataComponents()
+		if err != nil || config.NonFiniteCheck != NonFiniteHalt {
+			t.Errorf("expected halt to resolve, got %v %v", config, err)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package simulator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExecutionOrderError reports within-step params_from_upstream wiring that
+// admits no execution order. Partitions names those caught in the cycles.
+type ExecutionOrderError struct {
+	Partitions []string
+}
+
+func (e *ExecutionOrderError) Error() string {
+	return fmt.Sprintf(
+		"no within-step execution order exists: partitions %s form a "+
+			"params_from_upstream cycle; give at least one entry on each cycle "+
+			"a lag: 1 so it reads the previous step instead",
+		strings.Join(e.Partitions, ", "),
+	)
+}
+
+// withinStepOrder topologically sorts partitions by their within-step
+// params_from_upstream edges (the ParamsInject edges pkg/graph reports), where
+// upstreams[i] lists the partitions that partition i reads within-step. Lagged
+// entries impose no ordering and must not be listed.
+//
+// The sort is stable: among partitions that are ready to run it always picks
+// the lowest index, so an already well-ordered config comes back as the
+// identity order. The result is an execution order only — it never renumbers
+// partitions, so every index a user or an iteration sees is unchanged.
+//
+// If no order exists the *ExecutionOrderError names the partitions caught in
+// within-step cycles (including self-edges).
+func withinStepOrder(names []string, upstreams [][]int) ([]int, error) {
+	numPartitions := len(names)
+	consumers := make([][]int, numPartitions)
+	pending := make([]int, numPartitions)
+	for consumer, producers := range upstreams {
+		for _, producer := range producers {
+			consumers[producer] = append(consumers[producer], consumer)
+			pending[consumer]++
+		}
+	}
+	order := make([]int, 0, numPartitions)
+	done := make([]bool, numPartitions)
+	for len(order) < numPartitions {
+		next := -1
+		for index := range numPartitions {
+			if !done[index] && pending[index] == 0 {
+				next = index
+				break
+			}
+		}
+		if next < 0 {
+			return nil, &ExecutionOrderError{
+				Partitions: cyclicNames(names, upstreams, done),
+			}
+		}
+		done[next] = true
+		order = append(order, next)
+		for _, consumer := range consumers[next] {
+			pending[consumer]--
+		}
+	}
+	return order, nil
+}
+
+// cyclicNames narrows the partitions left unsorted by withinStepOrder to those
+// on (or between) cycles, by repeatedly dropping any that feed no other
+// unsorted partition: those are merely downstream of a cycle.
+func cyclicNames(names []string, upstreams [][]int, sorted []bool) []string {
+	remaining := make([]bool, len(names))
+	for index := range names {
+		remaining[index] = !sorted[index]
+	}
+	for changed := true; changed; {
+		changed = false
+		feeds := make([]bool, len(names))
+		for consumer, producers := range upstreams {
+			if !remaining[consumer] {
+				continue
+			}
+			for _, producer := range producers {
+				feeds[producer] = true
+			}
+		}
+		for index := range names {
+			if remaining[index] && !feeds[index] {
+				remaining[index] = false
+				changed = true
+			}
+		}
+	}
+	cyclic := make([]string, 0)
+	for index, name := range names {
+		if remaining[index] {
+			cyclic = append(cyclic, name)
+		}
+	}
+	return cyclic
+}
+
+// coordinatorWithinStepOrder is withinStepOrder over a coordinator's
+// partitions and their unlagged upstreams.
+func coordinatorWithinStepOrder(c *PartitionCoordinator) ([]int, error) {
+	names := make([]string, len(c.Iterators))
+	upstreams := make([][]int, len(c.Iterators))
+	for index, iterator := range c.Iterators {
+		names[index] = iterator.Partition.Name
+		for _, upstream := range iterator.ValueChannels.Upstreams {
+			if upstream.Lag == 0 {
+				upstreams[index] = append(upstreams[index], upstream.Upstream)
+			}
+		}
+	}
+	return withinStepOrder(names, upstreams)
+}
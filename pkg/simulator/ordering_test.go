@@ -0,0 +1,51 @@
+package simulator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithinStepOrder(t *testing.T) {
+	names := []string{"a", "b", "c", "d"}
+
+	t.Run("an already ordered config keeps index order", func(t *testing.T) {
+		order, err := withinStepOrder(names, [][]int{nil, {0}, {0, 1}, nil})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(order, []int{0, 1, 2, 3}) {
+			t.Errorf("got %v, want identity order", order)
+		}
+	})
+
+	t.Run("producers are moved ahead of consumers stably", func(t *testing.T) {
+		// a reads c, b reads a: c must run first, then a, then b; d is free
+		// and keeps its place relative to the other ready partitions.
+		order, err := withinStepOrder(names, [][]int{{2}, {0}, nil, nil})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(order, []int{2, 0, 1, 3}) {
+			t.Errorf("got %v, want [2 0 1 3]", order)
+		}
+	})
+
+	t.Run("a cycle is an error naming only its members", func(t *testing.T) {
+		// a and b read each other; c sits downstream of the cycle and d
+		// upstream of it, so neither belongs in the message.
+		_, err := withinStepOrder(names, [][]int{{1, 3}, {0}, {1}, nil})
+		if err == nil {
+			t.Fatal("expected an error for a within-step cycle")
+		}
+		if !strings.Contains(err.Error(), "partitions a, b form") {
+			t.Errorf("error should name a and b only, got: %v", err)
+		}
+	})
+
+	t.Run("a self-edge is a cycle", func(t *testing.T) {
+		if _, err := withinStepOrder(names[:1], [][]int{{0}}); err == nil {
+			t.Fatal("expected an error for a self-edge")
+		}
+	})
+}
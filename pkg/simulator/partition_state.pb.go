@@ -1,13 +1,15 @@
 // partition_state.proto defines PartitionState, the wire format for streaming a
 // single partition's output at one simulation step. The engine's websocket
 // output function (pkg/simulator/output.go) marshals one message per output step
-// and sends it to browser and Python clients. Go, JS, and Python bindings are
-// generated from this file by generate_proto.sh — edit here and regenerate;
-// never hand-edit the generated files.
+// and sends it to browser and Python clients. The same message carries the
+// history rows a client asks for with a SNAPSHOT control message (see
+// control_message.proto). Go, JS, and Python bindings are generated from this
+// file by generate_proto.sh — edit here and regenerate; never hand-edit the
+// generated files.
 
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.36.10
+// 	protoc-gen-go v1.36.9
 // 	protoc        v6.33.0
 // source: cmd/messages/partition_state.proto
 
@@ -37,7 +39,16 @@ type PartitionState struct {
 	// Name of the partition that produced this state.
 	PartitionName string `protobuf:"bytes,2,opt,name=partition_name,json=partitionName,proto3" json:"partition_name,omitempty"`
 	// The partition's state vector for this step (length = the partition's state width).
-	State         []float64 `protobuf:"fixed64,3,rep,packed,name=state,proto3" json:"state,omitempty"`
+	State []float64 `protobuf:"fixed64,3,rep,packed,name=state,proto3" json:"state,omitempty"`
+	// Zero for a live output. Nonzero marks a snapshot frame, and holds the
+	// request_id of the SNAPSHOT control message it answers.
+	SnapshotId uint64 `protobuf:"varint,4,opt,name=snapshot_id,json=snapshotId,proto3" json:"snapshot_id,omitempty"`
+	// For a snapshot frame, the history row this state comes from: 0 is the most
+	// recent committed state.
+	HistoryRow uint32 `protobuf:"varint,5,opt,name=history_row,json=historyRow,proto3" json:"history_row,omitempty"`
+	// For a snapshot frame, the total number of frames in the snapshot, so a
+	// client knows when it has all of them.
+	SnapshotSize  uint32 `protobuf:"varint,6,opt,name=snapshot_size,json=snapshotSize,proto3" json:"snapshot_size,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -93,15 +104,41 @@ func (x *PartitionState) GetState() []float64 {
 	return nil
 }
 
+func (x *PartitionState) GetSnapshotId() uint64 {
+	if x != nil {
+		return x.SnapshotId
+	}
+	return 0
+}
+
+func (x *PartitionState) GetHistoryRow() uint32 {
+	if x != nil {
+		return x.HistoryRow
+	}
+	return 0
+}
+
+func (x *PartitionState) GetSnapshotSize() uint32 {
+	if x != nil {
+		return x.SnapshotSize
+	}
+	return 0
+}
+
 var File_cmd_messages_partition_state_proto protoreflect.FileDescriptor
 
 const file_cmd_messages_partition_state_proto_rawDesc = "" +
 	"\n" +
-	"\"cmd/messages/partition_state.proto\"\x80\x01\n" +
+	"\"cmd/messages/partition_state.proto\"\xe7\x01\n" +
 	"\x0ePartitionState\x121\n" +
 	"\x14cumulative_timesteps\x18\x01 \x01(\x01R\x13cumulativeTimesteps\x12%\n" +
 	"\x0epartition_name\x18\x02 \x01(\tR\rpartitionName\x12\x14\n" +
-	"\x05state\x18\x03 \x03(\x01R\x05stateB\x11Z\x0f./pkg/simulatorb\x06proto3"
+	"\x05state\x18\x03 \x03(\x01R\x05state\x12\x1f\n" +
+	"\vsnapshot_id\x18\x04 \x01(\x04R\n" +
+	"snapshotId\x12\x1f\n" +
+	"\vhistory_row\x18\x05 \x01(\rR\n" +
+	"historyRow\x12#\n" +
+	"\rsnapshot_size\x18\x06 \x01(\rR\fsnapshotSizeB\x11Z\x0f./pkg/simulatorb\x06proto3"
 
 var (
 	file_cmd_messages_partition_state_proto_rawDescOnce sync.Once
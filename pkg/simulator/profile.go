@@ -0,0 +1,381 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/metrics"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// DefaultProfileTraceSteps is how many steps a Profiler records trace events
+// for unless told otherwise. The summary always covers the whole run.
+const DefaultProfileTraceSteps = 1000
+
+// PartitionProfile is the measured cost of one partition over a profiled run.
+type PartitionProfile struct {
+	Name  string
+	Index int
+	// Calls is the number of iterations run.
+	Calls int
+	// IterateTime is the wall time spent in Iterate: the Iteration plus any
+	// output it triggers.
+	IterateTime time.Duration
+	// WaitTime is the wall time spent blocked on channels: receiving
+	// params_from_upstream values and sending to downstream listeners. It is
+	// always zero under InlineExecution, which uses no channels.
+	WaitTime time.Duration
+	// UpdateTime is the wall time spent applying new states to the history.
+	UpdateTime time.Duration
+	// ProcessAllocBytes and ProcessAllocs count the heap allocations the whole
+	// process made while Iterate ran. Go has no per-goroutine counters, so they
+	// include anything else allocating meanwhile: the runtime, other goroutines
+	// and, under the concurrent strategies, other partitions. Read them as an
+	// upper bound on the partition's own allocations.
+	ProcessAllocBytes uint64
+	ProcessAllocs     uint64
+}
+
+// StepTime is the mean wall time of one Iterate plus one update.
+func (p *PartitionProfile) StepTime() time.Duration {
+	if p.Calls == 0 {
+		return 0
+	}
+	return (p.IterateTime + p.UpdateTime) / time.Duration(p.Calls)
+}
+
+// traceEvent is one Chrome trace-event format "complete" event.
+type traceEvent struct {
+	Name     string         `json:"name"`
+	Category string         `json:"cat,omitempty"`
+	Phase    string         `json:"ph"`
+	Start    float64        `json:"ts"`
+	Duration float64        `json:"dur,omitempty"`
+	Process  int            `json:"pid"`
+	Thread   int            `json:"tid"`
+	Args     map[string]any `json:"args,omitempty"`
+}
+
+// partitionRecorder accumulates one partition's profile. Only the goroutine
+// running that partition's work writes to it, and the phase barriers order
+// those writes before anything reads them.
+type partitionRecorder struct {
+	profiler *Profiler
+	profile  PartitionProfile
+	events   []traceEvent
+}
+
+// profileKind names what a profiled span measured.
+type profileKind int
+
+const (
+	profileWait profileKind = iota
+	profileIterate
+	profileUpdate
+)
+
+var profileKindNames = [...]string{"wait", "iterate", "update"}
+
+// profileSpan is an open measurement. The zero span, returned when profiling
+// is off, records nothing.
+type profileSpan struct {
+	recorder *partitionRecorder
+	kind     profileKind
+	start    time.Time
+	allocs   [2]uint64
+}
+
+// begin opens a span of the given kind. It is safe on a nil recorder, so the
+// hooks cost a nil check when profiling is off.
+func (r *partitionRecorder) begin(kind profileKind) profileSpan {
+	if r == nil {
+		return profileSpan{}
+	}
+	span := profileSpan{recorder: r, kind: kind}
+	if kind == profileIterate {
+		span.allocs = readAllocs()
+	}
+	span.start = time.Now()
+	return span
+}
+
+// end closes the span, adding it to the partition's totals and, for the first
+// TraceSteps steps, to its trace.
+func (s profileSpan) end(step int) {
+	r := s.recorder
+	if r == nil {
+		return
+	}
+	elapsed := time.Since(s.start)
+	switch s.kind {
+	case profileWait:
+		r.profile.WaitTime += elapsed
+	case profileIterate:
+		allocs := readAllocs()
+		r.profile.Calls++
+		r.profile.IterateTime += elapsed
+		r.profile.ProcessAllocBytes += allocs[0] - s.allocs[0]
+		r.profile.ProcessAllocs += allocs[1] - s.allocs[1]
+	case profileUpdate:
+		r.profile.UpdateTime += elapsed
+	}
+	// a wait with nothing to wait for is noise in the trace
+	if step <= r.profiler.TraceSteps && (s.kind != profileWait || elapsed >= time.Microsecond) {
+		r.events = append(r.events, r.profiler.event(
+			r.profile.Name, profileKindNames[s.kind], r.profile.Index+1, s.start, elapsed, step))
+	}
+}
+
+// readAllocs reads the process-wide cumulative heap allocation counters.
+func readAllocs() [2]uint64 {
+	samples := []metrics.Sample{
+		{Name: "/gc/heap/allocs:bytes"},
+		{Name: "/gc/heap/allocs:objects"},
+	}
+	metrics.Read(samples)
+	return [2]uint64{samples[0].Value.Uint64(), samples[1].Value.Uint64()}
+}
+
+// Profiler records where a run's time goes: per-partition iterate, update and
+// channel-wait time and the process-wide allocations made while each partition
+// iterated, and the wall time of each step's phases.
+// Attach one with PartitionCoordinator.Profile before running; it then works
+// under every ExecutionStrategy, so the same run can be profiled under each
+// and compared.
+//
+// After the run, WriteSummary prints a table of the costs, WriteChromeTrace
+// writes the recorded spans as a Chrome trace-event JSON file (open it in
+// chrome://tracing or ui.perfetto.dev; each partition is a thread, the
+// coordinator's phases are thread 0) and Recommend suggests a strategy.
+type Profiler struct {
+	// TraceSteps bounds how many steps are recorded as trace events, so a long
+	// run does not grow an unbounded trace.
+	TraceSteps int
+	// Strategy names the execution strategy the run used.
+	Strategy string
+
+	start        time.Time
+	partitions   []*partitionRecorder
+	events       []traceEvent
+	steps        int
+	iteratePhase time.Duration
+	updatePhase  time.Duration
+	wall         time.Duration
+}
+
+// event builds a trace event relative to the profiler's start, in µs.
+func (p *Profiler) event(
+	name, category string,
+	thread int,
+	start time.Time,
+	elapsed time.Duration,
+	step int,
+) traceEvent {
+	return traceEvent{
+		Name:     name,
+		Category: category,
+		Phase:    "X",
+		Start:    float64(start.Sub(p.start).Nanoseconds()) / 1e3,
+		Duration: float64(elapsed.Nanoseconds()) / 1e3,
+		Process:  1,
+		Thread:   thread,
+		Args:     map[string]any{"step": step},
+	}
+}
+
+// phase records one of the coordinator's step phases, measured on the
+// caller's goroutine. It is safe on a nil Profiler.
+func (p *Profiler) phase(name string, step int, start time.Time) {
+	if p == nil {
+		return
+	}
+	elapsed := time.Since(start)
+	switch name {
+	case "iterate phase":
+		p.iteratePhase += elapsed
+	case "update phase":
+		p.updatePhase += elapsed
+	case "step":
+		p.steps++
+		p.wall += elapsed
+	}
+	if step <= p.TraceSteps {
+		p.events = append(p.events, p.event(name, "coordinator", 0, start, elapsed, step))
+	}
+}
+
+// clock returns the time to start a phase at, or the zero time when profiling
+// is off.
+func (p *Profiler) clock() time.Time {
+	if p == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// Profile attaches a new Profiler to the coordinator and its iterators and
+// returns it. Call it before NewStepper or Run; every step from then on is
+// measured.
+func (c *PartitionCoordinator) Profile() *Profiler {
+	profiler := &Profiler{
+		TraceSteps: DefaultProfileTraceSteps,
+		Strategy:   strategyName(c.RunStrategy),
+		start:      time.Now(),
+	}
+	for _, iterator := range c.Iterators {
+		recorder := &partitionRecorder{
+			profiler: profiler,
+			profile: PartitionProfile{
+				Name:  iterator.Partition.Name,
+				Index: iterator.Partition.Index,
+			},
+		}
+		iterator.profile = recorder
+		profiler.partitions = append(profiler.partitions, recorder)
+	}
+	c.profiler = profiler
+	return profiler
+}
+
+// strategyName returns the data-spec name of a built-in strategy.
+func strategyName(strategy ExecutionStrategy) string {
+	switch strategy.(type) {
+	case nil, *SpawnPerStepExecution:
+		return "spawn_per_step"
+	case *PersistentWorkerExecution:
+		return "persistent_worker"
+	case *InlineExecution:
+		return "inline"
+	default:
+		return fmt.Sprintf("%T", strategy)
+	}
+}
+
+// Steps returns the number of steps profiled.
+func (p *Profiler) Steps() int { return p.steps }
+
+// Partitions returns each partition's profile in index order.
+func (p *Profiler) Partitions() []PartitionProfile {
+	profiles := make([]PartitionProfile, len(p.partitions))
+	for i, recorder := range p.partitions {
+		profiles[i] = recorder.profile
+	}
+	return profiles
+}
+
+// WriteSummary writes a table of the per-partition costs, most expensive
+// first, followed by the per-step phase times and the recommendation. The
+// allocation columns are process-wide (see PartitionProfile).
+func (p *Profiler) WriteSummary(w io.Writer) error {
+	profiles := p.Partitions()
+	sort.SliceStable(profiles, func(i, j int) bool {
+		return profiles[i].IterateTime+profiles[i].UpdateTime >
+			profiles[j].IterateTime+profiles[j].UpdateTime
+	})
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(table, "partition\tcalls\titerate\tupdate\twait\tper step\tprocess B/op\tprocess allocs/op\t\n")
+	for _, profile := range profiles {
+		calls := max(profile.Calls, 1)
+		fmt.Fprintf(table, "%s\t%d\t%v\t%v\t%v\t%v\t%d\t%d\t\n",
+			profile.Name, profile.Calls, profile.IterateTime, profile.UpdateTime,
+			profile.WaitTime, profile.StepTime(),
+			profile.ProcessAllocBytes/uint64(calls), profile.ProcessAllocs/uint64(calls))
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	steps := time.Duration(max(p.steps, 1))
+	recommendation := p.Recommend()
+	_, err := fmt.Fprintf(w,
+		"\n%d steps under %s: %v per step (iterate phase %v, update phase %v)\n"+
+			"recommended strategy: %s — %s\n",
+		p.steps, p.Strategy, p.wall/steps, p.iteratePhase/steps, p.updatePhase/steps,
+		recommendation.Strategy, recommendation.Reason,
+	)
+	return err
+}
+
+// WriteChromeTrace writes the recorded spans in the Chrome trace-event JSON
+// format, one thread per partition plus the coordinator on thread 0.
+func (p *Profiler) WriteChromeTrace(w io.Writer) error {
+	events := []traceEvent{threadName(0, "coordinator ("+p.Strategy+")")}
+	events = append(events, p.events...)
+	for _, recorder := range p.partitions {
+		events = append(events, threadName(recorder.profile.Index+1, recorder.profile.Name))
+		events = append(events, recorder.events...)
+	}
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents     []traceEvent `json:"traceEvents"`
+		DisplayTimeUnit string       `json:"displayTimeUnit"`
+	}{events, "ms"})
+}
+
+// threadName is the metadata event that labels a trace thread.
+func threadName(thread int, name string) traceEvent {
+	return traceEvent{
+		Name:    "thread_name",
+		Phase:   "M",
+		Process: 1,
+		Thread:  thread,
+		Args:    map[string]any{"name": name},
+	}
+}
+
+// StrategyRecommendation is the execution strategy a profile suggests, with
+// the reason in a sentence.
+type StrategyRecommendation struct {
+	Strategy string
+	Reason   string
+}
+
+// concurrencyFloor is the per-partition step cost below which handing a
+// partition to another goroutine costs more than running it: a goroutine
+// wake-up and channel round trip are on the order of a microsecond.
+const concurrencyFloor = 20 * time.Microsecond
+
+// Recommend suggests an execution strategy from the partition count and the
+// measured costs, which do not depend on the strategy that was profiled:
+//   - inline when there is one partition, when the mean partition is too cheap
+//     to be worth a goroutine hand-off, or when one partition dominates the
+//     step so that running the rest alongside it saves little;
+//   - persistent_worker otherwise, since it keeps the parallelism of
+//     spawn_per_step without spawning goroutines every step.
+//
+// spawn_per_step is only recommended for a run too short to profile.
+func (p *Profiler) Recommend() StrategyRecommendation {
+	if p.steps == 0 {
+		return StrategyRecommendation{"spawn_per_step", "no steps were profiled"}
+	}
+	if len(p.partitions) == 1 {
+		return StrategyRecommendation{
+			"inline", "a single partition has nothing to run concurrently with",
+		}
+	}
+	var total, largest time.Duration
+	for _, recorder := range p.partitions {
+		cost := recorder.profile.StepTime()
+		total += cost
+		largest = max(largest, cost)
+	}
+	mean := total / time.Duration(len(p.partitions))
+	if mean < concurrencyFloor {
+		return StrategyRecommendation{"inline", fmt.Sprintf(
+			"the mean partition costs %v per step, less than a goroutine hand-off "+
+				"is worth (%v)", mean, concurrencyFloor)}
+	}
+	// the best a parallel step can do is the larger of the slowest partition and
+	// the total spread evenly over the available cores
+	parallel := max(largest, total/time.Duration(runtime.GOMAXPROCS(0)))
+	if speedup := float64(total) / float64(parallel); speedup < 1.5 {
+		return StrategyRecommendation{"inline", fmt.Sprintf(
+			"running partitions concurrently could speed a step up by at most %.2fx "+
+				"(%v of %v per step is one partition or the cores are saturated)",
+			speedup, largest, total)}
+	}
+	return StrategyRecommendation{"persistent_worker", fmt.Sprintf(
+		"%d partitions costing %v per step in total could run up to %.2fx faster "+
+			"concurrently", len(p.partitions), total, float64(total)/float64(parallel))}
+}
@@ -0,0 +1,168 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sleepingIteration counts up by one each step after sleeping for delay.
+type sleepingIteration struct {
+	delay time.Duration
+}
+
+func (s *sleepingIteration) Configure(partitionIndex int, settings *Settings) {}
+
+func (s *sleepingIteration) Iterate(
+	params *Params,
+	partitionIndex int,
+	stateHistories []*StateHistory,
+	timestepsHistory *CumulativeTimestepsHistory,
+) []float64 {
+	time.Sleep(s.delay)
+	return []float64{stateHistories[partitionIndex].Values.At(0, 0) + 1.0}
+}
+
+// newProfiledRun builds a run of a slow partition feeding a fast consumer
+// through a within-step params_from_upstream edge.
+func newProfiledRun(strategy ExecutionStrategy, steps int) *PartitionCoordinator {
+	generator := NewConfigGenerator()
+	generator.SetPartition(&PartitionConfig{
+		Name:              "slow",
+		Iteration:         &sleepingIteration{delay: 200 * time.Microsecond},
+		Params:            NewParams(make(map[string][]float64)),
+		InitStateValues:   []float64{0.0},
+		StateHistoryDepth: 1,
+	})
+	generator.SetPartition(&PartitionConfig{
+		Name:      "fast",
+		Iteration: &paramEchoIteration{},
+		Params:    NewParams(make(map[string][]float64)),
+		ParamsFromUpstream: map[string]NamedUpstreamConfig{
+			"in": {Upstream: "slow"},
+		},
+		InitStateValues:   []float64{0.0},
+		StateHistoryDepth: 1,
+	})
+	generator.SetSimulation(&SimulationConfig{
+		OutputCondition:      &EveryStepOutputCondition{},
+		OutputFunction:       &NilOutputFunction{},
+		TerminationCondition: &NumberOfStepsTerminationCondition{MaxNumberOfSteps: steps},
+		TimestepFunction:     &ConstantTimestepFunction{Stepsize: 1.0},
+		ExecutionStrategy:    strategy,
+	})
+	return NewPartitionCoordinator(generator.GenerateConfigs())
+}
+
+func TestProfiler(t *testing.T) {
+	strategies := map[string]ExecutionStrategy{
+		"spawn_per_step":    nil,
+		"persistent_worker": &PersistentWorkerExecution{},
+		"inline":            &InlineExecution{},
+	}
+	for name, strategy := range strategies {
+		t.Run(name+": costs are recorded per partition", func(t *testing.T) {
+			coordinator := newProfiledRun(strategy, 10)
+			profiler := coordinator.Profile()
+			profiler.TraceSteps = 4
+			coordinator.Run()
+
+			if profiler.Steps() != 10 || profiler.Strategy != name {
+				t.Fatalf("profiled %d steps under %s", profiler.Steps(), profiler.Strategy)
+			}
+			profiles := profiler.Partitions()
+			for _, profile := range profiles {
+				if profile.Calls != 10 || profile.IterateTime <= 0 || profile.UpdateTime <= 0 {
+					t.Errorf("unexpected profile: %+v", profile)
+				}
+			}
+			if profiles[0].IterateTime < 10*200*time.Microsecond {
+				t.Errorf("slow partition iterated for only %v", profiles[0].IterateTime)
+			}
+			// the consumer blocks on the slow partition's channel, except inline
+			consumerWait := profiles[1].WaitTime
+			if name == "inline" && consumerWait != 0 {
+				t.Errorf("inline execution waited %v on channels", consumerWait)
+			} else if name != "inline" && consumerWait < 5*200*time.Microsecond {
+				t.Errorf("consumer waited only %v for its upstream", consumerWait)
+			}
+
+			var summary bytes.Buffer
+			if err := profiler.WriteSummary(&summary); err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(summary.String(), "\n")
+			if !strings.Contains(lines[1], "slow") ||
+				!strings.Contains(summary.String(), "10 steps under "+name) ||
+				!strings.Contains(summary.String(), "recommended strategy: inline") {
+				t.Errorf("unexpected summary:\n%s", summary.String())
+			}
+
+			var trace bytes.Buffer
+			if err := profiler.WriteChromeTrace(&trace); err != nil {
+				t.Fatal(err)
+			}
+			var decoded struct {
+				TraceEvents []traceEvent `json:"traceEvents"`
+			}
+			if err := json.Unmarshal(trace.Bytes(), &decoded); err != nil {
+				t.Fatal(err)
+			}
+			counts := make(map[string]int)
+			for _, event := range decoded.TraceEvents {
+				counts[event.Phase+" "+event.Category+" "+event.Name]++
+				if event.Phase == "X" && event.Args["step"].(float64) > 4 {
+					t.Errorf("event beyond the traced steps: %+v", event)
+				}
+			}
+			if counts["M  thread_name"] != 3 || counts["X coordinator step"] != 4 ||
+				counts["X iterate slow"] != 4 || counts["X update fast"] != 4 {
+				t.Errorf("unexpected trace events: %v", counts)
+			}
+		})
+	}
+
+	t.Run("an unprofiled run records nothing", func(t *testing.T) {
+		coordinator := newProfiledRun(&InlineExecution{}, 2)
+		coordinator.Run()
+		for _, iterator := range coordinator.Iterators {
+			if iterator.profile != nil {
+				t.Error("unexpected profile on an unprofiled run")
+			}
+		}
+	})
+}
+
+func TestProfilerRecommend(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	profiled := func(costs ...time.Duration) *Profiler {
+		profiler := &Profiler{steps: 10}
+		for _, cost := range costs {
+			profiler.partitions = append(profiler.partitions, &partitionRecorder{
+				profile: PartitionProfile{Calls: 10, IterateTime: 10 * cost},
+			})
+		}
+		return profiler
+	}
+	ms := time.Millisecond
+	for name, test := range map[string]struct {
+		profiler *Profiler
+		want     string
+	}{
+		"nothing profiled":      {&Profiler{}, "spawn_per_step"},
+		"one partition":         {profiled(ms), "inline"},
+		"cheap partitions":      {profiled(time.Microsecond, 2*time.Microsecond), "inline"},
+		"one dominant":          {profiled(10*ms, ms/10, ms/10), "inline"},
+		"balanced and costly":   {profiled(ms, ms, ms, ms), "persistent_worker"},
+		"more than the cores":   {profiled(ms, ms, ms, ms, ms, ms, ms, ms), "persistent_worker"},
+		"two equal and costly":  {profiled(ms, ms), "persistent_worker"},
+		"two unequal by 3 to 1": {profiled(3*ms, ms), "inline"},
+	} {
+		if got := test.profiler.Recommend(); got.Strategy != test.want || got.Reason == "" {
+			t.Errorf("%s: recommended %+v, want %s", name, got, test.want)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package simulator
 
-import "gonum.org/v1/gonum/mat"
+import (
+	"context"
+
+	"gonum.org/v1/gonum/mat"
+)
 
 // DeriveSeed mixes a base seed with a stream index, so the partitions of one
 // re-entrant run get distinct but jointly-determined seeds. Splitting this way
@@ -138,8 +142,9 @@ func (r *ReentrantSimulation) evaluate(run ReentrantRun) *PartitionCoordinator {
 			stepper.Step()
 		}
 		stepper.Close()
-	} else {
-		coordinator.Run()
+	} else if err := coordinator.run(context.Background(), false); err != nil {
+		// the iterations stay open: the next run reuses them
+		panic(err)
 	}
 	return coordinator
 }
@@ -0,0 +1,27 @@
+// Package spatial provides topologies for metapopulation and lattice models, the
+// neighbour-sum and diffusion operators defined over them, and ready-made
+// iterations for processes coupled across a network or a grid.
+//
+// Key Features:
+//   - Topology: a weighted graph over nodes, built from an edge list (inline or
+//     from CSV) or a rectangular grid spec
+//   - NeighboursSum and Laplacian operators, also available to ExpressionIteration
+//     as neighbours_sum(x) and laplacian(x) when its spec has a topology
+//   - SIRNetworkIteration for stochastic SIR epidemics on a network of populations
+//   - ReactionDiffusionIteration for reaction-diffusion on a grid or network
+//
+// Mathematical Background:
+// A node-indexed state x is coupled through the weighted adjacency w_ij, where
+// w_ij is the weight with which node j's value reaches node i. The neighbour sum
+// is (Wx)_i = Σ_j w_ij x_j and the graph Laplacian is
+//
+//	(Lx)_i = Σ_j w_ij (x_j - x_i),
+//
+// which on a unit-weight grid is the five-point finite-difference Laplacian with
+// zero-flux boundaries (or periodic ones on a torus).
+//
+// Usage Patterns:
+//   - Epidemics across local authorities linked by commuting flows
+//   - Environmental quantities spreading between monitoring sites
+//   - Pattern formation and invasion fronts on a lattice
+package spatial
@@ -0,0 +1,99 @@
+package spatial
+
+import (
+	"math"
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+func runReactionDiffusion(
+	settings *simulator.Settings,
+	iteration *ReactionDiffusionIteration,
+	steps int,
+	stepsize float64,
+) [][]float64 {
+	iteration.Configure(0, settings)
+	store := simulator.NewStateTimeStorage()
+	implementations := &simulator.Implementations{
+		Iterations:      []simulator.Iteration{iteration},
+		OutputCondition: &simulator.EveryStepOutputCondition{},
+		OutputFunction:  &simulator.StateTimeStorageOutputFunction{Store: store},
+		TerminationCondition: &simulator.NumberOfStepsTerminationCondition{
+			MaxNumberOfSteps: steps,
+		},
+		TimestepFunction: &simulator.ConstantTimestepFunction{Stepsize: stepsize},
+	}
+	simulator.NewPartitionCoordinator(settings, implementations).Run()
+	return store.GetValues("field")
+}
+
+func TestReactionDiffusion(t *testing.T) {
+	t.Run(
+		"test that pure diffusion conserves mass and spreads evenly",
+		func(t *testing.T) {
+			settings := simulator.LoadSettingsFromYaml("./reaction_diffusion_settings.yaml")
+			rows := runReactionDiffusion(
+				settings,
+				&ReactionDiffusionIteration{Topology: NewGridTopology(3, 3, true)},
+				200,
+				1.0,
+			)
+			for _, row := range rows {
+				total := 0.0
+				for _, x := range row {
+					total += x
+				}
+				if math.Abs(total-1) > 1e-12 {
+					t.Fatalf("mass %v, want 1", total)
+				}
+			}
+			for i, x := range rows[len(rows)-1] {
+				if math.Abs(x-1.0/9.0) > 1e-6 {
+					t.Errorf("node %d: %v, want the uniform 1/9", i, x)
+				}
+			}
+		},
+	)
+	t.Run(
+		"test that a fisher-kpp front invades the whole grid",
+		func(t *testing.T) {
+			settings := simulator.LoadSettingsFromYaml("./reaction_diffusion_settings.yaml")
+			rows := runReactionDiffusion(
+				settings,
+				&ReactionDiffusionIteration{
+					Topology: NewGridTopology(3, 3, false),
+					Reaction: FisherKPPReaction,
+				},
+				300,
+				0.1,
+			)
+			for i, x := range rows[len(rows)-1] {
+				if math.Abs(x-1) > 1e-3 {
+					t.Errorf("node %d: %v, want the carrying capacity 1", i, x)
+				}
+			}
+		},
+	)
+	t.Run(
+		"test that the reaction diffusion iteration runs with harnesses",
+		func(t *testing.T) {
+			settings := simulator.LoadSettingsFromYaml("./reaction_diffusion_settings.yaml")
+			implementations := &simulator.Implementations{
+				Iterations: []simulator.Iteration{&ReactionDiffusionIteration{
+					Topology: NewGridTopology(3, 3, false),
+					Reaction: FisherKPPReaction,
+				}},
+				OutputCondition: &simulator.EveryStepOutputCondition{},
+				OutputFunction:  &simulator.NilOutputFunction{},
+				TerminationCondition: &simulator.NumberOfStepsTerminationCondition{
+					MaxNumberOfSteps: 100,
+				},
+				TimestepFunction: &simulator.ConstantTimestepFunction{Stepsize: 0.1},
+			}
+			if err := simulator.RunWithHarnesses(settings, implementations); err != nil {
+				t.Errorf("test harness failed: %v", err)
+			}
+		},
+	)
+}
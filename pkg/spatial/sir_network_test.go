@@ -0,0 +1,95 @@
+package spatial
+
+import (
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+func newLineTopology(t *testing.T) *Topology {
+	t.Helper()
+	topology, err := NewNetworkTopology(3, []Edge{{From: 0, To: 1}, {From: 1, To: 2}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return topology
+}
+
+func TestSIRNetwork(t *testing.T) {
+	t.Run(
+		"test that the epidemic spreads along the network and conserves populations",
+		func(t *testing.T) {
+			settings := simulator.LoadSettingsFromYaml("./sir_network_settings.yaml")
+			iteration := &SIRNetworkIteration{Topology: newLineTopology(t)}
+			iteration.Configure(0, settings)
+			store := simulator.NewStateTimeStorage()
+			implementations := &simulator.Implementations{
+				Iterations:      []simulator.Iteration{iteration},
+				OutputCondition: &simulator.EveryStepOutputCondition{},
+				OutputFunction:  &simulator.StateTimeStorageOutputFunction{Store: store},
+				TerminationCondition: &simulator.NumberOfStepsTerminationCondition{
+					MaxNumberOfSteps: 200,
+				},
+				TimestepFunction: &simulator.ConstantTimestepFunction{Stepsize: 0.5},
+			}
+			simulator.NewPartitionCoordinator(settings, implementations).Run()
+			rows := store.GetValues("sir_network")
+			for _, row := range rows {
+				for node := 0; node < 3; node++ {
+					if total := row[node] + row[3+node] + row[6+node]; total != 1000 {
+						t.Fatalf("node %d: population %v, want 1000", node, total)
+					}
+				}
+			}
+			final := rows[len(rows)-1]
+			if final[8] == 0 {
+				t.Error("the epidemic never reached the far end of the line")
+			}
+		},
+	)
+	t.Run(
+		"test that an uncoupled network keeps outbreaks apart",
+		func(t *testing.T) {
+			settings := simulator.LoadSettingsFromYaml("./sir_network_settings.yaml")
+			settings.Iterations[0].Params.Set("coupling", []float64{0})
+			iteration := &SIRNetworkIteration{Topology: newLineTopology(t)}
+			iteration.Configure(0, settings)
+			store := simulator.NewStateTimeStorage()
+			implementations := &simulator.Implementations{
+				Iterations:      []simulator.Iteration{iteration},
+				OutputCondition: &simulator.EveryStepOutputCondition{},
+				OutputFunction:  &simulator.StateTimeStorageOutputFunction{Store: store},
+				TerminationCondition: &simulator.NumberOfStepsTerminationCondition{
+					MaxNumberOfSteps: 100,
+				},
+				TimestepFunction: &simulator.ConstantTimestepFunction{Stepsize: 0.5},
+			}
+			simulator.NewPartitionCoordinator(settings, implementations).Run()
+			for _, row := range store.GetValues("sir_network") {
+				if row[1] != 1000 || row[2] != 1000 {
+					t.Fatalf("uncoupled nodes were infected: %v", row)
+				}
+			}
+		},
+	)
+	t.Run(
+		"test that the sir network iteration runs with harnesses",
+		func(t *testing.T) {
+			settings := simulator.LoadSettingsFromYaml("./sir_network_settings.yaml")
+			implementations := &simulator.Implementations{
+				Iterations: []simulator.Iteration{
+					&SIRNetworkIteration{Topology: newLineTopology(t)},
+				},
+				OutputCondition: &simulator.EveryStepOutputCondition{},
+				OutputFunction:  &simulator.NilOutputFunction{},
+				TerminationCondition: &simulator.NumberOfStepsTerminationCondition{
+					MaxNumberOfSteps: 100,
+				},
+				TimestepFunction: &simulator.ConstantTimestepFunction{Stepsize: 0.5},
+			}
+			if err := simulator.RunWithHarnesses(settings, implementations); err != nil {
+				t.Errorf("test harness failed: %v", err)
+			}
+		},
+	)
+}
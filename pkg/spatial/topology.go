@@ -0,0 +1,271 @@
+package spatial
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Edge is a weighted link carrying node From's value into node To's neighbour sum.
+// A nil Weight is read as 1; an explicit weight, zero included, is kept as given.
+type Edge struct {
+	From   int
+	To     int
+	Weight *float64
+}
+
+// EdgeWeight returns weight as an Edge's Weight.
+func EdgeWeight(weight float64) *float64 {
+	return &weight
+}
+
+// weight is the edge's weight, defaulting to 1 when unset.
+func (e Edge) weight() float64 {
+	if e.Weight == nil {
+		return 1
+	}
+	return *e.Weight
+}
+
+// Topology is a weighted graph over numbered nodes, stored as each node's
+// incoming neighbours and weights.
+type Topology struct {
+	offsets    []int
+	neighbours []int
+	weights    []float64
+}
+
+// NewNetworkTopology builds a topology over numNodes nodes from an edge list. An
+// undirected topology links each edge both ways; a directed one only carries
+// From into To. It returns an error if an edge names a node out of range.
+func NewNetworkTopology(numNodes int, edges []Edge, directed bool) (*Topology, error) {
+	if numNodes <= 0 {
+		return nil, fmt.Errorf("spatial: topology needs at least one node, got %d", numNodes)
+	}
+	incoming := make([][]Edge, numNodes)
+	for i, edge := range edges {
+		if edge.From < 0 || edge.From >= numNodes || edge.To < 0 || edge.To >= numNodes {
+			return nil, fmt.Errorf(
+				"spatial: edge %d (%d -> %d) is outside nodes 0-%d",
+				i, edge.From, edge.To, numNodes-1)
+		}
+		incoming[edge.To] = append(incoming[edge.To], edge)
+		if !directed && edge.From != edge.To {
+			incoming[edge.From] = append(
+				incoming[edge.From], Edge{From: edge.To, To: edge.From, Weight: edge.Weight})
+		}
+	}
+	t := &Topology{offsets: make([]int, numNodes+1)}
+	for node, in := range incoming {
+		for _, edge := range in {
+			t.neighbours = append(t.neighbours, edge.From)
+			t.weights = append(t.weights, edge.weight())
+		}
+		t.offsets[node+1] = len(t.neighbours)
+	}
+	return t, nil
+}
+
+// NewGridTopology builds the four-neighbour lattice of a rows by cols grid with
+// unit weights, numbering node (r, c) as r*cols + c. A periodic grid wraps at its
+// edges into a torus; otherwise boundary nodes simply have fewer neighbours.
+func NewGridTopology(rows, cols int, periodic bool) *Topology {
+	if rows <= 0 || cols <= 0 {
+		panic(fmt.Sprintf("spatial: grid must be at least 1x1, got %dx%d", rows, cols))
+	}
+	edges := make([]Edge, 0, 2*rows*cols)
+	link := func(r, c, r2, c2 int) {
+		if periodic {
+			r2, c2 = (r2+rows)%rows, (c2+cols)%cols
+		} else if r2 < 0 || r2 >= rows || c2 < 0 || c2 >= cols {
+			return
+		}
+		if r2 == r && c2 == c {
+			return
+		}
+		edges = append(edges, Edge{From: r2*cols + c2, To: r*cols + c})
+	}
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			link(r, c, r-1, c)
+			link(r, c, r+1, c)
+			link(r, c, r, c-1)
+			link(r, c, r, c+1)
+		}
+	}
+	// Each direction is listed from the receiving node, so the edges are directed
+	// already and a narrow periodic grid keeps its doubled links.
+	topology, err := NewNetworkTopology(rows*cols, edges, true)
+	if err != nil {
+		panic(err)
+	}
+	return topology
+}
+
+// NumNodes returns the number of nodes.
+func (t *Topology) NumNodes() int {
+	return len(t.offsets) - 1
+}
+
+// Neighbours returns the nodes whose values reach node and their weights. The
+// returned slices must not be modified.
+func (t *Topology) Neighbours(node int) ([]int, []float64) {
+	return t.neighbours[t.offsets[node]:t.offsets[node+1]],
+		t.weights[t.offsets[node]:t.offsets[node+1]]
+}
+
+// Degree returns the total weight reaching node.
+func (t *Topology) Degree(node int) float64 {
+	total := 0.0
+	for _, w := range t.weights[t.offsets[node]:t.offsets[node+1]] {
+		total += w
+	}
+	return total
+}
+
+func (t *Topology) checkWidths(x, out []float64) {
+	if len(x) != t.NumNodes() || len(out) != t.NumNodes() {
+		panic(fmt.Sprintf("spatial: operator on %d nodes given widths %d and %d",
+			t.NumNodes(), len(x), len(out)))
+	}
+}
+
+// NeighboursSum writes (Wx)_i = Σ_j w_ij x_j into out.
+func (t *Topology) NeighboursSum(x, out []float64) {
+	t.checkWidths(x, out)
+	for i := range out {
+		total := 0.0
+		for k := t.offsets[i]; k < t.offsets[i+1]; k++ {
+			total += t.weights[k] * x[t.neighbours[k]]
+		}
+		out[i] = total
+	}
+}
+
+// Laplacian writes (Lx)_i = Σ_j w_ij (x_j - x_i) into out.
+func (t *Topology) Laplacian(x, out []float64) {
+	t.checkWidths(x, out)
+	for i := range out {
+		total := 0.0
+		for k := t.offsets[i]; k < t.offsets[i+1]; k++ {
+			total += t.weights[k] * (x[t.neighbours[k]] - x[i])
+		}
+		out[i] = total
+	}
+}
+
+// LoadEdgeListFromCsv reads an edge list with columns from, to and an optional
+// weight, skipping a header row if the first row is not numeric. numNodes may be
+// 0 to size the topology by the largest node mentioned.
+func LoadEdgeListFromCsv(path string, numNodes int, directed bool) (*Topology, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("spatial: parsing %s: %w", path, err)
+	}
+	rows := make([][]float64, 0, len(records))
+	for i, record := range records {
+		row := make([]float64, len(record))
+		for j, field := range record {
+			row[j], err = strconv.ParseFloat(field, 64)
+			if err != nil {
+				break
+			}
+		}
+		if err != nil {
+			if i == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("spatial: %s row %d: %w", path, i+1, err)
+		}
+		rows = append(rows, row)
+	}
+	edges, err := edgesFromRows(rows)
+	if err != nil {
+		return nil, fmt.Errorf("spatial: %s: %w", path, err)
+	}
+	return NewNetworkTopology(inferNumNodes(numNodes, edges), edges, directed)
+}
+
+func edgesFromRows(rows [][]float64) ([]Edge, error) {
+	edges := make([]Edge, len(rows))
+	for i, row := range rows {
+		if len(row) != 2 && len(row) != 3 {
+			return nil, fmt.Errorf("edge %d has %d values, want from, to and "+
+				"optionally a weight", i, len(row))
+		}
+		edges[i] = Edge{From: int(row[0]), To: int(row[1])}
+		if len(row) == 3 {
+			edges[i].Weight = EdgeWeight(row[2])
+		}
+	}
+	return edges, nil
+}
+
+func inferNumNodes(numNodes int, edges []Edge) int {
+	if numNodes > 0 {
+		return numNodes
+	}
+	for _, edge := range edges {
+		numNodes = max(numNodes, edge.From+1, edge.To+1)
+	}
+	return numNodes
+}
+
+// GridSpec is the data form of NewGridTopology.
+type GridSpec struct {
+	Rows     int  `yaml:"rows"`
+	Cols     int  `yaml:"cols"`
+	Periodic bool `yaml:"periodic,omitempty"`
+}
+
+// TopologySpec is the data form of a Topology, as written in a config. Exactly one
+// of Grid, Edges and EdgeListCsv must be set.
+type TopologySpec struct {
+	// Grid gives a rectangular lattice.
+	Grid *GridSpec `yaml:"grid,omitempty"`
+	// Edges lists [from, to] or [from, to, weight] triples inline.
+	Edges [][]float64 `yaml:"edges,omitempty"`
+	// EdgeListCsv is the path of an edge list file (see LoadEdgeListFromCsv).
+	EdgeListCsv string `yaml:"edge_list_csv,omitempty"`
+	// Nodes is the number of nodes of an edge-list topology, or 0 to infer it.
+	Nodes int `yaml:"nodes,omitempty"`
+	// Directed makes each edge carry From into To only.
+	Directed bool `yaml:"directed,omitempty"`
+}
+
+// Build constructs the Topology the spec describes.
+func (s *TopologySpec) Build() (*Topology, error) {
+	set := 0
+	for _, given := range []bool{s.Grid != nil, s.Edges != nil, s.EdgeListCsv != ""} {
+		if given {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf(
+			"spatial: a topology needs exactly one of grid, edges or edge_list_csv")
+	}
+	switch {
+	case s.Grid != nil:
+		if s.Grid.Rows <= 0 || s.Grid.Cols <= 0 {
+			return nil, fmt.Errorf("spatial: grid must be at least 1x1, got %dx%d",
+				s.Grid.Rows, s.Grid.Cols)
+		}
+		return NewGridTopology(s.Grid.Rows, s.Grid.Cols, s.Grid.Periodic), nil
+	case s.EdgeListCsv != "":
+		return LoadEdgeListFromCsv(s.EdgeListCsv, s.Nodes, s.Directed)
+	}
+	edges, err := edgesFromRows(s.Edges)
+	if err != nil {
+		return nil, fmt.Errorf("spatial: %w", err)
+	}
+	return NewNetworkTopology(inferNumNodes(s.Nodes, edges), edges, s.Directed)
+}
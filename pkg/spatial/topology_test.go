@@ -0,0 +1,141 @@
+package spatial
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTopology(t *testing.T) {
+	t.Run(
+		"test that a grid has four-neighbour links and zero-flux edges",
+		func(t *testing.T) {
+			grid := NewGridTopology(3, 4, false)
+			if grid.NumNodes() != 12 {
+				t.Fatalf("got %d nodes, want 12", grid.NumNodes())
+			}
+			for node, want := range map[int]float64{0: 2, 1: 3, 5: 4, 11: 2} {
+				if got := grid.Degree(node); got != want {
+					t.Errorf("node %d: degree %v, want %v", node, got, want)
+				}
+			}
+			x := make([]float64, 12)
+			x[5] = 1
+			out := make([]float64, 12)
+			grid.Laplacian(x, out)
+			total := 0.0
+			for _, v := range out {
+				total += v
+			}
+			if out[5] != -4 || out[1] != 1 || out[4] != 1 || total != 0 {
+				t.Errorf("got laplacian %v", out)
+			}
+		},
+	)
+	t.Run(
+		"test that a periodic grid wraps into a torus",
+		func(t *testing.T) {
+			grid := NewGridTopology(3, 3, true)
+			for node := 0; node < 9; node++ {
+				if grid.Degree(node) != 4 {
+					t.Errorf("node %d: degree %v, want 4", node, grid.Degree(node))
+				}
+			}
+			neighbours, _ := grid.Neighbours(0)
+			want := map[int]bool{6: true, 3: true, 2: true, 1: true}
+			for _, j := range neighbours {
+				if !want[j] {
+					t.Errorf("node 0 has unexpected neighbour %d", j)
+				}
+			}
+		},
+	)
+	t.Run(
+		"test that edge lists are weighted and optionally directed",
+		func(t *testing.T) {
+			edges := []Edge{{From: 0, To: 1, Weight: EdgeWeight(2)}, {From: 1, To: 2}}
+			undirected, err := NewNetworkTopology(3, edges, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := make([]float64, 3)
+			undirected.NeighboursSum([]float64{1, 10, 100}, out)
+			if out[0] != 20 || out[1] != 102 || out[2] != 10 {
+				t.Errorf("undirected neighbour sums %v", out)
+			}
+			directed, err := NewNetworkTopology(3, edges, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			directed.NeighboursSum([]float64{1, 10, 100}, out)
+			if out[0] != 0 || out[1] != 2 || out[2] != 10 {
+				t.Errorf("directed neighbour sums %v", out)
+			}
+			if _, err := NewNetworkTopology(2, edges, false); err == nil {
+				t.Error("expected an error for an edge outside the nodes")
+			}
+		},
+	)
+	t.Run(
+		"test that an explicit zero weight is kept rather than read as 1",
+		func(t *testing.T) {
+			edges := []Edge{{From: 0, To: 1, Weight: EdgeWeight(0)}, {From: 1, To: 2}}
+			topology, err := NewNetworkTopology(3, edges, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := make([]float64, 3)
+			topology.NeighboursSum([]float64{1, 10, 100}, out)
+			if out[1] != 0 || out[2] != 10 {
+				t.Errorf("neighbour sums %v, want the zero-weight edge to carry nothing", out)
+			}
+			spec, err := edgesFromRows([][]float64{{0, 1, 0}, {1, 2}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if spec[0].weight() != 0 || spec[1].weight() != 1 {
+				t.Errorf("edge list weights %v and %v, want 0 and 1",
+					spec[0].weight(), spec[1].weight())
+			}
+		},
+	)
+	t.Run(
+		"test that a topology spec builds from each of its forms",
+		func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "edges.csv")
+			if err := os.WriteFile(path, []byte("from,to,weight\n0,1,0.5\n1,3,1\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			for name, c := range map[string]struct {
+				spec  TopologySpec
+				nodes int
+			}{
+				"grid":   {TopologySpec{Grid: &GridSpec{Rows: 2, Cols: 5}}, 10},
+				"edges":  {TopologySpec{Edges: [][]float64{{0, 1}, {1, 2, 3}}}, 3},
+				"nodes":  {TopologySpec{Edges: [][]float64{{0, 1}}, Nodes: 5}, 5},
+				"csv":    {TopologySpec{EdgeListCsv: path}, 4},
+				"csv, n": {TopologySpec{EdgeListCsv: path, Nodes: 6}, 6},
+			} {
+				topology, err := c.spec.Build()
+				if err != nil {
+					t.Errorf("%s: %v", name, err)
+					continue
+				}
+				if topology.NumNodes() != c.nodes {
+					t.Errorf("%s: got %d nodes, want %d", name, topology.NumNodes(), c.nodes)
+				}
+			}
+			for name, spec := range map[string]TopologySpec{
+				"none":      {},
+				"two forms": {Grid: &GridSpec{Rows: 1, Cols: 1}, Edges: [][]float64{{0, 1}}},
+				"bad edge":  {Edges: [][]float64{{0}}},
+				"bad grid":  {Grid: &GridSpec{Rows: 0, Cols: 3}},
+				"no file":   {EdgeListCsv: filepath.Join(t.TempDir(), "missing.csv")},
+			} {
+				if _, err := spec.Build(); err == nil {
+					t.Errorf("%s: expected an error", name)
+				}
+			}
+		},
+	)
+}
@@ -0,0 +1,32 @@
+// Package starlark is an opt-in scripting partition: it runs a Starlark script
+// behind the engine's simulator.Iteration interface, for components whose logic
+// the expression DSL deliberately cannot say — order matching, queue
+// disciplines and anything else that loops over a structure that grows and
+// shrinks — but which do not warrant a bespoke Go iteration. Starlark is a small
+// Python dialect with a pure-Go interpreter (go.starlark.net), deterministic by
+// design: no clock, no filesystem, no unordered iteration.
+//
+// # Why a separate module
+//
+// This is a SEPARATE module, like pkg/wasm and pkg/s3store, so the engine's own
+// go.mod never carries the interpreter. It needs no cgo and no build tag:
+// importing the package is the whole opt-in. It self-registers the {type:
+// starlark} spelling through api.RegisterIteration, and cmd/stochadex
+// blank-imports it in every build.
+//
+// # Config surface
+//
+//	iteration:
+//	  type: starlark
+//	  script_path: queue.star    # or script: an inline source, exactly one
+//	  histories: [arrivals]      # other partitions whose histories are passed too
+//	  max_steps: 100000000       # optional step budget for each call
+//
+// The script defines iterate(state, params, histories, time) and returns the
+// next state; StarlarkIteration describes the arguments and the seeded draws.
+// While loops, recursion and sets are enabled. Top-level code runs once per run
+// at Configure, after which the script's globals are frozen, so constants and
+// helper functions belong at the top level and anything that changes from step
+// to step belongs in the state. Each call is bounded by max_steps, so a loop that never
+// ends stops the run with an error instead of hanging it.
+package starlark
@@ -0,0 +1,376 @@
+package starlark
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/umbralcalc/stochadex/pkg/api"
+	"github.com/umbralcalc/stochadex/pkg/rng"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+	starlarkmath "go.starlark.net/lib/math"
+	sl "go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// init self-registers the starlark spelling with the engine's config surface.
+// Importing this module is the opt-in: a CLI or a downstream library that
+// blank-imports it gains {type: starlark} without the engine core depending on
+// the interpreter.
+func init() {
+	api.RegisterIteration("starlark", BuildIteration)
+}
+
+// DefaultMaxSteps bounds the Starlark execution steps of each call into the
+// script when a StarlarkIteration's MaxSteps is zero: a few seconds of
+// interpretation, far more than any step should take.
+const DefaultMaxSteps = 100_000_000
+
+// fileOptions admits the statements the expression DSL lacks — while loops,
+// recursion, sets and top-level control flow — while keeping top-level names
+// single-assignment. Since a loop may then never end, every call into the
+// script runs under a step budget (see StarlarkIteration.MaxSteps).
+var fileOptions = &syntax.FileOptions{
+	Set:             true,
+	While:           true,
+	TopLevelControl: true,
+	Recursion:       true,
+}
+
+// StarlarkIteration computes a partition's next state with a Starlark script,
+// for logic the expression DSL cannot say — loops over queues, order books and
+// other dynamic structures — without writing a bespoke Go iteration. The
+// script defines
+//
+//	def iterate(state, params, histories, time):
+//	    ...
+//	    return next_state
+//
+// which is called each step and returns the next state as a list or tuple of
+// state_width numbers (or a single number when state_width is 1).
+//
+// Usage hints:
+//   - Exactly one of Script (the source) and ScriptPath (a .star file) is set.
+//   - state is the partition's latest state as a tuple; params maps each param
+//     name to a tuple of its values; histories maps the partition's own name
+//     and each partition named in Histories to a tuple of its rows, each a
+//     tuple, most recent first; time has the fields t, dt and step.
+//   - Everything the script is handed is read-only, and its globals are frozen
+//     once the top level has run, so the next state can only depend on what
+//     iterate is given and on its draws.
+//   - The draws normal(mu, sigma), uniform(lo, hi), gamma(alpha, beta),
+//     beta(alpha, beta), binomial(n, p), exponential(rate) and poisson(lambda)
+//     each return one sample from a stream seeded by the partition's seed,
+//     parameterised as in the expression DSL. The math module is predeclared
+//     and print writes to stderr; load is not available.
+//   - MaxSteps bounds the Starlark execution steps of the top level and of
+//     each iterate call (DefaultMaxSteps if zero); a script that exceeds it,
+//     say by looping forever, is cancelled and stops the run.
+type StarlarkIteration struct {
+	Script     string
+	ScriptPath string
+	Histories  []string
+	MaxSteps   uint64
+
+	partitionName  string
+	stateWidth     int
+	historyIndices []int
+	historyNames   []string
+	thread         *sl.Thread
+	iterate        *sl.Function
+	sampler        *rng.Sampler
+	out            []float64
+}
+
+// Configure runs the script's top level and finds its iterate function. It
+// panics on a malformed specification: a script that does not load is a
+// configuration error, not something to discover mid-run.
+func (s *StarlarkIteration) Configure(
+	partitionIndex int,
+	settings *simulator.Settings,
+) {
+	iteration := settings.Iterations[partitionIndex]
+	s.partitionName = iteration.Name
+	s.stateWidth = iteration.StateWidth
+	s.historyIndices = []int{partitionIndex}
+	s.historyNames = []string{iteration.Name}
+	for _, name := range s.Histories {
+		index := -1
+		for i, other := range settings.Iterations {
+			if other.Name == name {
+				index = i
+			}
+		}
+		if index < 0 {
+			panic(fmt.Sprintf(
+				"starlark %q: histories names unknown partition %q", s.partitionName, name))
+		}
+		s.historyIndices = append(s.historyIndices, index)
+		s.historyNames = append(s.historyNames, name)
+	}
+	var source interface{}
+	filename := s.ScriptPath
+	switch {
+	case s.Script != "" && s.ScriptPath != "":
+		panic(fmt.Sprintf(
+			"starlark %q: set either script or script_path, not both", s.partitionName))
+	case s.Script != "":
+		source, filename = s.Script, s.partitionName+".star"
+	case s.ScriptPath == "":
+		panic(fmt.Sprintf("starlark %q: no script or script_path given", s.partitionName))
+	}
+	s.sampler = rng.New(iteration.Seed)
+	s.thread = &sl.Thread{
+		Name: s.partitionName,
+		Print: func(_ *sl.Thread, message string) {
+			fmt.Fprintf(os.Stderr, "starlark %q: %s\n", s.partitionName, message)
+		},
+		OnMaxSteps: func(thread *sl.Thread) {
+			thread.Cancel(fmt.Sprintf(
+				"more than max_steps %d steps in one call", s.maxSteps()))
+		},
+	}
+	s.thread.SetMaxExecutionSteps(s.maxSteps())
+	globals, err := sl.ExecFileOptions(
+		fileOptions, s.thread, filename, source, s.predeclared())
+	if err != nil {
+		panic(fmt.Sprintf("starlark %q: %s", s.partitionName, describe(err)))
+	}
+	iterate, ok := globals["iterate"].(*sl.Function)
+	if !ok {
+		panic(fmt.Sprintf(
+			"starlark %q: the script must define iterate(state, params, histories, time)",
+			s.partitionName))
+	}
+	if iterate.NumParams() != 4 {
+		panic(fmt.Sprintf(
+			"starlark %q: iterate takes %d parameters, want 4 "+
+				"(state, params, histories, time)", s.partitionName, iterate.NumParams()))
+	}
+	s.iterate = iterate
+	s.out = make([]float64, s.stateWidth)
+}
+
+// Iterate calls the script's iterate function and converts what it returns
+// into the next state.
+func (s *StarlarkIteration) Iterate(
+	params *simulator.Params,
+	partitionIndex int,
+	stateHistories []*simulator.StateHistory,
+	timestepsHistory *simulator.CumulativeTimestepsHistory,
+) []float64 {
+	paramsDict := sl.NewDict(len(params.Map))
+	for name, values := range params.Map {
+		paramsDict.SetKey(sl.String(name), floatTuple(values))
+	}
+	paramsDict.Freeze()
+	historiesDict := sl.NewDict(len(s.historyIndices))
+	for i, index := range s.historyIndices {
+		history := stateHistories[index]
+		rows := make(sl.Tuple, history.StateHistoryDepth)
+		for row := range rows {
+			rows[row] = floatTuple(history.Values.RawRowView(row))
+		}
+		historiesDict.SetKey(sl.String(s.historyNames[i]), rows)
+	}
+	historiesDict.Freeze()
+	time := starlarkstruct.FromStringDict(starlarkstruct.Default, sl.StringDict{
+		"t":    sl.Float(timestepsHistory.Values.AtVec(0)),
+		"dt":   sl.Float(timestepsHistory.NextIncrement),
+		"step": sl.MakeInt(timestepsHistory.CurrentStepNumber),
+	})
+	state := floatTuple(stateHistories[partitionIndex].Values.RawRowView(0))
+	// the budget is per call
+	s.thread.Steps = 0
+	result, err := sl.Call(s.thread, s.iterate,
+		sl.Tuple{state, paramsDict, historiesDict, time}, nil)
+	if err != nil {
+		panic(fmt.Sprintf("starlark %q: step %d: %s",
+			s.partitionName, timestepsHistory.CurrentStepNumber, describe(err)))
+	}
+	if err := s.store(result); err != nil {
+		panic(fmt.Sprintf("starlark %q: step %d: iterate returned %s",
+			s.partitionName, timestepsHistory.CurrentStepNumber, err))
+	}
+	return s.out
+}
+
+func (s *StarlarkIteration) maxSteps() uint64 {
+	if s.MaxSteps > 0 {
+		return s.MaxSteps
+	}
+	return DefaultMaxSteps
+}
+
+// store converts the value iterate returned into s.out.
+func (s *StarlarkIteration) store(result sl.Value) error {
+	if number, ok := sl.AsFloat(result); ok && s.stateWidth == 1 {
+		s.out[0] = number
+		return nil
+	}
+	sequence, ok := result.(sl.Indexable)
+	if !ok || result.Type() == "string" {
+		return fmt.Errorf("a %s, want a list or tuple of %d numbers",
+			result.Type(), s.stateWidth)
+	}
+	if sequence.Len() != s.stateWidth {
+		return fmt.Errorf("%d values, want state width %d", sequence.Len(), s.stateWidth)
+	}
+	for i := range s.out {
+		number, ok := sl.AsFloat(sequence.Index(i))
+		if !ok {
+			return fmt.Errorf("a %s at index %d, want a number",
+				sequence.Index(i).Type(), i)
+		}
+		s.out[i] = number
+	}
+	return nil
+}
+
+// predeclared returns the names every script sees: the math module and the
+// seeded draws.
+func (s *StarlarkIteration) predeclared() sl.StringDict {
+	return sl.StringDict{
+		"math":        starlarkmath.Module,
+		"normal":      s.draw2("normal", s.sampler.Normal),
+		"uniform":     s.draw2("uniform", s.sampler.Uniform),
+		"gamma":       s.draw2("gamma", s.sampler.Gamma),
+		"beta":        s.draw2("beta", s.sampler.Beta),
+		"exponential": s.draw1("exponential", s.sampler.Exponential),
+		"poisson":     s.draw1("poisson", s.sampler.Poisson),
+		// pkg/rng leaves Binomial on distuv; draw from the sampler's own
+		// generator so a partition still has exactly one stream, as the
+		// expression DSL does.
+		"binomial": s.draw2("binomial", func(n, p float64) float64 {
+			return distuv.Binomial{N: n, P: p, Src: s.sampler.Rand()}.Rand()
+		}),
+	}
+}
+
+// draw1 wraps a one-parameter draw as a builtin.
+func (s *StarlarkIteration) draw1(name string, draw func(float64) float64) *sl.Builtin {
+	return sl.NewBuiltin(name, func(
+		_ *sl.Thread, b *sl.Builtin, args sl.Tuple, kwargs []sl.Tuple,
+	) (sl.Value, error) {
+		var a sl.Value
+		if err := sl.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &a); err != nil {
+			return nil, err
+		}
+		x, err := number(b.Name(), a)
+		if err != nil {
+			return nil, err
+		}
+		return sample(b.Name(), func() float64 { return draw(x) })
+	})
+}
+
+// draw2 wraps a two-parameter draw as a builtin.
+func (s *StarlarkIteration) draw2(
+	name string,
+	draw func(float64, float64) float64,
+) *sl.Builtin {
+	return sl.NewBuiltin(name, func(
+		_ *sl.Thread, b *sl.Builtin, args sl.Tuple, kwargs []sl.Tuple,
+	) (sl.Value, error) {
+		var a, c sl.Value
+		if err := sl.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &a, &c); err != nil {
+			return nil, err
+		}
+		x, err := number(b.Name(), a)
+		if err != nil {
+			return nil, err
+		}
+		y, err := number(b.Name(), c)
+		if err != nil {
+			return nil, err
+		}
+		return sample(b.Name(), func() float64 { return draw(x, y) })
+	})
+}
+
+// sample takes a draw, turning the sampler's panic on invalid parameters into
+// a Starlark error that carries the script's backtrace.
+func sample(name string, draw func() float64) (value sl.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			value, err = nil, fmt.Errorf("%s: %v", name, r)
+		}
+	}()
+	return sl.Float(draw()), nil
+}
+
+// number converts a draw parameter to a float64.
+func number(name string, value sl.Value) (float64, error) {
+	x, ok := sl.AsFloat(value)
+	if !ok {
+		return 0, fmt.Errorf("%s: got %s, want a number", name, value.Type())
+	}
+	return x, nil
+}
+
+// floatTuple converts values to a Starlark tuple of floats.
+func floatTuple(values []float64) sl.Tuple {
+	tuple := make(sl.Tuple, len(values))
+	for i, value := range values {
+		tuple[i] = sl.Float(value)
+	}
+	return tuple
+}
+
+// describe formats an error from the interpreter, with the script's backtrace
+// when there is one.
+func describe(err error) string {
+	var evalErr *sl.EvalError
+	if errors.As(err, &evalErr) {
+		return evalErr.Backtrace()
+	}
+	return err.Error()
+}
+
+// BuildIteration constructs a StarlarkIteration from a data spec, validating
+// fields strictly (an unknown key is an error, matching the rest of the config
+// surface).
+func BuildIteration(spec simulator.ComponentSpec) (simulator.Iteration, error) {
+	iteration := &StarlarkIteration{}
+	for key, value := range spec.Fields {
+		switch key {
+		case "script", "script_path":
+			text, ok := value.(string)
+			if !ok || text == "" {
+				return nil, fmt.Errorf("starlark: %s must be a non-empty string", key)
+			}
+			if key == "script" {
+				iteration.Script = text
+			} else {
+				iteration.ScriptPath = text
+			}
+		case "histories":
+			items, ok := value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("starlark: histories must be a list of partition names")
+			}
+			for _, item := range items {
+				name, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf(
+						"starlark: histories must be a list of partition names")
+				}
+				iteration.Histories = append(iteration.Histories, name)
+			}
+		case "max_steps":
+			steps, ok := value.(int)
+			if !ok || steps <= 0 {
+				return nil, fmt.Errorf("starlark: max_steps must be a positive integer")
+			}
+			iteration.MaxSteps = uint64(steps)
+		default:
+			return nil, fmt.Errorf("starlark: unknown field %q", key)
+		}
+	}
+	if (iteration.Script == "") == (iteration.ScriptPath == "") {
+		return nil, fmt.Errorf("starlark: exactly one of script and script_path is required")
+	}
+	return iteration, nil
+}
@@ -0,0 +1,223 @@
+package starlark
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/umbralcalc/stochadex/pkg/api"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// summaryScript reports the step, the time, the timestep, the walk's latest
+// value and how many rows of it the script can see, and a uniform draw.
+const summaryScript = `
+def iterate(state, params, histories, time):
+    walk = histories["walk"]
+    return [time.step, time.t, time.dt, walk[0][0], len(walk), uniform(0, 1)]
+`
+
+// starlarkImplementations builds the implementations over
+// starlark_settings.yaml with the summary partition running script.
+func starlarkImplementations(
+	script string,
+	outputFunction simulator.OutputFunction,
+	steps int,
+) *simulator.Implementations {
+	return &simulator.Implementations{
+		Iterations: []simulator.Iteration{
+			&StarlarkIteration{ScriptPath: "./testdata/walk.star"},
+			&StarlarkIteration{Script: script, Histories: []string{"walk"}},
+			&StarlarkIteration{ScriptPath: "./testdata/queue.star"},
+		},
+		OutputCondition: &simulator.EveryStepOutputCondition{},
+		OutputFunction:  outputFunction,
+		TerminationCondition: &simulator.NumberOfStepsTerminationCondition{
+			MaxNumberOfSteps: steps,
+		},
+		TimestepFunction: &simulator.ConstantTimestepFunction{Stepsize: 0.5},
+	}
+}
+
+// runStarlark runs the partitions in starlark_settings.yaml with the summary
+// partition running script, returning its stored output and the run's error.
+func runStarlark(
+	t *testing.T,
+	script string,
+	steps int,
+) (*simulator.StateTimeStorage, error) {
+	t.Helper()
+	settings := simulator.LoadSettingsFromYaml("./starlark_settings.yaml")
+	store := simulator.NewStateTimeStorage()
+	implementations := starlarkImplementations(
+		script, &simulator.StateTimeStorageOutputFunction{Store: store}, steps)
+	for index, iteration := range implementations.Iterations {
+		iteration.Configure(index, settings)
+	}
+	coordinator := simulator.NewPartitionCoordinator(settings, implementations)
+	return store, coordinator.RunContext(t.Context())
+}
+
+func TestStarlark(t *testing.T) {
+	t.Run(
+		"test that the starlark iteration runs",
+		func(t *testing.T) {
+			store, err := runStarlark(t, summaryScript, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			walkValues := store.GetValues("walk")
+			if final := walkValues[len(walkValues)-1]; final[0] != 5.0 || final[1] != 7.5 {
+				t.Errorf("unexpected final walk state: %v", final)
+			}
+			summary := store.GetValues("summary")
+			want := []float64{3, 1.0, 0.5, 1.0, 2}
+			for i, value := range want {
+				if summary[3][i] != value {
+					t.Errorf("unexpected summary at step 3: %v, want %v", summary[3], want)
+					break
+				}
+			}
+			for _, row := range store.GetValues("queue") {
+				for i, work := range row {
+					if work < 0 || (i > 0 && work > 0 && work < row[i-1]) {
+						t.Errorf("queue state is not a sorted list of jobs: %v", row)
+					}
+				}
+			}
+		},
+	)
+	t.Run(
+		"test that the starlark iteration runs with harnesses",
+		func(t *testing.T) {
+			settings := simulator.LoadSettingsFromYaml("./starlark_settings.yaml")
+			implementations := starlarkImplementations(
+				summaryScript, &simulator.NilOutputFunction{}, 20)
+			if err := simulator.RunWithHarnesses(settings, implementations); err != nil {
+				t.Errorf("test harness failed: %v", err)
+			}
+		},
+	)
+	t.Run(
+		"test that draws are seeded by the partition",
+		func(t *testing.T) {
+			first, _ := runStarlark(t, summaryScript, 5)
+			second, _ := runStarlark(t, summaryScript, 5)
+			a, b := first.GetValues("summary"), second.GetValues("summary")
+			for step := range a {
+				if a[step][5] != b[step][5] {
+					t.Errorf("step %d drew %v then %v", step, a[step][5], b[step][5])
+				}
+			}
+			if a[1][5] == a[2][5] {
+				t.Errorf("consecutive steps drew the same value %v", a[1][5])
+			}
+		},
+	)
+	t.Run(
+		"test that the starlark iteration resolves through the registry",
+		func(t *testing.T) {
+			iteration, err := api.ResolveIteration(simulator.ComponentSpec{
+				Type: "starlark",
+				Fields: map[string]interface{}{
+					"script_path": "./testdata/walk.star",
+					"histories":   []interface{}{"summary"},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if script := iteration.(*StarlarkIteration); script.ScriptPath !=
+				"./testdata/walk.star" || len(script.Histories) != 1 {
+				t.Errorf("unexpected iteration: %+v", script)
+			}
+			for _, fields := range []map[string]interface{}{
+				{},
+				{"script": "x = 1", "script_path": "./testdata/walk.star"},
+				{"script": 3},
+				{"script": "x = 1", "histories": "walk"},
+				{"script": "x = 1", "source": "x = 1"},
+				{"script": "x = 1", "max_steps": 0},
+			} {
+				if _, err := BuildIteration(simulator.ComponentSpec{
+					Type: "starlark", Fields: fields,
+				}); err == nil {
+					t.Errorf("expected %v to be rejected", fields)
+				}
+			}
+		},
+	)
+	t.Run(
+		"test that script errors stop the run with a backtrace",
+		func(t *testing.T) {
+			for script, want := range map[string]string{
+				"def iterate(state, params, histories, time):\n" +
+					"    return [1 / (time.step - 2)] * 6\n": "division by zero",
+				"def iterate(state, params, histories, time):\n" +
+					"    params[\"x\"] = (1.0,)\n": "cannot insert into frozen hash table",
+				"def iterate(state, params, histories, time):\n" +
+					"    return [0.0] * 5\n": "5 values, want state width 6",
+				"def iterate(state, params, histories, time):\n" +
+					"    return \"abcdef\"\n": "a string, want a list or tuple",
+				"def iterate(state, params, histories, time):\n" +
+					"    return [gamma(-1, 1)] * 6\n": "gamma: rng: gamma alpha <= 0",
+			} {
+				_, err := runStarlark(t, script, 5)
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("expected an error containing %q, got %v", want, err)
+				}
+			}
+			_, err := runStarlark(t,
+				"def iterate(state, params, histories, time):\n"+
+					"    return [1 / (time.step - 2)] * 6\n", 5)
+			if !strings.Contains(err.Error(), "summary.star:2") {
+				t.Errorf("expected a backtrace naming the line, got %v", err)
+			}
+		},
+	)
+	t.Run(
+		"test that an endless iterate is cancelled by its step budget",
+		func(t *testing.T) {
+			settings := simulator.LoadSettingsFromYaml("./starlark_settings.yaml")
+			implementations := starlarkImplementations(
+				"def iterate(state, params, histories, time):\n"+
+					"    while True:\n"+
+					"        pass\n",
+				&simulator.NilOutputFunction{}, 5)
+			implementations.Iterations[1].(*StarlarkIteration).MaxSteps = 10000
+			for index, iteration := range implementations.Iterations {
+				iteration.Configure(index, settings)
+			}
+			err := simulator.NewPartitionCoordinator(
+				settings, implementations).RunContext(t.Context())
+			if err == nil || !strings.Contains(err.Error(), "max_steps 10000") {
+				t.Errorf("expected the step budget to stop the run, got %v", err)
+			}
+		},
+	)
+	t.Run(
+		"test that configuration errors panic",
+		func(t *testing.T) {
+			settings := simulator.LoadSettingsFromYaml("./starlark_settings.yaml")
+			for name, iteration := range map[string]*StarlarkIteration{
+				"syntax error":    {Script: "def iterate(:\n"},
+				"no iterate":      {Script: "x = 1\n"},
+				"wrong arity":     {Script: "def iterate(state):\n    return state\n"},
+				"missing file":    {ScriptPath: "./testdata/missing.star"},
+				"both given":      {Script: "x = 1", ScriptPath: "./testdata/walk.star"},
+				"unknown history": {ScriptPath: "./testdata/walk.star", Histories: []string{"nope"}},
+				"load":            {Script: "load(\"other.star\", \"f\")\n"},
+				"no script given": {},
+				"endless top":     {Script: "while True:\n    pass\n", MaxSteps: 1000},
+			} {
+				func() {
+					defer func() {
+						if recover() == nil {
+							t.Errorf("%s: expected Configure to panic", name)
+						}
+					}()
+					iteration.Configure(0, settings)
+				}()
+			}
+		},
+	)
+}
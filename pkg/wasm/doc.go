@@ -0,0 +1,73 @@
+// Package wasm is an opt-in sandboxed plugin partition: it runs a WebAssembly
+// module behind the engine's simulator.Iteration interface, so a third-party
+// model component can ship as a .wasm file and join a simulation without cgo,
+// a subprocess or recompiling the engine. Modules run in wazero, a pure-Go
+// WebAssembly runtime, with a memory cap and a deadline on every call.
+//
+// # Why a separate module
+//
+// This is a SEPARATE module, like pkg/onnx and pkg/s3store, so the engine's own
+// go.mod never carries the runtime. Unlike onnx it needs no cgo and no build
+// tag: importing the package is the whole opt-in. It self-registers the {type:
+// wasm} spelling through api.RegisterIteration, and cmd/stochadex blank-imports
+// it in every build.
+//
+// # Config surface
+//
+//	iteration:
+//	  type: wasm
+//	  module_path: model.wasm   # required
+//	  histories: [other]        # other partitions whose histories are sent too
+//	  timeout: 2s               # deadline per call (default 10s)
+//	  memory_limit_mb: 64       # linear memory cap (default 256, at most 4096)
+//
+// A call that misses its deadline is stopped and fails the run, as does a trap,
+// a WASI exit or a module that grows its memory past the cap; one that declares
+// a larger minimum memory fails to configure. The module gets no filesystem,
+// environment or arguments, a fake clock and a deterministic random source, so
+// the partition's seed is its only source of randomness.
+//
+// # ABI
+//
+// A module exports its linear memory as "memory" and these functions, with
+// every pointer an i32 offset into that memory:
+//
+//	alloc(size i32) -> i32
+//	configure(request i32, length i32) -> i32                 (optional)
+//	iterate(request i32, length i32, state i32) -> i32
+//
+// The host calls alloc for a buffer, writes a request at its start and calls
+// configure or iterate with the request's address and length; iterate writes
+// the next state, state_width little-endian float64s, at state, just past the
+// request in the same buffer. The buffer is reused for every call, and alloc is
+// only called again when a larger one is needed. A nonzero return fails the
+// run, quoting what the module wrote to stderr during the call. WASI
+// (wasi_snapshot_preview1) modules are supported as reactors: _initialize, if
+// exported, runs once at instantiation, and _start never runs.
+//
+// Requests are sequences of little-endian 64-bit words, each an unsigned
+// integer (u64) or a float64 (f64). Configure, called once per run, sends
+//
+//	partition_index u64, seed u64, state_width u64, state_history_depth u64,
+//	params, init_state_values f64[state_width]
+//
+// and iterate, called every step, sends
+//
+//	step u64, time f64, timestep f64, state_width u64, params,
+//	history_count u64, then history_count histories
+//
+// where params is a count u64 followed, for each param in name order, by the
+// name's byte length u64, the name in bytes padded with zeros to a whole word,
+// the value count u64 and the values f64; and each history is its state_width
+// u64, its state_history_depth u64 and its values f64, row-major, most recent
+// row first. The partition's own history comes first, then those named in
+// histories, in order.
+//
+// A Go module implements the ABI with //go:wasmexport functions and builds
+// with
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o model.wasm
+//
+// as testdata/wasm_guest does; Rust, C and Zig modules export the same
+// functions.
+package wasm
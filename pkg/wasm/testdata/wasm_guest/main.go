@@ -0,0 +1,127 @@
+//go:build wasip1
+
+// Command wasm_guest is the module the wasm iteration tests run, built with
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared
+//
+// It implements the ABI in the package documentation and misbehaves when its
+// params ask it to, so the tests can cover errors, timeouts and memory limits.
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"unsafe"
+)
+
+func main() {}
+
+// buffer is the memory handed out by alloc, kept reachable so the Go garbage
+// collector does not reclaim it while the host writes into it.
+var buffer []byte
+
+var seed uint64
+
+//go:wasmexport alloc
+func alloc(size int32) int32 {
+	buffer = make([]byte, size)
+	return int32(uintptr(unsafe.Pointer(&buffer[0])))
+}
+
+//go:wasmexport configure
+func configure(request, length int32) int32 {
+	r := reader{data: view(request, length)}
+	r.word() // partition index
+	seed = r.word()
+	r.word() // state width
+	r.word() // state history depth
+	params := r.params()
+	if _, ok := params["refuse"]; ok {
+		fmt.Fprintln(os.Stderr, "cannot configure")
+		return 1
+	}
+	return 0
+}
+
+//go:wasmexport iterate
+func iterate(request, length, output int32) int32 {
+	r := reader{data: view(request, length)}
+	step := r.word()
+	time, timestep := r.float(), r.float()
+	width := int(r.word())
+	params := r.params()
+	histories := make([][]float64, r.word())
+	depths := make([]uint64, len(histories))
+	for i := range histories {
+		historyWidth, depth := r.word(), r.word()
+		histories[i], depths[i] = r.floats(int(historyWidth*depth)), depth
+	}
+	if at, ok := params["error_at"]; ok && uint64(at[0]) == step {
+		fmt.Fprintln(os.Stderr, "bad input")
+		return 2
+	}
+	if at, ok := params["spin_at"]; ok && uint64(at[0]) == step {
+		for {
+		}
+	}
+	if at, ok := params["grow_at"]; ok && uint64(at[0]) == step {
+		buffer = make([]byte, int(params["grow_mb"][0])<<20)
+	}
+	state := make([]float64, width)
+	if len(histories) > 1 {
+		// a summary of the request
+		copy(state, []float64{
+			float64(step), time, timestep, float64(seed),
+			histories[1][0], float64(depths[1]),
+		})
+	} else {
+		for i := range state {
+			state[i] = histories[0][i] + params["drift"][i]*timestep
+		}
+	}
+	out := view(output, int32(8*width))
+	for i, value := range state {
+		binary.LittleEndian.PutUint64(out[8*i:], math.Float64bits(value))
+	}
+	return 0
+}
+
+func view(pointer, length int32) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(uintptr(pointer))), length)
+}
+
+// reader decodes the little-endian words of a request.
+type reader struct {
+	data []byte
+}
+
+func (r *reader) word() uint64 {
+	value := binary.LittleEndian.Uint64(r.data)
+	r.data = r.data[8:]
+	return value
+}
+
+func (r *reader) float() float64 {
+	return math.Float64frombits(r.word())
+}
+
+func (r *reader) floats(n int) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = r.float()
+	}
+	return values
+}
+
+func (r *reader) params() map[string][]float64 {
+	params := make(map[string][]float64)
+	for count := r.word(); count > 0; count-- {
+		length := int(r.word())
+		name := string(r.data[:length])
+		r.data = r.data[(length+7)/8*8:]
+		params[name] = r.floats(int(r.word()))
+	}
+	return params
+}
@@ -0,0 +1,427 @@
+package wasm
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	wasmapi "github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/umbralcalc/stochadex/pkg/api"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// init self-registers the wasm spelling with the engine's config surface.
+// Importing this module is the opt-in: a CLI or a downstream library that
+// blank-imports it gains {type: wasm} without the engine core depending on the
+// WebAssembly runtime.
+func init() {
+	api.RegisterIteration("wasm", BuildIteration)
+}
+
+// DefaultTimeout bounds each configure or iterate call when a WasmIteration's
+// Timeout is zero.
+const DefaultTimeout = 10 * time.Second
+
+// DefaultMemoryLimitMB caps a module's linear memory when a WasmIteration's
+// MemoryLimitMB is zero.
+const DefaultMemoryLimitMB = 256
+
+// wasmPageBytes is the size of a WebAssembly memory page.
+const wasmPageBytes = 64 << 10
+
+// maxMemoryLimitMB is the most a 32-bit linear memory can address.
+const maxMemoryLimitMB = 4 << 10
+
+// compilationCache is shared by every WasmIteration in the process, so the
+// harness's second Configure and the members of an ensemble compile each
+// module once rather than once per partition.
+var compilationCache = wazero.NewCompilationCache()
+
+// WasmIteration computes a partition's next state in a sandboxed WebAssembly
+// module, so third-party components can ship as .wasm plugins that run without
+// cgo or recompiling the engine. Configure instantiates the module and calls
+// its configure export; each step Iterate writes the params, the state
+// histories and the time into the module's memory and calls its iterate
+// export, which writes back the next state. The ABI is described in the package
+// documentation.
+//
+// Usage hints:
+//   - ModulePath is the .wasm file. WASI (wasi_snapshot_preview1) modules are
+//     supported as reactors: _initialize runs once, _start never does.
+//   - Histories names other partitions whose state histories are sent after
+//     the partition's own.
+//   - Timeout bounds each call into the module (DefaultTimeout if zero).
+//   - MemoryLimitMB caps the module's linear memory (DefaultMemoryLimitMB if
+//     zero); a module that declares or grows past it fails.
+//   - The module sees no filesystem, environment or arguments, a fake clock
+//     and a deterministic random source; its stdout and stderr pass through to
+//     the run's stderr.
+//   - Close releases the module. The iteration must be configured again before
+//     it can iterate.
+type WasmIteration struct {
+	ModulePath    string
+	Histories     []string
+	Timeout       time.Duration
+	MemoryLimitMB int
+
+	partitionName  string
+	stateWidth     int
+	historyIndices []int
+	runtime        wazero.Runtime
+	module         wasmapi.Module
+	memory         wasmapi.Memory
+	alloc          wasmapi.Function
+	iterate        wasmapi.Function
+	stderr         *tailBuffer
+	buffer         uint32
+	bufferSize     int
+	request        []byte
+	stack          []uint64
+	out            []float64
+}
+
+func (w *WasmIteration) Configure(
+	partitionIndex int,
+	settings *simulator.Settings,
+) {
+	iteration := settings.Iterations[partitionIndex]
+	w.partitionName = iteration.Name
+	w.stateWidth = iteration.StateWidth
+	w.historyIndices = []int{partitionIndex}
+	for _, name := range w.Histories {
+		index := -1
+		for i, other := range settings.Iterations {
+			if other.Name == name {
+				index = i
+			}
+		}
+		if index < 0 {
+			panic(fmt.Sprintf(
+				"wasm %q: histories names unknown partition %q", w.partitionName, name))
+		}
+		w.historyIndices = append(w.historyIndices, index)
+	}
+	if err := w.start(); err != nil {
+		panic(err)
+	}
+	request := appendWords(w.request[:0],
+		uint64(partitionIndex), iteration.Seed, uint64(iteration.StateWidth),
+		uint64(iteration.StateHistoryDepth))
+	request = appendParams(request, &iteration.Params)
+	request = appendFloats(request, iteration.InitStateValues)
+	w.request = request
+	if configure := w.module.ExportedFunction("configure"); configure != nil {
+		if err := w.call(configure, "configure", 0, 0); err != nil {
+			w.Close()
+			panic(err)
+		}
+	}
+	w.out = make([]float64, w.stateWidth)
+}
+
+func (w *WasmIteration) Iterate(
+	params *simulator.Params,
+	partitionIndex int,
+	stateHistories []*simulator.StateHistory,
+	timestepsHistory *simulator.CumulativeTimestepsHistory,
+) []float64 {
+	if w.module == nil {
+		panic(fmt.Sprintf("wasm %q: iterated after Close", w.partitionName))
+	}
+	step := timestepsHistory.CurrentStepNumber
+	request := appendWords(w.request[:0], uint64(step))
+	request = appendFloats(request, []float64{
+		timestepsHistory.Values.AtVec(0), timestepsHistory.NextIncrement,
+	})
+	request = appendWords(request, uint64(w.stateWidth))
+	request = appendParams(request, params)
+	request = appendWords(request, uint64(len(w.historyIndices)))
+	for _, index := range w.historyIndices {
+		history := stateHistories[index]
+		request = appendWords(request,
+			uint64(history.StateWidth), uint64(history.StateHistoryDepth))
+		for row := 0; row < history.StateHistoryDepth; row++ {
+			request = appendFloats(request, history.Values.RawRowView(row))
+		}
+	}
+	w.request = request
+	if err := w.call(w.iterate, "iterate", step, 8*w.stateWidth); err != nil {
+		panic(err)
+	}
+	state, ok := w.memory.Read(w.buffer+uint32(len(w.request)), uint32(8*w.stateWidth))
+	if !ok {
+		panic(fmt.Sprintf("wasm %q: state buffer is outside the module's memory",
+			w.partitionName))
+	}
+	for i := range w.out {
+		w.out[i] = math.Float64frombits(binary.LittleEndian.Uint64(state[8*i:]))
+	}
+	return w.out
+}
+
+// Close releases the module and its runtime.
+func (w *WasmIteration) Close() error {
+	if w.runtime == nil {
+		return nil
+	}
+	err := w.runtime.Close(context.Background())
+	w.runtime = nil
+	w.module = nil
+	w.memory = nil
+	return err
+}
+
+// start closes any running module, then compiles and instantiates a new one
+// under the configured memory limit.
+func (w *WasmIteration) start() error {
+	w.Close()
+	if w.ModulePath == "" {
+		return fmt.Errorf("wasm %q: no module_path given", w.partitionName)
+	}
+	limit := w.MemoryLimitMB
+	if limit == 0 {
+		limit = DefaultMemoryLimitMB
+	}
+	if limit < 0 || limit > maxMemoryLimitMB {
+		return fmt.Errorf("wasm %q: memory_limit_mb must be between 1 and %d, got %d",
+			w.partitionName, maxMemoryLimitMB, limit)
+	}
+	code, err := os.ReadFile(w.ModulePath)
+	if err != nil {
+		return fmt.Errorf("wasm %q: %w", w.partitionName, err)
+	}
+	ctx := context.Background()
+	w.runtime = wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithCompilationCache(compilationCache).
+		WithMemoryLimitPages(uint32(limit*(1<<20)/wasmPageBytes)).
+		WithCloseOnContextDone(true))
+	fail := func(err error) error {
+		w.Close()
+		return fmt.Errorf("wasm %q: module %q: %w", w.partitionName, w.ModulePath, err)
+	}
+	compiled, err := w.runtime.CompileModule(ctx, code)
+	if err != nil {
+		return fail(err)
+	}
+	for _, function := range compiled.ImportedFunctions() {
+		if module, _, _ := function.Import(); module == wasi_snapshot_preview1.ModuleName {
+			wasi_snapshot_preview1.MustInstantiate(ctx, w.runtime)
+			break
+		}
+	}
+	w.stderr = &tailBuffer{}
+	output := io.MultiWriter(os.Stderr, w.stderr)
+	w.module, err = w.runtime.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize").
+		WithStdout(output).
+		WithStderr(output))
+	if err != nil {
+		return fail(w.trapped(err))
+	}
+	w.memory = w.module.Memory()
+	w.alloc = w.module.ExportedFunction("alloc")
+	w.iterate = w.module.ExportedFunction("iterate")
+	switch {
+	case w.memory == nil:
+		return fail(errors.New("module exports no memory"))
+	case w.alloc == nil:
+		return fail(errors.New("module does not export alloc"))
+	case w.iterate == nil:
+		return fail(errors.New("module does not export iterate"))
+	}
+	w.buffer, w.bufferSize = 0, 0
+	w.stack = make([]uint64, 3)
+	return nil
+}
+
+// call writes the pending request into the module's buffer, growing it by
+// asking alloc for a larger one if needed, and calls function with the
+// request's address and length and the address just past it, where the module
+// writes its output of outputSize bytes.
+func (w *WasmIteration) call(
+	function wasmapi.Function,
+	name string,
+	step int,
+	outputSize int,
+) error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout())
+	defer cancel()
+	w.stderr.Reset()
+	fail := func(err error) error {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("no result within %v", w.timeout())
+		}
+		return fmt.Errorf("wasm %q: %s failed at step %d: %w",
+			w.partitionName, name, step, err)
+	}
+	if size := len(w.request) + outputSize; size > w.bufferSize {
+		w.stack[0] = uint64(size)
+		if err := w.alloc.CallWithStack(ctx, w.stack); err != nil {
+			return fail(w.trapped(err))
+		}
+		w.buffer, w.bufferSize = uint32(w.stack[0]), size
+	}
+	if !w.memory.Write(w.buffer, w.request) {
+		return fail(fmt.Errorf("alloc returned %d, outside the module's memory", w.buffer))
+	}
+	w.stack[0] = uint64(w.buffer)
+	w.stack[1] = uint64(len(w.request))
+	w.stack[2] = uint64(w.buffer) + uint64(len(w.request))
+	if err := function.CallWithStack(ctx, w.stack); err != nil {
+		return fail(w.trapped(err))
+	}
+	if status := int32(w.stack[0]); status != 0 {
+		message := strings.TrimSpace(w.stderr.String())
+		if message == "" {
+			message = "(no stderr)"
+		}
+		return fail(fmt.Errorf("module returned status %d: %s", status, message))
+	}
+	return nil
+}
+
+// trapped adds what the module wrote to stderr during the failed call, e.g. a
+// Go guest's panic message, to the error from a trap or exit.
+func (w *WasmIteration) trapped(err error) error {
+	if tail := strings.TrimSpace(w.stderr.String()); tail != "" {
+		return fmt.Errorf("%w; stderr: %s", err, tail)
+	}
+	return err
+}
+
+func (w *WasmIteration) timeout() time.Duration {
+	if w.Timeout > 0 {
+		return w.Timeout
+	}
+	return DefaultTimeout
+}
+
+// appendWords appends each value as a little-endian 64-bit word.
+func appendWords(request []byte, values ...uint64) []byte {
+	for _, value := range values {
+		request = binary.LittleEndian.AppendUint64(request, value)
+	}
+	return request
+}
+
+// appendFloats appends each value as a little-endian float64.
+func appendFloats(request []byte, values []float64) []byte {
+	for _, value := range values {
+		request = binary.LittleEndian.AppendUint64(request, math.Float64bits(value))
+	}
+	return request
+}
+
+// appendParams appends the params block: a count, then for each param in name
+// order its name length, its name padded to a whole word, its value count and
+// its values.
+func appendParams(request []byte, params *simulator.Params) []byte {
+	names := make([]string, 0, len(params.Map))
+	for name := range params.Map {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	request = appendWords(request, uint64(len(names)))
+	for _, name := range names {
+		request = appendWords(request, uint64(len(name)))
+		request = append(request, name...)
+		for len(request)%8 != 0 {
+			request = append(request, 0)
+		}
+		values := params.Map[name]
+		request = appendWords(request, uint64(len(values)))
+		request = appendFloats(request, values)
+	}
+	return request
+}
+
+// tailBuffer keeps the last 2KB written to it since its last Reset, so an
+// error can quote the end of a module's stderr without holding all of it.
+type tailBuffer struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (t *tailBuffer) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.data = append(t.data, b...)
+	if excess := len(t.data) - 2048; excess > 0 {
+		t.data = append(t.data[:0], t.data[excess:]...)
+	}
+	return len(b), nil
+}
+
+func (t *tailBuffer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.data = t.data[:0]
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.data)
+}
+
+// BuildIteration constructs a WasmIteration from a data spec, validating fields
+// strictly (an unknown key is an error, matching the rest of the config
+// surface).
+func BuildIteration(spec simulator.ComponentSpec) (simulator.Iteration, error) {
+	iteration := &WasmIteration{}
+	for key, value := range spec.Fields {
+		switch key {
+		case "module_path":
+			path, ok := value.(string)
+			if !ok || path == "" {
+				return nil, fmt.Errorf("wasm: module_path must be a non-empty string")
+			}
+			iteration.ModulePath = path
+		case "histories":
+			items, ok := value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("wasm: histories must be a list of partition names")
+			}
+			for _, item := range items {
+				name, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("wasm: histories must be a list of partition names")
+				}
+				iteration.Histories = append(iteration.Histories, name)
+			}
+		case "timeout":
+			text, ok := value.(string)
+			timeout, err := time.ParseDuration(text)
+			if !ok || err != nil || timeout <= 0 {
+				return nil, fmt.Errorf(
+					"wasm: timeout must be a positive duration such as \"2s\", got %v", value)
+			}
+			iteration.Timeout = timeout
+		case "memory_limit_mb":
+			limit, ok := value.(int)
+			if !ok || limit <= 0 || limit > maxMemoryLimitMB {
+				return nil, fmt.Errorf(
+					"wasm: memory_limit_mb must be an integer between 1 and %d, got %v",
+					maxMemoryLimitMB, value)
+			}
+			iteration.MemoryLimitMB = limit
+		default:
+			return nil, fmt.Errorf("wasm: unknown field %q", key)
+		}
+	}
+	if iteration.ModulePath == "" {
+		return nil, fmt.Errorf("wasm: module_path is required")
+	}
+	return iteration, nil
+}
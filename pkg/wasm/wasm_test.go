@@ -0,0 +1,218 @@
+package wasm
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/umbralcalc/stochadex/pkg/api"
+	"github.com/umbralcalc/stochadex/pkg/simulator"
+)
+
+// buildWasmGuest builds testdata/wasm_guest into a WASI reactor module in a
+// temporary directory and returns its path.
+func buildWasmGuest(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "guest.wasm")
+	command := exec.Command("go", "build", "-buildmode=c-shared", "-o", path, ".")
+	command.Dir = "./testdata/wasm_guest"
+	command.Env = append(command.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if output, err := command.CombinedOutput(); err != nil {
+		t.Skipf("cannot build the wasm guest: %v\n%s", err, output)
+	}
+	return path
+}
+
+// wasmRun builds a coordinator over wasm_settings.yaml from walk and a summary
+// partition that runs guest, after setting the walk's extra params.
+func wasmRun(
+	t *testing.T,
+	guest string,
+	walk *WasmIteration,
+	walkParams map[string][]float64,
+	steps int,
+) (*simulator.PartitionCoordinator, *simulator.StateTimeStorage) {
+	t.Helper()
+	settings := simulator.LoadSettingsFromYaml("./wasm_settings.yaml")
+	for name, values := range walkParams {
+		settings.Iterations[0].Params.Set(name, values)
+	}
+	summary := &WasmIteration{ModulePath: guest, Histories: []string{"walk"}}
+	iterations := []simulator.Iteration{walk, summary}
+	for index, iteration := range iterations {
+		iteration.Configure(index, settings)
+	}
+	t.Cleanup(func() {
+		walk.Close()
+		summary.Close()
+	})
+	store := simulator.NewStateTimeStorage()
+	implementations := &simulator.Implementations{
+		Iterations:      iterations,
+		OutputCondition: &simulator.EveryStepOutputCondition{},
+		OutputFunction:  &simulator.StateTimeStorageOutputFunction{Store: store},
+		TerminationCondition: &simulator.NumberOfStepsTerminationCondition{
+			MaxNumberOfSteps: steps,
+		},
+		TimestepFunction: &simulator.ConstantTimestepFunction{Stepsize: 0.5},
+	}
+	return simulator.NewPartitionCoordinator(settings, implementations), store
+}
+
+func TestWasm(t *testing.T) {
+	guest := buildWasmGuest(t)
+	t.Run(
+		"test that the wasm iteration runs",
+		func(t *testing.T) {
+			walk := &WasmIteration{ModulePath: guest}
+			coordinator, store := wasmRun(t, guest, walk, nil, 10)
+			coordinator.Run()
+			walkValues := store.GetValues("walk")
+			if final := walkValues[len(walkValues)-1]; final[0] != 5.0 || final[1] != 7.5 {
+				t.Errorf("unexpected final walk state: %v", final)
+			}
+			// step, time, timestep, seed, the walk's latest value and its depth
+			summary := store.GetValues("summary")
+			want := []float64{3, 1.0, 0.5, 42, 1.0, 2}
+			for i, value := range summary[3] {
+				if value != want[i] {
+					t.Errorf("unexpected request summary at step 3: %v, want %v",
+						summary[3], want)
+					break
+				}
+			}
+		},
+	)
+	t.Run(
+		"test that the wasm iteration runs with harnesses",
+		func(t *testing.T) {
+			settings := simulator.LoadSettingsFromYaml("./wasm_settings.yaml")
+			walk := &WasmIteration{ModulePath: guest}
+			summary := &WasmIteration{ModulePath: guest, Histories: []string{"walk"}}
+			defer walk.Close()
+			defer summary.Close()
+			implementations := &simulator.Implementations{
+				Iterations:      []simulator.Iteration{walk, summary},
+				OutputCondition: &simulator.EveryStepOutputCondition{},
+				OutputFunction:  &simulator.NilOutputFunction{},
+				TerminationCondition: &simulator.NumberOfStepsTerminationCondition{
+					MaxNumberOfSteps: 20,
+				},
+				TimestepFunction: &simulator.ConstantTimestepFunction{Stepsize: 1.0},
+			}
+			if err := simulator.RunWithHarnesses(settings, implementations); err != nil {
+				t.Errorf("test harness failed: %v", err)
+			}
+		},
+	)
+	t.Run(
+		"test that the wasm iteration resolves through the registry",
+		func(t *testing.T) {
+			iteration, err := api.ResolveIteration(simulator.ComponentSpec{
+				Type: "wasm",
+				Fields: map[string]interface{}{
+					"module_path":     guest,
+					"histories":       []interface{}{"walk"},
+					"timeout":         "2s",
+					"memory_limit_mb": 64,
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			wasm := iteration.(*WasmIteration)
+			if wasm.Timeout != 2*time.Second || wasm.MemoryLimitMB != 64 ||
+				len(wasm.Histories) != 1 {
+				t.Errorf("unexpected iteration: %+v", wasm)
+			}
+			for _, fields := range []map[string]interface{}{
+				{},
+				{"module_path": guest, "timeout": "soon"},
+				{"module_path": guest, "memory_limit_mb": 0},
+				{"module_path": guest, "memory_limit_mb": 8192},
+				{"module_path": guest, "entry": "main"},
+			} {
+				if _, err := BuildIteration(simulator.ComponentSpec{
+					Type: "wasm", Fields: fields,
+				}); err == nil {
+					t.Errorf("expected %v to be rejected", fields)
+				}
+			}
+		},
+	)
+	t.Run(
+		"test that an error status stops the run with the module's stderr",
+		func(t *testing.T) {
+			walk := &WasmIteration{ModulePath: guest}
+			coordinator, _ := wasmRun(t, guest, walk,
+				map[string][]float64{"error_at": {2}}, 5)
+			err := coordinator.RunContext(t.Context())
+			if err == nil || !strings.Contains(err.Error(), "iterate failed at step 2") ||
+				!strings.Contains(err.Error(), "status 2: bad input") {
+				t.Errorf("expected the error status, got %v", err)
+			}
+		},
+	)
+	t.Run(
+		"test that a call is stopped at the timeout",
+		func(t *testing.T) {
+			walk := &WasmIteration{ModulePath: guest, Timeout: 200 * time.Millisecond}
+			coordinator, _ := wasmRun(t, guest, walk,
+				map[string][]float64{"spin_at": {2}}, 5)
+			start := time.Now()
+			err := coordinator.RunContext(t.Context())
+			if err == nil || !strings.Contains(err.Error(), "no result within 200ms") {
+				t.Errorf("expected a timeout, got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("the timeout took %v", elapsed)
+			}
+		},
+	)
+	t.Run(
+		"test that memory growth past the limit stops the run",
+		func(t *testing.T) {
+			grow := map[string][]float64{"grow_at": {2}, "grow_mb": {128}}
+			walk := &WasmIteration{ModulePath: guest, MemoryLimitMB: 512}
+			coordinator, _ := wasmRun(t, guest, walk, grow, 5)
+			if err := coordinator.RunContext(t.Context()); err != nil {
+				t.Fatalf("growth within the limit failed: %v", err)
+			}
+			walk = &WasmIteration{ModulePath: guest, MemoryLimitMB: 64}
+			coordinator, _ = wasmRun(t, guest, walk, grow, 5)
+			err := coordinator.RunContext(t.Context())
+			if err == nil || !strings.Contains(err.Error(), "iterate failed at step 2") {
+				t.Errorf("expected the allocation to fail, got %v", err)
+			}
+		},
+	)
+	t.Run(
+		"test that configuration errors panic",
+		func(t *testing.T) {
+			for name, iteration := range map[string]*WasmIteration{
+				"refused":           {ModulePath: guest},
+				"missing module":    {ModulePath: filepath.Join(t.TempDir(), "missing.wasm")},
+				"not a module":      {ModulePath: "./wasm_settings.yaml"},
+				"unknown history":   {ModulePath: guest, Histories: []string{"nope"}},
+				"too little memory": {ModulePath: guest, MemoryLimitMB: 1},
+				"no module given":   {},
+			} {
+				settings := simulator.LoadSettingsFromYaml("./wasm_settings.yaml")
+				if name == "refused" {
+					settings.Iterations[0].Params.Set("refuse", []float64{1})
+				}
+				func() {
+					defer func() {
+						if recover() == nil {
+							t.Errorf("%s: expected Configure to panic", name)
+						}
+					}()
+					iteration.Configure(0, settings)
+				}()
+				iteration.Close()
+			}
+		},
+	)
+}